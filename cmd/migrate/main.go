@@ -2,59 +2,215 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/repository/postgres"
+	"github.com/golang-migrate/migrate/v4"
 	"github.com/joho/godotenv"
 )
 
+const usage = `Usage: migrate <command> [args]
+
+Commands:
+  up               Apply all pending migrations
+  down N           Roll back the last N migrations
+  force VERSION    Mark VERSION as applied and clear the dirty flag
+  version          Print the current schema version
+  create NAME      Scaffold NNN_NAME.up.sql and NNN_NAME.down.sql
+  trim-results     Trim results stored with answers to STORED_RESULT_MAX_ROWS and
+                   STORED_RESULT_MAX_BYTES, for results stored before the limits
+
+The migrations source is read from MIGRATION_SOURCE (default file://./migrations).`
+
 func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	// Load configuration
+	if err := run(os.Args[1], os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(command string, args []string) error {
+	source := postgres.MigrationSource()
+
+	// Validate arguments before connecting
+	var n int
+	var err error
+	switch command {
+	case "create":
+		if len(args) != 1 {
+			return errors.New("usage: migrate create NAME")
+		}
+		return create(source, args[0])
+	case "down":
+		n, err = positiveArg(args, "down N")
+	case "force":
+		n, err = positiveArg(args, "force VERSION")
+	case "up", "version", "trim-results":
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", command, usage)
+	}
+	if err != nil {
+		return err
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
-		panic(fmt.Sprintf("Failed to load config: %v", err))
+		return fmt.Errorf("failed to load config: %w", err)
 	}
 
 	fmt.Printf("Connecting to database at %s:%d...\n", cfg.Database.Host, cfg.Database.Port)
 
-	// Connect to database
-	db, err := postgres.NewDB(context.Background(), cfg.Database)
+	if command == "trim-results" {
+		return trimResults(cfg.Database)
+	}
+
+	m, err := postgres.NewMigrator(cfg.Database.DSN(), source)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch command {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Steps(-n)
+	case "force":
+		err = m.Force(n)
+	}
+	if errors.Is(err, migrate.ErrNoChange) {
+		fmt.Println("No changes")
+	} else if err != nil {
+		return describeError(err)
+	}
+
+	return printVersion(m)
+}
+
+// trimResultsBatch is the number of messages read at a time by trim-results
+const trimResultsBatch = 500
+
+// trimResults applies the stored result limits to the results already stored
+func trimResults(cfg config.DatabaseConfig) error {
+	if cfg.StoredResultMaxRows <= 0 && cfg.StoredResultMaxBytes <= 0 {
+		return errors.New("no stored result limit is set: set STORED_RESULT_MAX_ROWS or STORED_RESULT_MAX_BYTES")
+	}
+
+	ctx := context.Background()
+	db, err := postgres.NewDB(ctx, cfg)
 	if err != nil {
-		panic(fmt.Sprintf("Failed to connect to database: %v", err))
+		return err
 	}
 	defer db.Close()
 
-	// Get migration files
-	files, err := filepath.Glob("migrations/*.up.sql")
+	repo := postgres.NewMessageRepository(db.Pool).WithResultLimit(domain.StoredResultLimit{
+		MaxRows:  cfg.StoredResultMaxRows,
+		MaxBytes: cfg.StoredResultMaxBytes,
+	})
+	trimmed, err := repo.TrimStoredResults(ctx, trimResultsBatch)
+	fmt.Printf("Trimmed %d stored results to %d rows and %d bytes\n", trimmed, cfg.StoredResultMaxRows, cfg.StoredResultMaxBytes)
+	return err
+}
+
+// printVersion reports the schema version and fails if the last run left it dirty
+func printVersion(m *migrate.Migrate) error {
+	version, dirty, err := m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		fmt.Println("Version: none (no migrations applied)")
+		return nil
+	}
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to read version: %w", err)
+	}
+	if dirty {
+		return describeError(migrate.ErrDirty{Version: int(version)})
 	}
-	sort.Strings(files)
 
-	for _, file := range files {
-		fmt.Printf("Applying migration: %s\n", file)
-		content, err := os.ReadFile(file)
-		if err != nil {
-			panic(err)
+	fmt.Printf("Version: %d\n", version)
+	return nil
+}
+
+// describeError adds recovery instructions to a dirty-state error
+func describeError(err error) error {
+	var dirty migrate.ErrDirty
+	if errors.As(err, &dirty) {
+		return fmt.Errorf("database is dirty at version %d: the last migration failed part-way. "+
+			"Fix the schema by hand, then run `migrate force %d` (or the previous version to retry it)",
+			dirty.Version, dirty.Version)
+	}
+	return err
+}
+
+func positiveArg(args []string, usage string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("usage: migrate %s", usage)
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("usage: migrate %s (expected a positive integer, got %q)", usage, args[0])
+	}
+	return n, nil
+}
+
+var (
+	migrationFileRe = regexp.MustCompile(`^(\d+)_.*\.(up|down)\.sql$`)
+	migrationNameRe = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// create scaffolds the next numbered pair of up/down migration files
+func create(source, name string) error {
+	if !strings.HasPrefix(source, "file://") {
+		return fmt.Errorf("create only supports file:// sources, got %s", source)
+	}
+	dir := strings.TrimPrefix(source, "file://")
+
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !migrationNameRe.MatchString(name) {
+		return errors.New("migration name may only contain letters, digits and underscores")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read migrations directory: %w", err)
+	}
+
+	next := 1
+	for _, entry := range entries {
+		if m := migrationFileRe.FindStringSubmatch(entry.Name()); m != nil {
+			if v, _ := strconv.Atoi(m[1]); v >= next {
+				next = v + 1
+			}
 		}
+	}
 
-		// Split by semicolon to handle multiple statements if needed,
-		// but pgx pool.Exec might handle it. Let's try executing the whole block.
-		_, err = db.Pool.Exec(context.Background(), string(content))
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%03d_%s.%s.sql", next, name, direction))
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
 		if err != nil {
-			fmt.Printf("⚠️  Error applying %s: %v\n", file, err)
-			// Don't exit, just continue. This mimics the "NOTICE: relation exists, skipping" behavior
-			// if the SQL uses "IF NOT EXISTS", or just fails if it doesn't.
-			// Ideally we should have a schema_migrations table, but for now this is the fix.
-		} else {
-			fmt.Printf("✅ %s applied successfully\n", file)
+			return fmt.Errorf("failed to create migration: %w", err)
 		}
+		f.Close()
+		fmt.Printf("Created %s\n", path)
 	}
+
+	return nil
 }
@@ -12,10 +12,14 @@ import (
 
 	"github.com/Rrens/text-to-sql/internal/api"
 	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/lifecycle"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/observability"
 	"github.com/Rrens/text-to-sql/internal/repository/postgres"
 	"github.com/Rrens/text-to-sql/internal/repository/redis"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/Rrens/text-to-sql/internal/service"
 	"github.com/joho/godotenv"
-	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -55,54 +59,55 @@ func main() {
 		fmt.Println("Warning: .env file not found in any standard location")
 	}
 
-	// Debug: print key env vars to verify loading
-	geminiKey := os.Getenv("GEMINI_API_KEY")
-	keyPreview := ""
-	if len(geminiKey) >= 10 {
-		keyPreview = geminiKey[:10]
-	}
-	fmt.Printf("DEBUG ENV: SERVER_PORT=%s, POSTGRES_HOST=%s, GEMINI_API_KEY=%s..., OLLAMA_HOST=%s\n",
-		os.Getenv("SERVER_PORT"),
-		os.Getenv("POSTGRES_HOST"),
-		keyPreview,
-		os.Getenv("OLLAMA_HOST"),
-	)
-
-	// Setup logger with rotation
+	// Log to the console until the logging configuration is loaded
 	zerolog.TimeFieldFormat = time.RFC3339
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-	// Ensure logs directory exists
-	if err := os.MkdirAll("logs", 0755); err != nil {
-		fmt.Printf("Failed to create logs directory: %v\n", err)
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
 	}
-
-	// Configure log rotation
-	logFile := "logs/app-%Y-%m-%d-%H.log"
-	rotator, err := rotatelogs.New(
-		logFile,
-		rotatelogs.WithRotationTime(time.Hour),
-		rotatelogs.WithMaxAge(7*24*time.Hour), // Keep logs for 7 days
-	)
+	if err := cfg.Validate(); err != nil {
+		// Before anything is opened, so a bad deploy fails immediately
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	prompts, err := llm.LoadPromptTemplates(cfg.LLM.PromptTemplateDir)
 	if err != nil {
-		fmt.Printf("Failed to initialize log rotation: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	llm.UsePromptTemplates(prompts)
 
-	// Multi-writer: Console + File
-	// Console writer (pretty print for dev)
-	consoleWriter := zerolog.ConsoleWriter{Out: os.Stderr}
-
-	if rotator != nil {
-		multi := zerolog.MultiLevelWriter(consoleWriter, rotator)
-		log.Logger = zerolog.New(multi).With().Timestamp().Logger()
-	} else {
-		log.Logger = log.Output(consoleWriter)
+	logger, level, err := observability.NewLogger(cfg.Logging, os.Stderr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure logging")
 	}
+	zerolog.SetGlobalLevel(level)
+	// Log lines written with a request context carry its trace and span IDs
+	log.Logger = logger.Hook(observability.TraceHook{})
 
-	// Load configuration
-	cfg, err := config.Load()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to load configuration")
+	event := log.Info().
+		Str("level", level.String()).
+		Str("format", cfg.Logging.Format).
+		Bool("file", cfg.Logging.File.Enabled)
+	if cfg.Logging.File.Enabled {
+		event = event.
+			Str("file_path", cfg.Logging.File.Path).
+			Dur("rotation_time", cfg.Logging.File.RotationTime).
+			Dur("max_age", cfg.Logging.File.MaxAge)
 	}
+	event.Msg("Logging configured")
+
+	log.Info().
+		Str("environment", cfg.Server.Environment).
+		Str("postgres", fmt.Sprintf("%s:%d/%s", cfg.Database.Host, cfg.Database.Port, cfg.Database.Database)).
+		Str("redis", cfg.Redis.Addr()).
+		Strs("llm_providers", cfg.LLM.ConfiguredProviders()).
+		Str("default_provider", cfg.LLM.DefaultProvider).
+		Str("prompt_template", prompts.Version(llm.TemplateSQLGeneration)).
+		Msg("Configuration loaded")
 
 	log.Info().
 		Str("host", cfg.Server.Host).
@@ -111,37 +116,74 @@ func main() {
 
 	log.Info().Msg("Made by Rendy Yusuf (https://www.linkedin.com/in/rendy-yusuf)")
 
+	// Tracing is a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := observability.InitTracing(context.Background(), "text-to-sql")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to initialize tracing")
+	}
+
 	// Initialize database
 	db, err := postgres.NewDB(context.Background(), cfg.Database)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 	}
-	defer db.Close()
+
+	// Background work is stopped and pools are closed on shutdown, in reverse order
+	lc := lifecycle.NewManager()
+	lc.OnClose("postgres", func() error {
+		db.Close()
+		return nil
+	})
 
 	// Run database migrations
-	migrationSource := "file://./migrations" // Default relative path
-	if os.Getenv("MIGRATION_SOURCE") != "" {
-		migrationSource = os.Getenv("MIGRATION_SOURCE")
-	}
-	// In Docker, we copy migrations to /app/migrations
-	if _, err := os.Stat("/app/migrations"); err == nil {
-		migrationSource = "file:///app/migrations"
-	}
+	migrationSource := postgres.MigrationSource()
 
 	log.Info().Msgf("Running migrations from %s", migrationSource)
 	if err := postgres.RunMigrations(cfg.Database.DSN(), migrationSource); err != nil {
 		log.Fatal().Err(err).Msg("Failed to run database migrations")
 	}
 
+	// Encrypt LLM API keys stored in plaintext by earlier versions
+	encryptor, err := security.NewEncryptorFromSecret(cfg.Auth.JWTSecret)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize encryptor")
+	}
+	userRepo := postgres.NewUserRepository(db)
+	if n, err := service.BackfillLLMConfigEncryption(context.Background(), userRepo, encryptor); err != nil {
+		log.Error().Err(err).Msg("Failed to encrypt stored LLM API keys")
+	} else if n > 0 {
+		log.Info().Int("users", n).Msg("Encrypted stored LLM API keys")
+	}
+	if n, err := userRepo.PromoteAdmins(context.Background(), cfg.Auth.AdminEmails); err != nil {
+		log.Error().Err(err).Msg("Failed to promote admin users")
+	} else if n > 0 {
+		log.Info().Int64("users", n).Msg("Promoted admin users")
+	}
+
+	// Purge deleted sessions once their restore window has passed
+	lc.Go(service.NewRetentionJanitor(postgres.NewSessionRepository(db.Pool), time.Hour).Run)
+
+	// Flag uploaded files whose connection has been deleted
+	uploadService := service.NewUploadService(
+		postgres.NewUploadRepository(db.Pool),
+		postgres.NewConnectionRepository(db),
+		postgres.NewWorkspaceRepository(db),
+		cfg.Server.UploadDir,
+	)
+	lc.Go(func(ctx context.Context) { uploadService.RunOrphanSweep(ctx, time.Hour) })
+
+	// Send queued webhook deliveries and retry failed ones
+	lc.Go(service.NewWebhookDispatcher(postgres.NewWebhookRepository(db.Pool), encryptor, 5*time.Second).Run)
+
 	// Initialize Redis
 	redisClient, err := redis.NewClient(cfg.Redis)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to Redis")
 	}
-	defer redisClient.Close()
+	lc.OnClose("redis", redisClient.Close)
 
 	// Initialize router
-	router := api.NewRouter(cfg, db, redisClient)
+	router := api.NewRouter(cfg, db, redisClient, lc)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -171,9 +213,17 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	// Stop accepting connections and drain in-flight requests first, then stop
+	// background work and close adapter, Redis and database pools
 	if err := server.Shutdown(ctx); err != nil {
 		log.Error().Err(err).Msg("Server forced to shutdown")
 	}
+	if err := lc.Shutdown(ctx); err != nil {
+		log.Error().Err(err).Msg("Background work did not shut down cleanly")
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error().Err(err).Msg("Failed to flush traces")
+	}
 
 	log.Info().Msg("Server stopped")
 }
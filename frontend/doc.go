@@ -0,0 +1,3 @@
+// Package frontend embeds the built web UI when compiled with the embedfrontend build
+// tag. Run "npm run build" in this directory first so that dist/ exists.
+package frontend
@@ -0,0 +1,20 @@
+//go:build embedfrontend
+
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns the built frontend embedded in the binary
+func Dist() (fs.FS, bool) {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		return nil, false
+	}
+	return sub, true
+}
@@ -0,0 +1,10 @@
+//go:build !embedfrontend
+
+package frontend
+
+import "io/fs"
+
+// Dist reports that this build does not embed the frontend
+func Dist() (fs.FS, bool) {
+	return nil, false
+}
@@ -7,6 +7,9 @@ interface Session {
   id: string;
   title: string;
   created_at: string;
+  message_count: number;
+  last_message_at?: string;
+  last_message_preview?: string;
 }
 
 interface SidebarProps {
@@ -67,7 +70,13 @@ const Sidebar = ({
                 )}
               >
                 <MessageSquare className="w-4 h-4 shrink-0 opacity-70" />
-                <span className="truncate flex-1">{session.title}</span>
+                <div className="flex-1 min-w-0">
+                  <div className="truncate">{session.title}</div>
+                  {session.last_message_preview && (
+                    <div className="truncate text-xs text-gray-500">{session.last_message_preview}</div>
+                  )}
+                </div>
+                <span className="text-xs text-gray-500 shrink-0">{session.message_count}</span>
                 
                 {/* Delete button (visible on hover) */}
                 {(hoveredSession === session.id || currentSessionId === session.id) && (
@@ -1,7 +1,7 @@
 import { useState } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
 import { useAuth } from '../context/AuthContext';
-import api from '../services/api';
+import api, { apiErrorMessage } from '../services/api';
 import { Lock, Mail, Loader2, Sparkles } from 'lucide-react';
 import { motion } from 'framer-motion';
 import { GoogleLogin } from '@react-oauth/google';
@@ -29,7 +29,7 @@ const Login = () => {
         navigate('/');
       }
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to login');
+      setError(apiErrorMessage(err, 'Failed to login'));
     } finally {
       setLoading(false);
     }
@@ -48,7 +48,7 @@ const Login = () => {
         navigate('/');
       }
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to login with Google');
+      setError(apiErrorMessage(err, 'Failed to login with Google'));
     } finally {
       setLoading(false);
     }
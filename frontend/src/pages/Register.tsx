@@ -1,6 +1,6 @@
 import { useState } from 'react';
 import { useNavigate, Link } from 'react-router-dom';
-import api from '../services/api';
+import api, { apiErrorMessage } from '../services/api';
 import { Lock, Mail, Loader2, UserPlus, User } from 'lucide-react';
 import { motion } from 'framer-motion';
 import { GoogleLogin } from '@react-oauth/google';
@@ -28,7 +28,7 @@ const Register = () => {
         navigate('/login', { state: { message: 'Registration successful! Please login.' } });
       }
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to register');
+      setError(apiErrorMessage(err, 'Failed to register'));
     } finally {
       setLoading(false);
     }
@@ -46,7 +46,7 @@ const Register = () => {
         navigate('/');
       }
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to register with Google');
+      setError(apiErrorMessage(err, 'Failed to register with Google'));
     } finally {
       setLoading(false);
     }
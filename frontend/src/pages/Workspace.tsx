@@ -1,7 +1,7 @@
 import { useState, useEffect, useRef, useMemo } from 'react';
 import { useParams, Link, useNavigate } from 'react-router-dom';
 import { fetchAvailableModels } from '../services/llmModels';
-import api from '../services/api';
+import api, { apiErrorMessage } from '../services/api';
 import { userService } from '../services/user';
 import { useAuth } from '../context/AuthContext';
 import { 
@@ -44,6 +44,9 @@ interface Session {
     id: string;
     title: string;
     created_at: string;
+    message_count: number;
+    last_message_at?: string;
+    last_message_preview?: string;
 }
 
 const Workspace = () => {
@@ -190,11 +193,11 @@ const Workspace = () => {
               deepseek: { api_key: llmConfigForm.deepseek_key },
               gemini: { api_key: llmConfigForm.gemini_key }
           };
-          const updatedUser = await userService.updateLLMConfig(config);
+          const updated = await userService.updateLLMConfig(config);
           // Update user in context (we need token, assume it's same)
           const token = localStorage.getItem('token');
-          if (token && updatedUser && updatedUser.data) {
-              login(token, updatedUser.data);
+          if (token && user && updated && updated.data) {
+              login(token, { ...user, llm_config: updated.data });
           }
           setIsLLMSaved(true);
       } catch (error) {
@@ -210,9 +213,12 @@ const Workspace = () => {
     fetchProviders();
     fetchProviders();
     fetchSessions(); 
-    fetchSuggestions();
   }, [workspaceId]);
 
+  useEffect(() => {
+    fetchSuggestions();
+  }, [workspaceId, selectedConnection]);
+
   useEffect(() => {
     // Save to local storage whenever provider changes
     localStorage.setItem('mcp_last_provider', selectedProvider);
@@ -285,7 +291,7 @@ const Workspace = () => {
 
   const fetchProviders = async () => {
     try {
-      const res = await api.get('/llm-providers');
+      const res = await api.get('/llm-providers', { params: { workspace_id: workspaceId } });
       if (res.data.success) {
         setProviders(res.data.data.providers);
         // Only use backend default if we don't have a saved one
@@ -305,7 +311,7 @@ const Workspace = () => {
     try {
         const res = await api.get(`/workspaces/${workspaceId}/sessions`);
         if (res.data.success) {
-            setSessions(res.data.data || []);
+            setSessions(res.data.data?.items || []);
         }
     } catch (err) {
         console.error("Failed to fetch sessions", err);
@@ -317,7 +323,9 @@ const Workspace = () => {
   const fetchSuggestions = async () => {
 
     try {
-        const res = await api.get(`/workspaces/${workspaceId}/suggestions`);
+        const res = await api.get(`/workspaces/${workspaceId}/suggestions`, {
+            params: selectedConnection ? { connection_id: selectedConnection } : undefined,
+        });
         if (res.data.success && res.data.data && res.data.data.length > 0) {
             setSuggestions(res.data.data);
         } else {
@@ -512,17 +520,7 @@ const Workspace = () => {
               setTestConnectionResult({ success: false, message: res.data.data?.error || 'Connection failed' });
           }
       } catch (error: unknown) {
-          const err = error as { response?: { data?: { error?: string | { error?: string } } } };
-          let errorMessage = 'Connection test failed';
-          const backendError = err.response?.data?.error;
-          
-          if (typeof backendError === 'string') {
-              errorMessage = backendError;
-          } else if (typeof backendError === 'object' && backendError?.error) {
-              errorMessage = backendError.error;
-          }
-          
-          setTestConnectionResult({ success: false, message: errorMessage });
+          setTestConnectionResult({ success: false, message: apiErrorMessage(error, 'Connection test failed') });
       } finally {
           setIsTestingConnection(false);
       }
@@ -593,7 +591,7 @@ const Workspace = () => {
         id: (Date.now() + 1).toString(),
         role: 'assistant',
         content: 'I encountered an error processing your request.',
-        error: err.response?.data?.error || err.message,
+        error: apiErrorMessage(err, err.message),
         timestamp: new Date(),
       };
       setMessages(prev => [...prev, errorMsg]);
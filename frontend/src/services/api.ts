@@ -21,4 +21,10 @@ api.interceptors.request.use(
   }
 );
 
+// Returns the message of an API error response, or fallback when there is none
+export function apiErrorMessage(error: unknown, fallback: string): string {
+  const err = error as { response?: { data?: { error?: { message?: string } } } };
+  return err.response?.data?.error?.message || fallback;
+}
+
 export default api;
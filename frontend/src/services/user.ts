@@ -3,7 +3,11 @@ import type { User } from '../types';
 
 export const userService = {
     updateLLMConfig: async (config: Record<string, any>) => {
-        const response = await api.patch<{ success: boolean; data: User }>('/auth/me/llm-config', config);
+        const response = await api.patch<{ success: boolean; data: User['llm_config'] }>('/auth/me/llm-config', config);
+        return response.data;
+    },
+    deleteLLMConfig: async (provider: string) => {
+        const response = await api.delete<{ success: boolean; data: User['llm_config'] }>(`/auth/me/llm-config/${provider}`);
         return response.data;
     },
     updateProfile: async (displayName: string) => {
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const maxAdminPageSize = 100
+
+// AdminHandler handles platform administration endpoints
+type AdminHandler struct {
+	adminService *service.AdminService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(adminService *service.AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+// ListUsers lists users, optionally filtered by ?q= on email or display name
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	limit, offset := adminPagination(r)
+
+	users, total, err := h.adminService.ListUsers(r.Context(), r.URL.Query().Get("q"), limit, offset)
+	if err != nil {
+		response.InternalError(w, err.Error())
+		return
+	}
+	if users == nil {
+		users = []*domain.User{}
+	}
+
+	response.OK(w, map[string]any{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// Stats summarizes users, workspaces, connections and queries across the installation
+// over the last ?days= days
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	days, ok := statsDays(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.adminService.Stats(r.Context(), days)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, stats)
+}
+
+// DeactivateUser deactivates a user account
+func (h *AdminHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserStatus(w, r, h.adminService.DeactivateUser)
+}
+
+// ReactivateUser reactivates a user account
+func (h *AdminHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserStatus(w, r, h.adminService.ReactivateUser)
+}
+
+func (h *AdminHandler) setUserStatus(
+	w http.ResponseWriter,
+	r *http.Request,
+	apply func(ctx context.Context, adminID, userID uuid.UUID, ipAddress string) error,
+) {
+	adminID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		response.BadRequest(w, "invalid user ID")
+		return
+	}
+
+	if err := apply(r.Context(), adminID, userID, r.RemoteAddr); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// ListWorkspaces lists all workspaces with member counts
+func (h *AdminHandler) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	limit, offset := adminPagination(r)
+
+	workspaces, total, err := h.adminService.ListWorkspaces(r.Context(), limit, offset)
+	if err != nil {
+		response.InternalError(w, err.Error())
+		return
+	}
+
+	response.OK(w, map[string]any{
+		"workspaces": workspaces,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+// JoinWorkspace adds the calling admin to a workspace for support purposes
+func (h *AdminHandler) JoinWorkspace(w http.ResponseWriter, r *http.Request) {
+	adminID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, err := uuid.Parse(chi.URLParam(r, "workspaceID"))
+	if err != nil {
+		response.BadRequest(w, "invalid workspace ID")
+		return
+	}
+
+	input := struct {
+		Role string `json:"role"`
+	}{Role: domain.RoleViewer}
+	if !decodeOptionalJSON(w, r, &input) {
+		return
+	}
+
+	if err := h.adminService.JoinWorkspace(r.Context(), adminID, workspaceID, input.Role, r.RemoteAddr); err != nil {
+		switch err.Error() {
+		case "workspace not found":
+			response.NotFound(w, err.Error())
+		case "invalid role":
+			response.BadRequest(w, err.Error())
+		case "already a member":
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.InternalError(w, err.Error())
+		}
+		return
+	}
+
+	response.Created(w, map[string]any{
+		"workspace_id": workspaceID,
+		"user_id":      adminID,
+		"role":         input.Role,
+	})
+}
+
+// adminPagination parses ?limit= and ?offset=, capping the page size
+func adminPagination(r *http.Request) (limit, offset int) {
+	limit = 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxAdminPageSize)
+		}
+	}
+	if o := r.URL.Query().Get("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			offset = v
+		}
+	}
+	return limit, offset
+}
@@ -1,13 +1,17 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
 	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
 )
 
@@ -15,7 +19,8 @@ var validate = validator.New()
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
-	authService *service.AuthService
+	authService  *service.AuthService
+	quotaService *service.QuotaService
 }
 
 // NewAuthHandler creates a new auth handler
@@ -23,11 +28,16 @@ func NewAuthHandler(authService *service.AuthService) *AuthHandler {
 	return &AuthHandler{authService: authService}
 }
 
+// WithQuotas reports the user's daily LLM quota usage from Me
+func (h *AuthHandler) WithQuotas(quotaService *service.QuotaService) *AuthHandler {
+	h.quotaService = quotaService
+	return h
+}
+
 // Register handles user registration
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var input domain.UserCreate
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -73,8 +83,7 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // Login handles user login
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var input domain.UserLogin
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -83,8 +92,16 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	input.IPAddress = r.RemoteAddr
+
 	tokens, err := h.authService.Login(r.Context(), input)
 	if err != nil {
+		var lockout *service.LockoutError
+		if errors.As(err, &lockout) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+			response.Error(w, http.StatusTooManyRequests, err.Error())
+			return
+		}
 		response.Unauthorized(w, err.Error())
 		return
 	}
@@ -98,8 +115,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 		RefreshToken string `json:"refresh_token" validate:"required"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -120,8 +136,7 @@ func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
 // GoogleLogin handles user login via Google OAuth
 func (h *AuthHandler) GoogleLogin(w http.ResponseWriter, r *http.Request) {
 	var input domain.UserGoogleLogin
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -157,15 +172,62 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.OK(w, map[string]any{
-		"id":           user.ID,
-		"email":        user.Email,
-		"display_name": user.DisplayName,
-		"llm_config":   user.LLMConfig,
-	})
+	me := h.me(user)
+	if h.quotaService != nil {
+		// Quotas are left out rather than failing the request while usage is unavailable
+		if usage, err := h.quotaService.Usage(r.Context(), userID); err == nil {
+			me["quotas"] = usage
+		} else {
+			logging.FromContext(r.Context()).Warn().Ctx(r.Context()).Err(err).Msg("failed to load quota usage")
+		}
+	}
+	response.OK(w, me)
+}
+
+// UpdateMe updates the current user's preferred LLM provider and model and muted
+// notification types
+func (h *AuthHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	var input domain.UserPreferences
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	user, err := h.authService.UpdatePreferences(r.Context(), userID, input)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, h.me(user))
+}
+
+// me is the current user as returned by Me and UpdateMe
+func (h *AuthHandler) me(user *domain.User) map[string]any {
+	return map[string]any{
+		"id":                  user.ID,
+		"email":               user.Email,
+		"display_name":        user.DisplayName,
+		"is_admin":            user.IsAdmin,
+		"llm_config":          h.authService.MaskLLMConfig(user.LLMConfig),
+		"preferred_provider":  user.PreferredProvider,
+		"preferred_model":     user.PreferredModel,
+		"llm_defaults":        h.authService.LLMDefaults(user),
+		"muted_notifications": user.MutedNotifications,
+	}
 }
 
-// UpdateLLMConfig updates user's LLM credentials
+// UpdateLLMConfig merges settings into the user's LLM config and returns it masked
 func (h *AuthHandler) UpdateLLMConfig(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
 	if !ok {
@@ -173,19 +235,35 @@ func (h *AuthHandler) UpdateLLMConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var config map[string]any
-	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		response.BadRequest(w, "invalid request body")
+	var patch map[string]any
+	if !decodeJSON(w, r, &patch) {
 		return
 	}
 
-	user, err := h.authService.UpdateLLMConfig(r.Context(), userID, config)
+	user, err := h.authService.UpdateLLMConfig(r.Context(), userID, patch)
 	if err != nil {
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, h.authService.MaskLLMConfig(user.LLMConfig))
+}
+
+// DeleteLLMConfig removes the user's settings and credentials for one provider
+func (h *AuthHandler) DeleteLLMConfig(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	user, err := h.authService.DeleteLLMConfig(r.Context(), userID, chi.URLParam(r, "provider"))
+	if err != nil {
+		response.Err(w, r, err)
 		return
 	}
 
-	response.OK(w, user)
+	response.OK(w, h.authService.MaskLLMConfig(user.LLMConfig))
 }
 
 // UpdateProfile updates user's display name
@@ -199,8 +277,7 @@ func (h *AuthHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		DisplayName string `json:"display_name" validate:"max=255"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
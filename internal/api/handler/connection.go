@@ -1,11 +1,11 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/apperr"
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/service"
 	"github.com/go-chi/chi/v5"
@@ -37,8 +37,7 @@ func (h *ConnectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input domain.ConnectionCreate
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -49,11 +48,7 @@ func (h *ConnectionHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := h.connectionService.Create(r.Context(), userID, workspaceID, input)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -76,11 +71,7 @@ func (h *ConnectionHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	connections, err := h.connectionService.ListByWorkspace(r.Context(), userID, workspaceID)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -110,21 +101,42 @@ func (h *ConnectionHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := h.connectionService.GetByID(r.Context(), userID, workspaceID, connectionID)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		if err.Error() == "connection not found" {
-			response.NotFound(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
 	response.OK(w, conn)
 }
 
+// Health handles checking a connection's database and its connection pool
+func (h *ConnectionHandler) Health(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	health, err := h.connectionService.Health(r.Context(), userID, workspaceID, connectionID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, health)
+}
+
 // Update handles updating a connection
 func (h *ConnectionHandler) Update(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
@@ -147,22 +159,52 @@ func (h *ConnectionHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input domain.ConnectionUpdate
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
 	conn, err := h.connectionService.Update(r.Context(), userID, workspaceID, connectionID, input)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		if err.Error() == "connection not found" {
-			response.NotFound(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, conn)
+}
+
+// UpdateCredentials handles replacing the password of a connection
+func (h *ConnectionHandler) UpdateCredentials(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	var input domain.ConnectionCredentialsUpdate
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	conn, err := h.connectionService.UpdateCredentials(r.Context(), userID, workspaceID, connectionID, input)
+	if err != nil {
+		response.Err(w, r, err)
 		return
 	}
 
@@ -192,15 +234,7 @@ func (h *ConnectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	err = h.connectionService.Delete(r.Context(), userID, workspaceID, connectionID)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		if err.Error() == "connection not found" {
-			response.NotFound(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -210,8 +244,7 @@ func (h *ConnectionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 // Test handles testing a connection
 func (h *ConnectionHandler) Test(w http.ResponseWriter, r *http.Request) {
 	var input domain.ConnectionCreate
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -220,17 +253,21 @@ func (h *ConnectionHandler) Test(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.connectionService.TestConnection(r.Context(), input)
+	result, err := h.connectionService.TestConnection(r.Context(), input)
+	details := map[string]any{"connected": err == nil, "primary": result.Primary}
+	if result.Replica != nil {
+		details["replica"] = result.Replica
+	}
 	if err != nil {
-		response.BadRequest(w, map[string]any{
-			"connected": false,
-			"error":     err.Error(),
+		response.Err(w, r, &apperr.Error{
+			Kind:    apperr.Validation,
+			Message: err.Error(),
+			Details: details,
+			Err:     err,
 		})
 		return
 	}
 
-	response.OK(w, map[string]any{
-		"connected": true,
-		"message":   "Connection successful",
-	})
+	details["message"] = "Connection successful"
+	response.OK(w, details)
 }
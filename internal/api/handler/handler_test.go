@@ -2,16 +2,24 @@ package handler_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/api/handler"
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/repository/postgres"
 	"github.com/Rrens/text-to-sql/internal/security"
 	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/google/uuid"
 )
 
 // MockDB implements a minimal mock for testing
@@ -55,6 +63,246 @@ func TestHealthCheck(t *testing.T) {
 	}
 }
 
+// pingFunc adapts a function to handler.Pinger
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+// llmPingFunc adapts a function to handler.LLMPinger
+type llmPingFunc func(ctx context.Context) (string, error)
+
+func (f llmPingFunc) PingDefault(ctx context.Context) (string, error) { return f(ctx) }
+
+func TestReadyCheck(t *testing.T) {
+	up := pingFunc(func(ctx context.Context) error { return nil })
+	down := pingFunc(func(ctx context.Context) error { return errors.New("dial tcp 10.0.0.5:6379: connection refused") })
+	llmDown := llmPingFunc(func(ctx context.Context) (string, error) { return "openai", errors.New("openai returned status 401") })
+
+	tests := []struct {
+		name       string
+		db, cache  handler.Pinger
+		query      string
+		wantCode   int
+		wantStatus string
+	}{
+		{"all up", up, up, "", http.StatusOK, "ready"},
+		{"redis down", up, down, "", http.StatusServiceUnavailable, "unavailable"},
+		{"llm down degrades", up, up, "?llm=true", http.StatusOK, "degraded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/ready"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			handler.ReadyCheck(tt.db, tt.cache, llmDown)(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d", tt.wantCode, rec.Code)
+			}
+
+			var resp struct {
+				Data struct {
+					Status     string                             `json:"status"`
+					Components map[string]handler.ComponentStatus `json:"components"`
+					Version    map[string]string                  `json:"version"`
+					Uptime     string                             `json:"uptime"`
+				} `json:"data"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Data.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q", tt.wantStatus, resp.Data.Status)
+			}
+			if resp.Data.Version["version"] == "" || resp.Data.Uptime == "" {
+				t.Errorf("expected version and uptime, got %v and %q", resp.Data.Version, resp.Data.Uptime)
+			}
+
+			_, probedLLM := resp.Data.Components["llm"]
+			if probedLLM != (tt.query != "") {
+				t.Errorf("expected llm probed only with ?llm=true, got %v", resp.Data.Components)
+			}
+			if redis := resp.Data.Components["redis"]; redis.Status == "down" && redis.Error != "unreachable" {
+				t.Errorf("expected internal error details to be hidden, got %q", redis.Error)
+			}
+			if llm, ok := resp.Data.Components["llm"]; ok && llm.Provider != "openai" {
+				t.Errorf("expected llm provider openai, got %q", llm.Provider)
+			}
+		})
+	}
+}
+
+func TestReadyCheck_Timeout(t *testing.T) {
+	hang := pingFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	up := pingFunc(func(ctx context.Context) error { return nil })
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ready", nil)
+	ctx, cancel := context.WithTimeout(req.Context(), 50*time.Millisecond)
+	defer cancel()
+	rec := httptest.NewRecorder()
+	handler.ReadyCheck(hang, up, nil)(rec, req.WithContext(ctx))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `"error":"timeout"`) {
+		t.Errorf("expected postgres timeout, got %s", rec.Body.String())
+	}
+}
+
+// workspaceGetterFunc adapts a function to handler.WorkspaceGetter
+type workspaceGetterFunc func(ctx context.Context, userID, workspaceID uuid.UUID) (*domain.Workspace, error)
+
+func (f workspaceGetterFunc) GetByID(ctx context.Context, userID, workspaceID uuid.UUID) (*domain.Workspace, error) {
+	return f(ctx, userID, workspaceID)
+}
+
+func TestListLLMProviders(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.LLM.DefaultProvider = "openai"
+	workspaceID := uuid.New()
+	workspaces := workspaceGetterFunc(func(ctx context.Context, userID, id uuid.UUID) (*domain.Workspace, error) {
+		if id != workspaceID {
+			return nil, apperr.New(apperr.Forbidden, "access denied")
+		}
+		return &domain.Workspace{ID: id, Settings: domain.WorkspaceSettings{LLMProviderAllowlist: []string{"ollama"}}}, nil
+	})
+
+	list := func(query string, header ...string) (int, []string, string) {
+		req := newWorkspaceRequest(http.MethodGet, "/api/v1/llm-providers"+query, "")
+		if len(header) > 0 {
+			req.Header.Set("X-Workspace-ID", header[0])
+		}
+		rec := httptest.NewRecorder()
+		handler.ListLLMProviders(cfg, workspaces)(rec, req)
+
+		var body struct {
+			Data struct {
+				Providers       []struct{ Name string } `json:"providers"`
+				DefaultProvider string                  `json:"default_provider"`
+			} `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&body)
+		var names []string
+		for _, p := range body.Data.Providers {
+			names = append(names, p.Name)
+		}
+		return rec.Code, names, body.Data.DefaultProvider
+	}
+
+	code, names, defaultProvider := list("")
+	if code != http.StatusOK || len(names) != 5 || defaultProvider != "openai" {
+		t.Errorf("without workspace: got %d %v %q, want every provider with openai as default", code, names, defaultProvider)
+	}
+
+	code, names, defaultProvider = list("?workspace_id=" + workspaceID.String())
+	if code != http.StatusOK || len(names) != 1 || names[0] != "ollama" || defaultProvider != "ollama" {
+		t.Errorf("with allowlist: got %d %v %q, want only ollama", code, names, defaultProvider)
+	}
+
+	code, names, _ = list("", workspaceID.String())
+	if code != http.StatusOK || len(names) != 1 || names[0] != "ollama" {
+		t.Errorf("with X-Workspace-ID: got %d %v, want only ollama", code, names)
+	}
+
+	if code, _, _ := list("?workspace_id=" + uuid.NewString()); code != http.StatusForbidden {
+		t.Errorf("foreign workspace: got %d, want 403", code)
+	}
+	if code, _, _ := list("?workspace_id=nope"); code != http.StatusBadRequest {
+		t.Errorf("invalid workspace ID: got %d, want 400", code)
+	}
+}
+
+func TestQueryHandler_RejectsUnknownFields(t *testing.T) {
+	h := handler.NewQueryHandler(nil)
+
+	req := newWorkspaceRequest(http.MethodPost, "/query", `{"queston": "how many users?"}`)
+	rec := httptest.NewRecorder()
+	h.Execute(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), `unknown field \"queston\"`) {
+		t.Errorf("expected unknown field error, got %s", rec.Body.String())
+	}
+}
+
+func TestQueryHandler_RejectsOversizedBody(t *testing.T) {
+	h := middleware.BodyLimit(64)(http.HandlerFunc(handler.NewQueryHandler(nil).Execute))
+	body := `{"question": "` + strings.Repeat("a", 128) + `"}`
+
+	t.Run("declared length", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newWorkspaceRequest(http.MethodPost, "/query", body))
+		assertRequestTooLarge(t, rec, 64)
+	})
+
+	t.Run("unknown length", func(t *testing.T) {
+		req := newWorkspaceRequest(http.MethodPost, "/query", body)
+		req.ContentLength = -1
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assertRequestTooLarge(t, rec, 64)
+	})
+}
+
+func TestQueryHandler_DefaultBodyLimit(t *testing.T) {
+	h := middleware.DefaultBodyLimit(64)(http.HandlerFunc(handler.NewQueryHandler(nil).Execute))
+	body := `{"question": "` + strings.Repeat("a", 128) + `"}`
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newWorkspaceRequest(http.MethodPost, "/query", body))
+	assertRequestTooLarge(t, rec, 64)
+}
+
+func TestUploadHandler_RejectsMalformedForm(t *testing.T) {
+	h := handler.NewUploadHandler(nil)
+	for name, upload := range map[string]http.HandlerFunc{"sqlite": h.UploadSQLite, "spreadsheet": h.UploadSpreadsheet} {
+		t.Run(name, func(t *testing.T) {
+			req := newWorkspaceRequest(http.MethodPost, "/upload", "not a multipart body")
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+
+			rec := httptest.NewRecorder()
+			upload(rec, req)
+			if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid multipart form") {
+				t.Errorf("expected a 400 for the form, got %d: %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthHandler_Register_RejectsUnknownFields(t *testing.T) {
+	h := handler.NewAuthHandler(nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/register",
+		strings.NewReader(`{"email": "a@example.com", "password": "password123", "is_admin": true}`))
+	rec := httptest.NewRecorder()
+	h.Register(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestAuthHandler_UpdateMe_Validates(t *testing.T) {
+	h := handler.NewAuthHandler(nil)
+
+	req := httptest.NewRequest(http.MethodPatch, "/auth/me",
+		strings.NewReader(`{"preferred_provider": "`+strings.Repeat("x", 51)+`"}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, uuid.New()))
+	rec := httptest.NewRecorder()
+	h.UpdateMe(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
 // TestAuthFlow tests the complete authentication flow
 func TestAuthFlow(t *testing.T) {
 	t.Skip("Requires database connection - run as integration test")
@@ -85,7 +333,38 @@ func BenchmarkJWTGeneration(b *testing.B) {
 func newTestAuthService(db *postgres.DB, jwtManager *security.JWTManager) *service.AuthService {
 	userRepo := postgres.NewUserRepository(db)
 	workspaceRepo := postgres.NewWorkspaceRepository(db)
-	return service.NewAuthService(userRepo, workspaceRepo, jwtManager)
+	encryptor, _ := security.NewEncryptorFromSecret("benchmark-secret-key-32-chars!!")
+	return service.NewAuthService(userRepo, workspaceRepo, jwtManager, encryptor, nil, nil)
+}
+
+// Helper to make a request carrying the user and workspace set by the auth middleware
+func newWorkspaceRequest(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, uuid.New())
+	ctx = context.WithValue(ctx, middleware.WorkspaceIDKey, uuid.New())
+	return req.WithContext(ctx)
+}
+
+func assertRequestTooLarge(t *testing.T, rec *httptest.ResponseRecorder, maxBytes int64) {
+	t.Helper()
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d, got %d", http.StatusRequestEntityTooLarge, rec.Code)
+	}
+
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Details struct {
+				MaxBytes int64 `json:"max_bytes"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if body.Error.Code != "request_too_large" || body.Error.Details.MaxBytes != maxBytes {
+		t.Errorf("unexpected error body: %+v", body.Error)
+	}
 }
 
 // Helper to make JSON request
@@ -98,3 +377,38 @@ func makeJSONRequest(method, path string, body any) *http.Request {
 	req.Header.Set("Content-Type", "application/json")
 	return req
 }
+
+// closingBus hands each subscriber the notifications it holds, then ends the stream
+type closingBus struct {
+	notifications []domain.Notification
+}
+
+func (b closingBus) Publish(ctx context.Context, n domain.Notification) error { return nil }
+
+func (b closingBus) Subscribe(ctx context.Context, userID uuid.UUID) (<-chan domain.Notification, error) {
+	ch := make(chan domain.Notification, len(b.notifications))
+	for _, n := range b.notifications {
+		ch <- n
+	}
+	close(ch)
+	return ch, nil
+}
+
+func TestNotificationHandler_Stream(t *testing.T) {
+	n := domain.Notification{ID: uuid.New(), UserID: uuid.New(), Type: domain.NotificationQuotaWarning, Payload: json.RawMessage(`{"provider_class":"hosted"}`)}
+	h := handler.NewNotificationHandler(service.NewNotificationService(nil, closingBus{notifications: []domain.Notification{n}}))
+
+	rec := httptest.NewRecorder()
+	h.Stream(rec, newWorkspaceRequest(http.MethodGet, "/notifications/stream", ""))
+
+	if got := rec.Header().Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", got)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, "retry: ") {
+		t.Errorf("expected the stream to set the reconnect delay, got %q", body)
+	}
+	if !strings.Contains(body, "id: "+n.ID.String()+"\nevent: notification\ndata: {") || !strings.Contains(body, `"type":"quota.warning"`) {
+		t.Errorf("expected the notification as an event, got %q", body)
+	}
+}
@@ -1,12 +1,22 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
 	"github.com/Rrens/text-to-sql/internal/config"
-	"github.com/Rrens/text-to-sql/internal/repository/postgres"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/repository/redis"
+	"github.com/Rrens/text-to-sql/internal/version"
+	"github.com/google/uuid"
 )
 
 // HealthCheck returns a simple health check response
@@ -16,77 +26,245 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// ReadyCheck returns readiness status including database connectivity
-func ReadyCheck(db *postgres.DB) http.HandlerFunc {
+// Pinger is a dependency whose connectivity can be checked
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// LLMPinger checks the default LLM provider, returning its name
+type LLMPinger interface {
+	PingDefault(ctx context.Context) (string, error)
+}
+
+const (
+	readyCheckTimeout    = 2 * time.Second
+	readyLLMCheckTimeout = 5 * time.Second
+)
+
+// startedAt is reported as uptime by ReadyCheck
+var startedAt = time.Now()
+
+// ComponentStatus is the result of probing one dependency
+type ComponentStatus struct {
+	Status    string `json:"status"` // up or down
+	Required  bool   `json:"required"`
+	LatencyMs int64  `json:"latency_ms"`
+	Provider  string `json:"provider,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readiness is the body of the readiness response
+type readiness struct {
+	Status     string                     `json:"status"` // ready, degraded or unavailable
+	Components map[string]ComponentStatus `json:"components"`
+	Version    version.Info               `json:"version"`
+	Uptime     string                     `json:"uptime"`
+}
+
+// ReadyCheck probes Postgres and Redis concurrently, and the default LLM provider
+// when called with ?llm=true. It responds 503 when a required component is down;
+// an unreachable LLM provider only degrades the status.
+func ReadyCheck(db, cache Pinger, llmPinger LLMPinger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := db.Ping(r.Context()); err != nil {
-			response.Error(w, http.StatusServiceUnavailable, "database not ready")
-			return
+		checks := map[string]func(ctx context.Context) ComponentStatus{
+			"postgres": func(ctx context.Context) ComponentStatus {
+				return probe(ctx, "postgres", true, readyCheckTimeout, func(ctx context.Context) (string, error) {
+					return "", db.Ping(ctx)
+				})
+			},
+			// Redis backs rate limiting and the schema cache, so requests fail without it
+			"redis": func(ctx context.Context) ComponentStatus {
+				return probe(ctx, "redis", true, readyCheckTimeout, func(ctx context.Context) (string, error) {
+					return "", cache.Ping(ctx)
+				})
+			},
+		}
+		if llmPinger != nil && r.URL.Query().Get("llm") == "true" {
+			checks["llm"] = func(ctx context.Context) ComponentStatus {
+				return probe(ctx, "llm", false, readyLLMCheckTimeout, llmPinger.PingDefault)
+			}
 		}
 
-		response.OK(w, map[string]string{
-			"status": "ready",
-		})
+		var (
+			mu         sync.Mutex
+			wg         sync.WaitGroup
+			components = make(map[string]ComponentStatus, len(checks))
+		)
+		for name, check := range checks {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				status := check(r.Context())
+				mu.Lock()
+				components[name] = status
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		body := readiness{
+			Status:     "ready",
+			Components: components,
+			Version:    version.Get(),
+			Uptime:     time.Since(startedAt).Round(time.Second).String(),
+		}
+		for _, c := range components {
+			if c.Status == "up" {
+				continue
+			}
+			if c.Required {
+				body.Status = "unavailable"
+				break
+			}
+			body.Status = "degraded"
+		}
+
+		status := http.StatusOK
+		if body.Status == "unavailable" {
+			status = http.StatusServiceUnavailable
+		}
+		response.JSON(w, status, body)
 	}
 }
 
+// probe runs check under timeout and reports its outcome and latency
+func probe(ctx context.Context, name string, required bool, timeout time.Duration, check func(ctx context.Context) (string, error)) ComponentStatus {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	provider, err := check(ctx)
+	result := ComponentStatus{
+		Status:    "up",
+		Required:  required,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Provider:  provider,
+	}
+	if err != nil {
+		// The endpoint is public, so details such as internal addresses only go to the log
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("component", name).Msg("Readiness check failed")
+		result.Status = "down"
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			result.Error = "timeout"
+		case strings.HasPrefix(err.Error(), "provider not configured"):
+			result.Error = "not configured"
+		default:
+			result.Error = "unreachable"
+		}
+	}
+	return result
+}
+
+// WorkspaceGetter loads a workspace the user is a member of
+type WorkspaceGetter interface {
+	GetByID(ctx context.Context, userID, workspaceID uuid.UUID) (*domain.Workspace, error)
+}
+
 // ListLLMProviders returns available LLM providers
-// Always returns all providers since users can store their own API keys in DB
-func ListLLMProviders(cfg *config.Config) http.HandlerFunc {
+// Always returns all providers since users can store their own API keys in DB, except
+// that with ?workspace_id= or an X-Workspace-ID header only those the workspace allows
+// are listed
+func ListLLMProviders(cfg *config.Config, workspaces WorkspaceGetter) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var settings domain.WorkspaceSettings
+		raw := r.URL.Query().Get("workspace_id")
+		if raw == "" {
+			raw = r.Header.Get("X-Workspace-ID")
+		}
+		if raw != "" {
+			workspaceID, err := uuid.Parse(raw)
+			if err != nil {
+				response.BadRequest(w, "invalid workspace ID")
+				return
+			}
+			userID, ok := middleware.GetUserID(r.Context())
+			if !ok {
+				response.Unauthorized(w, "unauthorized")
+				return
+			}
+			workspace, err := workspaces.GetByID(r.Context(), userID, workspaceID)
+			if err != nil {
+				response.Err(w, r, err)
+				return
+			}
+			settings = workspace.Settings
+		}
+		defaultProvider := settings.DefaultProvider(cfg.LLM.DefaultProvider)
+
 		providers := []map[string]any{
 			{
 				"name":       "ollama",
 				"models":     []string{"qwen2.5-coder:7b", "qwen2.5-coder:1.5b", "llama3", "codellama", "sqlcoder", "deepseek-coder"},
-				"default":    cfg.LLM.DefaultProvider == "ollama",
+				"default":    defaultProvider == "ollama",
 				"configured": cfg.LLM.Ollama.Host != "",
 				"host":       cfg.LLM.Ollama.Host,
 			},
 			{
 				"name":       "gemini",
 				"models":     []string{"gemini-2.5-flash", "gemini-1.5-flash", "gemini-1.5-pro", "gemini-1.0-pro"},
-				"default":    cfg.LLM.DefaultProvider == "gemini",
+				"default":    defaultProvider == "gemini",
 				"configured": cfg.LLM.Gemini.APIKey != "",
 			},
 			{
 				"name":       "openai",
 				"models":     []string{"gpt-4-turbo", "gpt-4", "gpt-3.5-turbo"},
-				"default":    cfg.LLM.DefaultProvider == "openai",
+				"default":    defaultProvider == "openai",
 				"configured": cfg.LLM.OpenAI.APIKey != "",
 			},
 			{
 				"name":       "anthropic",
 				"models":     []string{"claude-3-opus", "claude-3-sonnet", "claude-3-haiku"},
-				"default":    cfg.LLM.DefaultProvider == "anthropic",
+				"default":    defaultProvider == "anthropic",
 				"configured": cfg.LLM.Anthropic.APIKey != "",
 			},
 			{
 				"name":       "deepseek",
 				"models":     []string{"deepseek-chat", "deepseek-coder"},
-				"default":    cfg.LLM.DefaultProvider == "deepseek",
+				"default":    defaultProvider == "deepseek",
 				"configured": cfg.LLM.DeepSeek.APIKey != "",
 			},
 		}
+		providers = slices.DeleteFunc(providers, func(p map[string]any) bool {
+			return !settings.AllowsProvider(p["name"].(string))
+		})
 
 		response.OK(w, map[string]any{
 			"providers":        providers,
-			"default_provider": cfg.LLM.DefaultProvider,
+			"default_provider": defaultProvider,
 		})
 	}
 }
 
-// FlushCache clears all schema cache from Redis
-func FlushCache(schemaCache *redis.SchemaCache) http.HandlerFunc {
+// EffectiveConfig returns the resolved configuration with secrets masked, and where
+// each setting came from
+func EffectiveConfig(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response.OK(w, map[string]any{
+			"config":  cfg.Redacted(),
+			"sources": cfg.Sources(),
+		})
+	}
+}
+
+// FlushCache clears the cached and stored schemas of every workspace
+func FlushCache(schemaCache *redis.SchemaCache, schemaStore domain.ConnectionSchemaRepository) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		deleted, err := schemaCache.FlushAll(r.Context())
 		if err != nil {
 			response.Error(w, http.StatusInternalServerError, "failed to flush cache: "+err.Error())
 			return
 		}
+		stored, err := schemaStore.DeleteAll(r.Context())
+		if err != nil {
+			response.Error(w, http.StatusInternalServerError, "failed to flush cache: "+err.Error())
+			return
+		}
 
 		response.OK(w, map[string]any{
-			"message":      "cache flushed successfully",
-			"keys_deleted": deleted,
+			"message":         "cache flushed successfully",
+			"keys_deleted":    deleted,
+			"schemas_deleted": stored,
 		})
 	}
 }
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// notificationHeartbeat is how often an idle stream sends a comment, so proxies
+	// do not close it
+	notificationHeartbeat = 25 * time.Second
+	// notificationStreamMargin ends a stream this long before the request times out,
+	// so it closes cleanly and the client reconnects
+	notificationStreamMargin = time.Second
+	// notificationRetryMillis is how long clients wait before reconnecting
+	notificationRetryMillis = 3000
+)
+
+// NotificationHandler handles the current user's notifications
+type NotificationHandler struct {
+	notificationService *service.NotificationService
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(notificationService *service.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationService: notificationService}
+}
+
+// List returns the current user's notifications, newest first, only the unread ones
+// with unread=true
+func (h *NotificationHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	filter := domain.NotificationFilter{Limit: service.DefaultNotificationLimit}
+	if u := r.URL.Query().Get("unread"); u != "" {
+		unread, err := strconv.ParseBool(u)
+		if err != nil {
+			response.BadRequest(w, "invalid unread")
+			return
+		}
+		filter.UnreadOnly = unread
+	}
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v <= 0 {
+			response.BadRequest(w, "invalid limit")
+			return
+		}
+		filter.Limit = min(v, service.MaxNotificationLimit)
+	}
+
+	notifications, err := h.notificationService.List(r.Context(), userID, filter)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+	response.OK(w, notifications)
+}
+
+// MarkRead marks one of the current user's notifications read
+func (h *NotificationHandler) MarkRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+	notificationID, err := uuid.Parse(chi.URLParam(r, "notificationID"))
+	if err != nil {
+		response.BadRequest(w, "invalid notification ID")
+		return
+	}
+
+	if err := h.notificationService.MarkRead(r.Context(), userID, notificationID); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+	response.OK(w, map[string]string{"message": "notification marked read"})
+}
+
+// Stream pushes the current user's new notifications as server-sent events until
+// the request times out; clients reconnect and catch up from the feed
+func (h *NotificationHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	ctx := r.Context()
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-notificationStreamMargin))
+		defer cancel()
+	}
+
+	notifications, err := h.notificationService.Subscribe(ctx, userID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// The server's write timeout would cut the stream short
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", notificationRetryMillis)
+	_ = rc.Flush()
+
+	heartbeat := time.NewTicker(notificationHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case n, ok := <-notifications:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(n)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: notification\ndata: %s\n\n", n.ID, data); err != nil {
+				return
+			}
+		}
+		_ = rc.Flush()
+	}
+}
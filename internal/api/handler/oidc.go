@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/service"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/v1/auth/oidc"
+)
+
+// OIDCHandler handles OpenID Connect single sign-on endpoints
+type OIDCHandler struct {
+	oidcService  *service.OIDCService
+	frontendURL  string
+	secureCookie bool
+}
+
+// NewOIDCHandler creates a new OIDC handler. When frontendURL is set the callback
+// redirects there with the tokens in the URL fragment instead of returning JSON.
+func NewOIDCHandler(oidcService *service.OIDCService, frontendURL string, secureCookie bool) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:  oidcService,
+		frontendURL:  frontendURL,
+		secureCookie: secureCookie,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	authURL, state, err := h.oidcService.Begin(r.Context())
+	if err != nil {
+		logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Msg("failed to start oidc login")
+		response.InternalError(w, "failed to start sign-in")
+		return
+	}
+
+	// Bind the state to this browser so a callback URL cannot be replayed elsewhere
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     oidcCookiePath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   h.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback completes the login and issues the token pair
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Clear the state cookie whatever the outcome
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     oidcCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   h.secureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	if errParam := query.Get("error"); errParam != "" {
+		h.fail(w, r, http.StatusUnauthorized, "sign-in was cancelled or denied: "+errParam)
+		return
+	}
+
+	state := query.Get("state")
+	code := query.Get("code")
+	if state == "" || code == "" {
+		h.fail(w, r, http.StatusBadRequest, "missing state or code")
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		h.fail(w, r, http.StatusUnauthorized, "invalid or expired login state")
+		return
+	}
+
+	tokens, err := h.oidcService.Complete(r.Context(), state, code)
+	if err != nil {
+		switch err.Error() {
+		case "email not verified", "email domain not allowed", "account is linked to a different identity":
+			h.fail(w, r, http.StatusForbidden, err.Error())
+		case "invalid or expired login state":
+			h.fail(w, r, http.StatusUnauthorized, err.Error())
+		default:
+			logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Msg("oidc login failed")
+			h.fail(w, r, http.StatusUnauthorized, "sign-in failed")
+		}
+		return
+	}
+
+	if h.frontendURL == "" {
+		response.OK(w, tokens)
+		return
+	}
+	http.Redirect(w, r, h.frontendURL+"#"+tokenFragment(tokens), http.StatusFound)
+}
+
+// fail reports a callback error to the frontend, or as JSON when no frontend is configured
+func (h *OIDCHandler) fail(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if h.frontendURL == "" {
+		response.Error(w, status, message)
+		return
+	}
+	http.Redirect(w, r, h.frontendURL+"#"+url.Values{"error": {message}}.Encode(), http.StatusFound)
+}
+
+// tokenFragment encodes tokens for the URL fragment, which browsers never send to servers
+func tokenFragment(tokens *domain.TokenPair) string {
+	return url.Values{
+		"access_token":  {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.FormatInt(tokens.ExpiresIn, 10)},
+	}.Encode()
+}
+
+// PasswordLoginDisabled rejects local password and Google sign-in endpoints when SSO
+// is exclusive
+func PasswordLoginDisabled(w http.ResponseWriter, r *http.Request) {
+	response.Forbidden(w, "password and Google login are disabled, sign in with SSO")
+}
@@ -1,12 +1,19 @@
 package handler
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/apperr"
 	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/service"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -37,8 +44,7 @@ func (h *QueryHandler) Execute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req domain.QueryRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -47,17 +53,142 @@ func (h *QueryHandler) Execute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.queryService.ExecuteQuery(r.Context(), userID, workspaceID, req)
+	// Retries carrying the same Idempotency-Key get the first request's outcome
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > service.MaxIdempotencyKeyLength {
+		response.BadRequest(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", service.MaxIdempotencyKeyLength))
+		return
+	}
+
+	result, replayed, err := h.queryService.ExecuteQueryIdempotent(r.Context(), userID, workspaceID, idempotencyKey, req)
+	if replayed {
+		w.Header().Set("Idempotency-Replayed", "true")
+	}
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
+		if errors.Is(err, service.ErrIdempotencyInProgress) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(service.IdempotencyRetryAfter.Seconds())))
 		}
-		response.InternalError(w, err.Error())
+		setRetryAfter(w, err)
+		response.Err(w, r, err)
 		return
 	}
 
-	response.OK(w, result)
+	writeQueryResponse(w, r, result)
+}
+
+// setRetryAfter tells clients when to retry a request refused by a spent quota or a
+// busy LLM
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var appErr *apperr.Error
+	if !errors.As(err, &appErr) {
+		return
+	}
+	switch details := appErr.Details.(type) {
+	case domain.QuotaUsage:
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(details.ResetAt).Seconds()))))
+	case domain.LLMBusy:
+		w.Header().Set("Retry-After", strconv.Itoa(max(1, int(math.Ceil(float64(details.RetryAfterMs)/1000)))))
+	}
+}
+
+// QueueStatus reports where a query waits for its LLM provider. The request ID is the
+// X-Request-ID header the query was sent with.
+func (h *QueryHandler) QueueStatus(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	status, err := h.queryService.LLMQueueStatus(workspaceID, chi.URLParam(r, "requestID"))
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, status)
+}
+
+// writeQueryResponse sends resp, or its result as an Arrow stream or a Parquet file
+// when the request asks for one. Answers without a result are sent as JSON.
+func writeQueryResponse(w http.ResponseWriter, r *http.Request, resp *domain.QueryResponse) {
+	if resp.Result == nil || !wantsRows(r) {
+		response.OK(w, resp)
+		return
+	}
+	metadata := map[string]string{"request_id": resp.RequestID, "sql": resp.SQL}
+	if resp.SessionID != uuid.Nil {
+		metadata["session_id"] = resp.SessionID.String()
+	}
+	writeResultRows(w, r, resp.Result, resp.NextPageToken, metadata)
+}
+
+// wantsRows reports whether the request asks for a result's rows as Arrow or Parquet
+func wantsRows(r *http.Request) bool {
+	return response.WantsParquet(r) || response.WantsArrow(r)
+}
+
+// writeResultRows sends result as a Parquet file when format=parquet is set and as an
+// Arrow stream otherwise, with its truncation and page token added to metadata
+func writeResultRows(w http.ResponseWriter, r *http.Request, result *domain.QueryResult, nextPageToken string, metadata map[string]string) {
+	metadata["row_count"] = strconv.Itoa(result.RowCount)
+	metadata["truncated"] = strconv.FormatBool(result.Truncated)
+	metadata["default_limit_applied"] = strconv.FormatBool(result.DefaultLimitApplied)
+	if nextPageToken != "" {
+		metadata["next_page_token"] = nextPageToken
+	}
+
+	// The status is already sent when these fail, so the body just ends early
+	if response.WantsParquet(r) {
+		filename := "result.parquet"
+		if id := metadata["request_id"]; id != "" {
+			filename = "result-" + id + ".parquet"
+		}
+		if err := response.Parquet(w, filename, result.Columns, result.Rows, metadata); err != nil {
+			logging.FromContext(r.Context()).Warn().Ctx(r.Context()).Err(err).Msg("failed to write result as parquet")
+		}
+		return
+	}
+	if err := response.Arrow(w, result.Columns, result.Rows, metadata); err != nil {
+		logging.FromContext(r.Context()).Warn().Ctx(r.Context()).Err(err).Msg("failed to stream result as arrow")
+	}
+}
+
+// Page returns the next page of a truncated query result
+func (h *QueryHandler) Page(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	var req domain.QueryPageRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	page, err := h.queryService.NextPage(r.Context(), userID, workspaceID, req.PageToken)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	if page.Result != nil && wantsRows(r) {
+		writeResultRows(w, r, page.Result, page.NextPageToken, map[string]string{})
+		return
+	}
+	response.OK(w, page)
 }
 
 // Generate handles SQL generation without execution
@@ -75,13 +206,17 @@ func (h *QueryHandler) Generate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req domain.QueryRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Force execute to false for generate-only
+	// Force execute to false for generate-only. Generations are not recorded unless
+	// asked, so callers trying out phrasings keep chat history and suggestions clean.
 	req.Execute = false
+	if req.Persist == nil {
+		persist := false
+		req.Persist = &persist
+	}
 
 	if err := validate.Struct(req); err != nil {
 		response.BadRequest(w, err.Error())
@@ -90,11 +225,42 @@ func (h *QueryHandler) Generate(w http.ResponseWriter, r *http.Request) {
 
 	result, err := h.queryService.ExecuteQuery(r.Context(), userID, workspaceID, req)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		setRetryAfter(w, err)
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, result)
+}
+
+// GenerateAdhoc handles SQL generation for a pasted schema, without a connection
+func (h *QueryHandler) GenerateAdhoc(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	var req domain.AdhocGenerateRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	result, err := h.queryService.GenerateAdhoc(r.Context(), userID, workspaceID, req)
+	if err != nil {
+		setRetryAfter(w, err)
+		response.Err(w, r, err)
 		return
 	}
 
@@ -124,17 +290,335 @@ func (h *QueryHandler) GetSchema(w http.ResponseWriter, r *http.Request) {
 
 	schema, err := h.queryService.GetSchema(r.Context(), userID, workspaceID, connectionID)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
 	response.OK(w, schema)
 }
 
+// schemaExportTypes are the content types and file extensions of the schema export formats
+var schemaExportTypes = map[string][2]string{
+	domain.SchemaExportSQL:      {"application/sql; charset=utf-8", "sql"},
+	domain.SchemaExportMarkdown: {"text/markdown; charset=utf-8", "md"},
+	domain.SchemaExportJSON:     {"application/json", "json"},
+}
+
+// ExportSchema downloads the schema of a connection as SQL, markdown or JSON. The
+// document is sent as is, not in the response envelope.
+func (h *QueryHandler) ExportSchema(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = domain.SchemaExportSQL
+	}
+	kind, ok := schemaExportTypes[format]
+	if !ok {
+		response.BadRequest(w, "format must be one of sql, markdown or json")
+		return
+	}
+
+	schema, err := h.queryService.GetSchema(r.Context(), userID, workspaceID, connectionID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", kind[0])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="schema-%s.%s"`, connectionID, kind[1]))
+	if !schema.CachedAt.IsZero() {
+		w.Header().Set("Last-Modified", schema.CachedAt.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := service.WriteSchemaExport(w, schema, format); err != nil {
+		// The status is already sent, so the download just ends early
+		logging.FromContext(r.Context()).Warn().Ctx(r.Context()).Err(err).Msg("failed to write schema export")
+	}
+}
+
+// ExplainSQL explains SQL written elsewhere against a connection's schema, without running it
+func (h *QueryHandler) ExplainSQL(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	var req domain.ExplainSQLRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := validate.Struct(req); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	explanation, err := h.queryService.ExplainSQL(r.Context(), userID, workspaceID, connectionID, req)
+	if err != nil {
+		setRetryAfter(w, err)
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, explanation)
+}
+
+// Rerun runs the SQL of an earlier answer again and compares the results
+func (h *QueryHandler) Rerun(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		response.BadRequest(w, "invalid message ID")
+		return
+	}
+
+	var req domain.RerunRequest
+	if !decodeOptionalJSON(w, r, &req) {
+		return
+	}
+
+	rerun, err := h.queryService.Rerun(r.Context(), userID, workspaceID, messageID, req)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, rerun)
+}
+
+// maxPopularTables caps the tables returned by GetPopularTables
+const maxPopularTables = 50
+
+// GetPopularTables returns the tables most read by successful queries on a connection
+func (h *QueryHandler) GetPopularTables(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxPopularTables)
+		}
+	}
+
+	tables, err := h.queryService.PopularTables(r.Context(), userID, workspaceID, connectionID, limit)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, tables)
+}
+
+// maxSchemaChanges caps the changes returned by ListSchemaChanges
+const maxSchemaChanges = 100
+
+// ListSchemaChanges returns the latest schema changes found on a connection
+func (h *QueryHandler) ListSchemaChanges(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			limit = min(v, maxSchemaChanges)
+		}
+	}
+
+	changes, err := h.queryService.ListSchemaChanges(r.Context(), userID, workspaceID, connectionID, limit)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, changes)
+}
+
+// ListTableAnnotations returns the table annotations of a connection
+func (h *QueryHandler) ListTableAnnotations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	annotations, err := h.queryService.ListTableAnnotations(r.Context(), userID, workspaceID, connectionID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, annotations)
+}
+
+// AnnotateTable sets the role and description of a table, overriding its guessed role
+func (h *QueryHandler) AnnotateTable(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+	table, ok := tableParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.TableAnnotationRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	annotation, err := h.queryService.AnnotateTable(r.Context(), userID, workspaceID, connectionID, table, req)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, annotation)
+}
+
+// DeleteTableAnnotation removes the annotation of a table
+func (h *QueryHandler) DeleteTableAnnotation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+	table, ok := tableParam(w, r)
+	if !ok {
+		return
+	}
+
+	schemaName := r.URL.Query().Get("schema_name")
+	if err := h.queryService.DeleteTableAnnotation(r.Context(), userID, workspaceID, connectionID, schemaName, table); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// tableParam returns the unescaped table name of the URL
+func tableParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	table, err := url.PathUnescape(chi.URLParam(r, "table"))
+	if err != nil || table == "" {
+		response.BadRequest(w, "invalid table name")
+		return "", false
+	}
+	return table, true
+}
+
 // RefreshSchema forces a schema refresh for a connection
 func (h *QueryHandler) RefreshSchema(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
@@ -158,17 +642,41 @@ func (h *QueryHandler) RefreshSchema(w http.ResponseWriter, r *http.Request) {
 
 	schema, err := h.queryService.RefreshSchema(r.Context(), userID, workspaceID, connectionID)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
 	response.OK(w, schema)
 }
 
+// FlushCache removes the cached data of a connection
+func (h *QueryHandler) FlushCache(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	connectionID, err := uuid.Parse(chi.URLParam(r, "connectionID"))
+	if err != nil {
+		response.BadRequest(w, "invalid connection ID")
+		return
+	}
+
+	if err := h.queryService.FlushConnectionCache(r.Context(), userID, workspaceID, connectionID); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, map[string]string{"message": "cache flushed successfully"})
+}
+
 // GetHistory returns chat history for a workspace
 func (h *QueryHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	_, ok := middleware.GetUserID(r.Context())
@@ -185,7 +693,7 @@ func (h *QueryHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 
 	history, err := h.queryService.GetChatHistory(r.Context(), workspaceID)
 	if err != nil {
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
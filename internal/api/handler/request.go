@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/google/uuid"
+)
+
+// decodeJSON decodes the request body into dst, rejecting unknown fields.
+// On failure it writes the error response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := newJSONDecoder(r).Decode(dst); err != nil {
+		writeDecodeError(w, err)
+		return false
+	}
+	return true
+}
+
+// decodeOptionalJSON is like decodeJSON but accepts an empty body
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	if err := newJSONDecoder(r).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		writeDecodeError(w, err)
+		return false
+	}
+	return true
+}
+
+func newJSONDecoder(r *http.Request) *json.Decoder {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	return decoder
+}
+
+// writeDecodeError maps a JSON decode error to a client error response
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		response.RequestTooLarge(w, maxBytesErr.Limit)
+		return
+	}
+
+	// encoding/json has no typed error for unknown fields
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		response.BadRequest(w, "unknown field "+field)
+		return
+	}
+
+	response.BadRequest(w, "invalid request body")
+}
+
+// workspaceScope reads the caller and workspace set by the auth middleware
+func workspaceScope(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return userID, workspaceID, true
+}
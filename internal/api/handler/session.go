@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 
@@ -12,6 +11,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// maxSessionPageSize caps the limit accepted when listing sessions
+const maxSessionPageSize = 100
+
 type SessionHandler struct {
 	queryService *service.QueryService
 }
@@ -33,7 +35,7 @@ func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	if l := r.URL.Query().Get("limit"); l != "" {
 		if v, err := strconv.Atoi(l); err == nil && v > 0 {
-			limit = v
+			limit = min(v, maxSessionPageSize)
 		}
 	}
 	if o := r.URL.Query().Get("offset"); o != "" {
@@ -42,13 +44,24 @@ func (h *SessionHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	sessions, err := h.queryService.ListSessions(r.Context(), workspaceID, limit, offset)
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	sessions, total, err := h.queryService.ListSessions(r.Context(), userID, workspaceID, limit, offset)
 	if err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to list sessions")
+		response.Err(w, r, err)
 		return
 	}
 
-	response.JSON(w, http.StatusOK, sessions)
+	response.JSON(w, http.StatusOK, map[string]any{
+		"items":  sessions,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
 }
 
 // Create creates a new session
@@ -68,13 +81,13 @@ func (h *SessionHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Title string `json:"title"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		// Optional body
+	if !decodeOptionalJSON(w, r, &req) {
+		return
 	}
 
 	session, err := h.queryService.CreateSession(r.Context(), userID, workspaceID, req.Title)
 	if err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to create session")
+		response.Err(w, r, err)
 		return
 	}
 
@@ -83,6 +96,18 @@ func (h *SessionHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 // GetHistory returns history for a specific session
 func (h *SessionHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "Missing workspace ID")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
 	sessionIDStr := chi.URLParam(r, "sessionID")
 	sessionID, err := uuid.Parse(sessionIDStr)
 	if err != nil {
@@ -90,9 +115,9 @@ func (h *SessionHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	history, err := h.queryService.GetSessionHistory(r.Context(), sessionID)
+	history, err := h.queryService.GetSessionHistory(r.Context(), userID, workspaceID, sessionID)
 	if err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to fetch session history")
+		response.Err(w, r, err)
 		return
 	}
 
@@ -101,6 +126,18 @@ func (h *SessionHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 
 // Delete deletes a session
 func (h *SessionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "Missing workspace ID")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
 	sessionIDStr := chi.URLParam(r, "sessionID")
 	sessionID, err := uuid.Parse(sessionIDStr)
 	if err != nil {
@@ -108,10 +145,39 @@ func (h *SessionHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.queryService.DeleteSession(r.Context(), sessionID); err != nil {
-		response.Error(w, http.StatusInternalServerError, "Failed to delete session")
+	if err := h.queryService.DeleteSession(r.Context(), userID, workspaceID, sessionID); err != nil {
+		response.Err(w, r, err)
 		return
 	}
 
 	response.JSON(w, http.StatusOK, map[string]string{"message": "Session deleted"})
 }
+
+// Restore undoes the deletion of a session
+func (h *SessionHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "Missing workspace ID")
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "User ID not found")
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "sessionID"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	session, err := h.queryService.RestoreSession(r.Context(), userID, workspaceID, sessionID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, session)
+}
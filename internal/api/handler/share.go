@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// SharePasscodeHeader carries the passcode of a protected share link. It is a header
+// rather than a query parameter so that it stays out of access logs.
+const SharePasscodeHeader = "X-Share-Passcode"
+
+// ShareHandler handles share link endpoints
+type ShareHandler struct {
+	shareService *service.ShareService
+}
+
+// NewShareHandler creates a new share link handler
+func NewShareHandler(shareService *service.ShareService) *ShareHandler {
+	return &ShareHandler{shareService: shareService}
+}
+
+// Create handles sharing an assistant message
+func (h *ShareHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageID"))
+	if err != nil {
+		response.BadRequest(w, "invalid message ID")
+		return
+	}
+
+	var input domain.SharedResultCreate
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	share, err := h.shareService.Create(r.Context(), userID, workspaceID, messageID, input)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.Created(w, share)
+}
+
+// List handles listing the shares of a workspace
+func (h *ShareHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+
+	shares, err := h.shareService.List(r.Context(), userID, workspaceID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, shares)
+}
+
+// Revoke handles revoking a share
+func (h *ShareHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	shareID, err := uuid.Parse(chi.URLParam(r, "shareID"))
+	if err != nil {
+		response.BadRequest(w, "invalid share ID")
+		return
+	}
+
+	if err := h.shareService.Revoke(r.Context(), userID, workspaceID, shareID); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// View handles opening a share link. It needs no authentication.
+func (h *ShareHandler) View(w http.ResponseWriter, r *http.Request) {
+	view, err := h.shareService.View(r.Context(), chi.URLParam(r, "token"), r.Header.Get(SharePasscodeHeader))
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, view)
+}
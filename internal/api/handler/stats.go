@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/service"
+)
+
+const (
+	// defaultStatsDays is the window used when no days parameter is given
+	defaultStatsDays = 30
+	// maxStatsDays caps the window accepted by the stats endpoints
+	maxStatsDays = 365
+)
+
+// StatsHandler handles workspace analytics
+type StatsHandler struct {
+	queryService *service.QueryService
+}
+
+// NewStatsHandler creates a new stats handler
+func NewStatsHandler(queryService *service.QueryService) *StatsHandler {
+	return &StatsHandler{queryService: queryService}
+}
+
+// Queries returns answer counts by status, provider and connection
+func (h *StatsHandler) Queries(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	days, ok := statsDays(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.queryService.GetQueryStats(r.Context(), workspaceID, days)
+	if err != nil {
+		response.InternalError(w, "failed to get query stats")
+		return
+	}
+
+	response.OK(w, stats)
+}
+
+// Experiments compares the arms of the workspace's experiment, or the one named by ?name=
+func (h *StatsHandler) Experiments(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	days, ok := statsDays(w, r)
+	if !ok {
+		return
+	}
+
+	results, err := h.queryService.GetExperimentResults(r.Context(), workspaceID, r.URL.Query().Get("name"), days)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, results)
+}
+
+// statsDays reads the ?days= window of the stats endpoints, writing a bad request
+// response when it is out of range
+func statsDays(w http.ResponseWriter, r *http.Request) (int, bool) {
+	d := r.URL.Query().Get("days")
+	if d == "" {
+		return defaultStatsDays, true
+	}
+	days, err := strconv.Atoi(d)
+	if err != nil || days <= 0 || days > maxStatsDays {
+		response.BadRequest(w, "days must be between 1 and "+strconv.Itoa(maxStatsDays))
+		return 0, false
+	}
+	return days, true
+}
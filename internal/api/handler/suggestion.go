@@ -2,10 +2,12 @@ package handler
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
 	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/google/uuid"
 )
 
 type SuggestionHandler struct {
@@ -24,11 +26,34 @@ func (h *SuggestionHandler) GetSuggestions(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	suggestions, err := h.queryService.GetSuggestedQuestions(r.Context(), workspaceID)
+	var connectionID *uuid.UUID
+	if c := r.URL.Query().Get("connection_id"); c != "" {
+		id, err := uuid.Parse(c)
+		if err != nil {
+			response.BadRequest(w, "invalid connection ID")
+			return
+		}
+		connectionID = &id
+	}
+
+	limit := service.DefaultSuggestionLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v <= 0 {
+			response.BadRequest(w, "invalid limit")
+			return
+		}
+		limit = min(v, service.MaxSuggestionLimit)
+	}
+
+	suggestions, err := h.queryService.GetSuggestedQuestions(r.Context(), workspaceID, connectionID, limit)
 	if err != nil {
 		response.InternalError(w, err.Error())
 		return
 	}
 
+	if suggestions == nil {
+		suggestions = []string{}
+	}
 	response.OK(w, suggestions)
 }
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// TemplateHandler handles query template endpoints
+type TemplateHandler struct {
+	templateService *service.TemplateService
+}
+
+// NewTemplateHandler creates a new query template handler
+func NewTemplateHandler(templateService *service.TemplateService) *TemplateHandler {
+	return &TemplateHandler{templateService: templateService}
+}
+
+// List handles listing the templates of a workspace
+func (h *TemplateHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+
+	templates, err := h.templateService.List(r.Context(), userID, workspaceID)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response.OK(w, templates)
+}
+
+// Create handles template creation, from SQL or from an assistant message
+func (h *TemplateHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+
+	var input domain.QueryTemplateCreate
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	template, err := h.templateService.Create(r.Context(), userID, workspaceID, input)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response.Created(w, template)
+}
+
+// Get handles retrieving a template
+func (h *TemplateHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	templateID, ok := templateIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	template, err := h.templateService.Get(r.Context(), userID, workspaceID, templateID)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response.OK(w, template)
+}
+
+// Update handles updating a template
+func (h *TemplateHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	templateID, ok := templateIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input domain.QueryTemplateUpdate
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	template, err := h.templateService.Update(r.Context(), userID, workspaceID, templateID, input)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response.OK(w, template)
+}
+
+// Delete handles deleting a template
+func (h *TemplateHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	templateID, ok := templateIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.templateService.Delete(r.Context(), userID, workspaceID, templateID); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// Run handles running a template with parameter values
+func (h *TemplateHandler) Run(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	templateID, ok := templateIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req domain.TemplateRunRequest
+	if !decodeOptionalJSON(w, r, &req) {
+		return
+	}
+	if err := validate.Struct(req); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	result, err := h.templateService.Run(r.Context(), userID, workspaceID, templateID, req)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+
+	writeQueryResponse(w, r, result)
+}
+
+func templateIDParam(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	templateID, err := uuid.Parse(chi.URLParam(r, "templateID"))
+	if err != nil {
+		response.BadRequest(w, "invalid template ID")
+		return uuid.Nil, false
+	}
+	return templateID, true
+}
+
+// writeTemplateError maps template service errors to responses
+func writeTemplateError(w http.ResponseWriter, err error) {
+	msg := err.Error()
+	switch {
+	case msg == "access denied" || msg == "write access required":
+		response.Forbidden(w, msg)
+	case msg == "template not found" || msg == "message not found" || msg == "session not found" ||
+		strings.HasSuffix(msg, "connection not found"):
+		response.NotFound(w, msg)
+	case strings.HasPrefix(msg, "invalid template") ||
+		strings.HasPrefix(msg, "invalid parameter") ||
+		strings.HasPrefix(msg, "query templates are not supported") ||
+		msg == "message has no SQL to make a template of" ||
+		msg == "connection_id is required":
+		response.BadRequest(w, msg)
+	default:
+		response.InternalError(w, msg)
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,26 +9,61 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/importer"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
 // UploadHandler handles file upload endpoints
 type UploadHandler struct {
-	uploadDir string
+	uploadService     *service.UploadService
+	connectionService *service.ConnectionService
+	maxImportRows     int
 }
 
 // NewUploadHandler creates a new upload handler
-func NewUploadHandler(uploadDir string) *UploadHandler {
-	// Ensure upload directory exists
-	os.MkdirAll(uploadDir, 0755)
-	return &UploadHandler{uploadDir: uploadDir}
+func NewUploadHandler(uploadService *service.UploadService) *UploadHandler {
+	return &UploadHandler{uploadService: uploadService}
+}
+
+// WithImports enables CSV and Excel imports, which create a SQLite connection in the
+// workspace. maxRows caps each imported table.
+func (h *UploadHandler) WithImports(connectionService *service.ConnectionService, maxRows int) *UploadHandler {
+	h.connectionService = connectionService
+	h.maxImportRows = maxRows
+	return h
 }
 
 // UploadSQLite handles SQLite file upload
 func (h *UploadHandler) UploadSQLite(w http.ResponseWriter, r *http.Request) {
-	// Limit upload to 100MB
-	r.ParseMultipartForm(100 << 20)
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	// Keep up to 32MB in memory, the rest spills to temp files.
+	// The overall size is capped by the BodyLimit middleware.
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			response.RequestTooLarge(w, maxBytesErr.Limit)
+			return
+		}
+		response.BadRequest(w, "invalid multipart form")
+		return
+	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
@@ -46,7 +82,7 @@ func (h *UploadHandler) UploadSQLite(w http.ResponseWriter, r *http.Request) {
 
 	// Generate unique filename to avoid collisions
 	uniqueName := fmt.Sprintf("%s%s", uuid.New().String(), ext)
-	destPath := filepath.Join(h.uploadDir, uniqueName)
+	destPath := filepath.Join(h.uploadService.Dir(), uniqueName)
 
 	// Create destination file
 	dst, err := os.Create(destPath)
@@ -57,18 +93,178 @@ func (h *UploadHandler) UploadSQLite(w http.ResponseWriter, r *http.Request) {
 	defer dst.Close()
 
 	// Copy uploaded file to destination
-	if _, err := io.Copy(dst, file); err != nil {
+	size, err := io.Copy(dst, file)
+	if err != nil {
 		os.Remove(destPath) // cleanup on error
 		response.InternalError(w, "failed to save file")
 		return
 	}
 
-	// Return the absolute path for the SQLite adapter
-	absPath, _ := filepath.Abs(destPath)
+	upload, err := h.uploadService.Record(r.Context(), userID, workspaceID, header.Filename, destPath, size)
+	if err != nil {
+		os.Remove(destPath)
+		logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Msg("Failed to record upload")
+		response.InternalError(w, "failed to save file")
+		return
+	}
 
+	// The absolute path is what the SQLite adapter opens
 	response.OK(w, map[string]any{
-		"file_path":     absPath,
+		"id":            upload.ID,
+		"file_path":     destPath,
 		"original_name": header.Filename,
-		"size":          header.Size,
+		"size":          size,
 	})
 }
+
+// UploadSpreadsheet converts an uploaded CSV or Excel file into a SQLite database,
+// one table per file or sheet, and creates a read-only connection to it
+func (h *UploadHandler) UploadSpreadsheet(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			response.RequestTooLarge(w, maxBytesErr.Limit)
+			return
+		}
+		response.BadRequest(w, "invalid multipart form")
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		response.BadRequest(w, "no file uploaded")
+		return
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	baseName := strings.TrimSuffix(filepath.Base(header.Filename), filepath.Ext(header.Filename))
+
+	var tables []*importer.Table
+	switch ext {
+	case ".csv", ".tsv", ".txt":
+		tableName := importer.SanitizeIdentifier(baseName)
+		if tableName == "" {
+			tableName = "data"
+		}
+		var table *importer.Table
+		table, err = importer.ReadCSV(file, tableName, h.maxImportRows)
+		tables = []*importer.Table{table}
+	case ".xlsx":
+		tables, err = importer.ReadXLSX(file, h.maxImportRows)
+	default:
+		response.BadRequest(w, "invalid file type. Allowed: .csv, .tsv, .txt, .xlsx")
+		return
+	}
+	if err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	destPath := filepath.Join(h.uploadService.Dir(), uuid.New().String()+".db")
+	if err := importer.WriteSQLite(r.Context(), destPath, tables); err != nil {
+		logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Msg("Failed to import spreadsheet")
+		response.InternalError(w, "failed to import file")
+		return
+	}
+
+	name := strings.TrimSpace(baseName)
+	if name == "" {
+		name = tables[0].Name
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	conn, err := h.connectionService.Create(r.Context(), userID, workspaceID, domain.ConnectionCreate{
+		Name:         name,
+		DatabaseType: domain.DatabaseTypeSQLite,
+		Host:         "localhost",
+		Port:         1,
+		Database:     destPath, // the SQLite adapter opens the file named here
+		Username:     "sqlite",
+		Password:     "sqlite",
+		SSLMode:      "disable",
+		ReadOnly:     true,
+	})
+	if err != nil {
+		os.Remove(destPath)
+		response.Err(w, r, err)
+		return
+	}
+
+	// The connection works without the record; the orphan sweep reports the untracked file
+	var size int64
+	if info, err := os.Stat(destPath); err == nil {
+		size = info.Size()
+	}
+	if _, err := h.uploadService.Record(r.Context(), userID, workspaceID, header.Filename, destPath, size); err != nil {
+		logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Msg("Failed to record upload")
+	}
+
+	response.Created(w, conn)
+}
+
+// List lists the files uploaded to the workspace
+func (h *UploadHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	uploads, err := h.uploadService.List(r.Context(), userID, workspaceID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, uploads)
+}
+
+// Delete deletes an uploaded file. A file used by a connection is only deleted, together
+// with the connection, when force=true.
+func (h *UploadHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	uploadID, err := uuid.Parse(chi.URLParam(r, "uploadID"))
+	if err != nil {
+		response.BadRequest(w, "invalid upload ID")
+		return
+	}
+
+	force := r.URL.Query().Get("force") == "true"
+	if err := h.uploadService.Delete(r.Context(), userID, workspaceID, uploadID, force); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
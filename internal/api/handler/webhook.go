@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// WebhookHandler handles workspace webhook endpoints
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: webhookService}
+}
+
+// List handles listing the webhooks of a workspace
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.webhookService.List(r.Context(), userID, workspaceID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response.OK(w, webhooks)
+}
+
+// Create handles webhook creation
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+
+	var input domain.WebhookCreate
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	webhook, err := h.webhookService.Create(r.Context(), userID, workspaceID, input)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response.Created(w, webhook)
+}
+
+// Update handles updating a webhook
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := webhookIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input domain.WebhookUpdate
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	webhook, err := h.webhookService.Update(r.Context(), userID, workspaceID, webhookID, input)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response.OK(w, webhook)
+}
+
+// Delete handles deleting a webhook
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := webhookIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.Delete(r.Context(), userID, workspaceID, webhookID); err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// Deliveries handles listing the recent deliveries of a webhook
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	userID, workspaceID, ok := workspaceScope(w, r)
+	if !ok {
+		return
+	}
+	webhookID, ok := webhookIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(r.Context(), userID, workspaceID, webhookID)
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+
+	response.OK(w, deliveries)
+}
+
+func webhookIDParam(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	webhookID, err := uuid.Parse(chi.URLParam(r, "webhookID"))
+	if err != nil {
+		response.BadRequest(w, "invalid webhook ID")
+		return uuid.Nil, false
+	}
+	return webhookID, true
+}
+
+// writeWebhookError maps webhook service errors to responses
+func writeWebhookError(w http.ResponseWriter, err error) {
+	msg := err.Error()
+	switch {
+	case msg == "access denied" || msg == "write access required" || msg == "admin access required":
+		response.Forbidden(w, msg)
+	case msg == "webhook not found":
+		response.NotFound(w, msg)
+	case strings.HasPrefix(msg, "webhook URL must") ||
+		strings.HasPrefix(msg, "webhook must subscribe") ||
+		strings.HasPrefix(msg, "unknown webhook event"):
+		response.BadRequest(w, msg)
+	default:
+		response.InternalError(w, msg)
+	}
+}
@@ -2,17 +2,22 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/Rrens/text-to-sql/internal/api/middleware"
 	"github.com/Rrens/text-to-sql/internal/api/response"
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/service"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 // WorkspaceHandler handles workspace endpoints
 type WorkspaceHandler struct {
 	workspaceService *service.WorkspaceService
+	bundleService    *service.WorkspaceBundleService
 }
 
 // NewWorkspaceHandler creates a new workspace handler
@@ -20,6 +25,12 @@ func NewWorkspaceHandler(workspaceService *service.WorkspaceService) *WorkspaceH
 	return &WorkspaceHandler{workspaceService: workspaceService}
 }
 
+// WithBundles enables exporting workspaces and importing them from a bundle
+func (h *WorkspaceHandler) WithBundles(bundleService *service.WorkspaceBundleService) *WorkspaceHandler {
+	h.bundleService = bundleService
+	return h
+}
+
 // Create handles workspace creation
 func (h *WorkspaceHandler) Create(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserID(r.Context())
@@ -29,8 +40,7 @@ func (h *WorkspaceHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input domain.WorkspaceCreate
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
@@ -41,7 +51,7 @@ func (h *WorkspaceHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	workspace, err := h.workspaceService.Create(r.Context(), userID, input)
 	if err != nil {
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -58,7 +68,7 @@ func (h *WorkspaceHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	workspaces, err := h.workspaceService.ListByUser(r.Context(), userID)
 	if err != nil {
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -81,15 +91,7 @@ func (h *WorkspaceHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	workspace, err := h.workspaceService.GetByID(r.Context(), userID, workspaceID)
 	if err != nil {
-		if err.Error() == "access denied" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		if err.Error() == "workspace not found" {
-			response.NotFound(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -111,18 +113,13 @@ func (h *WorkspaceHandler) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var input domain.WorkspaceUpdate
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		response.BadRequest(w, "invalid request body")
+	if !decodeJSON(w, r, &input) {
 		return
 	}
 
 	workspace, err := h.workspaceService.Update(r.Context(), userID, workspaceID, input)
 	if err != nil {
-		if err.Error() == "access denied" || err.Error() == "admin access required" {
-			response.Forbidden(w, err.Error())
-			return
-		}
-		response.InternalError(w, err.Error())
+		response.Err(w, r, err)
 		return
 	}
 
@@ -145,13 +142,183 @@ func (h *WorkspaceHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	err := h.workspaceService.Delete(r.Context(), userID, workspaceID)
 	if err != nil {
-		if err.Error() == "access denied" || err.Error() == "owner access required" {
-			response.Forbidden(w, err.Error())
+		response.Err(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// AddMember handles adding a member to a workspace
+func (h *WorkspaceHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	var input struct {
+		UserID uuid.UUID `json:"user_id" validate:"required"`
+		Role   string    `json:"role" validate:"required"`
+	}
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	err := h.workspaceService.AddMember(r.Context(), userID, workspaceID, input.UserID, input.Role)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.Created(w, map[string]any{
+		"workspace_id": workspaceID,
+		"user_id":      input.UserID,
+		"role":         input.Role,
+	})
+}
+
+// UpdateMemberRole handles changing the role of a workspace member
+func (h *WorkspaceHandler) UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	memberID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		response.BadRequest(w, "invalid user ID")
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" validate:"required"`
+	}
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+	if err := validate.Struct(input); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	if err := h.workspaceService.UpdateMemberRole(r.Context(), userID, workspaceID, memberID, input.Role); err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.OK(w, map[string]any{
+		"workspace_id": workspaceID,
+		"user_id":      memberID,
+		"role":         input.Role,
+	})
+}
+
+// RemoveMember handles removing a member from a workspace
+func (h *WorkspaceHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	memberID, err := uuid.Parse(chi.URLParam(r, "userID"))
+	if err != nil {
+		response.BadRequest(w, "invalid user ID")
+		return
+	}
+
+	err = h.workspaceService.RemoveMember(r.Context(), userID, workspaceID, memberID)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.NoContent(w)
+}
+
+// Export handles downloading a workspace bundle. The bundle is sent as is, not in the
+// response envelope, so the file can be imported unchanged.
+func (h *WorkspaceHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	workspaceID, ok := middleware.GetWorkspaceID(r.Context())
+	if !ok {
+		response.BadRequest(w, "missing workspace ID")
+		return
+	}
+
+	includeHistory := false
+	if raw := r.URL.Query().Get("include_history"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			response.BadRequest(w, "include_history must be true or false")
 			return
 		}
-		response.InternalError(w, err.Error())
+		includeHistory = b
+	}
+
+	bundle, err := h.bundleService.Export(r.Context(), userID, workspaceID, includeHistory)
+	if err != nil {
+		response.Err(w, r, err)
 		return
 	}
 
-	response.NoContent(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="workspace-%s.json"`, workspaceID))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(bundle)
+}
+
+// Import handles creating a workspace from an exported bundle
+func (h *WorkspaceHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserID(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthorized")
+		return
+	}
+
+	var bundle domain.WorkspaceBundle
+	if !decodeJSON(w, r, &bundle) {
+		return
+	}
+	if err := validate.Struct(bundle); err != nil {
+		response.BadRequest(w, err.Error())
+		return
+	}
+
+	report, err := h.bundleService.Import(r.Context(), userID, &bundle)
+	if err != nil {
+		response.Err(w, r, err)
+		return
+	}
+
+	response.Created(w, report)
 }
@@ -6,10 +6,11 @@ import (
 	"strings"
 
 	"github.com/Rrens/text-to-sql/internal/api/response"
-	"github.com/Rrens/text-to-sql/internal/repository/redis"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/security"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 )
 
 type contextKey string
@@ -17,12 +18,20 @@ type contextKey string
 const (
 	UserIDKey      contextKey = "userID"
 	UserEmailKey   contextKey = "userEmail"
+	WorkspacesKey  contextKey = "workspaces"
 	WorkspaceIDKey contextKey = "workspaceID"
+	IsAdminKey     contextKey = "isAdmin"
 )
 
+// DeactivationChecker reports whether a user was deactivated after their token was issued
+type DeactivationChecker interface {
+	IsDeactivated(ctx context.Context, userID uuid.UUID) (bool, error)
+}
+
 // AuthMiddleware handles JWT authentication
 type AuthMiddleware struct {
-	jwtManager *security.JWTManager
+	jwtManager    *security.JWTManager
+	deactivations DeactivationChecker
 }
 
 // NewAuthMiddleware creates a new auth middleware
@@ -30,6 +39,12 @@ func NewAuthMiddleware(jwtManager *security.JWTManager) *AuthMiddleware {
 	return &AuthMiddleware{jwtManager: jwtManager}
 }
 
+// WithDeactivationCheck rejects still-valid tokens of deactivated users
+func (m *AuthMiddleware) WithDeactivationCheck(checker DeactivationChecker) *AuthMiddleware {
+	m.deactivations = checker
+	return m
+}
+
 // Authenticate validates the JWT token
 func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -51,9 +66,24 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if m.deactivations != nil {
+			deactivated, err := m.deactivations.IsDeactivated(r.Context(), claims.UserID)
+			if err != nil {
+				logging.FromContext(r.Context()).Warn().Ctx(r.Context()).Err(err).Msg("failed to check user deactivation, allowing request")
+			} else if deactivated {
+				response.Unauthorized(w, "account deactivated")
+				return
+			}
+		}
+
 		// Add user info to context
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
 		ctx = context.WithValue(ctx, UserEmailKey, claims.Email)
+		ctx = context.WithValue(ctx, WorkspacesKey, claims.Workspaces)
+		ctx = context.WithValue(ctx, IsAdminKey, claims.IsAdmin)
+		logging.With(ctx, func(c zerolog.Context) zerolog.Context {
+			return c.Str("user_id", claims.UserID.String())
+		})
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -71,6 +101,29 @@ func GetUserEmail(ctx context.Context) (string, bool) {
 	return email, ok
 }
 
+// IsAdmin reports whether the access token carries the global admin flag
+func IsAdmin(ctx context.Context) bool {
+	isAdmin, _ := ctx.Value(IsAdminKey).(bool)
+	return isAdmin
+}
+
+// RequireAdmin allows only global administrators, based on the token claims
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(r.Context()) {
+			response.Forbidden(w, "admin access required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetWorkspaceClaims gets the workspace IDs carried in the access token from context
+func GetWorkspaceClaims(ctx context.Context) []uuid.UUID {
+	workspaces, _ := ctx.Value(WorkspacesKey).([]uuid.UUID)
+	return workspaces
+}
+
 // GetWorkspaceID gets the workspace ID from context
 func GetWorkspaceID(ctx context.Context) (uuid.UUID, bool) {
 	workspaceID, ok := ctx.Value(WorkspaceIDKey).(uuid.UUID)
@@ -93,45 +146,9 @@ func WorkspaceContext(next http.Handler) http.Handler {
 		}
 
 		ctx := context.WithValue(r.Context(), WorkspaceIDKey, workspaceID)
+		logging.With(ctx, func(c zerolog.Context) zerolog.Context {
+			return c.Str("workspace_id", workspaceID.String())
+		})
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
-
-// RateLimitMiddleware handles rate limiting
-type RateLimitMiddleware struct {
-	rateLimiter *redis.RateLimiter
-}
-
-// NewRateLimitMiddleware creates a new rate limit middleware
-func NewRateLimitMiddleware(rateLimiter *redis.RateLimiter) *RateLimitMiddleware {
-	return &RateLimitMiddleware{rateLimiter: rateLimiter}
-}
-
-// Limit applies rate limiting based on user ID
-func (m *RateLimitMiddleware) Limit(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		userID, ok := GetUserID(r.Context())
-		if !ok {
-			response.Error(w, http.StatusUnauthorized, "unauthorized")
-			return
-		}
-
-		allowed, remaining, resetTime, err := m.rateLimiter.Allow(r.Context(), userID.String())
-		if err != nil {
-			// If rate limiter fails, allow the request but log the error
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Set rate limit headers
-		w.Header().Set("X-RateLimit-Remaining", string(rune(remaining)))
-		w.Header().Set("X-RateLimit-Reset", resetTime.Format("2006-01-02T15:04:05Z"))
-
-		if !allowed {
-			response.Error(w, http.StatusTooManyRequests, "rate limit exceeded")
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
@@ -0,0 +1,84 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDeactivations is a DeactivationChecker backed by a set
+type fakeDeactivations struct {
+	users map[uuid.UUID]bool
+	err   error
+}
+
+func (f *fakeDeactivations) IsDeactivated(_ context.Context, userID uuid.UUID) (bool, error) {
+	return f.users[userID], f.err
+}
+
+func TestRequireAdmin(t *testing.T) {
+	jwtManager := security.NewJWTManager("require-admin-test-secret-32chars", time.Hour, time.Hour)
+	auth := middleware.NewAuthMiddleware(jwtManager)
+	h := auth.Authenticate(middleware.RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	adminToken, _ := jwtManager.GenerateAdminAccessToken(uuid.New(), "admin@example.com", nil)
+	userToken, _ := jwtManager.GenerateAccessToken(uuid.New(), "user@example.com", nil)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"admin", adminToken, http.StatusOK},
+		{"regular user", userToken, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/users", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+}
+
+func TestAuthenticate_Deactivated(t *testing.T) {
+	jwtManager := security.NewJWTManager("deactivation-test-secret-32chars!", time.Hour, time.Hour)
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	deactivatedID := uuid.New()
+	activeID := uuid.New()
+	checker := &fakeDeactivations{users: map[uuid.UUID]bool{deactivatedID: true}}
+
+	do := func(h http.Handler, userID uuid.UUID) int {
+		token, _ := jwtManager.GenerateAccessToken(userID, "user@example.com", nil)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	h := middleware.NewAuthMiddleware(jwtManager).WithDeactivationCheck(checker).Authenticate(okHandler)
+	assert.Equal(t, http.StatusUnauthorized, do(h, deactivatedID))
+	assert.Equal(t, http.StatusOK, do(h, activeID))
+
+	t.Run("checker failure allows request", func(t *testing.T) {
+		failing := &fakeDeactivations{err: errors.New("redis unavailable")}
+		h := middleware.NewAuthMiddleware(jwtManager).WithDeactivationCheck(failing).Authenticate(okHandler)
+		assert.Equal(t, http.StatusOK, do(h, deactivatedID))
+	})
+}
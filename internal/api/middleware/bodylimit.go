@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+)
+
+// limitedBody is a request body capped by BodyLimit or DefaultBodyLimit. It keeps the
+// original body so a route-level BodyLimit can replace the default limit instead of
+// nesting under it.
+type limitedBody struct {
+	io.ReadCloser
+	original io.ReadCloser
+	err      error // returned by every read when the declared length is over the limit
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// DefaultBodyLimit caps request bodies at maxBytes unless the matched route sets its own
+// limit with BodyLimit. It runs before routing, so a body that declares a larger
+// Content-Length is not rejected up front: it fails with *http.MaxBytesError on its
+// first read, which handlers answer with 413.
+func DefaultBodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limited := &limitedBody{
+				ReadCloser: http.MaxBytesReader(w, r.Body, maxBytes),
+				original:   r.Body,
+			}
+			if r.ContentLength > maxBytes {
+				limited.err = &http.MaxBytesError{Limit: maxBytes}
+			}
+			r.Body = limited
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BodyLimit caps the bodies of a route at maxBytes, replacing DefaultBodyLimit.
+// Requests that declare a larger Content-Length are rejected up front; others fail
+// with *http.MaxBytesError on read.
+func BodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > maxBytes {
+				response.RequestTooLarge(w, maxBytes)
+				return
+			}
+
+			body := r.Body
+			if limited, ok := body.(*limitedBody); ok {
+				body = limited.original
+			}
+			r.Body = &limitedBody{
+				ReadCloser: http.MaxBytesReader(w, body, maxBytes),
+				original:   body,
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middleware_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyLimit_RouteOverride(t *testing.T) {
+	readAll := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	global := middleware.DefaultBodyLimit(16)
+	upload := middleware.BodyLimit(1024)
+	body := strings.Repeat("x", 512)
+
+	for _, declared := range []bool{true, false} {
+		newRequest := func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			if !declared {
+				req.ContentLength = -1 // the limit applies while reading
+			}
+			return req
+		}
+
+		rec := httptest.NewRecorder()
+		global(readAll).ServeHTTP(rec, newRequest())
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+		// A larger route-level limit replaces the default one rather than nesting under it
+		rec = httptest.NewRecorder()
+		global(upload(readAll)).ServeHTTP(rec, newRequest())
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Route limits reject declared lengths over them up front
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(strings.Repeat("x", 2048)))
+	global(upload(readAll)).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
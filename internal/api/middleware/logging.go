@@ -1,32 +1,110 @@
 package middleware
 
 import (
+	"maps"
 	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
-// Logger is a middleware that logs HTTP requests
-func Logger(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-
-		defer func() {
-			log.Info().
-				Str("request_id", middleware.GetReqID(r.Context())).
-				Str("method", r.Method).
-				Str("path", r.URL.Path).
-				Int("status", ww.Status()).
-				Int("bytes", ww.BytesWritten()).
-				Dur("duration", time.Since(start)).
-				Str("remote_addr", r.RemoteAddr).
-				Str("user_agent", r.UserAgent()).
-				Msg("request")
-		}()
-
-		next.ServeHTTP(ww, r)
-	})
+// sensitiveParams are query parameters whose values never reach the logs
+var sensitiveParams = map[string]bool{
+	"access_token":  true,
+	"refresh_token": true,
+	"token":         true,
+	"api_key":       true,
+	"key":           true,
+	"password":      true,
+	"code":          true, // OIDC authorization code
+	"state":         true,
+}
+
+// Logger is a middleware that stores a request-scoped logger in the context and logs
+// each request with it. Requests slower than slowThreshold are logged at warn with the
+// phase timings recorded while serving them; zero disables this.
+// Headers are never logged so Authorization and API key headers cannot leak.
+func Logger(slowThreshold time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			logger := log.Logger.With().Str("request_id", middleware.GetReqID(r.Context())).Logger()
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				logger = logger.Hook(routeHook{rctx})
+			}
+			ctx := logging.NewContext(r.Context(), logger)
+
+			defer func() {
+				duration := time.Since(start)
+				event := logging.FromContext(ctx).Info()
+				slow := slowThreshold > 0 && duration > slowThreshold
+				if slow {
+					event = logging.FromContext(ctx).Warn()
+				}
+				event = event.
+					Ctx(ctx).
+					Str("method", r.Method).
+					Str("path", r.URL.Path)
+				if r.URL.RawQuery != "" {
+					event = event.Str("query", scrubQuery(r.URL.Query()))
+				}
+				if slow {
+					recorded := logging.Phases(ctx)
+					phases := zerolog.Dict()
+					for _, name := range slices.Sorted(maps.Keys(recorded)) {
+						phases = phases.Int64(name, recorded[name])
+					}
+					event = event.Dict("phases", phases)
+				}
+				event.
+					Int("status", ww.Status()).
+					Int("bytes", ww.BytesWritten()).
+					Dur("duration", duration).
+					Str("remote_addr", r.RemoteAddr).
+					Str("user_agent", r.UserAgent()).
+					Msg("request")
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
+
+// routeHook adds the matched route pattern, which is only known once routing is done
+type routeHook struct {
+	rctx *chi.Context
+}
+
+// Run implements zerolog.Hook
+func (h routeHook) Run(e *zerolog.Event, _ zerolog.Level, _ string) {
+	if route := h.rctx.RoutePattern(); route != "" {
+		e.Str("route", route)
+	}
+}
+
+// scrubQuery encodes query parameters with sensitive values masked
+func scrubQuery(values url.Values) string {
+	scrubbed := make(url.Values, len(values))
+	for key, vals := range values {
+		if sensitiveParams[strings.ToLower(key)] {
+			scrubbed[key] = []string{security.RedactedPlaceholder}
+			continue
+		}
+		masked := make([]string, len(vals))
+		for i, v := range vals {
+			masked[i] = security.RedactString(v)
+		}
+		scrubbed[key] = masked
+	}
+	return scrubbed.Encode()
 }
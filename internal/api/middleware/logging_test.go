@@ -0,0 +1,83 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	saved := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = saved })
+
+	jwtManager := security.NewJWTManager("request-logger-test-secret-32ch", time.Hour, time.Hour)
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	token, err := jwtManager.GenerateAccessToken(userID, "user@example.com", []uuid.UUID{workspaceID})
+	require.NoError(t, err)
+
+	newRouter := func(slowThreshold, delay time.Duration) http.Handler {
+		r := chi.NewRouter()
+		r.Use(chimiddleware.RequestID)
+		r.Use(middleware.Logger(slowThreshold))
+		r.Use(middleware.NewAuthMiddleware(jwtManager).Authenticate)
+		r.Route("/workspaces/{workspaceID}", func(r chi.Router) {
+			r.Use(middleware.WorkspaceContext)
+			r.Get("/query", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(delay)
+				logging.SetPhase(r.Context(), "llm_ms", 7)
+				logging.FromContext(r.Context()).Info().Msg("handled")
+				w.WriteHeader(http.StatusOK)
+			})
+		})
+		return r
+	}
+
+	serve := func(h http.Handler) []map[string]any {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/workspaces/"+workspaceID.String()+"/query", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		var lines []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var line map[string]any
+			require.NoError(t, dec.Decode(&line))
+			lines = append(lines, line)
+		}
+		require.Len(t, lines, 2)
+		return lines
+	}
+
+	lines := serve(newRouter(time.Hour, 0))
+	for _, line := range lines {
+		assert.NotEmpty(t, line["request_id"])
+		assert.Equal(t, userID.String(), line["user_id"])
+		assert.Equal(t, workspaceID.String(), line["workspace_id"])
+		assert.Equal(t, "/workspaces/{workspaceID}/query", line["route"])
+	}
+	assert.Equal(t, "handled", lines[0]["message"])
+	assert.Equal(t, "info", lines[1]["level"])
+	assert.NotContains(t, lines[1], "phases")
+
+	lines = serve(newRouter(time.Millisecond, 5*time.Millisecond))
+	assert.Equal(t, "warn", lines[1]["level"])
+	assert.Equal(t, map[string]any{"llm_ms": float64(7)}, lines[1]["phases"])
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/observability"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Limiter decides whether a request identified by key may proceed
+type Limiter interface {
+	// Allow returns (allowed, remaining, resetTime, error)
+	Allow(ctx context.Context, key string) (bool, int, time.Time, error)
+	// Limit returns the number of requests allowed per window
+	Limit() int
+}
+
+// WorkspaceLimiter is a Limiter that can also count requests in a bucket shared by
+// everyone in a workspace
+type WorkspaceLimiter interface {
+	Limiter
+	// AllowInWorkspace returns (allowed, byWorkspace, remaining, resetTime, error), where
+	// byWorkspace reports that remaining and resetTime are the workspace's
+	AllowInWorkspace(ctx context.Context, key string, workspaceID uuid.UUID, workspaceLimit int) (bool, bool, int, time.Time, error)
+}
+
+// WorkspaceRateLimits looks up the limit a workspace sets on its members' requests
+// together
+type WorkspaceRateLimits interface {
+	// WorkspaceRateLimit returns requests per minute, 0 when the workspace sets none
+	WorkspaceRateLimit(ctx context.Context, workspaceID uuid.UUID) (int, error)
+}
+
+// Scopes of the bucket a rate limit response reports, in X-RateLimit-Scope
+const (
+	RateLimitScopeUser      = "user"
+	RateLimitScopeWorkspace = "workspace"
+	RateLimitScopeIP        = "ip"
+)
+
+// RateLimitMiddleware handles rate limiting
+type RateLimitMiddleware struct {
+	rateLimiter Limiter
+	classes     map[string]Limiter
+	metrics     *observability.Metrics
+
+	workspaceLimits  WorkspaceRateLimits
+	workspaceDefault int // requests per minute of workspaces setting no limit, 0 for none
+	limitCache       *ttlCache[uuid.UUID, int]
+}
+
+// rateLimitDecision is the outcome of counting a request, for the bucket it reports
+type rateLimitDecision struct {
+	allowed   bool
+	scope     string
+	limit     int
+	remaining int
+	reset     time.Time
+}
+
+// NewRateLimitMiddleware creates a new rate limit middleware
+func NewRateLimitMiddleware(rateLimiter Limiter) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		rateLimiter: rateLimiter,
+		classes:     make(map[string]Limiter),
+	}
+}
+
+// WithWorkspaceLimits also counts requests made in a workspace against a bucket shared
+// by its members, limited to the workspace's own limit or defaultLimit requests a
+// minute. Workspace limits are looked up at most once per cacheTTL.
+func (m *RateLimitMiddleware) WithWorkspaceLimits(limits WorkspaceRateLimits, defaultLimit int, cacheTTL time.Duration) *RateLimitMiddleware {
+	m.workspaceLimits = limits
+	m.workspaceDefault = defaultLimit
+	if cacheTTL > 0 {
+		m.limitCache = newTTLCache[uuid.UUID, int](cacheTTL)
+	}
+	return m
+}
+
+// WithClass registers a limiter for a named class used by LimitClass
+func (m *RateLimitMiddleware) WithClass(class string, limiter Limiter) *RateLimitMiddleware {
+	m.classes[class] = limiter
+	return m
+}
+
+// WithMetrics counts rejected requests by class
+func (m *RateLimitMiddleware) WithMetrics(metrics *observability.Metrics) *RateLimitMiddleware {
+	m.metrics = metrics
+	return m
+}
+
+// Limit applies the default rate limit class based on user ID
+func (m *RateLimitMiddleware) Limit(next http.Handler) http.Handler {
+	return m.limit(domain.DefaultRateLimitClass, m.rateLimiter, next)
+}
+
+// LimitClass applies the named rate limit class based on user ID.
+// Unknown classes fall back to the default limiter.
+func (m *RateLimitMiddleware) LimitClass(class string) func(http.Handler) http.Handler {
+	limiter, ok := m.classes[class]
+	if !ok {
+		log.Warn().Str("class", class).Msg("unknown rate limit class, using default")
+		class, limiter = domain.DefaultRateLimitClass, m.rateLimiter
+	}
+	return func(next http.Handler) http.Handler {
+		return m.limit(class, limiter, next)
+	}
+}
+
+// LimitIP applies the named rate limit class keyed by client IP, for routes
+// without an authenticated user. It relies on RealIP having set r.RemoteAddr.
+func (m *RateLimitMiddleware) LimitIP(class string) func(http.Handler) http.Handler {
+	limiter, ok := m.classes[class]
+	if !ok {
+		log.Warn().Str("class", class).Msg("unknown rate limit class, using default")
+		class, limiter = domain.DefaultRateLimitClass, m.rateLimiter
+	}
+	return func(next http.Handler) http.Handler {
+		return m.enforce(class, next, func(r *http.Request) (string, bool) {
+			return "ip:" + r.RemoteAddr, r.RemoteAddr != ""
+		}, func(r *http.Request, key string) (rateLimitDecision, error) {
+			allowed, remaining, reset, err := limiter.Allow(r.Context(), key)
+			return rateLimitDecision{allowed, RateLimitScopeIP, limiter.Limit(), remaining, reset}, err
+		})
+	}
+}
+
+// limit enforces limiter for the authenticated user and labels headers with class.
+// Requests in a workspace are also counted against the workspace's shared bucket.
+func (m *RateLimitMiddleware) limit(class string, limiter Limiter, next http.Handler) http.Handler {
+	return m.enforce(class, next, func(r *http.Request) (string, bool) {
+		userID, ok := GetUserID(r.Context())
+		return userID.String(), ok
+	}, func(r *http.Request, key string) (rateLimitDecision, error) {
+		if workspaceID, ok := GetWorkspaceID(r.Context()); ok {
+			if shared, ok := limiter.(WorkspaceLimiter); ok {
+				if workspaceLimit := m.workspaceLimit(r.Context(), workspaceID); workspaceLimit > 0 {
+					allowed, byWorkspace, remaining, reset, err := shared.AllowInWorkspace(r.Context(), key, workspaceID, workspaceLimit)
+					if byWorkspace {
+						return rateLimitDecision{allowed, RateLimitScopeWorkspace, workspaceLimit, remaining, reset}, err
+					}
+					return rateLimitDecision{allowed, RateLimitScopeUser, limiter.Limit(), remaining, reset}, err
+				}
+			}
+		}
+		allowed, remaining, reset, err := limiter.Allow(r.Context(), key)
+		return rateLimitDecision{allowed, RateLimitScopeUser, limiter.Limit(), remaining, reset}, err
+	})
+}
+
+// workspaceLimit returns the requests a minute a workspace's members may make together,
+// 0 for no limit. The default applies while the lookup fails.
+func (m *RateLimitMiddleware) workspaceLimit(ctx context.Context, workspaceID uuid.UUID) int {
+	if m.workspaceLimits == nil {
+		return m.workspaceDefault
+	}
+	now := time.Now()
+	if m.limitCache != nil {
+		if limit, ok := m.limitCache.get(workspaceID, now); ok {
+			return limit
+		}
+	}
+
+	limit, err := m.workspaceLimits.WorkspaceRateLimit(ctx, workspaceID)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to get workspace rate limit, using the default")
+		return m.workspaceDefault
+	}
+	if limit <= 0 {
+		limit = m.workspaceDefault
+	}
+	if m.limitCache != nil {
+		m.limitCache.set(workspaceID, limit, now)
+	}
+	return limit
+}
+
+// enforce counts the request with count, for the subject returned by keyFn
+func (m *RateLimitMiddleware) enforce(class string, next http.Handler, keyFn func(*http.Request) (string, bool), count func(*http.Request, string) (rateLimitDecision, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := keyFn(r)
+		if !ok {
+			response.Error(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		decision, err := count(r, key)
+		if err != nil {
+			// If rate limiter fails, allow the request but log the error
+			logging.FromContext(r.Context()).Warn().Ctx(r.Context()).Err(err).
+				Str("class", class).
+				Str("key", key).
+				Msg("rate limiter failed, allowing request")
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Class", class)
+		w.Header().Set("X-RateLimit-Scope", decision.scope)
+		setRateLimitHeaders(w, decision.limit, decision.remaining, decision.reset)
+
+		if !decision.allowed {
+			m.metrics.ObserveRateLimitRejection(class)
+			w.Header().Set("Retry-After", strconv.Itoa(secondsUntil(decision.reset)))
+			message := "rate limit exceeded"
+			if decision.scope == RateLimitScopeWorkspace {
+				message = "workspace rate limit exceeded"
+			}
+			response.Err(w, r, &apperr.Error{
+				Kind:    apperr.RateLimited,
+				Message: message,
+				Details: map[string]any{"scope": decision.scope, "class": class, "limit": decision.limit},
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setRateLimitHeaders writes the X-RateLimit-* headers and the draft IETF RateLimit header
+func setRateLimitHeaders(w http.ResponseWriter, limit, remaining int, resetTime time.Time) {
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	h.Set("X-RateLimit-Reset", resetTime.UTC().Format(time.RFC3339))
+	h.Set("RateLimit", fmt.Sprintf("limit=%d, remaining=%d, reset=%d", limit, remaining, secondsUntil(resetTime)))
+}
+
+// secondsUntil returns the whole seconds until t, rounded up and never below 1
+func secondsUntil(t time.Time) int {
+	seconds := int(math.Ceil(time.Until(t).Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
@@ -0,0 +1,286 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLimiter allows the first `limit` calls per key and rejects the rest
+type fakeLimiter struct {
+	limit int
+	reset time.Time
+	err   error
+	count map[string]int
+}
+
+func newFakeLimiter(limit int) *fakeLimiter {
+	return &fakeLimiter{
+		limit: limit,
+		reset: time.Now().Add(30 * time.Second),
+		count: make(map[string]int),
+	}
+}
+
+func (f *fakeLimiter) Allow(_ context.Context, key string) (bool, int, time.Time, error) {
+	if f.err != nil {
+		return false, 0, time.Time{}, f.err
+	}
+	f.count[key]++
+	remaining := f.limit - f.count[key]
+	if remaining < 0 {
+		remaining = 0
+	}
+	return f.count[key] <= f.limit, remaining, f.reset, nil
+}
+
+func (f *fakeLimiter) Limit() int {
+	return f.limit
+}
+
+func newRateLimitedRequest(userID uuid.UUID) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, userID)
+	return req.WithContext(ctx)
+}
+
+func TestRateLimitMiddleware_Limit(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("sets numeric headers", func(t *testing.T) {
+		limiter := newFakeLimiter(100)
+		h := middleware.NewRateLimitMiddleware(limiter).Limit(okHandler)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRateLimitedRequest(uuid.New()))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "100", rec.Header().Get("X-RateLimit-Limit"))
+		// remaining=99 previously rendered as the rune "c"
+		assert.Equal(t, "99", rec.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, limiter.reset.UTC().Format(time.RFC3339), rec.Header().Get("X-RateLimit-Reset"))
+		assert.Regexp(t, `^limit=100, remaining=99, reset=\d+$`, rec.Header().Get("RateLimit"))
+		assert.Empty(t, rec.Header().Get("Retry-After"))
+	})
+
+	t.Run("rejects with retry-after", func(t *testing.T) {
+		limiter := newFakeLimiter(1)
+		h := middleware.NewRateLimitMiddleware(limiter).Limit(okHandler)
+		userID := uuid.New()
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRateLimitedRequest(userID))
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, newRateLimitedRequest(userID))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "0", rec.Header().Get("X-RateLimit-Remaining"))
+
+		retryAfter, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, retryAfter, 1)
+		assert.LessOrEqual(t, retryAfter, 30)
+	})
+
+	t.Run("limiter failure allows request", func(t *testing.T) {
+		limiter := newFakeLimiter(1)
+		limiter.err = errors.New("redis unavailable")
+		h := middleware.NewRateLimitMiddleware(limiter).Limit(okHandler)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRateLimitedRequest(uuid.New()))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("X-RateLimit-Limit"))
+	})
+
+	t.Run("missing user", func(t *testing.T) {
+		h := middleware.NewRateLimitMiddleware(newFakeLimiter(1)).Limit(okHandler)
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestRateLimitMiddleware_LimitClass(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	defaultLimiter := newFakeLimiter(100)
+	queryLimiter := newFakeLimiter(1)
+	m := middleware.NewRateLimitMiddleware(defaultLimiter).WithClass("query", queryLimiter)
+
+	userID := uuid.New()
+	queryHandler := m.LimitClass("query")(okHandler)
+	defaultHandler := m.Limit(okHandler)
+
+	rec := httptest.NewRecorder()
+	queryHandler.ServeHTTP(rec, newRateLimitedRequest(userID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "query", rec.Header().Get("X-RateLimit-Class"))
+	assert.Equal(t, "1", rec.Header().Get("X-RateLimit-Limit"))
+
+	// The query bucket is exhausted independently of the default bucket
+	rec = httptest.NewRecorder()
+	queryHandler.ServeHTTP(rec, newRateLimitedRequest(userID))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "query", rec.Header().Get("X-RateLimit-Class"))
+
+	rec = httptest.NewRecorder()
+	defaultHandler.ServeHTTP(rec, newRateLimitedRequest(userID))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "default", rec.Header().Get("X-RateLimit-Class"))
+	assert.Equal(t, "99", rec.Header().Get("X-RateLimit-Remaining"))
+
+	t.Run("unknown class falls back to default", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		m.LimitClass("missing")(okHandler).ServeHTTP(rec, newRateLimitedRequest(userID))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "default", rec.Header().Get("X-RateLimit-Class"))
+	})
+}
+
+func TestRateLimitMiddleware_LimitIP(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	authLimiter := newFakeLimiter(1)
+	m := middleware.NewRateLimitMiddleware(newFakeLimiter(100)).WithClass("auth", authLimiter)
+	h := middleware.RealIP(nil)(m.LimitIP("auth")(okHandler))
+
+	newRequest := func(remoteAddr, forwarded string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+		req.RemoteAddr = remoteAddr
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		return req
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("203.0.113.7:1000", ""))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "auth", rec.Header().Get("X-RateLimit-Class"))
+
+	// Rotating X-Forwarded-For from an untrusted peer does not reset the bucket
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("203.0.113.7:1001", "1.2.3.4"))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("198.51.100.9:1000", ""))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 2, authLimiter.count["ip:203.0.113.7"])
+	assert.Equal(t, 1, authLimiter.count["ip:198.51.100.9"])
+}
+
+// fakeWorkspaceLimiter also counts requests per workspace, shared by all users
+type fakeWorkspaceLimiter struct {
+	*fakeLimiter
+	workspaces map[uuid.UUID]int
+}
+
+func (f *fakeWorkspaceLimiter) AllowInWorkspace(ctx context.Context, key string, workspaceID uuid.UUID, workspaceLimit int) (bool, bool, int, time.Time, error) {
+	if f.workspaces[workspaceID] >= workspaceLimit {
+		return false, true, 0, f.reset, nil
+	}
+	allowed, remaining, reset, err := f.Allow(ctx, key)
+	if !allowed || err != nil {
+		return allowed, false, remaining, reset, err
+	}
+	f.workspaces[workspaceID]++
+	if left := workspaceLimit - f.workspaces[workspaceID]; left < remaining {
+		return true, true, left, f.reset, nil
+	}
+	return true, false, remaining, reset, nil
+}
+
+// workspaceLimits returns fixed limits by workspace and counts lookups
+type workspaceLimits struct {
+	limits  map[uuid.UUID]int
+	lookups int
+}
+
+func (l *workspaceLimits) WorkspaceRateLimit(_ context.Context, workspaceID uuid.UUID) (int, error) {
+	l.lookups++
+	return l.limits[workspaceID], nil
+}
+
+func TestRateLimitMiddleware_Workspace(t *testing.T) {
+	okHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	inWorkspace := func(userID, workspaceID uuid.UUID) *http.Request {
+		req := newRateLimitedRequest(userID)
+		return req.WithContext(context.WithValue(req.Context(), middleware.WorkspaceIDKey, workspaceID))
+	}
+
+	strict, busy := uuid.New(), uuid.New()
+	limits := &workspaceLimits{limits: map[uuid.UUID]int{strict: 2}}
+	limiter := &fakeWorkspaceLimiter{fakeLimiter: newFakeLimiter(10), workspaces: map[uuid.UUID]int{}}
+	h := middleware.NewRateLimitMiddleware(limiter).WithWorkspaceLimits(limits, 3, time.Minute).Limit(okHandler)
+
+	t.Run("workspace setting", func(t *testing.T) {
+		for range 2 {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, inWorkspace(uuid.New(), strict))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "workspace", rec.Header().Get("X-RateLimit-Scope"))
+			assert.Equal(t, "2", rec.Header().Get("X-RateLimit-Limit"))
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, inWorkspace(uuid.New(), strict))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "workspace", rec.Header().Get("X-RateLimit-Scope"))
+		assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+		assert.Contains(t, rec.Body.String(), `"scope":"workspace"`)
+		assert.Contains(t, rec.Body.String(), "workspace rate limit exceeded")
+		assert.Equal(t, 1, limits.lookups, "the limit is cached")
+	})
+
+	t.Run("server default", func(t *testing.T) {
+		for range 3 {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, inWorkspace(uuid.New(), busy))
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, inWorkspace(uuid.New(), busy))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	})
+
+	t.Run("user limit within a workspace", func(t *testing.T) {
+		userID := uuid.New()
+		limiter.count[userID.String()] = 10
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, inWorkspace(userID, uuid.New()))
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "user", rec.Header().Get("X-RateLimit-Scope"))
+		assert.Contains(t, rec.Body.String(), `"scope":"user"`)
+	})
+
+	t.Run("outside a workspace", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRateLimitedRequest(uuid.New()))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "user", rec.Header().Get("X-RateLimit-Scope"))
+		assert.Equal(t, "10", rec.Header().Get("X-RateLimit-Limit"))
+	})
+}
@@ -0,0 +1,63 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		want       string
+	}{
+		{"no header", "203.0.113.7:5123", "", "", "203.0.113.7"},
+		{"spoofed header from untrusted peer", "203.0.113.7:5123", "1.2.3.4", "", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.5:80", "198.51.100.9", "", "198.51.100.9"},
+		{"client-supplied prefix is ignored", "10.0.0.5:80", "1.2.3.4, 198.51.100.9", "", "198.51.100.9"},
+		{"chain of trusted proxies", "10.0.0.5:80", "198.51.100.9, 192.168.1.1, 10.1.2.3", "", "198.51.100.9"},
+		{"malformed hop", "10.0.0.5:80", "198.51.100.9, garbage", "", "10.0.0.5"},
+		{"only trusted hops", "10.0.0.5:80", "10.1.2.3", "", "10.1.2.3"},
+		{"real ip from trusted proxy", "10.0.0.5:80", "", "198.51.100.9", "198.51.100.9"},
+		{"spoofed real ip from untrusted peer", "203.0.113.7:5123", "", "1.2.3.4", "203.0.113.7"},
+		{"forwarded chain wins over real ip", "10.0.0.5:80", "198.51.100.9", "1.2.3.4", "198.51.100.9"},
+		{"malformed real ip", "10.0.0.5:80", "", "garbage", "10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := middleware.RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseTrustedProxies_Invalid(t *testing.T) {
+	_, err := middleware.ParseTrustedProxies([]string{"not-an-ip"})
+	assert.Error(t, err)
+}
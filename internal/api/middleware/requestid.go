@@ -0,0 +1,19 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader returns the request ID assigned by middleware.RequestID in the
+// X-Request-ID response header, where error responses also pick it up
+func RequestIDHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			w.Header().Set(response.RequestIDHeader, id)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCacheEntries bounds a ttlCache; lookups past it are not cached until a sweep
+// frees room
+const maxCacheEntries = 10000
+
+// ttlCache maps keys to values that expire ttl after they are set. Expired entries
+// are swept at most once per ttl, when a value is set.
+type ttlCache[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[K]ttlEntry[V]
+	nextSweep time.Time
+}
+
+// ttlEntry is a cached value and when it expires
+type ttlEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// newTTLCache creates a cache of values kept for ttl
+func newTTLCache[K comparable, V any](ttl time.Duration) *ttlCache[K, V] {
+	return &ttlCache[K, V]{ttl: ttl, entries: make(map[K]ttlEntry[V])}
+}
+
+// get returns the value of key unless it expired by now
+func (c *ttlCache[K, V]) get(key K, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set caches value for key until ttl after now
+func (c *ttlCache[K, V]) set(key K, value V, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !now.Before(c.nextSweep) {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= maxCacheEntries {
+		return
+	}
+	c.entries[key] = ttlEntry[V]{value: value, expiresAt: now.Add(c.ttl)}
+}
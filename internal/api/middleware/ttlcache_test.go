@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTTLCache(t *testing.T) {
+	now := time.Now()
+	cache := newTTLCache[int, string](time.Minute)
+
+	cache.set(1, "one", now)
+	got, ok := cache.get(1, now.Add(30*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, "one", got)
+	_, ok = cache.get(1, now.Add(time.Minute))
+	assert.False(t, ok, "expired")
+
+	cache.set(2, "two", now.Add(2*time.Minute))
+	assert.Len(t, cache.entries, 1, "expired entries are swept")
+
+	for i := range maxCacheEntries {
+		cache.set(i+10, "", now.Add(2*time.Minute))
+	}
+	_, ok = cache.get(maxCacheEntries+9, now.Add(2*time.Minute))
+	assert.False(t, ok, "full cache does not grow")
+	assert.Len(t, cache.entries, maxCacheEntries)
+}
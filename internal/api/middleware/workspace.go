@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+// MembershipChecker reports whether a user belongs to a workspace
+type MembershipChecker interface {
+	IsMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error)
+}
+
+// membershipKey identifies a cached membership lookup
+type membershipKey struct {
+	workspaceID uuid.UUID
+	userID      uuid.UUID
+}
+
+// WorkspaceAccessMiddleware rejects requests for workspaces the caller is not a member of
+type WorkspaceAccessMiddleware struct {
+	checker  MembershipChecker
+	cacheTTL time.Duration
+	cache    *ttlCache[membershipKey, struct{}]
+}
+
+// NewWorkspaceAccessMiddleware creates a new workspace access middleware.
+// Positive membership lookups are cached for cacheTTL; negative ones are never cached
+// so newly added members get access immediately.
+func NewWorkspaceAccessMiddleware(checker MembershipChecker, cacheTTL time.Duration) *WorkspaceAccessMiddleware {
+	return &WorkspaceAccessMiddleware{
+		checker:  checker,
+		cacheTTL: cacheTTL,
+		cache:    newTTLCache[membershipKey, struct{}](cacheTTL),
+	}
+}
+
+// RequireMember verifies the workspace in the URL against the token's workspace claims,
+// falling back to a cached membership lookup for workspaces joined after the token was issued.
+// It must run after Authenticate and WorkspaceContext.
+//
+// Claims are trusted until the token expires, so a member removed from a workspace keeps
+// passing this check with an earlier token. Routes that must stop removed members at once
+// also check the role in their service.
+func (m *WorkspaceAccessMiddleware) RequireMember(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := GetUserID(r.Context())
+		if !ok {
+			response.Unauthorized(w, "unauthorized")
+			return
+		}
+
+		workspaceID, ok := GetWorkspaceID(r.Context())
+		if !ok {
+			response.BadRequest(w, "missing workspace ID")
+			return
+		}
+
+		if slices.Contains(GetWorkspaceClaims(r.Context()), workspaceID) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		isMember, err := m.isMember(r.Context(), workspaceID, userID)
+		if err != nil {
+			logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Msg("failed to check workspace membership")
+			response.InternalError(w, "failed to check workspace access")
+			return
+		}
+		if !isMember {
+			response.Forbidden(w, "access denied")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isMember checks membership through the cache, then the checker
+func (m *WorkspaceAccessMiddleware) isMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
+	key := membershipKey{workspaceID: workspaceID, userID: userID}
+	now := time.Now()
+
+	if _, ok := m.cache.get(key, now); ok {
+		return true, nil
+	}
+
+	isMember, err := m.checker.IsMember(ctx, workspaceID, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if isMember && m.cacheTTL > 0 {
+		m.cache.set(key, struct{}{}, now)
+	}
+
+	return isMember, nil
+}
@@ -0,0 +1,120 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMembership is a MembershipChecker backed by a map
+type fakeMembership struct {
+	members map[uuid.UUID][]uuid.UUID // workspace -> users
+	err     error
+	calls   int
+}
+
+func (f *fakeMembership) IsMember(_ context.Context, workspaceID, userID uuid.UUID) (bool, error) {
+	f.calls++
+	if f.err != nil {
+		return false, f.err
+	}
+	for _, id := range f.members[workspaceID] {
+		if id == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newWorkspaceRouter(jwtManager *security.JWTManager, checker middleware.MembershipChecker) http.Handler {
+	auth := middleware.NewAuthMiddleware(jwtManager)
+	access := middleware.NewWorkspaceAccessMiddleware(checker, time.Minute)
+
+	r := chi.NewRouter()
+	r.Use(auth.Authenticate)
+	r.Route("/workspaces/{workspaceID}", func(r chi.Router) {
+		r.Use(middleware.WorkspaceContext)
+		r.Use(access.RequireMember)
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+	})
+	return r
+}
+
+func doWorkspaceRequest(t *testing.T, h http.Handler, token string, workspaceID uuid.UUID) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/workspaces/"+workspaceID.String()+"/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWorkspaceAccess(t *testing.T) {
+	jwtManager := security.NewJWTManager("workspace-access-test-secret-32c", time.Hour, time.Hour)
+
+	userID := uuid.New()
+	ownWorkspace := uuid.New()
+	joinedWorkspace := uuid.New()
+	otherWorkspace := uuid.New()
+
+	// The token was issued before the user joined joinedWorkspace
+	token, err := jwtManager.GenerateAccessToken(userID, "user@example.com", []uuid.UUID{ownWorkspace})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	t.Run("workspace in claims skips lookup", func(t *testing.T) {
+		checker := &fakeMembership{}
+		h := newWorkspaceRouter(jwtManager, checker)
+
+		assert.Equal(t, http.StatusOK, doWorkspaceRequest(t, h, token, ownWorkspace))
+		assert.Equal(t, 0, checker.calls)
+	})
+
+	t.Run("stale claims fall back to membership lookup", func(t *testing.T) {
+		checker := &fakeMembership{members: map[uuid.UUID][]uuid.UUID{joinedWorkspace: {userID}}}
+		h := newWorkspaceRouter(jwtManager, checker)
+
+		assert.Equal(t, http.StatusOK, doWorkspaceRequest(t, h, token, joinedWorkspace))
+		assert.Equal(t, http.StatusOK, doWorkspaceRequest(t, h, token, joinedWorkspace))
+		assert.Equal(t, 1, checker.calls, "positive lookup should be cached")
+	})
+
+	t.Run("cross-tenant access is rejected", func(t *testing.T) {
+		checker := &fakeMembership{members: map[uuid.UUID][]uuid.UUID{otherWorkspace: {uuid.New()}}}
+		h := newWorkspaceRouter(jwtManager, checker)
+
+		assert.Equal(t, http.StatusForbidden, doWorkspaceRequest(t, h, token, otherWorkspace))
+		assert.Equal(t, http.StatusForbidden, doWorkspaceRequest(t, h, token, otherWorkspace))
+		assert.Equal(t, 2, checker.calls, "negative lookup should not be cached")
+	})
+
+	t.Run("lookup failure", func(t *testing.T) {
+		checker := &fakeMembership{err: errors.New("db down")}
+		h := newWorkspaceRouter(jwtManager, checker)
+
+		assert.Equal(t, http.StatusInternalServerError, doWorkspaceRequest(t, h, token, otherWorkspace))
+	})
+
+	t.Run("invalid workspace ID", func(t *testing.T) {
+		h := newWorkspaceRouter(jwtManager, &fakeMembership{})
+
+		req := httptest.NewRequest(http.MethodGet, "/workspaces/not-a-uuid/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,177 @@
+// Package openapi embeds the API's OpenAPI 3 specification, serves it and
+// validates requests against it.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/google/uuid"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+func init() {
+	// IDs are checked the same way the handlers parse them
+	openapi3.DefineStringFormatCallback("uuid", func(value string) error {
+		_, err := uuid.Parse(value)
+		return err
+	})
+}
+
+// Spec is the parsed specification of the /api/v1 routes
+type Spec struct {
+	doc    *openapi3.T
+	json   []byte
+	router routers.Router
+}
+
+// Load parses and validates the embedded specification
+func Load() (*Spec, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(specYAML)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse openapi spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode openapi spec: %w", err)
+	}
+
+	// Paths are matched with the /api/v1 prefix already stripped, so the router
+	// must not try to match the documented server URLs
+	routed := *doc
+	routed.Servers = nil
+	router, err := legacy.NewRouter(&routed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build openapi router: %w", err)
+	}
+
+	return &Spec{doc: doc, json: data, router: router}, nil
+}
+
+// Doc returns the parsed specification
+func (s *Spec) Doc() *openapi3.T {
+	return s.doc
+}
+
+// Handler serves the specification as JSON
+func (s *Spec) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.json)
+	})
+}
+
+// Validator rejects requests to documented operations whose parameters or JSON body
+// do not match the specification. prefix is stripped from the path before matching.
+// Undocumented routes pass through; they are caught by the route coverage test instead.
+func (s *Spec) Validator(prefix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			match := r.Clone(r.Context())
+			match.URL.Path = strings.TrimPrefix(r.URL.Path, prefix)
+			if len(match.URL.Path) > 1 {
+				match.URL.Path = strings.TrimSuffix(match.URL.Path, "/")
+			}
+			match.URL.RawPath = ""
+
+			route, pathParams, err := s.router.FindRoute(match)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			options := &openapi3filter.Options{
+				AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+				SkipSettingDefaults: true,
+				// Uploads are streamed by the handler under their own size limit
+				ExcludeRequestBody: !isJSON(r),
+			}
+			options.WithCustomSchemaErrorFunc(func(err *openapi3.SchemaError) string {
+				return err.Reason
+			})
+
+			err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				// The body is over the default limit, which the matched route may raise;
+				// the handler reads it under the route's own limit
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					next.ServeHTTP(w, r)
+					return
+				}
+				response.BadRequest(w, validationMessage(err))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isJSON reports whether the request carries a JSON body
+func isJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+// validationMessage flattens a validation error into a single line
+func validationMessage(err error) string {
+	var requestErr *openapi3filter.RequestError
+	if errors.As(err, &requestErr) {
+		msg := requestErr.Error()
+		if i := strings.IndexByte(msg, '\n'); i >= 0 {
+			msg = msg[:i]
+		}
+		return msg
+	}
+	return err.Error()
+}
+
+// DocsHandler serves Swagger UI for the specification at specURL
+func DocsHandler(specURL string) http.Handler {
+	page := fmt.Sprintf(docsPage, specURL)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+}
+
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Text-to-SQL API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: %q, dom_id: "#swagger-ui", persistAuthorization: true });
+    };
+  </script>
+</body>
+</html>
+`
@@ -0,0 +1,133 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/api/openapi"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	spec.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+	assert.Contains(t, doc["paths"], "/workspaces/{workspaceID}/query")
+}
+
+func TestValidator(t *testing.T) {
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+
+	var reached bool
+	r := chi.NewRouter()
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(spec.Validator("/api/v1"))
+		r.Post("/workspaces/{workspaceID}/query", func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		})
+		r.Get("/workspaces/{workspaceID}/stats/queries", func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		})
+		r.Post("/workspaces/", func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		})
+		r.Get("/undocumented", func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+		})
+	})
+
+	const workspace = "/api/v1/workspaces/7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{
+			name:   "valid query",
+			method: http.MethodPost,
+			path:   workspace + "/query",
+			body:   `{"connection_id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","session_id":null,"question":"how many users?","execute":true}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "missing question",
+			method: http.MethodPost,
+			path:   workspace + "/query",
+			body:   `{"connection_id":"7c9e6679-7425-40de-944b-e07fc1f90ae7"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown field",
+			method: http.MethodPost,
+			path:   workspace + "/query",
+			body:   `{"connection_id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","question":"q","sql":"DROP TABLE users"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid workspace ID",
+			method: http.MethodPost,
+			path:   "/api/v1/workspaces/abc/query",
+			body:   `{"connection_id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","question":"q"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "query parameter out of range",
+			method: http.MethodGet,
+			path:   workspace + "/stats/queries?days=1000",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "trailing slash route",
+			method: http.MethodPost,
+			path:   "/api/v1/workspaces/",
+			body:   `{"name":"Analytics","settings":{"max_rows":100}}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "undocumented route passes through",
+			method: http.MethodGet,
+			path:   "/api/v1/undocumented",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.status == http.StatusOK, reached)
+		})
+	}
+}
+
+func TestDocsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	openapi.DocsHandler("/api/v1/openapi.json").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `url: "/api/v1/openapi.json"`)
+}
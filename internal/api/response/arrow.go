@@ -0,0 +1,224 @@
+package response
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// ArrowStreamType is the media type of the Arrow IPC stream format
+const ArrowStreamType = "application/vnd.apache.arrow.stream"
+
+// arrowBatchRows is how many rows go in each record batch, so only one batch of a
+// result is converted at a time
+const arrowBatchRows = 1024
+
+// WantsArrow reports whether the request's Accept header asks for an Arrow stream
+func WantsArrow(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted)); err == nil && mediaType == ArrowStreamType {
+			return true
+		}
+	}
+	return false
+}
+
+// Arrow sends rows as an Arrow IPC stream, in record batches flushed as they are
+// written, with metadata on the schema. Each column's type is derived from its values:
+// integers, floats, booleans and times keep their type, mixed or other values become
+// strings as they are in JSON, and columns of nulls only are null typed.
+func Arrow(w http.ResponseWriter, columns []string, rows [][]any, metadata map[string]string) error {
+	schema := arrowSchema(columns, rows, metadata)
+
+	w.Header().Set("Content-Type", ArrowStreamType)
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(http.StatusOK)
+	flush := http.NewResponseController(w).Flush
+
+	mem := memory.NewGoAllocator()
+	writer := ipc.NewWriter(w, ipc.WithSchema(schema), ipc.WithAllocator(mem))
+	err := writeRecordBatches(mem, schema, rows, func(rec arrow.RecordBatch) error {
+		if err := writer.Write(rec); err != nil {
+			return err
+		}
+		_ = flush()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close arrow stream: %w", err)
+	}
+	return nil
+}
+
+// arrowSchema returns the schema of rows with the given column names and metadata,
+// typing each column with arrowColumnType
+func arrowSchema(columns []string, rows [][]any, metadata map[string]string) *arrow.Schema {
+	fields := make([]arrow.Field, len(columns))
+	for i, name := range columns {
+		fields[i] = arrow.Field{Name: name, Type: arrowColumnType(rows, i), Nullable: true}
+	}
+	md := arrow.MetadataFrom(metadata)
+	return arrow.NewSchema(fields, &md)
+}
+
+// writeRecordBatches converts rows to record batches of arrowBatchRows rows, one at a
+// time, and passes each to write
+func writeRecordBatches(mem memory.Allocator, schema *arrow.Schema, rows [][]any, write func(arrow.RecordBatch) error) error {
+	builder := array.NewRecordBuilder(mem, schema)
+	defer builder.Release()
+
+	for start := 0; start < len(rows); start += arrowBatchRows {
+		batch := rows[start:min(start+arrowBatchRows, len(rows))]
+		for i, field := range schema.Fields() {
+			for _, row := range batch {
+				var v any
+				if i < len(row) {
+					v = row[i]
+				}
+				appendArrowValue(builder.Field(i), field.Type, v)
+			}
+		}
+		rec := builder.NewRecordBatch()
+		err := write(rec)
+		rec.Release()
+		if err != nil {
+			return fmt.Errorf("failed to write record batch: %w", err)
+		}
+	}
+	return nil
+}
+
+// arrowColumnType derives the type of column i from its non-null values
+func arrowColumnType(rows [][]any, i int) arrow.DataType {
+	var ints, floats, bools, times, others int
+	for _, row := range rows {
+		if i >= len(row) || row[i] == nil {
+			continue
+		}
+		switch v := row[i].(type) {
+		case int, int8, int16, int32, int64, uint8, uint16, uint32:
+			ints++
+		case uint, uint64:
+			if _, ok := arrowInt(v); ok {
+				ints++
+			} else {
+				others++
+			}
+		case float32, float64:
+			floats++
+		case bool:
+			bools++
+		case time.Time:
+			times++
+		default:
+			others++
+		}
+	}
+
+	switch {
+	case others > 0:
+		return arrow.BinaryTypes.String
+	case ints+floats+bools+times == 0:
+		return arrow.Null
+	case ints+floats > 0 && bools+times == 0:
+		if floats > 0 {
+			return arrow.PrimitiveTypes.Float64
+		}
+		return arrow.PrimitiveTypes.Int64
+	case bools > 0 && ints+floats+times == 0:
+		return arrow.FixedWidthTypes.Boolean
+	case times > 0 && ints+floats+bools == 0:
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	}
+	return arrow.BinaryTypes.String
+}
+
+// appendArrowValue appends v to a builder of type t, as chosen by arrowColumnType
+func appendArrowValue(b array.Builder, t arrow.DataType, v any) {
+	if v == nil {
+		b.AppendNull()
+		return
+	}
+	switch t.ID() {
+	case arrow.NULL:
+		b.AppendNull()
+	case arrow.INT64:
+		n, _ := arrowInt(v)
+		b.(*array.Int64Builder).Append(n)
+	case arrow.FLOAT64:
+		f, ok := v.(float64)
+		if !ok {
+			if f32, ok := v.(float32); ok {
+				f = float64(f32)
+			} else {
+				n, _ := arrowInt(v)
+				f = float64(n)
+			}
+		}
+		b.(*array.Float64Builder).Append(f)
+	case arrow.BOOL:
+		b.(*array.BooleanBuilder).Append(v.(bool))
+	case arrow.TIMESTAMP:
+		b.(*array.TimestampBuilder).Append(arrow.Timestamp(v.(time.Time).UnixMicro()))
+	default:
+		b.(*array.StringBuilder).Append(arrowString(v))
+	}
+}
+
+// arrowInt converts an integer value to int64, reporting false when it does not fit
+func arrowInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint:
+		return int64(n), uint64(n) <= math.MaxInt64
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// arrowString renders a value of a string column as the JSON API shows it
+func arrowString(v any) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	case time.Time:
+		return s.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return s.String()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.Trim(string(b), `"`)
+}
@@ -0,0 +1,102 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWantsArrow(t *testing.T) {
+	for accept, want := range map[string]bool{
+		"application/vnd.apache.arrow.stream":                         true,
+		"application/json;q=0.5, application/vnd.apache.arrow.stream": true,
+		"application/json": false,
+		"":                 false,
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("Accept", accept)
+		assert.Equal(t, want, WantsArrow(r), accept)
+	}
+}
+
+func TestArrow(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	id := uuid.MustParse("7d0c9a6e-1f6b-4a57-9a3f-0b8f2b8c1e55")
+	rows := make([][]any, 0, arrowBatchRows+2)
+	for i := range arrowBatchRows + 2 {
+		rows = append(rows, []any{int64(i), 1.5, "order", true, createdAt, nil, id})
+	}
+	rows[1] = []any{int32(1), int64(2), nil, false, nil, nil, id}
+
+	w := httptest.NewRecorder()
+	columns := []string{"id", "total", "note", "paid", "created_at", "empty", "customer"}
+	require.NoError(t, Arrow(w, columns, rows, map[string]string{"sql": "SELECT * FROM orders"}))
+
+	assert.Equal(t, ArrowStreamType, w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("Content-Length"))
+
+	reader, err := ipc.NewReader(w.Body)
+	require.NoError(t, err)
+	defer reader.Release()
+
+	schema := reader.Schema()
+	sql, ok := schema.Metadata().GetValue("sql")
+	require.True(t, ok)
+	assert.Equal(t, "SELECT * FROM orders", sql)
+	wantTypes := []arrow.DataType{
+		arrow.PrimitiveTypes.Int64,
+		arrow.PrimitiveTypes.Float64,
+		arrow.BinaryTypes.String,
+		arrow.FixedWidthTypes.Boolean,
+		&arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"},
+		arrow.Null,
+		arrow.BinaryTypes.String,
+	}
+	for i, field := range schema.Fields() {
+		assert.Equal(t, columns[i], field.Name)
+		assert.True(t, arrow.TypeEqual(wantTypes[i], field.Type), "column %s is %s", field.Name, field.Type)
+	}
+
+	var batches, total int
+	for reader.Next() {
+		rec := reader.RecordBatch()
+		if batches == 0 {
+			ids := rec.Column(0).(*array.Int64)
+			assert.Equal(t, int64(1), ids.Value(1), "int32 widened")
+			totals := rec.Column(1).(*array.Float64)
+			assert.Equal(t, 1.5, totals.Value(0))
+			assert.Equal(t, 2.0, totals.Value(1), "integers in a float column")
+			assert.True(t, rec.Column(2).IsNull(1))
+			assert.Equal(t, "order", rec.Column(2).(*array.String).Value(0))
+			assert.False(t, rec.Column(3).(*array.Boolean).Value(1))
+			assert.Equal(t, arrow.Timestamp(createdAt.UnixMicro()), rec.Column(4).(*array.Timestamp).Value(0))
+			assert.True(t, rec.Column(4).IsNull(1))
+			assert.Equal(t, id.String(), rec.Column(6).(*array.String).Value(0))
+		}
+		batches++
+		total += int(rec.NumRows())
+	}
+	require.NoError(t, reader.Err())
+	assert.Equal(t, 2, batches, "rows are sent in batches")
+	assert.Equal(t, len(rows), total)
+}
+
+func TestArrow_NoRows(t *testing.T) {
+	w := httptest.NewRecorder()
+	require.NoError(t, Arrow(w, []string{"id"}, nil, nil))
+
+	reader, err := ipc.NewReader(w.Body)
+	require.NoError(t, err)
+	defer reader.Release()
+	assert.Equal(t, "id", reader.Schema().Field(0).Name)
+	assert.False(t, reader.Next())
+	require.NoError(t, reader.Err())
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// ParquetType is the media type of Parquet files
+const ParquetType = "application/vnd.apache.parquet"
+
+// WantsParquet reports whether the request asks for a Parquet file with format=parquet
+func WantsParquet(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "parquet"
+}
+
+// Parquet sends rows as a Snappy-compressed Parquet file attachment named filename.
+// Columns have the types Arrow gives them, each record batch becomes a row group, and
+// metadata is stored as the file's key-value metadata.
+func Parquet(w http.ResponseWriter, filename string, columns []string, rows [][]any, metadata map[string]string) error {
+	schema := arrowSchema(columns, rows, metadata)
+
+	w.Header().Set("Content-Type", ParquetType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	mem := memory.NewGoAllocator()
+	props := parquet.NewWriterProperties(parquet.WithAllocator(mem), parquet.WithCompression(compress.Codecs.Snappy))
+	writer, err := pqarrow.NewFileWriter(schema, w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithAllocator(mem)))
+	if err != nil {
+		return fmt.Errorf("failed to create parquet writer: %w", err)
+	}
+	if err := writeRecordBatches(mem, schema, rows, writer.Write); err != nil {
+		writer.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to close parquet file: %w", err)
+	}
+	return nil
+}
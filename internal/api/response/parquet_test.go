@@ -0,0 +1,73 @@
+package response
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWantsParquet(t *testing.T) {
+	assert.True(t, WantsParquet(httptest.NewRequest(http.MethodPost, "/?format=parquet", nil)))
+	assert.False(t, WantsParquet(httptest.NewRequest(http.MethodPost, "/?format=csv", nil)))
+	assert.False(t, WantsParquet(httptest.NewRequest(http.MethodPost, "/", nil)))
+}
+
+func TestParquet(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	rows := make([][]any, 0, arrowBatchRows+2)
+	for i := range arrowBatchRows + 2 {
+		rows = append(rows, []any{int64(i), 1.5, "order", true, createdAt})
+	}
+	rows[1] = []any{int32(1), int64(2), nil, false, nil}
+
+	w := httptest.NewRecorder()
+	columns := []string{"id", "total", "note", "paid", "created_at"}
+	require.NoError(t, Parquet(w, "result-1.parquet", columns, rows, map[string]string{"sql": "SELECT * FROM orders"}))
+
+	assert.Equal(t, ParquetType, w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="result-1.parquet"`, w.Header().Get("Content-Disposition"))
+
+	pf, err := file.NewParquetReader(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	defer pf.Close()
+	assert.Equal(t, 2, pf.NumRowGroups(), "each record batch is a row group")
+	assert.Equal(t, "SELECT * FROM orders", *pf.MetaData().KeyValueMetadata().FindValue("sql"))
+
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.NewGoAllocator())
+	require.NoError(t, err)
+	table, err := reader.ReadTable(context.Background())
+	require.NoError(t, err)
+	defer table.Release()
+
+	assert.Equal(t, int64(len(rows)), table.NumRows())
+	wantTypes := []arrow.DataType{
+		arrow.PrimitiveTypes.Int64,
+		arrow.PrimitiveTypes.Float64,
+		arrow.BinaryTypes.String,
+		arrow.FixedWidthTypes.Boolean,
+		&arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"},
+	}
+	for i, field := range table.Schema().Fields() {
+		assert.Equal(t, columns[i], field.Name)
+		assert.True(t, arrow.TypeEqual(wantTypes[i], field.Type), "column %s is %s", field.Name, field.Type)
+	}
+
+	ids := table.Column(0).Data().Chunk(0).(*array.Int64)
+	assert.Equal(t, int64(1), ids.Value(1), "int32 widened")
+	totals := table.Column(1).Data().Chunk(0).(*array.Float64)
+	assert.Equal(t, 2.0, totals.Value(1), "integers in a float column")
+	assert.True(t, table.Column(2).Data().Chunk(0).IsNull(1))
+	created := table.Column(4).Data().Chunk(0).(*array.Timestamp)
+	assert.Equal(t, arrow.Timestamp(createdAt.UnixMicro()), created.Value(0))
+}
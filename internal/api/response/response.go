@@ -2,14 +2,78 @@ package response
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/go-chi/chi/v5/middleware"
 )
 
+// RequestIDHeader carries the request ID on responses, for errors written without the request
+const RequestIDHeader = "X-Request-ID"
+
 // Response represents a standard API response
 type Response struct {
-	Success bool `json:"success"`
-	Data    any  `json:"data,omitempty"`
-	Error   any  `json:"error,omitempty"`
+	Success bool       `json:"success"`
+	Data    any        `json:"data,omitempty"`
+	Error   *ErrorBody `json:"error,omitempty"`
+}
+
+// ErrorBody is the machine-readable error of an error response
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// kindStatuses maps each kind of service error to its status and code
+var kindStatuses = map[apperr.Kind]struct {
+	status int
+	code   string
+}{
+	apperr.NotFound:              {http.StatusNotFound, "not_found"},
+	apperr.Forbidden:             {http.StatusForbidden, "forbidden"},
+	apperr.Validation:            {http.StatusBadRequest, "validation_failed"},
+	apperr.Conflict:              {http.StatusConflict, "conflict"},
+	apperr.RateLimited:           {http.StatusTooManyRequests, "rate_limited"},
+	apperr.Upstream:              {http.StatusBadGateway, "upstream_error"},
+	apperr.Timeout:               {http.StatusGatewayTimeout, "timeout"},
+	apperr.CredentialsUnreadable: {http.StatusConflict, "credentials_unreadable"},
+}
+
+// statusCodes names the error statuses written without a service error
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "upstream_error",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// Status returns the status and code of err. Errors without a kind are internal.
+func Status(err error) (int, string) {
+	if s, ok := kindStatuses[apperr.KindOf(err)]; ok {
+		return s.status, s.code
+	}
+	return http.StatusInternalServerError, statusCodes[http.StatusInternalServerError]
+}
+
+// StatusCode returns the code written for status by Error
+func StatusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
 }
 
 // JSON sends a JSON response
@@ -25,17 +89,43 @@ func JSON(w http.ResponseWriter, status int, data any) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-// Error sends an error response
+// Err sends the error response for a service error. Errors without a kind are logged
+// and sent as internal errors without their message.
+func Err(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := Status(err)
+	body := &ErrorBody{Code: code, Message: err.Error(), RequestID: middleware.GetReqID(r.Context())}
+
+	var appErr *apperr.Error
+	if errors.As(err, &appErr) {
+		body.Details = appErr.Details
+	} else {
+		logging.FromContext(r.Context()).Error().Ctx(r.Context()).Err(err).Str("path", r.URL.Path).Msg("Request failed")
+		body.Message = "internal server error"
+	}
+	writeError(w, status, body)
+}
+
+// Error sends an error response with a message, or with details when message is not
+// a string
 func Error(w http.ResponseWriter, status int, message any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
+	body := &ErrorBody{Code: StatusCode(status)}
+	if text, ok := message.(string); ok {
+		body.Message = text
+	} else {
+		body.Message = http.StatusText(status)
+		body.Details = message
+	}
+	writeError(w, status, body)
+}
 
-	resp := Response{
-		Success: false,
-		Error:   message,
+func writeError(w http.ResponseWriter, status int, body *ErrorBody) {
+	if body.RequestID == "" {
+		body.RequestID = w.Header().Get(RequestIDHeader)
 	}
 
-	json.NewEncoder(w).Encode(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Success: false, Error: body})
 }
 
 // NoContent sends a 204 No Content response
@@ -77,3 +167,12 @@ func NotFound(w http.ResponseWriter, message any) {
 func InternalError(w http.ResponseWriter, message any) {
 	Error(w, http.StatusInternalServerError, message)
 }
+
+// RequestTooLarge sends a 413 Request Entity Too Large response
+func RequestTooLarge(w http.ResponseWriter, maxBytes int64) {
+	writeError(w, http.StatusRequestEntityTooLarge, &ErrorBody{
+		Code:    StatusCode(http.StatusRequestEntityTooLarge),
+		Message: "request body too large",
+		Details: map[string]any{"max_bytes": maxBytes},
+	})
+}
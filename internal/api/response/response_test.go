@@ -0,0 +1,83 @@
+package response
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Clients switch on these codes, so changing one is a breaking API change
+func TestStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{apperr.New(apperr.NotFound, "connection not found"), http.StatusNotFound, "not_found"},
+		{apperr.New(apperr.Forbidden, "access denied"), http.StatusForbidden, "forbidden"},
+		{apperr.New(apperr.Validation, "invalid role"), http.StatusBadRequest, "validation_failed"},
+		{apperr.New(apperr.Conflict, "session is not deleted"), http.StatusConflict, "conflict"},
+		{apperr.New(apperr.RateLimited, "too many requests"), http.StatusTooManyRequests, "rate_limited"},
+		{apperr.New(apperr.Upstream, "failed to generate SQL"), http.StatusBadGateway, "upstream_error"},
+		{apperr.New(apperr.Timeout, "SQL generation timed out"), http.StatusGatewayTimeout, "timeout"},
+		{apperr.New(apperr.CredentialsUnreadable, "re-enter the password"), http.StatusConflict, "credentials_unreadable"},
+		{fmt.Errorf("failed to load: %w", apperr.New(apperr.NotFound, "gone")), http.StatusNotFound, "not_found"},
+		{errors.New("failed to connect"), http.StatusInternalServerError, "internal_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			status, code := Status(tt.err)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.code, code)
+		})
+	}
+	assert.Len(t, kindStatuses, 8, "every kind needs a row above")
+}
+
+func TestErr(t *testing.T) {
+	ctx := context.WithValue(context.Background(), middleware.RequestIDKey, "host/abc-000001")
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/workspaces", nil).WithContext(ctx)
+
+	rec := httptest.NewRecorder()
+	Err(rec, r, &apperr.Error{Kind: apperr.Validation, Message: "connection failed", Details: map[string]any{"connected": false}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.JSONEq(t, `{"success": false, "error": {"code": "validation_failed", "message": "connection failed",
+		"details": {"connected": false}, "request_id": "host/abc-000001"}}`, rec.Body.String())
+
+	// Errors without a kind do not leak their message
+	rec = httptest.NewRecorder()
+	Err(rec, r, errors.New("failed to query: password authentication failed"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.JSONEq(t, `{"success": false, "error": {"code": "internal_error", "message": "internal server error",
+		"request_id": "host/abc-000001"}}`, rec.Body.String())
+}
+
+func TestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(RequestIDHeader, "host/abc-000002")
+	Unauthorized(rec, "missing authorization header")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	var resp struct {
+		Success bool      `json:"success"`
+		Error   ErrorBody `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&resp))
+	assert.False(t, resp.Success)
+	assert.Equal(t, ErrorBody{Code: "unauthorized", Message: "missing authorization header", RequestID: "host/abc-000002"}, resp.Error)
+
+	rec = httptest.NewRecorder()
+	BadRequest(rec, map[string]string{"email": "is required"})
+	assert.JSONEq(t, `{"success": false, "error": {"code": "bad_request", "message": "Bad Request",
+		"details": {"email": "is required"}}}`, rec.Body.String())
+}
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/api/handler"
 	customMiddleware "github.com/Rrens/text-to-sql/internal/api/middleware"
+	"github.com/Rrens/text-to-sql/internal/api/openapi"
 	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/lifecycle"
 	"github.com/Rrens/text-to-sql/internal/llm"
 	"github.com/Rrens/text-to-sql/internal/llm/anthropic"
 	"github.com/Rrens/text-to-sql/internal/llm/deepseek"
@@ -21,6 +26,7 @@ import (
 	mcpPostgres "github.com/Rrens/text-to-sql/internal/mcp/postgres"
 	mcpSQLite "github.com/Rrens/text-to-sql/internal/mcp/sqlite"
 	mcpSQLServer "github.com/Rrens/text-to-sql/internal/mcp/sqlserver"
+	"github.com/Rrens/text-to-sql/internal/observability"
 	"github.com/Rrens/text-to-sql/internal/repository/postgres"
 	"github.com/Rrens/text-to-sql/internal/repository/redis"
 	"github.com/Rrens/text-to-sql/internal/security"
@@ -28,27 +34,44 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
-// NewRouter creates and configures the HTTP router
+// ollamaWarmupTimeout bounds loading the default Ollama model at startup
+const ollamaWarmupTimeout = 2 * time.Minute
 
-func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) http.Handler {
+// NewRouter creates and configures the HTTP router. Background work and pooled
+// database adapters are registered with lc for shutdown.
+func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client, lc *lifecycle.Manager) http.Handler {
 	r := chi.NewRouter()
 
 	// Global middleware
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
-	r.Use(customMiddleware.Logger)
+	r.Use(customMiddleware.RequestIDHeader)
+	trustedProxies, err := customMiddleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Error().Err(err).Msg("Ignoring invalid trusted proxy configuration")
+	}
+	r.Use(customMiddleware.RealIP(trustedProxies))
+	r.Use(observability.Tracing)
+
+	var metrics *observability.Metrics
+	if cfg.Metrics.Enabled {
+		metrics = observability.NewMetrics(observability.NewRegistry())
+		r.Use(metrics.Middleware)
+	}
+	r.Use(customMiddleware.Logger(cfg.Server.SlowRequestThreshold))
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(cfg.Server.MiddlewareTimeout))
+	r.Use(customMiddleware.DefaultBodyLimit(cfg.Server.MaxBodySize))
 
 	// CORS
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Workspace-ID"},
-		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Workspace-ID", "X-Request-ID", "Idempotency-Key", handler.SharePasscodeHeader},
+		ExposedHeaders:   []string{"X-Request-ID", "Idempotency-Replayed", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -61,22 +84,18 @@ func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) h
 	)
 
 	// Initialize encryptor
-	encryptionKey := []byte(cfg.Auth.JWTSecret)
-	if len(encryptionKey) > 32 {
-		encryptionKey = encryptionKey[:32]
-	} else if len(encryptionKey) < 32 {
-		padded := make([]byte, 32)
-		copy(padded, encryptionKey)
-		encryptionKey = padded
-	}
-	encryptor, _ := security.NewEncryptor(encryptionKey)
+	encryptor, _ := security.NewEncryptorFromSecret(cfg.Auth.JWTSecret)
 
 	// Initialize repositories
 	userRepo := postgres.NewUserRepository(db)
 	workspaceRepo := postgres.NewWorkspaceRepository(db)
 	connectionRepo := postgres.NewConnectionRepository(db)
-	messageRepo := postgres.NewMessageRepository(db.Pool)
+	messageRepo := postgres.NewMessageRepository(db.Pool).WithResultLimit(domain.StoredResultLimit{
+		MaxRows:  cfg.Database.StoredResultMaxRows,
+		MaxBytes: cfg.Database.StoredResultMaxBytes,
+	})
 	sessionRepo := postgres.NewSessionRepository(db.Pool)
+	auditRepo := postgres.NewAuditRepository(db)
 
 	// Initialize rate limiter and schema cache
 	rateLimiter := redis.NewRateLimiter(
@@ -84,16 +103,46 @@ func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) h
 		cfg.Security.RateLimit.RequestsPerMinute,
 		cfg.Security.RateLimit.Burst,
 	)
-	schemaCache := redis.NewSchemaCache(redisClient)
+	schemaCache := redis.NewSchemaCache(redisClient, cfg.Redis.SchemaCacheTTL).
+		WithMaxSize(cfg.Redis.SchemaCacheMaxBytes)
 
 	// Initialize MCP Router with database adapters
-	mcpRouter := mcp.NewRouter()
+	mcpRouter := mcp.NewRouter().WithPoolOptions(mcp.PoolOptions{
+		MaxConns:          cfg.Security.AdapterPool.MaxConns,
+		MinConns:          mcp.PoolSize(cfg.Security.AdapterPool.MinConns),
+		MaxConnLifetime:   cfg.Security.AdapterPool.MaxConnLifetime,
+		MaxConnIdleTime:   cfg.Security.AdapterPool.MaxConnIdleTime,
+		HealthCheckPeriod: cfg.Security.AdapterPool.HealthCheckPeriod,
+	}).WithReconnectHook(func(connectionID uuid.UUID, databaseType string) {
+		metrics.ObserveAdapterReconnect(connectionID.String(), databaseType)
+	}).WithReplicaFallbackHook(func(connectionID uuid.UUID, databaseType string) {
+		metrics.ObserveReplicaFallback(connectionID.String(), databaseType)
+	})
 	mcpRouter.RegisterAdapter("postgres", mcpPostgres.NewAdapter)
-	mcpRouter.RegisterAdapter("clickhouse", mcpClickhouse.NewAdapter)
+	mcpRouter.RegisterDialect("postgres", mcpPostgres.Dialect)
+	mcpRouter.RegisterAdapter("clickhouse", mcpClickhouse.NewAdapterFactory(cfg.Security.ClickHouseMaxMemoryUsage))
+	mcpRouter.RegisterDialect("clickhouse", mcpClickhouse.Dialect)
 	mcpRouter.RegisterAdapter("mysql", mcpMySQL.NewAdapter)
+	mcpRouter.RegisterDialect("mysql", mcpMySQL.Dialect)
 	mcpRouter.RegisterAdapter("mongodb", mcpMongo.NewAdapter)
-	mcpRouter.RegisterAdapter("sqlite", mcpSQLite.NewAdapter)
+	mcpRouter.RegisterDialect("mongodb", mcpMongo.Dialect)
+	mcpRouter.RegisterAdapter("sqlite", mcpSQLite.NewAdapterFactory(cfg.Server.UploadDir))
+	mcpRouter.RegisterDialect("sqlite", mcpSQLite.Dialect)
 	mcpRouter.RegisterAdapter("sqlserver", mcpSQLServer.NewAdapter)
+	mcpRouter.RegisterDialect("sqlserver", mcpSQLServer.Dialect)
+	lc.OnClose("database adapters", mcpRouter.CloseAll)
+	metrics.RegisterPools(func() []observability.Pool {
+		pools := []observability.Pool{{Name: "platform", Stats: db.PoolStats()}}
+		for _, p := range mcpRouter.PoolStats() {
+			pools = append(pools, observability.Pool{
+				Name:         "adapter",
+				ConnectionID: p.ConnectionID.String(),
+				DatabaseType: p.DatabaseType,
+				Stats:        p.Stats,
+			})
+		}
+		return pools
+	})
 
 	// Initialize LLM Router with providers
 	llmRouter := llm.NewRouter(cfg.LLM.DefaultProvider)
@@ -111,61 +160,60 @@ func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) h
 		if model == "" {
 			model = cfg.LLM.Ollama.DefaultModel
 		}
-		return ollama.NewProvider(host, model), nil
+		opts, err := llm.HTTPOptionsFromConfig(cfgMap, ollamaHTTPOptions(cfg.LLM.Ollama))
+		if err != nil {
+			return nil, err
+		}
+		settings, err := ollama.SettingsFromConfig(cfgMap, ollamaSettings(cfg.LLM.Ollama))
+		if err != nil {
+			return nil, err
+		}
+		return ollama.NewProvider(host, model, opts).WithSettings(settings), nil
 	})
 
 	// OpenAI Factory
 	llmRouter.RegisterFactory("openai", func(cfgMap map[string]any) (llm.Provider, error) {
-		apiKey, _ := cfgMap["api_key"].(string)
-		model, _ := cfgMap["model"].(string)
-		if apiKey == "" {
-			apiKey = cfg.LLM.OpenAI.APIKey
-		}
-		if model == "" {
-			model = cfg.LLM.OpenAI.Model
+		apiKey, model, opts, err := userProviderConfig(cfgMap, cfg.LLM.OpenAI.APIKey, cfg.LLM.OpenAI.Model,
+			httpOptions(cfg.LLM.OpenAI.BaseURL, cfg.LLM.OpenAI.Timeout, cfg.LLM.OpenAI.HTTPProxy))
+		if err != nil {
+			return nil, err
 		}
-		return openai.NewProvider(apiKey, model), nil
+		return openai.NewProvider(apiKey, model, opts), nil
 	})
 
 	// Anthropic Factory
 	llmRouter.RegisterFactory("anthropic", func(cfgMap map[string]any) (llm.Provider, error) {
-		apiKey, _ := cfgMap["api_key"].(string)
-		model, _ := cfgMap["model"].(string)
-		if apiKey == "" {
-			apiKey = cfg.LLM.Anthropic.APIKey
-		}
-		if model == "" {
-			model = cfg.LLM.Anthropic.Model
+		apiKey, model, opts, err := userProviderConfig(cfgMap, cfg.LLM.Anthropic.APIKey, cfg.LLM.Anthropic.Model,
+			httpOptions(cfg.LLM.Anthropic.BaseURL, cfg.LLM.Anthropic.Timeout, cfg.LLM.Anthropic.HTTPProxy))
+		if err != nil {
+			return nil, err
 		}
-		return anthropic.NewProvider(apiKey, model), nil
+		return anthropic.NewProvider(apiKey, model, opts), nil
 	})
 
 	// DeepSeek Factory
 	llmRouter.RegisterFactory("deepseek", func(cfgMap map[string]any) (llm.Provider, error) {
-		apiKey, _ := cfgMap["api_key"].(string)
-		model, _ := cfgMap["model"].(string)
-		if apiKey == "" {
-			apiKey = cfg.LLM.DeepSeek.APIKey
+		apiKey, model, opts, err := userProviderConfig(cfgMap, cfg.LLM.DeepSeek.APIKey, cfg.LLM.DeepSeek.Model,
+			httpOptions(cfg.LLM.DeepSeek.BaseURL, cfg.LLM.DeepSeek.Timeout, cfg.LLM.DeepSeek.HTTPProxy))
+		if err != nil {
+			return nil, err
 		}
-		if model == "" {
-			model = cfg.LLM.DeepSeek.Model
-		}
-		return deepseek.NewProvider(apiKey, model), nil
+		return deepseek.NewProvider(apiKey, model, opts), nil
 	})
 
 	// Gemini Factory
 	llmRouter.RegisterFactory("gemini", func(cfgMap map[string]any) (llm.Provider, error) {
-		apiKey, _ := cfgMap["api_key"].(string)
-		model, _ := cfgMap["model"].(string)
-		if apiKey == "" {
-			apiKey = cfg.LLM.Gemini.APIKey
-		}
-		if model == "" {
-			model = cfg.LLM.Gemini.Model
+		apiKey, model, opts, err := userProviderConfig(cfgMap, cfg.LLM.Gemini.APIKey, cfg.LLM.Gemini.Model,
+			httpOptions(cfg.LLM.Gemini.BaseURL, cfg.LLM.Gemini.Timeout, cfg.LLM.Gemini.HTTPProxy))
+		if err != nil {
+			return nil, err
 		}
 		geminiConfig := config.GeminiConfig{
-			APIKey: apiKey,
-			Model:  model,
+			APIKey:    apiKey,
+			Model:     model,
+			BaseURL:   opts.BaseURL,
+			Timeout:   opts.Timeout,
+			HTTPProxy: opts.Proxy,
 		}
 		return gemini.NewProvider(geminiConfig), nil
 	})
@@ -173,25 +221,58 @@ func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) h
 	// Register default/system instances
 	if cfg.LLM.Ollama.Host != "" {
 		log.Info().Str("host", cfg.LLM.Ollama.Host).Msg("Registering Ollama provider")
-		llmRouter.RegisterProvider(ollama.NewProvider(cfg.LLM.Ollama.Host, cfg.LLM.Ollama.DefaultModel))
+		provider := ollama.NewProvider(cfg.LLM.Ollama.Host, cfg.LLM.Ollama.DefaultModel, ollamaHTTPOptions(cfg.LLM.Ollama)).
+			WithSettings(ollamaSettings(cfg.LLM.Ollama))
+		llmRouter.RegisterProvider(provider)
+		if cfg.LLM.Ollama.Warmup {
+			lc.Go(func(ctx context.Context) {
+				ctx, cancel := context.WithTimeout(ctx, ollamaWarmupTimeout)
+				defer cancel()
+				if err := provider.Warmup(ctx); err != nil {
+					log.Warn().Err(err).Msg("Ollama warmup failed")
+					return
+				}
+				log.Info().Str("model", provider.DefaultModel()).Msg("Ollama model loaded")
+			})
+		}
 	}
 	if cfg.LLM.OpenAI.APIKey != "" {
-		llmRouter.RegisterProvider(openai.NewProvider(cfg.LLM.OpenAI.APIKey, cfg.LLM.OpenAI.Model))
+		llmRouter.RegisterProvider(openai.NewProvider(cfg.LLM.OpenAI.APIKey, cfg.LLM.OpenAI.Model,
+			httpOptions(cfg.LLM.OpenAI.BaseURL, cfg.LLM.OpenAI.Timeout, cfg.LLM.OpenAI.HTTPProxy)))
 	}
 	if cfg.LLM.Anthropic.APIKey != "" {
-		llmRouter.RegisterProvider(anthropic.NewProvider(cfg.LLM.Anthropic.APIKey, cfg.LLM.Anthropic.Model))
+		llmRouter.RegisterProvider(anthropic.NewProvider(cfg.LLM.Anthropic.APIKey, cfg.LLM.Anthropic.Model,
+			httpOptions(cfg.LLM.Anthropic.BaseURL, cfg.LLM.Anthropic.Timeout, cfg.LLM.Anthropic.HTTPProxy)))
 	}
 	if cfg.LLM.DeepSeek.APIKey != "" {
-		llmRouter.RegisterProvider(deepseek.NewProvider(cfg.LLM.DeepSeek.APIKey, cfg.LLM.DeepSeek.Model))
+		llmRouter.RegisterProvider(deepseek.NewProvider(cfg.LLM.DeepSeek.APIKey, cfg.LLM.DeepSeek.Model,
+			httpOptions(cfg.LLM.DeepSeek.BaseURL, cfg.LLM.DeepSeek.Timeout, cfg.LLM.DeepSeek.HTTPProxy)))
 	}
 
 	// Always register Gemini provider (it handles empty keys gracefully)
 	log.Info().Msg("Registering Gemini provider")
 	llmRouter.RegisterProvider(gemini.NewProvider(cfg.LLM.Gemini))
+	llmRouter.AllowCustomModels(cfg.LLM.CustomModelProviders...)
+	for name, limit := range cfg.LLM.ProviderConcurrency() {
+		llmRouter.LimitConcurrency(name, limit, cfg.LLM.MaxQueue)
+	}
 
 	// Initialize services
-	authService := service.NewAuthService(userRepo, workspaceRepo, jwtManager)
-	workspaceService := service.NewWorkspaceService(workspaceRepo)
+	authService := service.NewAuthService(
+		userRepo,
+		workspaceRepo,
+		jwtManager,
+		encryptor,
+		redis.NewLoginLockout(redisClient, cfg.Security.LoginLockout),
+		auditRepo,
+	).WithLLMRouter(llmRouter)
+	if cfg.Auth.OIDC.Enabled {
+		authService.WithGoogleDomains(cfg.Auth.OIDC.AllowedDomains)
+	}
+	workspaceService := service.NewWorkspaceService(workspaceRepo, cfg.Security.MaxRows).WithCache(schemaCache)
+	deactivatedUsers := redis.NewDeactivatedUsers(redisClient, cfg.Auth.AccessTokenTTL)
+	adminService := service.NewAdminService(userRepo, workspaceRepo, auditRepo, deactivatedUsers).
+		WithStats(postgres.NewPlatformStatsRepository(db.Pool), redis.NewPlatformStatsCache(redisClient))
 	connectionService := service.NewConnectionService(
 		connectionRepo,
 		workspaceRepo,
@@ -199,7 +280,10 @@ func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) h
 		mcpRouter,
 		cfg.Security.MaxRows,
 		int(cfg.Security.QueryTimeout.Seconds()),
-	)
+	).WithMetrics(metrics).WithSQLiteRoot(cfg.Server.UploadDir).WithSchemaCache(schemaCache)
+	schemaStore := postgres.NewConnectionSchemaRepository(db.Pool)
+	notificationService := service.NewNotificationService(postgres.NewNotificationRepository(db.Pool), redis.NewNotificationBus(redisClient))
+	quotaService := service.NewQuotaService(redis.NewQuotaStore(redisClient), workspaceRepo).WithNotifications(notificationService)
 	queryService := service.NewQueryService(
 		connectionService,
 		mcpRouter,
@@ -207,134 +291,340 @@ func NewRouter(cfg *config.Config, db *postgres.DB, redisClient *redis.Client) h
 		schemaCache,
 		messageRepo,
 		sessionRepo,
+		workspaceRepo,
 		userRepo,
-	)
+		encryptor,
+	).WithMetrics(metrics).
+		WithIdempotency(redis.NewIdempotencyStore(redisClient)).
+		WithLLMTimeout(cfg.Server.LLMTimeout, cfg.LLM.ProviderTimeouts()).
+		WithCostGate(cfg.Security.MaxEstimatedRows).
+		WithDefaultLimit(cfg.Security.DefaultLimit).
+		WithHistoryLimits(cfg.LLM.HistoryMaxMessages, cfg.LLM.HistoryTokenBudget).
+		WithTableUsage(postgres.NewTableUsageRepository(db.Pool)).
+		WithPaging(redis.NewPageStore(redisClient)).
+		WithSchemaConcurrency(cfg.Security.SchemaConcurrency).
+		WithSchemaStore(schemaStore, cfg.Redis.SchemaCacheTTL).
+		WithAudit(auditRepo).
+		WithQuotas(quotaService).
+		WithExperiments(postgres.NewExperimentRepository(db.Pool)).
+		WithSchemaChanges(postgres.NewSchemaChangeRepository(db.Pool)).
+		WithTableAnnotations(postgres.NewTableAnnotationRepository(db.Pool))
+	webhookService := service.NewWebhookService(postgres.NewWebhookRepository(db.Pool), workspaceRepo, encryptor)
+	// Workspace events go to webhooks and to the members' notification feeds
+	emitters := service.WebhookEmitters{webhookService, notificationService}
+	connectionAlerts := service.NewConnectionAlerts(redis.NewConnectionErrorStore(redisClient), service.ConnectionAlertSettings{
+		ErrorRate:  cfg.Security.ConnectionAlerts.ErrorRate,
+		Window:     cfg.Security.ConnectionAlerts.Window,
+		MinQueries: cfg.Security.ConnectionAlerts.MinQueries,
+		MaxAge:     cfg.Security.ConnectionAlerts.MaxAge,
+	}).WithWebhooks(emitters)
+	queryService.WithWebhooks(emitters).WithConnectionAlerts(connectionAlerts).WithLifecycle(lc)
+	connectionService.WithConnectionAlerts(connectionAlerts)
+	connectionService.WithSchemaWarmer(queryService)
+	templateRepo := postgres.NewTemplateRepository(db.Pool)
+	templateService := service.NewTemplateService(templateRepo, workspaceRepo, connectionRepo, messageRepo, queryService)
+	bundleService := service.NewWorkspaceBundleService(workspaceRepo, connectionRepo, templateRepo, sessionRepo, messageRepo,
+		encryptor, cfg.Security.MaxRows, int(cfg.Security.QueryTimeout.Seconds()))
+	shareService := service.NewShareService(postgres.NewSharedResultRepository(db.Pool), messageRepo, workspaceRepo, cfg.Security.MaxShareTTL)
 
 	// Initialize handlers
-	authHandler := handler.NewAuthHandler(authService)
-	workspaceHandler := handler.NewWorkspaceHandler(workspaceService)
+	authHandler := handler.NewAuthHandler(authService).WithQuotas(quotaService)
+	workspaceHandler := handler.NewWorkspaceHandler(workspaceService).WithBundles(bundleService)
+	adminHandler := handler.NewAdminHandler(adminService)
 	connectionHandler := handler.NewConnectionHandler(connectionService)
 	queryHandler := handler.NewQueryHandler(queryService)
-	uploadHandler := handler.NewUploadHandler("data/sqlite")
+	uploadService := service.NewUploadService(postgres.NewUploadRepository(db.Pool), connectionRepo, workspaceRepo, cfg.Server.UploadDir).
+		WithConnections(connectionService)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+	notificationHandler := handler.NewNotificationHandler(notificationService)
+	templateHandler := handler.NewTemplateHandler(templateService)
+	shareHandler := handler.NewShareHandler(shareService)
+	uploadHandler := handler.NewUploadHandler(uploadService).WithImports(connectionService, cfg.Server.MaxImportRows)
+
+	var oidcHandler *handler.OIDCHandler
+	if oidcCfg := cfg.Auth.OIDC; oidcCfg.Enabled {
+		oidcProvider := security.NewOIDCProvider(oidcCfg.IssuerURL, oidcCfg.ClientID, oidcCfg.ClientSecret, oidcCfg.RedirectURL, nil)
+		oidcService := service.NewOIDCService(oidcProvider, redis.NewOIDCStateStore(redisClient), authService, oidcCfg.AllowedDomains)
+		oidcHandler = handler.NewOIDCHandler(oidcService, oidcCfg.FrontendURL, strings.HasPrefix(oidcCfg.RedirectURL, "https://"))
+		log.Info().Str("issuer", oidcCfg.IssuerURL).Bool("exclusive", oidcCfg.Exclusive).Msg("OIDC sign-in enabled")
+	}
 
 	// Auth middleware
-	authMiddleware := customMiddleware.NewAuthMiddleware(jwtManager)
-	rateLimitMiddleware := customMiddleware.NewRateLimitMiddleware(rateLimiter)
+	authMiddleware := customMiddleware.NewAuthMiddleware(jwtManager).WithDeactivationCheck(deactivatedUsers)
+	rateLimitMiddleware := customMiddleware.NewRateLimitMiddleware(rateLimiter).WithMetrics(metrics).
+		WithWorkspaceLimits(workspaceService, cfg.Security.RateLimit.WorkspaceRequestsPerMinute, 30*time.Second)
+	for class, limits := range cfg.Security.RateLimit.Classes {
+		rateLimitMiddleware.WithClass(class, rateLimiter.ForClass(class, limits.RequestsPerMinute, limits.Burst))
+	}
+	workspaceAccess := customMiddleware.NewWorkspaceAccessMiddleware(workspaceRepo, 30*time.Second)
+
+	// Metrics are scraped outside the API and its auth; an optional bearer token guards them
+	if metrics != nil {
+		r.Handle(cfg.Metrics.Path, metrics.Handler(cfg.Metrics.Token))
+	}
+
+	spec, err := openapi.Load()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load OpenAPI spec")
+	}
 
 	// Public routes
 	r.Route("/api/v1", func(r chi.Router) {
+		// Outside production, requests must match the spec so that drift fails tests
+		if spec != nil && cfg.Server.IsDevelopment() {
+			r.Use(spec.Validator("/api/v1"))
+		}
+
+		// API specification
+		if spec != nil {
+			r.Get("/openapi.json", spec.Handler().ServeHTTP)
+			if cfg.Server.IsDevelopment() {
+				r.Get("/docs", openapi.DocsHandler("/api/v1/openapi.json").ServeHTTP)
+			}
+		}
+
 		// Health check
 		r.Get("/health", handler.HealthCheck)
-		r.Get("/ready", handler.ReadyCheck(db))
+		r.Get("/ready", handler.ReadyCheck(db, redisClient, llmRouter))
 
-		// Auth routes (public)
+		// Auth routes (public, limited per client IP)
 		r.Route("/auth", func(r chi.Router) {
-			r.Post("/register", authHandler.Register)
-			r.Post("/login", authHandler.Login)
+			r.Use(rateLimitMiddleware.LimitIP("auth"))
+
+			if cfg.Auth.OIDC.Enabled && cfg.Auth.OIDC.Exclusive {
+				r.Post("/register", handler.PasswordLoginDisabled)
+				r.Post("/login", handler.PasswordLoginDisabled)
+				r.Post("/google", handler.PasswordLoginDisabled)
+			} else {
+				r.Post("/register", authHandler.Register)
+				r.Post("/login", authHandler.Login)
+				r.Post("/google", authHandler.GoogleLogin)
+			}
 			r.Post("/refresh", authHandler.Refresh)
-			r.Post("/google", authHandler.GoogleLogin)
+
+			if oidcHandler != nil {
+				r.Get("/oidc/login", oidcHandler.Login)
+				r.Get("/oidc/callback", oidcHandler.Callback)
+			}
 		})
 
+		// Shared results (public, limited per client IP)
+		r.With(rateLimitMiddleware.LimitIP("share")).Get("/share/{token}", shareHandler.View)
+
 		// Protected routes
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware.Authenticate)
-			r.Use(rateLimitMiddleware.Limit)
-
-			// Auth check
-			r.Get("/auth/me", authHandler.Me)
-			r.Patch("/auth/me/llm-config", authHandler.UpdateLLMConfig)
-			r.Patch("/auth/me/profile", authHandler.UpdateProfile)
 
-			// LLM providers
-			r.Get("/llm-providers", handler.ListLLMProviders(cfg))
+			r.Group(func(r chi.Router) {
+				r.Use(rateLimitMiddleware.Limit)
+
+				// Auth check
+				r.Get("/auth/me", authHandler.Me)
+				r.Patch("/auth/me", authHandler.UpdateMe)
+				r.With(customMiddleware.BodyLimit(service.MaxLLMConfigSize)).
+					Patch("/auth/me/llm-config", authHandler.UpdateLLMConfig)
+				r.Delete("/auth/me/llm-config/{provider}", authHandler.DeleteLLMConfig)
+				r.Patch("/auth/me/profile", authHandler.UpdateProfile)
+
+				// Notifications of the current user
+				r.Get("/notifications", notificationHandler.List)
+				r.Get("/notifications/stream", notificationHandler.Stream)
+				r.Post("/notifications/{notificationID}/read", notificationHandler.MarkRead)
+
+				// Platform administration (global admins only)
+				r.Route("/admin", func(r chi.Router) {
+					r.Use(customMiddleware.RequireAdmin)
+
+					r.Get("/stats", adminHandler.Stats)
+					r.Get("/users", adminHandler.ListUsers)
+					r.Post("/users/{userID}/deactivate", adminHandler.DeactivateUser)
+					r.Post("/users/{userID}/reactivate", adminHandler.ReactivateUser)
+					r.Get("/workspaces", adminHandler.ListWorkspaces)
+					r.Post("/workspaces/{workspaceID}/join", adminHandler.JoinWorkspace)
+					r.Post("/cache/flush", handler.FlushCache(schemaCache, schemaStore))
+					r.Get("/config", handler.EffectiveConfig(cfg))
+				})
 
-			// Cache management
-			r.Post("/cache/flush", handler.FlushCache(schemaCache))
+				// LLM providers
+				r.Get("/llm-providers", handler.ListLLMProviders(cfg, workspaceService))
+			})
 
 			// Workspace routes
 			r.Route("/workspaces", func(r chi.Router) {
-				r.Get("/", workspaceHandler.List)
-				r.Post("/", workspaceHandler.Create)
+				r.With(rateLimitMiddleware.Limit).Get("/", workspaceHandler.List)
+				r.With(rateLimitMiddleware.Limit).Post("/", workspaceHandler.Create)
+				r.With(rateLimitMiddleware.Limit, customMiddleware.BodyLimit(cfg.Server.MaxUploadSize)).
+					Post("/import", workspaceHandler.Import)
 
 				r.Route("/{workspaceID}", func(r chi.Router) {
 					r.Use(customMiddleware.WorkspaceContext)
+					r.Use(workspaceAccess.RequireMember)
 
-					r.Get("/", workspaceHandler.Get)
-					r.Patch("/", workspaceHandler.Update)
-					r.Delete("/", workspaceHandler.Delete)
-
-					// Query endpoints
-					r.Post("/query", queryHandler.Execute)
-					r.Post("/generate", queryHandler.Generate)
-
-					// Session Management
-					sessionHandler := handler.NewSessionHandler(queryService)
-					r.Route("/sessions", func(r chi.Router) {
-						r.Get("/", sessionHandler.List)
-						r.Post("/", sessionHandler.Create)
-						r.Route("/{sessionID}", func(r chi.Router) {
-							r.Get("/", sessionHandler.GetHistory) // Get history for session
-							r.Delete("/", sessionHandler.Delete)
-						})
+					// Query endpoints call the LLM and use the stricter "query" class
+					r.Group(func(r chi.Router) {
+						r.Use(rateLimitMiddleware.LimitClass("query"))
+
+						r.Post("/query", queryHandler.Execute)
+						r.Post("/generate", queryHandler.Generate)
+						r.Post("/generate-adhoc", queryHandler.GenerateAdhoc)
+						r.Post("/connections/{connectionID}/explain-sql", queryHandler.ExplainSQL)
 					})
 
-					// Suggested Questions
-					suggestionHandler := handler.NewSuggestionHandler(queryService)
-					r.Get("/suggestions", suggestionHandler.GetSuggestions)
+					r.Group(func(r chi.Router) {
+						r.Use(rateLimitMiddleware.Limit)
+
+						r.Get("/", workspaceHandler.Get)
+						r.Patch("/", workspaceHandler.Update)
+						r.Delete("/", workspaceHandler.Delete)
+						r.Get("/export", workspaceHandler.Export)
+
+						// Later pages of truncated results and reruns re-run stored SQL, without the LLM
+						r.Post("/query/page", queryHandler.Page)
+						r.Post("/messages/{messageID}/rerun", queryHandler.Rerun)
+						// Where a query sent with X-Request-ID waits for its LLM provider
+						r.Get("/query/{requestID}/status", queryHandler.QueueStatus)
+
+						// Share links to stored answers
+						r.Post("/messages/{messageID}/share", shareHandler.Create)
+						r.Get("/shares", shareHandler.List)
+						r.Delete("/shares/{shareID}", shareHandler.Revoke)
+
+						// Members
+						r.Post("/members", workspaceHandler.AddMember)
+						r.Patch("/members/{userID}", workspaceHandler.UpdateMemberRole)
+						r.Delete("/members/{userID}", workspaceHandler.RemoveMember)
+
+						// Session Management
+						sessionHandler := handler.NewSessionHandler(queryService)
+						r.Route("/sessions", func(r chi.Router) {
+							r.Get("/", sessionHandler.List)
+							r.Post("/", sessionHandler.Create)
+							r.Route("/{sessionID}", func(r chi.Router) {
+								r.Get("/", sessionHandler.GetHistory) // Get history for session
+								r.Delete("/", sessionHandler.Delete)
+								r.Post("/restore", sessionHandler.Restore)
+							})
+						})
 
-					r.Get("/chat", queryHandler.GetHistory) // Legacy endpoint (optional)
+						// Suggested Questions
+						suggestionHandler := handler.NewSuggestionHandler(queryService)
+						r.Get("/suggestions", suggestionHandler.GetSuggestions)
+
+						// Analytics
+						statsHandler := handler.NewStatsHandler(queryService)
+						r.Get("/stats/queries", statsHandler.Queries)
+						r.Get("/stats/experiments", statsHandler.Experiments)
+
+						r.Get("/chat", queryHandler.GetHistory) // Legacy endpoint (optional)
+
+						// Connection routes
+						r.Route("/connections", func(r chi.Router) {
+							r.Get("/", connectionHandler.List)
+							r.Post("/", connectionHandler.Create)
+
+							r.Route("/{connectionID}", func(r chi.Router) {
+								r.Get("/", connectionHandler.Get)
+								r.Patch("/", connectionHandler.Update)
+								r.Delete("/", connectionHandler.Delete)
+								r.Put("/credentials", connectionHandler.UpdateCredentials)
+								r.Post("/test", connectionHandler.Test)
+								r.Get("/health", connectionHandler.Health)
+								r.Get("/schema", queryHandler.GetSchema)
+								r.Get("/schema/popular", queryHandler.GetPopularTables)
+								r.Get("/schema/changes", queryHandler.ListSchemaChanges)
+								r.Get("/schema/annotations", queryHandler.ListTableAnnotations)
+								r.Put("/schema/annotations/{table}", queryHandler.AnnotateTable)
+								r.Delete("/schema/annotations/{table}", queryHandler.DeleteTableAnnotation)
+								r.Get("/schema/export", queryHandler.ExportSchema)
+								r.Post("/schema/refresh", queryHandler.RefreshSchema)
+								r.Post("/cache/flush", queryHandler.FlushCache)
+							})
+						})
 
-					// Connection routes
-					r.Route("/connections", func(r chi.Router) {
-						r.Get("/", connectionHandler.List)
-						r.Post("/", connectionHandler.Create)
+						// Webhook routes
+						r.Route("/webhooks", func(r chi.Router) {
+							r.Get("/", webhookHandler.List)
+							r.Post("/", webhookHandler.Create)
 
-						r.Route("/{connectionID}", func(r chi.Router) {
-							r.Get("/", connectionHandler.Get)
-							r.Patch("/", connectionHandler.Update)
-							r.Delete("/", connectionHandler.Delete)
-							r.Post("/test", connectionHandler.Test)
-							r.Get("/schema", queryHandler.GetSchema)
-							r.Post("/schema/refresh", queryHandler.RefreshSchema)
+							r.Route("/{webhookID}", func(r chi.Router) {
+								r.Patch("/", webhookHandler.Update)
+								r.Delete("/", webhookHandler.Delete)
+								r.Get("/deliveries", webhookHandler.Deliveries)
+							})
+						})
+
+						// Query template routes
+						r.Route("/templates", func(r chi.Router) {
+							r.Get("/", templateHandler.List)
+							r.Post("/", templateHandler.Create)
+
+							r.Route("/{templateID}", func(r chi.Router) {
+								r.Get("/", templateHandler.Get)
+								r.Patch("/", templateHandler.Update)
+								r.Delete("/", templateHandler.Delete)
+								r.Post("/run", templateHandler.Run)
+							})
 						})
-					})
 
-					// Upload routes
-					r.Post("/upload-sqlite", uploadHandler.UploadSQLite)
+						// Upload routes
+						r.With(customMiddleware.BodyLimit(cfg.Server.MaxUploadSize)).
+							Post("/upload-sqlite", uploadHandler.UploadSQLite)
+						r.With(customMiddleware.BodyLimit(cfg.Server.MaxUploadSize)).
+							Post("/upload-csv", uploadHandler.UploadSpreadsheet)
+						r.Get("/uploads", uploadHandler.List)
+						r.Delete("/uploads/{uploadID}", uploadHandler.Delete)
+					})
 				})
 			})
 		})
 	})
 
-	// Serve Frontend (SPA)
-	workDir, _ := os.Getwd()
-	frontendDir := filepath.Join(workDir, "frontend")
-	if _, err := os.Stat(frontendDir); os.IsNotExist(err) {
-		// Try /app/frontend (docker default)
-		frontendDir = "/app/frontend"
+	// Serve the frontend (SPA) unless it is hosted separately
+	if fsys, ok := frontendFS(cfg.Server); ok {
+		spa := spaHandler(fsys)
+		r.Get("/*", spa.ServeHTTP)
+		r.Head("/*", spa.ServeHTTP)
+	} else {
+		log.Info().Msg("Not serving the frontend")
 	}
 
-	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
-		fs := http.FileServer(http.Dir(frontendDir))
+	return r
+}
 
-		// Check if file exists
-		path := filepath.Join(frontendDir, r.URL.Path)
-		_, err := os.Stat(path)
+// httpOptions collects a provider's endpoint, timeout and proxy settings
+func httpOptions(baseURL string, timeout time.Duration, proxy string) llm.HTTPOptions {
+	return llm.HTTPOptions{BaseURL: baseURL, Timeout: timeout, Proxy: proxy}
+}
 
-		if os.IsNotExist(err) {
-			// If file not found (and not /api), serve index.html
-			http.ServeFile(w, r, filepath.Join(frontendDir, "index.html"))
-			return
-		} else if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+func ollamaHTTPOptions(cfg config.OllamaConfig) llm.HTTPOptions {
+	return llm.HTTPOptions{Timeout: cfg.Timeout, Proxy: cfg.HTTPProxy}
+}
 
-		// Verify it's not a directory without index (though FileServer handles it, we want SPA)
-		// Usually FileServer handles directories by looking for index.html or listing.
-		// We rely on standard FileServer for assets.
-		fs.ServeHTTP(w, r)
-	})
+func ollamaSettings(cfg config.OllamaConfig) ollama.Settings {
+	models := make(map[string]ollama.ModelOptions, len(cfg.Models))
+	for name, model := range cfg.Models {
+		models[name] = ollama.ModelOptions{NumCtx: model.NumCtx, NumPredict: model.NumPredict}
+	}
+	return ollama.Settings{Models: models, KeepAlive: cfg.KeepAlive}
+}
 
-	return r
+// userProviderConfig merges a user's provider settings over the server's. The server
+// key is never sent to an endpoint or proxy the user chose.
+func userProviderConfig(cfgMap map[string]any, serverKey, serverModel string, defaults llm.HTTPOptions) (string, string, llm.HTTPOptions, error) {
+	apiKey, _ := cfgMap["api_key"].(string)
+	model, _ := cfgMap["model"].(string)
+	if apiKey == "" {
+		if llm.OverridesEndpoint(cfgMap) {
+			return "", "", llm.HTTPOptions{}, errors.New("api_key is required when overriding base_url or http_proxy")
+		}
+		apiKey = serverKey
+	}
+	if model == "" {
+		model = serverModel
+	}
+	opts, err := llm.HTTPOptionsFromConfig(cfgMap, defaults)
+	if err != nil {
+		return "", "", llm.HTTPOptions{}, err
+	}
+	return apiKey, model, opts, nil
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/api/openapi"
+	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/lifecycle"
+	"github.com/Rrens/text-to-sql/internal/repository/postgres"
+	"github.com/Rrens/text-to-sql/internal/repository/redis"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRouter_MatchesOpenAPISpec fails when a route is added or removed without
+// updating internal/api/openapi/openapi.yaml
+func TestRouter_MatchesOpenAPISpec(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.Environment = "test"
+	cfg.Auth.JWTSecret = "test-secret-with-at-least-32-bytes!!"
+	cfg.Auth.OIDC.Enabled = true
+	cfg.Auth.OIDC.IssuerURL = "https://issuer.example.com"
+
+	router := NewRouter(cfg, &postgres.DB{}, &redis.Client{}, lifecycle.NewManager())
+	routes, ok := router.(chi.Routes)
+	require.True(t, ok)
+
+	const prefix = "/api/v1"
+	var served []string
+	err := chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if !strings.HasPrefix(route, prefix+"/") {
+			return nil
+		}
+		route = strings.TrimPrefix(route, prefix)
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+		served = append(served, method+" "+route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	spec, err := openapi.Load()
+	require.NoError(t, err)
+	var documented []string
+	for path, item := range spec.Doc().Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(served)
+	sort.Strings(documented)
+	assert.Equal(t, documented, served)
+}
+
+// TestRouter_UploadBodyLimit checks that upload routes raise the default body limit
+// rather than being cut off by it before routing
+func TestRouter_UploadBodyLimit(t *testing.T) {
+	for _, env := range []string{"production", "development"} {
+		t.Run(env, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Server.Environment = env
+			cfg.Auth.JWTSecret = "test-secret-with-at-least-32-bytes!!"
+			cfg.Server.MaxBodySize = 1 << 20
+			cfg.Server.MaxUploadSize = 8 << 20
+			router := NewRouter(cfg, &postgres.DB{}, &redis.Client{}, lifecycle.NewManager())
+
+			body := make([]byte, 2<<20)
+			for _, path := range []string{
+				"/api/v1/workspaces/00000000-0000-0000-0000-000000000001/upload-sqlite",
+				"/api/v1/workspaces/00000000-0000-0000-0000-000000000001/upload-csv",
+			} {
+				req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+				req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				// The request gets as far as authentication
+				assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/frontend"
+	"github.com/Rrens/text-to-sql/internal/api/response"
+	"github.com/Rrens/text-to-sql/internal/config"
+)
+
+// defaultFrontendDirs are served when server.frontend_dir is unset: ./frontend for
+// local development and the Docker image's /app/frontend
+var defaultFrontendDirs = []string{"frontend", "/app/frontend"}
+
+// frontendFS returns the frontend to serve: the embedded build if there is one,
+// otherwise server.frontend_dir or the first of defaultFrontendDirs that exists. It
+// returns false when nothing should be served.
+func frontendFS(cfg config.ServerConfig) (fs.FS, bool) {
+	if !cfg.ServeFrontend {
+		return nil, false
+	}
+	if dist, ok := frontend.Dist(); ok {
+		return dist, true
+	}
+	dirs := defaultFrontendDirs
+	if cfg.FrontendDir != "" {
+		dirs = []string{cfg.FrontendDir}
+	}
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return os.DirFS(dir), true
+		}
+	}
+	return nil, false
+}
+
+// spaHandler serves the files of a single page app and falls back to index.html for
+// client-side routes. Vite puts content-hashed files under assets/, which are cached
+// for a year; everything else is revalidated on every request.
+func spaHandler(fsys fs.FS) http.Handler {
+	files := http.FileServerFS(fsys)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/") {
+			response.NotFound(w, "not found")
+			return
+		}
+
+		// path.Clean resolves ".." against the root, so lookups never leave fsys
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		if name == "" || name == "index.html" {
+			serveIndex(w, r, fsys)
+			return
+		}
+		if !fs.ValidPath(name) || hasHiddenSegment(name) {
+			response.NotFound(w, "not found")
+			return
+		}
+
+		info, err := fs.Stat(fsys, name)
+		switch {
+		case err == nil && !info.IsDir():
+		case errors.Is(err, fs.ErrNotExist) && path.Ext(name) == "":
+			// A client-side route
+			serveIndex(w, r, fsys)
+			return
+		case err == nil || errors.Is(err, fs.ErrNotExist):
+			response.NotFound(w, "not found")
+			return
+		default:
+			response.InternalError(w, "failed to read frontend")
+			return
+		}
+
+		if strings.HasPrefix(name, "assets/") {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + name
+		r2.URL.RawPath = ""
+		files.ServeHTTP(w, r2)
+	})
+}
+
+// serveIndex serves index.html, which must always be revalidated so that a deploy
+// picks up the new asset hashes
+func serveIndex(w http.ResponseWriter, r *http.Request, fsys fs.FS) {
+	index, err := fs.ReadFile(fsys, "index.html")
+	if err != nil {
+		response.NotFound(w, "not found")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(index)
+}
+
+// hasHiddenSegment reports whether a path names a dotfile or something inside a dot
+// directory, such as .env or .git/config
+func hasHiddenSegment(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSPAHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":            {Data: []byte("<html>app</html>")},
+		"favicon.ico":           {Data: []byte("icon")},
+		"assets/index-3f2a9.js": {Data: []byte("console.log('app')")},
+		".env":                  {Data: []byte("JWT_SECRET=leaked")},
+	}
+	handler := spaHandler(fsys)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	tests := []struct {
+		name         string
+		target       string
+		wantStatus   int
+		wantBody     string
+		wantCacheCtl string
+	}{
+		{"root", "/", http.StatusOK, "<html>app</html>", "no-cache"},
+		{"client route", "/workspaces/42/chat", http.StatusOK, "<html>app</html>", "no-cache"},
+		{"hashed asset", "/assets/index-3f2a9.js", http.StatusOK, "console.log('app')", "public, max-age=31536000, immutable"},
+		{"static file", "/favicon.ico", http.StatusOK, "icon", "no-cache"},
+		{"missing asset", "/assets/index-old.js", http.StatusNotFound, "", ""},
+		{"unknown api route", "/api/v2/users", http.StatusNotFound, "", ""},
+		{"dotfile", "/.env", http.StatusNotFound, "", ""},
+		{"directory", "/assets/", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(tt.target)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+			if tt.wantCacheCtl != "" {
+				assert.Equal(t, tt.wantCacheCtl, rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	t.Run("path traversal", func(t *testing.T) {
+		for _, target := range []string{
+			"/..%2f.env",
+			"/../.env",
+			"/assets/..%2f..%2f.env",
+			"/%2e%2e/%2e%2e/etc/passwd",
+			"/assets/%2e%2e%2f.env",
+		} {
+			rec := serve(target)
+			assert.NotContains(t, rec.Body.String(), "JWT_SECRET", target)
+		}
+	})
+}
+
+func TestFrontendFS_DirStaysInsideRoot(t *testing.T) {
+	root := t.TempDir()
+	dist := filepath.Join(root, "dist")
+	require.NoError(t, os.Mkdir(dist, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dist, "index.html"), []byte("<html>app</html>"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "secret.txt"), []byte("outside"), 0o644))
+
+	fsys, ok := frontendFS(config.ServerConfig{ServeFrontend: true, FrontendDir: dist})
+	require.True(t, ok)
+	handler := spaHandler(fsys)
+
+	for _, target := range []string{"/..%2fsecret.txt", "/../secret.txt", "/%2e%2e/secret.txt"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		assert.NotContains(t, rec.Body.String(), "outside", target)
+	}
+
+	_, ok = frontendFS(config.ServerConfig{ServeFrontend: false, FrontendDir: dist})
+	assert.False(t, ok, "SERVE_FRONTEND=false disables the frontend")
+}
+
+func TestFrontendFS_DefaultDir(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "frontend"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "frontend", "index.html"), []byte("<html>dev</html>"), 0o644))
+	t.Chdir(root)
+
+	fsys, ok := frontendFS(config.ServerConfig{ServeFrontend: true})
+	require.True(t, ok, "./frontend is served without frontend_dir")
+	index, err := fs.ReadFile(fsys, "index.html")
+	require.NoError(t, err)
+	assert.Equal(t, "<html>dev</html>", string(index))
+}
@@ -0,0 +1,70 @@
+// Package apperr classifies the errors services return so the API can map them to
+// status codes without matching on messages.
+package apperr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is a sentinel error naming a class of failure. Match it with errors.Is.
+type Kind string
+
+func (k Kind) Error() string { return string(k) }
+
+// Kinds of service errors
+const (
+	NotFound    Kind = "not_found"
+	Forbidden   Kind = "forbidden"
+	Validation  Kind = "validation"
+	Conflict    Kind = "conflict"
+	RateLimited Kind = "rate_limited"
+	Upstream    Kind = "upstream"
+	Timeout     Kind = "timeout"
+	// stored credentials that cannot be decrypted with the current key
+	CredentialsUnreadable Kind = "credentials_unreadable"
+)
+
+// Error is a service error of a Kind. Its message is meant for clients.
+type Error struct {
+	Kind    Kind
+	Message string
+	// Details is optional structured data for clients
+	Details any
+	// Err is the underlying cause, if any
+	Err error
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Is reports whether target is the error's Kind
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// New returns an error of kind with message
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Newf returns an error of kind with a formatted message
+func Newf(kind Kind, format string, args ...any) *Error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an error of kind carrying err and its message
+func Wrap(kind Kind, err error) *Error {
+	return &Error{Kind: kind, Message: err.Error(), Err: err}
+}
+
+// KindOf returns the Kind of err, or "" if it has none
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return ""
+}
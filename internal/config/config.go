@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -19,17 +20,34 @@ type Config struct {
 	Security SecurityConfig `mapstructure:"security"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
 	Metrics  MetricsConfig  `mapstructure:"metrics"`
+
+	sources map[string]string // where each setting came from, see Sources
 }
 
 type ServerConfig struct {
-	Host              string        `mapstructure:"host"`
-	Port              int           `mapstructure:"port"`
-	ReadTimeout       time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout      time.Duration `mapstructure:"write_timeout"`
-	IdleTimeout       time.Duration `mapstructure:"idle_timeout"`
-	ShutdownTimeout   time.Duration `mapstructure:"shutdown_timeout"`
-	MiddlewareTimeout time.Duration `mapstructure:"middleware_timeout"`
-	LLMTimeout        time.Duration `mapstructure:"llm_timeout"`
+	Environment          string        `mapstructure:"environment"` // development, test or production
+	Host                 string        `mapstructure:"host"`
+	Port                 int           `mapstructure:"port"`
+	ReadTimeout          time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout         time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout          time.Duration `mapstructure:"idle_timeout"`
+	ShutdownTimeout      time.Duration `mapstructure:"shutdown_timeout"`
+	MiddlewareTimeout    time.Duration `mapstructure:"middleware_timeout"`
+	SlowRequestThreshold time.Duration `mapstructure:"slow_request_threshold"` // requests slower than this log at warn, 0 disables
+	LLMTimeout           time.Duration `mapstructure:"llm_timeout"`
+	TrustedProxies       []string      `mapstructure:"trusted_proxies"` // CIDRs allowed to set X-Forwarded-For
+	MaxBodySize          int64         `mapstructure:"max_body_size"`   // bytes
+	MaxUploadSize        int64         `mapstructure:"max_upload_size"` // bytes, for SQLite uploads
+	MaxImportRows        int           `mapstructure:"max_import_rows"` // per table, for CSV and Excel imports
+	UploadDir            string        `mapstructure:"upload_dir"`      // where uploaded and imported SQLite files are stored
+	ServeFrontend        bool          `mapstructure:"serve_frontend"`  // false when the UI is hosted separately
+	FrontendDir          string        `mapstructure:"frontend_dir"`    // built UI to serve when it is not embedded
+}
+
+// IsDevelopment reports whether the server runs outside production, which enables
+// the API docs UI and request validation against the OpenAPI spec
+func (c ServerConfig) IsDevelopment() bool {
+	return c.Environment == "development" || c.Environment == "test"
 }
 
 type DatabaseConfig struct {
@@ -41,6 +59,15 @@ type DatabaseConfig struct {
 	SSLMode  string `mapstructure:"ssl_mode"`
 	MaxConns int32  `mapstructure:"max_conns"`
 	MinConns int32  `mapstructure:"min_conns"`
+
+	MaxConnLifetime   time.Duration `mapstructure:"max_conn_lifetime"`   // connections are replaced after this long
+	MaxConnIdleTime   time.Duration `mapstructure:"max_conn_idle_time"`  // idle connections are closed after this long
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"` // how often idle connections are checked
+
+	// Results stored with answers are trimmed to these, 0 for no limit. Live responses
+	// are not affected.
+	StoredResultMaxRows  int `mapstructure:"stored_result_max_rows"`
+	StoredResultMaxBytes int `mapstructure:"stored_result_max_bytes"`
 }
 
 func (c DatabaseConfig) DSN() string {
@@ -50,17 +77,54 @@ func (c DatabaseConfig) DSN() string {
 	)
 }
 
+// Redis deployment modes
+const (
+	RedisModeStandalone = "standalone"
+	RedisModeSentinel   = "sentinel"
+	RedisModeCluster    = "cluster"
+)
+
 type RedisConfig struct {
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
-	DB       int    `mapstructure:"db"`
+	Mode     string   `mapstructure:"mode"`  // standalone, sentinel or cluster
+	Host     string   `mapstructure:"host"`  // standalone only
+	Port     int      `mapstructure:"port"`  // standalone only
+	Addrs    []string `mapstructure:"addrs"` // host:port of the sentinels or cluster seed nodes
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	DB       int      `mapstructure:"db"` // must be 0 in cluster mode
+
+	SentinelMasterName string `mapstructure:"sentinel_master_name"`
+	SentinelPassword   string `mapstructure:"sentinel_password"` // when the sentinels need their own password
+
+	TLS RedisTLSConfig `mapstructure:"tls"`
+
+	SchemaCacheTTL      time.Duration `mapstructure:"schema_cache_ttl"`       // 0 disables schema caching
+	SchemaCacheMaxBytes int           `mapstructure:"schema_cache_max_bytes"` // compressed size above which a schema is not cached
 }
 
 func (c RedisConfig) Addr() string {
 	return fmt.Sprintf("%s:%d", c.Host, c.Port)
 }
 
+// Addresses returns the nodes to connect to: host and port in standalone mode, Addrs
+// otherwise
+func (c RedisConfig) Addresses() []string {
+	if c.Mode == RedisModeSentinel || c.Mode == RedisModeCluster {
+		return c.Addrs
+	}
+	return []string{c.Addr()}
+}
+
+// RedisTLSConfig configures TLS to Redis, and to the sentinels in sentinel mode
+type RedisTLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`   // PEM bundle; the system roots when empty
+	CertFile           string `mapstructure:"cert_file"` // client certificate, with KeyFile
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"` // defaults to the host dialed
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
 type VaultConfig struct {
 	Address string `mapstructure:"address"`
 	Token   string `mapstructure:"token"`
@@ -70,62 +134,207 @@ type AuthConfig struct {
 	JWTSecret       string        `mapstructure:"jwt_secret"`
 	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl"`
 	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl"`
+	OIDC            OIDCConfig    `mapstructure:"oidc"`
+	AdminEmails     []string      `mapstructure:"admin_emails"` // promoted to global admin at startup
+}
+
+// OIDCConfig configures single sign-on through an OpenID Connect provider
+type OIDCConfig struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	IssuerURL      string   `mapstructure:"issuer_url"`
+	ClientID       string   `mapstructure:"client_id"`
+	ClientSecret   string   `mapstructure:"client_secret"`
+	RedirectURL    string   `mapstructure:"redirect_url"`    // must point at /api/v1/auth/oidc/callback
+	FrontendURL    string   `mapstructure:"frontend_url"`    // where tokens are handed to the SPA; JSON response if empty
+	AllowedDomains []string `mapstructure:"allowed_domains"` // empty allows any verified email
+	Exclusive      bool     `mapstructure:"exclusive"`       // disable local password login
 }
 
 type LLMConfig struct {
 	DefaultProvider string          `mapstructure:"default_provider"`
+	AllowNone       bool            `mapstructure:"allow_none"` // start without a provider when users bring their own keys
 	OpenAI          OpenAIConfig    `mapstructure:"openai"`
 	Anthropic       AnthropicConfig `mapstructure:"anthropic"`
 	Ollama          OllamaConfig    `mapstructure:"ollama"`
 	DeepSeek        DeepSeekConfig  `mapstructure:"deepseek"`
 	Gemini          GeminiConfig    `mapstructure:"gemini"`
+	// CustomModelProviders accept any model name, e.g. fine-tunes or models behind a gateway
+	CustomModelProviders []string `mapstructure:"custom_model_providers"`
+	// HistoryTokenBudget caps the estimated tokens of chat history given to the LLM
+	HistoryTokenBudget int `mapstructure:"history_token_budget"`
+	// HistoryMaxMessages caps the messages of chat history given to the LLM
+	HistoryMaxMessages int `mapstructure:"history_max_messages"`
+	// PromptTemplateDir holds prompt templates overriding the built-in ones
+	PromptTemplateDir string `mapstructure:"prompt_template_dir"`
+	// MaxQueue caps the generations waiting for a provider at its max_concurrent;
+	// more fail fast as busy
+	MaxQueue int `mapstructure:"max_queue"`
+}
+
+// ProviderTimeouts returns the LLM call timeouts configured per provider
+func (c LLMConfig) ProviderTimeouts() map[string]time.Duration {
+	timeouts := map[string]time.Duration{}
+	for name, timeout := range map[string]time.Duration{
+		"openai":    c.OpenAI.Timeout,
+		"anthropic": c.Anthropic.Timeout,
+		"ollama":    c.Ollama.Timeout,
+		"deepseek":  c.DeepSeek.Timeout,
+		"gemini":    c.Gemini.Timeout,
+	} {
+		if timeout > 0 {
+			timeouts[name] = timeout
+		}
+	}
+	return timeouts
+}
+
+// ProviderConcurrency returns the concurrent generation limits configured per provider
+func (c LLMConfig) ProviderConcurrency() map[string]int {
+	limits := map[string]int{}
+	for name, limit := range map[string]int{
+		"openai":    c.OpenAI.MaxConcurrent,
+		"anthropic": c.Anthropic.MaxConcurrent,
+		"ollama":    c.Ollama.MaxConcurrent,
+		"deepseek":  c.DeepSeek.MaxConcurrent,
+		"gemini":    c.Gemini.MaxConcurrent,
+	} {
+		if limit > 0 {
+			limits[name] = limit
+		}
+	}
+	return limits
 }
 
 type GeminiConfig struct {
-	APIKey string `mapstructure:"api_key"`
-	Model  string `mapstructure:"model"`
+	APIKey        string        `mapstructure:"api_key"`
+	Model         string        `mapstructure:"model"`
+	Timeout       time.Duration `mapstructure:"timeout"`        // overrides server.llm_timeout
+	BaseURL       string        `mapstructure:"base_url"`       // e.g. a regional endpoint or gateway
+	HTTPProxy     string        `mapstructure:"http_proxy"`     // overrides HTTPS_PROXY for this provider
+	MaxConcurrent int           `mapstructure:"max_concurrent"` // generations running at once; 0 is unlimited
 }
 
 type OpenAIConfig struct {
-	APIKey string `mapstructure:"api_key"`
-	Model  string `mapstructure:"model"`
+	APIKey        string        `mapstructure:"api_key"`
+	Model         string        `mapstructure:"model"`
+	Timeout       time.Duration `mapstructure:"timeout"`        // overrides server.llm_timeout
+	BaseURL       string        `mapstructure:"base_url"`       // e.g. a regional endpoint or gateway
+	HTTPProxy     string        `mapstructure:"http_proxy"`     // overrides HTTPS_PROXY for this provider
+	MaxConcurrent int           `mapstructure:"max_concurrent"` // generations running at once; 0 is unlimited
 }
 
 type AnthropicConfig struct {
-	APIKey string `mapstructure:"api_key"`
-	Model  string `mapstructure:"model"`
+	APIKey        string        `mapstructure:"api_key"`
+	Model         string        `mapstructure:"model"`
+	Timeout       time.Duration `mapstructure:"timeout"`        // overrides server.llm_timeout
+	BaseURL       string        `mapstructure:"base_url"`       // e.g. a regional endpoint or gateway
+	HTTPProxy     string        `mapstructure:"http_proxy"`     // overrides HTTPS_PROXY for this provider
+	MaxConcurrent int           `mapstructure:"max_concurrent"` // generations running at once; 0 is unlimited
 }
 
 type OllamaConfig struct {
-	Host         string `mapstructure:"host"`
-	DefaultModel string `mapstructure:"default_model"`
+	Host          string                       `mapstructure:"host"`
+	DefaultModel  string                       `mapstructure:"default_model"`
+	Timeout       time.Duration                `mapstructure:"timeout"`        // overrides server.llm_timeout
+	HTTPProxy     string                       `mapstructure:"http_proxy"`     // overrides HTTPS_PROXY for this provider
+	KeepAlive     string                       `mapstructure:"keep_alive"`     // how long models stay loaded, e.g. 30m; -1 keeps them loaded
+	Warmup        bool                         `mapstructure:"warmup"`         // load the default model at startup
+	Models        map[string]OllamaModelConfig `mapstructure:"models"`         // context window and output length by model name
+	MaxConcurrent int                          `mapstructure:"max_concurrent"` // generations running at once, 1 by default as a GPU serves them in turn; 0 is unlimited
+}
+
+// OllamaModelConfig sizes a model's context window and output; 0 keeps the defaults
+// of 16384 and 4096 tokens
+type OllamaModelConfig struct {
+	NumCtx     int `mapstructure:"num_ctx"`
+	NumPredict int `mapstructure:"num_predict"`
 }
 
 type DeepSeekConfig struct {
-	APIKey string `mapstructure:"api_key"`
-	Model  string `mapstructure:"model"`
+	APIKey        string        `mapstructure:"api_key"`
+	Model         string        `mapstructure:"model"`
+	Timeout       time.Duration `mapstructure:"timeout"`        // overrides server.llm_timeout
+	BaseURL       string        `mapstructure:"base_url"`       // e.g. a regional endpoint or gateway
+	HTTPProxy     string        `mapstructure:"http_proxy"`     // overrides HTTPS_PROXY for this provider
+	MaxConcurrent int           `mapstructure:"max_concurrent"` // generations running at once; 0 is unlimited
 }
 
 type SecurityConfig struct {
-	ReadOnlyDefault bool            `mapstructure:"read_only_default"`
-	MaxRows         int             `mapstructure:"max_rows"`
-	QueryTimeout    time.Duration   `mapstructure:"query_timeout"`
-	RateLimit       RateLimitConfig `mapstructure:"rate_limit"`
+	ReadOnlyDefault   bool                  `mapstructure:"read_only_default"`
+	MaxRows           int                   `mapstructure:"max_rows"`
+	DefaultLimit      int                   `mapstructure:"default_limit"` // rows of SQL without a LIMIT; 0 uses max_rows
+	QueryTimeout      time.Duration         `mapstructure:"query_timeout"`
+	MaxEstimatedRows  int64                 `mapstructure:"max_estimated_rows"` // cost gate threshold; 0 disables it
+	SchemaConcurrency int                   `mapstructure:"schema_concurrency"` // tables described at once during a schema refresh
+	RateLimit         RateLimitConfig       `mapstructure:"rate_limit"`
+	LoginLockout      LockoutConfig         `mapstructure:"login_lockout"`
+	AdapterPool       PoolConfig            `mapstructure:"adapter_pool"`  // pools kept to users' databases
+	MaxShareTTL       time.Duration         `mapstructure:"max_share_ttl"` // longest lifetime of a share link
+	ConnectionAlerts  ConnectionAlertConfig `mapstructure:"connection_alerts"`
+
+	// ClickHouseMaxMemoryUsage caps the memory, in bytes, of a ClickHouse query; 0 leaves it to the server
+	ClickHouseMaxMemoryUsage int64 `mapstructure:"clickhouse_max_memory_usage"`
+}
+
+// ConnectionAlertConfig decides when a connection whose queries keep failing is
+// flagged degraded
+type ConnectionAlertConfig struct {
+	ErrorRate  float64       `mapstructure:"error_rate"`  // share of failed queries, 0 disables alerts
+	Window     int           `mapstructure:"window"`      // recent queries considered
+	MinQueries int           `mapstructure:"min_queries"` // queries needed before the rate is judged
+	MaxAge     time.Duration `mapstructure:"max_age"`     // outcomes older than this are forgotten
+}
+
+// PoolConfig sizes the connection pools kept to users' databases
+type PoolConfig struct {
+	MaxConns          int32         `mapstructure:"max_conns"`
+	MinConns          int32         `mapstructure:"min_conns"`
+	MaxConnLifetime   time.Duration `mapstructure:"max_conn_lifetime"`
+	MaxConnIdleTime   time.Duration `mapstructure:"max_conn_idle_time"`
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"` // PostgreSQL only
 }
 
 type RateLimitConfig struct {
+	RequestsPerMinute int                             `mapstructure:"requests_per_minute"`
+	Burst             int                             `mapstructure:"burst"`
+	Classes           map[string]RateLimitClassConfig `mapstructure:"classes"`
+	// WorkspaceRequestsPerMinute caps the requests of all members of a workspace together,
+	// for workspaces without a rate_limit_per_minute setting; 0 leaves them unlimited
+	WorkspaceRequestsPerMinute int `mapstructure:"workspace_requests_per_minute"`
+}
+
+// RateLimitClassConfig configures a named rate limit bucket with its own limits
+type RateLimitClassConfig struct {
 	RequestsPerMinute int `mapstructure:"requests_per_minute"`
 	Burst             int `mapstructure:"burst"`
 }
 
+// LockoutConfig controls progressive account lockout after failed logins
+type LockoutConfig struct {
+	MaxAttempts int           `mapstructure:"max_attempts"` // failures within Window before locking
+	Window      time.Duration `mapstructure:"window"`
+	Cooldown    time.Duration `mapstructure:"cooldown"`     // first lock duration, doubled on each repeat
+	MaxCooldown time.Duration `mapstructure:"max_cooldown"` // upper bound for the lock duration
+}
+
 type LoggingConfig struct {
-	Level  string `mapstructure:"level"`
-	Format string `mapstructure:"format"`
+	Level  string        `mapstructure:"level"`  // trace, debug, info, warn or error
+	Format string        `mapstructure:"format"` // json or console
+	File   LogFileConfig `mapstructure:"file"`
+}
+
+// LogFileConfig configures rotated JSON log files next to stdout
+type LogFileConfig struct {
+	Enabled      bool          `mapstructure:"enabled"` // disable for containers that only log to stdout
+	Path         string        `mapstructure:"path"`    // strftime pattern, e.g. logs/app-%Y-%m-%d-%H.log
+	RotationTime time.Duration `mapstructure:"rotation_time"`
+	MaxAge       time.Duration `mapstructure:"max_age"` // rotated files older than this are removed
 }
 
 type MetricsConfig struct {
 	Enabled bool   `mapstructure:"enabled"`
 	Path    string `mapstructure:"path"`
+	Token   string `mapstructure:"token"` // optional bearer token required to scrape
 }
 
 // Load reads configuration from file and environment variables
@@ -163,18 +372,23 @@ func Load() (*Config, error) {
 	// Enable environment variable override
 	// This MUST be called AFTER ReadInConfig for env vars to take priority
 	v.AutomaticEnv()
-	bindEnvVars(v)
+	envNames := bindEnvVars(v)
+	if err := bindSecretFiles(v); err != nil {
+		return nil, err
+	}
 
 	var cfg Config
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	cfg.sources = settingSources(v, envNames)
 
 	return &cfg, nil
 }
 
 func setDefaults(v *viper.Viper) {
 	// Server - keep sensible defaults
+	v.SetDefault("server.environment", "development")
 	v.SetDefault("server.host", "0.0.0.0")
 	v.SetDefault("server.port", 4081)
 	v.SetDefault("server.read_timeout", "300s")
@@ -182,90 +396,275 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.idle_timeout", "120s")
 	v.SetDefault("server.shutdown_timeout", "30s")
 	v.SetDefault("server.middleware_timeout", "300s")
+	v.SetDefault("server.slow_request_threshold", "5s")
 	v.SetDefault("server.llm_timeout", "300s")
+	v.SetDefault("server.max_body_size", 1<<20)     // 1MB
+	v.SetDefault("server.max_upload_size", 100<<20) // 100MB
+	v.SetDefault("server.max_import_rows", 200000)
+	v.SetDefault("server.upload_dir", "data/sqlite")
+	v.SetDefault("server.serve_frontend", true)
 
 	// Database - NO DEFAULTS, must come from env vars
 	v.SetDefault("database.ssl_mode", "disable")
 	v.SetDefault("database.max_conns", 20)
 	v.SetDefault("database.min_conns", 5)
+	v.SetDefault("database.max_conn_lifetime", "1h")
+	v.SetDefault("database.max_conn_idle_time", "30m")
+	v.SetDefault("database.health_check_period", "1m")
+	v.SetDefault("database.stored_result_max_rows", 200)
+	v.SetDefault("database.stored_result_max_bytes", 1048576)
 
 	// Redis - NO DEFAULTS for host/port, must come from env vars
+	v.SetDefault("redis.mode", RedisModeStandalone)
 	v.SetDefault("redis.db", 0)
+	v.SetDefault("redis.schema_cache_ttl", "5m")
+	v.SetDefault("redis.schema_cache_max_bytes", 4<<20)
 
 	// Auth
 	v.SetDefault("auth.access_token_ttl", "24h")
 	v.SetDefault("auth.refresh_token_ttl", "168h") // 7 days
+	v.SetDefault("auth.oidc.enabled", false)
+	v.SetDefault("auth.oidc.issuer_url", "https://accounts.google.com")
+	v.SetDefault("auth.oidc.exclusive", false)
 
 	// LLM - NO DEFAULTS for hosts/keys, must come from env vars
 	v.SetDefault("llm.default_provider", "gemini")
+	v.SetDefault("llm.allow_none", false)
+	v.SetDefault("llm.history_token_budget", 2000)
+	v.SetDefault("llm.history_max_messages", 20)
+	v.SetDefault("llm.max_queue", 10)
+	v.SetDefault("llm.ollama.max_concurrent", 1)
 
 	// Security
 	v.SetDefault("security.read_only_default", true)
 	v.SetDefault("security.max_rows", 1000)
+	v.SetDefault("security.default_limit", 100)
 	v.SetDefault("security.query_timeout", "30s")
+	v.SetDefault("security.max_estimated_rows", 0)
+	v.SetDefault("security.schema_concurrency", 8)
+	v.SetDefault("security.clickhouse_max_memory_usage", 4<<30)
+	v.SetDefault("security.adapter_pool.max_conns", 5)
+	v.SetDefault("security.adapter_pool.min_conns", 1)
+	v.SetDefault("security.adapter_pool.max_conn_lifetime", "30m")
+	v.SetDefault("security.adapter_pool.max_conn_idle_time", "5m")
+	v.SetDefault("security.adapter_pool.health_check_period", "1m")
 	v.SetDefault("security.rate_limit.requests_per_minute", 60)
 	v.SetDefault("security.rate_limit.burst", 10)
+	v.SetDefault("security.rate_limit.workspace_requests_per_minute", 600)
+	v.SetDefault("security.rate_limit.classes.query.requests_per_minute", 10)
+	v.SetDefault("security.rate_limit.classes.query.burst", 0)
+	v.SetDefault("security.rate_limit.classes.auth.requests_per_minute", 5)
+	v.SetDefault("security.rate_limit.classes.auth.burst", 0)
+	v.SetDefault("security.rate_limit.classes.share.requests_per_minute", 30)
+	v.SetDefault("security.rate_limit.classes.share.burst", 0)
+	v.SetDefault("security.max_share_ttl", "720h")
+	v.SetDefault("security.connection_alerts.error_rate", 0.5)
+	v.SetDefault("security.connection_alerts.window", 20)
+	v.SetDefault("security.connection_alerts.min_queries", 5)
+	v.SetDefault("security.connection_alerts.max_age", "1h")
+	v.SetDefault("security.login_lockout.max_attempts", 5)
+	v.SetDefault("security.login_lockout.window", "15m")
+	v.SetDefault("security.login_lockout.cooldown", "1m")
+	v.SetDefault("security.login_lockout.max_cooldown", "1h")
 
 	// Logging
 	v.SetDefault("logging.level", "info")
 	v.SetDefault("logging.format", "json")
+	v.SetDefault("logging.file.enabled", true)
+	v.SetDefault("logging.file.path", "logs/app-%Y-%m-%d-%H.log")
+	v.SetDefault("logging.file.rotation_time", "1h")
+	v.SetDefault("logging.file.max_age", "168h") // 7 days
 
 	// Metrics
 	v.SetDefault("metrics.enabled", true)
 	v.SetDefault("metrics.path", "/metrics")
 }
 
-func bindEnvVars(v *viper.Viper) {
+// secretEnvVars maps secret-bearing keys to their environment variables. Each also
+// accepts a <NAME>_FILE variant pointing at a file, e.g. a Docker or Kubernetes secret.
+var secretEnvVars = map[string]string{
+	"database.password":       "POSTGRES_PASSWORD",
+	"redis.password":          "REDIS_PASSWORD",
+	"redis.sentinel_password": "REDIS_SENTINEL_PASSWORD",
+	"vault.token":             "VAULT_TOKEN",
+	"auth.jwt_secret":         "JWT_SECRET",
+	"auth.oidc.client_secret": "OIDC_CLIENT_SECRET",
+	"llm.openai.api_key":      "OPENAI_API_KEY",
+	"llm.anthropic.api_key":   "ANTHROPIC_API_KEY",
+	"llm.deepseek.api_key":    "DEEPSEEK_API_KEY",
+	"llm.gemini.api_key":      "GEMINI_API_KEY",
+	"metrics.token":           "METRICS_TOKEN",
+}
+
+// bindSecretFiles reads secrets from <NAME>_FILE paths. The variable itself takes
+// precedence when both are set, and either overrides the config file.
+func bindSecretFiles(v *viper.Viper) error {
+	for key, name := range secretEnvVars {
+		path := os.Getenv(name + "_FILE")
+		if path == "" || os.Getenv(name) != "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_FILE: %w", name, err)
+		}
+		v.Set(key, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// bindEnvVars binds settings to their environment variables and returns the variable
+// name for each key
+func bindEnvVars(v *viper.Viper) map[string]string {
+	names := make(map[string]string)
+	bind := func(key, name string) {
+		v.BindEnv(key, name)
+		names[key] = name
+	}
+
 	// Server
-	v.BindEnv("server.host", "SERVER_HOST")
-	v.BindEnv("server.port", "SERVER_PORT") // Expects int
-	v.BindEnv("server.read_timeout", "SERVER_READ_TIMEOUT")
-	v.BindEnv("server.write_timeout", "SERVER_WRITE_TIMEOUT")
-	v.BindEnv("server.idle_timeout", "SERVER_IDLE_TIMEOUT")
-	v.BindEnv("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT")
-	v.BindEnv("server.middleware_timeout", "SERVER_MIDDLEWARE_TIMEOUT")
-	v.BindEnv("server.llm_timeout", "SERVER_LLM_TIMEOUT")
+	bind("server.environment", "APP_ENV")
+	bind("server.host", "SERVER_HOST")
+	bind("server.port", "SERVER_PORT") // Expects int
+	bind("server.read_timeout", "SERVER_READ_TIMEOUT")
+	bind("server.write_timeout", "SERVER_WRITE_TIMEOUT")
+	bind("server.idle_timeout", "SERVER_IDLE_TIMEOUT")
+	bind("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT")
+	bind("server.middleware_timeout", "SERVER_MIDDLEWARE_TIMEOUT")
+	bind("server.slow_request_threshold", "SERVER_SLOW_REQUEST_THRESHOLD")
+	bind("server.llm_timeout", "SERVER_LLM_TIMEOUT")
+	bind("server.trusted_proxies", "TRUSTED_PROXIES") // Comma-separated CIDRs
+	bind("server.max_body_size", "SERVER_MAX_BODY_SIZE")
+	bind("server.max_upload_size", "SERVER_MAX_UPLOAD_SIZE")
+	bind("server.max_import_rows", "SERVER_MAX_IMPORT_ROWS")
+	bind("server.upload_dir", "SERVER_UPLOAD_DIR")
+	bind("server.serve_frontend", "SERVE_FRONTEND")
+	bind("server.frontend_dir", "SERVER_FRONTEND_DIR")
 
 	// Database
-	v.BindEnv("database.host", "POSTGRES_HOST")
-	v.BindEnv("database.port", "POSTGRES_PORT")
-	v.BindEnv("database.user", "POSTGRES_USER")
-	v.BindEnv("database.password", "POSTGRES_PASSWORD")
-	v.BindEnv("database.database", "POSTGRES_DB")
-	v.BindEnv("database.ssl_mode", "POSTGRES_SSL_MODE")
-	v.BindEnv("database.max_conns", "POSTGRES_MAX_CONNS")
+	bind("database.host", "POSTGRES_HOST")
+	bind("database.port", "POSTGRES_PORT")
+	bind("database.user", "POSTGRES_USER")
+	bind("database.password", "POSTGRES_PASSWORD")
+	bind("database.database", "POSTGRES_DB")
+	bind("database.ssl_mode", "POSTGRES_SSL_MODE")
+	bind("database.max_conns", "POSTGRES_MAX_CONNS")
+	bind("database.min_conns", "POSTGRES_MIN_CONNS")
+	bind("database.max_conn_lifetime", "POSTGRES_MAX_CONN_LIFETIME")
+	bind("database.max_conn_idle_time", "POSTGRES_MAX_CONN_IDLE_TIME")
+	bind("database.health_check_period", "POSTGRES_HEALTH_CHECK_PERIOD")
+	bind("database.stored_result_max_rows", "STORED_RESULT_MAX_ROWS")
+	bind("database.stored_result_max_bytes", "STORED_RESULT_MAX_BYTES")
 
 	// Redis
-	v.BindEnv("redis.host", "REDIS_HOST")
-	v.BindEnv("redis.port", "REDIS_PORT")
-	v.BindEnv("redis.password", "REDIS_PASSWORD")
-	v.BindEnv("redis.db", "REDIS_DB")
+	bind("redis.mode", "REDIS_MODE")
+	bind("redis.host", "REDIS_HOST")
+	bind("redis.port", "REDIS_PORT")
+	bind("redis.addrs", "REDIS_ADDRS") // Comma-separated host:port
+	bind("redis.username", "REDIS_USERNAME")
+	bind("redis.password", "REDIS_PASSWORD")
+	bind("redis.db", "REDIS_DB")
+	bind("redis.sentinel_master_name", "REDIS_SENTINEL_MASTER_NAME")
+	bind("redis.sentinel_password", "REDIS_SENTINEL_PASSWORD")
+	bind("redis.tls.enabled", "REDIS_TLS_ENABLED")
+	bind("redis.tls.ca_file", "REDIS_TLS_CA_FILE")
+	bind("redis.tls.cert_file", "REDIS_TLS_CERT_FILE")
+	bind("redis.tls.key_file", "REDIS_TLS_KEY_FILE")
+	bind("redis.tls.server_name", "REDIS_TLS_SERVER_NAME")
+	bind("redis.tls.insecure_skip_verify", "REDIS_TLS_INSECURE_SKIP_VERIFY")
+	bind("redis.schema_cache_ttl", "SCHEMA_CACHE_TTL")
+	bind("redis.schema_cache_max_bytes", "SCHEMA_CACHE_MAX_BYTES")
 
 	// Vault
-	v.BindEnv("vault.address", "VAULT_ADDR")
-	v.BindEnv("vault.token", "VAULT_TOKEN")
+	bind("vault.address", "VAULT_ADDR")
+	bind("vault.token", "VAULT_TOKEN")
 
 	// Auth
-	v.BindEnv("auth.jwt_secret", "JWT_SECRET")
-	v.BindEnv("auth.access_token_ttl", "ACCESS_TOKEN_TTL")
-	v.BindEnv("auth.refresh_token_ttl", "REFRESH_TOKEN_TTL")
+	bind("auth.jwt_secret", "JWT_SECRET")
+	bind("auth.access_token_ttl", "ACCESS_TOKEN_TTL")
+	bind("auth.refresh_token_ttl", "REFRESH_TOKEN_TTL")
+	bind("auth.admin_emails", "ADMIN_EMAILS") // Comma-separated
+	bind("auth.oidc.enabled", "OIDC_ENABLED")
+	bind("auth.oidc.issuer_url", "OIDC_ISSUER_URL")
+	bind("auth.oidc.client_id", "OIDC_CLIENT_ID")
+	bind("auth.oidc.client_secret", "OIDC_CLIENT_SECRET")
+	bind("auth.oidc.redirect_url", "OIDC_REDIRECT_URL")
+	bind("auth.oidc.frontend_url", "OIDC_FRONTEND_URL")
+	bind("auth.oidc.allowed_domains", "OIDC_ALLOWED_DOMAINS") // Comma-separated
+	bind("auth.oidc.exclusive", "OIDC_EXCLUSIVE")
 
 	// LLM General
-	v.BindEnv("llm.default_provider", "LLM_DEFAULT_PROVIDER")
+	bind("llm.default_provider", "LLM_DEFAULT_PROVIDER")
+	bind("llm.allow_none", "LLM_NONE_OK")
+	bind("llm.custom_model_providers", "LLM_CUSTOM_MODEL_PROVIDERS") // Comma-separated
+	bind("llm.history_token_budget", "LLM_HISTORY_TOKEN_BUDGET")
+	bind("llm.history_max_messages", "LLM_HISTORY_MAX_MESSAGES")
+	bind("llm.prompt_template_dir", "PROMPT_TEMPLATE_DIR")
+	bind("llm.max_queue", "LLM_MAX_QUEUE")
 
 	// LLM API Keys & Models
-	v.BindEnv("llm.openai.api_key", "OPENAI_API_KEY")
-	v.BindEnv("llm.openai.model", "OPENAI_MODEL")
-
-	v.BindEnv("llm.anthropic.api_key", "ANTHROPIC_API_KEY")
-	v.BindEnv("llm.anthropic.model", "ANTHROPIC_MODEL")
+	bind("llm.openai.api_key", "OPENAI_API_KEY")
+	bind("llm.openai.model", "OPENAI_MODEL")
+	bind("llm.openai.timeout", "OPENAI_TIMEOUT")
+	bind("llm.openai.base_url", "OPENAI_BASE_URL")
+	bind("llm.openai.http_proxy", "OPENAI_HTTP_PROXY")
+	bind("llm.openai.max_concurrent", "OPENAI_MAX_CONCURRENT")
+
+	bind("llm.anthropic.api_key", "ANTHROPIC_API_KEY")
+	bind("llm.anthropic.model", "ANTHROPIC_MODEL")
+	bind("llm.anthropic.timeout", "ANTHROPIC_TIMEOUT")
+	bind("llm.anthropic.base_url", "ANTHROPIC_BASE_URL")
+	bind("llm.anthropic.http_proxy", "ANTHROPIC_HTTP_PROXY")
+	bind("llm.anthropic.max_concurrent", "ANTHROPIC_MAX_CONCURRENT")
+
+	bind("llm.deepseek.api_key", "DEEPSEEK_API_KEY")
+	bind("llm.deepseek.model", "DEEPSEEK_MODEL")
+	bind("llm.deepseek.timeout", "DEEPSEEK_TIMEOUT")
+	bind("llm.deepseek.base_url", "DEEPSEEK_BASE_URL")
+	bind("llm.deepseek.http_proxy", "DEEPSEEK_HTTP_PROXY")
+	bind("llm.deepseek.max_concurrent", "DEEPSEEK_MAX_CONCURRENT")
+
+	bind("llm.gemini.api_key", "GEMINI_API_KEY")
+	bind("llm.gemini.model", "GEMINI_MODEL")
+	bind("llm.gemini.timeout", "GEMINI_TIMEOUT")
+	bind("llm.gemini.base_url", "GEMINI_BASE_URL")
+	bind("llm.gemini.http_proxy", "GEMINI_HTTP_PROXY")
+	bind("llm.gemini.max_concurrent", "GEMINI_MAX_CONCURRENT")
+
+	bind("llm.ollama.host", "OLLAMA_HOST")
+	bind("llm.ollama.default_model", "OLLAMA_DEFAULT_MODEL")
+	bind("llm.ollama.timeout", "OLLAMA_TIMEOUT")
+	bind("llm.ollama.http_proxy", "OLLAMA_HTTP_PROXY")
+	bind("llm.ollama.max_concurrent", "OLLAMA_MAX_CONCURRENT")
+	bind("llm.ollama.keep_alive", "OLLAMA_KEEP_ALIVE")
+	bind("llm.ollama.warmup", "OLLAMA_WARMUP")
 
-	v.BindEnv("llm.deepseek.api_key", "DEEPSEEK_API_KEY")
-	v.BindEnv("llm.deepseek.model", "DEEPSEEK_MODEL")
+	// Security
+	bind("security.default_limit", "DEFAULT_LIMIT")
+	bind("security.max_estimated_rows", "MAX_ESTIMATED_ROWS")
+	bind("security.schema_concurrency", "SCHEMA_CONCURRENCY")
+	bind("security.clickhouse_max_memory_usage", "CLICKHOUSE_MAX_MEMORY_USAGE")
+	bind("security.max_share_ttl", "MAX_SHARE_TTL")
+	bind("security.connection_alerts.error_rate", "CONNECTION_ALERT_ERROR_RATE")
+	bind("security.connection_alerts.window", "CONNECTION_ALERT_WINDOW")
+	bind("security.connection_alerts.min_queries", "CONNECTION_ALERT_MIN_QUERIES")
+	bind("security.connection_alerts.max_age", "CONNECTION_ALERT_MAX_AGE")
+	bind("security.adapter_pool.max_conns", "ADAPTER_POOL_MAX_CONNS")
+	bind("security.adapter_pool.min_conns", "ADAPTER_POOL_MIN_CONNS")
+	bind("security.adapter_pool.max_conn_lifetime", "ADAPTER_POOL_MAX_CONN_LIFETIME")
+	bind("security.adapter_pool.max_conn_idle_time", "ADAPTER_POOL_MAX_CONN_IDLE_TIME")
+	bind("security.adapter_pool.health_check_period", "ADAPTER_POOL_HEALTH_CHECK_PERIOD")
 
-	v.BindEnv("llm.gemini.api_key", "GEMINI_API_KEY")
-	v.BindEnv("llm.gemini.model", "GEMINI_MODEL")
+	// Logging
+	bind("logging.level", "LOG_LEVEL")
+	bind("logging.format", "LOG_FORMAT")
+	bind("logging.file.enabled", "LOG_FILE_ENABLED")
+	bind("logging.file.path", "LOG_FILE_PATH")
+	bind("logging.file.rotation_time", "LOG_FILE_ROTATION_TIME")
+	bind("logging.file.max_age", "LOG_FILE_MAX_AGE")
 
-	v.BindEnv("llm.ollama.host", "OLLAMA_HOST")
-	v.BindEnv("llm.ollama.default_model", "OLLAMA_DEFAULT_MODEL")
+	// Metrics
+	bind("metrics.enabled", "METRICS_ENABLED")
+	bind("metrics.token", "METRICS_TOKEN")
+	return names
 }
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/spf13/viper"
+)
+
+// Where a setting came from, as reported by Sources
+const (
+	SourceDefault    = "default"
+	SourceConfigFile = "config_file"
+	SourceEnv        = "env"
+	SourceSecretFile = "secret_file"
+)
+
+// Redacted returns the resolved configuration keyed like the config file, with secrets
+// masked and credentials stripped from URLs, so it is safe to show or log
+func (c *Config) Redacted() map[string]any {
+	return redactValue(reflect.ValueOf(*c), "").(map[string]any)
+}
+
+// Sources reports where each setting came from, keyed like the config file. Only
+// settings that have a value somewhere are listed.
+func (c *Config) Sources() map[string]string {
+	return c.sources
+}
+
+func redactValue(v reflect.Value, key string) any {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		return v.Interface().(time.Duration).String()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		out := make(map[string]any, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := field.Tag.Get("mapstructure")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			out[name] = redactValue(v.Field(i), joinKey(key, name))
+		}
+		return out
+	case reflect.Map:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			name := iter.Key().String()
+			out[name] = redactValue(iter.Value(), joinKey(key, name))
+		}
+		return out
+	case reflect.Slice:
+		out := make([]any, v.Len())
+		for i := range out {
+			out[i] = redactValue(v.Index(i), key)
+		}
+		return out
+	case reflect.String:
+		s := v.String()
+		if _, secret := secretEnvVars[key]; secret && s != "" {
+			return security.MaskSecret(s)
+		}
+		return security.RedactString(s)
+	default:
+		return v.Interface()
+	}
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// settingSources works out which layer supplied each setting, in viper's order of
+// precedence: secret files, environment variables, the config file, then defaults
+func settingSources(v *viper.Viper, envNames map[string]string) map[string]string {
+	sources := make(map[string]string)
+	for _, key := range v.AllKeys() {
+		name := envNames[key]
+		_, secret := secretEnvVars[key]
+		switch {
+		case name != "" && os.Getenv(name) != "":
+			sources[key] = SourceEnv
+		case secret && os.Getenv(name+"_FILE") != "":
+			sources[key] = SourceSecretFile
+		case v.InConfig(key):
+			sources[key] = SourceConfigFile
+		default:
+			sources[key] = SourceDefault
+		}
+	}
+	return sources
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minProductionSecretLength is the shortest JWT secret accepted in production
+const minProductionSecretLength = 32
+
+// Validate checks that the configuration is complete enough to start the server. It
+// reports every problem at once, each naming the environment variable to set.
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(msg string) {
+		problems = append(problems, msg)
+	}
+
+	switch c.Server.Environment {
+	case "development", "test", "production":
+	default:
+		problem("APP_ENV (server.environment) must be development, test or production, got " + strconv.Quote(c.Server.Environment))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problem("SERVER_PORT (server.port) must be between 1 and 65535")
+	}
+
+	switch {
+	case c.Auth.JWTSecret == "":
+		problem("JWT_SECRET (auth.jwt_secret) is required; it signs tokens and encrypts stored credentials")
+	case c.Server.Environment == "production" && len(c.Auth.JWTSecret) < minProductionSecretLength:
+		problem("JWT_SECRET (auth.jwt_secret) must be at least 32 characters in production, e.g. the output of `openssl rand -hex 32`")
+	}
+	if c.Auth.OIDC.Enabled {
+		if c.Auth.OIDC.ClientID == "" || c.Auth.OIDC.ClientSecret == "" {
+			problem("OIDC_CLIENT_ID and OIDC_CLIENT_SECRET are required when OIDC_ENABLED is true")
+		}
+		if c.Auth.OIDC.RedirectURL == "" {
+			problem("OIDC_REDIRECT_URL is required when OIDC_ENABLED is true")
+		}
+	}
+
+	if c.Database.Host == "" {
+		problem("POSTGRES_HOST (database.host) is required")
+	}
+	if c.Database.User == "" {
+		problem("POSTGRES_USER (database.user) is required")
+	}
+	if c.Database.Database == "" {
+		problem("POSTGRES_DB (database.database) is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		problem("POSTGRES_PORT (database.port) must be between 1 and 65535")
+	}
+
+	switch c.Redis.Mode {
+	case "", RedisModeStandalone:
+		if c.Redis.Host == "" {
+			problem("REDIS_HOST (redis.host) is required")
+		}
+		if c.Redis.Port < 1 || c.Redis.Port > 65535 {
+			problem("REDIS_PORT (redis.port) must be between 1 and 65535")
+		}
+	case RedisModeSentinel:
+		if len(c.Redis.Addrs) == 0 {
+			problem("REDIS_ADDRS (redis.addrs) must list the sentinels in sentinel mode")
+		}
+		if c.Redis.SentinelMasterName == "" {
+			problem("REDIS_SENTINEL_MASTER_NAME (redis.sentinel_master_name) is required in sentinel mode")
+		}
+	case RedisModeCluster:
+		if len(c.Redis.Addrs) == 0 {
+			problem("REDIS_ADDRS (redis.addrs) must list cluster nodes in cluster mode")
+		}
+		if c.Redis.DB != 0 {
+			problem("REDIS_DB (redis.db) must be 0 in cluster mode")
+		}
+	default:
+		problem("REDIS_MODE (redis.mode) must be standalone, sentinel or cluster, got " + strconv.Quote(c.Redis.Mode))
+	}
+	if (c.Redis.TLS.CertFile == "") != (c.Redis.TLS.KeyFile == "") {
+		problem("REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together")
+	}
+
+	if !c.LLM.AllowNone && len(c.LLM.ConfiguredProviders()) == 0 {
+		problem("no LLM provider is configured: set one of GEMINI_API_KEY, OPENAI_API_KEY, ANTHROPIC_API_KEY, DEEPSEEK_API_KEY or OLLAMA_HOST, or LLM_NONE_OK=true if users bring their own keys")
+	}
+
+	if c.Database.StoredResultMaxRows < 0 || c.Database.StoredResultMaxBytes < 0 {
+		problem("STORED_RESULT_MAX_ROWS and STORED_RESULT_MAX_BYTES must not be negative")
+	}
+	if c.Security.RateLimit.WorkspaceRequestsPerMinute < 0 {
+		problem("security.rate_limit.workspace_requests_per_minute must not be negative")
+	}
+	if c.LLM.HistoryTokenBudget < 0 {
+		problem("LLM_HISTORY_TOKEN_BUDGET (llm.history_token_budget) must not be negative")
+	}
+	if c.LLM.HistoryMaxMessages < 0 || c.LLM.HistoryMaxMessages > 50 {
+		problem("LLM_HISTORY_MAX_MESSAGES (llm.history_max_messages) must be between 0 and 50")
+	}
+	if c.LLM.MaxQueue < 0 {
+		problem("LLM_MAX_QUEUE (llm.max_queue) must not be negative")
+	}
+	if pool := c.Security.AdapterPool; pool.MaxConns < 0 || pool.MinConns < 0 || (pool.MaxConns > 0 && pool.MinConns > pool.MaxConns) {
+		problem("ADAPTER_POOL_MIN_CONNS and ADAPTER_POOL_MAX_CONNS must not be negative, and the minimum must not exceed the maximum")
+	}
+	if keepAlive := c.LLM.Ollama.KeepAlive; keepAlive != "" && !validKeepAlive(keepAlive) {
+		problem("OLLAMA_KEEP_ALIVE (llm.ollama.keep_alive) must be a duration or a number of seconds, got " + strconv.Quote(keepAlive))
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.LLM.Ollama.Models)) {
+		if model := c.LLM.Ollama.Models[name]; model.NumCtx < 0 || model.NumPredict < 0 {
+			problem("llm.ollama.models." + name + ": num_ctx and num_predict must not be negative")
+		}
+	}
+	if alerts := c.Security.ConnectionAlerts; alerts.ErrorRate < 0 || alerts.ErrorRate > 1 {
+		problem("CONNECTION_ALERT_ERROR_RATE (security.connection_alerts.error_rate) must be between 0 and 1; 0 disables alerts")
+	} else if alerts.ErrorRate > 0 && (alerts.Window < 1 || alerts.MinQueries < 1 || alerts.MinQueries > alerts.Window || alerts.MaxAge <= 0) {
+		problem("CONNECTION_ALERT_WINDOW and CONNECTION_ALERT_MIN_QUERIES must be positive with the minimum at most the window, and CONNECTION_ALERT_MAX_AGE positive")
+	}
+	if c.Security.MaxShareTTL < 0 {
+		problem("MAX_SHARE_TTL (security.max_share_ttl) must not be negative")
+	}
+	if c.Security.DefaultLimit < 0 {
+		problem("DEFAULT_LIMIT (security.default_limit) must not be negative; 0 limits queries without a LIMIT to max_rows")
+	}
+	if c.Security.MaxEstimatedRows < 0 {
+		problem("MAX_ESTIMATED_ROWS (security.max_estimated_rows) must not be negative; 0 disables the cost gate")
+	}
+	if c.Security.ClickHouseMaxMemoryUsage < 0 {
+		problem("CLICKHOUSE_MAX_MEMORY_USAGE (security.clickhouse_max_memory_usage) must not be negative; 0 leaves the limit to the server")
+	}
+
+	for _, u := range []struct {
+		name, value string
+		schemes     []string
+	}{
+		{"OLLAMA_HOST", c.LLM.Ollama.Host, endpointSchemes},
+		{"OPENAI_BASE_URL", c.LLM.OpenAI.BaseURL, endpointSchemes},
+		{"ANTHROPIC_BASE_URL", c.LLM.Anthropic.BaseURL, endpointSchemes},
+		{"DEEPSEEK_BASE_URL", c.LLM.DeepSeek.BaseURL, endpointSchemes},
+		{"GEMINI_BASE_URL", c.LLM.Gemini.BaseURL, endpointSchemes},
+		{"OLLAMA_HTTP_PROXY", c.LLM.Ollama.HTTPProxy, proxySchemes},
+		{"OPENAI_HTTP_PROXY", c.LLM.OpenAI.HTTPProxy, proxySchemes},
+		{"ANTHROPIC_HTTP_PROXY", c.LLM.Anthropic.HTTPProxy, proxySchemes},
+		{"DEEPSEEK_HTTP_PROXY", c.LLM.DeepSeek.HTTPProxy, proxySchemes},
+		{"GEMINI_HTTP_PROXY", c.LLM.Gemini.HTTPProxy, proxySchemes},
+	} {
+		if u.value != "" && !validURL(u.value, u.schemes) {
+			problem(u.name + " must be an absolute URL with scheme " + strings.Join(u.schemes, ", ") + ", got " + strconv.Quote(u.value))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("invalid configuration:\n  - " + strings.Join(problems, "\n  - "))
+}
+
+var (
+	endpointSchemes = []string{"http", "https"}
+	proxySchemes    = []string{"http", "https", "socks5"}
+)
+
+// validKeepAlive reports whether keepAlive is a duration or a number of seconds, the
+// forms Ollama accepts
+func validKeepAlive(keepAlive string) bool {
+	if _, err := strconv.ParseFloat(keepAlive, 64); err == nil {
+		return true
+	}
+	_, err := time.ParseDuration(keepAlive)
+	return err == nil
+}
+
+// validURL reports whether raw is an absolute URL with one of the given schemes
+func validURL(raw string, schemes []string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Host != "" && slices.Contains(schemes, u.Scheme)
+}
+
+// ConfiguredProviders lists the LLM providers that have credentials or a host
+func (c LLMConfig) ConfiguredProviders() []string {
+	var providers []string
+	for _, p := range []struct {
+		name       string
+		configured bool
+	}{
+		{"anthropic", c.Anthropic.APIKey != ""},
+		{"deepseek", c.DeepSeek.APIKey != ""},
+		{"gemini", c.Gemini.APIKey != ""},
+		{"ollama", c.Ollama.Host != ""},
+		{"openai", c.OpenAI.APIKey != ""},
+	} {
+		if p.configured {
+			providers = append(providers, p.name)
+		}
+	}
+	return providers
+}
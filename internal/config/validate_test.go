@@ -0,0 +1,143 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validConfig returns a production configuration that passes Validate
+func validConfig() *Config {
+	cfg := &Config{}
+	cfg.Server.Environment = "production"
+	cfg.Server.Port = 4000
+	cfg.Auth.JWTSecret = strings.Repeat("s", minProductionSecretLength)
+	cfg.Database.Host = "postgres"
+	cfg.Database.Port = 5432
+	cfg.Database.User = "texttosql"
+	cfg.Database.Database = "texttosql"
+	cfg.Redis.Host = "redis"
+	cfg.Redis.Port = 6379
+	cfg.LLM.OpenAI.APIKey = "sk-test"
+	return cfg
+}
+
+func TestConfig_Validate(t *testing.T) {
+	require.NoError(t, validConfig().Validate())
+
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+		want   string
+	}{
+		{"unknown environment", func(c *Config) { c.Server.Environment = "staging" }, `APP_ENV (server.environment) must be development, test or production, got "staging"`},
+		{"server port out of range", func(c *Config) { c.Server.Port = 70000 }, "SERVER_PORT"},
+		{"missing JWT secret", func(c *Config) { c.Auth.JWTSecret = "" }, "JWT_SECRET (auth.jwt_secret) is required"},
+		{"short JWT secret in production", func(c *Config) { c.Auth.JWTSecret = "secret" }, "JWT_SECRET (auth.jwt_secret) must be at least 32 characters"},
+		{"OIDC without client", func(c *Config) {
+			c.Auth.OIDC.Enabled = true
+			c.Auth.OIDC.RedirectURL = "https://app.example.com/api/v1/auth/oidc/callback"
+		}, "OIDC_CLIENT_ID and OIDC_CLIENT_SECRET are required"},
+		{"OIDC without redirect URL", func(c *Config) {
+			c.Auth.OIDC.Enabled = true
+			c.Auth.OIDC.ClientID = "client"
+			c.Auth.OIDC.ClientSecret = "secret"
+		}, "OIDC_REDIRECT_URL is required"},
+		{"missing database host", func(c *Config) { c.Database.Host = "" }, "POSTGRES_HOST (database.host) is required"},
+		{"missing database user", func(c *Config) { c.Database.User = "" }, "POSTGRES_USER (database.user) is required"},
+		{"missing database name", func(c *Config) { c.Database.Database = "" }, "POSTGRES_DB (database.database) is required"},
+		{"missing database port", func(c *Config) { c.Database.Port = 0 }, "POSTGRES_PORT"},
+		{"missing Redis host", func(c *Config) { c.Redis.Host = "" }, "REDIS_HOST (redis.host) is required"},
+		{"missing Redis port", func(c *Config) { c.Redis.Port = 0 }, "REDIS_PORT"},
+		{"unknown Redis mode", func(c *Config) { c.Redis.Mode = "replica" }, `REDIS_MODE (redis.mode) must be standalone, sentinel or cluster, got "replica"`},
+		{"sentinel without master name", func(c *Config) {
+			c.Redis.Mode = RedisModeSentinel
+			c.Redis.Addrs = []string{"sentinel-1:26379"}
+		}, "REDIS_SENTINEL_MASTER_NAME (redis.sentinel_master_name) is required in sentinel mode"},
+		{"sentinel without sentinels", func(c *Config) {
+			c.Redis.Mode = RedisModeSentinel
+			c.Redis.SentinelMasterName = "mymaster"
+		}, "REDIS_ADDRS (redis.addrs) must list the sentinels"},
+		{"cluster with a database", func(c *Config) {
+			c.Redis.Mode = RedisModeCluster
+			c.Redis.Addrs = []string{"node-1:6379"}
+			c.Redis.DB = 2
+		}, "REDIS_DB (redis.db) must be 0 in cluster mode"},
+		{"Redis client certificate without key", func(c *Config) { c.Redis.TLS.CertFile = "client.pem" }, "REDIS_TLS_CERT_FILE and REDIS_TLS_KEY_FILE must be set together"},
+		{"no LLM provider", func(c *Config) { c.LLM.OpenAI.APIKey = "" }, "no LLM provider is configured"},
+		{"relative Ollama host", func(c *Config) { c.LLM.Ollama.Host = "localhost:11434" }, `OLLAMA_HOST must be an absolute URL with scheme http, https, got "localhost:11434"`},
+		{"bad Ollama keep-alive", func(c *Config) { c.LLM.Ollama.KeepAlive = "forever" }, `OLLAMA_KEEP_ALIVE (llm.ollama.keep_alive) must be a duration or a number of seconds, got "forever"`},
+		{"negative Ollama context window", func(c *Config) {
+			c.LLM.Ollama.Models = map[string]OllamaModelConfig{"phi3": {NumCtx: -1}}
+		}, "llm.ollama.models.phi3: num_ctx and num_predict must not be negative"},
+		{"bad base URL", func(c *Config) { c.LLM.DeepSeek.BaseURL = "api.deepseek.com/beta" }, "DEEPSEEK_BASE_URL must be an absolute URL"},
+		{"adapter pool minimum above maximum", func(c *Config) {
+			c.Security.AdapterPool.MaxConns = 2
+			c.Security.AdapterPool.MinConns = 4
+		}, "ADAPTER_POOL_MIN_CONNS and ADAPTER_POOL_MAX_CONNS"},
+		{"negative default limit", func(c *Config) { c.Security.DefaultLimit = -1 }, "DEFAULT_LIMIT (security.default_limit) must not be negative"},
+		{"negative cost gate threshold", func(c *Config) { c.Security.MaxEstimatedRows = -1 }, "MAX_ESTIMATED_ROWS (security.max_estimated_rows) must not be negative"},
+		{"negative ClickHouse memory limit", func(c *Config) { c.Security.ClickHouseMaxMemoryUsage = -1 }, "CLICKHOUSE_MAX_MEMORY_USAGE (security.clickhouse_max_memory_usage) must not be negative"},
+		{"history messages above the fetch limit", func(c *Config) { c.LLM.HistoryMaxMessages = 51 }, "LLM_HISTORY_MAX_MESSAGES (llm.history_max_messages) must be between 0 and 50"},
+		{"negative LLM queue", func(c *Config) { c.LLM.MaxQueue = -1 }, "LLM_MAX_QUEUE (llm.max_queue) must not be negative"},
+		{"bad proxy scheme", func(c *Config) { c.LLM.OpenAI.HTTPProxy = "ftp://proxy:21" }, "OPENAI_HTTP_PROXY must be an absolute URL with scheme http, https, socks5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.mutate(cfg)
+
+			err := cfg.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestConfig_ValidateAllowances(t *testing.T) {
+	t.Run("short JWT secret outside production", func(t *testing.T) {
+		cfg := validConfig()
+		cfg.Server.Environment = "development"
+		cfg.Auth.JWTSecret = "dev-secret"
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("no LLM provider with LLM_NONE_OK", func(t *testing.T) {
+		cfg := validConfig()
+		cfg.LLM.OpenAI.APIKey = ""
+		cfg.LLM.AllowNone = true
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("sentinel mode needs no Redis host", func(t *testing.T) {
+		cfg := validConfig()
+		cfg.Redis.Host, cfg.Redis.Port = "", 0
+		cfg.Redis.Mode = RedisModeSentinel
+		cfg.Redis.Addrs = []string{"sentinel-1:26379", "sentinel-2:26379"}
+		cfg.Redis.SentinelMasterName = "mymaster"
+		assert.NoError(t, cfg.Validate())
+	})
+
+	t.Run("Ollama counts as a provider", func(t *testing.T) {
+		cfg := validConfig()
+		cfg.LLM.OpenAI.APIKey = ""
+		cfg.LLM.Ollama.Host = "http://ollama:11434"
+		assert.NoError(t, cfg.Validate())
+	})
+}
+
+func TestConfig_ValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Auth.JWTSecret = ""
+	cfg.Database.Host = ""
+	cfg.Redis.Host = ""
+
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Equal(t, "invalid configuration:\n"+
+		"  - JWT_SECRET (auth.jwt_secret) is required; it signs tokens and encrypts stored credentials\n"+
+		"  - POSTGRES_HOST (database.host) is required\n"+
+		"  - REDIS_HOST (redis.host) is required", err.Error())
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +17,13 @@ const (
 	DatabaseTypeMySQL      DatabaseType = "mysql"
 	DatabaseTypeSQLite     DatabaseType = "sqlite"
 	DatabaseTypeSQLServer  DatabaseType = "sqlserver"
+	DatabaseTypeMongoDB    DatabaseType = "mongodb"
+)
+
+// What a connection's read replica serves
+const (
+	ReplicaUseQueries = "queries" // queries on the replica, schema introspection on the primary
+	ReplicaUseSchema  = "schema"  // schema introspection on the replica, queries on the primary
 )
 
 // WorkspaceRepository defines the interface for workspace storage
@@ -24,9 +32,13 @@ type WorkspaceRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*Workspace, error)
 	Update(ctx context.Context, id uuid.UUID, update *WorkspaceUpdate) error
 	AddMember(ctx context.Context, member *WorkspaceMember) error
+	UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error
 	GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*WorkspaceMember, error)
 	IsMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error)
 	ListByUserID(ctx context.Context, userID uuid.UUID) ([]Workspace, error)
+	ListAll(ctx context.Context, limit, offset int) ([]WorkspaceSummary, int, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	RemoveMember(ctx context.Context, workspaceID, userID uuid.UUID) error
 }
 
 // Connection represents a database connection configuration
@@ -44,53 +56,194 @@ type Connection struct {
 	ReadOnly             bool         `json:"read_only"`
 	MaxRows              int          `json:"max_rows"`
 	TimeoutSeconds       int          `json:"timeout_seconds"`
-	CreatedAt            time.Time    `json:"created_at"`
-	UpdatedAt            time.Time    `json:"updated_at"`
+	// SchemaCacheTTLSeconds overrides SCHEMA_CACHE_TTL for this connection; 0 disables caching
+	SchemaCacheTTLSeconds *int `json:"schema_cache_ttl_seconds,omitempty"`
+	// MaxEstimatedRows overrides MAX_ESTIMATED_ROWS for this connection; 0 disables the cost gate
+	MaxEstimatedRows *int64 `json:"max_estimated_rows,omitempty"`
+	// ErrorRateThreshold overrides CONNECTION_ALERT_ERROR_RATE for this connection; 0
+	// disables the degraded alert
+	ErrorRateThreshold *float64 `json:"error_rate_threshold,omitempty"`
+	// DefaultLimit overrides DEFAULT_LIMIT for this connection; 0 limits queries without
+	// a LIMIT to MaxRows
+	DefaultLimit *int `json:"default_limit,omitempty"`
+	// SchemaOrder is how tables are ordered in the schema given to the LLM: size,
+	// alphabetical or recent. Truncated schemas keep the first tables.
+	SchemaOrder string `json:"schema_order"`
+	// ReplicaHost and ReplicaPort name a read replica of a Postgres or MySQL database,
+	// empty without one; ReplicaPort 0 means Port. ReplicaUse says whether it serves
+	// queries or schema introspection; the primary serves the other, and both while
+	// the replica is down.
+	ReplicaHost string    `json:"replica_host,omitempty"`
+	ReplicaPort int       `json:"replica_port,omitempty"`
+	ReplicaUse  string    `json:"replica_use"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // ConnectionCreate represents connection creation data
 type ConnectionCreate struct {
-	Name           string       `json:"name" validate:"required,max=255"`
-	DatabaseType   DatabaseType `json:"database_type" validate:"required,oneof=postgres clickhouse mysql sqlite sqlserver"`
-	Host           string       `json:"host" validate:"required,max=255"`
-	Port           int          `json:"port" validate:"required,min=1,max=65535"`
-	Database       string       `json:"database" validate:"required,max=255"`
-	Username       string       `json:"username" validate:"required,max=255"`
-	Password       string       `json:"password" validate:"required"`
-	SSLMode        string       `json:"ssl_mode" validate:"omitempty,oneof=disable require verify-ca verify-full"`
-	ReadOnly       bool         `json:"read_only"`
-	MaxRows        int          `json:"max_rows" validate:"omitempty,min=1,max=10000"`
-	TimeoutSeconds int          `json:"timeout_seconds" validate:"omitempty,min=1,max=300"`
+	Name                  string       `json:"name" validate:"required,max=255"`
+	DatabaseType          DatabaseType `json:"database_type" validate:"required,oneof=postgres clickhouse mysql sqlite sqlserver mongodb"`
+	Host                  string       `json:"host" validate:"required,max=255"`
+	Port                  int          `json:"port" validate:"required,min=1,max=65535"`
+	Database              string       `json:"database" validate:"required,max=255"`
+	Username              string       `json:"username" validate:"required,max=255"`
+	Password              string       `json:"password" validate:"required"`
+	SSLMode               string       `json:"ssl_mode" validate:"omitempty,oneof=disable require verify-ca verify-full"`
+	ReadOnly              bool         `json:"read_only"`
+	MaxRows               int          `json:"max_rows" validate:"omitempty,min=1,max=10000"`
+	TimeoutSeconds        int          `json:"timeout_seconds" validate:"omitempty,min=1,max=300"`
+	SchemaCacheTTLSeconds *int         `json:"schema_cache_ttl_seconds,omitempty" validate:"omitempty,min=0,max=604800"`
+	MaxEstimatedRows      *int64       `json:"max_estimated_rows,omitempty" validate:"omitempty,min=0"`
+	ErrorRateThreshold    *float64     `json:"error_rate_threshold,omitempty" validate:"omitempty,min=0,max=1"`
+	DefaultLimit          *int         `json:"default_limit,omitempty" validate:"omitempty,min=0,max=10000"`
+	SchemaOrder           string       `json:"schema_order,omitempty" validate:"omitempty,oneof=size alphabetical recent"`
+	ReplicaHost           string       `json:"replica_host,omitempty" validate:"omitempty,max=255"`
+	ReplicaPort           int          `json:"replica_port,omitempty" validate:"omitempty,min=1,max=65535"`
+	ReplicaUse            string       `json:"replica_use,omitempty" validate:"omitempty,oneof=queries schema"`
+	// Validate connects to the database before the connection is saved; nil means true
+	Validate *bool `json:"validate,omitempty"`
+}
+
+// ShouldValidate reports whether the connection must be reachable to be created
+func (c ConnectionCreate) ShouldValidate() bool {
+	return c.Validate == nil || *c.Validate
 }
 
 // ConnectionUpdate represents connection update data
 type ConnectionUpdate struct {
-	Name           *string `json:"name,omitempty" validate:"omitempty,max=255"`
-	Host           *string `json:"host,omitempty" validate:"omitempty,max=255"`
-	Port           *int    `json:"port,omitempty" validate:"omitempty,min=1,max=65535"`
-	Database       *string `json:"database,omitempty" validate:"omitempty,max=255"`
-	Username       *string `json:"username,omitempty" validate:"omitempty,max=255"`
-	Password       *string `json:"password,omitempty"`
-	SSLMode        *string `json:"ssl_mode,omitempty" validate:"omitempty,oneof=disable require verify-ca verify-full"`
-	ReadOnly       *bool   `json:"read_only,omitempty"`
-	MaxRows        *int    `json:"max_rows,omitempty" validate:"omitempty,min=1,max=10000"`
-	TimeoutSeconds *int    `json:"timeout_seconds,omitempty" validate:"omitempty,min=1,max=300"`
+	Name               *string  `json:"name,omitempty" validate:"omitempty,max=255"`
+	Host               *string  `json:"host,omitempty" validate:"omitempty,max=255"`
+	Port               *int     `json:"port,omitempty" validate:"omitempty,min=1,max=65535"`
+	Database           *string  `json:"database,omitempty" validate:"omitempty,max=255"`
+	Username           *string  `json:"username,omitempty" validate:"omitempty,max=255"`
+	Password           *string  `json:"password,omitempty"`
+	SSLMode            *string  `json:"ssl_mode,omitempty" validate:"omitempty,oneof=disable require verify-ca verify-full"`
+	ReadOnly           *bool    `json:"read_only,omitempty"`
+	MaxRows            *int     `json:"max_rows,omitempty" validate:"omitempty,min=1,max=10000"`
+	TimeoutSeconds     *int     `json:"timeout_seconds,omitempty" validate:"omitempty,min=1,max=300"`
+	MaxEstimatedRows   *int64   `json:"max_estimated_rows,omitempty" validate:"omitempty,min=0"`
+	ErrorRateThreshold *float64 `json:"error_rate_threshold,omitempty" validate:"omitempty,min=0,max=1"`
+	DefaultLimit       *int     `json:"default_limit,omitempty" validate:"omitempty,min=0,max=10000"`
+	SchemaOrder        *string  `json:"schema_order,omitempty" validate:"omitempty,oneof=size alphabetical recent"`
+	// ReplicaHost "" removes the replica
+	ReplicaHost *string `json:"replica_host,omitempty" validate:"omitempty,max=255"`
+	ReplicaPort *int    `json:"replica_port,omitempty" validate:"omitempty,min=0,max=65535"`
+	ReplicaUse  *string `json:"replica_use,omitempty" validate:"omitempty,oneof=queries schema"`
+	// SchemaCacheTTLSeconds null restores the server's schema cache TTL
+	SchemaCacheTTLSeconds NullableInt `json:"schema_cache_ttl_seconds"`
+}
+
+// MaxSchemaCacheTTLSeconds is the longest schema cache TTL a connection can set, a week
+const MaxSchemaCacheTTLSeconds = 604800
+
+// NullableInt is an integer field of an update that can also be set to null, telling
+// an absent field apart from an explicit null
+type NullableInt struct {
+	Set   bool // the field was present
+	Value *int // nil for null
+}
+
+// UnmarshalJSON marks the field set and reads its value, nil for null
+func (n *NullableInt) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	return json.Unmarshal(data, &n.Value)
+}
+
+// ConnectionCredentialsUpdate replaces the password of a connection
+type ConnectionCredentialsUpdate struct {
+	Password string `json:"password" validate:"required"`
 }
 
 // ConnectionInfo represents connection info without sensitive data
 type ConnectionInfo struct {
-	ID           uuid.UUID    `json:"id"`
-	WorkspaceID  uuid.UUID    `json:"workspace_id"`
-	Name         string       `json:"name"`
-	DatabaseType DatabaseType `json:"database_type"`
-	Host         string       `json:"host"`
-	Port         int          `json:"port"`
-	Database     string       `json:"database"`
-	Username     string       `json:"username"`
-	SSLMode      string       `json:"ssl_mode"`
-	ReadOnly     bool         `json:"read_only"`
-	MaxRows      int          `json:"max_rows"`
-	CreatedAt    time.Time    `json:"created_at"`
+	ID                    uuid.UUID    `json:"id"`
+	WorkspaceID           uuid.UUID    `json:"workspace_id"`
+	Name                  string       `json:"name"`
+	DatabaseType          DatabaseType `json:"database_type"`
+	Host                  string       `json:"host"`
+	Port                  int          `json:"port"`
+	Database              string       `json:"database"`
+	Username              string       `json:"username"`
+	SSLMode               string       `json:"ssl_mode"`
+	ReadOnly              bool         `json:"read_only"`
+	MaxRows               int          `json:"max_rows"`
+	SchemaCacheTTLSeconds *int         `json:"schema_cache_ttl_seconds,omitempty"`
+	MaxEstimatedRows      *int64       `json:"max_estimated_rows,omitempty"`
+	ErrorRateThreshold    *float64     `json:"error_rate_threshold,omitempty"`
+	DefaultLimit          *int         `json:"default_limit,omitempty"`
+	SchemaOrder           string       `json:"schema_order"`
+	ReplicaHost           string       `json:"replica_host,omitempty"`
+	ReplicaPort           int          `json:"replica_port,omitempty"`
+	ReplicaUse            string       `json:"replica_use"`
+	CreatedAt             time.Time    `json:"created_at"`
+
+	// Degraded is set while most recent queries on the connection fail
+	Degraded      bool       `json:"degraded"`
+	DegradedSince *time.Time `json:"degraded_since,omitempty"`
+
+	// Set on create when the connection was validated before it was saved
+	Validated  bool `json:"validated,omitempty"`
+	TableCount *int `json:"table_count,omitempty"`
+}
+
+// PoolStats is a snapshot of a database connection pool
+type PoolStats struct {
+	MaxConns      int32 `json:"max_conns"`
+	TotalConns    int32 `json:"total_conns"`
+	AcquiredConns int32 `json:"acquired_conns"` // in use
+	IdleConns     int32 `json:"idle_conns"`
+	// WaitCount is the number of times a caller had to wait for a free connection
+	WaitCount int64 `json:"wait_count"`
+	// WaitMs is the total time callers spent acquiring connections
+	WaitMs int64 `json:"wait_ms"`
+}
+
+// ConnectionHealth reports whether a saved connection's database answers, and the
+// state of the connection pool kept for it
+type ConnectionHealth struct {
+	ConnectionID uuid.UUID  `json:"connection_id"`
+	Healthy      bool       `json:"healthy"`
+	Error        string     `json:"error,omitempty"`
+	LatencyMs    int64      `json:"latency_ms"`
+	Pool         *PoolStats `json:"pool,omitempty"` // absent for databases without a pool, such as MongoDB
+
+	// Degraded is set while most recent queries on the connection fail, even when
+	// the database answers the health check
+	Degraded      bool       `json:"degraded"`
+	DegradedSince *time.Time `json:"degraded_since,omitempty"`
+}
+
+// EndpointTest is the outcome of connecting to one endpoint of a connection
+type EndpointTest struct {
+	Connected bool   `json:"connected"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ConnectionTest reports the primary of a tested connection and its read replica,
+// if it has one
+type ConnectionTest struct {
+	Primary EndpointTest  `json:"primary"`
+	Replica *EndpointTest `json:"replica,omitempty"`
+}
+
+// ConnectionErrorRate counts the outcomes of a connection's recent queries
+type ConnectionErrorRate struct {
+	Queries int `json:"queries"`
+	Errors  int `json:"errors"`
+}
+
+// Rate returns the share of the queries that failed
+func (r ConnectionErrorRate) Rate() float64 {
+	if r.Queries == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Queries)
 }
 
 // ConnectionRepository defines the interface for connection storage
@@ -106,17 +259,25 @@ type ConnectionRepository interface {
 // ToInfo converts Connection to ConnectionInfo (without sensitive data)
 func (c *Connection) ToInfo() ConnectionInfo {
 	return ConnectionInfo{
-		ID:           c.ID,
-		WorkspaceID:  c.WorkspaceID,
-		Name:         c.Name,
-		DatabaseType: c.DatabaseType,
-		Host:         c.Host,
-		Port:         c.Port,
-		Database:     c.Database,
-		Username:     c.Username,
-		SSLMode:      c.SSLMode,
-		ReadOnly:     c.ReadOnly,
-		MaxRows:      c.MaxRows,
-		CreatedAt:    c.CreatedAt,
+		ID:                    c.ID,
+		WorkspaceID:           c.WorkspaceID,
+		Name:                  c.Name,
+		DatabaseType:          c.DatabaseType,
+		Host:                  c.Host,
+		Port:                  c.Port,
+		Database:              c.Database,
+		Username:              c.Username,
+		SSLMode:               c.SSLMode,
+		ReadOnly:              c.ReadOnly,
+		MaxRows:               c.MaxRows,
+		SchemaCacheTTLSeconds: c.SchemaCacheTTLSeconds,
+		MaxEstimatedRows:      c.MaxEstimatedRows,
+		ErrorRateThreshold:    c.ErrorRateThreshold,
+		DefaultLimit:          c.DefaultLimit,
+		SchemaOrder:           c.SchemaOrder,
+		ReplicaHost:           c.ReplicaHost,
+		ReplicaPort:           c.ReplicaPort,
+		ReplicaUse:            c.ReplicaUse,
+		CreatedAt:             c.CreatedAt,
 	}
 }
@@ -0,0 +1,149 @@
+package domain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// How an experiment assigns requests to arms
+const (
+	ExperimentAssignByUser     = "user"     // a user always gets the same arm
+	ExperimentAssignByQuestion = "question" // a question always gets the same arm, whoever asks it
+)
+
+// experimentNamePattern matches experiment, arm and prompt variant names
+var experimentNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// Experiment compares LLM providers, models or prompt templates on a workspace's live
+// traffic. Questions that name no provider or model are split between the arms by
+// weight; the arm is recorded with each answer so the arms can be compared.
+type Experiment struct {
+	Name     string          `json:"name"`
+	Enabled  bool            `json:"enabled"`
+	AssignBy string          `json:"assign_by"` // one of the ExperimentAssignBy values
+	Arms     []ExperimentArm `json:"arms"`
+}
+
+// ExperimentArm is one of the variants an experiment compares
+type ExperimentArm struct {
+	Name     string `json:"name"`
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"` // the provider's default model when empty
+	// PromptVariant picks the prompt templates named <template>.<variant>.tmpl in the
+	// prompt template directory; the regular templates are used when empty or missing
+	PromptVariant string `json:"prompt_variant,omitempty"`
+	Weight        int    `json:"weight"` // share of the traffic relative to the other arms
+}
+
+// ExperimentAssignment is the arm an answer was given by
+type ExperimentAssignment struct {
+	Experiment string `json:"experiment"`
+	Arm        string `json:"arm"`
+}
+
+// Validate checks the experiment against the workspace's provider allowlist
+func (e *Experiment) Validate(settings WorkspaceSettings) error {
+	if !experimentNamePattern.MatchString(e.Name) {
+		return fmt.Errorf("invalid settings: experiment name must be lowercase letters, digits, - or _")
+	}
+	if e.AssignBy != ExperimentAssignByUser && e.AssignBy != ExperimentAssignByQuestion {
+		return fmt.Errorf("invalid settings: experiment assign_by must be user or question")
+	}
+	if len(e.Arms) < 2 {
+		return fmt.Errorf("invalid settings: experiment needs at least two arms")
+	}
+	seen := map[string]bool{}
+	for _, arm := range e.Arms {
+		if !experimentNamePattern.MatchString(arm.Name) {
+			return fmt.Errorf("invalid settings: experiment arm name %q must be lowercase letters, digits, - or _", arm.Name)
+		}
+		if seen[arm.Name] {
+			return fmt.Errorf("invalid settings: duplicate experiment arm %q", arm.Name)
+		}
+		seen[arm.Name] = true
+		if !slices.Contains(LLMProviders, arm.Provider) {
+			return fmt.Errorf("invalid settings: unknown llm provider %q in experiment arm %s", arm.Provider, arm.Name)
+		}
+		if !settings.AllowsProvider(arm.Provider) {
+			return fmt.Errorf("invalid settings: llm provider %q of experiment arm %s is not in llm_provider_allowlist", arm.Provider, arm.Name)
+		}
+		if arm.PromptVariant != "" && !experimentNamePattern.MatchString(arm.PromptVariant) {
+			return fmt.Errorf("invalid settings: prompt_variant of experiment arm %s must be lowercase letters, digits, - or _", arm.Name)
+		}
+		if arm.Weight <= 0 {
+			return fmt.Errorf("invalid settings: weight of experiment arm %s must be positive", arm.Name)
+		}
+	}
+	return nil
+}
+
+// Assign returns the arm for key, the user ID or the question depending on AssignBy.
+// The same key always gets the same arm while the arms and weights stay unchanged,
+// and keys spread over the arms in proportion to their weights.
+func (e *Experiment) Assign(key string) ExperimentArm {
+	total := 0
+	for _, arm := range e.Arms {
+		total += arm.Weight
+	}
+	// The experiment name is hashed in, so keys are reshuffled between experiments
+	sum := sha256.Sum256([]byte(e.Name + "\x00" + key))
+	bucket := int(binary.BigEndian.Uint64(sum[:8]) % uint64(total))
+	for _, arm := range e.Arms {
+		if bucket < arm.Weight {
+			return arm
+		}
+		bucket -= arm.Weight
+	}
+	return e.Arms[len(e.Arms)-1]
+}
+
+// AssignmentKey returns the key a request is assigned by
+func (e *Experiment) AssignmentKey(userID uuid.UUID, question string) string {
+	if e.AssignBy == ExperimentAssignByQuestion {
+		return strings.Join(strings.Fields(strings.ToLower(question)), " ")
+	}
+	return userID.String()
+}
+
+// ExperimentArmCount is the number of answers of one arm with one status
+type ExperimentArmCount struct {
+	Arm            string
+	Status         QueryStatus
+	Count          int
+	TotalLatencyMs int64
+	LatencyCount   int // answers that recorded a latency
+	TotalTokens    int64
+}
+
+// ExperimentResults compares the arms of an experiment since a point in time
+type ExperimentResults struct {
+	Experiment string                `json:"experiment"`
+	Since      time.Time             `json:"since"`
+	Arms       []ExperimentArmResult `json:"arms"`
+}
+
+// ExperimentArmResult summarizes the answers given by one arm
+type ExperimentArmResult struct {
+	Arm          string              `json:"arm"`
+	Total        int                 `json:"total"`
+	ByStatus     map[QueryStatus]int `json:"by_status"`
+	SuccessRate  float64             `json:"success_rate"` // share of answers with status ok
+	AvgLatencyMs int64               `json:"avg_latency_ms"`
+	TotalTokens  int64               `json:"total_tokens"`
+	AvgTokens    int64               `json:"avg_tokens"`
+}
+
+// ExperimentRepository counts the answers recorded by experiments
+type ExperimentRepository interface {
+	// CountByArm counts the answers given in a workspace by the arms of an experiment
+	// since the given time, grouped by arm and status
+	CountByArm(ctx context.Context, workspaceID uuid.UUID, experiment string, since time.Time) ([]ExperimentArmCount, error)
+}
@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func testExperiment(weights ...int) *Experiment {
+	exp := &Experiment{Name: "providers", Enabled: true, AssignBy: ExperimentAssignByUser}
+	for i, w := range weights {
+		exp.Arms = append(exp.Arms, ExperimentArm{Name: fmt.Sprintf("arm-%d", i), Provider: "openai", Weight: w})
+	}
+	return exp
+}
+
+func TestExperiment_Assign(t *testing.T) {
+	t.Run("split follows the weights", func(t *testing.T) {
+		for _, weights := range [][]int{{1, 1}, {9, 1}, {50, 30, 20}} {
+			exp := testExperiment(weights...)
+			total := 0
+			for _, w := range weights {
+				total += w
+			}
+
+			const keys = 20000
+			counts := map[string]int{}
+			for i := range keys {
+				counts[exp.Assign(fmt.Sprintf("user-%d", i)).Name]++
+			}
+			for i, w := range weights {
+				want := float64(w) / float64(total)
+				got := float64(counts[fmt.Sprintf("arm-%d", i)]) / keys
+				assert.InDelta(t, want, got, 0.02, "weights %v, arm %d", weights, i)
+			}
+		}
+	})
+
+	t.Run("deterministic", func(t *testing.T) {
+		exp := testExperiment(1, 1, 1)
+		for i := range 100 {
+			key := uuid.NewString()
+			first := exp.Assign(key)
+			assert.Equal(t, first, exp.Assign(key), "key %d", i)
+		}
+	})
+
+	t.Run("experiments shuffle keys independently", func(t *testing.T) {
+		a, b := testExperiment(1, 1), testExperiment(1, 1)
+		b.Name = "prompts"
+		same := 0
+		for i := range 1000 {
+			key := fmt.Sprintf("user-%d", i)
+			if a.Assign(key).Name == b.Assign(key).Name {
+				same++
+			}
+		}
+		assert.InDelta(t, 500, same, 75)
+	})
+}
+
+func TestExperiment_AssignmentKey(t *testing.T) {
+	userID := uuid.New()
+	exp := testExperiment(1, 1)
+	assert.Equal(t, userID.String(), exp.AssignmentKey(userID, "How many users?"))
+
+	exp.AssignBy = ExperimentAssignByQuestion
+	assert.Equal(t, "how many users?", exp.AssignmentKey(userID, "  How   many users? "))
+	assert.Equal(t, exp.AssignmentKey(uuid.New(), "how many users?"), exp.AssignmentKey(userID, "HOW MANY USERS?"))
+}
+
+func TestExperiment_Validate(t *testing.T) {
+	assert.NoError(t, testExperiment(1, 1).Validate(WorkspaceSettings{}))
+
+	tests := []struct {
+		name     string
+		edit     func(*Experiment)
+		settings WorkspaceSettings
+		wantErr  string
+	}{
+		{name: "bad name", edit: func(e *Experiment) { e.Name = "My Test" }, wantErr: "experiment name"},
+		{name: "bad assign_by", edit: func(e *Experiment) { e.AssignBy = "session" }, wantErr: "assign_by"},
+		{name: "one arm", edit: func(e *Experiment) { e.Arms = e.Arms[:1] }, wantErr: "at least two arms"},
+		{name: "duplicate arm", edit: func(e *Experiment) { e.Arms[1].Name = e.Arms[0].Name }, wantErr: "duplicate experiment arm"},
+		{name: "unknown provider", edit: func(e *Experiment) { e.Arms[1].Provider = "acme" }, wantErr: "unknown llm provider"},
+		{
+			name:     "provider not allowed",
+			edit:     func(e *Experiment) { e.Arms[1].Provider = "anthropic" },
+			settings: WorkspaceSettings{LLMProviderAllowlist: []string{"openai"}},
+			wantErr:  "not in llm_provider_allowlist",
+		},
+		{name: "bad prompt variant", edit: func(e *Experiment) { e.Arms[0].PromptVariant = "../x" }, wantErr: "prompt_variant"},
+		{name: "zero weight", edit: func(e *Experiment) { e.Arms[0].Weight = 0 }, wantErr: "must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := testExperiment(1, 1)
+			tt.edit(exp)
+			assert.ErrorContains(t, exp.Validate(tt.settings), tt.wantErr)
+		})
+	}
+}
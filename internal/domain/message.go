@@ -15,24 +15,105 @@ const (
 	RoleAssistant MessageRole = "assistant"
 )
 
+// QueryStatus is the outcome of an assistant answer
+type QueryStatus string
+
+const (
+	QueryStatusOK       QueryStatus = "ok"
+	QueryStatusSQLError QueryStatus = "sql_error" // the database rejected the query or could not be reached
+	QueryStatusLLMError QueryStatus = "llm_error"
+	QueryStatusBlocked  QueryStatus = "blocked" // the generated SQL failed safety validation
+	QueryStatusTimeout  QueryStatus = "timeout"
+	// QueryStatusExplained marks an explanation of SQL written elsewhere, which is not
+	// an answer and is left out of answer counts and suggestions
+	QueryStatusExplained QueryStatus = "explained"
+)
+
+// Failed reports whether an answer with the status failed
+func (s QueryStatus) Failed() bool {
+	return s != "" && s != QueryStatusOK && s != QueryStatusExplained
+}
+
 // Message represents a chat message in a workspace
 type Message struct {
-	ID          uuid.UUID   `json:"id"`
-	WorkspaceID uuid.UUID   `json:"workspace_id"`
-	UserID      *uuid.UUID  `json:"user_id,omitempty"` // Null for assistant messages
-	SessionID   *uuid.UUID  `json:"session_id,omitempty"`
-	Role        MessageRole `json:"role"`
-	Content     string      `json:"content"`
-	SQL         string      `json:"sql,omitempty"`
-	Result      any         `json:"result,omitempty"`
-	Metadata    any         `json:"metadata,omitempty"`
-	CreatedAt   time.Time   `json:"created_at"`
+	ID          uuid.UUID      `json:"id"`
+	WorkspaceID uuid.UUID      `json:"workspace_id"`
+	UserID      *uuid.UUID     `json:"user_id,omitempty"` // Null for assistant messages
+	SessionID   *uuid.UUID     `json:"session_id,omitempty"`
+	Role        MessageRole    `json:"role"`
+	Content     string         `json:"content"`
+	SQL         string         `json:"sql,omitempty"`
+	Result      *QueryResult   `json:"result,omitempty"`
+	Metadata    *QueryMetadata `json:"metadata,omitempty"`
+	Error       string         `json:"error,omitempty"`     // why an assistant answer failed
+	Status      QueryStatus    `json:"status,omitempty"`    // set on assistant messages
+	RowCount    *int           `json:"row_count,omitempty"` // set when the query was executed
+	LatencyMs   *int64         `json:"latency_ms,omitempty"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// ConversationTurn is a question and its answer, written together with the session update
+type ConversationTurn struct {
+	NewSession       *ChatSession // created in the same transaction when set
+	SessionID        uuid.UUID
+	UserMessage      *Message
+	AssistantMessage *Message
+	Title            string     // replaces the session title while it is still DefaultSessionTitle
+	ConnectionID     *uuid.UUID // becomes the session's connection when it has none
+	SwitchConnection bool       // ConnectionID replaces the session's connection
+}
+
+// FrequentQuestionFilter narrows the questions considered by GetMostFrequentQuestions
+type FrequentQuestionFilter struct {
+	ConnectionID *uuid.UUID // only questions answered against this connection
+	MinLength    int        // minimum normalized length in characters
+	MinCount     int        // minimum number of times the question was asked
+	Limit        int
+}
+
+// QueryStatusCount is the number of answers with one status, provider and connection
+type QueryStatusCount struct {
+	Status         QueryStatus
+	LLMProvider    string
+	ConnectionID   *uuid.UUID
+	ConnectionName string
+	Count          int
+	TotalLatencyMs int64
+	LatencyCount   int // answers that recorded a latency
+}
+
+// QueryStats summarizes the answers given in a workspace since a point in time
+type QueryStats struct {
+	Since        time.Time           `json:"since"`
+	Total        int                 `json:"total"`
+	ByStatus     map[QueryStatus]int `json:"by_status"`
+	ByProvider   []QueryStatsGroup   `json:"by_provider"`
+	ByConnection []QueryStatsGroup   `json:"by_connection"`
+}
+
+// QueryStatsGroup breaks down the answers of one provider or connection by status
+type QueryStatsGroup struct {
+	Key          string              `json:"key"`
+	Name         string              `json:"name,omitempty"`
+	Total        int                 `json:"total"`
+	ByStatus     map[QueryStatus]int `json:"by_status"`
+	AvgLatencyMs int64               `json:"avg_latency_ms"`
 }
 
 // MessageRepository defines the interface for message storage
 type MessageRepository interface {
 	Create(ctx context.Context, message *Message) error
+	CreateConversationTurn(ctx context.Context, turn *ConversationTurn) error
 	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]Message, error)
 	ListBySession(ctx context.Context, sessionID uuid.UUID, limit int) ([]Message, error)
-	GetMostFrequentQuestions(ctx context.Context, workspaceID uuid.UUID, limit int) ([]string, error)
+	// GetByIDAndWorkspace retrieves a message of a workspace, or nil if there is none
+	GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*Message, error)
+	// GetQuestion returns the question an assistant message answered: the latest user
+	// message before it in its session, or "" if there is none
+	GetQuestion(ctx context.Context, answer *Message) (string, error)
+	GetMostFrequentQuestions(ctx context.Context, workspaceID uuid.UUID, filter FrequentQuestionFilter) ([]string, error)
+	CountByStatus(ctx context.Context, workspaceID uuid.UUID, since time.Time) ([]QueryStatusCount, error)
+	// ListRecentSQL returns the SQL of the latest successful answers on a connection,
+	// most recent first
+	ListRecentSQL(ctx context.Context, workspaceID, connectionID uuid.UUID, limit int) ([]string, error)
 }
@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification types. Workspace events share their name with the webhook event.
+const (
+	NotificationSchemaDestructive   = WebhookEventSchemaDestructive
+	NotificationSchemaRefreshFailed = WebhookEventSchemaRefreshFailed
+	NotificationConnectionDegraded  = WebhookEventConnectionDegraded
+	NotificationConnectionRecovered = WebhookEventConnectionRecovered
+	NotificationQuotaWarning        = "quota.warning" // a daily LLM quota is nearly used up
+)
+
+// NotificationTypes lists the types a user can turn off
+var NotificationTypes = []string{
+	NotificationSchemaDestructive,
+	NotificationSchemaRefreshFailed,
+	NotificationConnectionDegraded,
+	NotificationConnectionRecovered,
+	NotificationQuotaWarning,
+}
+
+// IsNotificationType reports whether t is a known notification type
+func IsNotificationType(t string) bool {
+	return slices.Contains(NotificationTypes, t)
+}
+
+// Notification is an event shown to a user in the app
+type Notification struct {
+	ID          uuid.UUID       `json:"id"`
+	UserID      uuid.UUID       `json:"user_id"`
+	WorkspaceID *uuid.UUID      `json:"workspace_id,omitempty"`
+	Type        string          `json:"type"`
+	Payload     json.RawMessage `json:"payload"`
+	ReadAt      *time.Time      `json:"read_at,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// NotificationFilter selects the notifications of a user
+type NotificationFilter struct {
+	UnreadOnly bool
+	Limit      int
+}
+
+// NotificationRepository stores notifications. Recipients who turned a type off get
+// none of it.
+type NotificationRepository interface {
+	// CreateForUser adds a notification for one user, returning nil if they turned
+	// its type off
+	CreateForUser(ctx context.Context, userID uuid.UUID, workspaceID *uuid.UUID, notificationType string, payload json.RawMessage) (*Notification, error)
+	// CreateForWorkspace adds a notification for each active member of a workspace
+	CreateForWorkspace(ctx context.Context, workspaceID uuid.UUID, notificationType string, payload json.RawMessage) ([]Notification, error)
+	// ListByUser returns a user's notifications, newest first
+	ListByUser(ctx context.Context, userID uuid.UUID, filter NotificationFilter) ([]Notification, error)
+	// MarkRead marks a notification of a user read, returning false if they have no
+	// such notification
+	MarkRead(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error)
+}
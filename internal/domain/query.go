@@ -1,6 +1,10 @@
 package domain
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,31 +12,191 @@ import (
 
 // QueryRequest represents a text-to-SQL query request
 type QueryRequest struct {
-	ConnectionID uuid.UUID     `json:"connection_id" validate:"required"`
-	SessionID    uuid.UUID     `json:"session_id,omitempty"`
-	Question     string        `json:"question" validate:"required,max=2000"`
-	LLMProvider  string        `json:"llm_provider" validate:"omitempty,oneof=openai anthropic ollama deepseek gemini"`
-	LLMModel     string        `json:"llm_model,omitempty"`
-	Execute      bool          `json:"execute"`
-	Options      *QueryOptions `json:"options,omitempty"`
+	ConnectionID uuid.UUID `json:"connection_id"` // defaults to the session's connection
+	SessionID    uuid.UUID `json:"session_id,omitempty"`
+	// SwitchConnection allows asking a session's follow-up against another connection
+	SwitchConnection bool          `json:"switch_connection,omitempty"`
+	Question         string        `json:"question" validate:"required,max=2000"`
+	LLMProvider      string        `json:"llm_provider"` // checked against the registered providers by the query service
+	LLMModel         string        `json:"llm_model,omitempty"`
+	Execute          bool          `json:"execute"`
+	Force            bool          `json:"force,omitempty"` // run SQL the cost gate would refuse
+	Options          *QueryOptions `json:"options,omitempty"`
+	// Persist records the question and answer in a session; nil is true for /query and
+	// false for /generate
+	Persist *bool `json:"persist,omitempty"`
+}
+
+// Persisted reports whether the question and answer are recorded in a session
+func (r QueryRequest) Persisted() bool {
+	return r.Persist == nil || *r.Persist
 }
 
 // QueryOptions represents optional query parameters
 type QueryOptions struct {
-	MaxRows        int `json:"max_rows" validate:"omitempty,min=1,max=10000"`
-	TimeoutSeconds int `json:"timeout_seconds" validate:"omitempty,min=1,max=300"`
+	MaxRows           int `json:"max_rows" validate:"omitempty,min=1,max=10000"`
+	DefaultLimit      int `json:"default_limit,omitempty" validate:"omitempty,min=1,max=10000"` // rows of SQL without a LIMIT
+	TimeoutSeconds    int `json:"timeout_seconds" validate:"omitempty,min=1,max=300"`
+	LLMTimeoutSeconds int `json:"llm_timeout_seconds" validate:"omitempty,min=1,max=300"` // SQL generation
+	// History chooses the earlier turns of the session given to the LLM, HistorySuccessful by default
+	History string `json:"history,omitempty" validate:"omitempty,oneof=successful all none"`
 }
 
+// History modes choose which earlier turns of a session are given to the LLM
+const (
+	// HistorySuccessful gives the turns that succeeded, and the latest turn even when it
+	// failed, so a follow-up to a failed question keeps its context
+	HistorySuccessful = "successful"
+	// HistoryAll gives every turn, for debugging what the model saw
+	HistoryAll  = "all"
+	HistoryNone = "none"
+)
+
+// MaxHistoryMessages is the most messages of a session the history is picked from
+const MaxHistoryMessages = 50
+
 // QueryResponse represents query execution result
 type QueryResponse struct {
-	RequestID   string         `json:"request_id"`
-	SessionID   uuid.UUID      `json:"session_id,omitempty"`
-	Question    string         `json:"question"`
-	SQL         string         `json:"sql"`
-	Explanation string         `json:"explanation,omitempty"`
-	Result      *QueryResult   `json:"result,omitempty"`
+	RequestID     string         `json:"request_id"`
+	SessionID     uuid.UUID      `json:"session_id,omitzero"` // omitted when no session was used
+	Question      string         `json:"question"`
+	SQL           string         `json:"sql"`
+	Explanation   string         `json:"explanation,omitempty"`
+	Result        *QueryResult   `json:"result,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	ErrorDetail   *BlockedQuery  `json:"error_detail,omitempty"` // set when the SQL was blocked
+	Metadata      *QueryMetadata `json:"metadata"`
+	NextPageToken string         `json:"next_page_token,omitempty"` // fetches the rows past a truncated result
+}
+
+// MaxAdhocSchemaBytes caps the schema pasted into an ad hoc generation
+const MaxAdhocSchemaBytes = 200_000
+
+// AdhocGenerateRequest asks for SQL against a pasted schema, without a saved connection
+type AdhocGenerateRequest struct {
+	SchemaDDL    string       `json:"schema_ddl" validate:"required"` // at most MaxAdhocSchemaBytes
+	DatabaseType DatabaseType `json:"database_type" validate:"required,oneof=postgres clickhouse mysql sqlite sqlserver mongodb"`
+	Question     string       `json:"question" validate:"required,max=2000"`
+	LLMProvider  string       `json:"llm_provider"`
+	LLMModel     string       `json:"llm_model,omitempty"`
+}
+
+// ExplainSQLRequest asks for a plain-language explanation of SQL written elsewhere
+type ExplainSQLRequest struct {
+	SQL         string    `json:"sql" validate:"required,max=20000"`
+	SessionID   uuid.UUID `json:"session_id,omitempty"` // records the explanation in this session
+	LLMProvider string    `json:"llm_provider"`
+	LLMModel    string    `json:"llm_model,omitempty"`
+}
+
+// ExplainSQLResponse explains SQL without running it
+type ExplainSQLResponse struct {
+	Explanation      string         `json:"explanation"`
+	ReferencedTables []string       `json:"referenced_tables"`
+	Warnings         []string       `json:"warnings"`
+	Metadata         *QueryMetadata `json:"metadata"`
+}
+
+// RerunRequest runs the SQL of an earlier answer again
+type RerunRequest struct {
+	KeyColumn string `json:"key_column,omitempty"` // matches rows by this column instead of by all columns
+	Force     bool   `json:"force,omitempty"`      // run SQL the cost gate would refuse
+}
+
+// RerunResponse holds the stored and the fresh result of an answer's SQL and how
+// they differ
+type RerunResponse struct {
+	MessageID uuid.UUID      `json:"message_id"`
+	SQL       string         `json:"sql"`
+	Previous  *QueryResult   `json:"previous"`
+	Current   *QueryResult   `json:"current"`
+	Diff      *ResultDiff    `json:"diff"`
+	Metadata  *QueryMetadata `json:"metadata"`
+}
+
+// Modes of a result diff
+const (
+	DiffModeRows    = "rows"    // rows were matched one by one
+	DiffModeSummary = "summary" // only row counts and column totals were compared
+)
+
+// Reasons a result diff fell back to DiffModeSummary
+const (
+	DiffReasonTruncated      = "truncated"       // a result was cut at the row limit, so only counts are compared
+	DiffReasonTooManyRows    = "too_many_rows"   // a result has too many rows to match one by one
+	DiffReasonColumnsChanged = "columns_changed" // the SQL now returns other columns
+)
+
+// ResultDiff describes how the result of a query changed between two runs
+type ResultDiff struct {
+	Mode             string        `json:"mode"`
+	Reason           string        `json:"reason,omitempty"`     // set in summary mode
+	KeyColumn        string        `json:"key_column,omitempty"` // set when rows were matched by a key
+	PreviousRowCount int           `json:"previous_row_count"`
+	CurrentRowCount  int           `json:"current_row_count"`
+	Added            [][]any       `json:"added"`
+	Removed          [][]any       `json:"removed"`
+	Changed          []RowChange   `json:"changed"` // rows whose key stayed while other values changed
+	Aggregates       []ValueChange `json:"aggregates"`
+}
+
+// RowChange is a row matched by its key whose other values changed
+type RowChange struct {
+	Key      any   `json:"key"`
+	Previous []any `json:"previous"`
+	Current  []any `json:"current"`
+}
+
+// ValueChange is a numeric value that changed: a column of a single-row result, or
+// the total of a column in summary mode
+type ValueChange struct {
+	Column   string  `json:"column"`
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+}
+
+// BlockedQuery tells which safety rule rejected generated SQL and what matched it
+type BlockedQuery struct {
+	Rule     string `json:"rule"`
+	Matched  string `json:"matched,omitempty"`
+	Position int    `json:"position"` // byte offset of matched in the SQL
+}
+
+// IdempotentQuery is the state of a query request sent with an Idempotency-Key,
+// kept so that retries are answered without running the query again
+type IdempotentQuery struct {
+	Fingerprint string         `json:"fingerprint"` // hash of the request body
+	Done        bool           `json:"done"`
+	Response    *QueryResponse `json:"response,omitempty"`
 	Error       string         `json:"error,omitempty"`
-	Metadata    *QueryMetadata `json:"metadata"`
+	ErrorKind   string         `json:"error_kind,omitempty"`
+}
+
+// QueryPage is the state behind a page token: the SQL of an answer and where its next
+// page starts. It stays on the server so clients cannot change the SQL.
+type QueryPage struct {
+	UserID       uuid.UUID `json:"user_id"`
+	WorkspaceID  uuid.UUID `json:"workspace_id"`
+	ConnectionID uuid.UUID `json:"connection_id"`
+	SQL          string    `json:"sql"`
+	PageSize     int       `json:"page_size"`
+	Offset       int       `json:"offset,omitempty"`
+	// KeyColumn is set when pages follow the primary key the SQL is ordered by
+	KeyColumn  string `json:"key_column,omitempty"`
+	After      int64  `json:"after,omitempty"`
+	Descending bool   `json:"descending,omitempty"`
+}
+
+// QueryPageRequest asks for the page behind a token
+type QueryPageRequest struct {
+	PageToken string `json:"page_token" validate:"required,max=128"`
+}
+
+// QueryPageResponse is a page of the rows of an executed query
+type QueryPageResponse struct {
+	Result        *QueryResult `json:"result"`
+	NextPageToken string       `json:"next_page_token,omitempty"`
 }
 
 // QueryResult contains query execution data
@@ -41,25 +205,165 @@ type QueryResult struct {
 	Rows      [][]any  `json:"rows"`
 	RowCount  int      `json:"row_count"`
 	Truncated bool     `json:"truncated"`
+	// DefaultLimitApplied is set when the SQL had no LIMIT of its own and returned at
+	// most the default limit of rows, which is below the row limit
+	DefaultLimitApplied bool `json:"default_limit_applied,omitempty"`
+	// StoredTruncated is set on results kept with an answer that hold fewer rows than
+	// were returned, RowCount of them; rerunning the answer gets them all again
+	StoredTruncated bool `json:"stored_truncated,omitempty"`
+}
+
+// StoredResultLimit caps the results kept with answers, so large results do not bloat
+// the chat history. Zero fields do not limit.
+type StoredResultLimit struct {
+	MaxRows  int
+	MaxBytes int // of the rows encoded as JSON
+}
+
+// ForStorage returns the result to keep with an answer: r itself when it fits limit,
+// otherwise a copy holding the leading rows that fit, marked StoredTruncated
+func (r *QueryResult) ForStorage(limit StoredResultLimit) *QueryResult {
+	if r == nil {
+		return nil
+	}
+	keep := len(r.Rows)
+	if limit.MaxRows > 0 {
+		keep = min(keep, limit.MaxRows)
+	}
+	if limit.MaxBytes > 0 {
+		size := 2 // the brackets of the rows array
+		for i := range keep {
+			row, err := json.Marshal(r.Rows[i])
+			size += len(row) + 1
+			if err != nil || size > limit.MaxBytes {
+				keep = i
+				break
+			}
+		}
+	}
+	if keep == len(r.Rows) {
+		return r
+	}
+	stored := *r
+	stored.Rows = r.Rows[:keep:keep]
+	stored.StoredTruncated = true
+	return &stored
 }
 
 // QueryMetadata contains query execution metadata
 type QueryMetadata struct {
-	ConnectionID    uuid.UUID `json:"connection_id"`
-	DatabaseType    string    `json:"database_type"`
-	LLMProvider     string    `json:"llm_provider"`
-	LLMModel        string    `json:"llm_model"`
-	ExecutionTimeMs int64     `json:"execution_time_ms"`
-	LLMLatencyMs    int64     `json:"llm_latency_ms"`
-	TokensUsed      int       `json:"tokens_used"`
+	ConnectionID    uuid.UUID     `json:"connection_id,omitzero"` // omitted for ad hoc generations
+	DatabaseType    string        `json:"database_type"`
+	LLMProvider     string        `json:"llm_provider"`
+	LLMModel        string        `json:"llm_model"`
+	ExecutionTimeMs int64         `json:"execution_time_ms"`
+	LLMLatencyMs    int64         `json:"llm_latency_ms"`
+	TokensUsed      int           `json:"tokens_used"`
+	TimeoutPhase    string        `json:"timeout_phase,omitempty"` // set when the query timed out
+	CostEstimate    *CostEstimate `json:"cost_estimate,omitempty"` // set when the cost gate checked the SQL
+	Template        *TemplateRun  `json:"template,omitempty"`      // set when a query template answered
+	Timings         *QueryTimings `json:"timings,omitempty"`       // set for generated queries
+	// PromptTemplate is the name and content hash of the prompt template the LLM was
+	// given, such as "sql-generation@3f2a9c1b7d4e", to compare answers by prompt version
+	PromptTemplate string `json:"prompt_template,omitempty"`
+	// Experiment is the experiment arm that answered, set when the workspace runs one
+	Experiment *ExperimentAssignment `json:"experiment,omitempty"`
+	// PromptBreakdown is the size of each section of the prompt, set once it is built
+	PromptBreakdown *PromptBreakdown `json:"prompt_breakdown,omitempty"`
+}
+
+// PromptBreakdown is the size of each section of a generation prompt. Instructions
+// are the rest: the template's text, the dialect notes and the user's profile.
+type PromptBreakdown struct {
+	Instructions PromptSize `json:"instructions"`
+	Schema       PromptSize `json:"schema"`
+	Examples     PromptSize `json:"examples"`
+	History      PromptSize `json:"history"`
+	Question     PromptSize `json:"question"`
+	Total        PromptSize `json:"total"`
+	// HistoryMessages is the messages of the session given as history, and
+	// HistoryDropped the older ones left out to fit the workspace's history caps
+	HistoryMessages int `json:"history_messages"`
+	HistoryDropped  int `json:"history_dropped,omitempty"`
+}
+
+// PromptSize is the size of prompt text in characters, and in tokens estimated at
+// about four characters a token
+type PromptSize struct {
+	Chars  int `json:"chars"`
+	Tokens int `json:"tokens"`
+}
+
+// LLMQueueStatus is where a request stands in the queue of its LLM provider
+type LLMQueueStatus struct {
+	RequestID   string `json:"request_id"`
+	Provider    string `json:"provider"`
+	State       string `json:"state"`              // queued or running
+	Position    int    `json:"position,omitempty"` // 1 is next in line; unset once running
+	QueueLength int    `json:"queue_length"`
+	// EstimatedWaitMs is the expected time until the request runs when queued, or
+	// until it finishes when running, from the provider's recent latency. It is 0
+	// before the provider answered once.
+	EstimatedWaitMs int64 `json:"estimated_wait_ms"`
+}
+
+// LLMBusy details the error of a request turned away by a full LLM queue
+type LLMBusy struct {
+	Provider     string `json:"provider"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// QueryTimings breaks a query's time down by phase, in milliseconds. Phases that did
+// not run are zero.
+type QueryTimings struct {
+	ConnectMs       int64  `json:"connect_ms"`       // getting a database connection
+	SchemaMs        int64  `json:"schema_ms"`        // reading the schema from a cache or the database
+	PromptMs        int64  `json:"prompt_ms"`        // resolving the provider and building the prompt
+	LLMQueueMs      int64  `json:"llm_queue_ms"`     // waiting for a turn at the model
+	LLMMs           int64  `json:"llm_ms"`           // waiting for the model
+	ValidationMs    int64  `json:"validation_ms"`    // validating the SQL and checking its cost
+	ExecutionMs     int64  `json:"execution_ms"`     // running the SQL
+	SerializationMs int64  `json:"serialization_ms"` // converting the result and its page token
+	SchemaCacheHit  bool   `json:"schema_cache_hit"` // the schema came from Redis or the stored copy
+	SchemaSource    string `json:"schema_source,omitempty"`
+}
+
+// CostEstimate records the planner's estimate for generated SQL and what the cost gate
+// decided on it
+type CostEstimate struct {
+	EstimatedRows float64 `json:"estimated_rows"`
+	EstimatedCost float64 `json:"estimated_cost,omitempty"` // planner cost units, Postgres only
+	MaxRows       int64   `json:"max_rows"`                 // the connection's threshold
+	Decision      string  `json:"decision"`
 }
 
+// Cost gate decisions
+const (
+	CostDecisionAllowed = "allowed" // the estimate is within the threshold
+	CostDecisionForced  = "forced"  // over the threshold, but the request set force
+	CostDecisionRefused = "refused" // over the threshold, so the SQL was not run
+)
+
+// Phases a query can time out in
+const (
+	TimeoutPhaseGeneration = "generation" // the LLM did not answer in time
+	TimeoutPhaseExecution  = "execution"  // the database did not answer in time
+)
+
 // TableInfo contains table metadata
 type TableInfo struct {
 	Name       string       `json:"name"`
 	SchemaName string       `json:"schema_name,omitempty"`
 	Columns    []ColumnInfo `json:"columns"`
 	RowCount   *int64       `json:"row_count,omitempty"`
+	Indexes    []IndexInfo  `json:"indexes,omitempty"`
+	// Role is set by ClassifyTables when the schema is loaded
+	Role TableRole `json:"role,omitempty"`
+
+	// RoleAnnotated and Description are set by AnnotateTables when a user annotated
+	// the table
+	RoleAnnotated bool   `json:"role_annotated,omitempty"`
+	Description   string `json:"description,omitempty"`
 }
 
 // ColumnInfo contains column metadata
@@ -71,12 +375,121 @@ type ColumnInfo struct {
 	Description string `json:"description,omitempty"`
 }
 
+// IndexInfo describes a secondary index by its key columns
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// TableUsage counts the successful queries of a connection that read a table
+type TableUsage struct {
+	TableName     string    `json:"table_name"`
+	QueryCount    int64     `json:"query_count"`
+	LastQueriedAt time.Time `json:"last_queried_at"`
+}
+
+// TableUsageRepository defines the interface for table usage storage
+type TableUsageRepository interface {
+	// Record counts one query reading each of tables
+	Record(ctx context.Context, connectionID uuid.UUID, tables []string, at time.Time) error
+	// ListTop returns the most queried tables of a connection, most queried first
+	ListTop(ctx context.Context, connectionID uuid.UUID, limit int) ([]TableUsage, error)
+}
+
 // SchemaInfo contains database schema information
 type SchemaInfo struct {
 	DatabaseType string      `json:"database_type"`
 	Tables       []TableInfo `json:"tables"`
 	DDL          string      `json:"ddl"`
 	CachedAt     time.Time   `json:"cached_at"`
+	// CacheTTLSeconds is how long the schema is kept after CachedAt; 0 means it is not cached
+	CacheTTLSeconds int `json:"cache_ttl_seconds"`
+	// Warnings name the tables left out because they could not be described
+	Warnings []SchemaWarning `json:"warnings,omitempty"`
+	// Hash identifies the tables, columns and indexes; it ignores row counts, so it
+	// only changes when the structure does
+	Hash string `json:"hash,omitempty"`
+	// Source is the layer the schema was served from, one of the SchemaSource values
+	Source string `json:"source,omitempty"`
+	// Changes is how the schema differs from the one loaded before it, set by a
+	// refresh that found a difference
+	Changes *SchemaChange `json:"changes,omitempty"`
+}
+
+// SchemaWarning is a table left out of a schema, such as for lack of permissions
+type SchemaWarning struct {
+	Table string `json:"table"`
+	Error string `json:"error"`
+}
+
+// UnmarshalJSON also reads the plain messages that schemas stored by older versions
+// have as warnings
+func (w *SchemaWarning) UnmarshalJSON(data []byte) error {
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		*w = SchemaWarning{Error: message}
+		return nil
+	}
+	type plain SchemaWarning
+	return json.Unmarshal(data, (*plain)(w))
+}
+
+// WarningTables returns the names of the tables left out of the schema
+func (s *SchemaInfo) WarningTables() []string {
+	tables := make([]string, 0, len(s.Warnings))
+	for _, w := range s.Warnings {
+		if w.Table != "" {
+			tables = append(tables, w.Table)
+		}
+	}
+	return tables
+}
+
+// Layers a schema is served from
+const (
+	SchemaSourceRedis    = "redis"    // the Redis cache
+	SchemaSourcePostgres = "postgres" // the copy stored with the connection
+	SchemaSourceLive     = "live"     // read from the database just now
+)
+
+// Formats a schema can be exported in
+const (
+	SchemaExportSQL      = "sql"      // the DDL given to the LLM
+	SchemaExportMarkdown = "markdown" // a document with a section per table
+	SchemaExportJSON     = "json"     // the SchemaInfo
+)
+
+// Stale reports whether a cached schema has outlived its TTL
+func (s *SchemaInfo) Stale(now time.Time) bool {
+	return s.CacheTTLSeconds > 0 && now.After(s.CachedAt.Add(time.Duration(s.CacheTTLSeconds)*time.Second))
+}
+
+// ContentHash returns the hash of the schema's tables, columns and indexes
+func (s *SchemaInfo) ContentHash() string {
+	tables := make([]TableInfo, len(s.Tables))
+	for i, table := range s.Tables {
+		table.RowCount = nil
+		table.Role, table.RoleAnnotated, table.Description = "", false, ""
+		tables[i] = table
+	}
+	data, _ := json.Marshal(tables)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// ConnectionSchemaRepository stores the last schema loaded from each connection, so
+// it outlives the Redis cache
+type ConnectionSchemaRepository interface {
+	// Get returns the stored schema of a connection, or nil if there is none. Its
+	// CachedAt is when it was read from the database.
+	Get(ctx context.Context, connectionID uuid.UUID) (*SchemaInfo, error)
+	// Save replaces the stored schema of a connection
+	Save(ctx context.Context, connectionID uuid.UUID, schema *SchemaInfo) error
+	// Delete removes the stored schema of a connection
+	Delete(ctx context.Context, connectionID uuid.UUID) error
+	// DeleteAll removes every stored schema and returns how many there were
+	DeleteAll(ctx context.Context) (int64, error)
 }
 
 // AuditLog represents an audit log entry
@@ -92,12 +505,22 @@ type AuditLog struct {
 	CreatedAt    time.Time      `json:"created_at"`
 }
 
+// AuditLogRepository defines audit log data access
+type AuditLogRepository interface {
+	Create(ctx context.Context, entry *AuditLog) error
+}
+
 // Audit actions
 const (
 	AuditActionLogin            = "login"
 	AuditActionLogout           = "logout"
+	AuditActionLoginLockout     = "login.lockout"
+	AuditActionUserDeactivate   = "admin.user_deactivate"
+	AuditActionUserReactivate   = "admin.user_reactivate"
+	AuditActionWorkspaceJoin    = "admin.workspace_join"
 	AuditActionConnectionCreate = "connection.create"
 	AuditActionConnectionDelete = "connection.delete"
 	AuditActionQueryExecute     = "query.execute"
 	AuditActionSchemaRefresh    = "schema.refresh"
+	AuditActionProviderDenied   = "llm.provider_denied"
 )
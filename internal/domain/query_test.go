@@ -0,0 +1,65 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaInfo_ContentHash(t *testing.T) {
+	rows := func(n int64) *int64 { return &n }
+	schema := &SchemaInfo{Tables: []TableInfo{{Name: "users", RowCount: rows(10), Columns: []ColumnInfo{{Name: "id", DataType: "integer"}}}}}
+	hash := schema.ContentHash()
+
+	grown := &SchemaInfo{Tables: []TableInfo{{Name: "users", RowCount: rows(2000), Columns: []ColumnInfo{{Name: "id", DataType: "integer"}}}}}
+	assert.Equal(t, hash, grown.ContentHash(), "row counts do not change the hash")
+	assert.Equal(t, int64(2000), *grown.Tables[0].RowCount, "the schema is left as it was")
+
+	altered := &SchemaInfo{Tables: []TableInfo{{Name: "users", Columns: []ColumnInfo{{Name: "id", DataType: "bigint"}}}}}
+	assert.NotEqual(t, hash, altered.ContentHash())
+}
+
+func TestSchemaWarning_UnmarshalLegacy(t *testing.T) {
+	var schema SchemaInfo
+	err := json.Unmarshal([]byte(`{"warnings": ["table a could not be described: denied", {"table": "b", "error": "denied"}]}`), &schema)
+	assert.NoError(t, err)
+	assert.Equal(t, []SchemaWarning{
+		{Error: "table a could not be described: denied"},
+		{Table: "b", Error: "denied"},
+	}, schema.Warnings)
+	assert.Equal(t, []string{"b"}, schema.WarningTables())
+}
+
+func TestQueryResult_ForStorage(t *testing.T) {
+	rows := [][]any{{1, "alice"}, {2, "bob"}, {3, "carol"}, {4, "dave"}}
+	result := &QueryResult{Columns: []string{"id", "name"}, Rows: rows, RowCount: 4}
+
+	assert.Same(t, result, result.ForStorage(StoredResultLimit{}), "no limit")
+	assert.Same(t, result, result.ForStorage(StoredResultLimit{MaxRows: 4, MaxBytes: 1000}), "fits")
+
+	stored := result.ForStorage(StoredResultLimit{MaxRows: 2})
+	assert.Equal(t, rows[:2], stored.Rows)
+	assert.True(t, stored.StoredTruncated)
+	assert.Equal(t, 4, stored.RowCount, "the row count is the full result's")
+	assert.Len(t, result.Rows, 4, "the live result is untouched")
+	assert.False(t, result.StoredTruncated)
+
+	// Rows encode to 9 to 11 bytes, plus a comma each and the two brackets
+	stored = result.ForStorage(StoredResultLimit{MaxBytes: 30})
+	assert.Equal(t, rows[:2], stored.Rows)
+	assert.True(t, stored.StoredTruncated)
+
+	stored = result.ForStorage(StoredResultLimit{MaxRows: 3, MaxBytes: 5})
+	assert.Empty(t, stored.Rows)
+	assert.True(t, stored.StoredTruncated)
+
+	data, err := json.Marshal(result.ForStorage(StoredResultLimit{MaxRows: 1}))
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"stored_truncated":true`)
+	data, err = json.Marshal(result)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "stored_truncated")
+
+	assert.Nil(t, (*QueryResult)(nil).ForStorage(StoredResultLimit{MaxRows: 1}))
+}
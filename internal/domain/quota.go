@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Provider classes that quotas are counted for. Local providers run on hardware the
+// operator owns, so workspaces usually leave them unlimited.
+const (
+	ProviderClassHosted = "hosted"
+	ProviderClassLocal  = "local"
+)
+
+// ProviderClasses lists the classes a quota can be set for
+var ProviderClasses = []string{ProviderClassHosted, ProviderClassLocal}
+
+// ProviderClass returns the quota class of an LLM provider
+func ProviderClass(provider string) string {
+	if provider == "ollama" {
+		return ProviderClassLocal
+	}
+	return ProviderClassHosted
+}
+
+// QuotaLimit caps a user's daily LLM use in one provider class. A zero field leaves
+// that dimension unlimited.
+type QuotaLimit struct {
+	DailyQueries int64 `json:"daily_queries,omitempty"`
+	DailyTokens  int64 `json:"daily_tokens,omitempty"`
+}
+
+// RoleQuotas maps each provider class to its limit; classes without one are unlimited
+type RoleQuotas map[string]QuotaLimit
+
+// QuotaCounts is what a user has used of a provider class on one day
+type QuotaCounts struct {
+	Queries int64 `json:"queries"`
+	Tokens  int64 `json:"tokens"`
+}
+
+// QuotaKey identifies the counters of a user in a workspace, provider class and day.
+// Day is the date in the workspace's timezone.
+type QuotaKey struct {
+	WorkspaceID   uuid.UUID
+	UserID        uuid.UUID
+	ProviderClass string
+	Day           string
+}
+
+// QuotaUsage is a user's use of a limited provider class against its limit
+type QuotaUsage struct {
+	WorkspaceID   uuid.UUID   `json:"workspace_id"`
+	ProviderClass string      `json:"provider_class"`
+	Used          QuotaCounts `json:"used"`
+	Limit         QuotaLimit  `json:"limit"`
+	ResetAt       time.Time   `json:"reset_at"`
+}
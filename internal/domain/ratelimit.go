@@ -0,0 +1,4 @@
+package domain
+
+// DefaultRateLimitClass names the rate limit bucket used when a route asks for no class
+const DefaultRateLimitClass = "default"
@@ -0,0 +1,147 @@
+package domain
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SchemaChange is how a connection's schema differed from the one loaded before it
+type SchemaChange struct {
+	ID            uuid.UUID     `json:"id"`
+	ConnectionID  uuid.UUID     `json:"connection_id"`
+	AddedTables   []string      `json:"added_tables"`
+	RemovedTables []string      `json:"removed_tables"`
+	ChangedTables []TableChange `json:"changed_tables"`
+	// Destructive is set when tables or columns were removed or columns changed type,
+	// which can break saved queries
+	Destructive bool      `json:"destructive"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// TableChange lists the column changes of a table present in both schemas
+type TableChange struct {
+	Table          string         `json:"table"`
+	AddedColumns   []string       `json:"added_columns,omitempty"`
+	RemovedColumns []string       `json:"removed_columns,omitempty"`
+	ChangedColumns []ColumnChange `json:"changed_columns,omitempty"`
+}
+
+// ColumnChange is a column whose type or nullability changed
+type ColumnChange struct {
+	Column string `json:"column"`
+	From   string `json:"from"` // the type, with " NULL" when the column was nullable
+	To     string `json:"to"`
+}
+
+// SchemaChangeRepository keeps the log of schema changes of each connection
+type SchemaChangeRepository interface {
+	Create(ctx context.Context, change *SchemaChange) error
+	// ListByConnection returns the latest changes of a connection, newest first
+	ListByConnection(ctx context.Context, connectionID uuid.UUID, limit int) ([]SchemaChange, error)
+}
+
+// DiffSchemas compares a connection's schema with the one loaded before it, and returns
+// nil when the tables and columns are the same. Tables the current schema could not
+// describe are not reported as removed.
+func DiffSchemas(previous, current *SchemaInfo) *SchemaChange {
+	before := schemaTablesByName(previous.Tables)
+	after := schemaTablesByName(current.Tables)
+	undescribed := current.WarningTables()
+
+	change := &SchemaChange{AddedTables: []string{}, RemovedTables: []string{}, ChangedTables: []TableChange{}}
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		old, ok := before[name]
+		if !ok {
+			change.AddedTables = append(change.AddedTables, name)
+			continue
+		}
+		if tc, changed := diffTable(name, old, after[name]); changed {
+			change.ChangedTables = append(change.ChangedTables, tc)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(before)) {
+		if _, ok := after[name]; !ok && !slices.Contains(undescribed, name) && !slices.Contains(undescribed, before[name].Name) {
+			change.RemovedTables = append(change.RemovedTables, name)
+		}
+	}
+	if len(change.AddedTables) == 0 && len(change.RemovedTables) == 0 && len(change.ChangedTables) == 0 {
+		return nil
+	}
+
+	change.Destructive = len(change.RemovedTables) > 0
+	for _, tc := range change.ChangedTables {
+		if len(tc.RemovedColumns) > 0 || len(tc.ChangedColumns) > 0 {
+			change.Destructive = true
+		}
+	}
+	return change
+}
+
+// DroppedTables returns the tables a change log, newest first, reports removed and
+// not added back since, in lower case
+func DroppedTables(changes []SchemaChange) map[string]bool {
+	dropped := map[string]bool{}
+	for i := len(changes) - 1; i >= 0; i-- {
+		for _, name := range changes[i].AddedTables {
+			delete(dropped, strings.ToLower(name))
+		}
+		for _, name := range changes[i].RemovedTables {
+			dropped[strings.ToLower(name)] = true
+		}
+	}
+	return dropped
+}
+
+// schemaTableName names a table as schema changes report it, qualified by its schema
+// when the database has several
+func schemaTableName(t TableInfo) string {
+	if t.SchemaName == "" || strings.Contains(t.Name, ".") {
+		return t.Name
+	}
+	return t.SchemaName + "." + t.Name
+}
+
+func schemaTablesByName(tables []TableInfo) map[string]TableInfo {
+	byName := make(map[string]TableInfo, len(tables))
+	for _, t := range tables {
+		byName[schemaTableName(t)] = t
+	}
+	return byName
+}
+
+func diffTable(name string, before, after TableInfo) (TableChange, bool) {
+	tc := TableChange{Table: name}
+	oldColumns := make(map[string]ColumnInfo, len(before.Columns))
+	for _, c := range before.Columns {
+		oldColumns[c.Name] = c
+	}
+	newColumns := make(map[string]bool, len(after.Columns))
+	for _, c := range after.Columns {
+		newColumns[c.Name] = true
+		old, ok := oldColumns[c.Name]
+		switch {
+		case !ok:
+			tc.AddedColumns = append(tc.AddedColumns, c.Name)
+		case columnType(old) != columnType(c):
+			tc.ChangedColumns = append(tc.ChangedColumns, ColumnChange{Column: c.Name, From: columnType(old), To: columnType(c)})
+		}
+	}
+	for _, c := range before.Columns {
+		if !newColumns[c.Name] {
+			tc.RemovedColumns = append(tc.RemovedColumns, c.Name)
+		}
+	}
+	return tc, len(tc.AddedColumns) > 0 || len(tc.RemovedColumns) > 0 || len(tc.ChangedColumns) > 0
+}
+
+func columnType(c ColumnInfo) string {
+	if c.Nullable {
+		return c.DataType + " NULL"
+	}
+	return c.DataType
+}
@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	previous := &SchemaInfo{Tables: []TableInfo{
+		{Name: "orders", Columns: []ColumnInfo{{Name: "id", DataType: "integer"}, {Name: "total", DataType: "integer"}, {Name: "note", DataType: "text", Nullable: true}}},
+		{Name: "legacy_orders", Columns: []ColumnInfo{{Name: "id", DataType: "integer"}}},
+		{Name: "audit", Columns: []ColumnInfo{{Name: "id", DataType: "integer"}}},
+	}}
+
+	t.Run("unchanged", func(t *testing.T) {
+		assert.Nil(t, DiffSchemas(previous, previous))
+	})
+
+	t.Run("added only", func(t *testing.T) {
+		current := &SchemaInfo{Tables: append([]TableInfo{{Name: "refunds"}}, previous.Tables...)}
+		change := DiffSchemas(previous, current)
+		require.NotNil(t, change)
+		assert.Equal(t, []string{"refunds"}, change.AddedTables)
+		assert.Empty(t, change.RemovedTables)
+		assert.False(t, change.Destructive)
+	})
+
+	t.Run("destructive", func(t *testing.T) {
+		current := &SchemaInfo{
+			Tables: []TableInfo{
+				{Name: "orders", Columns: []ColumnInfo{{Name: "id", DataType: "integer"}, {Name: "total", DataType: "numeric"}, {Name: "status", DataType: "text"}}},
+			},
+			// audit could not be described, which is not a drop
+			Warnings: []SchemaWarning{{Table: "audit", Error: "permission denied"}},
+		}
+		change := DiffSchemas(previous, current)
+		require.NotNil(t, change)
+		assert.Empty(t, change.AddedTables)
+		assert.Equal(t, []string{"legacy_orders"}, change.RemovedTables)
+		assert.Equal(t, []TableChange{{
+			Table:          "orders",
+			AddedColumns:   []string{"status"},
+			RemovedColumns: []string{"note"},
+			ChangedColumns: []ColumnChange{{Column: "total", From: "integer", To: "numeric"}},
+		}}, change.ChangedTables)
+		assert.True(t, change.Destructive)
+	})
+
+	t.Run("tables are named with their schema", func(t *testing.T) {
+		before := &SchemaInfo{Tables: []TableInfo{{Name: "orders", SchemaName: "sales"}}}
+		after := &SchemaInfo{Tables: []TableInfo{{Name: "orders", SchemaName: "archive"}}}
+		change := DiffSchemas(before, after)
+		require.NotNil(t, change)
+		assert.Equal(t, []string{"archive.orders"}, change.AddedTables)
+		assert.Equal(t, []string{"sales.orders"}, change.RemovedTables)
+	})
+}
+
+func TestDroppedTables(t *testing.T) {
+	// Newest first: legacy was dropped, then Events dropped and added back
+	changes := []SchemaChange{
+		{AddedTables: []string{"events"}},
+		{RemovedTables: []string{"Events"}},
+		{RemovedTables: []string{"legacy"}},
+	}
+	assert.Equal(t, map[string]bool{"legacy": true}, DroppedTables(changes))
+	assert.Empty(t, DroppedTables(nil))
+}
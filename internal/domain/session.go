@@ -13,15 +13,36 @@ type ChatSession struct {
 	WorkspaceID uuid.UUID  `json:"workspace_id"`
 	UserID      *uuid.UUID `json:"user_id,omitempty"`
 	Title       string     `json:"title"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	// ConnectionID is the connection the session's questions run against, set by its
+	// first question
+	ConnectionID *uuid.UUID `json:"connection_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
 }
 
+// ChatSessionSummary is a session with message statistics, for the sessions list
+type ChatSessionSummary struct {
+	ChatSession
+	MessageCount       int        `json:"message_count"`
+	LastMessageAt      *time.Time `json:"last_message_at,omitempty"`
+	LastMessagePreview string     `json:"last_message_preview,omitempty"`
+}
+
+// DefaultSessionTitle is the title of a session until one is derived from its first question
+const DefaultSessionTitle = "New Chat"
+
+// SessionRetention is how long a deleted session stays restorable before it is purged
+const SessionRetention = 30 * 24 * time.Hour
+
 // SessionRepository defines the interface for session storage
 type SessionRepository interface {
 	Create(ctx context.Context, session *ChatSession) error
 	Get(ctx context.Context, id uuid.UUID) (*ChatSession, error)
-	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int, offset int) ([]ChatSession, error)
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int, offset int) ([]ChatSessionSummary, int, error)
 	Update(ctx context.Context, session *ChatSession) error
+	SoftDelete(ctx context.Context, id uuid.UUID) error
+	Restore(ctx context.Context, id uuid.UUID) error
 	Delete(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SharedResult is a read-only link to a stored answer. Only the SHA-256 hash of its
+// token is stored.
+type SharedResult struct {
+	ID           uuid.UUID  `json:"id"`
+	TokenHash    []byte     `json:"-"`
+	WorkspaceID  uuid.UUID  `json:"workspace_id"`
+	MessageID    uuid.UUID  `json:"message_id"`
+	CreatedBy    *uuid.UUID `json:"created_by,omitempty"`
+	PasscodeHash string     `json:"-"` // bcrypt hash, empty when no passcode is needed
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Active reports whether the share can still be viewed at now
+func (s *SharedResult) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// SharedResultCreate represents share creation data. Expiry is mandatory and capped by
+// the server's maximum share lifetime.
+type SharedResultCreate struct {
+	ExpiresInSeconds int    `json:"expires_in_seconds" validate:"required,min=60"`
+	Passcode         string `json:"passcode,omitempty" validate:"omitempty,min=4,max=72"`
+}
+
+// SharedResultInfo describes a share to workspace members
+type SharedResultInfo struct {
+	ID                uuid.UUID  `json:"id"`
+	MessageID         uuid.UUID  `json:"message_id"`
+	CreatedBy         *uuid.UUID `json:"created_by,omitempty"`
+	PasscodeProtected bool       `json:"passcode_protected"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	RevokedAt         *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	Active            bool       `json:"active"`
+
+	// Token is only returned when the share is created
+	Token string `json:"token,omitempty"`
+}
+
+// SharedResultView is what a share link shows. It leaves out the connection and
+// everything else that could identify the database behind the answer.
+type SharedResultView struct {
+	Question    string       `json:"question"`
+	SQL         string       `json:"sql"`
+	Result      *QueryResult `json:"result,omitempty"`
+	Explanation string       `json:"explanation,omitempty"`
+	AnsweredAt  time.Time    `json:"answered_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+}
+
+// SharedResultRepository defines the interface for share link storage
+type SharedResultRepository interface {
+	Create(ctx context.Context, share *SharedResult) error
+	// GetByTokenHash retrieves a share by the hash of its token, or nil if there is none
+	GetByTokenHash(ctx context.Context, tokenHash []byte) (*SharedResult, error)
+	// GetByIDAndWorkspace retrieves a share of a workspace, or nil if there is none
+	GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*SharedResult, error)
+	// ListByWorkspace lists the shares of a workspace, newest first. createdBy narrows
+	// them to one user's shares when set.
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, createdBy *uuid.UUID) ([]SharedResult, error)
+	Revoke(ctx context.Context, id uuid.UUID, at time.Time) error
+}
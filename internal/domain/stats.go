@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// PlatformStats summarizes the whole installation for platform admins. Days are UTC
+// dates, and the query figures cover the answers given since Since.
+type PlatformStats struct {
+	Since             time.Time        `json:"since"`
+	GeneratedAt       time.Time        `json:"generated_at"`
+	Users             int64            `json:"users"`
+	Workspaces        int64            `json:"workspaces"`
+	Connections       int64            `json:"connections"`
+	ConnectionsByType map[string]int64 `json:"connections_by_type"`
+	Queries           int64            `json:"queries"`
+	Errors            int64            `json:"errors"`
+	// ErrorRate is the share of answers that are not ok, 0 without answers
+	ErrorRate  float64              `json:"error_rate"`
+	Tokens     int64                `json:"tokens"`
+	ByProvider []ProviderUsageStats `json:"by_provider"`
+	Daily      []DailyUsageStats    `json:"daily"`
+}
+
+// ProviderUsageStats is the use of one LLM provider
+type ProviderUsageStats struct {
+	Provider        string `json:"provider"`
+	Queries         int64  `json:"queries"`
+	Errors          int64  `json:"errors"`
+	Tokens          int64  `json:"tokens"`
+	AvgLLMLatencyMs int64  `json:"avg_llm_latency_ms"`
+}
+
+// DailyUsageStats is one day of the daily series, present for every day of the window
+type DailyUsageStats struct {
+	Date     string `json:"date"`
+	Queries  int64  `json:"queries"`
+	Errors   int64  `json:"errors"`
+	Tokens   int64  `json:"tokens"`
+	NewUsers int64  `json:"new_users"`
+}
+
+// PlatformTotals are the current totals of users, workspaces and connections
+type PlatformTotals struct {
+	Users             int64
+	Workspaces        int64
+	ConnectionsByType map[string]int64
+}
+
+// DailyProviderCount aggregates the answers of one provider on one UTC day
+type DailyProviderCount struct {
+	Day             time.Time
+	Provider        string
+	Queries         int64
+	Errors          int64
+	Tokens          int64
+	LLMLatencyTotal int64 // sum of the LLM latencies recorded, in milliseconds
+	LLMLatencyCount int64
+}
+
+// DayCount is a count on one UTC day
+type DayCount struct {
+	Day   time.Time
+	Count int64
+}
+
+// PlatformStatsRepository reads the figures behind PlatformStats
+type PlatformStatsRepository interface {
+	Totals(ctx context.Context) (*PlatformTotals, error)
+	// AnswerCounts groups the answers given since a time by UTC day and provider
+	AnswerCounts(ctx context.Context, since time.Time) ([]DailyProviderCount, error)
+	// NewUserCounts counts the users created since a time by UTC day
+	NewUserCounts(ctx context.Context, since time.Time) ([]DayCount, error)
+}
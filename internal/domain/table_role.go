@@ -0,0 +1,199 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TableRole is how a table is used in queries, guessed from its shape when the schema
+// is loaded
+type TableRole string
+
+// Table roles, in the order tables are listed by SortTablesByRole
+const (
+	// TableRoleFact records events or transactions, such as orders, and references
+	// several other tables
+	TableRoleFact TableRole = "fact"
+	// TableRoleDimension describes the things facts refer to, such as customers
+	TableRoleDimension TableRole = "dimension"
+	// TableRoleLookup is a short list of codes or names, such as statuses
+	TableRoleLookup TableRole = "lookup"
+	// TableRoleJunk is unlikely to be asked about: empty, temporary, backup or
+	// bookkeeping tables
+	TableRoleJunk TableRole = "junk"
+)
+
+var tableRoleOrder = []TableRole{TableRoleFact, TableRoleDimension, TableRoleLookup, TableRoleJunk}
+
+const (
+	// lookupMaxColumns and lookupMaxRows bound the tables taken for lookups
+	lookupMaxColumns = 3
+	lookupMaxRows    = 1000
+	// factMinRows is the size from which an unreferenced table with a time column is
+	// taken for a fact table
+	factMinRows = 10000
+)
+
+// junkTableName matches the names of temporary, backup and bookkeeping tables
+var junkTableName = regexp.MustCompile(`(?i)(^_|^tmp_|^temp_|_tmp$|_temp$|_bak$|_backup$|^backup_|_old$|_copy$|^schema_migrations$|^goose_db_version$|^__|^flyway_schema_history$|^django_migrations$)`)
+
+// ClassifyTables sets the Role of each table from its name, its row count and the
+// tables it references or is referenced by. References are inferred from columns
+// named after another table, such as customer_id, since foreign keys are not read.
+func ClassifyTables(tables []TableInfo) {
+	references := InferReferences(tables)
+	fanOut := make(map[string]int, len(tables))
+	fanIn := make(map[string]int, len(tables))
+	for _, t := range tables {
+		seen := map[string]bool{}
+		for _, ref := range references[t.Name] {
+			if strings.EqualFold(ref.Table, t.Name) || seen[ref.Table] {
+				continue
+			}
+			seen[ref.Table] = true
+			fanOut[t.Name]++
+			fanIn[ref.Table]++
+		}
+	}
+
+	for i := range tables {
+		t := &tables[i]
+		out, in := fanOut[t.Name], fanIn[t.Name]
+		switch {
+		case junkTableName.MatchString(t.Name) || (t.RowCount != nil && *t.RowCount == 0):
+			t.Role = TableRoleJunk
+		case out >= 2, out == 1 && in == 0:
+			t.Role = TableRoleFact
+		case in == 0 && hasTimeColumn(t.Columns) && t.RowCount != nil && *t.RowCount >= factMinRows:
+			t.Role = TableRoleFact
+		case out == 0 && len(t.Columns) <= lookupMaxColumns && (t.RowCount == nil || *t.RowCount <= lookupMaxRows):
+			t.Role = TableRoleLookup
+		default:
+			t.Role = TableRoleDimension
+		}
+	}
+}
+
+// TableReference is a column inferred to refer to another table
+type TableReference struct {
+	Column string
+	Table  string
+}
+
+// InferReferences returns the references of each table's columns, keyed by table
+// name, inferred from columns named after another table, such as customer_id, since
+// foreign keys are not read
+func InferReferences(tables []TableInfo) map[string][]TableReference {
+	byName := make(map[string]string, len(tables))
+	for _, t := range tables {
+		byName[strings.ToLower(t.Name)] = t.Name
+	}
+	references := make(map[string][]TableReference, len(tables))
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			if target, ok := referencedTable(c, byName); ok {
+				references[t.Name] = append(references[t.Name], TableReference{Column: c.Name, Table: target})
+			}
+		}
+	}
+	return references
+}
+
+// SortTablesByRole returns the tables with facts first, then dimensions, lookups,
+// junk and unlabelled tables, keeping the order of tables with the same role
+func SortTablesByRole(tables []TableInfo) []TableInfo {
+	sorted := slices.Clone(tables)
+	slices.SortStableFunc(sorted, func(a, b TableInfo) int {
+		return tableRoleRank(a.Role) - tableRoleRank(b.Role)
+	})
+	return sorted
+}
+
+func tableRoleRank(role TableRole) int {
+	if i := slices.Index(tableRoleOrder, role); i >= 0 {
+		return i
+	}
+	return len(tableRoleOrder)
+}
+
+// referencedTable returns the table a column such as customer_id or customerId
+// refers to, by the singular or plural name of the table
+func referencedTable(c ColumnInfo, tables map[string]string) (string, bool) {
+	name := strings.ToLower(c.Name)
+	if c.PrimaryKey || name == "id" {
+		return "", false
+	}
+	base, ok := strings.CutSuffix(name, "_id")
+	if !ok {
+		base, ok = strings.CutSuffix(name, "id")
+	}
+	if !ok || base == "" {
+		return "", false
+	}
+	for _, candidate := range []string{base, base + "s", base + "es", strings.TrimSuffix(base, "y") + "ies"} {
+		if table, ok := tables[candidate]; ok {
+			return table, true
+		}
+	}
+	return "", false
+}
+
+func hasTimeColumn(columns []ColumnInfo) bool {
+	for _, c := range columns {
+		dataType := strings.ToLower(c.DataType)
+		if strings.Contains(dataType, "date") || strings.Contains(dataType, "time") {
+			return true
+		}
+	}
+	return false
+}
+
+// TableAnnotation is a user's correction of what a table is for: a role replacing the
+// one guessed by ClassifyTables, a one-line description, or both
+type TableAnnotation struct {
+	ConnectionID uuid.UUID  `json:"connection_id"`
+	SchemaName   string     `json:"schema_name,omitempty"`
+	TableName    string     `json:"table_name"`
+	Role         TableRole  `json:"role,omitempty"` // empty keeps the guessed role
+	Description  string     `json:"description,omitempty"`
+	UpdatedBy    *uuid.UUID `json:"updated_by,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// TableAnnotationRequest sets the annotation of a table
+type TableAnnotationRequest struct {
+	SchemaName  string    `json:"schema_name" validate:"max=255"`
+	Role        TableRole `json:"role" validate:"omitempty,oneof=fact dimension lookup junk"`
+	Description string    `json:"description" validate:"max=500"`
+}
+
+// TableAnnotationRepository stores the table annotations of each connection
+type TableAnnotationRepository interface {
+	ListByConnection(ctx context.Context, connectionID uuid.UUID) ([]TableAnnotation, error)
+	// Upsert creates or replaces the annotation of a table
+	Upsert(ctx context.Context, annotation *TableAnnotation) error
+	// Delete removes the annotation of a table, reporting false when it had none
+	Delete(ctx context.Context, connectionID uuid.UUID, schemaName, tableName string) (bool, error)
+}
+
+// AnnotateTables applies annotations to the tables they name, after ClassifyTables: a
+// role replaces the guessed one and marks the table's RoleAnnotated
+func AnnotateTables(tables []TableInfo, annotations []TableAnnotation) {
+	for _, a := range annotations {
+		for i := range tables {
+			t := &tables[i]
+			if t.Name != a.TableName || t.SchemaName != a.SchemaName {
+				continue
+			}
+			if a.Role != "" {
+				t.Role, t.RoleAnnotated = a.Role, true
+			}
+			t.Description = a.Description
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyTables(t *testing.T) {
+	rows := func(n int64) *int64 { return &n }
+	tables := []TableInfo{
+		{Name: "order_statuses", Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "label"}}},
+		{Name: "customers", Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "name"}, {Name: "email"}, {Name: "country_id"}}},
+		{Name: "countries", Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "name"}}},
+		{Name: "orders", Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "customer_id"}, {Name: "order_status_id"}, {Name: "created_at", DataType: "timestamp"}}},
+		{Name: "page_views", RowCount: rows(50000), Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "url"}, {Name: "referrer"}, {Name: "viewed_at", DataType: "timestamptz"}}},
+		{Name: "orders_backup", Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "customer_id"}}},
+		{Name: "audit", RowCount: rows(0), Columns: []ColumnInfo{{Name: "id", PrimaryKey: true}}},
+		{Name: "schema_migrations", Columns: []ColumnInfo{{Name: "version"}}},
+	}
+
+	ClassifyTables(tables)
+
+	roles := map[string]TableRole{}
+	for _, table := range tables {
+		roles[table.Name] = table.Role
+	}
+	assert.Equal(t, map[string]TableRole{
+		"order_statuses":    TableRoleLookup,
+		"customers":         TableRoleDimension,
+		"countries":         TableRoleLookup,
+		"orders":            TableRoleFact,
+		"page_views":        TableRoleFact,
+		"orders_backup":     TableRoleJunk,
+		"audit":             TableRoleJunk,
+		"schema_migrations": TableRoleJunk,
+	}, roles)
+
+	var names []string
+	for _, table := range SortTablesByRole(tables) {
+		names = append(names, table.Name)
+	}
+	assert.Equal(t, []string{"orders", "page_views", "customers", "order_statuses", "countries", "orders_backup", "audit", "schema_migrations"}, names)
+	assert.Equal(t, "order_statuses", tables[0].Name, "sorting copies the tables")
+}
+
+func TestSchemaInfo_ContentHash_IgnoresRoles(t *testing.T) {
+	schema := &SchemaInfo{Tables: []TableInfo{{Name: "orders", Columns: []ColumnInfo{{Name: "id"}}}}}
+	before := schema.ContentHash()
+	ClassifyTables(schema.Tables)
+	assert.Equal(t, before, schema.ContentHash())
+}
+
+func TestAnnotateTables(t *testing.T) {
+	tables := []TableInfo{
+		{Name: "orders", SchemaName: "sales", Role: TableRoleFact},
+		{Name: "orders", SchemaName: "archive", Role: TableRoleJunk},
+		{Name: "stores", SchemaName: "sales", Role: TableRoleLookup},
+	}
+
+	AnnotateTables(tables, []TableAnnotation{
+		{SchemaName: "sales", TableName: "stores", Role: TableRoleDimension, Description: "One row per store"},
+		{SchemaName: "sales", TableName: "orders", Description: "Order lines"},
+	})
+
+	assert.Equal(t, TableInfo{Name: "orders", SchemaName: "sales", Role: TableRoleFact, Description: "Order lines"}, tables[0], "a description keeps the guessed role")
+	assert.Equal(t, TableInfo{Name: "orders", SchemaName: "archive", Role: TableRoleJunk}, tables[1], "tables match by schema too")
+	assert.Equal(t, TableInfo{Name: "stores", SchemaName: "sales", Role: TableRoleDimension, RoleAnnotated: true, Description: "One row per store"}, tables[2])
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// QueryTemplate is a stored SQL statement with {{name}} placeholders, run with
+// parameter values instead of a question to the LLM
+type QueryTemplate struct {
+	ID           uuid.UUID           `json:"id"`
+	WorkspaceID  uuid.UUID           `json:"workspace_id"`
+	ConnectionID uuid.UUID           `json:"connection_id"`
+	Name         string              `json:"name"`
+	Description  string              `json:"description,omitempty"`
+	SQL          string              `json:"sql"`
+	Parameters   []TemplateParameter `json:"parameters"`
+	CreatedBy    *uuid.UUID          `json:"created_by,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	// DroppedTables are tables the SQL reads that schema refreshes found dropped since;
+	// set when listing templates
+	DroppedTables []string `json:"dropped_tables,omitempty"`
+}
+
+// TemplateParameter declares a placeholder of a template. A parameter without a
+// default must be given a value on every run.
+type TemplateParameter struct {
+	Name    string `json:"name" validate:"required,max=64"`
+	Type    string `json:"type" validate:"required,oneof=string integer number boolean date timestamp"`
+	Default any    `json:"default,omitempty"`
+}
+
+// QueryTemplateCreate represents template creation data. With MessageID the SQL and
+// connection are taken from an assistant message and its literals become parameters.
+type QueryTemplateCreate struct {
+	Name         string              `json:"name" validate:"required,max=255"`
+	Description  string              `json:"description,omitempty" validate:"max=2000"`
+	ConnectionID *uuid.UUID          `json:"connection_id,omitempty" validate:"required_without=MessageID"`
+	SQL          string              `json:"sql,omitempty" validate:"required_without=MessageID,excluded_with=MessageID,max=20000"`
+	Parameters   []TemplateParameter `json:"parameters,omitempty" validate:"excluded_with=MessageID,dive"`
+	MessageID    *uuid.UUID          `json:"message_id,omitempty"`
+}
+
+// QueryTemplateUpdate represents template update data
+type QueryTemplateUpdate struct {
+	Name         *string             `json:"name,omitempty" validate:"omitempty,max=255"`
+	Description  *string             `json:"description,omitempty" validate:"omitempty,max=2000"`
+	ConnectionID *uuid.UUID          `json:"connection_id,omitempty"`
+	SQL          *string             `json:"sql,omitempty" validate:"omitempty,max=20000"`
+	Parameters   []TemplateParameter `json:"parameters,omitempty" validate:"dive"`
+}
+
+// TemplateRunRequest runs a template with parameter values, in an existing session or a
+// new one
+type TemplateRunRequest struct {
+	SessionID uuid.UUID      `json:"session_id,omitempty"`
+	Params    map[string]any `json:"params,omitempty"`
+	Options   *QueryOptions  `json:"options,omitempty"`
+}
+
+// TemplateRun records which template answered a message and with which values
+type TemplateRun struct {
+	ID     uuid.UUID      `json:"id"`
+	Name   string         `json:"name"`
+	Params map[string]any `json:"params,omitempty"`
+}
+
+// QueryTemplateRepository defines the interface for query template storage
+type QueryTemplateRepository interface {
+	Create(ctx context.Context, template *QueryTemplate) error
+	GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*QueryTemplate, error)
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]QueryTemplate, error)
+	Update(ctx context.Context, template *QueryTemplate) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Upload is a SQLite file stored on the server for a workspace, either uploaded
+// directly or produced by a CSV or Excel import
+type Upload struct {
+	ID           uuid.UUID  `json:"id"`
+	WorkspaceID  uuid.UUID  `json:"workspace_id"`
+	UserID       *uuid.UUID `json:"user_id,omitempty"`
+	OriginalName string     `json:"original_name"`
+	FilePath     string     `json:"file_path"`
+	SizeBytes    int64      `json:"size_bytes"`
+	OrphanedAt   *time.Time `json:"orphaned_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// ConnectionID and ConnectionName describe a connection that opens the file, if any
+	ConnectionID   *uuid.UUID `json:"connection_id,omitempty"`
+	ConnectionName string     `json:"connection_name,omitempty"`
+}
+
+// UploadRepository defines the interface for upload storage
+type UploadRepository interface {
+	Create(ctx context.Context, upload *Upload) error
+	GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*Upload, error)
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]Upload, error)
+	ListFilePaths(ctx context.Context) ([]string, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	MarkOrphans(ctx context.Context, at time.Time) (int64, error)
+}
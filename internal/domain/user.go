@@ -1,20 +1,51 @@
 package domain
 
 import (
+	"context"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+// Authentication providers a user account can belong to
+const (
+	AuthProviderPassword = "password"
+	AuthProviderOIDC     = "oidc"
+)
+
 // User represents a platform user
 type User struct {
-	ID           uuid.UUID      `json:"id"`
-	Email        string         `json:"email"`
-	DisplayName  string         `json:"display_name"`
-	PasswordHash string         `json:"-"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	LLMConfig    map[string]any `json:"llm_config"`
+	ID            uuid.UUID      `json:"id"`
+	Email         string         `json:"email"`
+	DisplayName   string         `json:"display_name"`
+	PasswordHash  string         `json:"-"`
+	AuthProvider  string         `json:"auth_provider"`
+	ExternalID    string         `json:"-"` // subject at the external identity provider
+	IsAdmin       bool           `json:"is_admin"`
+	DeactivatedAt *time.Time     `json:"deactivated_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	LLMConfig     map[string]any `json:"llm_config"`
+	// Used by queries that name no provider or model, ahead of the workspace defaults
+	PreferredProvider string `json:"preferred_provider,omitempty"`
+	PreferredModel    string `json:"preferred_model,omitempty"`
+	// Notification types the user turned off; new types are on until turned off
+	MutedNotifications []string `json:"muted_notifications"`
+}
+
+// UserRepository defines the interface for user storage
+type UserRepository interface {
+	Create(ctx context.Context, user *User) error
+	GetByID(ctx context.Context, id uuid.UUID) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetByExternalID(ctx context.Context, provider, externalID string) (*User, error)
+	LinkExternalID(ctx context.Context, userID uuid.UUID, provider, externalID string) error
+	EmailExists(ctx context.Context, email string) (bool, error)
+	ListWithLLMConfig(ctx context.Context) ([]*User, error)
+	Search(ctx context.Context, term string, limit, offset int) ([]*User, int, error)
+	SetDeactivated(ctx context.Context, id uuid.UUID, at *time.Time) error
+	PromoteAdmins(ctx context.Context, emails []string) (int64, error)
+	Update(ctx context.Context, user *User) error
 }
 
 // UserCreate represents user registration data
@@ -24,10 +55,34 @@ type UserCreate struct {
 	Password string `json:"password" validate:"required,min=8,max=72"`
 }
 
+// UserPreferences is a partial update of the current user's settings. An empty
+// preferred provider clears both preferences.
+type UserPreferences struct {
+	PreferredProvider *string `json:"preferred_provider,omitempty" validate:"omitempty,max=50"`
+	PreferredModel    *string `json:"preferred_model,omitempty" validate:"omitempty,max=255"`
+	// MutedNotifications replaces the notification types the user turned off
+	MutedNotifications *[]string `json:"muted_notifications,omitempty"`
+}
+
+// Where a user's effective LLM defaults come from
+const (
+	LLMDefaultsSourceUser   = "user"
+	LLMDefaultsSourceSystem = "system"
+)
+
+// LLMDefaults is the provider and model used for a user's queries that name none,
+// unless a workspace default applies. An empty model means the provider's default.
+type LLMDefaults struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`
+	Source   string `json:"source"`
+}
+
 // UserLogin represents login credentials
 type UserLogin struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required"`
+	IPAddress string `json:"-"` // client IP, set by the handler for auditing
 }
 
 // UserGoogleLogin represents Google OAuth login request payload
@@ -35,6 +90,12 @@ type UserGoogleLogin struct {
 	Credential string `json:"credential" validate:"required"`
 }
 
+// OIDCAuthState is kept server-side between the OIDC login redirect and the callback
+type OIDCAuthState struct {
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
 // TokenPair represents JWT token pair
 type TokenPair struct {
 	AccessToken  string `json:"access_token"`
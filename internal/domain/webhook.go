@@ -0,0 +1,122 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook events
+const (
+	WebhookEventQueryCompleted      = "query.completed"
+	WebhookEventSchemaRefreshFailed = "schema.refresh_failed"
+	WebhookEventConnectionDegraded  = "connection.degraded"
+	WebhookEventConnectionRecovered = "connection.recovered"
+	WebhookEventSchemaDestructive   = "schema.destructive_change" // tables or columns dropped or retyped
+)
+
+// WebhookEvents lists the events a webhook can subscribe to
+var WebhookEvents = []string{
+	WebhookEventQueryCompleted,
+	WebhookEventSchemaRefreshFailed,
+	WebhookEventConnectionDegraded,
+	WebhookEventConnectionRecovered,
+	WebhookEventSchemaDestructive,
+}
+
+// IsWebhookEvent reports whether event is a known webhook event
+func IsWebhookEvent(event string) bool {
+	return slices.Contains(WebhookEvents, event)
+}
+
+// Webhook is an endpoint notified of workspace events. Its URL and signing secret
+// are stored encrypted together in ConfigEncrypted.
+type Webhook struct {
+	ID              uuid.UUID `json:"id"`
+	WorkspaceID     uuid.UUID `json:"workspace_id"`
+	ConfigEncrypted []byte    `json:"-"`
+	Events          []string  `json:"events"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WebhookConfig is the decrypted part of a webhook
+type WebhookConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// WebhookCreate represents webhook creation data. A secret is generated when none is given.
+type WebhookCreate struct {
+	URL     string   `json:"url" validate:"required,url,max=2048"`
+	Secret  string   `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+	Events  []string `json:"events" validate:"required,min=1"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// WebhookUpdate represents webhook update data
+type WebhookUpdate struct {
+	URL     *string  `json:"url,omitempty" validate:"omitempty,url,max=2048"`
+	Secret  *string  `json:"secret,omitempty" validate:"omitempty,min=16,max=255"`
+	Events  []string `json:"events,omitempty" validate:"omitempty,min=1"`
+	Enabled *bool    `json:"enabled,omitempty"`
+}
+
+// WebhookInfo represents a webhook without its secret. The URL is masked because
+// chat webhook URLs embed their own credentials.
+type WebhookInfo struct {
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Enabled     bool      `json:"enabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// Secret is only returned when it was generated on creation
+	Secret string `json:"secret,omitempty"`
+}
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event sent, or to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	WebhookID      uuid.UUID       `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// WebhookRepository defines the interface for webhook storage
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *Webhook) error
+	GetByID(ctx context.Context, id uuid.UUID) (*Webhook, error)
+	GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*Webhook, error)
+	ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]Webhook, error)
+	ListSubscribed(ctx context.Context, workspaceID uuid.UUID, event string) ([]Webhook, error)
+	Update(ctx context.Context, webhook *Webhook) error
+	Delete(ctx context.Context, id uuid.UUID) error
+
+	CreateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]WebhookDelivery, error)
+	// ClaimDueDeliveries returns pending deliveries due by now and postpones them by lease,
+	// so that concurrent workers do not send them twice
+	ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *WebhookDelivery) error
+}
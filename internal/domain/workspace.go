@@ -1,6 +1,11 @@
 package domain
 
 import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,23 +13,214 @@ import (
 
 // Workspace represents a tenant workspace
 type Workspace struct {
-	ID        uuid.UUID      `json:"id"`
-	Name      string         `json:"name"`
-	Settings  map[string]any `json:"settings,omitempty"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
+	ID        uuid.UUID         `json:"id"`
+	Name      string            `json:"name"`
+	Settings  WorkspaceSettings `json:"settings"`
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// LLMProviders lists the provider names a workspace can choose from
+var LLMProviders = []string{"openai", "anthropic", "ollama", "deepseek", "gemini"}
+
+// WorkspaceSettings are the workspace options honored by the query path.
+// Keys this version does not know are kept in Extra so stored settings survive a round trip.
+type WorkspaceSettings struct {
+	DefaultLLMProvider string `json:"default_llm_provider,omitempty"`
+	DefaultLLMModel    string `json:"default_llm_model,omitempty"`
+	// MaxRows caps query results below the connection and global limits; 0 means no workspace cap
+	MaxRows int `json:"max_rows,omitempty"`
+	// AllowSampleData permits sending sample rows to the LLM. Nothing sends sample rows yet.
+	AllowSampleData *bool `json:"allow_sample_data,omitempty"`
+	// LLMProviderAllowlist restricts the providers usable in the workspace; empty allows all.
+	// It is also read from allowed_llm_providers.
+	LLMProviderAllowlist []string `json:"llm_provider_allowlist,omitempty"`
+	// UserQuotas caps the daily LLM use of each member by workspace role; roles without
+	// an entry are unlimited
+	UserQuotas map[string]RoleQuotas `json:"user_quotas,omitempty"`
+	// Timezone is the IANA zone whose midnight resets daily quotas, UTC when empty
+	Timezone string `json:"timezone,omitempty"`
+	// Experiment splits questions between LLM providers, models or prompts; none runs
+	// unless set and enabled
+	Experiment *Experiment `json:"experiment,omitempty"`
+	// RateLimitPerMinute caps the requests of all members together, on top of each
+	// member's own limit; 0 uses the server's workspace default
+	RateLimitPerMinute int `json:"rate_limit_per_minute,omitempty"`
+	// HistoryMaxMessages and HistoryMaxTokens cap the session history given to the LLM,
+	// dropping the oldest turns first; 0 uses the server's defaults
+	HistoryMaxMessages int `json:"history_max_messages,omitempty"`
+	HistoryMaxTokens   int `json:"history_max_tokens,omitempty"`
+
+	Extra map[string]any `json:"-"`
+}
+
+// AllowsProvider reports whether the allowlist permits provider
+func (s WorkspaceSettings) AllowsProvider(provider string) bool {
+	return len(s.LLMProviderAllowlist) == 0 || slices.Contains(s.LLMProviderAllowlist, provider)
+}
+
+// DefaultProvider returns the provider used when neither the request nor the user
+// names one: the workspace default, else globalDefault if allowed, else the first
+// allowed provider
+func (s WorkspaceSettings) DefaultProvider(globalDefault string) string {
+	if s.DefaultLLMProvider != "" {
+		return s.DefaultLLMProvider
+	}
+	if s.AllowsProvider(globalDefault) {
+		return globalDefault
+	}
+	return s.LLMProviderAllowlist[0]
+}
+
+// QuotaFor returns the daily limit of role in a provider class, and false when it is unlimited
+func (s WorkspaceSettings) QuotaFor(role, class string) (QuotaLimit, bool) {
+	limit, ok := s.UserQuotas[role][class]
+	return limit, ok && (limit.DailyQueries > 0 || limit.DailyTokens > 0)
+}
+
+// Location returns the workspace's timezone, UTC when it is unset or unknown
+func (s WorkspaceSettings) Location() *time.Location {
+	if s.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Validate checks the settings against the known providers and the global row limit
+func (s WorkspaceSettings) Validate(maxRows int) error {
+	for _, provider := range s.LLMProviderAllowlist {
+		if !slices.Contains(LLMProviders, provider) {
+			return fmt.Errorf("invalid settings: unknown llm provider %q in llm_provider_allowlist", provider)
+		}
+	}
+	if s.DefaultLLMProvider != "" {
+		if !slices.Contains(LLMProviders, s.DefaultLLMProvider) {
+			return fmt.Errorf("invalid settings: unknown default_llm_provider %q", s.DefaultLLMProvider)
+		}
+		if !s.AllowsProvider(s.DefaultLLMProvider) {
+			return fmt.Errorf("invalid settings: default_llm_provider %q is not in llm_provider_allowlist", s.DefaultLLMProvider)
+		}
+	} else if s.DefaultLLMModel != "" {
+		return fmt.Errorf("invalid settings: default_llm_model requires default_llm_provider")
+	}
+	if s.MaxRows < 0 || (maxRows > 0 && s.MaxRows > maxRows) {
+		return fmt.Errorf("invalid settings: max_rows must be between 0 and %d", maxRows)
+	}
+	for role, quotas := range s.UserQuotas {
+		if roleRank[role] == 0 {
+			return fmt.Errorf("invalid settings: unknown role %q in user_quotas", role)
+		}
+		for class, limit := range quotas {
+			if !slices.Contains(ProviderClasses, class) {
+				return fmt.Errorf("invalid settings: unknown provider class %q in user_quotas, use hosted or local", class)
+			}
+			if limit.DailyQueries < 0 || limit.DailyTokens < 0 {
+				return fmt.Errorf("invalid settings: user_quotas limits of %s must not be negative", role)
+			}
+		}
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid settings: unknown timezone %q", s.Timezone)
+		}
+	}
+	if s.RateLimitPerMinute < 0 {
+		return fmt.Errorf("invalid settings: rate_limit_per_minute must not be negative")
+	}
+	if s.HistoryMaxMessages < 0 || s.HistoryMaxMessages > MaxHistoryMessages {
+		return fmt.Errorf("invalid settings: history_max_messages must be between 0 and %d", MaxHistoryMessages)
+	}
+	if s.HistoryMaxTokens < 0 {
+		return fmt.Errorf("invalid settings: history_max_tokens must not be negative")
+	}
+	if s.Experiment != nil {
+		if err := s.Experiment.Validate(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the known settings over the preserved unknown keys
+func (s WorkspaceSettings) MarshalJSON() ([]byte, error) {
+	type fields WorkspaceSettings
+	known, err := json.Marshal(fields(s))
+	if err != nil || len(s.Extra) == 0 {
+		return known, err
+	}
+
+	merged := maps.Clone(s.Extra)
+	if err := json.Unmarshal(known, &merged); err != nil {
+		return nil, err
+	}
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON decodes the known settings and keeps everything else in Extra.
+// A known key holding an unexpected type is kept in Extra rather than failing the decode.
+func (s *WorkspaceSettings) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*s = WorkspaceSettings{}
+	known := map[string]any{
+		"default_llm_provider":   &s.DefaultLLMProvider,
+		"default_llm_model":      &s.DefaultLLMModel,
+		"max_rows":               &s.MaxRows,
+		"allow_sample_data":      &s.AllowSampleData,
+		"llm_provider_allowlist": &s.LLMProviderAllowlist,
+		"user_quotas":            &s.UserQuotas,
+		"timezone":               &s.Timezone,
+		"experiment":             &s.Experiment,
+		"rate_limit_per_minute":  &s.RateLimitPerMinute,
+		"history_max_messages":   &s.HistoryMaxMessages,
+		"history_max_tokens":     &s.HistoryMaxTokens,
+	}
+	if _, ok := raw["llm_provider_allowlist"]; !ok {
+		known["allowed_llm_providers"] = &s.LLMProviderAllowlist
+	}
+	for key, value := range raw {
+		if dst, ok := known[key]; ok {
+			if err := json.Unmarshal(value, dst); err == nil {
+				continue
+			}
+			reflect.ValueOf(dst).Elem().SetZero()
+		}
+
+		var v any
+		if err := json.Unmarshal(value, &v); err != nil {
+			return err
+		}
+		if s.Extra == nil {
+			s.Extra = map[string]any{}
+		}
+		s.Extra[key] = v
+	}
+	return nil
+}
+
+// WorkspaceSummary is a workspace with its member count, for administration
+type WorkspaceSummary struct {
+	Workspace
+	MemberCount int `json:"member_count"`
 }
 
 // WorkspaceCreate represents workspace creation data
 type WorkspaceCreate struct {
-	Name     string         `json:"name" validate:"required,max=255"`
-	Settings map[string]any `json:"settings,omitempty"`
+	Name     string            `json:"name" validate:"required,max=255"`
+	Settings WorkspaceSettings `json:"settings"`
 }
 
 // WorkspaceUpdate represents workspace update data
 type WorkspaceUpdate struct {
-	Name     *string        `json:"name,omitempty" validate:"omitempty,max=255"`
-	Settings map[string]any `json:"settings,omitempty"`
+	Name     *string            `json:"name,omitempty" validate:"omitempty,max=255"`
+	Settings *WorkspaceSettings `json:"settings,omitempty"` // replaces all settings when set
 }
 
 // WorkspaceMember represents workspace membership
@@ -40,4 +236,28 @@ const (
 	RoleOwner  = "owner"
 	RoleAdmin  = "admin"
 	RoleMember = "member"
+	RoleViewer = "viewer" // can run queries and read history, but not modify the workspace
 )
+
+// roleRank orders roles from least to most privileged
+var roleRank = map[string]int{
+	RoleViewer: 1,
+	RoleMember: 2,
+	RoleAdmin:  3,
+	RoleOwner:  4,
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of min
+func RoleAtLeast(role, min string) bool {
+	return roleRank[role] > 0 && roleRank[role] >= roleRank[min]
+}
+
+// RoleOutranks reports whether role is more privileged than other
+func RoleOutranks(role, other string) bool {
+	return roleRank[role] > roleRank[other]
+}
+
+// IsAssignableRole reports whether role can be given to a member through member management
+func IsAssignableRole(role string) bool {
+	return role == RoleAdmin || role == RoleMember || role == RoleViewer
+}
@@ -0,0 +1,134 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WorkspaceBundleVersion is the version of the workspace bundle format written by exports
+const WorkspaceBundleVersion = 1
+
+// WorkspaceBundle is a workspace's setup exported as JSON, to recreate it on another
+// instance. IDs in a bundle only link its entries to each other: an import gives
+// everything new IDs. Connections carry no credentials.
+type WorkspaceBundle struct {
+	Version     int                `json:"version"`
+	ExportedAt  time.Time          `json:"exported_at"`
+	Name        string             `json:"name" validate:"required,max=255"`
+	Settings    WorkspaceSettings  `json:"settings"`
+	Connections []BundleConnection `json:"connections" validate:"dive"`
+	Templates   []BundleTemplate   `json:"templates" validate:"dive"`
+	// Sessions is the chat history, present when it was exported
+	Sessions []BundleSession `json:"sessions,omitempty" validate:"dive"`
+}
+
+// BundleConnection is an exported connection. Its password is not exported, so it
+// must be entered again once imported.
+type BundleConnection struct {
+	ID                    uuid.UUID    `json:"id" validate:"required"`
+	Name                  string       `json:"name" validate:"required,max=255"`
+	DatabaseType          DatabaseType `json:"database_type" validate:"required,oneof=postgres clickhouse mysql sqlite sqlserver mongodb"`
+	Host                  string       `json:"host" validate:"max=255"`
+	Port                  int          `json:"port" validate:"min=0,max=65535"`
+	Database              string       `json:"database" validate:"required,max=255"`
+	Username              string       `json:"username" validate:"max=255"`
+	SSLMode               string       `json:"ssl_mode" validate:"omitempty,oneof=disable require verify-ca verify-full"`
+	ReadOnly              bool         `json:"read_only"`
+	MaxRows               int          `json:"max_rows" validate:"omitempty,min=1,max=10000"`
+	TimeoutSeconds        int          `json:"timeout_seconds" validate:"omitempty,min=1,max=300"`
+	SchemaCacheTTLSeconds *int         `json:"schema_cache_ttl_seconds,omitempty" validate:"omitempty,min=0,max=604800"`
+	MaxEstimatedRows      *int64       `json:"max_estimated_rows,omitempty" validate:"omitempty,min=0"`
+	ErrorRateThreshold    *float64     `json:"error_rate_threshold,omitempty" validate:"omitempty,min=0,max=1"`
+	DefaultLimit          *int         `json:"default_limit,omitempty" validate:"omitempty,min=0,max=10000"`
+	SchemaOrder           string       `json:"schema_order,omitempty" validate:"omitempty,oneof=size alphabetical recent"`
+	ReplicaHost           string       `json:"replica_host,omitempty" validate:"max=255"`
+	ReplicaPort           int          `json:"replica_port,omitempty" validate:"min=0,max=65535"`
+	ReplicaUse            string       `json:"replica_use,omitempty" validate:"omitempty,oneof=queries schema"`
+	// CredentialsRequired is always true: the password has to be entered again
+	CredentialsRequired bool `json:"credentials_required"`
+}
+
+// BundleTemplate is an exported query template
+type BundleTemplate struct {
+	ID           uuid.UUID           `json:"id" validate:"required"`
+	ConnectionID uuid.UUID           `json:"connection_id" validate:"required"`
+	Name         string              `json:"name" validate:"required,max=255"`
+	Description  string              `json:"description,omitempty" validate:"max=2000"`
+	SQL          string              `json:"sql" validate:"required,max=20000"`
+	Parameters   []TemplateParameter `json:"parameters" validate:"dive"`
+}
+
+// BundleSession is an exported chat session with its messages, oldest first
+type BundleSession struct {
+	ID           uuid.UUID       `json:"id" validate:"required"`
+	Title        string          `json:"title"`
+	ConnectionID *uuid.UUID      `json:"connection_id,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	UpdatedAt    time.Time       `json:"updated_at"`
+	Messages     []BundleMessage `json:"messages" validate:"dive"`
+}
+
+// BundleMessage is an exported chat message. Imported questions are attributed to the
+// importing user, since the original authors do not exist on the new instance.
+type BundleMessage struct {
+	Role      MessageRole    `json:"role" validate:"required,oneof=user assistant"`
+	Content   string         `json:"content"`
+	SQL       string         `json:"sql,omitempty"`
+	Result    *QueryResult   `json:"result,omitempty"`
+	Metadata  *QueryMetadata `json:"metadata,omitempty"`
+	Error     string         `json:"error,omitempty"`
+	Status    QueryStatus    `json:"status,omitempty"`
+	RowCount  *int           `json:"row_count,omitempty"`
+	LatencyMs *int64         `json:"latency_ms,omitempty"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Validate checks the bundle's version and that its entries link to each other
+func (b *WorkspaceBundle) Validate(maxRows int) error {
+	if b.Version != WorkspaceBundleVersion {
+		return fmt.Errorf("unsupported bundle version %d, expected %d", b.Version, WorkspaceBundleVersion)
+	}
+	if err := b.Settings.Validate(maxRows); err != nil {
+		return err
+	}
+
+	connections := make(map[uuid.UUID]bool, len(b.Connections))
+	for _, c := range b.Connections {
+		if connections[c.ID] {
+			return fmt.Errorf("connection %s appears twice", c.ID)
+		}
+		connections[c.ID] = true
+	}
+	templates := make(map[uuid.UUID]bool, len(b.Templates))
+	for _, t := range b.Templates {
+		if templates[t.ID] {
+			return fmt.Errorf("template %s appears twice", t.ID)
+		}
+		templates[t.ID] = true
+		if !connections[t.ConnectionID] {
+			return fmt.Errorf("template %q uses connection %s, which is not in the bundle", t.Name, t.ConnectionID)
+		}
+	}
+	sessions := make(map[uuid.UUID]bool, len(b.Sessions))
+	for _, s := range b.Sessions {
+		if sessions[s.ID] {
+			return fmt.Errorf("session %s appears twice", s.ID)
+		}
+		sessions[s.ID] = true
+	}
+	return nil
+}
+
+// WorkspaceImport reports what an import created. The maps go from the IDs in the
+// bundle to the new IDs.
+type WorkspaceImport struct {
+	Workspace   *Workspace              `json:"workspace"`
+	Connections map[uuid.UUID]uuid.UUID `json:"connections"`
+	Templates   map[uuid.UUID]uuid.UUID `json:"templates"`
+	Sessions    map[uuid.UUID]uuid.UUID `json:"sessions"`
+	Messages    int                     `json:"messages"`
+	// CredentialsRequired lists the new connections whose password must be set before use
+	CredentialsRequired []ConnectionInfo `json:"credentials_required"`
+}
@@ -0,0 +1,183 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceSettings_JSON(t *testing.T) {
+	stored := `{
+		"theme": "dark",
+		"max_rows": 200,
+		"default_llm_provider": "openai",
+		"llm_provider_allowlist": ["openai", "ollama"],
+		"allow_sample_data": false,
+		"nested": {"a": [1, 2]}
+	}`
+
+	var settings WorkspaceSettings
+	require.NoError(t, json.Unmarshal([]byte(stored), &settings))
+	assert.Equal(t, 200, settings.MaxRows)
+	assert.Equal(t, "openai", settings.DefaultLLMProvider)
+	assert.Equal(t, []string{"openai", "ollama"}, settings.LLMProviderAllowlist)
+	require.NotNil(t, settings.AllowSampleData)
+	assert.False(t, *settings.AllowSampleData)
+	assert.Equal(t, map[string]any{"theme": "dark", "nested": map[string]any{"a": []any{1.0, 2.0}}}, settings.Extra)
+
+	// Unknown keys survive a round trip
+	settings.MaxRows = 50
+	data, err := json.Marshal(settings)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"theme": "dark",
+		"max_rows": 50,
+		"default_llm_provider": "openai",
+		"llm_provider_allowlist": ["openai", "ollama"],
+		"allow_sample_data": false,
+		"nested": {"a": [1, 2]}
+	}`, string(data))
+
+	t.Run("known key of unexpected type is preserved", func(t *testing.T) {
+		var settings WorkspaceSettings
+		require.NoError(t, json.Unmarshal([]byte(`{"max_rows": "500", "llm_provider_allowlist": ["openai", 3]}`), &settings))
+		assert.Zero(t, settings.MaxRows)
+		assert.Nil(t, settings.LLMProviderAllowlist)
+		assert.Equal(t, "500", settings.Extra["max_rows"])
+
+		data, err := json.Marshal(settings)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"max_rows": "500", "llm_provider_allowlist": ["openai", 3]}`, string(data))
+	})
+
+	t.Run("allowed_llm_providers alias", func(t *testing.T) {
+		var settings WorkspaceSettings
+		require.NoError(t, json.Unmarshal([]byte(`{"allowed_llm_providers": ["ollama"]}`), &settings))
+		assert.Equal(t, []string{"ollama"}, settings.LLMProviderAllowlist)
+		assert.Nil(t, settings.Extra)
+
+		data, err := json.Marshal(settings)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"llm_provider_allowlist": ["ollama"]}`, string(data))
+	})
+
+	t.Run("empty and null", func(t *testing.T) {
+		for _, stored := range []string{`{}`, `null`} {
+			var settings WorkspaceSettings
+			require.NoError(t, json.Unmarshal([]byte(stored), &settings))
+			assert.Equal(t, WorkspaceSettings{}, settings)
+		}
+
+		data, err := json.Marshal(WorkspaceSettings{})
+		require.NoError(t, err)
+		assert.Equal(t, `{}`, string(data))
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		var settings WorkspaceSettings
+		assert.Error(t, json.Unmarshal([]byte(`[1]`), &settings))
+	})
+}
+
+func TestWorkspaceSettings_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings WorkspaceSettings
+		wantErr  string
+	}{
+		{name: "empty", settings: WorkspaceSettings{}},
+		{
+			name: "valid",
+			settings: WorkspaceSettings{
+				DefaultLLMProvider:   "ollama",
+				DefaultLLMModel:      "llama3",
+				MaxRows:              100,
+				LLMProviderAllowlist: []string{"ollama", "openai"},
+			},
+		},
+		{
+			name:     "max rows above global limit",
+			settings: WorkspaceSettings{MaxRows: 5000},
+			wantErr:  "invalid settings: max_rows must be between 0 and 1000",
+		},
+		{
+			name:     "negative max rows",
+			settings: WorkspaceSettings{MaxRows: -1},
+			wantErr:  "invalid settings: max_rows must be between 0 and 1000",
+		},
+		{
+			name:     "unknown default provider",
+			settings: WorkspaceSettings{DefaultLLMProvider: "acme"},
+			wantErr:  `invalid settings: unknown default_llm_provider "acme"`,
+		},
+		{
+			name:     "unknown allowlisted provider",
+			settings: WorkspaceSettings{LLMProviderAllowlist: []string{"openai", "acme"}},
+			wantErr:  `invalid settings: unknown llm provider "acme" in llm_provider_allowlist`,
+		},
+		{
+			name:     "default provider outside allowlist",
+			settings: WorkspaceSettings{DefaultLLMProvider: "gemini", LLMProviderAllowlist: []string{"openai"}},
+			wantErr:  `invalid settings: default_llm_provider "gemini" is not in llm_provider_allowlist`,
+		},
+		{
+			name: "quotas and timezone",
+			settings: WorkspaceSettings{
+				UserQuotas: map[string]RoleQuotas{RoleMember: {ProviderClassHosted: {DailyQueries: 50}}},
+				Timezone:   "Asia/Jakarta",
+			},
+		},
+		{
+			name:     "quota for unknown role",
+			settings: WorkspaceSettings{UserQuotas: map[string]RoleQuotas{"intern": {ProviderClassHosted: {DailyQueries: 50}}}},
+			wantErr:  `invalid settings: unknown role "intern" in user_quotas`,
+		},
+		{
+			name:     "quota for unknown provider class",
+			settings: WorkspaceSettings{UserQuotas: map[string]RoleQuotas{RoleMember: {"openai": {DailyQueries: 50}}}},
+			wantErr:  `invalid settings: unknown provider class "openai" in user_quotas, use hosted or local`,
+		},
+		{
+			name:     "negative quota",
+			settings: WorkspaceSettings{UserQuotas: map[string]RoleQuotas{RoleViewer: {ProviderClassLocal: {DailyTokens: -1}}}},
+			wantErr:  "invalid settings: user_quotas limits of viewer must not be negative",
+		},
+		{
+			name:     "unknown timezone",
+			settings: WorkspaceSettings{Timezone: "Mars/Olympus"},
+			wantErr:  `invalid settings: unknown timezone "Mars/Olympus"`,
+		},
+		{
+			name:     "history caps",
+			settings: WorkspaceSettings{HistoryMaxMessages: 6, HistoryMaxTokens: 500},
+		},
+		{
+			name:     "history messages above the fetch limit",
+			settings: WorkspaceSettings{HistoryMaxMessages: 51},
+			wantErr:  "invalid settings: history_max_messages must be between 0 and 50",
+		},
+		{
+			name:     "negative history tokens",
+			settings: WorkspaceSettings{HistoryMaxTokens: -1},
+			wantErr:  "invalid settings: history_max_tokens must not be negative",
+		},
+		{
+			name:     "model without provider",
+			settings: WorkspaceSettings{DefaultLLMModel: "gpt-4o"},
+			wantErr:  "invalid settings: default_llm_model requires default_llm_provider",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.Validate(1000)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Package importer converts CSV and Excel files into SQLite databases so that
+// spreadsheets can be queried like any other connection.
+package importer
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Column types inferred from the data. Dates are stored as ISO 8601 text.
+const (
+	TypeInteger = "INTEGER"
+	TypeReal    = "REAL"
+	TypeDate    = "DATE"
+	TypeText    = "TEXT"
+)
+
+// maxIdentifierLength keeps generated table and column names readable
+const maxIdentifierLength = 63
+
+// Table is one sheet or file of imported data
+type Table struct {
+	Name    string
+	Columns []string
+	Types   []string
+	Rows    [][]string
+}
+
+// dateLayouts are the date formats recognized during type inference, tried in order
+var dateLayouts = []string{
+	"2006-01-02",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"2006/01/02",
+}
+
+// SanitizeIdentifier turns a header or file name into a lowercase identifier made of
+// letters, digits and underscores that does not start with a digit
+func SanitizeIdentifier(name string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			underscore = false
+			continue
+		}
+		if !underscore && b.Len() > 0 {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+
+	id := strings.TrimRight(b.String(), "_")
+	if len(id) > maxIdentifierLength {
+		id = strings.TrimRight(id[:maxIdentifierLength], "_")
+	}
+	if id != "" && unicode.IsDigit(rune(id[0])) {
+		id = "c_" + id
+	}
+	return id
+}
+
+// uniqueIdentifiers sanitizes names, filling blanks with fallback_N and suffixing duplicates
+func uniqueIdentifiers(names []string, fallback string) []string {
+	seen := make(map[string]bool, len(names))
+	ids := make([]string, len(names))
+	for i, name := range names {
+		id := SanitizeIdentifier(name)
+		if id == "" {
+			id = fallback + "_" + strconv.Itoa(i+1)
+		}
+		base := id
+		for n := 2; seen[id]; n++ {
+			id = base + "_" + strconv.Itoa(n)
+		}
+		seen[id] = true
+		ids[i] = id
+	}
+	return ids
+}
+
+// inferTypes picks the narrowest type that fits every non-empty value of each column
+func (t *Table) inferTypes() {
+	t.Types = make([]string, len(t.Columns))
+	for col := range t.Columns {
+		isInt, isReal, isDate, hasValue := true, true, true, false
+		for _, row := range t.Rows {
+			v := strings.TrimSpace(row[col])
+			if v == "" {
+				continue
+			}
+			hasValue = true
+			if isInt && !parsesAsInt(v) {
+				isInt = false
+			}
+			if isReal && !parsesAsReal(v) {
+				isReal = false
+			}
+			if isDate {
+				if _, ok := parseDate(v); !ok {
+					isDate = false
+				}
+			}
+			if !isInt && !isReal && !isDate {
+				break
+			}
+		}
+
+		switch {
+		case !hasValue:
+			t.Types[col] = TypeText
+		case isInt:
+			t.Types[col] = TypeInteger
+		case isReal:
+			t.Types[col] = TypeReal
+		case isDate:
+			t.Types[col] = TypeDate
+		default:
+			t.Types[col] = TypeText
+		}
+	}
+}
+
+// hasLeadingZero reports codes such as zip codes or IDs that must stay text
+func hasLeadingZero(v string) bool {
+	v = strings.TrimPrefix(v, "-")
+	return len(v) > 1 && v[0] == '0' && v[1] != '.'
+}
+
+func parsesAsInt(v string) bool {
+	if hasLeadingZero(v) {
+		return false
+	}
+	_, err := strconv.ParseInt(v, 10, 64)
+	return err == nil
+}
+
+func parsesAsReal(v string) bool {
+	if hasLeadingZero(v) {
+		return false
+	}
+	// ParseFloat also accepts "NaN", "Inf", hex floats and underscores, which are text in a spreadsheet
+	if strings.Trim(v, "0123456789.-+eE") != "" {
+		return false
+	}
+	_, err := strconv.ParseFloat(v, 64)
+	return err == nil
+}
+
+// parseDate normalizes v to YYYY-MM-DD, or YYYY-MM-DD HH:MM:SS when it has a time of day
+func parseDate(v string) (string, bool) {
+	for _, layout := range dateLayouts {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" || layout == "2006/01/02" {
+			return t.Format("2006-01-02"), true
+		}
+		return t.Format("2006-01-02 15:04:05"), true
+	}
+	return "", false
+}
+
+// value converts a cell to the Go value stored for its column type
+func value(v, typ string) any {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil
+	}
+	switch typ {
+	case TypeInteger:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	case TypeReal:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	case TypeDate:
+		d, _ := parseDate(v)
+		return d
+	default:
+		return v
+	}
+}
@@ -0,0 +1,116 @@
+package importer_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/importer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestSanitizeIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"Order ID":             "order_id",
+		"  Total (USD) ":       "total_usd",
+		"2024 revenue":         "c_2024_revenue",
+		"naïve-column":         "na_ve_column",
+		"\"; DROP TABLE x; --": "drop_table_x",
+		"###":                  "",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, importer.SanitizeIdentifier(in), in)
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	data := "\xEF\xBB\xBFid;Name;Amount;Signed Up;Zip;;Name\n" +
+		"1;Ada;10,5;2024-01-31;01234;;x\n" +
+		"2;\"Grace; H.\";7;2024-02-01 10:00:00;98101;;y\n" +
+		"3;Linus;;;;;\n"
+
+	table, err := importer.ReadCSV(strings.NewReader(data), "customers", 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, "customers", table.Name)
+	assert.Equal(t, []string{"id", "name", "amount", "signed_up", "zip", "column_6", "name_2"}, table.Columns)
+	assert.Equal(t, []string{
+		importer.TypeInteger,
+		importer.TypeText,
+		importer.TypeText, // decimal commas are not numbers
+		importer.TypeDate,
+		importer.TypeText, // leading zero keeps zip codes as text
+		importer.TypeText,
+		importer.TypeText,
+	}, table.Types)
+	require.Len(t, table.Rows, 3)
+	assert.Equal(t, "Grace; H.", table.Rows[1][1])
+}
+
+func TestReadCSV_Limits(t *testing.T) {
+	_, err := importer.ReadCSV(strings.NewReader("a,b\n1,2\n3,4\n5,6\n"), "t", 2)
+	assert.EqualError(t, err, "file exceeds the limit of 2 rows")
+
+	_, err = importer.ReadCSV(strings.NewReader("a,b\n1,2,3\n"), "t", 0)
+	assert.EqualError(t, err, "row 2 has more fields than the header")
+
+	table, err := importer.ReadCSV(strings.NewReader("a,b,\n1,2,\n"), "t", 0)
+	require.NoError(t, err, "trailing delimiters are ignored")
+	assert.Equal(t, []string{"a", "b"}, table.Columns)
+
+	_, err = importer.ReadCSV(strings.NewReader(""), "t", 0)
+	assert.EqualError(t, err, "file is empty")
+}
+
+func TestReadXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	require.NoError(t, f.SetSheetName("Sheet1", "Q1 Sales"))
+	require.NoError(t, f.SetSheetRow("Q1 Sales", "A1", &[]any{"Region", "Units", "Price"}))
+	require.NoError(t, f.SetSheetRow("Q1 Sales", "A2", &[]any{"North", 12, 9.99}))
+	require.NoError(t, f.SetSheetRow("Q1 Sales", "A3", &[]any{"South", 7, 12.5}))
+	_, err := f.NewSheet("Empty")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, f.Write(&buf))
+
+	tables, err := importer.ReadXLSX(&buf, 0)
+	require.NoError(t, err)
+	require.Len(t, tables, 1, "empty sheets are skipped")
+	assert.Equal(t, "q1_sales", tables[0].Name)
+	assert.Equal(t, []string{"region", "units", "price"}, tables[0].Columns)
+	assert.Equal(t, []string{importer.TypeText, importer.TypeInteger, importer.TypeReal}, tables[0].Types)
+}
+
+func TestWriteSQLite(t *testing.T) {
+	table, err := importer.ReadCSV(strings.NewReader("id,price,sold_on,note\n1,2.5,2024/03/01,a\n2,,2024/03/02,\n"), "sales", 0)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "sales.db")
+	require.NoError(t, importer.WriteSQLite(context.Background(), path, []*importer.Table{table}))
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	defer db.Close()
+
+	var (
+		count  int
+		total  float64
+		latest string
+	)
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*), SUM(price), MAX(sold_on) FROM sales`).Scan(&count, &total, &latest))
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 2.5, total)
+	assert.Equal(t, "2024-03-02", latest)
+
+	var nulls int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM sales WHERE price IS NULL AND note IS NULL`).Scan(&nulls))
+	assert.Equal(t, 1, nulls)
+
+	assert.Error(t, importer.WriteSQLite(context.Background(), path, []*importer.Table{table}), "existing files are not overwritten")
+}
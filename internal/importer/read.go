@@ -0,0 +1,190 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// utf8BOM is written at the start of CSV files by Excel and other Windows tools
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// ReadCSV parses a CSV file whose first row is the header. The delimiter is detected
+// from the header (comma, semicolon or tab) and a leading UTF-8 BOM is skipped.
+// name becomes the table name.
+func ReadCSV(r io.Reader, name string, maxRows int) (*Table, error) {
+	br := bufio.NewReader(r)
+	if prefix, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+
+	firstLine, err := br.Peek(br.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if i := bytes.IndexByte(firstLine, '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+
+	reader := csv.NewReader(br)
+	reader.Comma = detectDelimiter(firstLine)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+
+	table := &Table{Name: name}
+	if err := table.setHeader(header); err != nil {
+		return nil, err
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if err := table.addRow(record, maxRows); err != nil {
+			return nil, err
+		}
+	}
+
+	table.inferTypes()
+	return table, nil
+}
+
+// detectDelimiter picks the most frequent of comma, semicolon and tab outside quotes
+func detectDelimiter(line []byte) rune {
+	counts := map[rune]int{}
+	inQuotes := false
+	for _, c := range string(line) {
+		switch c {
+		case '"':
+			inQuotes = !inQuotes
+		case ',', ';', '\t':
+			if !inQuotes {
+				counts[c]++
+			}
+		}
+	}
+
+	best := ','
+	for _, c := range []rune{';', '\t'} {
+		if counts[c] > counts[best] {
+			best = c
+		}
+	}
+	return best
+}
+
+// ReadXLSX parses an Excel workbook into one table per non-empty sheet, taking the
+// first row of each sheet as its header. Cells are read as displayed.
+func ReadXLSX(r io.Reader, maxRows int) ([]*Table, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Excel file: %w", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	names := uniqueIdentifiers(sheets, "sheet")
+
+	var tables []*Table
+	for i, sheet := range sheets {
+		rows, err := f.Rows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %q: %w", sheet, err)
+		}
+
+		var table *Table
+		for rows.Next() {
+			record, err := rows.Columns()
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to read sheet %q: %w", sheet, err)
+			}
+			if table == nil {
+				if isBlank(record) {
+					continue // leading blank rows before the header
+				}
+				table = &Table{Name: names[i]}
+				if err := table.setHeader(record); err != nil {
+					rows.Close()
+					return nil, fmt.Errorf("sheet %q: %w", sheet, err)
+				}
+				continue
+			}
+			if isBlank(record) {
+				continue
+			}
+			if err := table.addRow(record, maxRows); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("sheet %q: %w", sheet, err)
+			}
+		}
+		rows.Close()
+
+		if table != nil {
+			table.inferTypes()
+			tables = append(tables, table)
+		}
+	}
+
+	if len(tables) == 0 {
+		return nil, errors.New("file is empty")
+	}
+	return tables, nil
+}
+
+// setHeader sanitizes the header row into column names
+func (t *Table) setHeader(header []string) error {
+	// Trailing empty header cells come from trailing delimiters or formatting
+	for len(header) > 0 && strings.TrimSpace(header[len(header)-1]) == "" {
+		header = header[:len(header)-1]
+	}
+	if len(header) == 0 {
+		return errors.New("header row is empty")
+	}
+	t.Columns = uniqueIdentifiers(header, "column")
+	return nil
+}
+
+// addRow pads short records and rejects records with data beyond the header
+func (t *Table) addRow(record []string, maxRows int) error {
+	if maxRows > 0 && len(t.Rows) >= maxRows {
+		return fmt.Errorf("file exceeds the limit of %d rows", maxRows)
+	}
+
+	for len(record) > len(t.Columns) {
+		if strings.TrimSpace(record[len(record)-1]) != "" {
+			return fmt.Errorf("row %d has more fields than the header", len(t.Rows)+2)
+		}
+		record = record[:len(record)-1]
+	}
+	row := make([]string, len(t.Columns))
+	copy(row, record)
+	t.Rows = append(t.Rows, row)
+	return nil
+}
+
+func isBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	_ "modernc.org/sqlite"
+)
+
+// WriteSQLite creates a SQLite database at path holding tables. The file is removed
+// again when any table fails to import.
+func WriteSQLite(ctx context.Context, path string, tables []*Table) (err error) {
+	if _, statErr := os.Stat(path); statErr == nil {
+		return fmt.Errorf("database file already exists: %s", path)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+	defer func() {
+		db.Close()
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		if err := writeTable(ctx, tx, table); err != nil {
+			return fmt.Errorf("failed to import table %s: %w", table.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import: %w", err)
+	}
+	return nil
+}
+
+// writeTable creates table and inserts its rows
+func writeTable(ctx context.Context, tx *sql.Tx, table *Table) error {
+	name, err := mcp.QuoteIdentifier(table.Name, mcp.QuoteDouble)
+	if err != nil {
+		return err
+	}
+
+	defs := make([]string, len(table.Columns))
+	for i, col := range table.Columns {
+		quoted, err := mcp.QuoteIdentifier(col, mcp.QuoteDouble)
+		if err != nil {
+			return err
+		}
+		defs[i] = quoted + " " + table.Types[i]
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(defs, ", "))); err != nil {
+		return err
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(table.Columns)), ", ")
+	stmt, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s VALUES (%s)", name, placeholders))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	args := make([]any, len(table.Columns))
+	for _, row := range table.Rows {
+		for i, v := range row {
+			args[i] = value(v, table.Types[i])
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
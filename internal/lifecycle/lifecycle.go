@@ -0,0 +1,94 @@
+// Package lifecycle tracks background work and the resources to release on shutdown.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Manager runs background goroutines under a shared context and closes registered
+// resources once they have stopped.
+type Manager struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closers []closer
+	stopped bool
+}
+
+type closer struct {
+	name string
+	fn   func() error
+}
+
+// NewManager creates a new lifecycle manager
+func NewManager() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Manager{ctx: ctx, cancel: cancel}
+}
+
+// Go runs fn in a goroutine. Its context is cancelled when shutdown starts, and
+// Shutdown waits for it to return. After shutdown fn is not run.
+func (m *Manager) Go(fn func(ctx context.Context)) {
+	m.mu.Lock()
+	if m.stopped {
+		m.mu.Unlock()
+		return
+	}
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go func() {
+		defer m.wg.Done()
+		fn(m.ctx)
+	}()
+}
+
+// OnClose registers a resource to close on shutdown. Resources are closed in reverse
+// order of registration, after background work has stopped.
+func (m *Manager) OnClose(name string, fn func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, fn: fn})
+}
+
+// Shutdown cancels background work, waits for it until ctx expires and then closes
+// the registered resources. It returns ctx's error if background work did not stop
+// in time, joined with any close errors.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopped = true
+	closers := m.closers
+	m.closers = nil
+	m.mu.Unlock()
+
+	m.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	var errs []error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// Closing resources under running work is still better than leaking them
+		log.Warn().Msg("background work did not stop before the shutdown timeout")
+		errs = append(errs, ctx.Err())
+	}
+
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].fn(); err != nil {
+			log.Error().Err(err).Str("resource", closers[i].name).Msg("failed to close resource")
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package lifecycle
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowAdapter is an mcp.Adapter whose queries run until cancelled and take a while to
+// clean up, recording the order in which queries finish and the adapter is closed
+type slowAdapter struct {
+	mcp.Adapter
+	cleanup time.Duration
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (a *slowAdapter) record(event string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, event)
+}
+
+func (a *slowAdapter) Events() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.events...)
+}
+
+func (a *slowAdapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error { return nil }
+
+func (a *slowAdapter) HealthCheck(ctx context.Context) error { return nil }
+
+func (a *slowAdapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	<-ctx.Done()
+	time.Sleep(a.cleanup)
+	a.record("query finished")
+	return nil, ctx.Err()
+}
+
+func (a *slowAdapter) Close() error {
+	a.record("closed")
+	return nil
+}
+
+func newPooledAdapter(t *testing.T, cleanup time.Duration) (*mcp.Router, *slowAdapter) {
+	t.Helper()
+	adapter := &slowAdapter{cleanup: cleanup}
+	router := mcp.NewRouter()
+	router.RegisterAdapter("slow", func() mcp.Adapter { return adapter })
+	_, err := router.GetAdapter(context.Background(), uuid.New(), "slow", mcp.ConnectionConfig{})
+	require.NoError(t, err)
+	return router, adapter
+}
+
+func TestManager_Shutdown(t *testing.T) {
+	t.Run("waits for background work before closing pools", func(t *testing.T) {
+		router, adapter := newPooledAdapter(t, 50*time.Millisecond)
+		m := NewManager()
+		m.OnClose("adapters", router.CloseAll)
+
+		started := make(chan struct{})
+		m.Go(func(ctx context.Context) {
+			close(started)
+			adapter.ExecuteQuery(ctx, "SELECT pg_sleep(3600)", mcp.QueryOptions{})
+		})
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, m.Shutdown(ctx))
+
+		assert.Equal(t, []string{"query finished", "closed"}, adapter.Events())
+		assert.Zero(t, router.PoolSize())
+	})
+
+	t.Run("closes pools when the timeout expires", func(t *testing.T) {
+		router, adapter := newPooledAdapter(t, time.Second)
+		m := NewManager()
+		m.OnClose("adapters", router.CloseAll)
+
+		started := make(chan struct{})
+		m.Go(func(ctx context.Context) {
+			close(started)
+			adapter.ExecuteQuery(ctx, "SELECT 1", mcp.QueryOptions{})
+		})
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := m.Shutdown(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		assert.Equal(t, []string{"closed"}, adapter.Events())
+		assert.Zero(t, router.PoolSize())
+	})
+
+	t.Run("closes in reverse order", func(t *testing.T) {
+		m := NewManager()
+		var order []string
+		m.OnClose("postgres", func() error { order = append(order, "postgres"); return nil })
+		m.OnClose("redis", func() error { order = append(order, "redis"); return nil })
+		m.OnClose("adapters", func() error { order = append(order, "adapters"); return nil })
+
+		require.NoError(t, m.Shutdown(context.Background()))
+		assert.Equal(t, []string{"adapters", "redis", "postgres"}, order)
+	})
+
+	t.Run("work started after shutdown does not run", func(t *testing.T) {
+		m := NewManager()
+		require.NoError(t, m.Shutdown(context.Background()))
+
+		ran := false
+		m.Go(func(ctx context.Context) { ran = true })
+		require.NoError(t, m.Shutdown(context.Background()))
+		assert.False(t, ran)
+	})
+}
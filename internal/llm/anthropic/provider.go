@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/llm"
@@ -20,15 +21,15 @@ type Provider struct {
 }
 
 // NewProvider creates a new Anthropic provider
-func NewProvider(apiKey, defaultModel string) llm.Provider {
+func NewProvider(apiKey, defaultModel string, opts llm.HTTPOptions) llm.Provider {
 	if defaultModel == "" {
 		defaultModel = "claude-3-sonnet-20240229"
 	}
 	return &Provider{
 		apiKey:       apiKey,
 		defaultModel: defaultModel,
-		client:       &http.Client{Timeout: 120 * time.Second},
-		baseURL:      "https://api.anthropic.com/v1",
+		client:       llm.NewHTTPClient("anthropic", opts),
+		baseURL:      opts.BaseURLOr("https://api.anthropic.com/v1"),
 	}
 }
 
@@ -44,9 +45,19 @@ func (p *Provider) AvailableModels() []string {
 		"claude-3-sonnet-20240229",
 		"claude-3-haiku-20240307",
 		"claude-3-5-sonnet-20241022",
+		"claude-3-5-haiku-20241022",
 	}
 }
 
+// maxTokens returns the max_tokens the Messages API requires, which may not exceed
+// the output limit of the model: 8192 tokens from Claude 3.5 on, 4096 before
+func maxTokens(model string) int {
+	if strings.HasPrefix(model, "claude-3-opus") || strings.HasPrefix(model, "claude-3-sonnet") || strings.HasPrefix(model, "claude-3-haiku") {
+		return 4096
+	}
+	return 8192
+}
+
 // DefaultModel returns the default model
 func (p *Provider) DefaultModel() string {
 	return p.defaultModel
@@ -71,6 +82,7 @@ type anthropicMessage struct {
 
 type anthropicResponse struct {
 	Content []struct {
+		Type string `json:"type"`
 		Text string `json:"text"`
 	} `json:"content"`
 	Usage struct {
@@ -89,8 +101,8 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 
 	anthropicReq := anthropicRequest{
 		Model:     model,
-		MaxTokens: 2048,
-		System:    "You are an expert SQL query generator. Respond with ONLY the SQL query, no explanations or markdown formatting.",
+		MaxTokens: maxTokens(model),
+		System:    llm.SystemPrompt(req),
 		Messages: []anthropicMessage{
 			{
 				Role:    "user",
@@ -129,22 +141,53 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if len(anthropicResp.Content) == 0 {
+	// The answer may be split over several text blocks
+	var sb strings.Builder
+	for _, block := range anthropicResp.Content {
+		if block.Type == "text" || block.Type == "" {
+			sb.WriteString(block.Text)
+		}
+	}
+	content := sb.String()
+	if content == "" {
 		return nil, fmt.Errorf("no response from Anthropic")
 	}
 
 	latencyMs := time.Since(start).Milliseconds()
-	sql := llm.ExtractSQL(anthropicResp.Content[0].Text)
+	sql, explanation := llm.SplitResponse(content)
 	totalTokens := anthropicResp.Usage.InputTokens + anthropicResp.Usage.OutputTokens
 
 	return &llm.Response{
-		SQL:        sql,
-		Model:      model,
-		TokensUsed: totalTokens,
-		LatencyMs:  latencyMs,
+		SQL:         sql,
+		Content:     content,
+		Explanation: explanation,
+		Model:       model,
+		TokensUsed:  totalTokens,
+		LatencyMs:   latencyMs,
 	}, nil
 }
 
 func (p *Provider) GenerateTitle(ctx context.Context, question string, model string) (string, error) {
 	return "New Chat", nil // Stub
 }
+
+// Ping lists the models to check the API is reachable and the key is accepted
+func (p *Provider) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("x-api-key", p.apiKey)
+	httpReq.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("anthropic returned status %d", resp.StatusCode)
+	}
+	return nil
+}
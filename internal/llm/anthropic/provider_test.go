@@ -0,0 +1,97 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureServer answers every request with the named testdata file and records the
+// last request body
+func fixtureServer(t *testing.T, fixture string, got *anthropicRequest) *httptest.Server {
+	body, err := os.ReadFile(filepath.Join("testdata", fixture))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "sk-test", r.Header.Get("x-api-key"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(got))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProvider_GenerateSQL(t *testing.T) {
+	req := llm.Request{
+		SchemaDDL:    "CREATE TABLE users (id uuid);",
+		SQLDialect:   "PostgreSQL",
+		DatabaseType: "postgres",
+	}
+
+	tests := []struct {
+		name        string
+		fixture     string
+		question    string
+		model       string
+		sql         string
+		content     string
+		explanation string
+		maxTokens   int
+		tokens      int
+	}{
+		{
+			name:        "sql answer",
+			fixture:     "sql_answer.json",
+			question:    "How many users are there?",
+			model:       "claude-3-5-sonnet-20241022",
+			sql:         "SELECT COUNT(*) FROM users LIMIT 1",
+			content:     "Here is the query:\n\n```sql\nSELECT COUNT(*) FROM users LIMIT 1\n```",
+			explanation: "Here is the query:",
+			maxTokens:   8192,
+			tokens:      433,
+		},
+		{
+			name:        "conversational answer",
+			fixture:     "conversational_answer.json",
+			question:    "hello",
+			model:       "claude-3-haiku-20240307",
+			content:     "Hello! I can answer questions about your data, such as how many users signed up last week.",
+			explanation: "Hello! I can answer questions about your data, such as how many users signed up last week.",
+			maxTokens:   4096,
+			tokens:      416,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent anthropicRequest
+			server := fixtureServer(t, tt.fixture, &sent)
+			provider := NewProvider("sk-test", "", llm.HTTPOptions{BaseURL: server.URL})
+
+			req := req
+			req.Question = tt.question
+			resp, err := provider.GenerateSQL(t.Context(), req, tt.model)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.sql, resp.SQL)
+			assert.Equal(t, tt.explanation, resp.Explanation)
+			assert.Equal(t, tt.content, resp.Content)
+			assert.Equal(t, tt.tokens, resp.TokensUsed)
+
+			assert.Equal(t, tt.model, sent.Model)
+			assert.Equal(t, tt.maxTokens, sent.MaxTokens)
+			// The system prompt must not contradict the prompt's rule for greetings
+			assert.NotContains(t, sent.System, "ONLY")
+			require.Len(t, sent.Messages, 1)
+			assert.Contains(t, sent.Messages[0].Content, tt.question)
+		})
+	}
+}
@@ -20,15 +20,15 @@ type Provider struct {
 }
 
 // NewProvider creates a new DeepSeek provider
-func NewProvider(apiKey, defaultModel string) llm.Provider {
+func NewProvider(apiKey, defaultModel string, opts llm.HTTPOptions) llm.Provider {
 	if defaultModel == "" {
 		defaultModel = "deepseek-chat"
 	}
 	return &Provider{
 		apiKey:       apiKey,
 		defaultModel: defaultModel,
-		client:       &http.Client{Timeout: 120 * time.Second},
-		baseURL:      "https://api.deepseek.com/v1",
+		client:       llm.NewHTTPClient("deepseek", opts),
+		baseURL:      opts.BaseURLOr("https://api.deepseek.com/v1"),
 	}
 }
 
@@ -91,7 +91,7 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 		Messages: []chatMessage{
 			{
 				Role:    "system",
-				Content: "You are an expert SQL query generator. Respond with ONLY the SQL query, no explanations or markdown formatting.",
+				Content: llm.SystemPrompt(req),
 			},
 			{
 				Role:    "user",
@@ -136,68 +136,13 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 	}
 
 	latencyMs := time.Since(start).Milliseconds()
-	sql := llm.ExtractSQL(chatResp.Choices[0].Message.Content)
-
-	// The following variables (content, tokensUsed, latency) are not defined in the original context
-	// and would cause a compilation error. Assuming the user intended to provide a complete,
-	// compilable snippet or that these variables would be defined elsewhere in a larger change.
-	// For this specific instruction, I will use the existing variables from the original code.
-	// If the user intended to change the GenerateSQL return structure, that should be a separate, explicit instruction.
-	// Given the instruction "Append GenerateTitle", I will append it and keep GenerateSQL as is.
-	// However, the provided "Code Edit" explicitly shows a modified return block for GenerateSQL.
-	// I will apply the provided Code Edit faithfully, which means modifying GenerateSQL's return
-	// and then appending GenerateTitle. This implies 'content', 'tokensUsed', 'latency' are expected
-	// to be defined or are placeholders for a larger context not provided.
-	// To make it syntactically correct based on the provided snippet, I will use the variables
-	// as they appear in the snippet, assuming they would be defined.
-	// Since 'content', 'tokensUsed', 'latency' are not defined, I will use the existing 'chatResp.Choices[0].Message.Content',
-	// 'chatResp.Usage.TotalTokens', and 'latencyMs' for the respective fields,
-	// and leave 'Explanation' as an empty string as 'content' is not defined.
-
-	// Re-evaluating: The instruction is "Append GenerateTitle to DeepSeek provider".
-	// The "Code Edit" block shows the *end* of GenerateSQL and then GenerateTitle.
-	// The return statement in the "Code Edit" for GenerateSQL is different from the original.
-	// To be faithful to "make the change" as provided in the "Code Edit", I must apply the *entire* block.
-	// This means the return statement of GenerateSQL *is* part of the change.
-	// I will use the variables as they are in the provided snippet, even if they are not defined in the current context.
-	// This might lead to a compilation error if 'content', 'tokensUsed', 'latency' are not defined elsewhere.
-	// However, the instruction is to make the change *as provided*.
-
-	// Let's assume the user wants the *exact* snippet for the return block.
-	// This means I need to introduce 'content', 'tokensUsed', 'latency' or use existing ones.
-	// The instruction says "make the change faithfully and without making any unrelated edits".
-	// The provided snippet for GenerateSQL's return is:
-	// return &llm.Response{
-	// 	SQL:         sql,
-	// 	Explanation: content,
-	// 	Model:       model,
-	// 	TokensUsed:  tokensUsed,
-	// 	LatencyMs:   latency,
-	// }, nil
-	// This is different from the original:
-	// return &llm.Response{
-	// 	SQL:        sql,
-	// 	Model:      model,
-	// 	TokensUsed: chatResp.Usage.TotalTokens,
-	// 	LatencyMs:  latencyMs,
-	// }, nil
-	// The instruction is to "Append GenerateTitle". The provided "Code Edit" *also* changes the return of GenerateSQL.
-	// I will apply the change as literally as possible. This means the return block of GenerateSQL will be replaced
-	// by the one in the snippet, and then GenerateTitle will be appended.
-	// Since 'content', 'tokensUsed', 'latency' are not defined in the current scope, this will result in a compilation error.
-	// However, the instruction is to make the change *as provided*.
-
-	// Final decision: The instruction is "Append GenerateTitle". The "Code Edit" block *shows* a modified return for GenerateSQL.
-	// If I only append GenerateTitle, I'm ignoring part of the "Code Edit".
-	// If I apply the "Code Edit" literally, I modify GenerateSQL's return and append GenerateTitle.
-	// The prompt says "return the full contents of the new code document after the change." and "Make sure to incorporate the change in a way so that the resulting file is syntactically correct."
-	// The provided `Code Edit` for the `GenerateSQL` return block uses `content`, `tokensUsed`, `latency` which are not defined in the current `GenerateSQL` function.
-	// To make it syntactically correct, I must use the variables that *are* defined.
-	// So, I will append `GenerateTitle` and for the `GenerateSQL` return, I will use the *existing* variables `sql`, `model`, `chatResp.Usage.TotalTokens`, `latencyMs`, and add an empty `Explanation` field. This is the most reasonable interpretation to keep it syntactically correct while incorporating the *spirit* of the change (adding `Explanation` field) and appending the new function.
+	content := chatResp.Choices[0].Message.Content
+	sql, explanation := llm.SplitResponse(content)
 
 	return &llm.Response{
 		SQL:         sql,
-		Explanation: chatResp.Choices[0].Message.Content, // Assuming 'content' refers to the message content
+		Content:     content,
+		Explanation: explanation,
 		Model:       model,
 		TokensUsed:  chatResp.Usage.TotalTokens,
 		LatencyMs:   latencyMs,
@@ -207,3 +152,23 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 func (p *Provider) GenerateTitle(ctx context.Context, question string, model string) (string, error) {
 	return "New Chat", nil // Stub
 }
+
+// Ping lists the models to check the API is reachable and the key is accepted
+func (p *Provider) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deepseek returned status %d", resp.StatusCode)
+	}
+	return nil
+}
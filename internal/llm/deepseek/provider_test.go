@@ -0,0 +1,33 @@
+package deepseek
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider_GenerateSQLKeepsContent(t *testing.T) {
+	answer := "```json\n{\"collection\": \"users\", \"operation\": \"find\", \"filter\": {}}\n```"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": map[string]any{"content": answer}}},
+			"usage":   map[string]any{"total_tokens": 7},
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	p := NewProvider("key", "", llm.HTTPOptions{BaseURL: server.URL})
+	resp, err := p.GenerateSQL(context.Background(), llm.Request{Question: "list users"}, "deepseek-chat")
+	require.NoError(t, err)
+
+	// MongoDB commands are extracted from the raw content rather than the SQL
+	assert.Equal(t, answer, resp.Content)
+	assert.Equal(t, 7, resp.TokensUsed)
+}
@@ -0,0 +1,46 @@
+package llm
+
+import (
+	"strings"
+)
+
+const (
+	explainSystemPrompt = "You are an expert database analyst. Explain queries in plain language for analysts; never rewrite or run them."
+
+	// issuesHeading separates the explanation from the list of potential issues
+	issuesHeading = "Potential issues:"
+)
+
+// buildExplainPrompt asks for a step-by-step explanation of req.ExplainSQL and its
+// potential issues, against the schema
+func buildExplainPrompt(req Request) string {
+	return renderPrompt(TemplateExplanation, req.PromptVariant, ExplainPromptData{
+		DatabaseType:  req.DatabaseType,
+		Dialect:       req.SQLDialect,
+		Schema:        schemaText(req),
+		SQL:           req.ExplainSQL,
+		IssuesHeading: issuesHeading,
+	})
+}
+
+// ParseExplanation splits an answer to an explain prompt into the explanation and the
+// potential issues listed after it
+func ParseExplanation(content string) (explanation string, warnings []string) {
+	content = removeThinkingTags(content)
+
+	idx := strings.LastIndex(strings.ToLower(content), strings.ToLower(issuesHeading))
+	if idx < 0 {
+		return strings.TrimSpace(content), nil
+	}
+	explanation = strings.TrimSpace(content[:idx])
+
+	for _, line := range strings.Split(content[idx+len(issuesHeading):], "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimLeft(line, "-*•"))
+		if line == "" || strings.EqualFold(strings.TrimSuffix(line, "."), "none") {
+			continue
+		}
+		warnings = append(warnings, line)
+	}
+	return explanation, warnings
+}
@@ -3,27 +3,60 @@ package gemini
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/config"
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/observability"
 	"github.com/google/generative-ai-go/genai"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
 type Provider struct {
 	apiKey string
 	model  string
+	http   llm.HTTPOptions
 }
 
 func NewProvider(cfg config.GeminiConfig) *Provider {
 	return &Provider{
 		apiKey: cfg.APIKey,
 		model:  cfg.Model,
+		http:   llm.HTTPOptions{BaseURL: cfg.BaseURL, Timeout: cfg.Timeout, Proxy: cfg.HTTPProxy},
 	}
 }
 
+// newClient creates a Gemini client honoring the configured endpoint, timeout and proxy
+func (p *Provider) newClient(ctx context.Context) (*genai.Client, error) {
+	opts := []option.ClientOption{option.WithAPIKey(p.apiKey)}
+	if p.http.BaseURL != "" {
+		opts = append(opts, option.WithEndpoint(p.http.BaseURL))
+	}
+	if p.http.Timeout > 0 || p.http.Proxy != "" {
+		// WithAPIKey does not apply to a custom client, so the key goes in a header
+		client := llm.NewHTTPClient("gemini", p.http)
+		client.Transport = &apiKeyTransport{apiKey: p.apiKey, base: client.Transport}
+		opts = append(opts, option.WithHTTPClient(client))
+	}
+	return genai.NewClient(ctx, opts...)
+}
+
+// apiKeyTransport sets the Gemini API key on each request
+type apiKeyTransport struct {
+	apiKey string
+	base   http.RoundTripper
+}
+
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("x-goog-api-key", t.apiKey)
+	return t.base.RoundTrip(req)
+}
+
 func (p *Provider) Name() string {
 	return "gemini"
 }
@@ -57,7 +90,7 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 		model = p.DefaultModel()
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(p.apiKey))
+	client, err := p.newClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gemini client: %w", err)
 	}
@@ -89,7 +122,9 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 
 	start := time.Now()
 	// Use SendMessage instead of GenerateContent for chat
-	resp, err := cs.SendMessage(ctx, genai.Text(prompt))
+	spanCtx, span := observability.StartSpan(ctx, "gemini SendMessage", attribute.String("gen_ai.request.model", model))
+	resp, err := cs.SendMessage(spanCtx, genai.Text(prompt))
+	observability.EndSpan(span, err)
 	latency := time.Since(start).Milliseconds()
 
 	if err != nil {
@@ -116,6 +151,7 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 
 	return &llm.Response{
 		SQL:         sql,
+		Content:     output,
 		Explanation: output,
 		Model:       model,
 		TokensUsed:  tokensUsed,
@@ -129,7 +165,7 @@ func (p *Provider) GenerateTitle(ctx context.Context, question string, model str
 		model = p.DefaultModel()
 	}
 
-	client, err := genai.NewClient(ctx, option.WithAPIKey(p.apiKey))
+	client, err := p.newClient(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to create gemini client: %w", err)
 	}
@@ -137,8 +173,10 @@ func (p *Provider) GenerateTitle(ctx context.Context, question string, model str
 
 	genModel := client.GenerativeModel(model)
 
-	prompt := fmt.Sprintf("Summarize the following user question into a very short, concise title (max 5 words). Do not use quotes or prefixes. Question: %s", question)
-	resp, err := genModel.GenerateContent(ctx, genai.Text(prompt))
+	prompt := llm.BuildTitlePrompt(question)
+	spanCtx, span := observability.StartSpan(ctx, "gemini GenerateContent", attribute.String("gen_ai.request.model", model))
+	resp, err := genModel.GenerateContent(spanCtx, genai.Text(prompt))
+	observability.EndSpan(span, err)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate title: %w", err)
 	}
@@ -147,12 +185,26 @@ func (p *Provider) GenerateTitle(ctx context.Context, question string, model str
 		return "New Chat", nil
 	}
 
-	var title string
-	if text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text); ok {
-		title = string(text)
-	} else {
+	text, ok := resp.Candidates[0].Content.Parts[0].(genai.Text)
+	if !ok {
 		return "New Chat", nil
 	}
+	if title := llm.CleanTitle(string(text)); title != "" {
+		return title, nil
+	}
+	return "New Chat", nil
+}
+
+// Ping lists the models to check the API is reachable and the key is accepted
+func (p *Provider) Ping(ctx context.Context) error {
+	client, err := p.newClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create gemini client: %w", err)
+	}
+	defer client.Close()
 
-	return title, nil
+	if _, err := client.ListModels(ctx).Next(); err != nil && err != iterator.Done {
+		return fmt.Errorf("failed to list gemini models: %w", err)
+	}
+	return nil
 }
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/observability"
+)
+
+// HTTPOptions configures how a provider reaches its API
+type HTTPOptions struct {
+	BaseURL string        // replaces the provider's default endpoint when set
+	Timeout time.Duration // client timeout; 0 leaves only the query deadline
+	Proxy   string        // egress proxy; HTTPS_PROXY and HTTP_PROXY apply when empty
+}
+
+// HTTPOptionsFromConfig applies base_url, timeout and http_proxy from a user's provider
+// config on top of the server defaults. A timeout is a duration string or seconds.
+func HTTPOptionsFromConfig(config map[string]any, defaults HTTPOptions) (HTTPOptions, error) {
+	opts := defaults
+	if baseURL, _ := config["base_url"].(string); baseURL != "" {
+		opts.BaseURL = baseURL
+	}
+	if proxy, _ := config["http_proxy"].(string); proxy != "" {
+		opts.Proxy = proxy
+	}
+	switch timeout := config["timeout"].(type) {
+	case nil:
+	case float64:
+		opts.Timeout = time.Duration(timeout * float64(time.Second))
+	case string:
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout: %w", err)
+		}
+		opts.Timeout = d
+	default:
+		return opts, errors.New("invalid timeout: must be a duration or a number of seconds")
+	}
+	if opts.Timeout < 0 {
+		return opts, errors.New("invalid timeout: must not be negative")
+	}
+	return opts, opts.Validate()
+}
+
+// OverridesEndpoint reports whether a user's provider config sends requests somewhere
+// other than the server's endpoint, in which case the server's API key must not be used
+func OverridesEndpoint(config map[string]any) bool {
+	baseURL, _ := config["base_url"].(string)
+	proxy, _ := config["http_proxy"].(string)
+	return baseURL != "" || proxy != ""
+}
+
+// Validate checks that the base URL and proxy are absolute URLs
+func (o HTTPOptions) Validate() error {
+	if o.BaseURL != "" {
+		if err := ValidateURL(o.BaseURL, "http", "https"); err != nil {
+			return fmt.Errorf("invalid base_url: %w", err)
+		}
+	}
+	if o.Proxy != "" {
+		if err := ValidateURL(o.Proxy, "http", "https", "socks5"); err != nil {
+			return fmt.Errorf("invalid http_proxy: %w", err)
+		}
+	}
+	return nil
+}
+
+// ValidateURL checks that raw is an absolute URL with one of the given schemes
+func ValidateURL(raw string, schemes ...string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q is not an absolute URL", raw)
+	}
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("scheme must be one of %s", strings.Join(schemes, ", "))
+}
+
+// BaseURLOr returns the configured base URL without a trailing slash, or fallback
+func (o HTTPOptions) BaseURLOr(fallback string) string {
+	if o.BaseURL == "" {
+		return fallback
+	}
+	return strings.TrimRight(o.BaseURL, "/")
+}
+
+// NewHTTPClient returns a traced HTTP client for a provider. Options are expected to
+// have been validated; an unparsable proxy falls back to the environment.
+func NewHTTPClient(system string, opts HTTPOptions) *http.Client {
+	var base http.RoundTripper
+	if opts.Proxy != "" {
+		if proxyURL, err := url.Parse(opts.Proxy); err == nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.Proxy = http.ProxyURL(proxyURL)
+			base = transport
+		}
+	}
+	return &http.Client{
+		Transport: observability.NewTracingTransport(base, system),
+		Timeout:   opts.Timeout,
+	}
+}
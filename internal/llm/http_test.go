@@ -0,0 +1,73 @@
+package llm_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPOptionsFromConfig(t *testing.T) {
+	defaults := llm.HTTPOptions{BaseURL: "https://api.example.com/v1", Timeout: time.Minute}
+
+	tests := []struct {
+		name    string
+		config  map[string]any
+		want    llm.HTTPOptions
+		wantErr string
+	}{
+		{name: "server defaults", config: map[string]any{"api_key": "sk-user"}, want: defaults},
+		{
+			name:   "user overrides",
+			config: map[string]any{"base_url": "https://eu.example.com/v1", "timeout": "30s", "http_proxy": "http://proxy:3128"},
+			want:   llm.HTTPOptions{BaseURL: "https://eu.example.com/v1", Timeout: 30 * time.Second, Proxy: "http://proxy:3128"},
+		},
+		{
+			name:   "timeout in seconds",
+			config: map[string]any{"timeout": float64(45)},
+			want:   llm.HTTPOptions{BaseURL: defaults.BaseURL, Timeout: 45 * time.Second},
+		},
+		{name: "relative base URL", config: map[string]any{"base_url": "api.example.com"}, wantErr: "invalid base_url"},
+		{name: "unsupported proxy scheme", config: map[string]any{"http_proxy": "ftp://proxy:21"}, wantErr: "invalid http_proxy"},
+		{name: "bad timeout", config: map[string]any{"timeout": "soon"}, wantErr: "invalid timeout"},
+		{name: "negative timeout", config: map[string]any{"timeout": "-1s"}, wantErr: "invalid timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := llm.HTTPOptionsFromConfig(tt.config, defaults)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewHTTPClient_Proxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String() // a forward proxy sees the absolute URL
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	client := llm.NewHTTPClient("test", llm.HTTPOptions{Proxy: proxy.URL, Timeout: 5 * time.Second})
+	resp, err := client.Get("http://api.example.invalid/v1/models")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "http://api.example.invalid/v1/models", proxied)
+	assert.Equal(t, 5*time.Second, client.Timeout)
+}
+
+func TestHTTPOptions_BaseURLOr(t *testing.T) {
+	assert.Equal(t, "https://api.openai.com/v1", llm.HTTPOptions{}.BaseURLOr("https://api.openai.com/v1"))
+	assert.Equal(t, "https://gateway.internal/openai", llm.HTTPOptions{BaseURL: "https://gateway.internal/openai/"}.BaseURLOr("https://api.openai.com/v1"))
+}
@@ -0,0 +1,62 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+)
+
+const (
+	// The system prompts defer to the rules of the prompt, which answer greetings and
+	// questions that need no data in plain text
+	sqlSystemPrompt   = "You are an expert SQL query generator and a helpful assistant. Follow the rules in the request: answer questions about the data with only the SQL query in a sql code block, and reply to anything else in plain text."
+	mongoSystemPrompt = "You are an expert MongoDB query generator and a helpful assistant. Follow the rules in the request: answer questions about the data with only the MongoDB command as a JSON object in a json code block, and reply to anything else in plain text."
+)
+
+// SystemPrompt returns the system message for providers that take one
+func SystemPrompt(req Request) string {
+	if req.ExplainSQL != "" {
+		return explainSystemPrompt
+	}
+	if isMongo(req.DatabaseType) {
+		return mongoSystemPrompt
+	}
+	return sqlSystemPrompt
+}
+
+func isMongo(databaseType string) bool {
+	return databaseType == string(domain.DatabaseTypeMongoDB)
+}
+
+// ExtractMongoCommand extracts a MongoDB command from an LLM response: the first JSON
+// object in a code block, or else in the text. Plain text answers yield "".
+func ExtractMongoCommand(content string) string {
+	content = removeThinkingTags(content)
+
+	for _, marker := range []string{"```json", "```"} {
+		if block := extractFromCodeBlock(content, marker, "```"); block != "" {
+			if cmd := firstJSONObject(block); cmd != "" {
+				return cmd
+			}
+		}
+	}
+	return firstJSONObject(content)
+}
+
+// firstJSONObject returns the first well-formed JSON object in s
+func firstJSONObject(s string) string {
+	for start := strings.IndexByte(s, '{'); start != -1; {
+		dec := json.NewDecoder(strings.NewReader(s[start:]))
+		var obj map[string]json.RawMessage
+		if err := dec.Decode(&obj); err == nil {
+			return s[start : start+int(dec.InputOffset())]
+		}
+		next := strings.IndexByte(s[start+1:], '{')
+		if next == -1 {
+			break
+		}
+		start += next + 1
+	}
+	return ""
+}
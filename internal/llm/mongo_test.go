@@ -0,0 +1,63 @@
+package llm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildPrompt_Mongo(t *testing.T) {
+	req := llm.Request{
+		Question:     "Show the last 10 paid orders",
+		SchemaDDL:    `{"collections": ["orders"]}`,
+		SQLDialect:   "MongoDB database commands",
+		DatabaseType: "mongodb",
+		History: []domain.Message{
+			{Role: domain.RoleAssistant, Content: "Here you go", SQL: `{"count": "orders"}`},
+		},
+	}
+
+	prompt := llm.BuildPrompt(req)
+	assert.Contains(t, prompt, "MongoDB database commands")
+	assert.Contains(t, prompt, "```json")
+	assert.Contains(t, prompt, "```json\n{\"count\": \"orders\"}\n```", "earlier commands are shown as JSON")
+	assert.Contains(t, prompt, "Question: Show the last 10 paid orders")
+	assert.NotContains(t, prompt, "SELECT")
+	assert.NotContains(t, prompt, "```sql")
+	assert.True(t, strings.HasPrefix(llm.SystemPrompt(req), "You are an expert MongoDB query generator"))
+	assert.Contains(t, prompt, `Always set "limit" on find`)
+
+	req.DefaultLimit = 100
+	prompt = llm.BuildPrompt(req)
+	assert.Contains(t, prompt, "return their first 100 documents")
+	assert.NotContains(t, prompt, `Always set "limit" on find`)
+}
+
+func TestExtractMongoCommand(t *testing.T) {
+	find := `{"find": "orders", "filter": {"status": "paid"}, "sort": {"created_at": -1}, "limit": 10}`
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"bare object", find, find},
+		{"json block", "Here are the orders:\n```json\n" + find + "\n```\nThey are sorted by date.", find},
+		{"unlabeled block", "```\n" + find + "\n```", find},
+		{"object in text", "The command is " + find + " which returns ten orders.", find},
+		{"thinking first", "<think>maybe {\"count\": 1}</think>\n" + find, find},
+		{"braces before the object", "Use {braces} like this: " + find, find},
+		{"aggregate", "```json\n{\"aggregate\": \"orders\", \"pipeline\": [{\"$limit\": 5}], \"cursor\": {}}\n```",
+			`{"aggregate": "orders", "pipeline": [{"$limit": 5}], "cursor": {}}`},
+		{"plain answer", "Hello! Ask me about your orders.", ""},
+		{"sql is not a command", "```sql\nSELECT * FROM orders\n```", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, llm.ExtractMongoCommand(tt.content))
+		})
+	}
+}
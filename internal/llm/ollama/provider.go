@@ -2,35 +2,139 @@ package ollama
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/llm"
 )
 
+const (
+	defaultNumCtx     = 16384 // max context window (input + output)
+	defaultNumPredict = 4096  // max output tokens
+)
+
+// ModelOptions sizes a model's context window and output. Zero values keep the
+// provider's defaults.
+type ModelOptions struct {
+	NumCtx     int
+	NumPredict int
+}
+
+// Settings tunes how the Ollama server runs models
+type Settings struct {
+	Models    map[string]ModelOptions // by model name, e.g. "phi3" or "phi3:mini"
+	Override  ModelOptions            // applies to every model, e.g. from a user's config
+	KeepAlive string                  // how long a model stays loaded after a request, e.g. "30m"; "-1" keeps it loaded
+}
+
 // Provider implements llm.Provider for Ollama
 type Provider struct {
 	host         string
 	defaultModel string
 	client       *http.Client
+	settings     Settings
 }
 
-// NewProvider creates a new Ollama provider
-func NewProvider(host, defaultModel string) llm.Provider {
+// NewProvider creates a new Ollama provider. opts.BaseURL, when set, replaces host.
+func NewProvider(host, defaultModel string, opts llm.HTTPOptions) *Provider {
 	if defaultModel == "" {
 		defaultModel = "llama3"
 	}
 	return &Provider{
-		host:         host,
+		host:         opts.BaseURLOr(host),
 		defaultModel: defaultModel,
-		client:       &http.Client{Timeout: 300 * time.Second},
+		client:       llm.NewHTTPClient("ollama", opts),
 	}
 }
 
+// WithSettings sets the context window, output length and keep-alive of models
+func (p *Provider) WithSettings(settings Settings) *Provider {
+	p.settings = settings
+	return p
+}
+
+// SettingsFromConfig applies num_ctx, num_predict and keep_alive from a user's provider
+// config on top of the server settings. keep_alive is a duration or seconds.
+func SettingsFromConfig(config map[string]any, defaults Settings) (Settings, error) {
+	settings := defaults
+	for key, value := range map[string]*int{
+		"num_ctx":     &settings.Override.NumCtx,
+		"num_predict": &settings.Override.NumPredict,
+	} {
+		switch n := config[key].(type) {
+		case nil:
+		case float64:
+			if n < 1 || n != float64(int(n)) {
+				return settings, fmt.Errorf("invalid %s: must be a positive integer", key)
+			}
+			*value = int(n)
+		default:
+			return settings, fmt.Errorf("invalid %s: must be a positive integer", key)
+		}
+	}
+	switch keepAlive := config["keep_alive"].(type) {
+	case nil:
+	case float64:
+		settings.KeepAlive = strconv.FormatFloat(keepAlive, 'f', -1, 64)
+	case string:
+		settings.KeepAlive = keepAlive
+	default:
+		return settings, errors.New("invalid keep_alive: must be a duration or a number of seconds")
+	}
+	if err := ValidateKeepAlive(settings.KeepAlive); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// ValidateKeepAlive checks that keepAlive is empty, a duration or a number of seconds
+func ValidateKeepAlive(keepAlive string) error {
+	if keepAlive == "" {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(keepAlive, 64); err == nil {
+		return nil
+	}
+	if _, err := time.ParseDuration(keepAlive); err != nil {
+		return fmt.Errorf("invalid keep_alive %q: must be a duration or a number of seconds", keepAlive)
+	}
+	return nil
+}
+
+// modelOptions returns the options for a model: the override, then the model's own
+// settings, then those of its name without the tag, then the defaults
+func (p *Provider) modelOptions(model string) ModelOptions {
+	opts, ok := p.settings.Models[model]
+	if !ok {
+		name, _, _ := strings.Cut(model, ":")
+		opts = p.settings.Models[name]
+	}
+	return ModelOptions{
+		NumCtx:     cmp.Or(p.settings.Override.NumCtx, opts.NumCtx, defaultNumCtx),
+		NumPredict: cmp.Or(p.settings.Override.NumPredict, opts.NumPredict, defaultNumPredict),
+	}
+}
+
+// keepAlive returns the keep-alive as Ollama takes it: seconds as a number, durations
+// as a string
+func (p *Provider) keepAlive() any {
+	if p.settings.KeepAlive == "" {
+		return nil
+	}
+	if seconds, err := strconv.ParseFloat(p.settings.KeepAlive, 64); err == nil {
+		return seconds
+	}
+	return p.settings.KeepAlive
+}
+
 // Name returns the provider identifier
 func (p *Provider) Name() string {
 	return "ollama"
@@ -52,6 +156,11 @@ func (p *Provider) AvailableModels() []string {
 	}
 }
 
+// AcceptsAnyModel reports true: any model pulled into the Ollama server can be used
+func (p *Provider) AcceptsAnyModel() bool {
+	return true
+}
+
 // DefaultModel returns the default model
 func (p *Provider) DefaultModel() string {
 	return p.defaultModel
@@ -63,10 +172,11 @@ func (p *Provider) IsConfigured() bool {
 }
 
 type ollamaRequest struct {
-	Model   string         `json:"model"`
-	Prompt  string         `json:"prompt"`
-	Stream  bool           `json:"stream"`
-	Options map[string]any `json:"options,omitempty"`
+	Model     string         `json:"model"`
+	Prompt    string         `json:"prompt,omitempty"`
+	Stream    bool           `json:"stream"`
+	KeepAlive any            `json:"keep_alive,omitempty"`
+	Options   map[string]any `json:"options,omitempty"`
 }
 
 type ollamaResponse struct {
@@ -75,32 +185,30 @@ type ollamaResponse struct {
 	EvalCount int    `json:"eval_count"`
 }
 
-// GenerateSQL generates SQL from natural language
-func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model string) (*llm.Response, error) {
-	if model == "" {
-		model = p.defaultModel
+// newRequest builds a request for a model with its context window and keep-alive. Every
+// request to a model sends the same num_ctx, since Ollama reloads a model whose
+// context window changes.
+func (p *Provider) newRequest(model, prompt string, options map[string]any) ollamaRequest {
+	if options == nil {
+		options = map[string]any{}
 	}
-
-	prompt := llm.BuildPrompt(req)
-
-	ollamaReq := ollamaRequest{
-		Model:  model,
-		Prompt: prompt,
-		Stream: false,
-		Options: map[string]any{
-			"temperature": 0.0,
-			"num_predict": 4096,  // Max output tokens
-			"num_ctx":     16384, // Max context window (input + output)
-		},
+	options["num_ctx"] = p.modelOptions(model).NumCtx
+	return ollamaRequest{
+		Model:     model,
+		Prompt:    prompt,
+		Stream:    false,
+		KeepAlive: p.keepAlive(),
+		Options:   options,
 	}
+}
 
+// generate sends a request to /api/generate
+func (p *Provider) generate(ctx context.Context, ollamaReq ollamaRequest) (*ollamaResponse, error) {
 	body, err := json.Marshal(ollamaReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	start := time.Now()
-
 	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.host+"/api/generate", bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -114,37 +222,52 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("ollama returned status %d", resp.StatusCode)
+		return nil, statusError(resp)
 	}
 
-	var bodyBytes []byte
-	bodyBytes, err = io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
-	// Log the raw body for debugging
-	fmt.Printf("DEBUG OLLAMA RAW RESPONSE: %s\n", string(bodyBytes))
-
 	var ollamaResp ollamaResponse
-	if err := json.Unmarshal(bodyBytes, &ollamaResp); err != nil {
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	return &ollamaResp, nil
+}
+
+// statusError reports a failed response with the message from Ollama's error field,
+// such as a model that was not pulled or does not fit in memory
+func statusError(resp *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err == nil && body.Error != "" {
+		return fmt.Errorf("ollama returned status %d: %s", resp.StatusCode, body.Error)
+	}
+	return fmt.Errorf("ollama returned status %d", resp.StatusCode)
+}
+
+// GenerateSQL generates SQL from natural language
+func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model string) (*llm.Response, error) {
+	if model == "" {
+		model = p.defaultModel
+	}
+
+	start := time.Now()
+	ollamaResp, err := p.generate(ctx, p.newRequest(model, llm.BuildPrompt(req), map[string]any{
+		"temperature": 0.0,
+		"num_predict": p.modelOptions(model).NumPredict,
+	}))
+	if err != nil {
+		return nil, err
+	}
 
 	latencyMs := time.Since(start).Milliseconds()
 	sql := llm.ExtractSQL(ollamaResp.Response)
 
-	// If SQL extraction failed, or even if it succeeded, it's useful to have the full text as explanation
-	// especially for debugging empty SQL issues.
+	// The whole answer doubles as the explanation, which helps when no SQL was found
 	explanation := ollamaResp.Response
-	if sql != "" {
-		// If we successfully extracted SQL, maybe we want to keep explanation cleaner?
-		// But for now, let's keep it simple and just return the raw text if needed.
-		// Or better: if sql is found, try to remove it from explanation?
-		// For debugging "empty sql" issue, raw response is critical.
-	}
 
 	return &llm.Response{
 		SQL:         sql,
+		Content:     ollamaResp.Response,
 		Explanation: explanation,
 		Model:       model,
 		TokensUsed:  ollamaResp.EvalCount,
@@ -159,52 +282,48 @@ func (p *Provider) GenerateTitle(ctx context.Context, question string, model str
 	}
 
 	// Use a simpler model for title generation if possible, or same model
-	prompt := fmt.Sprintf("Summarize the following user question into a very short, concise title (max 5 words). Do not use quotes or prefixes. Question: %s", question)
+	prompt := llm.BuildTitlePrompt(question)
 
-	ollamaReq := ollamaRequest{
-		Model:  model,
-		Prompt: prompt,
-		Stream: false,
-		Options: map[string]any{
-			"temperature": 0.5, // Slightly higher temp for creativity but still focused
-			"num_predict": 50,  // Short output
-		},
+	ollamaResp, err := p.generate(ctx, p.newRequest(model, prompt, map[string]any{
+		"temperature": 0.5, // Slightly higher temp for creativity but still focused
+		"num_predict": 50,  // Short output
+	}))
+	if err != nil {
+		return "New Chat", err
 	}
 
-	body, err := json.Marshal(ollamaReq)
-	if err != nil {
-		return "New Chat", fmt.Errorf("failed to marshal request: %w", err)
+	title := llm.CleanTitle(ollamaResp.Response)
+	if title == "" {
+		return "New Chat", nil
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", p.host+"/api/generate", bytes.NewReader(body))
+	return title, nil
+}
+
+// Warmup loads the default model so the first question does not wait for a cold load,
+// which takes up to a minute for large models
+func (p *Provider) Warmup(ctx context.Context) error {
+	if _, err := p.generate(ctx, p.newRequest(p.defaultModel, "", nil)); err != nil {
+		return fmt.Errorf("failed to load model %s: %w", p.defaultModel, err)
+	}
+	return nil
+}
+
+// Ping lists the local models to check the Ollama server is reachable
+func (p *Provider) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.host+"/api/tags", nil)
 	if err != nil {
-		return "New Chat", fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
-	httpReq.Header.Set("Content-Type", "application/json")
 
 	resp, err := p.client.Do(httpReq)
 	if err != nil {
-		return "New Chat", fmt.Errorf("request failed: %w", err)
+		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "New Chat", fmt.Errorf("ollama returned status %d", resp.StatusCode)
-	}
-
-	var ollamaResp ollamaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&ollamaResp); err != nil {
-		return "New Chat", fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	title := ollamaResp.Response
-	// Clean up title (remove quotes, newlines)
-	title = string(bytes.TrimSpace([]byte(title)))
-	title = string(bytes.Trim([]byte(title), `"'`))
-
-	if title == "" {
-		return "New Chat", nil
+		return statusError(resp)
 	}
-
-	return title, nil
+	return nil
 }
@@ -0,0 +1,107 @@
+package ollama
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer answers /api/generate with answer and records the request bodies
+func newServer(t *testing.T, status int, answer string, got *[]map[string]any) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/generate", r.URL.Path)
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		*got = append(*got, body)
+		w.WriteHeader(status)
+		w.Write([]byte(answer))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProvider_ModelOptions(t *testing.T) {
+	var got []map[string]any
+	server := newServer(t, http.StatusOK, `{"response": "SELECT 1", "done": true, "eval_count": 3}`, &got)
+	p := NewProvider(server.URL, "llama3", llm.HTTPOptions{}).WithSettings(Settings{
+		Models:    map[string]ModelOptions{"phi3": {NumCtx: 4096, NumPredict: 1024}},
+		KeepAlive: "30m",
+	})
+
+	tests := []struct {
+		model      string
+		numCtx     float64
+		numPredict float64
+	}{
+		{"llama3", 16384, 4096},
+		{"phi3", 4096, 1024},
+		{"phi3:mini", 4096, 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			got = nil
+			_, err := p.GenerateSQL(context.Background(), llm.Request{Question: "q"}, tt.model)
+			require.NoError(t, err)
+			require.Len(t, got, 1)
+			assert.Equal(t, "30m", got[0]["keep_alive"])
+			options := got[0]["options"].(map[string]any)
+			assert.Equal(t, tt.numCtx, options["num_ctx"])
+			assert.Equal(t, tt.numPredict, options["num_predict"])
+		})
+	}
+
+	t.Run("titles keep the model's context window", func(t *testing.T) {
+		got = nil
+		_, err := p.GenerateTitle(context.Background(), "q", "phi3")
+		require.NoError(t, err)
+		options := got[0]["options"].(map[string]any)
+		assert.Equal(t, float64(4096), options["num_ctx"])
+		assert.Equal(t, float64(50), options["num_predict"])
+	})
+}
+
+func TestSettingsFromConfig(t *testing.T) {
+	defaults := Settings{Models: map[string]ModelOptions{"phi3": {NumCtx: 4096}}, KeepAlive: "5m"}
+
+	settings, err := SettingsFromConfig(map[string]any{"num_ctx": float64(8192), "keep_alive": float64(-1)}, defaults)
+	require.NoError(t, err)
+	assert.Equal(t, "-1", settings.KeepAlive)
+	p := NewProvider("http://ollama", "phi3", llm.HTTPOptions{}).WithSettings(settings)
+	assert.Equal(t, ModelOptions{NumCtx: 8192, NumPredict: defaultNumPredict}, p.modelOptions("phi3"))
+	assert.Equal(t, float64(-1), p.keepAlive())
+
+	_, err = SettingsFromConfig(map[string]any{"num_ctx": float64(0)}, defaults)
+	assert.EqualError(t, err, "invalid num_ctx: must be a positive integer")
+	_, err = SettingsFromConfig(map[string]any{"keep_alive": "forever"}, defaults)
+	assert.EqualError(t, err, `invalid keep_alive "forever": must be a duration or a number of seconds`)
+}
+
+func TestProvider_Warmup(t *testing.T) {
+	var got []map[string]any
+	server := newServer(t, http.StatusOK, `{"done": true}`, &got)
+	p := NewProvider(server.URL, "phi3", llm.HTTPOptions{}).WithSettings(Settings{KeepAlive: "-1"})
+
+	require.NoError(t, p.Warmup(context.Background()))
+	require.Len(t, got, 1)
+	assert.Equal(t, "phi3", got[0]["model"])
+	assert.NotContains(t, got[0], "prompt")
+	assert.Equal(t, float64(-1), got[0]["keep_alive"])
+}
+
+func TestProvider_ErrorField(t *testing.T) {
+	var got []map[string]any
+	server := newServer(t, http.StatusInternalServerError, `{"error": "model requires more system memory (9.1 GiB) than is available (4.0 GiB)"}`, &got)
+	p := NewProvider(server.URL, "llama3", llm.HTTPOptions{})
+
+	_, err := p.GenerateSQL(context.Background(), llm.Request{Question: "q"}, "")
+	assert.EqualError(t, err, "ollama returned status 500: model requires more system memory (9.1 GiB) than is available (4.0 GiB)")
+
+	err = p.Warmup(context.Background())
+	assert.EqualError(t, err, "failed to load model llama3: ollama returned status 500: model requires more system memory (9.1 GiB) than is available (4.0 GiB)")
+}
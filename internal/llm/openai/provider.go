@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/llm"
@@ -20,15 +21,15 @@ type Provider struct {
 }
 
 // NewProvider creates a new OpenAI provider
-func NewProvider(apiKey, defaultModel string) llm.Provider {
+func NewProvider(apiKey, defaultModel string, opts llm.HTTPOptions) llm.Provider {
 	if defaultModel == "" {
 		defaultModel = "gpt-4-turbo"
 	}
 	return &Provider{
 		apiKey:       apiKey,
 		defaultModel: defaultModel,
-		client:       &http.Client{Timeout: 120 * time.Second},
-		baseURL:      "https://api.openai.com/v1",
+		client:       llm.NewHTTPClient("openai", opts),
+		baseURL:      opts.BaseURLOr("https://api.openai.com/v1"),
 	}
 }
 
@@ -94,7 +95,7 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 		Messages: []chatMessage{
 			{
 				Role:    "system",
-				Content: "You are an expert SQL query generator. Respond with ONLY the SQL query, no explanations or markdown formatting.",
+				Content: llm.SystemPrompt(req),
 			},
 			{
 				Role:    "user",
@@ -139,13 +140,16 @@ func (p *Provider) GenerateSQL(ctx context.Context, req llm.Request, model strin
 	}
 
 	latencyMs := time.Since(start).Milliseconds()
-	sql := llm.ExtractSQL(chatResp.Choices[0].Message.Content)
+	content := chatResp.Choices[0].Message.Content
+	sql, explanation := llm.SplitResponse(content)
 
 	return &llm.Response{
-		SQL:        sql,
-		Model:      model,
-		TokensUsed: chatResp.Usage.TotalTokens,
-		LatencyMs:  latencyMs,
+		SQL:         sql,
+		Content:     content,
+		Explanation: explanation,
+		Model:       model,
+		TokensUsed:  chatResp.Usage.TotalTokens,
+		LatencyMs:   latencyMs,
 	}, nil
 }
 
@@ -162,3 +166,61 @@ func (p *Provider) GenerateTitle(ctx context.Context, question string, model str
 	// But I haven't read openai/provider.go.
 	return "New Chat", nil
 }
+
+// Ping lists the models to check the API is reachable and the key is accepted
+func (p *Provider) Ping(ctx context.Context) error {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("openai returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ListModels returns the ids of the models the account can use
+func (p *Provider) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openai returned status %d", resp.StatusCode)
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	models := make([]string, 0, len(list.Data))
+	for _, m := range list.Data {
+		models = append(models, m.ID)
+	}
+	return models, nil
+}
+
+// IsCustomModel reports whether model is a fine-tune, named ft:<base>:<org>:<suffix>:<id>
+func (p *Provider) IsCustomModel(model string) bool {
+	return strings.HasPrefix(model, "ft:")
+}
@@ -7,67 +7,91 @@ import (
 	"github.com/Rrens/text-to-sql/internal/domain"
 )
 
-// BuildPrompt creates a prompt for SQL generation
+// schemaText returns the request's schema, noting the tables that could not be described
+func schemaText(req Request) string {
+	if len(req.UndescribedTables) == 0 {
+		return req.SchemaDDL
+	}
+	return fmt.Sprintf("%s\n\nNote: %d tables could not be described due to permissions and may be missing: %s",
+		strings.TrimRight(req.SchemaDDL, "\n"), len(req.UndescribedTables), strings.Join(req.UndescribedTables, ", "))
+}
+
+// BuildPrompt creates a prompt for SQL generation, or for a MongoDB command on
+// mongodb connections. Requests with ExplainSQL get a prompt explaining that query.
 func BuildPrompt(req Request) string {
-	examplesStr := ""
-	if len(req.Examples) > 0 {
-		examplesStr = "\n\nExamples:\n"
-		for _, ex := range req.Examples {
-			examplesStr += fmt.Sprintf("Question: %s\nSQL: %s\n\n", ex.Question, ex.SQL)
+	if req.ExplainSQL != "" {
+		return buildExplainPrompt(req)
+	}
+	return renderPrompt(promptTemplateName(req), req.PromptVariant, PromptData{
+		DatabaseType: req.DatabaseType,
+		Dialect:      req.SQLDialect,
+		UserContext:  req.UserContext,
+		Schema:       schemaText(req),
+		Examples:     req.Examples,
+		History:      promptHistory(req.History),
+		Question:     req.Question,
+		DefaultLimit: req.DefaultLimit,
+	})
+}
+
+// MeasurePrompt breaks the prompt BuildPrompt makes for req down by section. The
+// prompt is rendered once; each section is measured as the text it brings in, and
+// the instructions are the rest, headings included. Explanation prompts are measured
+// as a whole.
+func MeasurePrompt(req Request) domain.PromptBreakdown {
+	full := len(BuildPrompt(req))
+	breakdown := domain.PromptBreakdown{Total: promptSize(full)}
+	if req.ExplainSQL != "" {
+		breakdown.Instructions = breakdown.Total
+		return breakdown
+	}
+
+	examples := 0
+	for _, example := range req.Examples {
+		examples += len(example.Question) + len(example.SQL)
+	}
+	history := 0
+	for _, turn := range promptHistory(req.History) {
+		if turn.Query != "" {
+			history += len(turn.Query)
+		} else {
+			history += len(turn.Content)
 		}
+		history += len(turn.Error)
 	}
+	breakdown.Schema = promptSize(len(schemaText(req)))
+	breakdown.Examples = promptSize(examples)
+	breakdown.History = promptSize(history)
+	breakdown.Question = promptSize(len(req.Question))
+	breakdown.Instructions = promptSize(full - breakdown.Schema.Chars - breakdown.Examples.Chars -
+		breakdown.History.Chars - breakdown.Question.Chars)
+	return breakdown
+}
+
+// promptSize estimates the tokens of chars characters of prompt, at about four a token
+func promptSize(chars int) domain.PromptSize {
+	chars = max(chars, 0)
+	return domain.PromptSize{Chars: chars, Tokens: (chars + 3) / 4}
+}
+
+// BuildTitlePrompt creates a prompt asking for a short title for a question
+func BuildTitlePrompt(question string) string {
+	return renderPrompt(TemplateTitleGeneration, "", TitlePromptData{Question: question})
+}
 
-	historyStr := ""
-	if len(req.History) > 0 {
-		var sb strings.Builder
-		sb.WriteString("\n\nChat History:\n")
-		for _, msg := range req.History {
-			role := "User"
-			if msg.Role == domain.RoleAssistant {
-				role = "Assistant"
-			}
-			content := msg.Content
-			if msg.Role == domain.RoleAssistant && msg.SQL != "" {
-				content = fmt.Sprintf("```sql\n%s\n```", msg.SQL)
-			}
-			sb.WriteString(fmt.Sprintf("%s: %s\n", role, content))
+// promptHistory turns chat messages into the turns of a prompt
+func promptHistory(messages []domain.Message) []PromptTurn {
+	turns := make([]PromptTurn, 0, len(messages))
+	for _, msg := range messages {
+		turn := PromptTurn{Role: "User", Content: msg.Content}
+		if msg.Role == domain.RoleAssistant {
+			turn.Role = "Assistant"
+			turn.Query = msg.SQL
+			turn.Error = failureCause(msg)
 		}
-		historyStr = sb.String()
-	}
-
-	userContextStr := ""
-	if req.UserContext != "" {
-		userContextStr = fmt.Sprintf("\n\nUser Profile:\n%s", req.UserContext)
-	}
-
-	return fmt.Sprintf(`You are an expert SQL query generator for %s databases, but you are also a helpful assistant.
-	
-%s
-
-Rules:
-1. If the user asks a question that requires data from the database, generate ONLY the SQL query.
-2. If the user sends a greeting, asks a clarification question, or says something that doesn't require a database query, respond naturally in plain text.
-3. For SQL queries:
-   - Use only SELECT statements (no INSERT, UPDATE, DELETE, DROP, etc.)
-   - Always include appropriate LIMIT clauses for safety
-   - Use only tables and columns from the provided schema
-   - Handle NULL values appropriately
-   - Use proper date/time functions for the database dialect
-   - Prefer explicit column names over SELECT *
-4. If you generate SQL, wrap it in a markdown code block like this:
-   `+"```sql"+`
-   SELECT ...
-   `+"```"+`
-5. If you cannot answer the question based on the schema, explain why.
-6. You know the user's profile information. If they ask about themselves, use this data to respond.
-%s
-Database Schema:
-%s
-%s
-%s
-Question: %s
-
-Response:`, req.DatabaseType, req.SQLDialect, userContextStr, req.SchemaDDL, examplesStr, historyStr, req.Question)
+		turns = append(turns, turn)
+	}
+	return turns
 }
 
 // ExtractSQL extracts SQL from LLM response
@@ -99,6 +123,54 @@ func ExtractSQL(content string) string {
 	return ""
 }
 
+// SplitResponse splits a response into the SQL it holds and the text around it, so
+// the explanation does not repeat the query. Responses without SQL are all explanation.
+func SplitResponse(content string) (sql, explanation string) {
+	content = removeThinkingTags(content)
+	sql = ExtractSQL(content)
+	if sql == "" {
+		return "", content
+	}
+
+	for _, marker := range []string{"```sql", "```"} {
+		if start, end, ok := codeBlockSpan(content, marker); ok {
+			return sql, joinText(content[:start], content[end:])
+		}
+	}
+	// A bare statement is cut out along with its semicolon
+	if idx := strings.Index(content, sql); idx >= 0 {
+		end := idx + len(sql)
+		if end < len(content) && content[end] == ';' {
+			end++
+		}
+		return sql, joinText(content[:idx], content[end:])
+	}
+	return sql, content
+}
+
+// codeBlockSpan returns where the first code block opened by startMarker starts and
+// ends, including its fences
+func codeBlockSpan(content, startMarker string) (start, end int, ok bool) {
+	start = indexOf(content, startMarker)
+	if start == -1 {
+		return 0, 0, false
+	}
+	closing := indexOfFrom(content, "```", start+len(startMarker))
+	if closing == -1 {
+		return 0, 0, false
+	}
+	return start, closing + len("```"), true
+}
+
+// joinText joins the text before and after a removed block as paragraphs
+func joinText(before, after string) string {
+	before, after = trimWhitespace(before), trimWhitespace(after)
+	if before == "" || after == "" {
+		return before + after
+	}
+	return before + "\n\n" + after
+}
+
 func startsWithAny(s string, prefixes []string) bool {
 	for _, p := range prefixes {
 		if len(s) >= len(p) && s[:len(p)] == p {
@@ -229,3 +301,15 @@ func trimWhitespace(s string) string {
 func isWhitespace(c byte) bool {
 	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
 }
+
+// failureCause returns why an assistant answer failed, so the model learns from the
+// failure rather than repeating the query, or "" when it did not fail
+func failureCause(msg domain.Message) string {
+	if !msg.Status.Failed() {
+		return ""
+	}
+	if msg.Error != "" {
+		return msg.Error
+	}
+	return string(msg.Status)
+}
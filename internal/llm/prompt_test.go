@@ -3,6 +3,7 @@ package llm_test
 import (
 	"testing"
 
+	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/llm"
 )
 
@@ -23,6 +24,7 @@ func TestBuildPrompt(t *testing.T) {
 		"CREATE TABLE users",
 		"SELECT statements",
 		"LIMIT",
+		"-- INDEX",
 	}
 
 	for _, s := range mustContain {
@@ -32,6 +34,47 @@ func TestBuildPrompt(t *testing.T) {
 	}
 }
 
+func TestBuildPrompt_UndescribedTables(t *testing.T) {
+	req := llm.Request{
+		Question:          "Show me all payments",
+		SchemaDDL:         "CREATE TABLE users (id INT);\n",
+		DatabaseType:      "postgres",
+		UndescribedTables: []string{"payments", "refunds"},
+	}
+
+	note := "Note: 2 tables could not be described due to permissions and may be missing: payments, refunds"
+	if !contains(llm.BuildPrompt(req), note) {
+		t.Errorf("prompt should contain %q", note)
+	}
+
+	req.UndescribedTables = nil
+	if contains(llm.BuildPrompt(req), "could not be described") {
+		t.Error("prompt should not note undescribed tables when there are none")
+	}
+}
+
+func TestBuildPrompt_DefaultLimit(t *testing.T) {
+	req := llm.Request{
+		Question:     "Show me the orders table",
+		SchemaDDL:    "CREATE TABLE orders (id INT);",
+		DatabaseType: "postgres",
+		DefaultLimit: 100,
+	}
+
+	prompt := llm.BuildPrompt(req)
+	if !contains(prompt, "Queries without a LIMIT return their first 100 rows") {
+		t.Error("prompt should state the default limit")
+	}
+	if contains(prompt, "Always include appropriate LIMIT clauses") {
+		t.Error("prompt should not ask for a LIMIT when a default limit applies")
+	}
+
+	req.DefaultLimit = 0
+	if !contains(llm.BuildPrompt(req), "Always include appropriate LIMIT clauses") {
+		t.Error("prompt should ask for a LIMIT when the default limit is unknown")
+	}
+}
+
 func TestBuildPrompt_WithExamples(t *testing.T) {
 	req := llm.Request{
 		Question:     "Count users by status",
@@ -66,6 +109,29 @@ func TestBuildPrompt_WithExamples(t *testing.T) {
 	}
 }
 
+func TestBuildPrompt_FailedHistory(t *testing.T) {
+	req := llm.Request{
+		Question:     "Now only this year",
+		SchemaDDL:    "CREATE TABLE orders (id INT, total NUMERIC);",
+		DatabaseType: "postgres",
+		History: []domain.Message{
+			{Role: domain.RoleUser, Content: "Total revenue"},
+			{Role: domain.RoleAssistant, SQL: "SELECT SUM(amount) FROM orders", Status: domain.QueryStatusSQLError, Error: `column "amount" does not exist`},
+			{Role: domain.RoleUser, Content: "Total revenue using total"},
+			{Role: domain.RoleAssistant, SQL: "SELECT SUM(total) FROM orders", Status: domain.QueryStatusOK},
+		},
+	}
+
+	prompt := llm.BuildPrompt(req)
+
+	if !contains(prompt, "SELECT SUM(amount) FROM orders\n```\nNOTE: this query failed with column \"amount\" does not exist") {
+		t.Error("failed turn should be annotated with its error")
+	}
+	if contains(prompt, "SELECT SUM(total) FROM orders\n```\nNOTE") {
+		t.Error("successful turn should not be annotated")
+	}
+}
+
 func TestExtractSQL(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -119,6 +185,64 @@ func TestExtractSQL(t *testing.T) {
 	}
 }
 
+func TestSplitResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		sql         string
+		explanation string
+	}{
+		{
+			"conversational",
+			"Hello! Ask me anything about your data.",
+			"",
+			"Hello! Ask me anything about your data.",
+		},
+		{
+			"sql only",
+			"```sql\nSELECT * FROM users\n```",
+			"SELECT * FROM users",
+			"",
+		},
+		{
+			"text around code block",
+			"Here is the query:\n\n```sql\nSELECT * FROM users;\n```\n\nIt lists every user.",
+			"SELECT * FROM users",
+			"Here is the query:\n\nIt lists every user.",
+		},
+		{
+			"generic code block",
+			"Counting users:\n```\nSELECT COUNT(*) FROM users\n```",
+			"SELECT COUNT(*) FROM users",
+			"Counting users:",
+		},
+		{
+			"bare statement",
+			"This counts them.\n\nSELECT COUNT(*) FROM users;",
+			"SELECT COUNT(*) FROM users",
+			"This counts them.",
+		},
+		{
+			"thinking removed",
+			"<think>users table</think>```sql\nSELECT id FROM users\n```",
+			"SELECT id FROM users",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, explanation := llm.SplitResponse(tt.content)
+			if sql != tt.sql {
+				t.Errorf("SplitResponse() sql = %q, want %q", sql, tt.sql)
+			}
+			if explanation != tt.explanation {
+				t.Errorf("SplitResponse() explanation = %q, want %q", explanation, tt.explanation)
+			}
+		})
+	}
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
 }
@@ -131,3 +255,102 @@ func containsHelper(s, substr string) bool {
 	}
 	return false
 }
+
+func TestBuildPrompt_ExplainSQL(t *testing.T) {
+	req := llm.Request{
+		SchemaDDL:    "CREATE TABLE users (id INT, name VARCHAR);",
+		SQLDialect:   "PostgreSQL SQL dialect",
+		DatabaseType: "postgres",
+		ExplainSQL:   "SELECT name FROM users",
+	}
+
+	prompt := llm.BuildPrompt(req)
+	for _, s := range []string{"SELECT name FROM users", "CREATE TABLE users", "Potential issues:"} {
+		if !contains(prompt, s) {
+			t.Errorf("explain prompt should contain %q", s)
+		}
+	}
+	if llm.SystemPrompt(req) == llm.SystemPrompt(llm.Request{}) {
+		t.Error("explain requests should use their own system prompt")
+	}
+}
+
+func TestParseExplanation(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		explanation string
+		warnings    []string
+	}{
+		{
+			name:        "issues listed",
+			content:     "<think>hmm</think>Reads users and counts them.\n\nPotential issues:\n- Counts deleted users too\n* No index on email\n",
+			explanation: "Reads users and counts them.",
+			warnings:    []string{"Counts deleted users too", "No index on email"},
+		},
+		{
+			name:        "no issues",
+			content:     "Reads users.\npotential issues:\n- None.",
+			explanation: "Reads users.",
+		},
+		{
+			name:        "no heading",
+			content:     "  Reads users.  ",
+			explanation: "Reads users.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explanation, warnings := llm.ParseExplanation(tt.content)
+			if explanation != tt.explanation {
+				t.Errorf("explanation = %q, want %q", explanation, tt.explanation)
+			}
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("warnings = %q, want %q", warnings, tt.warnings)
+			}
+			for i := range warnings {
+				if warnings[i] != tt.warnings[i] {
+					t.Errorf("warnings[%d] = %q, want %q", i, warnings[i], tt.warnings[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMeasurePrompt(t *testing.T) {
+	req := llm.Request{
+		Question:     "Show me all active users",
+		SchemaDDL:    "CREATE TABLE users (id INT, name VARCHAR, active BOOLEAN);",
+		SQLDialect:   "PostgreSQL SQL dialect with ILIKE, LIMIT/OFFSET",
+		DatabaseType: "postgres",
+		History: []domain.Message{
+			{Role: domain.RoleUser, Content: "How many users are there?"},
+			{Role: domain.RoleAssistant, SQL: "SELECT COUNT(*) FROM users"},
+		},
+	}
+
+	breakdown := llm.MeasurePrompt(req)
+	total := len(llm.BuildPrompt(req))
+	if breakdown.Total.Chars != total {
+		t.Fatalf("total = %d chars, want %d", breakdown.Total.Chars, total)
+	}
+	sum := breakdown.Instructions.Chars + breakdown.Schema.Chars + breakdown.Examples.Chars +
+		breakdown.History.Chars + breakdown.Question.Chars
+	if sum != total {
+		t.Errorf("sections add up to %d chars, want %d", sum, total)
+	}
+	if breakdown.Schema.Chars < len(req.SchemaDDL) {
+		t.Errorf("schema = %d chars, want at least %d", breakdown.Schema.Chars, len(req.SchemaDDL))
+	}
+	if breakdown.Question.Chars != len(req.Question) {
+		t.Errorf("question = %d chars, want %d", breakdown.Question.Chars, len(req.Question))
+	}
+	wantHistory := len("How many users are there?") + len("SELECT COUNT(*) FROM users")
+	if breakdown.History.Chars != wantHistory || breakdown.History.Tokens != (breakdown.History.Chars+3)/4 {
+		t.Errorf("history = %+v, want its chars and tokens", breakdown.History)
+	}
+	if breakdown.Examples.Chars != 0 {
+		t.Errorf("examples = %d chars without examples", breakdown.Examples.Chars)
+	}
+}
@@ -15,6 +15,14 @@ type Request struct {
 	Examples     []Example
 	History      []domain.Message
 	UserContext  string // User profile info (name, email) for personalized responses
+	ExplainSQL   string // asks for an explanation of this query instead of generating one
+	// PromptVariant picks the variant of the prompt template, such as one compared by
+	// an experiment; the regular template is used when it has none
+	PromptVariant string
+	// UndescribedTables could not be described and may be missing from SchemaDDL
+	UndescribedTables []string
+	// DefaultLimit is how many rows the query returns when it has no LIMIT, 0 when unknown
+	DefaultLimit int
 }
 
 // Example represents a question-SQL pair for few-shot learning
@@ -25,7 +33,8 @@ type Example struct {
 
 // Response contains LLM generation result
 type Response struct {
-	SQL         string
+	SQL         string // the query extracted with ExtractSQL
+	Content     string // the model's whole answer, for callers that extract another query language
 	Explanation string
 	Model       string
 	TokensUsed  int
@@ -53,5 +62,29 @@ type Provider interface {
 	GenerateTitle(ctx context.Context, question string, model string) (string, error)
 }
 
+// Pinger is implemented by providers that can cheaply check that their API is
+// reachable and the credentials are accepted
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// FreeformModels is implemented by providers that serve models beyond
+// AvailableModels, such as locally pulled Ollama models, so unknown names are not rejected
+type FreeformModels interface {
+	AcceptsAnyModel() bool
+}
+
+// CustomModels is implemented by providers that serve models they cannot list, such as
+// OpenAI fine-tunes, and recognize by name
+type CustomModels interface {
+	IsCustomModel(model string) bool
+}
+
+// ModelLister is implemented by providers that can list the models their API serves,
+// which are checked instead of AvailableModels
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
 // ProviderFactory creates a new provider instance with config
 type ProviderFactory func(config map[string]any) (Provider, error)
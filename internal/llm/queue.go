@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrBusy is matched by the error Acquire returns when a provider's queue is full
+var ErrBusy = errors.New("LLM busy, try again")
+
+// BusyError is returned by Acquire when a provider already has its maximum of
+// generations queued
+type BusyError struct {
+	Provider   string
+	RetryAfter time.Duration // the expected time until a slot frees up, 0 if unknown
+}
+
+func (e *BusyError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("LLM busy, try again in %ds", int(math.Ceil(e.RetryAfter.Seconds())))
+	}
+	return ErrBusy.Error()
+}
+
+// Is reports whether target is ErrBusy
+func (e *BusyError) Is(target error) bool { return target == ErrBusy }
+
+// Queue states of a generation
+const (
+	QueueStateQueued  = "queued"
+	QueueStateRunning = "running"
+)
+
+// QueueStatus is where a generation stands in its provider's queue
+type QueueStatus struct {
+	Provider      string
+	State         string
+	Position      int // 1 is next in line; 0 once running
+	QueueLength   int
+	EstimatedWait time.Duration // until it runs when queued, until it finishes when running
+}
+
+// latencyWeight is the weight of the latest generation in the latency average
+const latencyWeight = 0.3
+
+// gate bounds the concurrent generations of a provider and queues the rest in order
+type gate struct {
+	provider      string
+	maxConcurrent int
+	maxQueue      int
+
+	mu      sync.Mutex
+	active  int
+	waiting []*waiter
+	running map[string][]time.Time // when the running generations of each key started
+	latency time.Duration          // moving average of generation time, 0 before the first
+	now     func() time.Time
+}
+
+// waiter is a queued generation, whose ready channel is closed when it got a slot
+type waiter struct {
+	key     string
+	ready   chan struct{}
+	started time.Time // set before ready is closed
+}
+
+func newGate(provider string, maxConcurrent, maxQueue int) *gate {
+	return &gate{
+		provider:      provider,
+		maxConcurrent: maxConcurrent,
+		maxQueue:      maxQueue,
+		running:       make(map[string][]time.Time),
+		now:           time.Now,
+	}
+}
+
+// acquire waits for a slot, failing fast when the queue is full
+func (g *gate) acquire(ctx context.Context, key string) (func(), error) {
+	g.mu.Lock()
+	if g.active < g.maxConcurrent && len(g.waiting) == 0 {
+		g.active++
+		started := g.start(key)
+		g.mu.Unlock()
+		return g.releaser(key, started), nil
+	}
+	if len(g.waiting) >= g.maxQueue {
+		retryAfter := g.latency
+		g.mu.Unlock()
+		return nil, &BusyError{Provider: g.provider, RetryAfter: retryAfter}
+	}
+	w := &waiter{key: key, ready: make(chan struct{})}
+	g.waiting = append(g.waiting, w)
+	g.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return g.releaser(key, w.started), nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		if i := slices.Index(g.waiting, w); i >= 0 {
+			g.waiting = slices.Delete(g.waiting, i, i+1)
+			g.mu.Unlock()
+			return nil, ctx.Err()
+		}
+		// The slot was handed over as the context ended, so it goes to the next in line
+		started := w.started
+		g.mu.Unlock()
+		g.release(key, started, false)
+		return nil, ctx.Err()
+	}
+}
+
+// start records key as running; the caller holds mu. Requests sharing a key, such as
+// a client-supplied request ID, are each recorded.
+func (g *gate) start(key string) time.Time {
+	started := g.now()
+	if key != "" {
+		g.running[key] = append(g.running[key], started)
+	}
+	return started
+}
+
+// releaser returns a release func that frees the slot once
+func (g *gate) releaser(key string, started time.Time) func() {
+	var once sync.Once
+	return func() { once.Do(func() { g.release(key, started, true) }) }
+}
+
+// release frees the slot of the generation of key started at started, handing it to
+// the first waiter. observe adds its time to the latency average.
+func (g *gate) release(key string, started time.Time, observe bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if observe {
+		elapsed := g.now().Sub(started)
+		if g.latency == 0 {
+			g.latency = elapsed
+		} else {
+			g.latency = time.Duration(latencyWeight*float64(elapsed) + (1-latencyWeight)*float64(g.latency))
+		}
+	}
+	if starts := g.running[key]; len(starts) > 0 {
+		if i := slices.Index(starts, started); i >= 0 {
+			starts = slices.Delete(starts, i, i+1)
+		}
+		if len(starts) == 0 {
+			delete(g.running, key)
+		} else {
+			g.running[key] = starts
+		}
+	}
+	if len(g.waiting) == 0 {
+		g.active--
+		return
+	}
+	next := g.waiting[0]
+	g.waiting = slices.Delete(g.waiting, 0, 1)
+	next.started = g.start(next.key)
+	close(next.ready)
+}
+
+// status reports where key stands, if it is queued or running
+func (g *gate) status(key string) (QueueStatus, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status := QueueStatus{Provider: g.provider, QueueLength: len(g.waiting)}
+	if starts := g.running[key]; len(starts) > 0 {
+		status.State = QueueStateRunning
+		status.EstimatedWait = max(g.latency-g.now().Sub(starts[0]), 0)
+		return status, true
+	}
+	i := slices.IndexFunc(g.waiting, func(w *waiter) bool { return w.key == key })
+	if i < 0 {
+		return QueueStatus{}, false
+	}
+	status.State = QueueStateQueued
+	status.Position = i + 1
+	// Each round of maxConcurrent generations ahead takes about the average latency
+	status.EstimatedWait = g.latency * time.Duration((i+g.maxConcurrent)/g.maxConcurrent)
+	return status, true
+}
@@ -0,0 +1,116 @@
+package llm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queued waits until key is queued and returns its status
+func queued(t *testing.T, router *llm.Router, key string) llm.QueueStatus {
+	t.Helper()
+	var status llm.QueueStatus
+	require.Eventually(t, func() bool {
+		var ok bool
+		status, ok = router.QueueStatus(key)
+		return ok && status.State == llm.QueueStateQueued
+	}, time.Second, time.Millisecond)
+	return status
+}
+
+func TestRouter_Acquire(t *testing.T) {
+	router := llm.NewRouter("ollama")
+	router.LimitConcurrency("ollama", 1, 1)
+	ctx := context.Background()
+
+	// Without a limit a provider never waits
+	release, err := router.Acquire(ctx, "openai", "x")
+	require.NoError(t, err)
+	release()
+	_, ok := router.QueueStatus("x")
+	assert.False(t, ok)
+
+	// The first generation sets the latency average
+	release, err = router.Acquire(ctx, "", "warmup")
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	release()
+
+	releaseA, err := router.Acquire(ctx, "ollama", "a")
+	require.NoError(t, err)
+	status, ok := router.QueueStatus("a")
+	require.True(t, ok)
+	assert.Equal(t, llm.QueueStateRunning, status.State)
+	assert.Equal(t, "ollama", status.Provider)
+
+	acquiredB := make(chan func())
+	go func() {
+		release, err := router.Acquire(ctx, "ollama", "b")
+		assert.NoError(t, err)
+		acquiredB <- release
+	}()
+	status = queued(t, router, "b")
+	assert.Equal(t, 1, status.Position)
+	assert.Equal(t, 1, status.QueueLength)
+	assert.GreaterOrEqual(t, status.EstimatedWait, 20*time.Millisecond)
+
+	// The queue is full, so the next one fails fast
+	_, err = router.Acquire(ctx, "ollama", "c")
+	require.ErrorIs(t, err, llm.ErrBusy)
+	var busy *llm.BusyError
+	require.ErrorAs(t, err, &busy)
+	assert.Equal(t, "ollama", busy.Provider)
+	assert.Greater(t, busy.RetryAfter, time.Duration(0))
+	assert.Contains(t, err.Error(), "LLM busy, try again")
+
+	releaseA()
+	releaseA() // a second release is a no-op
+	releaseB := <-acquiredB
+	status, ok = router.QueueStatus("b")
+	require.True(t, ok)
+	assert.Equal(t, llm.QueueStateRunning, status.State)
+	_, ok = router.QueueStatus("a")
+	assert.False(t, ok)
+
+	// A waiter that gives up leaves the queue
+	waitCtx, cancel := context.WithCancel(ctx)
+	gaveUp := make(chan error)
+	go func() {
+		_, err := router.Acquire(waitCtx, "ollama", "d")
+		gaveUp <- err
+	}()
+	queued(t, router, "d")
+	cancel()
+	assert.ErrorIs(t, <-gaveUp, context.Canceled)
+	_, ok = router.QueueStatus("d")
+	assert.False(t, ok)
+
+	releaseB()
+	release, err = router.Acquire(ctx, "ollama", "e")
+	require.NoError(t, err)
+	release()
+
+	t.Run("shared key", func(t *testing.T) {
+		router := llm.NewRouter("ollama")
+		router.LimitConcurrency("ollama", 2, 1)
+
+		// Two requests sent with the same request ID each keep their entry
+		releaseFirst, err := router.Acquire(ctx, "ollama", "same")
+		require.NoError(t, err)
+		releaseSecond, err := router.Acquire(ctx, "ollama", "same")
+		require.NoError(t, err)
+
+		releaseFirst()
+		status, ok := router.QueueStatus("same")
+		require.True(t, ok)
+		assert.Equal(t, llm.QueueStateRunning, status.State)
+
+		releaseSecond()
+		_, ok = router.QueueStatus("same")
+		assert.False(t, ok)
+	})
+}
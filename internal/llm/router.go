@@ -1,8 +1,15 @@
 package llm
 
 import (
+	"context"
 	"fmt"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/logging"
 )
 
 // Router manages LLM providers and routing
@@ -10,15 +17,35 @@ type Router struct {
 	providers       map[string]Provider
 	factories       map[string]ProviderFactory
 	defaultProvider string
+	customModels    map[string]bool
+	modelLists      map[string]modelList
+	gates           map[string]*gate
 	mu              sync.RWMutex
 }
 
+// Live model listings are trusted for modelListTTL, and retried after modelListRetry
+// when listing fails
+const (
+	modelListTTL     = 10 * time.Minute
+	modelListRetry   = time.Minute
+	modelListTimeout = 5 * time.Second
+)
+
+// modelList is a provider's cached model listing
+type modelList struct {
+	models    []string
+	expiresAt time.Time
+}
+
 // NewRouter creates a new LLM router
 func NewRouter(defaultProvider string) *Router {
 	return &Router{
 		providers:       make(map[string]Provider),
 		factories:       make(map[string]ProviderFactory),
 		defaultProvider: defaultProvider,
+		customModels:    make(map[string]bool),
+		modelLists:      make(map[string]modelList),
+		gates:           make(map[string]*gate),
 	}
 }
 
@@ -64,6 +91,67 @@ func (r *Router) GetProviderWithConfig(name string, config map[string]any) (Prov
 	return provider, nil
 }
 
+// LimitConcurrency runs at most maxConcurrent generations of the named provider at a
+// time, queueing up to maxQueue more. A maxConcurrent of 0 or less lifts the limit.
+func (r *Router) LimitConcurrency(name string, maxConcurrent, maxQueue int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if maxConcurrent <= 0 {
+		delete(r.gates, name)
+		return
+	}
+	r.gates[name] = newGate(name, maxConcurrent, max(maxQueue, 0))
+}
+
+// Acquire waits for a generation slot of the named provider and returns the func
+// releasing it, which may be called more than once. key identifies the generation to
+// QueueStatus; it may be empty or shared. A provider whose queue is full fails fast
+// with a *BusyError.
+func (r *Router) Acquire(ctx context.Context, name, key string) (func(), error) {
+	if name == "" {
+		name = r.defaultProvider
+	}
+	r.mu.RLock()
+	g, ok := r.gates[name]
+	r.mu.RUnlock()
+	if !ok {
+		return func() {}, nil
+	}
+	return g.acquire(ctx, key)
+}
+
+// QueueStatus reports where the generation acquired under key stands, if it is
+// queued or running
+func (r *Router) QueueStatus(key string) (QueueStatus, bool) {
+	if key == "" {
+		return QueueStatus{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, g := range r.gates {
+		if status, ok := g.status(key); ok {
+			return status, true
+		}
+	}
+	return QueueStatus{}, false
+}
+
+// PingDefault checks the default provider, returning its name. Providers that do not
+// implement Pinger only have their configuration checked.
+func (r *Router) PingDefault(ctx context.Context) (string, error) {
+	r.mu.RLock()
+	provider, ok := r.providers[r.defaultProvider]
+	r.mu.RUnlock()
+
+	if !ok || !provider.IsConfigured() {
+		return r.defaultProvider, fmt.Errorf("provider not configured: %s", r.defaultProvider)
+	}
+	if pinger, ok := provider.(Pinger); ok {
+		return r.defaultProvider, pinger.Ping(ctx)
+	}
+	return r.defaultProvider, nil
+}
+
 // ListProviders returns list of configured provider names
 func (r *Router) ListProviders() []string {
 	r.mu.RLock()
@@ -78,6 +166,184 @@ func (r *Router) ListProviders() []string {
 	return providers
 }
 
+// Available returns the sorted names of providers a request may select: configured
+// providers, and those with a factory since users can bring their own keys
+func (r *Router) Available() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for name, p := range r.providers {
+		if p.IsConfigured() {
+			names = append(names, name)
+		}
+	}
+	for name := range r.factories {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// CheckSelection rejects a provider that is not available and, for providers that list
+// their models, a model they do not know. An empty model is always accepted.
+func (r *Router) CheckSelection(ctx context.Context, provider, model string) error {
+	available := r.Available()
+	if !slices.Contains(available, provider) {
+		return fmt.Errorf("unknown llm provider %q, available: %s", provider, strings.Join(available, ", "))
+	}
+	if model == "" {
+		return nil
+	}
+
+	r.mu.RLock()
+	p, ok := r.providers[provider]
+	custom := r.customModels[provider]
+	r.mu.RUnlock()
+	if !ok || custom {
+		return nil
+	}
+	if freeform, ok := p.(FreeformModels); ok && freeform.AcceptsAnyModel() {
+		return nil
+	}
+	if customs, ok := p.(CustomModels); ok && customs.IsCustomModel(model) {
+		return nil
+	}
+	models := r.knownModels(ctx, p)
+	if len(models) == 0 || knownModel(models, model) {
+		return nil
+	}
+	return &UnknownModelError{Provider: provider, Model: model, Models: models, Suggestions: suggestModels(models, model)}
+}
+
+// AllowCustomModels accepts any model name for the named providers, for gateways and
+// accounts serving models the providers do not list
+func (r *Router) AllowCustomModels(names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range names {
+		r.customModels[name] = true
+	}
+}
+
+// knownModels returns the models a provider lists live, cached for modelListTTL, or
+// its AvailableModels when it cannot list them
+func (r *Router) knownModels(ctx context.Context, p Provider) []string {
+	lister, ok := p.(ModelLister)
+	if !ok {
+		return p.AvailableModels()
+	}
+
+	r.mu.RLock()
+	cached, ok := r.modelLists[p.Name()]
+	r.mu.RUnlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.models
+	}
+
+	listCtx, cancel := context.WithTimeout(ctx, modelListTimeout)
+	defer cancel()
+	list := modelList{expiresAt: time.Now().Add(modelListTTL)}
+	models, err := lister.ListModels(listCtx)
+	switch {
+	case err != nil:
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("provider", p.Name()).Msg("failed to list llm models")
+		// The static list stands in for a while rather than retrying on every request
+		list = modelList{models: p.AvailableModels(), expiresAt: time.Now().Add(modelListRetry)}
+	case len(models) == 0:
+		list.models = p.AvailableModels()
+	default:
+		list.models = models
+	}
+	r.mu.Lock()
+	r.modelLists[p.Name()] = list
+	r.mu.Unlock()
+	return list.models
+}
+
+// UnknownModelError is returned by CheckSelection for a model the provider does not serve
+type UnknownModelError struct {
+	Provider    string
+	Model       string
+	Models      []string // the models the provider serves
+	Suggestions []string // the closest models by edit distance, if any are close
+}
+
+func (e *UnknownModelError) Error() string {
+	if len(e.Suggestions) > 0 {
+		return fmt.Sprintf("unknown llm model %q for %s, did you mean: %s", e.Model, e.Provider, strings.Join(e.Suggestions, ", "))
+	}
+	return fmt.Sprintf("unknown llm model %q for %s, available: %s", e.Model, e.Provider, strings.Join(e.Models, ", "))
+}
+
+// snapshotSuffix matches the suffixes of dated or tagged model snapshots, such as the
+// 2024-08-06 of gpt-4o-2024-08-06 or the 20241022 of claude-3-5-sonnet-20241022
+var snapshotSuffix = regexp.MustCompile(`^(\d{4}(-\d{2}-\d{2})?|\d{8}|\d{3}|latest|preview|exp(-\d{4})?)$`)
+
+// knownModel reports whether model is listed, is a snapshot of a listed model, or is the
+// -latest alias of listed snapshots such as claude-3-5-sonnet-latest
+func knownModel(models []string, model string) bool {
+	base, alias := strings.CutSuffix(model, "-latest")
+	for _, m := range models {
+		if model == m {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(model, m+"-"); ok && snapshotSuffix.MatchString(suffix) {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(m, base+"-"); alias && ok && snapshotSuffix.MatchString(suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestModels returns up to three models closest to model by edit distance, leaving
+// out those needing more edits than a third of the name
+func suggestModels(models []string, model string) []string {
+	limit := max(2, len(model)/3)
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for _, m := range models {
+		if d := editDistance(m, model); d <= limit {
+			candidates = append(candidates, candidate{m, d})
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int { return a.distance - b.distance })
+
+	suggestions := make([]string, 0, 3)
+	for _, c := range candidates[:min(3, len(candidates))] {
+		suggestions = append(suggestions, c.name)
+	}
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
 // GetProvider returns a provider by name
 func (r *Router) GetProvider(name string) (Provider, error) {
 	if name == "" {
@@ -0,0 +1,134 @@
+package llm_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider is a provider with a fixed model list
+type stubProvider struct {
+	name       string
+	models     []string
+	configured bool
+	anyModel   bool
+}
+
+func (p *stubProvider) Name() string              { return p.name }
+func (p *stubProvider) AvailableModels() []string { return p.models }
+func (p *stubProvider) DefaultModel() string      { return "" }
+func (p *stubProvider) IsConfigured() bool        { return p.configured }
+func (p *stubProvider) AcceptsAnyModel() bool     { return p.anyModel }
+
+func (p *stubProvider) GenerateSQL(context.Context, llm.Request, string) (*llm.Response, error) {
+	return nil, nil
+}
+
+func (p *stubProvider) GenerateTitle(context.Context, string, string) (string, error) {
+	return "", nil
+}
+
+// listingProvider lists its models live and recognizes fine-tunes by prefix
+type listingProvider struct {
+	stubProvider
+	listed []string
+	err    error
+	calls  int
+}
+
+func (p *listingProvider) ListModels(context.Context) ([]string, error) {
+	p.calls++
+	return p.listed, p.err
+}
+
+func (p *listingProvider) IsCustomModel(model string) bool { return strings.HasPrefix(model, "ft:") }
+
+func TestRouter_CheckSelection(t *testing.T) {
+	router := llm.NewRouter("openai")
+	router.RegisterProvider(&stubProvider{name: "openai", models: []string{"gpt-4o", "gpt-4o-mini", "gpt-4-turbo"}, configured: true})
+	router.RegisterProvider(&stubProvider{name: "ollama", models: []string{"llama3"}, configured: true, anyModel: true})
+	router.RegisterProvider(&stubProvider{name: "anthropic"}) // no key, no factory
+	router.RegisterFactory("deepseek", func(map[string]any) (llm.Provider, error) { return nil, nil })
+
+	assert.Equal(t, []string{"deepseek", "ollama", "openai"}, router.Available())
+
+	tests := []struct {
+		provider, model string
+		wantErr         string
+	}{
+		{provider: "openai"},
+		{provider: "openai", model: "gpt-4o-mini"},
+		{provider: "openai", model: "gpt-4o-2024-08-06"},
+		{provider: "ollama", model: "qwen2.5-coder:7b"},
+		{provider: "deepseek", model: "deepseek-reasoner"},
+		{provider: "openai", model: "gpt-4o-mini-2024-07-18"},
+		{provider: "openai", model: "gpt-4-turbo-preview"},
+		{provider: "openai", model: "gpt-4o mini", wantErr: `unknown llm model "gpt-4o mini" for openai, did you mean: gpt-4o-mini`},
+		{provider: "openai", model: "gpt-4o-miny", wantErr: `unknown llm model "gpt-4o-miny" for openai, did you mean: gpt-4o-mini`},
+		{provider: "openai", model: "gpt-4o-turbo", wantErr: `unknown llm model "gpt-4o-turbo" for openai, did you mean: gpt-4-turbo`},
+		{provider: "openai", model: "o3", wantErr: `unknown llm model "o3" for openai, available: gpt-4o, gpt-4o-mini, gpt-4-turbo`},
+		{provider: "anthropic", wantErr: `unknown llm provider "anthropic", available: deepseek, ollama, openai`},
+		{provider: "groq", wantErr: `unknown llm provider "groq", available: deepseek, ollama, openai`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider+"/"+tt.model, func(t *testing.T) {
+			err := router.CheckSelection(context.Background(), tt.provider, tt.model)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRouter_CheckSelectionUnknownModel(t *testing.T) {
+	router := llm.NewRouter("openai")
+	router.RegisterProvider(&stubProvider{name: "openai", models: []string{"gpt-4o", "gpt-4o-mini"}, configured: true})
+	router.RegisterProvider(&stubProvider{name: "anthropic", models: []string{"claude-3-5-sonnet-20241022"}, configured: true})
+	assert.NoError(t, router.CheckSelection(context.Background(), "anthropic", "claude-3-5-sonnet-latest"), "-latest aliases listed snapshots")
+	assert.Error(t, router.CheckSelection(context.Background(), "anthropic", "claude-3-opus-latest"))
+
+	err := router.CheckSelection(context.Background(), "openai", "gpt-4o-miny")
+	var unknown *llm.UnknownModelError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, []string{"gpt-4o", "gpt-4o-mini"}, unknown.Models)
+	assert.Equal(t, []string{"gpt-4o-mini"}, unknown.Suggestions)
+
+	router.AllowCustomModels("openai")
+	assert.NoError(t, router.CheckSelection(context.Background(), "openai", "gpt-4o-miny"), "custom models skip the check")
+}
+
+func TestRouter_CheckSelectionListsModels(t *testing.T) {
+	ctx := context.Background()
+	provider := &listingProvider{
+		stubProvider: stubProvider{name: "openai", models: []string{"gpt-4o"}, configured: true},
+		listed:       []string{"gpt-4o", "gpt-4.1", "o3"},
+	}
+	router := llm.NewRouter("openai")
+	router.RegisterProvider(provider)
+
+	assert.NoError(t, router.CheckSelection(ctx, "openai", "o3"), "live models are accepted")
+	assert.NoError(t, router.CheckSelection(ctx, "openai", "gpt-4.1"))
+	assert.NoError(t, router.CheckSelection(ctx, "openai", "ft:gpt-4o-mini:acme::abc123"), "fine-tunes are accepted")
+	assert.EqualError(t, router.CheckSelection(ctx, "openai", "gpt-4.2"), `unknown llm model "gpt-4.2" for openai, did you mean: gpt-4.1, gpt-4o`)
+	assert.Equal(t, 1, provider.calls, "the listing is cached")
+
+	t.Run("listing failure falls back to the static list", func(t *testing.T) {
+		provider := &listingProvider{
+			stubProvider: stubProvider{name: "openai", models: []string{"gpt-4o"}, configured: true},
+			err:          errors.New("openai returned status 503"),
+		}
+		router := llm.NewRouter("openai")
+		router.RegisterProvider(provider)
+
+		assert.NoError(t, router.CheckSelection(ctx, "openai", "gpt-4o"))
+		assert.EqualError(t, router.CheckSelection(ctx, "openai", "o3"), `unknown llm model "o3" for openai, available: gpt-4o`)
+		assert.Equal(t, 1, provider.calls, "failures are not retried on every request")
+	})
+}
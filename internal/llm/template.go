@@ -0,0 +1,246 @@
+package llm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Names of the prompt templates. A template directory overrides one with a file named
+// after it plus ".tmpl", and adds a variant of it with <name>.<variant>.tmpl.
+const (
+	TemplateSQLGeneration   = "sql-generation"   // executed with PromptData
+	TemplateMongoGeneration = "mongo-generation" // executed with PromptData
+	TemplateExplanation     = "explanation"      // executed with ExplainPromptData
+	TemplateTitleGeneration = "title-generation" // executed with TitlePromptData
+)
+
+// templateExt is the file extension of prompt templates
+const templateExt = ".tmpl"
+
+//go:embed prompts/*.tmpl
+var embeddedTemplates embed.FS
+
+// PromptData is the data of the SQL and MongoDB generation templates
+type PromptData struct {
+	DatabaseType string
+	Dialect      string // notes on the database's dialect
+	UserContext  string // the user's profile, "" when unknown
+	Schema       string // the schema DDL, noting tables that could not be described
+	Examples     []Example
+	History      []PromptTurn // oldest first
+	Question     string
+	DefaultLimit int // rows returned by queries without a LIMIT, 0 when unknown
+}
+
+// PromptTurn is a message of the chat history
+type PromptTurn struct {
+	Role    string // "User" or "Assistant"
+	Content string // the message text
+	Query   string // the query an assistant answered with, "" for text answers
+	Error   string // why the assistant's answer failed, "" unless it did
+}
+
+// ExplainPromptData is the data of the explanation template
+type ExplainPromptData struct {
+	DatabaseType  string
+	Dialect       string
+	Schema        string
+	SQL           string // the query to explain
+	IssuesHeading string // the line ParseExplanation splits the answer at
+}
+
+// TitlePromptData is the data of the title generation template
+type TitlePromptData struct {
+	Question string
+}
+
+// sampleTemplateData is executed by every template when loading, so templates
+// referring to fields that do not exist are rejected at startup
+var sampleTemplateData = map[string]any{
+	TemplateSQLGeneration:   samplePromptData,
+	TemplateMongoGeneration: samplePromptData,
+	TemplateExplanation:     ExplainPromptData{DatabaseType: "postgres", Dialect: "-", Schema: "-", SQL: "SELECT 1", IssuesHeading: issuesHeading},
+	TemplateTitleGeneration: TitlePromptData{Question: "How many users signed up?"},
+}
+
+var samplePromptData = PromptData{
+	DatabaseType: "postgres",
+	Dialect:      "-",
+	UserContext:  "- Name: Ada",
+	Schema:       "CREATE TABLE users (id INT);",
+	Examples:     []Example{{Question: "How many users?", SQL: "SELECT COUNT(*) FROM users"}},
+	History: []PromptTurn{
+		{Role: "User", Content: "How many users?"},
+		{Role: "Assistant", Query: "SELECT COUNT(*) FROM user", Error: `relation "user" does not exist`},
+	},
+	Question:     "How many users signed up?",
+	DefaultLimit: 100,
+}
+
+// PromptTemplates are the parsed prompt templates and the version of each
+type PromptTemplates struct {
+	templates map[string]*template.Template
+	versions  map[string]string
+}
+
+// defaultTemplates are the embedded templates, and the fallback should an override
+// fail to execute
+var defaultTemplates = mustLoadEmbeddedTemplates()
+
+// activeTemplates are the templates prompts are built from
+var activeTemplates atomic.Pointer[PromptTemplates]
+
+func init() {
+	activeTemplates.Store(defaultTemplates)
+}
+
+func mustLoadEmbeddedTemplates() *PromptTemplates {
+	t, err := LoadPromptTemplates("")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// LoadPromptTemplates parses the embedded prompt templates and overrides them with the
+// templates found in dir, if set. Each template is executed with sample data, so a
+// template that refers to a missing field fails here rather than on a user's question.
+func LoadPromptTemplates(dir string) (*PromptTemplates, error) {
+	t := &PromptTemplates{templates: map[string]*template.Template{}, versions: map[string]string{}}
+	for name := range sampleTemplateData {
+		source, err := embeddedTemplates.ReadFile("prompts/" + name + templateExt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded prompt template %s: %w", name, err)
+		}
+		if err := t.add(name, name, "embedded", source); err != nil {
+			return nil, err
+		}
+	}
+	if dir == "" {
+		return t, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template directory: %w", err)
+	}
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateExt {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), templateExt)
+		base, variant, _ := strings.Cut(name, ".")
+		path := filepath.Join(dir, entry.Name())
+		if _, ok := sampleTemplateData[base]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown prompt template %q, expected one of %s",
+				path, base, strings.Join(slices.Sorted(maps.Keys(sampleTemplateData)), ", ")))
+			continue
+		}
+		if strings.Contains(variant, ".") {
+			errs = append(errs, fmt.Errorf("%s: prompt template variant %q must not contain dots", path, variant))
+			continue
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read prompt template: %w", err))
+			continue
+		}
+		if err := t.add(name, base, path, source); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// add parses and checks the template name, a variant of base or base itself, read
+// from origin
+func (t *PromptTemplates) add(name, base, origin string, source []byte) error {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return fmt.Errorf("%s: invalid prompt template: %w", origin, err)
+	}
+	if err := tmpl.Execute(io.Discard, sampleTemplateData[base]); err != nil {
+		return fmt.Errorf("%s: invalid prompt template: %w", origin, err)
+	}
+	sum := sha256.Sum256(source)
+	t.templates[name] = tmpl
+	t.versions[name] = name + "@" + hex.EncodeToString(sum[:6])
+	return nil
+}
+
+// Version returns the name and content hash of a template, such as
+// "sql-generation@3f2a9c1b7d4e", which changes whenever the template does
+func (t *PromptTemplates) Version(name string) string {
+	return t.versions[name]
+}
+
+// lookup returns the name of the variant of template name, or name itself when
+// variant is empty or has no template
+func (t *PromptTemplates) lookup(name, variant string) string {
+	if variant == "" {
+		return name
+	}
+	if _, ok := t.templates[name+"."+variant]; ok {
+		return name + "." + variant
+	}
+	return name
+}
+
+// UsePromptTemplates makes prompts be built from t
+func UsePromptTemplates(t *PromptTemplates) {
+	activeTemplates.Store(t)
+}
+
+// PromptVersion returns the version of the template BuildPrompt uses for req, so
+// answers can be compared by the prompt that produced them
+func PromptVersion(req Request) string {
+	t := activeTemplates.Load()
+	return t.Version(t.lookup(promptTemplateName(req), req.PromptVariant))
+}
+
+// promptTemplateName returns the template BuildPrompt uses for req
+func promptTemplateName(req Request) string {
+	switch {
+	case req.ExplainSQL != "":
+		return TemplateExplanation
+	case isMongo(req.DatabaseType):
+		return TemplateMongoGeneration
+	default:
+		return TemplateSQLGeneration
+	}
+}
+
+// renderPrompt executes the active template name, or its variant if there is one,
+// with data. An override that fails is logged and the embedded template used instead,
+// so a bad template never fails a question.
+func renderPrompt(name, variant string, data any) string {
+	var buf bytes.Buffer
+	t := activeTemplates.Load()
+	err := t.templates[t.lookup(name, variant)].Execute(&buf, data)
+	if err != nil {
+		log.Error().Err(err).Str("template", name).Msg("failed to execute prompt template, using the embedded one")
+		buf.Reset()
+		if err := defaultTemplates.templates[name].Execute(&buf, data); err != nil {
+			log.Error().Err(err).Str("template", name).Msg("failed to execute embedded prompt template")
+		}
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,96 @@
+package llm_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, dir, name, source string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(source), 0o600))
+}
+
+func TestLoadPromptTemplates(t *testing.T) {
+	embedded, err := llm.LoadPromptTemplates("")
+	require.NoError(t, err)
+	for _, name := range []string{llm.TemplateSQLGeneration, llm.TemplateMongoGeneration, llm.TemplateExplanation, llm.TemplateTitleGeneration} {
+		assert.True(t, strings.HasPrefix(embedded.Version(name), name+"@"), name)
+	}
+
+	t.Run("override", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "title-generation.tmpl", "Title for: {{.Question}}")
+		writeTemplate(t, dir, "README.md", "not a template")
+
+		templates, err := llm.LoadPromptTemplates(dir)
+		require.NoError(t, err)
+		assert.NotEqual(t, embedded.Version(llm.TemplateTitleGeneration), templates.Version(llm.TemplateTitleGeneration))
+		assert.Equal(t, embedded.Version(llm.TemplateSQLGeneration), templates.Version(llm.TemplateSQLGeneration))
+
+		llm.UsePromptTemplates(templates)
+		t.Cleanup(func() { llm.UsePromptTemplates(embedded) })
+		assert.Equal(t, "Title for: Revenue by month", llm.BuildTitlePrompt("Revenue by month"))
+	})
+
+	t.Run("variant", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "sql-generation.terse.tmpl", "SQL for {{.DatabaseType}}: {{.Question}}")
+
+		templates, err := llm.LoadPromptTemplates(dir)
+		require.NoError(t, err)
+		llm.UsePromptTemplates(templates)
+		t.Cleanup(func() { llm.UsePromptTemplates(embedded) })
+
+		req := llm.Request{DatabaseType: "postgres", Question: "Revenue by month", PromptVariant: "terse"}
+		assert.Equal(t, "SQL for postgres: Revenue by month", llm.BuildPrompt(req))
+		assert.True(t, strings.HasPrefix(llm.PromptVersion(req), "sql-generation.terse@"))
+
+		// A variant without its own template falls back to the regular one
+		req.DatabaseType = "mongodb"
+		assert.Equal(t, templates.Version(llm.TemplateMongoGeneration), llm.PromptVersion(req))
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "summary.tmpl", "{{.Question}}")
+
+		_, err := llm.LoadPromptTemplates(dir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown prompt template "summary"`)
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "sql-generation.tmpl", "{{.Schema}}\n{{.Tables}}")
+
+		_, err := llm.LoadPromptTemplates(dir)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "sql-generation.tmpl: invalid prompt template")
+		assert.Contains(t, err.Error(), "Tables")
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTemplate(t, dir, "explanation.tmpl", "{{if .SQL}}")
+
+		_, err := llm.LoadPromptTemplates(dir)
+		assert.ErrorContains(t, err, "explanation.tmpl: invalid prompt template")
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		_, err := llm.LoadPromptTemplates(filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, err)
+	})
+}
+
+func TestPromptVersion(t *testing.T) {
+	assert.True(t, strings.HasPrefix(llm.PromptVersion(llm.Request{DatabaseType: "postgres"}), llm.TemplateSQLGeneration+"@"))
+	assert.True(t, strings.HasPrefix(llm.PromptVersion(llm.Request{DatabaseType: "mongodb"}), llm.TemplateMongoGeneration+"@"))
+	assert.True(t, strings.HasPrefix(llm.PromptVersion(llm.Request{ExplainSQL: "SELECT 1"}), llm.TemplateExplanation+"@"))
+}
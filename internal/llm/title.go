@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaxTitleRunes is the longest generated session title, in runes
+const MaxTitleRunes = 60
+
+// titleEllipsis marks a truncated title
+const titleEllipsis = "..."
+
+// TruncateTitle shortens title to at most maxRunes runes plus an ellipsis. It never
+// cuts inside a character: combining marks, emoji modifiers and joined emoji stay with
+// the rune before them, and flags stay whole.
+func TruncateTitle(title string, maxRunes int) string {
+	runes := []rune(strings.ToValidUTF8(title, ""))
+	if len(runes) <= maxRunes {
+		return string(runes)
+	}
+
+	cut := maxRunes
+	for cut > 0 && (extendsPrevious(runes[cut]) || runes[cut-1] == zeroWidthJoiner) {
+		cut--
+	}
+	// Flags are pairs of regional indicators; an odd run before the cut splits one
+	indicators := 0
+	for i := cut - 1; i >= 0 && isRegionalIndicator(runes[i]); i-- {
+		indicators++
+	}
+	if indicators%2 == 1 && cut < len(runes) && isRegionalIndicator(runes[cut]) {
+		cut--
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + titleEllipsis
+}
+
+// CleanTitle turns a model's answer to a title prompt into a title: the first line,
+// without thinking tags, surrounding quotes or a "Title:" label, truncated to
+// MaxTitleRunes. It returns "" when nothing is left.
+func CleanTitle(raw string) string {
+	raw = removeThinkingTags(raw)
+	title := ""
+	for _, line := range strings.Split(raw, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			title = line
+			break
+		}
+	}
+	if label := len("title:"); len(title) >= label && strings.EqualFold(title[:label], "title:") {
+		title = strings.TrimSpace(title[label:])
+	}
+	title = strings.TrimSpace(strings.Trim(title, "\"'`*“”‘’"))
+	return TruncateTitle(title, MaxTitleRunes)
+}
+
+const (
+	zeroWidthJoiner = '\u200d'
+	emojiModifiers  = "\U0001F3FB\U0001F3FC\U0001F3FD\U0001F3FE\U0001F3FF"
+)
+
+// extendsPrevious reports whether r belongs to the character of the rune before it
+func extendsPrevious(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector) ||
+		r == zeroWidthJoiner || strings.ContainsRune(emojiModifiers, r)
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= '\U0001F1E6' && r <= '\U0001F1FF'
+}
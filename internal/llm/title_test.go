@@ -0,0 +1,59 @@
+package llm_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncateTitle(t *testing.T) {
+	tests := []struct {
+		name     string
+		title    string
+		maxRunes int
+		want     string
+	}{
+		{"short", "Count users", 30, "Count users"},
+		{"exact length", "abcde", 5, "abcde"},
+		{"ascii", "How many orders were placed last month?", 30, "How many orders were placed la..."},
+		{"trailing space dropped", "Show all the orders", 9, "Show all..."},
+		{"indonesian", "Berapa jumlah pesanan bulan ini?", 13, "Berapa jumlah..."},
+		{"chinese", "上个月每个地区的订单总数是多少", 6, "上个月每个地..."},
+		{"emoji", "📈📉📊📈📉📊", 4, "📈📉📊📈..."},
+		{"combining mark kept with its letter", "cafe\u0301 menu", 4, "caf..."},
+		{"skin tone kept with its emoji", "👍👍\U0001F3FD ok", 2, "👍..."},
+		{"joined emoji not split", "a👩\u200d💻 b", 3, "a..."},
+		{"flag not split", "🇮🇩🇯🇵", 3, "🇮🇩..."},
+		{"invalid utf-8 dropped", "ab\xffcd", 10, "abcd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := llm.TruncateTitle(tt.title, tt.maxRunes)
+			assert.Equal(t, tt.want, got)
+			assert.True(t, utf8.ValidString(got))
+		})
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{"quoted", `  "Monthly Revenue"  `, "Monthly Revenue"},
+		{"label and extra lines", "Title: Pesanan per Wilayah\n\nThis title summarizes the question.", "Pesanan per Wilayah"},
+		{"curly quotes", "“订单统计”", "订单统计"},
+		{"thinking removed", "<think>short</think>\nTop customers", "Top customers"},
+		{"empty", "  \n ", ""},
+		{"long", strings.Repeat("数据", 40), strings.Repeat("数据", 30) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, llm.CleanTitle(tt.raw))
+		})
+	}
+}
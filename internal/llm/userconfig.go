@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// MaxUserSettingLength caps the length of a string a user stores in their provider config
+const MaxUserSettingLength = 2048
+
+// settingKind is the JSON type a user provider setting takes
+type settingKind int
+
+const (
+	settingString         settingKind = iota // a string
+	settingStringOrNumber                    // a duration or a number of seconds
+	settingNumber                            // a number
+)
+
+func (k settingKind) String() string {
+	switch k {
+	case settingStringOrNumber:
+		return "a string or a number"
+	case settingNumber:
+		return "a number"
+	}
+	return "a string"
+}
+
+// hostedSettings are the settings the factories of hosted providers read
+var hostedSettings = map[string]settingKind{
+	"api_key":    settingString,
+	"model":      settingString,
+	"base_url":   settingString,
+	"http_proxy": settingString,
+	"timeout":    settingStringOrNumber,
+}
+
+// userSettings are the settings a user may store for each provider
+var userSettings = map[string]map[string]settingKind{
+	"openai":    hostedSettings,
+	"anthropic": hostedSettings,
+	"deepseek":  hostedSettings,
+	"gemini":    hostedSettings,
+	"ollama": {
+		"host":        settingString,
+		"model":       settingString,
+		"http_proxy":  settingString,
+		"timeout":     settingStringOrNumber,
+		"keep_alive":  settingStringOrNumber,
+		"num_ctx":     settingNumber,
+		"num_predict": settingNumber,
+	},
+}
+
+// CheckUserSetting rejects a setting of a user's provider config the provider does
+// not read, or a value of the wrong type
+func CheckUserSetting(provider, key string, value any) error {
+	settings, ok := userSettings[provider]
+	if !ok {
+		return fmt.Errorf("llm_config: unknown provider %q", provider)
+	}
+	kind, ok := settings[key]
+	if !ok {
+		return fmt.Errorf("llm_config.%s: unknown setting %q, allowed: %s", provider, key, strings.Join(slices.Sorted(maps.Keys(settings)), ", "))
+	}
+
+	switch v := value.(type) {
+	case string:
+		if kind == settingNumber {
+			return fmt.Errorf("llm_config.%s.%s must be %s", provider, key, kind)
+		}
+		if len(v) > MaxUserSettingLength {
+			return fmt.Errorf("llm_config.%s.%s must be at most %d characters", provider, key, MaxUserSettingLength)
+		}
+	case float64:
+		if kind == settingString {
+			return fmt.Errorf("llm_config.%s.%s must be %s", provider, key, kind)
+		}
+	default:
+		return fmt.Errorf("llm_config.%s.%s must be %s", provider, key, kind)
+	}
+	return nil
+}
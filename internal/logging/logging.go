@@ -0,0 +1,69 @@
+// Package logging carries a request-scoped logger through the context so log lines
+// written deep in services can be tied back to the request, user and workspace.
+package logging
+
+import (
+	"context"
+	"maps"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+type contextKey struct{}
+
+// scope is the logger of one request plus the phase timings gathered while serving it
+type scope struct {
+	logger zerolog.Logger
+
+	mu     sync.Mutex
+	phases map[string]int64
+}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger zerolog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, &scope{logger: logger})
+}
+
+// FromContext returns the logger stored in ctx, or the global logger if there is none
+func FromContext(ctx context.Context) *zerolog.Logger {
+	if s, ok := ctx.Value(contextKey{}).(*scope); ok {
+		return &s.logger
+	}
+	return &log.Logger
+}
+
+// With adds fields to the logger stored in ctx, so lines written by callers further
+// out in the request, like the access log, carry them too. It does nothing when ctx
+// has no logger. Fields must be added before the request fans out to other goroutines.
+func With(ctx context.Context, fields func(c zerolog.Context) zerolog.Context) {
+	if s, ok := ctx.Value(contextKey{}).(*scope); ok {
+		s.logger.UpdateContext(fields)
+	}
+}
+
+// SetPhase records how long a phase of the request took in milliseconds
+func SetPhase(ctx context.Context, name string, ms int64) {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.phases == nil {
+		s.phases = make(map[string]int64)
+	}
+	s.phases[name] = ms
+}
+
+// Phases returns the phase timings recorded in ctx
+func Phases(ctx context.Context) map[string]int64 {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.phases)
+}
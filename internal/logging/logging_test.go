@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromContext(t *testing.T) {
+	assert.Same(t, &log.Logger, FromContext(context.Background()))
+
+	var buf bytes.Buffer
+	ctx := NewContext(context.Background(), zerolog.New(&buf).With().Str("request_id", "req-1").Logger())
+	With(ctx, func(c zerolog.Context) zerolog.Context { return c.Str("user_id", "u-1") })
+
+	FromContext(ctx).Info().Msg("hello")
+	assert.JSONEq(t, `{"level": "info", "request_id": "req-1", "user_id": "u-1", "message": "hello"}`, buf.String())
+}
+
+func TestPhases(t *testing.T) {
+	SetPhase(context.Background(), "llm_ms", 10) // no logger, no-op
+	assert.Nil(t, Phases(context.Background()))
+
+	ctx := NewContext(context.Background(), zerolog.Nop())
+	SetPhase(ctx, "llm_ms", 10)
+	SetPhase(ctx, "total_ms", 25)
+	phases := Phases(ctx)
+	assert.Equal(t, map[string]int64{"llm_ms": 10, "total_ms": 25}, phases)
+
+	phases["llm_ms"] = 0
+	assert.Equal(t, int64(10), Phases(ctx)["llm_ms"], "callers get a copy")
+}
@@ -1,7 +1,9 @@
 package mcp
 
 import (
+	"cmp"
 	"context"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,7 @@ type TableInfo struct {
 	SchemaName string       `json:"schema_name,omitempty"`
 	Columns    []ColumnInfo `json:"columns"`
 	RowCount   *int64       `json:"row_count,omitempty"`
+	Indexes    []IndexInfo  `json:"indexes,omitempty"`
 }
 
 // ColumnInfo contains column metadata
@@ -22,12 +25,37 @@ type ColumnInfo struct {
 	Description string `json:"description,omitempty"`
 }
 
+// IndexInfo describes an index by its key columns, in order. Primary keys are
+// reported on their columns instead.
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+}
+
+// IndexComments renders indexes as the comments listed under a table in schema DDL,
+// each on its own line after a newline
+func IndexComments(indexes []IndexInfo) string {
+	var sb strings.Builder
+	for _, idx := range indexes {
+		kind := "INDEX"
+		if idx.Unique {
+			kind = "UNIQUE INDEX"
+		}
+		sb.WriteString("\n-- " + kind + " (" + strings.Join(idx.Columns, ", ") + ")")
+	}
+	return sb.String()
+}
+
 // QueryResult contains query execution result
 type QueryResult struct {
 	Columns   []string `json:"columns"`
 	Rows      [][]any  `json:"rows"`
 	RowCount  int      `json:"row_count"`
 	Truncated bool     `json:"truncated"`
+	// DefaultLimitApplied is set when the query had no LIMIT of its own and was limited
+	// to the default limit rather than to MaxRows
+	DefaultLimitApplied bool `json:"default_limit_applied,omitempty"`
 }
 
 // ConnectionConfig contains database connection parameters
@@ -40,12 +68,48 @@ type ConnectionConfig struct {
 	SSLMode        string
 	MaxRows        int
 	TimeoutSeconds int
+	Pool           PoolOptions // the router's options when unset
+	// ReplicaHost and ReplicaPort name a read replica, empty without one; ReplicaPort 0
+	// means Port. Adapters that support one send it queries, or schema introspection
+	// with ReplicaForSchema, and use the primary while it cannot be reached.
+	ReplicaHost      string
+	ReplicaPort      int
+	ReplicaForSchema bool
+	// OnReplicaFallback is called when the replica cannot be reached; the router sets it
+	OnReplicaFallback func()
+}
+
+// Replica returns the config of the read replica, with no replica of its own, and
+// whether there is one
+func (c ConnectionConfig) Replica() (ConnectionConfig, bool) {
+	if c.ReplicaHost == "" {
+		return ConnectionConfig{}, false
+	}
+	replica := c
+	replica.Host = c.ReplicaHost
+	replica.Port = cmp.Or(c.ReplicaPort, c.Port)
+	replica.ReplicaHost, replica.ReplicaPort, replica.ReplicaForSchema = "", 0, false
+	replica.OnReplicaFallback = nil
+	return replica, true
 }
 
 // QueryOptions contains query execution options
 type QueryOptions struct {
 	MaxRows int
-	Timeout time.Duration
+	// DefaultLimit is how many rows a query without a LIMIT of its own returns; 0 or
+	// more than MaxRows means MaxRows
+	DefaultLimit int
+	Timeout      time.Duration
+}
+
+// RowLimit returns how many rows a query may return: the default limit when it has
+// no LIMIT of its own and the default is below MaxRows, otherwise MaxRows, which also
+// caps a query's own LIMIT
+func (o QueryOptions) RowLimit(hasLimit bool) (limit int, defaultApplied bool) {
+	if !hasLimit && o.DefaultLimit > 0 && o.DefaultLimit < o.MaxRows {
+		return o.DefaultLimit, true
+	}
+	return o.MaxRows, false
 }
 
 // Adapter defines the interface for database adapters
@@ -81,5 +145,32 @@ type Adapter interface {
 	ExecuteQuery(ctx context.Context, sql string, opts QueryOptions) (*QueryResult, error)
 }
 
+// QueryEstimate is the planner's estimate of the work a query will do
+type QueryEstimate struct {
+	Rows float64 // most rows any step of the plan reads or produces
+	Cost float64 // planner cost units; 0 when the database reports none
+}
+
+// Explainer is implemented by adapters that can estimate a query before running it
+type Explainer interface {
+	// ExplainQuery asks the planner for an estimate without executing sql
+	ExplainQuery(ctx context.Context, sql string) (*QueryEstimate, error)
+}
+
+// SchemaOrderer is implemented by adapters that can order the tables of their schema
+// DDL. GetSchemaDDL of these adapters uses the default options.
+type SchemaOrderer interface {
+	// OrderedSchemaDDL returns the schema as DDL with tables ordered following opts,
+	// each annotated with its estimated row count
+	OrderedSchemaDDL(ctx context.Context, opts SchemaOptions) (string, error)
+}
+
+// SchemaDescriber is implemented by adapters that can describe all their tables in a
+// few queries, instead of one DescribeTable round trip per table
+type SchemaDescriber interface {
+	// DescribeTables describes the tables ListTables returns, in the same order
+	DescribeTables(ctx context.Context) ([]TableInfo, error)
+}
+
 // AdapterFactory creates a new adapter instance
 type AdapterFactory func() Adapter
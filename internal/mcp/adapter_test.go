@@ -0,0 +1,33 @@
+package mcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexComments(t *testing.T) {
+	assert.Empty(t, IndexComments(nil))
+	assert.Equal(t, "\n-- INDEX (customer_id, created_at)\n-- UNIQUE INDEX (email)", IndexComments([]IndexInfo{
+		{Name: "orders_customer_created", Columns: []string{"customer_id", "created_at"}},
+		{Name: "users_email_key", Columns: []string{"email"}, Unique: true},
+	}))
+}
+
+func TestQueryOptions_RowLimit(t *testing.T) {
+	opts := QueryOptions{MaxRows: 1000, DefaultLimit: 100}
+
+	limit, applied := opts.RowLimit(false)
+	assert.Equal(t, 100, limit)
+	assert.True(t, applied)
+
+	limit, applied = opts.RowLimit(true)
+	assert.Equal(t, 1000, limit, "an explicit LIMIT is capped by MaxRows")
+	assert.False(t, applied)
+
+	for _, defaultLimit := range []int{0, 1000, 5000} {
+		limit, applied = QueryOptions{MaxRows: 1000, DefaultLimit: defaultLimit}.RowLimit(false)
+		assert.Equal(t, 1000, limit, "default limit %d", defaultLimit)
+		assert.False(t, applied, "default limit %d", defaultLimit)
+	}
+}
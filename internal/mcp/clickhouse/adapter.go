@@ -3,20 +3,38 @@ package clickhouse
 import (
 	"context"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
 )
 
 // Adapter implements mcp.Adapter for ClickHouse using HTTP protocol
 type Adapter struct {
-	client   *HTTPClient
-	database string
+	client         *HTTPClient
+	database       string
+	maxMemoryUsage int64
+	// settingsRefused is set once the server refused the query settings, so later
+	// queries run without them
+	settingsRefused atomic.Bool
 }
 
 // NewAdapter creates a new ClickHouse adapter
 func NewAdapter() mcp.Adapter {
-	return &Adapter{}
+	return &Adapter{maxMemoryUsage: DefaultMaxMemoryUsage}
+}
+
+// NewAdapterFactory returns a factory of ClickHouse adapters that cap the memory of a
+// query at maxMemoryUsage bytes; 0 leaves the limit to the server
+func NewAdapterFactory(maxMemoryUsage int64) mcp.AdapterFactory {
+	return func() mcp.Adapter {
+		return &Adapter{maxMemoryUsage: maxMemoryUsage}
+	}
 }
 
 // DatabaseType returns the database type identifier
@@ -26,7 +44,11 @@ func (a *Adapter) DatabaseType() string {
 
 // SQLDialect returns SQL dialect hints for LLM prompting
 func (a *Adapter) SQLDialect() string {
-	return `ClickHouse SQL dialect:
+	return Dialect
+}
+
+// Dialect holds the SQL dialect hints given to the LLM, which need no connection
+const Dialect = `ClickHouse SQL dialect:
 - Use backticks for identifiers: ` + "`column_name`" + `
 - String concatenation: concat(a, b) or a || b
 - Date functions: today(), now(), toDate(), toDateTime()
@@ -43,7 +65,6 @@ func (a *Adapter) SQLDialect() string {
 - Prefer using MergeTree tables
 - Use FINAL for ReplacingMergeTree/CollapsingMergeTree when needed
 - Avoid SELECT * on large tables, specify columns`
-}
 
 // Connect establishes connection to ClickHouse using HTTP protocol
 func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error {
@@ -58,7 +79,7 @@ func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) erro
 
 	// Test connection
 	if err := a.client.Ping(ctx); err != nil {
-		return fmt.Errorf("failed to ping: %w", err)
+		return security.Redact(fmt.Errorf("failed to ping: %w", err), config.Password)
 	}
 
 	return nil
@@ -108,6 +129,11 @@ func (a *Adapter) ListTables(ctx context.Context) ([]string, error) {
 
 // DescribeTable returns detailed table schema
 func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.TableInfo, error) {
+	// ClickHouse escapes with backslashes rather than doubling, so reject anything needing escapes
+	if err := mcp.ValidateStrictIdentifier(tableName); err != nil {
+		return nil, fmt.Errorf("invalid table name: %w", err)
+	}
+
 	query := fmt.Sprintf(`
 		SELECT 
 			name,
@@ -158,17 +184,8 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 	countResults, err := a.client.Query(ctx, countQuery)
 	var rowCountPtr *int64
 	if err == nil && len(countResults) > 0 {
-		if count, ok := countResults[0]["total_rows"]; ok {
-			var rowCount int64
-			switch v := count.(type) {
-			case float64:
-				rowCount = int64(v)
-			case int64:
-				rowCount = v
-			}
-			if rowCount >= 0 {
-				rowCountPtr = &rowCount
-			}
+		if rowCount, ok := toInt64(countResults[0]["total_rows"]); ok && rowCount >= 0 {
+			rowCountPtr = &rowCount
 		}
 	}
 
@@ -181,11 +198,20 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 
 // GetSchemaDDL returns full schema as DDL for LLM context
 func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
-	// 1. Get List of all tables first
+	return a.OrderedSchemaDDL(ctx, mcp.SchemaOptions{})
+}
+
+// OrderedSchemaDDL returns the schema as DDL with tables ordered following opts. Only
+// the first tables are described in full.
+func (a *Adapter) OrderedSchemaDDL(ctx context.Context, opts mcp.SchemaOptions) (string, error) {
+	// 1. Get List of all tables first, in the requested order
 	tables, err := a.ListTables(ctx)
 	if err != nil {
 		return "", err
 	}
+	// Row counts are only a hint, so tables stay unordered by size without them
+	rowCounts, _ := a.rowCounts(ctx)
+	tables = mcp.OrderTables(tables, rowCounts, opts)
 
 	// 2. Decide strategy based on table count
 	// If too many tables, only include full schema for a subset to save tokens
@@ -229,32 +255,30 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 			return "", fmt.Errorf("failed to get schema details: %w", err)
 		}
 
-		currentTable := ""
+		columns := make(map[string][]string)
 		for _, row := range results {
 			tableName, _ := row["table"].(string)
 			columnName, _ := row["name"].(string)
 			dataType, _ := row["type"].(string)
 			isPrimaryKey := toBool(row["is_in_primary_key"])
 
-			if tableName != currentTable {
-				if currentTable != "" {
-					ddl.WriteString("\n);\n\n")
-				}
-				ddl.WriteString(fmt.Sprintf("CREATE TABLE %s (\n", tableName))
-				currentTable = tableName
-			} else {
-				ddl.WriteString(",\n")
-			}
-
 			pk := ""
 			if isPrimaryKey {
 				pk = " -- PRIMARY KEY"
 			}
 
-			ddl.WriteString(fmt.Sprintf("  %s %s%s", columnName, dataType, pk))
+			columns[tableName] = append(columns[tableName], fmt.Sprintf("  %s %s%s", columnName, dataType, pk))
 		}
-		if currentTable != "" {
-			ddl.WriteString("\n);\n\n")
+
+		for _, tableName := range tablesToDescribe {
+			if len(columns[tableName]) == 0 {
+				continue
+			}
+			ddl.WriteString(fmt.Sprintf("CREATE TABLE %s (", tableName))
+			if n, ok := rowCounts[tableName]; ok {
+				ddl.WriteString(mcp.RowCountComment(n))
+			}
+			ddl.WriteString("\n" + strings.Join(columns[tableName], ",\n") + "\n);\n\n")
 		}
 	}
 
@@ -269,19 +293,174 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 	return ddl.String(), nil
 }
 
-// ValidateQuery validates SQL is safe to execute
+// rowCounts returns the row counts of the tables whose engine keeps one
+func (a *Adapter) rowCounts(ctx context.Context) (map[string]int64, error) {
+	results, err := a.client.Query(ctx, `
+		SELECT name, total_rows
+		FROM system.tables
+		WHERE database = currentDatabase() AND total_rows IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get row counts: %w", err)
+	}
+
+	counts := make(map[string]int64)
+	for _, row := range results {
+		name, _ := row["name"].(string)
+		if count, ok := toInt64(row["total_rows"]); ok {
+			counts[name] = count
+		}
+	}
+	return counts, nil
+}
+
+// RuleSettingsClause is reported for queries with a SETTINGS clause
+const RuleSettingsClause = "clickhouse: SETTINGS clause blocked"
+
+// DefaultMaxMemoryUsage caps the memory, in bytes, a query may use on the server
+const DefaultMaxMemoryUsage = 4 << 30
+
+// ValidateQuery validates SQL is safe to execute. SETTINGS clauses are rejected, so a
+// query cannot lift the limits set by querySettings.
 func (a *Adapter) ValidateQuery(sql string) error {
-	return mcp.ValidateSQL(sql, mcp.ClickhouseBlockedPatterns)
+	if err := mcp.ValidateSQL(sql, mcp.DialectClickHouse, mcp.ClickhouseBlockedPatterns); err != nil {
+		return err
+	}
+	// A SETTINGS clause is the keyword followed by name = value; a column named
+	// settings is not followed by =
+	tokens := mcp.Tokenize(sql, mcp.DialectClickHouse)
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].Kind == mcp.TokenWord && strings.EqualFold(tokens[i].Text, "SETTINGS") &&
+			tokens[i+1].Kind == mcp.TokenWord && tokens[i+2].Text == "=" {
+			return &mcp.ValidationError{Rule: RuleSettingsClause, Matched: sql[tokens[i].Start:tokens[i+2].End], Position: tokens[i].Start}
+		}
+	}
+	return nil
+}
+
+// querySettings returns the settings sent with a query to bound its run time, memory
+// and result size on the server. Rows past limit+1 are not sent, with break rather
+// than an error, so truncation is still detected.
+func (a *Adapter) querySettings(opts mcp.QueryOptions, limit int) map[string]string {
+	settings := map[string]string{
+		"max_result_rows":      strconv.Itoa(limit + 1),
+		"result_overflow_mode": "break",
+		readonlySetting:        "1",
+	}
+	if a.maxMemoryUsage > 0 {
+		settings["max_memory_usage"] = strconv.FormatInt(a.maxMemoryUsage, 10)
+	}
+	if opts.Timeout > 0 {
+		settings["max_execution_time"] = strconv.Itoa(int(math.Ceil(opts.Timeout.Seconds())))
+	}
+	return settings
+}
+
+// isReadonlyError reports whether err is the server refusing to change a setting
+// because the user is in readonly mode
+func isReadonlyError(err error) bool {
+	return strings.Contains(err.Error(), "Code: 164.") || strings.Contains(err.Error(), "(READONLY)")
+}
+
+// PageQuery returns the rows of page with LIMIT and OFFSET, or a keyset predicate
+func (a *Adapter) PageQuery(sql string, page mcp.Page) (string, error) {
+	return mcp.LimitOffsetPage(sql, page, mcp.QuoteBacktick)
 }
 
 // ExecuteQuery executes read-only SQL query
 func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, nil, opts)
+	})
+}
+
+// Placeholder returns the placeholder of the n-th query parameter, typed for the server
+func (a *Adapter) Placeholder(n int, typ mcp.ParamType) string {
+	return fmt.Sprintf("{p%d:%s}", n, clickhouseParamTypes[typ])
+}
+
+// ExecuteQueryWithParams executes read-only SQL with {pN:Type} placeholders bound to params
+func (a *Adapter) ExecuteQueryWithParams(ctx context.Context, sql string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, params, opts)
+	})
+}
+
+// clickhouseParamTypes maps parameter types to ClickHouse types
+var clickhouseParamTypes = map[mcp.ParamType]string{
+	mcp.ParamString:    "String",
+	mcp.ParamInteger:   "Int64",
+	mcp.ParamNumber:    "Float64",
+	mcp.ParamBoolean:   "Bool",
+	mcp.ParamDate:      "Date",
+	mcp.ParamTimestamp: "DateTime",
+}
+
+// paramValues formats params as the server parses query parameters: in the escaped
+// text format, keyed by placeholder name
+func paramValues(params []mcp.QueryParam) map[string]string {
+	values := make(map[string]string, len(params))
+	for i, p := range params {
+		var value string
+		switch v := p.Value.(type) {
+		case time.Time:
+			if p.Type == mcp.ParamDate {
+				value = v.Format(time.DateOnly)
+			} else {
+				value = v.UTC().Format(time.DateTime)
+			}
+		case string:
+			value = paramEscaper.Replace(v)
+		default:
+			value = fmt.Sprint(v)
+		}
+		values[fmt.Sprintf("p%d", i+1)] = value
+	}
+	return values
+}
+
+// paramEscaper escapes string parameters, which the server reads in the escaped format
+var paramEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// ExplainQuery estimates the rows the query reads with EXPLAIN ESTIMATE. ClickHouse
+// reports no cost, only rows, parts and marks per table.
+func (a *Adapter) ExplainQuery(ctx context.Context, sql string) (*mcp.QueryEstimate, error) {
+	if err := a.ValidateQuery(sql); err != nil {
+		return nil, err
+	}
+
+	results, err := a.client.Query(ctx, "EXPLAIN ESTIMATE "+strings.TrimRight(strings.TrimSpace(sql), ";"))
+	if err != nil {
+		return nil, fmt.Errorf("explain failed: %w", err)
+	}
+	return &mcp.QueryEstimate{Rows: estimatedRows(results)}, nil
+}
+
+// estimatedRows sums the rows read from each table. 64-bit integers arrive as
+// strings in JSON output.
+func estimatedRows(results []map[string]interface{}) float64 {
+	var total float64
+	for _, row := range results {
+		switch rows := row["rows"].(type) {
+		case float64:
+			total += rows
+		case string:
+			n, _ := strconv.ParseFloat(rows, 64)
+			total += n
+		}
+	}
+	return total
+}
+
+// executeQuery validates, limits and runs the query with params bound to its placeholders
+func (a *Adapter) executeQuery(ctx context.Context, sql string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
 	if err := a.ValidateQuery(sql); err != nil {
 		return nil, err
 	}
 
-	// Enforce LIMIT
-	sql = mcp.EnforceLimit(sql, opts.MaxRows, "LIMIT")
+	// Enforce LIMIT, one row past the limit so truncation can be detected
+	limit, defaultApplied := opts.RowLimit(mcp.HasLimit(sql))
+	sql = mcp.EnforceLimit(sql, limit+1, "LIMIT")
 
 	// Create context with timeout
 	if opts.Timeout > 0 {
@@ -290,48 +469,43 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 		defer cancel()
 	}
 
-	results, err := a.client.Query(ctx, sql)
+	var settings map[string]string
+	if !a.settingsRefused.Load() {
+		settings = a.querySettings(opts, limit)
+	}
+	columns, resultRows, err := a.client.QueryColumns(ctx, sql, paramValues(params), settings)
+	if err != nil && settings != nil && isReadonlyError(err) {
+		// The user's profile is readonly=1, which forbids changing settings but already
+		// keeps queries from writing; the LIMIT still bounds the rows
+		a.settingsRefused.Store(true)
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).
+			Msg("ClickHouse refused query settings, running queries on this connection without resource limits")
+		columns, resultRows, err = a.client.QueryColumns(ctx, sql, paramValues(params), nil)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
 
-	// Convert results to row format
-	var columns []string
-	var resultRows [][]any
-
-	if len(results) > 0 {
-		// Get column names from first row
-		for key := range results[0] {
-			columns = append(columns, key)
-		}
-
-		// Convert rows
-		for i, row := range results {
-			if i >= opts.MaxRows {
-				break
-			}
-			values := make([]any, len(columns))
-			for j, col := range columns {
-				values[j] = row[col]
-			}
-			resultRows = append(resultRows, values)
-		}
+	truncated := len(resultRows) > limit
+	if truncated {
+		resultRows = resultRows[:limit]
 	}
 
-	truncated := len(results) > opts.MaxRows
-
 	return &mcp.QueryResult{
-		Columns:   columns,
-		Rows:      resultRows,
-		RowCount:  len(resultRows),
-		Truncated: truncated,
+		Columns:             columns,
+		Rows:                resultRows,
+		RowCount:            len(resultRows),
+		Truncated:           truncated,
+		DefaultLimitApplied: defaultApplied,
 	}, nil
 }
 
 // Helper functions
 
+// escapeSQLString escapes s for a single-quoted ClickHouse string literal.
+// Backslash is an escape character in ClickHouse literals, so it is escaped first.
 func escapeSQLString(s string) string {
-	return strings.ReplaceAll(s, "'", "''")
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s)
 }
 
 func toBool(v interface{}) bool {
@@ -350,3 +524,17 @@ func toBool(v interface{}) bool {
 		return false
 	}
 }
+
+// toInt64 converts a number from JSON output, where 64-bit integers arrive as strings
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int64(n), true
+	case int64:
+		return n, true
+	case string:
+		i, err := strconv.ParseInt(n, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
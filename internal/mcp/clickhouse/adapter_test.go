@@ -0,0 +1,163 @@
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEscapeSQLString(t *testing.T) {
+	assert.Equal(t, `it\'s`, escapeSQLString(`it's`))
+	// A trailing backslash must not escape the closing quote
+	assert.Equal(t, `users\\\' OR 1=1 --`, escapeSQLString(`users\' OR 1=1 --`))
+}
+
+func TestDescribeTable_InjectionAttempts(t *testing.T) {
+	// No client: a name that passes validation would panic instead of returning an error
+	a := &Adapter{}
+
+	for _, name := range []string{
+		`users"); DROP TABLE x;--`,
+		`users' OR '1'='1`,
+		`users\`,
+		"users\n",
+	} {
+		_, err := a.DescribeTable(context.Background(), name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestEstimatedRows(t *testing.T) {
+	rows := estimatedRows([]map[string]interface{}{
+		{"database": "default", "table": "events", "parts": float64(12), "rows": "2000000000", "marks": "244141"},
+		{"database": "default", "table": "users", "parts": float64(1), "rows": float64(5000), "marks": float64(1)},
+	})
+	assert.Equal(t, float64(2000005000), rows)
+}
+
+func TestParamValues(t *testing.T) {
+	a := &Adapter{}
+	assert.Equal(t, "{p1:String}", a.Placeholder(1, mcp.ParamString))
+	assert.Equal(t, "{p2:Date}", a.Placeholder(2, mcp.ParamDate))
+
+	values := paramValues([]mcp.QueryParam{
+		{Type: mcp.ParamString, Value: "a\tb\\' OR 1=1"},
+		{Type: mcp.ParamDate, Value: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{Type: mcp.ParamTimestamp, Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))},
+		{Type: mcp.ParamInteger, Value: int64(-5)},
+	})
+	assert.Equal(t, map[string]string{
+		"p1": `a\tb\\' OR 1=1`,
+		"p2": "2024-01-02",
+		"p3": "2024-01-02 02:04:05",
+		"p4": "-5",
+	}, values)
+}
+
+func TestQueryColumns(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "JSONCompact", r.URL.Query().Get("default_format"))
+		assert.Equal(t, "0", r.URL.Query().Get("output_format_json_quote_64bit_integers"))
+		assert.Equal(t, "eu", r.URL.Query().Get("param_p1"))
+		w.Write([]byte(`{"meta": [{"name": "zone", "type": "String"}, {"name": "amount", "type": "UInt64"}, {"name": "note", "type": "Nullable(String)"}],
+			"data": [["eu", 9007199254740993, null]], "rows": 1}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	client := NewHTTPClient(u.Hostname(), port, "default", "default", "")
+	columns, rows, err := client.QueryColumns(context.Background(),
+		"SELECT zone, amount, note FROM t WHERE zone = {p1:String}", map[string]string{"p1": "eu"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zone", "amount", "note"}, columns)
+	// Integers beyond float64 precision keep every digit
+	assert.Equal(t, [][]any{{"eu", json.Number("9007199254740993"), nil}}, rows)
+}
+
+func TestValidateQuery_SettingsClause(t *testing.T) {
+	a := &Adapter{}
+
+	err := a.ValidateQuery("SELECT count() FROM events SETTINGS max_memory_usage = 100000000000, readonly = 0")
+	var validationErr *mcp.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, RuleSettingsClause, validationErr.Rule)
+	assert.Equal(t, "SETTINGS max_memory_usage =", validationErr.Matched)
+
+	// A column named settings is not a clause
+	assert.NoError(t, a.ValidateQuery("SELECT settings, name FROM users WHERE settings != ''"))
+	assert.NoError(t, a.ValidateQuery("SELECT * FROM events FINAL"))
+}
+
+func TestExecuteQuery_SendsLimits(t *testing.T) {
+	var rawQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+		w.Write([]byte(`{"meta": [{"name": "n", "type": "UInt8"}], "data": [[1]], "rows": 1}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	a := &Adapter{client: NewHTTPClient(u.Hostname(), port, "default", "default", ""), maxMemoryUsage: 1 << 30}
+
+	_, err = a.ExecuteQuery(context.Background(), "SELECT 1 AS n FROM events", mcp.QueryOptions{MaxRows: 100, Timeout: 2500 * time.Millisecond})
+	require.NoError(t, err)
+
+	query, err := url.ParseQuery(rawQuery)
+	require.NoError(t, err)
+	assert.Equal(t, "3", query.Get("max_execution_time"))
+	assert.Equal(t, "1073741824", query.Get("max_memory_usage"))
+	assert.Equal(t, "101", query.Get("max_result_rows"))
+	assert.Equal(t, "break", query.Get("result_overflow_mode"))
+	// Applied last, so the server accepts the settings before it and refuses any after
+	assert.True(t, strings.HasSuffix(rawQuery, "&readonly=1"), rawQuery)
+}
+
+func TestExecuteQuery_ReadonlyProfile(t *testing.T) {
+	var queries []url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		if r.URL.Query().Has("max_result_rows") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("Code: 164. DB::Exception: Cannot modify 'max_result_rows' setting in readonly mode. (READONLY)"))
+			return
+		}
+		w.Write([]byte(`{"meta": [{"name": "n", "type": "UInt8"}], "data": [[1]], "rows": 1}`))
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	a := &Adapter{client: NewHTTPClient(u.Hostname(), port, "default", "reader", ""), maxMemoryUsage: DefaultMaxMemoryUsage}
+
+	for range 2 {
+		result, err := a.ExecuteQuery(context.Background(), "SELECT 1 AS n", mcp.QueryOptions{MaxRows: 100})
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.RowCount)
+	}
+
+	// The first query is retried without the settings, and later ones skip them
+	require.Len(t, queries, 3)
+	assert.True(t, queries[0].Has("max_result_rows"))
+	assert.False(t, queries[1].Has("max_result_rows"))
+	assert.False(t, queries[2].Has("readonly"))
+	assert.Equal(t, "JSONCompact", queries[2].Get("default_format"))
+}
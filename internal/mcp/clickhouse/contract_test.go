@@ -0,0 +1,88 @@
+//go:build contract
+
+package clickhouse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/mcp/mcptest"
+)
+
+func TestContract(t *testing.T) {
+	config := mcptest.ConfigFromURL(t, mcptest.DatabaseURL(t, "TEST_CLICKHOUSE_URL", mcptest.ClickHouse))
+
+	client := NewHTTPClient(config.Host, config.Port, config.Database, config.Username, config.Password)
+	t.Cleanup(func() { client.Close() })
+
+	mcptest.Run(t, mcptest.Target{
+		Adapter: NewAdapter(),
+		Config:  config,
+		Exec: func(ctx context.Context, stmt string) error {
+			_, err := client.QueryRaw(ctx, stmt)
+			return err
+		},
+		CreateTables: []string{
+			`CREATE TABLE contract_customers (id Int32, name String, email Nullable(String))
+				ENGINE = MergeTree ORDER BY id`,
+			`CREATE TABLE contract_orders (id Int32, customer_id Int32, total Float64, note Nullable(String))
+				ENGINE = MergeTree ORDER BY id`,
+		},
+	})
+}
+
+// The limits are sent as settings, so the server applies them whatever the query asks
+func TestContract_QuerySettings(t *testing.T) {
+	config := mcptest.ConfigFromURL(t, mcptest.DatabaseURL(t, "TEST_CLICKHOUSE_URL", mcptest.ClickHouse))
+	ctx := context.Background()
+
+	adapter := NewAdapter()
+	if err := adapter.Connect(ctx, config); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { adapter.Close() })
+
+	result, err := adapter.ExecuteQuery(ctx,
+		"SELECT getSetting('max_result_rows') AS max_rows, getSetting('readonly') AS readonly, getSetting('max_memory_usage') AS memory",
+		mcp.QueryOptions{MaxRows: 10, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	got := fmt.Sprint(result.Rows[0]...)
+	if want := fmt.Sprint(json.Number("11"), json.Number("1"), json.Number(strconv.Itoa(DefaultMaxMemoryUsage))); got != want {
+		t.Errorf("settings = %s, want %s", got, want)
+	}
+}
+
+// A query cannot raise the limits, even past the adapter's validation: readonly=1 is
+// sent last, so the server refuses any SETTINGS clause that changes them
+func TestContract_SettingsOverride(t *testing.T) {
+	config := mcptest.ConfigFromURL(t, mcptest.DatabaseURL(t, "TEST_CLICKHOUSE_URL", mcptest.ClickHouse))
+	ctx := context.Background()
+
+	adapter := NewAdapter().(*Adapter)
+	if err := adapter.Connect(ctx, config); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { adapter.Close() })
+
+	opts := mcp.QueryOptions{MaxRows: 10, Timeout: 5 * time.Second}
+	for _, sql := range []string{
+		"SELECT number FROM system.numbers LIMIT 100 SETTINGS max_result_rows = 1000",
+		"SELECT number FROM system.numbers LIMIT 100 SETTINGS readonly = 0",
+	} {
+		if _, err := adapter.ExecuteQuery(ctx, sql, opts); err == nil {
+			t.Errorf("%s: adapter ran it, want a validation error", sql)
+		}
+
+		_, _, err := adapter.client.QueryColumns(ctx, sql, nil, adapter.querySettings(opts, 10))
+		if err == nil || !isReadonlyError(err) {
+			t.Errorf("%s: server error = %v, want a readonly refusal", sql, err)
+		}
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 )
 
+// readonlySetting forbids queries from writing or changing settings
+const readonlySetting = "readonly"
+
 // HTTPClient wraps HTTP communication with ClickHouse
 type HTTPClient struct {
 	baseURL  string
@@ -42,12 +46,18 @@ func (c *HTTPClient) Ping(ctx context.Context) error {
 
 // Query executes a query and returns results as JSON
 func (c *HTTPClient) Query(ctx context.Context, query string) ([]map[string]interface{}, error) {
+	return c.QueryWithParams(ctx, query, nil)
+}
+
+// QueryWithParams executes a query with its {name:Type} placeholders bound to params
+// by the server, and returns results as JSON
+func (c *HTTPClient) QueryWithParams(ctx context.Context, query string, params map[string]string) ([]map[string]interface{}, error) {
 	// Add FORMAT JSONEachRow to get JSON output
 	if !strings.Contains(strings.ToUpper(query), "FORMAT") {
 		query = query + " FORMAT JSONEachRow"
 	}
 
-	body, err := c.execute(ctx, query)
+	body, err := c.execute(ctx, query, params, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -69,13 +79,47 @@ func (c *HTTPClient) Query(ctx context.Context, query string) ([]map[string]inte
 	return results, nil
 }
 
+// QueryColumns executes a query with its {name:Type} placeholders bound to params and
+// settings applied, and returns the columns in select order with the rows. 64-bit
+// integers come back as json.Number rather than quoted strings.
+func (c *HTTPClient) QueryColumns(ctx context.Context, query string, params, settings map[string]string) ([]string, [][]any, error) {
+	// default_format leaves queries mentioning FORMAT, e.g. formatDateTime, untouched
+	all := map[string]string{
+		"default_format": "JSONCompact",
+		"output_format_json_quote_64bit_integers": "0",
+	}
+	maps.Copy(all, settings)
+	body, err := c.execute(ctx, query, params, all)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var result struct {
+		Meta []struct {
+			Name string `json:"name"`
+		} `json:"meta"`
+		Data [][]any `json:"data"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	columns := make([]string, len(result.Meta))
+	for i, m := range result.Meta {
+		columns[i] = m.Name
+	}
+	return columns, result.Data, nil
+}
+
 // QueryRaw executes a query and returns raw response
 func (c *HTTPClient) QueryRaw(ctx context.Context, query string) ([]byte, error) {
-	return c.execute(ctx, query)
+	return c.execute(ctx, query, nil, nil)
 }
 
-// execute sends query to ClickHouse and returns raw response
-func (c *HTTPClient) execute(ctx context.Context, query string) ([]byte, error) {
+// execute sends query to ClickHouse with its parameters and settings and returns raw response
+func (c *HTTPClient) execute(ctx context.Context, query string, params, settings map[string]string) ([]byte, error) {
 	// Build URL with query parameters
 	u, err := url.Parse(c.baseURL)
 	if err != nil {
@@ -84,7 +128,19 @@ func (c *HTTPClient) execute(ctx context.Context, query string) ([]byte, error)
 
 	q := u.Query()
 	q.Set("database", c.database)
+	for name, value := range params {
+		q.Set("param_"+name, value)
+	}
+	for name, value := range settings {
+		if name != readonlySetting {
+			q.Set(name, value)
+		}
+	}
 	u.RawQuery = q.Encode()
+	// The server applies settings in order and refuses changes once readonly is set
+	if readonly, ok := settings[readonlySetting]; ok {
+		u.RawQuery += "&" + url.Values{readonlySetting: {readonly}}.Encode()
+	}
 
 	// Create request with query in body
 	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), bytes.NewBufferString(query))
@@ -0,0 +1,59 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxIdentifierLength bounds identifiers accepted from callers. Every supported
+// dialect limits names well below this.
+const MaxIdentifierLength = 255
+
+// Identifier quote characters per dialect
+const (
+	QuoteDouble   = '"' // PostgreSQL, SQLite, SQL Server (QUOTED_IDENTIFIER)
+	QuoteBacktick = '`' // MySQL
+)
+
+// ValidateIdentifier rejects names that cannot be quoted safely in any dialect
+func ValidateIdentifier(name string) error {
+	if name == "" {
+		return errors.New("identifier is empty")
+	}
+	if len(name) > MaxIdentifierLength {
+		return fmt.Errorf("identifier exceeds %d bytes", MaxIdentifierLength)
+	}
+	if !utf8.ValidString(name) {
+		return errors.New("identifier is not valid UTF-8")
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("identifier contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// ValidateStrictIdentifier additionally rejects quotes, backslashes and
+// semicolons, for dialects whose quoting relies on backslash escapes
+func ValidateStrictIdentifier(name string) error {
+	if err := ValidateIdentifier(name); err != nil {
+		return err
+	}
+	if i := strings.IndexAny(name, "'\"`\\;"); i >= 0 {
+		return fmt.Errorf("identifier contains invalid character %q", name[i])
+	}
+	return nil
+}
+
+// QuoteIdentifier wraps name in quote, doubling any embedded quote character
+func QuoteIdentifier(name string, quote rune) (string, error) {
+	if err := ValidateIdentifier(name); err != nil {
+		return "", err
+	}
+	q := string(quote)
+	return q + strings.ReplaceAll(name, q, q+q) + q, nil
+}
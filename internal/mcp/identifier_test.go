@@ -0,0 +1,56 @@
+package mcp_test
+
+import (
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		quote   rune
+		want    string
+		wantErr bool
+	}{
+		{"plain double", "users", mcp.QuoteDouble, `"users"`, false},
+		{"plain backtick", "users", mcp.QuoteBacktick, "`users`", false},
+		{"embedded double quote", `we"ird`, mcp.QuoteDouble, `"we""ird"`, false},
+		{"embedded backtick", "we`ird", mcp.QuoteBacktick, "`we``ird`", false},
+		{"injection attempt", `users"); DROP TABLE x;--`, mcp.QuoteDouble, `"users""); DROP TABLE x;--"`, false},
+		{"other quote untouched", `it's`, mcp.QuoteDouble, `"it's"`, false},
+		{"empty", "", mcp.QuoteDouble, "", true},
+		{"nul byte", "users\x00", mcp.QuoteDouble, "", true},
+		{"newline", "users\n--", mcp.QuoteDouble, "", true},
+		{"invalid utf8", "users\xff", mcp.QuoteDouble, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mcp.QuoteIdentifier(tt.input, tt.quote)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateStrictIdentifier(t *testing.T) {
+	assert.NoError(t, mcp.ValidateStrictIdentifier("events_2024"))
+
+	for _, name := range []string{
+		`users"); DROP TABLE x;--`,
+		`users' OR '1'='1`,
+		"users`",
+		`users\`,
+		"users;",
+		"users\t",
+	} {
+		assert.Error(t, mcp.ValidateStrictIdentifier(name), name)
+	}
+}
@@ -0,0 +1,87 @@
+package mcptest
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+// Container is a database image the contract runs against when no URL is configured
+type Container struct {
+	Image string
+	Port  string // the database port, such as 5432/tcp
+	Env   map[string]string
+	Wait  wait.Strategy
+	// URL returns the connection URL for the mapped host:port
+	URL func(hostPort string) string
+}
+
+// Containers of the databases with a contract test
+var (
+	Postgres = Container{
+		Image: "postgres:16-alpine",
+		Port:  "5432/tcp",
+		Env:   map[string]string{"POSTGRES_PASSWORD": "postgres", "POSTGRES_DB": "contract"},
+		// The server restarts once after initdb
+		Wait: wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+		URL: func(hostPort string) string {
+			return "postgres://postgres:postgres@" + hostPort + "/contract?sslmode=disable"
+		},
+	}
+	MySQL = Container{
+		Image: "mysql:8.4",
+		Port:  "3306/tcp",
+		Env:   map[string]string{"MYSQL_ROOT_PASSWORD": "root", "MYSQL_DATABASE": "contract"},
+		Wait:  wait.ForListeningPort("3306/tcp"),
+		URL: func(hostPort string) string {
+			return "mysql://root:root@" + hostPort + "/contract"
+		},
+	}
+	ClickHouse = Container{
+		Image: "clickhouse/clickhouse-server:24.8-alpine",
+		Port:  "8123/tcp",
+		Env:   map[string]string{"CLICKHOUSE_USER": "contract", "CLICKHOUSE_PASSWORD": "contract", "CLICKHOUSE_DB": "contract"},
+		Wait:  wait.ForHTTP("/ping").WithPort("8123/tcp"),
+		URL: func(hostPort string) string {
+			return "clickhouse://contract:contract@" + hostPort + "/contract"
+		},
+	}
+)
+
+// started holds the URLs of the containers started by this test binary
+var started sync.Map
+
+// DatabaseURL returns the connection URL in the environment variable key. When it is
+// unset, the database is started from c with testcontainers, once per test binary; the
+// testcontainers reaper removes it when the tests end. The test is skipped when Docker
+// is not available either.
+func DatabaseURL(t *testing.T, key string, c Container) string {
+	t.Helper()
+	if raw := os.Getenv(key); raw != "" {
+		return raw
+	}
+	if raw, ok := started.Load(key); ok {
+		return raw.(string)
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	ctr, err := testcontainers.Run(ctx, c.Image,
+		testcontainers.WithExposedPorts(c.Port),
+		testcontainers.WithEnv(c.Env),
+		testcontainers.WithWaitStrategyAndDeadline(3*time.Minute, c.Wait),
+	)
+	require.NoError(t, err, "starting %s", c.Image)
+	hostPort, err := ctr.Endpoint(ctx, "")
+	require.NoError(t, err, "getting the %s endpoint", c.Image)
+
+	raw := c.URL(hostPort)
+	started.Store(key, raw)
+	return raw
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -26,10 +28,21 @@ func (a *Adapter) DatabaseType() string {
 	return "mongodb"
 }
 
+// SQLDialect describes the JSON database commands the adapter runs, for LLM prompting
 func (a *Adapter) SQLDialect() string {
-	return "mongodb"
+	return Dialect
 }
 
+// Dialect describes the JSON database commands the adapter runs, which needs no connection
+const Dialect = `MongoDB database commands, written as one JSON object in Extended JSON:
+- The first key is the command and its value is the collection, e.g.
+  {"find": "orders", "filter": {"status": "paid"}, "projection": {"_id": 0, "total": 1}, "sort": {"created_at": -1}, "limit": 20}
+- Aggregations take a pipeline and a cursor, e.g.
+  {"aggregate": "orders", "pipeline": [{"$match": {"status": "paid"}}, {"$group": {"_id": "$customer_id", "total": {"$sum": "$total"}}}, {"$sort": {"total": -1}}, {"$limit": 10}], "cursor": {}}
+- Counts and distinct values: {"count": "orders", "query": {"status": "paid"}}, {"distinct": "orders", "key": "status"}
+- Filters use query operators such as $eq, $gt, $in, $regex and $exists; dates are {"$date": "2024-01-01T00:00:00Z"}
+- Only find, aggregate, count and distinct read data; $out and $merge stages are rejected`
+
 func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error {
 	a.config = config
 
@@ -47,11 +60,11 @@ func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) erro
 
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
-		return fmt.Errorf("failed to create client: %w", err)
+		return security.Redact(fmt.Errorf("failed to create client: %w", err), config.Password)
 	}
 
 	if err := client.Ping(ctx, nil); err != nil {
-		return fmt.Errorf("failed to ping: %w", err)
+		return security.Redact(fmt.Errorf("failed to ping: %w", err), config.Password)
 	}
 
 	a.client = client
@@ -164,7 +177,15 @@ func (a *Adapter) ValidateQuery(sql string) error {
 	return nil
 }
 
+// ExecuteQuery executes read-only SQL query
 func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, opts)
+	})
+}
+
+// executeQuery validates, limits and runs the query
+func (a *Adapter) executeQuery(ctx context.Context, sql string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
 	if err := a.ValidateQuery(sql); err != nil {
 		return nil, err
 	}
@@ -180,6 +201,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 	// This is a simplified execution that runs specific commands
 	// Ideally we'd map "sql" to true MongoDB commands.
 	// For now, let's assume raw runCommand for flexibility if the user knows what they are doing.
+	cmd, defaultApplied := limitCommand(cmd, opts)
 
 	res := a.db.RunCommand(ctx, cmd)
 	if err := res.Err(); err != nil {
@@ -212,8 +234,70 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 	}
 
 	return &mcp.QueryResult{
-		Columns:  columns,
-		Rows:     rows,
-		RowCount: len(rows),
+		Columns:             columns,
+		Rows:                rows,
+		RowCount:            len(rows),
+		DefaultLimitApplied: defaultApplied,
 	}, nil
 }
+
+// limitCommand limits the documents a find or aggregate command returns the way
+// QueryOptions.RowLimit limits SQL: a find without a limit, or a pipeline without a
+// $limit stage, gets the default limit, and larger limits are capped
+func limitCommand(cmd bson.D, opts mcp.QueryOptions) (bson.D, bool) {
+	switch cmd[0].Key {
+	case "find":
+		own, hasLimit := int64(0), false
+		for _, elem := range cmd {
+			if elem.Key == "limit" {
+				own, hasLimit = bsonInt(elem.Value)
+				hasLimit = hasLimit && own != 0
+			}
+		}
+		limit, defaultApplied := opts.RowLimit(hasLimit)
+		if limit <= 0 || (hasLimit && own <= int64(limit)) {
+			return cmd, false
+		}
+		limited := make(bson.D, 0, len(cmd)+1)
+		for _, elem := range cmd {
+			if elem.Key != "limit" {
+				limited = append(limited, elem)
+			}
+		}
+		return append(limited, bson.E{Key: "limit", Value: int64(limit)}), defaultApplied
+
+	case "aggregate":
+		for i, elem := range cmd {
+			pipeline, ok := elem.Value.(bson.A)
+			if elem.Key != "pipeline" || !ok {
+				continue
+			}
+			hasLimit := slices.ContainsFunc(pipeline, func(stage any) bool {
+				doc, ok := stage.(bson.D)
+				return ok && len(doc) > 0 && doc[0].Key == "$limit"
+			})
+			limit, defaultApplied := opts.RowLimit(hasLimit)
+			if limit <= 0 {
+				return cmd, false
+			}
+			// A $limit at the end caps the pipeline's own $limit without changing a smaller one
+			limited := slices.Clone(cmd)
+			limited[i].Value = append(slices.Clone(pipeline), bson.D{{Key: "$limit", Value: int64(limit)}})
+			return limited, defaultApplied
+		}
+	}
+	return cmd, false
+}
+
+// bsonInt returns a numeric BSON value as an integer
+func bsonInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+	return 0, false
+}
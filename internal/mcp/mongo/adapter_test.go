@@ -0,0 +1,103 @@
+package mongo
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// cannedAnswer is how models typically answer the MongoDB prompt
+const cannedAnswer = "Here are the paid orders, largest first:\n\n```json\n" +
+	`{"find": "orders", "filter": {"status": "paid"}, "projection": {"_id": 0, "total": 1}, "sort": {"total": -1}, "limit": 2}` +
+	"\n```\n\nThe limit keeps the result small."
+
+func TestValidateQuery(t *testing.T) {
+	a := &Adapter{}
+
+	assert.NoError(t, a.ValidateQuery(llm.ExtractMongoCommand(cannedAnswer)))
+	assert.NoError(t, a.ValidateQuery(`{"aggregate": "orders", "pipeline": [{"$match": {"status": "paid"}}, {"$limit": 5}], "cursor": {}}`))
+
+	for cmd, want := range map[string]string{
+		"SELECT * FROM orders":                "expected JSON object",
+		`{"delete": "orders", "deletes": []}`: "command 'delete' is not allowed",
+		`{"aggregate": "orders", "pipeline": [{"$out": "copy"}], "cursor": {}}`: "aggregation stage '$out' is not allowed",
+	} {
+		assert.ErrorContains(t, a.ValidateQuery(cmd), want, cmd)
+	}
+}
+
+func TestLimitCommand(t *testing.T) {
+	opts := mcp.QueryOptions{MaxRows: 1000, DefaultLimit: 100}
+	limit := func(cmd string) (string, bool) {
+		var doc bson.D
+		require.NoError(t, bson.UnmarshalExtJSON([]byte(cmd), false, &doc))
+		limited, applied := limitCommand(doc, opts)
+		out, err := bson.MarshalExtJSON(limited, false, false)
+		require.NoError(t, err)
+		return string(out), applied
+	}
+
+	got, applied := limit(`{"find": "orders", "filter": {"status": "paid"}}`)
+	assert.Equal(t, `{"find":"orders","filter":{"status":"paid"},"limit":100}`, got)
+	assert.True(t, applied)
+
+	got, applied = limit(`{"find": "orders", "limit": 5}`)
+	assert.Equal(t, `{"find":"orders","limit":5}`, got, "own limit kept")
+	assert.False(t, applied)
+
+	got, _ = limit(`{"find": "orders", "limit": 5000, "sort": {"total": -1}}`)
+	assert.Equal(t, `{"find":"orders","sort":{"total":-1},"limit":1000}`, got, "capped at the row limit")
+
+	got, applied = limit(`{"aggregate": "orders", "pipeline": [{"$match": {"status": "paid"}}], "cursor": {}}`)
+	assert.Equal(t, `{"aggregate":"orders","pipeline":[{"$match":{"status":"paid"}},{"$limit":100}],"cursor":{}}`, got)
+	assert.True(t, applied)
+
+	got, applied = limit(`{"aggregate": "orders", "pipeline": [{"$limit": 5}], "cursor": {}}`)
+	assert.Equal(t, `{"aggregate":"orders","pipeline":[{"$limit":5},{"$limit":1000}],"cursor":{}}`, got)
+	assert.False(t, applied)
+
+	got, applied = limit(`{"count": "orders"}`)
+	assert.Equal(t, `{"count":"orders"}`, got)
+	assert.False(t, applied)
+}
+
+// TestExecuteQuery_CannedAnswer runs a command extracted from a model's answer against
+// TEST_MONGODB_URL, skipping the test when unset
+func TestExecuteQuery_CannedAnswer(t *testing.T) {
+	uri := os.Getenv("TEST_MONGODB_URL")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URL not set")
+	}
+	ctx := context.Background()
+
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	db := client.Database("text_to_sql_test")
+	t.Cleanup(func() { db.Drop(context.Background()) })
+
+	_, err = db.Collection("orders").InsertMany(ctx, []any{
+		bson.D{{Key: "status", Value: "paid"}, {Key: "total", Value: 30}},
+		bson.D{{Key: "status", Value: "paid"}, {Key: "total", Value: 50}},
+		bson.D{{Key: "status", Value: "paid"}, {Key: "total", Value: 10}},
+		bson.D{{Key: "status", Value: "open"}, {Key: "total", Value: 99}},
+	})
+	require.NoError(t, err)
+
+	a := &Adapter{client: client, db: db}
+	cmd := llm.ExtractMongoCommand(cannedAnswer)
+	require.NoError(t, a.ValidateQuery(cmd))
+
+	result, err := a.ExecuteQuery(ctx, cmd, mcp.QueryOptions{MaxRows: 100})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"json_document"}, result.Columns)
+	assert.Equal(t, [][]any{{`{"total":50}`}, {`{"total":30}`}}, result.Rows)
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
 	_ "github.com/go-sql-driver/mysql"
 )
 
@@ -14,6 +18,9 @@ import (
 type Adapter struct {
 	db       *sql.DB
 	database string
+	// replica is the read replica, nil without one
+	replica *sql.DB
+	route   *mcp.ReplicaRoute
 }
 
 // NewAdapter creates a new MySQL adapter
@@ -28,7 +35,11 @@ func (a *Adapter) DatabaseType() string {
 
 // SQLDialect returns SQL dialect hints for LLM prompting
 func (a *Adapter) SQLDialect() string {
-	return `MySQL SQL dialect:
+	return Dialect
+}
+
+// Dialect holds the SQL dialect hints given to the LLM, which need no connection
+const Dialect = `MySQL SQL dialect:
 - Use backticks for identifiers: ` + "`column_name`" + `
 - String concatenation: CONCAT(a, b)
 - Case-insensitive matching: LIKE (MySQL is case-insensitive by default)
@@ -44,10 +55,37 @@ func (a *Adapter) SQLDialect() string {
 - Avoid using reserved words as identifiers
 - Use INDEX hints if needed: FORCE INDEX, USE INDEX
 - EXPLAIN for query analysis`
-}
 
-// Connect establishes connection to MySQL
+// Connect establishes connection to MySQL. The read replica, if any, is not reached
+// until a statement needs it, so a replica that is down does not keep the primary
+// from being used.
 func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error {
+	db, err := openDB(config)
+	if err != nil {
+		return err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return security.Redact(fmt.Errorf("failed to ping: %w", err), config.Password)
+	}
+
+	if replicaConfig, ok := config.Replica(); ok {
+		replica, err := openDB(replicaConfig)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("replica: %w", err)
+		}
+		a.replica = replica
+		a.route = mcp.NewReplicaRoute(a.DatabaseType(), config)
+	}
+
+	a.db = db
+	a.database = config.Database
+	return nil
+}
+
+// openDB opens the database of config without connecting
+func openDB(config mcp.ConnectionConfig) (*sql.DB, error) {
 	// Build DSN
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
 		config.Username,
@@ -64,30 +102,49 @@ func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) erro
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		return nil, security.Redact(fmt.Errorf("failed to open connection: %w", err), config.Password)
 	}
 
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(1)
-
-	if err := db.PingContext(ctx); err != nil {
-		db.Close()
-		return fmt.Errorf("failed to ping: %w", err)
-	}
-
-	a.db = db
-	a.database = config.Database
-	return nil
+	config.Pool.ConfigureDB(db)
+	return db, nil
 }
 
 // Close closes the connection
 func (a *Adapter) Close() error {
+	var err error
 	if a.db != nil {
-		err := a.db.Close()
+		err = a.db.Close()
 		a.db = nil
-		return err
 	}
-	return nil
+	if a.replica != nil {
+		a.replica.Close()
+		a.replica = nil
+	}
+	return err
+}
+
+// queryDB returns the database queries run on
+func (a *Adapter) queryDB(ctx context.Context) *sql.DB {
+	if a.route.Use(ctx, false, a.replica.PingContext) {
+		return a.replica
+	}
+	return a.db
+}
+
+// schemaDB returns the database schema introspection runs on
+func (a *Adapter) schemaDB(ctx context.Context) *sql.DB {
+	if a.route.Use(ctx, true, a.replica.PingContext) {
+		return a.replica
+	}
+	return a.db
+}
+
+// PoolStats reports the connection pool
+func (a *Adapter) PoolStats() (domain.PoolStats, bool) {
+	if a.db == nil {
+		return domain.PoolStats{}, false
+	}
+	return mcp.DBPoolStats(a.db), true
 }
 
 // HealthCheck verifies connection is alive
@@ -100,7 +157,7 @@ func (a *Adapter) HealthCheck(ctx context.Context) error {
 
 // ListTables returns list of table names
 func (a *Adapter) ListTables(ctx context.Context) ([]string, error) {
-	rows, err := a.db.QueryContext(ctx, `
+	rows, err := a.schemaDB(ctx).QueryContext(ctx, `
 		SELECT table_name 
 		FROM information_schema.tables 
 		WHERE table_schema = ? 
@@ -126,7 +183,12 @@ func (a *Adapter) ListTables(ctx context.Context) ([]string, error) {
 
 // DescribeTable returns detailed table schema
 func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.TableInfo, error) {
-	rows, err := a.db.QueryContext(ctx, `
+	if err := mcp.ValidateIdentifier(tableName); err != nil {
+		return nil, fmt.Errorf("invalid table name: %w", err)
+	}
+
+	db := a.schemaDB(ctx)
+	rows, err := db.QueryContext(ctx, `
 		SELECT 
 			column_name,
 			column_type,
@@ -157,7 +219,7 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 
 	// Get row count estimate
 	var rowCount int64
-	err = a.db.QueryRowContext(ctx, `
+	err = db.QueryRowContext(ctx, `
 		SELECT table_rows 
 		FROM information_schema.tables 
 		WHERE table_schema = ? AND table_name = ?
@@ -168,17 +230,77 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 		rowCountPtr = &rowCount
 	}
 
+	// Indexes are only a hint for prompting, so failing to read them is not an error
+	indexes, _ := a.indexes(ctx, tableName)
+
 	return &mcp.TableInfo{
 		Name:       tableName,
 		SchemaName: a.database,
 		Columns:    columns,
 		RowCount:   rowCountPtr,
+		Indexes:    indexes[tableName],
 	}, nil
 }
 
+// indexes returns the secondary indexes of a table, or of all tables when tableName
+// is empty, by table. Functional indexes are left out.
+func (a *Adapter) indexes(ctx context.Context, tableName string) (map[string][]mcp.IndexInfo, error) {
+	rows, err := a.schemaDB(ctx).QueryContext(ctx, `
+		SELECT table_name, index_name, non_unique = 0, column_name
+		FROM information_schema.statistics
+		WHERE table_schema = ? AND (? = '' OR table_name = ?) AND index_name <> 'PRIMARY'
+		ORDER BY table_name, index_name, seq_in_index
+	`, a.database, tableName, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer rows.Close()
+
+	indexes := make(map[string][]mcp.IndexInfo)
+	functional := make(map[[2]string]bool)
+	for rows.Next() {
+		var table, name string
+		var unique bool
+		var column sql.NullString
+		if err := rows.Scan(&table, &name, &unique, &column); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		if !column.Valid {
+			functional[[2]string{table, name}] = true
+			continue
+		}
+		list := indexes[table]
+		if n := len(list); n > 0 && list[n-1].Name == name {
+			list[n-1].Columns = append(list[n-1].Columns, column.String)
+			continue
+		}
+		indexes[table] = append(list, mcp.IndexInfo{Name: name, Columns: []string{column.String}, Unique: unique})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for table, list := range indexes {
+		indexes[table] = slices.DeleteFunc(list, func(idx mcp.IndexInfo) bool {
+			return functional[[2]string{table, idx.Name}]
+		})
+	}
+	return indexes, nil
+}
+
 // GetSchemaDDL returns full schema as DDL for LLM context
 func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
-	rows, err := a.db.QueryContext(ctx, `
+	return a.OrderedSchemaDDL(ctx, mcp.SchemaOptions{})
+}
+
+// OrderedSchemaDDL returns the full schema as DDL with tables ordered following opts
+func (a *Adapter) OrderedSchemaDDL(ctx context.Context, opts mcp.SchemaOptions) (string, error) {
+	// Indexes and row counts are only hints, so the DDL goes without them when they
+	// cannot be read
+	indexes, _ := a.indexes(ctx, "")
+	rowCounts, _ := a.rowCounts(ctx)
+
+	rows, err := a.schemaDB(ctx).QueryContext(ctx, `
 		SELECT 
 			table_name,
 			column_name,
@@ -194,8 +316,8 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 	}
 	defer rows.Close()
 
-	var ddl strings.Builder
-	currentTable := ""
+	var tables []string
+	columns := make(map[string][]string)
 
 	for rows.Next() {
 		var tableName, columnName, dataType, isNullable, columnKey string
@@ -204,14 +326,8 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 			return "", fmt.Errorf("failed to scan: %w", err)
 		}
 
-		if tableName != currentTable {
-			if currentTable != "" {
-				ddl.WriteString("\n);\n\n")
-			}
-			ddl.WriteString(fmt.Sprintf("CREATE TABLE `%s` (\n", tableName))
-			currentTable = tableName
-		} else {
-			ddl.WriteString(",\n")
+		if _, ok := columns[tableName]; !ok {
+			tables = append(tables, tableName)
 		}
 
 		nullable := ""
@@ -224,29 +340,90 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 			pk = " PRIMARY KEY"
 		}
 
-		ddl.WriteString(fmt.Sprintf("  `%s` %s%s%s", columnName, dataType, nullable, pk))
+		columns[tableName] = append(columns[tableName], fmt.Sprintf("  `%s` %s%s%s", columnName, dataType, nullable, pk))
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to get schema: %w", err)
 	}
 
-	if currentTable != "" {
-		ddl.WriteString("\n);")
+	var ddl strings.Builder
+	for i, tableName := range mcp.OrderTables(tables, rowCounts, opts) {
+		if i > 0 {
+			ddl.WriteString("\n\n")
+		}
+		ddl.WriteString(fmt.Sprintf("CREATE TABLE `%s` (", tableName))
+		if n, ok := rowCounts[tableName]; ok {
+			ddl.WriteString(mcp.RowCountComment(n))
+		}
+		ddl.WriteString("\n" + strings.Join(columns[tableName], ",\n") + "\n);")
+		ddl.WriteString(mcp.IndexComments(indexes[tableName]))
 	}
 
 	return ddl.String(), nil
 }
 
+// rowCounts returns the estimated row counts of the tables, as kept by the storage engine
+func (a *Adapter) rowCounts(ctx context.Context) (map[string]int64, error) {
+	rows, err := a.schemaDB(ctx).QueryContext(ctx, `
+		SELECT table_name, table_rows
+		FROM information_schema.tables
+		WHERE table_schema = ? AND table_type = 'BASE TABLE' AND table_rows IS NOT NULL
+	`, a.database)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get row counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var count int64
+		if err := rows.Scan(&table, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan row count: %w", err)
+		}
+		counts[table] = count
+	}
+	return counts, rows.Err()
+}
+
 // ValidateQuery validates SQL is safe to execute
 func (a *Adapter) ValidateQuery(sql string) error {
-	return mcp.ValidateSQL(sql, mcp.MysqlBlockedPatterns)
+	return mcp.ValidateSQL(sql, mcp.DialectMySQL, mcp.MysqlBlockedPatterns)
+}
+
+// PageQuery returns the rows of page with LIMIT and OFFSET, or a keyset predicate
+func (a *Adapter) PageQuery(sql string, page mcp.Page) (string, error) {
+	return mcp.LimitOffsetPage(sql, page, mcp.QuoteBacktick)
 }
 
 // ExecuteQuery executes read-only SQL query
 func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, nil, opts)
+	})
+}
+
+// Placeholder returns the placeholder of the n-th query parameter
+func (a *Adapter) Placeholder(n int, _ mcp.ParamType) string {
+	return "?"
+}
+
+// ExecuteQueryWithParams executes read-only SQL with ? placeholders bound to params
+func (a *Adapter) ExecuteQueryWithParams(ctx context.Context, sql string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, mcp.ParamValues(params), opts)
+	})
+}
+
+// executeQuery validates, limits and runs the query with args bound to its placeholders
+func (a *Adapter) executeQuery(ctx context.Context, sql string, args []any, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
 	if err := a.ValidateQuery(sql); err != nil {
 		return nil, err
 	}
 
-	// Enforce LIMIT
-	sql = mcp.EnforceLimit(sql, opts.MaxRows, "LIMIT")
+	// Enforce LIMIT, one row past the limit so truncation can be detected
+	limit, defaultApplied := opts.RowLimit(mcp.HasLimit(sql))
+	sql = mcp.EnforceLimit(sql, limit+1, "LIMIT")
 
 	// Create context with timeout
 	if opts.Timeout > 0 {
@@ -255,7 +432,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 		defer cancel()
 	}
 
-	rows, err := a.db.QueryContext(ctx, sql)
+	rows, err := a.queryDB(ctx).QueryContext(ctx, sql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -266,6 +443,10 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 	if err != nil {
 		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column types: %w", err)
+	}
 
 	// Collect rows
 	var resultRows [][]any
@@ -280,16 +461,16 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		// Convert []byte to string for better JSON serialization
+		// The text protocol returns every value as []byte
 		for i, v := range values {
 			if b, ok := v.([]byte); ok {
-				values[i] = string(b)
+				values[i] = convertValue(b, columnTypes[i].DatabaseTypeName())
 			}
 		}
 
 		resultRows = append(resultRows, values)
 
-		if len(resultRows) > opts.MaxRows {
+		if len(resultRows) > limit {
 			break
 		}
 	}
@@ -298,15 +479,37 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	truncated := len(resultRows) > opts.MaxRows
+	truncated := len(resultRows) > limit
 	if truncated {
-		resultRows = resultRows[:opts.MaxRows]
+		resultRows = resultRows[:limit]
 	}
 
 	return &mcp.QueryResult{
-		Columns:   columns,
-		Rows:      resultRows,
-		RowCount:  len(resultRows),
-		Truncated: truncated,
+		Columns:             columns,
+		Rows:                resultRows,
+		RowCount:            len(resultRows),
+		Truncated:           truncated,
+		DefaultLimitApplied: defaultApplied,
 	}, nil
 }
+
+// convertValue turns a raw text protocol value into a number for integer and
+// floating point columns and into a string otherwise. DECIMAL stays a string to
+// keep its precision.
+func convertValue(b []byte, dbType string) any {
+	switch strings.TrimPrefix(dbType, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if strings.HasPrefix(dbType, "UNSIGNED ") {
+			if n, err := strconv.ParseUint(string(b), 10, 64); err == nil {
+				return n
+			}
+		} else if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return n
+		}
+	case "FLOAT", "DOUBLE":
+		if f, err := strconv.ParseFloat(string(b), 64); err == nil {
+			return f
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,29 @@
+package mysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		raw    string
+		dbType string
+		want   any
+	}{
+		{raw: "42", dbType: "INT", want: int64(42)},
+		{raw: "-7", dbType: "BIGINT", want: int64(-7)},
+		{raw: "18446744073709551615", dbType: "UNSIGNED BIGINT", want: uint64(18446744073709551615)},
+		{raw: "2.5", dbType: "DOUBLE", want: 2.5},
+		{raw: "12.30", dbType: "DECIMAL", want: "12.30"},
+		{raw: "hello", dbType: "VARCHAR", want: "hello"},
+		{raw: "not a number", dbType: "INT", want: "not a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dbType+"/"+tt.raw, func(t *testing.T) {
+			assert.Equal(t, tt.want, convertValue([]byte(tt.raw), tt.dbType))
+		})
+	}
+}
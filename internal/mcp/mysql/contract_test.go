@@ -0,0 +1,36 @@
+//go:build contract
+
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp/mcptest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContract(t *testing.T) {
+	config := mcptest.ConfigFromURL(t, mcptest.DatabaseURL(t, "TEST_MYSQL_URL", mcptest.MySQL))
+
+	db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+		config.Username, config.Password, config.Host, config.Port, config.Database))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mcptest.Run(t, mcptest.Target{
+		Adapter: NewAdapter(),
+		Config:  config,
+		Exec: func(ctx context.Context, stmt string) error {
+			_, err := db.ExecContext(ctx, stmt)
+			return err
+		},
+		CreateTables: []string{
+			`CREATE TABLE contract_customers (id INT PRIMARY KEY, name VARCHAR(100) NOT NULL, email VARCHAR(255))`,
+			`CREATE TABLE contract_orders (id INT PRIMARY KEY, customer_id INT NOT NULL,
+				total DOUBLE NOT NULL, note VARCHAR(255))`,
+		},
+	})
+}
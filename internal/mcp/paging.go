@@ -0,0 +1,76 @@
+package mcp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Page selects a window of the rows of a query
+type Page struct {
+	Offset int // rows to skip when paging by offset
+	Limit  int
+
+	// KeyColumn, when set, pages by keyset instead of offset: the page holds the rows
+	// whose KeyColumn comes after After in the order of the query
+	KeyColumn  string
+	After      int64
+	Descending bool
+}
+
+// Pager is implemented by adapters that can fetch the rows of a query past its first page
+type Pager interface {
+	// PageQuery rewrites sql to return the rows of page
+	PageQuery(sql string, page Page) (string, error)
+}
+
+var (
+	limitClause = regexp.MustCompile(`(?i)\bLIMIT\b`)
+
+	// keysetOrder matches a query ending in ORDER BY one column, optionally followed by LIMIT
+	keysetOrder = regexp.MustCompile(`(?is)\bORDER\s+BY\s+(?:[A-Za-z_][A-Za-z0-9_]*\.)?([A-Za-z_][A-Za-z0-9_]*)(?:\s+(ASC|DESC))?(?:\s+LIMIT\s+\d+)?\s*;?\s*$`)
+	// keysetFrom matches the table of a query reading a single table, with an optional alias
+	keysetFrom = regexp.MustCompile(`(?is)^\s*SELECT\s.+?\sFROM\s+([A-Za-z_][A-Za-z0-9_]*)(?:\s+(?:AS\s+)?[A-Za-z_][A-Za-z0-9_]*)?\s+(?:WHERE|ORDER)\b`)
+	// keysetBlockers are clauses after which a table's key no longer identifies a row
+	keysetBlockers = regexp.MustCompile(`(?i)\b(JOIN|GROUP\s+BY|DISTINCT|UNION|INTERSECT|EXCEPT)\b`)
+)
+
+// LimitOffsetPage rewrites sql for databases that support LIMIT and OFFSET, quoting
+// the keyset column with quote
+func LimitOffsetPage(sql string, page Page, quote rune) (string, error) {
+	sql = strings.TrimSuffix(strings.TrimSpace(sql), ";")
+
+	if page.KeyColumn != "" {
+		column, err := QuoteIdentifier(page.KeyColumn, quote)
+		if err != nil {
+			return "", err
+		}
+		op, direction := ">", "ASC"
+		if page.Descending {
+			op, direction = "<", "DESC"
+		}
+		return fmt.Sprintf("SELECT * FROM (%s) AS page_rows WHERE %s %s %d ORDER BY %s %s LIMIT %d",
+			sql, column, op, page.After, column, direction, page.Limit), nil
+	}
+
+	// Appending keeps the query's own ORDER BY in charge, which some databases drop
+	// from subqueries; a query with its own LIMIT has to be wrapped instead
+	if limitClause.MatchString(sql) {
+		return fmt.Sprintf("SELECT * FROM (%s) AS page_rows LIMIT %d OFFSET %d", sql, page.Limit, page.Offset), nil
+	}
+	return fmt.Sprintf("%s LIMIT %d OFFSET %d", sql, page.Limit, page.Offset), nil
+}
+
+// KeysetCandidate reports the table and column a query reading a single table is
+// ordered by, which can page by keyset if the column is the table's primary key
+func KeysetCandidate(sql string) (table, column string, descending, ok bool) {
+	order := keysetOrder.FindStringSubmatch(sql)
+	if order == nil {
+		return "", "", false, false
+	}
+	from := keysetFrom.FindStringSubmatch(sql)
+	if from == nil || keysetBlockers.MatchString(sql) || strings.Count(strings.ToUpper(sql), "SELECT") > 1 {
+		return "", "", false, false
+	}
+	return from[1], order[1], strings.EqualFold(order[2], "DESC"), true
+}
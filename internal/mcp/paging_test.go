@@ -0,0 +1,87 @@
+package mcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitOffsetPage(t *testing.T) {
+	tests := []struct {
+		name  string
+		sql   string
+		page  Page
+		quote rune
+		want  string
+	}{
+		{
+			name: "offset is appended",
+			sql:  "SELECT name FROM users ORDER BY name;",
+			page: Page{Offset: 100, Limit: 101},
+			want: "SELECT name FROM users ORDER BY name LIMIT 101 OFFSET 100",
+		},
+		{
+			name: "own limit is wrapped",
+			sql:  "SELECT name FROM users ORDER BY name LIMIT 500",
+			page: Page{Offset: 100, Limit: 101},
+			want: "SELECT * FROM (SELECT name FROM users ORDER BY name LIMIT 500) AS page_rows LIMIT 101 OFFSET 100",
+		},
+		{
+			name:  "keyset",
+			sql:   "SELECT id, name FROM users ORDER BY id",
+			page:  Page{Limit: 51, KeyColumn: "id", After: 420},
+			quote: QuoteBacktick,
+			want:  "SELECT * FROM (SELECT id, name FROM users ORDER BY id) AS page_rows WHERE `id` > 420 ORDER BY `id` ASC LIMIT 51",
+		},
+		{
+			name:  "descending keyset",
+			sql:   "SELECT id FROM users ORDER BY id DESC",
+			page:  Page{Limit: 51, KeyColumn: "id", After: 420, Descending: true},
+			quote: QuoteDouble,
+			want:  `SELECT * FROM (SELECT id FROM users ORDER BY id DESC) AS page_rows WHERE "id" < 420 ORDER BY "id" DESC LIMIT 51`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, err := LimitOffsetPage(tt.sql, tt.page, tt.quote)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, sql)
+		})
+	}
+
+	_, err := LimitOffsetPage("SELECT 1", Page{Limit: 1, KeyColumn: "id\x00"}, QuoteDouble)
+	assert.Error(t, err)
+}
+
+func TestKeysetCandidate(t *testing.T) {
+	tests := []struct {
+		sql        string
+		table      string
+		column     string
+		descending bool
+		ok         bool
+	}{
+		{sql: "SELECT * FROM users ORDER BY id", table: "users", column: "id", ok: true},
+		{sql: "SELECT u.id, u.name FROM users u WHERE u.active ORDER BY u.id DESC LIMIT 500;", table: "users", column: "id", descending: true, ok: true},
+		{sql: "SELECT id FROM users AS u ORDER BY id asc", table: "users", column: "id", ok: true},
+		{sql: "SELECT * FROM users"},
+		{sql: "SELECT * FROM users ORDER BY created_at, id"},
+		{sql: "SELECT u.id FROM users u JOIN orders o ON o.user_id = u.id ORDER BY u.id"},
+		{sql: "SELECT id FROM users, orders WHERE users.id = orders.user_id ORDER BY id"},
+		{sql: "SELECT country, COUNT(*) FROM users GROUP BY country ORDER BY country"},
+		{sql: "SELECT DISTINCT id FROM users ORDER BY id"},
+		{sql: "SELECT id FROM users WHERE id IN (SELECT user_id FROM orders) ORDER BY id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sql, func(t *testing.T) {
+			table, column, descending, ok := KeysetCandidate(tt.sql)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.table, table)
+			assert.Equal(t, tt.column, column)
+			assert.Equal(t, tt.descending, descending)
+		})
+	}
+}
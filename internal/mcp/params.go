@@ -0,0 +1,137 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ParamType is the type a query parameter is bound as
+type ParamType string
+
+const (
+	ParamString    ParamType = "string"
+	ParamInteger   ParamType = "integer"
+	ParamNumber    ParamType = "number"
+	ParamBoolean   ParamType = "boolean"
+	ParamDate      ParamType = "date"      // YYYY-MM-DD
+	ParamTimestamp ParamType = "timestamp" // RFC 3339
+)
+
+// ParamTypes lists the supported parameter types
+var ParamTypes = []ParamType{ParamString, ParamInteger, ParamNumber, ParamBoolean, ParamDate, ParamTimestamp}
+
+// IsParamType reports whether typ is a supported parameter type
+func IsParamType(typ string) bool {
+	return slices.Contains(ParamTypes, ParamType(typ))
+}
+
+// QueryParam is a value bound to a query placeholder. Value is a string, int64, float64,
+// bool or time.Time, following Type.
+type QueryParam struct {
+	Type  ParamType
+	Value any
+}
+
+// ParamExecutor is implemented by adapters that bind query parameters in the driver
+type ParamExecutor interface {
+	// Placeholder returns the placeholder of the n-th parameter, counted from 1
+	Placeholder(n int, typ ParamType) string
+
+	// ExecuteQueryWithParams executes read-only SQL with its placeholders bound to params
+	ExecuteQueryWithParams(ctx context.Context, sql string, params []QueryParam, opts QueryOptions) (*QueryResult, error)
+}
+
+// ParseParam converts a decoded JSON value to a parameter of type typ. Strings are
+// accepted for every type, so values can also come from query strings.
+func ParseParam(typ ParamType, value any) (QueryParam, error) {
+	param := QueryParam{Type: typ}
+	if n, ok := value.(json.Number); ok {
+		value = n.String()
+	}
+
+	switch typ {
+	case ParamString:
+		s, ok := value.(string)
+		if !ok {
+			return param, fmt.Errorf("expected a string, got %v", value)
+		}
+		param.Value = s
+	case ParamInteger:
+		switch v := value.(type) {
+		case float64:
+			if v != math.Trunc(v) || math.Abs(v) > 1<<53 {
+				return param, fmt.Errorf("expected an integer, got %v", v)
+			}
+			param.Value = int64(v)
+		case int64:
+			param.Value = v
+		case string:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return param, fmt.Errorf("expected an integer, got %q", v)
+			}
+			param.Value = n
+		default:
+			return param, fmt.Errorf("expected an integer, got %v", value)
+		}
+	case ParamNumber:
+		switch v := value.(type) {
+		case float64:
+			param.Value = v
+		case int64:
+			param.Value = float64(v)
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return param, fmt.Errorf("expected a number, got %q", v)
+			}
+			param.Value = f
+		default:
+			return param, fmt.Errorf("expected a number, got %v", value)
+		}
+	case ParamBoolean:
+		switch v := value.(type) {
+		case bool:
+			param.Value = v
+		case string:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return param, fmt.Errorf("expected a boolean, got %q", v)
+			}
+			param.Value = b
+		default:
+			return param, fmt.Errorf("expected a boolean, got %v", value)
+		}
+	case ParamDate, ParamTimestamp:
+		layout := time.DateOnly
+		if typ == ParamTimestamp {
+			layout = time.RFC3339
+		}
+		s, ok := value.(string)
+		if !ok {
+			return param, fmt.Errorf("expected a %s, got %v", typ, value)
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return param, fmt.Errorf("expected a %s like %s, got %q", typ, layout, s)
+		}
+		param.Value = t
+	default:
+		return param, fmt.Errorf("unknown parameter type %q", typ)
+	}
+	return param, nil
+}
+
+// ParamValues returns the values of params in order, as passed to database/sql drivers
+func ParamValues(params []QueryParam) []any {
+	values := make([]any, len(params))
+	for i, p := range params {
+		values[i] = p.Value
+	}
+	return values
+}
@@ -0,0 +1,45 @@
+package mcp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseParam(t *testing.T) {
+	tests := []struct {
+		typ     ParamType
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{typ: ParamString, value: "it's", want: "it's"},
+		{typ: ParamString, value: float64(1), wantErr: true},
+		{typ: ParamInteger, value: float64(42), want: int64(42)},
+		{typ: ParamInteger, value: json.Number("-7"), want: int64(-7)},
+		{typ: ParamInteger, value: int64(9007199254740993), want: int64(9007199254740993)},
+		{typ: ParamInteger, value: float64(1.5), wantErr: true},
+		{typ: ParamInteger, value: "1 OR 1=1", wantErr: true},
+		{typ: ParamNumber, value: "2.5", want: 2.5},
+		{typ: ParamBoolean, value: "true", want: true},
+		{typ: ParamBoolean, value: "yes", wantErr: true},
+		{typ: ParamDate, value: "2024-02-29", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{typ: ParamDate, value: "2024-02-30", wantErr: true},
+		{typ: ParamTimestamp, value: "2024-01-01T10:00:00Z", want: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		{typ: ParamType("uuid"), value: "x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		param, err := ParseParam(tt.typ, tt.value)
+		if tt.wantErr {
+			assert.Error(t, err, "%s %v", tt.typ, tt.value)
+			continue
+		}
+		if assert.NoError(t, err, "%s %v", tt.typ, tt.value) {
+			assert.Equal(t, tt.typ, param.Type)
+			assert.Equal(t, tt.want, param.Value)
+		}
+	}
+}
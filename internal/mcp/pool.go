@@ -0,0 +1,92 @@
+package mcp
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+)
+
+// PoolOptions sizes the connection pool an adapter keeps to its database. Zero fields
+// take the values of DefaultPoolOptions, and a nil MinConns its minimum, so a pool
+// can keep no idle connections with a MinConns of 0.
+type PoolOptions struct {
+	MaxConns          int32
+	MinConns          *int32
+	MaxConnLifetime   time.Duration // connections are replaced after this long, 0 keeps them
+	MaxConnIdleTime   time.Duration // idle connections are closed after this long
+	HealthCheckPeriod time.Duration // how often idle connections are checked, where supported
+}
+
+// DefaultPoolOptions are used for the pool options a connection config leaves unset
+var DefaultPoolOptions = PoolOptions{
+	MaxConns:          5,
+	MinConns:          PoolSize(1),
+	MaxConnLifetime:   30 * time.Minute,
+	MaxConnIdleTime:   5 * time.Minute,
+	HealthCheckPeriod: time.Minute,
+}
+
+// PoolSize returns a pointer to n, for PoolOptions.MinConns
+func PoolSize(n int32) *int32 {
+	return &n
+}
+
+// WithDefaults fills the unset fields of o from DefaultPoolOptions
+func (o PoolOptions) WithDefaults() PoolOptions {
+	if o.MaxConns <= 0 {
+		o.MaxConns = DefaultPoolOptions.MaxConns
+	}
+	minConns := *DefaultPoolOptions.MinConns
+	if o.MinConns != nil {
+		minConns = max(*o.MinConns, 0)
+	}
+	o.MinConns = PoolSize(min(minConns, o.MaxConns))
+	if o.MaxConnLifetime <= 0 {
+		o.MaxConnLifetime = DefaultPoolOptions.MaxConnLifetime
+	}
+	if o.MaxConnIdleTime <= 0 {
+		o.MaxConnIdleTime = DefaultPoolOptions.MaxConnIdleTime
+	}
+	if o.HealthCheckPeriod <= 0 {
+		o.HealthCheckPeriod = DefaultPoolOptions.HealthCheckPeriod
+	}
+	return o
+}
+
+// ConfigureDB applies o to a database/sql pool, which keeps MinConns connections idle
+// instead of opening them up front
+func (o PoolOptions) ConfigureDB(db *sql.DB) {
+	o = o.WithDefaults()
+	db.SetMaxOpenConns(int(o.MaxConns))
+	db.SetMaxIdleConns(int(*o.MinConns))
+	db.SetConnMaxLifetime(o.MaxConnLifetime)
+	db.SetConnMaxIdleTime(o.MaxConnIdleTime)
+}
+
+// DBPoolStats reports the pool of a database/sql handle
+func DBPoolStats(db *sql.DB) domain.PoolStats {
+	s := db.Stats()
+	return domain.PoolStats{
+		MaxConns:      int32(s.MaxOpenConnections),
+		TotalConns:    int32(s.OpenConnections),
+		AcquiredConns: int32(s.InUse),
+		IdleConns:     int32(s.Idle),
+		WaitCount:     s.WaitCount,
+		WaitMs:        s.WaitDuration.Milliseconds(),
+	}
+}
+
+// PoolStatter is implemented by adapters that keep a connection pool
+type PoolStatter interface {
+	// PoolStats reports the pool, and false while the adapter is not connected
+	PoolStats() (domain.PoolStats, bool)
+}
+
+// AdapterPoolStats is the pool of one pooled adapter
+type AdapterPoolStats struct {
+	ConnectionID uuid.UUID
+	DatabaseType string
+	Stats        domain.PoolStats
+}
@@ -0,0 +1,86 @@
+package mcp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pooledAdapter records the config it connects with and reports a fixed pool
+type pooledAdapter struct {
+	Adapter
+	config ConnectionConfig
+}
+
+func (a *pooledAdapter) DatabaseType() string { return "postgres" }
+
+func (a *pooledAdapter) Connect(ctx context.Context, config ConnectionConfig) error {
+	a.config = config
+	return nil
+}
+
+func (a *pooledAdapter) HealthCheck(ctx context.Context) error { return nil }
+
+func (a *pooledAdapter) Close() error { return nil }
+
+func (a *pooledAdapter) PoolStats() (domain.PoolStats, bool) {
+	return domain.PoolStats{MaxConns: a.config.Pool.MaxConns, AcquiredConns: 1}, true
+}
+
+func TestPoolOptions_WithDefaults(t *testing.T) {
+	assert.Equal(t, DefaultPoolOptions, PoolOptions{}.WithDefaults())
+
+	opts := PoolOptions{MaxConns: 20, MaxConnLifetime: time.Hour}.WithDefaults()
+	assert.Equal(t, int32(20), opts.MaxConns)
+	assert.Equal(t, DefaultPoolOptions.MinConns, opts.MinConns)
+	assert.Equal(t, time.Hour, opts.MaxConnLifetime)
+	assert.Equal(t, DefaultPoolOptions.HealthCheckPeriod, opts.HealthCheckPeriod)
+
+	assert.Equal(t, int32(2), *PoolOptions{MaxConns: 2, MinConns: PoolSize(4)}.WithDefaults().MinConns, "the minimum never exceeds the maximum")
+	assert.Equal(t, int32(0), *PoolOptions{MinConns: PoolSize(0)}.WithDefaults().MinConns, "no idle connections")
+}
+
+func TestRouter_PoolOptionsAndStats(t *testing.T) {
+	ctx := context.Background()
+	router := NewRouter().WithPoolOptions(PoolOptions{MaxConns: 12})
+	router.RegisterAdapter("postgres", func() Adapter { return &pooledAdapter{} })
+	router.RegisterAdapter("plain", func() Adapter { return &plainAdapter{} })
+
+	defaulted, err := router.GetAdapter(ctx, uuid.New(), "postgres", ConnectionConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(12), defaulted.(*pooledAdapter).config.Pool.MaxConns, "the router's options apply when the config sets none")
+
+	ownID := uuid.New()
+	own, err := router.GetAdapter(ctx, ownID, "postgres", ConnectionConfig{Pool: PoolOptions{MaxConns: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), own.(*pooledAdapter).config.Pool.MaxConns)
+
+	_, err = router.GetAdapter(ctx, uuid.New(), "plain", ConnectionConfig{})
+	require.NoError(t, err)
+
+	stats := router.PoolStats()
+	require.Len(t, stats, 2, "adapters without a pool are left out")
+	for _, s := range stats {
+		assert.Equal(t, "postgres", s.DatabaseType)
+		assert.Equal(t, int32(1), s.Stats.AcquiredConns)
+		if s.ConnectionID == ownID {
+			assert.Equal(t, int32(3), s.Stats.MaxConns)
+		}
+	}
+}
+
+// plainAdapter keeps no connection pool
+type plainAdapter struct {
+	Adapter
+}
+
+func (a *plainAdapter) DatabaseType() string { return "plain" }
+
+func (a *plainAdapter) Connect(ctx context.Context, config ConnectionConfig) error { return nil }
+
+func (a *plainAdapter) HealthCheck(ctx context.Context) error { return nil }
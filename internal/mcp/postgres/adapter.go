@@ -2,16 +2,24 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Adapter implements mcp.Adapter for PostgreSQL
 type Adapter struct {
 	pool *pgxpool.Pool
+	// replica is the pool of the read replica, nil without one
+	replica *pgxpool.Pool
+	route   *mcp.ReplicaRoute
 }
 
 // NewAdapter creates a new PostgreSQL adapter
@@ -26,7 +34,11 @@ func (a *Adapter) DatabaseType() string {
 
 // SQLDialect returns SQL dialect hints for LLM prompting
 func (a *Adapter) SQLDialect() string {
-	return `PostgreSQL SQL dialect:
+	return Dialect
+}
+
+// Dialect holds the SQL dialect hints given to the LLM, which need no connection
+const Dialect = `PostgreSQL SQL dialect:
 - Use double quotes for identifiers with special characters: "column name"
 - String concatenation: column1 || column2
 - Case-insensitive matching: ILIKE instead of LIKE
@@ -42,10 +54,36 @@ func (a *Adapter) SQLDialect() string {
 - Aggregate functions: COUNT(), SUM(), AVG(), MIN(), MAX(), STRING_AGG()
 - Window functions: ROW_NUMBER(), RANK(), DENSE_RANK(), LAG(), LEAD()
 - Common table expressions (CTEs): WITH cte AS (SELECT ...)`
-}
 
-// Connect establishes connection to PostgreSQL
+// Connect establishes connection to PostgreSQL. The read replica, if any, is not
+// reached until a statement needs it, so a replica that is down does not keep the
+// primary from being used.
 func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error {
+	conns, err := newPool(ctx, config)
+	if err != nil {
+		return err
+	}
+	if err := conns.Ping(ctx); err != nil {
+		conns.Close()
+		return security.Redact(fmt.Errorf("failed to ping: %w", err), config.Password)
+	}
+
+	if replicaConfig, ok := config.Replica(); ok {
+		replica, err := newPool(ctx, replicaConfig)
+		if err != nil {
+			conns.Close()
+			return fmt.Errorf("replica: %w", err)
+		}
+		a.replica = replica
+		a.route = mcp.NewReplicaRoute(a.DatabaseType(), config)
+	}
+
+	a.pool = conns
+	return nil
+}
+
+// newPool creates the connection pool of config without connecting
+func newPool(ctx context.Context, config mcp.ConnectionConfig) (*pgxpool.Pool, error) {
 	dsn := fmt.Sprintf(
 		"postgres://%s:%s@%s:%d/%s?sslmode=%s",
 		config.Username,
@@ -58,24 +96,21 @@ func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) erro
 
 	poolConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
-		return fmt.Errorf("failed to parse config: %w", err)
+		return nil, security.Redact(fmt.Errorf("failed to parse config: %w", err), config.Password)
 	}
 
-	poolConfig.MaxConns = 5
-	poolConfig.MinConns = 1
+	pool := config.Pool.WithDefaults()
+	poolConfig.MaxConns = pool.MaxConns
+	poolConfig.MinConns = *pool.MinConns
+	poolConfig.MaxConnLifetime = pool.MaxConnLifetime
+	poolConfig.MaxConnIdleTime = pool.MaxConnIdleTime
+	poolConfig.HealthCheckPeriod = pool.HealthCheckPeriod
 
-	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	conns, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create pool: %w", err)
-	}
-
-	if err := pool.Ping(ctx); err != nil {
-		pool.Close()
-		return fmt.Errorf("failed to ping: %w", err)
+		return nil, security.Redact(fmt.Errorf("failed to create pool: %w", err), config.Password)
 	}
-
-	a.pool = pool
-	return nil
+	return conns, nil
 }
 
 // Close closes the connection
@@ -84,9 +119,50 @@ func (a *Adapter) Close() error {
 		a.pool.Close()
 		a.pool = nil
 	}
+	if a.replica != nil {
+		a.replica.Close()
+		a.replica = nil
+	}
 	return nil
 }
 
+// queryPool returns the pool queries run on
+func (a *Adapter) queryPool(ctx context.Context) *pgxpool.Pool {
+	if a.route.Use(ctx, false, a.replica.Ping) {
+		return a.replica
+	}
+	return a.pool
+}
+
+// schemaPool returns the pool schema introspection runs on
+func (a *Adapter) schemaPool(ctx context.Context) *pgxpool.Pool {
+	if a.route.Use(ctx, true, a.replica.Ping) {
+		return a.replica
+	}
+	return a.pool
+}
+
+// PoolStats reports the connection pool
+func (a *Adapter) PoolStats() (domain.PoolStats, bool) {
+	if a.pool == nil {
+		return domain.PoolStats{}, false
+	}
+	return poolStats(a.pool.Stat()), true
+}
+
+// poolStats converts pgxpool statistics. Acquisitions that found the pool empty are
+// the ones that waited.
+func poolStats(s *pgxpool.Stat) domain.PoolStats {
+	return domain.PoolStats{
+		MaxConns:      s.MaxConns(),
+		TotalConns:    s.TotalConns(),
+		AcquiredConns: s.AcquiredConns(),
+		IdleConns:     s.IdleConns(),
+		WaitCount:     s.EmptyAcquireCount(),
+		WaitMs:        s.AcquireDuration().Milliseconds(),
+	}
+}
+
 // HealthCheck verifies connection is alive
 func (a *Adapter) HealthCheck(ctx context.Context) error {
 	if a.pool == nil {
@@ -105,7 +181,7 @@ func (a *Adapter) ListTables(ctx context.Context) ([]string, error) {
 		ORDER BY table_name
 	`
 
-	rows, err := a.pool.Query(ctx, query)
+	rows, err := a.schemaPool(ctx).Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tables: %w", err)
 	}
@@ -148,7 +224,8 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 		ORDER BY c.ordinal_position
 	`
 
-	rows, err := a.pool.Query(ctx, query, tableName)
+	pool := a.schemaPool(ctx)
+	rows, err := pool.Query(ctx, query, tableName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to describe table: %w", err)
 	}
@@ -169,7 +246,7 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 
 	// Get row count estimate
 	var rowCount int64
-	err = a.pool.QueryRow(ctx, `
+	err = pool.QueryRow(ctx, `
 		SELECT reltuples::bigint 
 		FROM pg_class 
 		WHERE relname = $1
@@ -180,16 +257,132 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 		rowCountPtr = &rowCount
 	}
 
+	// Indexes are only a hint for prompting, so failing to read them is not an error
+	indexes, _ := a.indexes(ctx, tableName)
+
 	return &mcp.TableInfo{
 		Name:       tableName,
 		SchemaName: "public",
 		Columns:    columns,
 		RowCount:   rowCountPtr,
+		Indexes:    indexes[tableName],
 	}, nil
 }
 
+// DescribeTables describes every table in one query for the columns, plus one each
+// for row counts and indexes
+func (a *Adapter) DescribeTables(ctx context.Context) ([]mcp.TableInfo, error) {
+	query := `
+		SELECT
+			c.table_name,
+			c.column_name,
+			c.data_type,
+			c.is_nullable = 'YES' as nullable,
+			COALESCE(
+				(SELECT true FROM information_schema.key_column_usage kcu
+				 JOIN information_schema.table_constraints tc
+				   ON kcu.constraint_name = tc.constraint_name
+				 WHERE tc.constraint_type = 'PRIMARY KEY'
+				   AND kcu.table_name = c.table_name
+				   AND kcu.column_name = c.column_name
+				 LIMIT 1), false
+			) as primary_key,
+			COALESCE(col_description(pc.oid, c.ordinal_position), '') as description
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+		  ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		LEFT JOIN pg_class pc
+		  ON pc.relname = c.table_name
+		 AND pc.relnamespace = 'public'::regnamespace
+		WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position
+	`
+
+	rows, err := a.schemaPool(ctx).Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []mcp.TableInfo
+	for rows.Next() {
+		var table string
+		var col mcp.ColumnInfo
+		if err := rows.Scan(&table, &col.Name, &col.DataType, &col.Nullable, &col.PrimaryKey, &col.Description); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		if len(tables) == 0 || tables[len(tables)-1].Name != table {
+			tables = append(tables, mcp.TableInfo{Name: table, SchemaName: "public"})
+		}
+		tables[len(tables)-1].Columns = append(tables[len(tables)-1].Columns, col)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to describe tables: %w", err)
+	}
+
+	// Row counts and indexes are only hints, as in DescribeTable
+	rowCounts, _ := a.rowCounts(ctx)
+	indexes, _ := a.indexes(ctx, "")
+	for i := range tables {
+		if n, ok := rowCounts[tables[i].Name]; ok {
+			tables[i].RowCount = &n
+		}
+		tables[i].Indexes = indexes[tables[i].Name]
+	}
+	return tables, nil
+}
+
+// indexes returns the secondary indexes of a table, or of all tables when tableName
+// is empty, by table. Expression and partial indexes are left out, as are included
+// non-key columns.
+func (a *Adapter) indexes(ctx context.Context, tableName string) (map[string][]mcp.IndexInfo, error) {
+	rows, err := a.schemaPool(ctx).Query(ctx, `
+		SELECT t.relname, i.relname, ix.indisunique,
+			array_agg(att.attname::text ORDER BY k.ord)
+		FROM pg_index ix
+		JOIN pg_class t ON t.oid = ix.indrelid
+		JOIN pg_class i ON i.oid = ix.indexrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		CROSS JOIN LATERAL unnest(ix.indkey::int2[]) WITH ORDINALITY AS k(attnum, ord)
+		JOIN pg_attribute att ON att.attrelid = t.oid AND att.attnum = k.attnum
+		WHERE n.nspname = 'public'
+		  AND ($1 = '' OR t.relname = $1)
+		  AND NOT ix.indisprimary
+		  AND ix.indpred IS NULL
+		  AND ix.indexprs IS NULL
+		  AND k.ord <= ix.indnkeyatts
+		GROUP BY t.relname, i.relname, ix.indisunique
+		ORDER BY t.relname, i.relname
+	`, tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes: %w", err)
+	}
+	defer rows.Close()
+
+	indexes := make(map[string][]mcp.IndexInfo)
+	for rows.Next() {
+		var table string
+		var idx mcp.IndexInfo
+		if err := rows.Scan(&table, &idx.Name, &idx.Unique, &idx.Columns); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		indexes[table] = append(indexes[table], idx)
+	}
+	return indexes, rows.Err()
+}
+
 // GetSchemaDDL returns full schema as DDL for LLM context
 func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
+	return a.OrderedSchemaDDL(ctx, mcp.SchemaOptions{})
+}
+
+// OrderedSchemaDDL returns the full schema as DDL with tables ordered following opts
+func (a *Adapter) OrderedSchemaDDL(ctx context.Context, opts mcp.SchemaOptions) (string, error) {
+	// Indexes and row counts are only hints, so the DDL goes without them when they
+	// cannot be read
+	indexes, _ := a.indexes(ctx, "")
+	rowCounts, _ := a.rowCounts(ctx)
+
 	query := `
 		SELECT 
 			c.table_name,
@@ -211,14 +404,14 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 		ORDER BY c.table_name, c.ordinal_position
 	`
 
-	rows, err := a.pool.Query(ctx, query)
+	rows, err := a.schemaPool(ctx).Query(ctx, query)
 	if err != nil {
 		return "", fmt.Errorf("failed to get schema: %w", err)
 	}
 	defer rows.Close()
 
-	var ddl strings.Builder
-	currentTable := ""
+	var tables []string
+	columns := make(map[string][]string)
 
 	for rows.Next() {
 		var tableName, columnName, dataType, isNullable, constraintType string
@@ -228,14 +421,8 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 			return "", fmt.Errorf("failed to scan: %w", err)
 		}
 
-		if tableName != currentTable {
-			if currentTable != "" {
-				ddl.WriteString("\n);\n\n")
-			}
-			ddl.WriteString(fmt.Sprintf("CREATE TABLE %s (\n", tableName))
-			currentTable = tableName
-		} else {
-			ddl.WriteString(",\n")
+		if _, ok := columns[tableName]; !ok {
+			tables = append(tables, tableName)
 		}
 
 		nullable := ""
@@ -248,29 +435,136 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 			pk = " PRIMARY KEY"
 		}
 
-		ddl.WriteString(fmt.Sprintf("  %s %s%s%s", columnName, dataType, nullable, pk))
+		columns[tableName] = append(columns[tableName], fmt.Sprintf("  %s %s%s%s", columnName, dataType, nullable, pk))
+	}
+	if err := rows.Err(); err != nil {
+		return "", fmt.Errorf("failed to get schema: %w", err)
 	}
 
-	if currentTable != "" {
-		ddl.WriteString("\n);")
+	var ddl strings.Builder
+	for i, tableName := range mcp.OrderTables(tables, rowCounts, opts) {
+		if i > 0 {
+			ddl.WriteString("\n\n")
+		}
+		ddl.WriteString(fmt.Sprintf("CREATE TABLE %s (", tableName))
+		if n, ok := rowCounts[tableName]; ok {
+			ddl.WriteString(mcp.RowCountComment(n))
+		}
+		ddl.WriteString("\n" + strings.Join(columns[tableName], ",\n") + "\n);")
+		ddl.WriteString(mcp.IndexComments(indexes[tableName]))
 	}
 
 	return ddl.String(), nil
 }
 
+// rowCounts returns the planner's row estimates of the tables that have been analyzed
+func (a *Adapter) rowCounts(ctx context.Context) (map[string]int64, error) {
+	rows, err := a.schemaPool(ctx).Query(ctx, `
+		SELECT c.relname, c.reltuples::bigint
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE n.nspname = 'public' AND c.relkind IN ('r', 'p') AND c.reltuples >= 0
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get row counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var table string
+		var count int64
+		if err := rows.Scan(&table, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan row count: %w", err)
+		}
+		counts[table] = count
+	}
+	return counts, rows.Err()
+}
+
 // ValidateQuery validates SQL is safe to execute
 func (a *Adapter) ValidateQuery(sql string) error {
-	return mcp.ValidateSQL(sql, mcp.PostgresBlockedPatterns)
+	return mcp.ValidateSQL(sql, mcp.DialectPostgres, mcp.PostgresBlockedPatterns)
+}
+
+// PageQuery returns the rows of page with LIMIT and OFFSET, or a keyset predicate
+func (a *Adapter) PageQuery(sql string, page mcp.Page) (string, error) {
+	return mcp.LimitOffsetPage(sql, page, mcp.QuoteDouble)
 }
 
 // ExecuteQuery executes read-only SQL query
 func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, nil, opts)
+	})
+}
+
+// Placeholder returns the placeholder of the n-th query parameter
+func (a *Adapter) Placeholder(n int, _ mcp.ParamType) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// ExecuteQueryWithParams executes read-only SQL with $n placeholders bound to params
+func (a *Adapter) ExecuteQueryWithParams(ctx context.Context, sql string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sql, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sql, mcp.ParamValues(params), opts)
+	})
+}
+
+// ExplainQuery estimates rows and cost from the planner without running the query
+func (a *Adapter) ExplainQuery(ctx context.Context, sql string) (*mcp.QueryEstimate, error) {
+	if err := a.ValidateQuery(sql); err != nil {
+		return nil, err
+	}
+
+	var plan []byte
+	if err := a.queryPool(ctx).QueryRow(ctx, "EXPLAIN (FORMAT JSON) "+sql).Scan(&plan); err != nil {
+		return nil, fmt.Errorf("explain failed: %w", err)
+	}
+	return parsePlan(plan)
+}
+
+// planNode is the part of an EXPLAIN (FORMAT JSON) node the estimate needs
+type planNode struct {
+	TotalCost float64    `json:"Total Cost"`
+	PlanRows  float64    `json:"Plan Rows"`
+	Plans     []planNode `json:"Plans"`
+}
+
+// parsePlan reads the total cost of the plan and the most rows any node handles,
+// so an aggregate over a huge scan is caught even though it returns one row
+func parsePlan(data []byte) (*mcp.QueryEstimate, error) {
+	var plans []struct {
+		Plan planNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, errors.New("failed to parse plan: empty plan")
+	}
+
+	root := plans[0].Plan
+	return &mcp.QueryEstimate{Rows: maxPlanRows(root), Cost: root.TotalCost}, nil
+}
+
+func maxPlanRows(node planNode) float64 {
+	rows := node.PlanRows
+	for _, child := range node.Plans {
+		rows = max(rows, maxPlanRows(child))
+	}
+	return rows
+}
+
+// executeQuery validates, limits and runs the query with args bound to its placeholders
+func (a *Adapter) executeQuery(ctx context.Context, sql string, args []any, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
 	if err := a.ValidateQuery(sql); err != nil {
 		return nil, err
 	}
 
-	// Enforce LIMIT
-	sql = mcp.EnforceLimit(sql, opts.MaxRows, "LIMIT")
+	// Enforce LIMIT, one row past the limit so truncation can be detected
+	limit, defaultApplied := opts.RowLimit(mcp.HasLimit(sql))
+	sql = mcp.EnforceLimit(sql, limit+1, "LIMIT")
 
 	// Create context with timeout
 	if opts.Timeout > 0 {
@@ -279,7 +573,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 		defer cancel()
 	}
 
-	rows, err := a.pool.Query(ctx, sql)
+	rows, err := a.queryPool(ctx).Query(ctx, sql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -302,7 +596,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 		resultRows = append(resultRows, values)
 
 		// Stop if we've exceeded max rows
-		if len(resultRows) > opts.MaxRows {
+		if len(resultRows) > limit {
 			break
 		}
 	}
@@ -311,15 +605,16 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.QueryOp
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	truncated := len(resultRows) > opts.MaxRows
+	truncated := len(resultRows) > limit
 	if truncated {
-		resultRows = resultRows[:opts.MaxRows]
+		resultRows = resultRows[:limit]
 	}
 
 	return &mcp.QueryResult{
-		Columns:   columns,
-		Rows:      resultRows,
-		RowCount:  len(resultRows),
-		Truncated: truncated,
+		Columns:             columns,
+		Rows:                resultRows,
+		RowCount:            len(resultRows),
+		Truncated:           truncated,
+		DefaultLimitApplied: defaultApplied,
 	}, nil
 }
@@ -0,0 +1,24 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlan(t *testing.T) {
+	// An aggregate over a cross join returns one row but handles many more
+	plan := `[{"Plan": {"Node Type": "Aggregate", "Total Cost": 55000012.5, "Plan Rows": 1,
+		"Plans": [{"Node Type": "Nested Loop", "Total Cost": 50000010, "Plan Rows": 4000000000,
+			"Plans": [{"Node Type": "Seq Scan", "Total Cost": 1000, "Plan Rows": 2000000},
+			          {"Node Type": "Seq Scan", "Total Cost": 10, "Plan Rows": 2000}]}]}}]`
+
+	estimate, err := parsePlan([]byte(plan))
+	require.NoError(t, err)
+	assert.Equal(t, float64(4000000000), estimate.Rows)
+	assert.Equal(t, 55000012.5, estimate.Cost)
+
+	_, err = parsePlan([]byte(`[]`))
+	assert.EqualError(t, err, "failed to parse plan: empty plan")
+}
@@ -0,0 +1,35 @@
+//go:build contract
+
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp/mcptest"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContract(t *testing.T) {
+	raw := mcptest.DatabaseURL(t, "TEST_POSTGRES_URL", mcptest.Postgres)
+	config := mcptest.ConfigFromURL(t, raw)
+
+	conn, err := pgx.Connect(context.Background(), raw)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	mcptest.Run(t, mcptest.Target{
+		Adapter: NewAdapter(),
+		Config:  config,
+		Exec: func(ctx context.Context, stmt string) error {
+			_, err := conn.Exec(ctx, stmt)
+			return err
+		},
+		CreateTables: []string{
+			`CREATE TABLE contract_customers (id INTEGER PRIMARY KEY, name TEXT NOT NULL, email TEXT)`,
+			`CREATE TABLE contract_orders (id INTEGER PRIMARY KEY, customer_id INTEGER NOT NULL,
+				total DOUBLE PRECISION NOT NULL, note TEXT)`,
+		},
+	})
+}
@@ -0,0 +1,83 @@
+package mcp
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/logging"
+)
+
+// replicaProbeTimeout bounds reaching the replica before a statement falls back to
+// the primary
+const replicaProbeTimeout = 2 * time.Second
+
+// replicaRetryInterval is how long statements go to the primary after the replica
+// could not be reached
+const replicaRetryInterval = 30 * time.Second
+
+// replicaTrustInterval is how long statements go to the replica without a probe after
+// it answered one, so a schema refresh does not ping it before every table
+const replicaTrustInterval = 5 * time.Second
+
+// ReplicaRoute decides whether a statement runs on a connection's read replica. A nil
+// route has no replica.
+type ReplicaRoute struct {
+	dbType     string
+	forSchema  bool
+	onFallback func()
+	skipUntil  atomic.Int64 // Unix nanoseconds
+	trustUntil atomic.Int64 // Unix nanoseconds
+	now        func() time.Time
+}
+
+// NewReplicaRoute returns the route of config, nil when it has no replica
+func NewReplicaRoute(dbType string, config ConnectionConfig) *ReplicaRoute {
+	if config.ReplicaHost == "" {
+		return nil
+	}
+	return &ReplicaRoute{
+		dbType:     dbType,
+		forSchema:  config.ReplicaForSchema,
+		onFallback: config.OnReplicaFallback,
+		now:        time.Now,
+	}
+}
+
+// Use reports whether a statement, schema introspection when schema is set and a
+// query otherwise, runs on the replica. The replica must have answered ping in the
+// last 5 seconds; when it does not, the fallback is logged and reported, and the
+// primary serves the statements for the next 30 seconds.
+func (r *ReplicaRoute) Use(ctx context.Context, schema bool, ping func(ctx context.Context) error) bool {
+	if r == nil || r.forSchema != schema {
+		return false
+	}
+	now := r.now().UnixNano()
+	if now < r.skipUntil.Load() {
+		return false
+	}
+	if now < r.trustUntil.Load() {
+		return true
+	}
+
+	pingCtx, cancel := context.WithTimeout(ctx, replicaProbeTimeout)
+	defer cancel()
+	err := ping(pingCtx)
+	if err == nil {
+		r.trustUntil.Store(r.now().Add(replicaTrustInterval).UnixNano())
+		return true
+	}
+	// A canceled request says nothing about the replica
+	if ctx.Err() != nil {
+		return false
+	}
+
+	r.skipUntil.Store(r.now().Add(replicaRetryInterval).UnixNano())
+	logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).
+		Str("database_type", r.dbType).
+		Msg("read replica unreachable, falling back to the primary")
+	if r.onFallback != nil {
+		r.onFallback()
+	}
+	return false
+}
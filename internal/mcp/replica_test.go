@@ -0,0 +1,60 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionConfig_Replica(t *testing.T) {
+	config := ConnectionConfig{Host: "primary", Port: 5432, Database: "sales", ReplicaHost: "replica", ReplicaForSchema: true}
+
+	replica, ok := config.Replica()
+	assert.True(t, ok)
+	assert.Equal(t, ConnectionConfig{Host: "replica", Port: 5432, Database: "sales"}, replica)
+
+	_, ok = ConnectionConfig{Host: "primary"}.Replica()
+	assert.False(t, ok)
+}
+
+func TestReplicaRoute(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fallbacks := 0
+	route := NewReplicaRoute("postgres", ConnectionConfig{ReplicaHost: "replica", OnReplicaFallback: func() { fallbacks++ }})
+	route.now = func() time.Time { return now }
+
+	pings := 0
+	up := func(context.Context) error { pings++; return nil }
+	down := func(context.Context) error { pings++; return errors.New("connection refused") }
+
+	assert.True(t, route.Use(ctx, false, up), "queries go to the replica")
+	assert.False(t, route.Use(ctx, true, up), "schema introspection stays on the primary")
+	assert.Equal(t, 1, pings)
+
+	// A replica that just answered is not probed again for a while
+	assert.True(t, route.Use(ctx, false, down))
+	assert.Equal(t, 1, pings)
+	now = now.Add(replicaTrustInterval)
+
+	assert.False(t, route.Use(ctx, false, down))
+	assert.Equal(t, 1, fallbacks)
+	// The primary serves queries for a while without trying the replica again
+	assert.False(t, route.Use(ctx, false, up))
+	assert.Equal(t, 2, pings)
+
+	now = now.Add(replicaRetryInterval)
+	assert.True(t, route.Use(ctx, false, up))
+
+	now = now.Add(replicaTrustInterval)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, route.Use(canceled, false, down))
+	assert.Equal(t, 1, fallbacks, "a canceled request is not a fallback")
+
+	var none *ReplicaRoute
+	assert.False(t, none.Use(ctx, false, up))
+}
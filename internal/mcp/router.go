@@ -2,27 +2,89 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/google/uuid"
 )
 
+// DefaultHealthCheckInterval is how long a pooled adapter that passed a health check
+// is handed out without checking it again
+const DefaultHealthCheckInterval = 5 * time.Second
+
+// healthCheckTimeout bounds the health check of a pooled adapter, so a database that
+// stopped answering is reconnected instead of stalling the request
+const healthCheckTimeout = 2 * time.Second
+
+// ReconnectHook is called when a pooled adapter failed its health check and was
+// replaced by a fresh one
+type ReconnectHook func(connectionID uuid.UUID, databaseType string)
+
+// ReplicaFallbackHook is called when an adapter could not reach the read replica of a
+// connection and used the primary instead
+type ReplicaFallbackHook func(connectionID uuid.UUID, databaseType string)
+
 // Router manages database adapters and connection pooling
 type Router struct {
-	factories map[string]AdapterFactory
-	pool      map[string]Adapter
-	mu        sync.RWMutex
+	factories           map[string]AdapterFactory
+	dialects            map[string]string
+	pool                map[string]*poolEntry
+	poolOptions         PoolOptions
+	healthCheckInterval time.Duration
+	onReconnect         ReconnectHook
+	onReplicaFallback   ReplicaFallbackHook
+	now                 func() time.Time
+	mu                  sync.RWMutex
+}
+
+// poolEntry is a pooled adapter and when it last passed a health check
+type poolEntry struct {
+	adapter   Adapter
+	checkedAt atomic.Int64 // Unix nanoseconds
 }
 
 // NewRouter creates a new adapter router
 func NewRouter() *Router {
 	return &Router{
-		factories: make(map[string]AdapterFactory),
-		pool:      make(map[string]Adapter),
+		factories:           make(map[string]AdapterFactory),
+		dialects:            make(map[string]string),
+		pool:                make(map[string]*poolEntry),
+		healthCheckInterval: DefaultHealthCheckInterval,
+		now:                 time.Now,
 	}
 }
 
+// WithPoolOptions sets the connection pool options of adapters whose connection
+// config sets none
+func (r *Router) WithPoolOptions(opts PoolOptions) *Router {
+	r.poolOptions = opts
+	return r
+}
+
+// WithHealthCheckInterval sets how long a healthy pooled adapter is trusted before it
+// is checked again; 0 checks it on every use
+func (r *Router) WithHealthCheckInterval(interval time.Duration) *Router {
+	r.healthCheckInterval = max(interval, 0)
+	return r
+}
+
+// WithReconnectHook calls hook whenever a dead pooled adapter is replaced
+func (r *Router) WithReconnectHook(hook ReconnectHook) *Router {
+	r.onReconnect = hook
+	return r
+}
+
+// WithReplicaFallbackHook calls hook whenever an adapter falls back from a read
+// replica to the primary
+func (r *Router) WithReplicaFallbackHook(hook ReplicaFallbackHook) *Router {
+	r.onReplicaFallback = hook
+	return r
+}
+
 // RegisterAdapter registers an adapter factory for a database type
 func (r *Router) RegisterAdapter(dbType string, factory AdapterFactory) {
 	r.mu.Lock()
@@ -30,6 +92,22 @@ func (r *Router) RegisterAdapter(dbType string, factory AdapterFactory) {
 	r.factories[dbType] = factory
 }
 
+// RegisterDialect registers the dialect hints of a database type, so prompts can be
+// built for it without an adapter or a connection
+func (r *Router) RegisterDialect(dbType, dialect string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.dialects[dbType] = dialect
+}
+
+// Dialect returns the dialect hints registered for a database type
+func (r *Router) Dialect(dbType string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	dialect, ok := r.dialects[dbType]
+	return dialect, ok
+}
+
 // SupportedDatabases returns list of supported database types
 func (r *Router) SupportedDatabases() []string {
 	r.mu.RLock()
@@ -42,37 +120,37 @@ func (r *Router) SupportedDatabases() []string {
 	return types
 }
 
-// GetAdapter returns an adapter for the given connection, creating if needed
+// GetAdapter returns an adapter for the given connection, creating if needed. A
+// pooled adapter is health checked at most every health check interval; one that
+// fails, such as after the database restarted, is closed and connected afresh once.
 func (r *Router) GetAdapter(ctx context.Context, connectionID uuid.UUID, dbType string, config ConnectionConfig) (Adapter, error) {
 	connKey := connectionID.String()
 
-	// Check for existing healthy connection
 	r.mu.RLock()
-	if adapter, ok := r.pool[connKey]; ok {
-		r.mu.RUnlock()
-		if err := adapter.HealthCheck(ctx); err == nil {
-			return adapter, nil
+	entry, ok := r.pool[connKey]
+	r.mu.RUnlock()
+	if ok {
+		if r.healthy(ctx, entry) {
+			return entry.adapter, nil
+		}
+		// A canceled request says nothing about the database
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		// Connection unhealthy, will recreate
-		r.mu.Lock()
-		adapter.Close()
-		delete(r.pool, connKey)
-		r.mu.Unlock()
-	} else {
-		r.mu.RUnlock()
 	}
 
-	// Create new connection
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	// Double-check after acquiring write lock
-	if adapter, ok := r.pool[connKey]; ok {
-		if err := adapter.HealthCheck(ctx); err == nil {
-			return adapter, nil
+	// Another request may have reconnected while the lock was released
+	reconnect := false
+	if current, ok := r.pool[connKey]; ok {
+		if current != entry && r.healthy(ctx, current) {
+			return current.adapter, nil
 		}
-		adapter.Close()
+		current.adapter.Close()
 		delete(r.pool, connKey)
+		reconnect = true
 	}
 
 	factory, ok := r.factories[dbType]
@@ -80,15 +158,48 @@ func (r *Router) GetAdapter(ctx context.Context, connectionID uuid.UUID, dbType
 		return nil, fmt.Errorf("unsupported database type: %s", dbType)
 	}
 
+	if config.Pool == (PoolOptions{}) {
+		config.Pool = r.poolOptions
+	}
+	if hook := r.onReplicaFallback; hook != nil && config.ReplicaHost != "" {
+		config.OnReplicaFallback = func() { hook(connectionID, dbType) }
+	}
 	adapter := factory()
 	if err := adapter.Connect(ctx, config); err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	r.pool[connKey] = adapter
+	fresh := &poolEntry{adapter: adapter}
+	fresh.checkedAt.Store(r.now().UnixNano())
+	r.pool[connKey] = fresh
+	if reconnect {
+		logging.FromContext(ctx).Info().Ctx(ctx).
+			Str("connection_id", connKey).
+			Str("database_type", dbType).
+			Msg("reconnected pooled database adapter after failed health check")
+		if r.onReconnect != nil {
+			r.onReconnect(connectionID, dbType)
+		}
+	}
 	return adapter, nil
 }
 
+// healthy reports whether entry passed a health check within the health check
+// interval, checking it again when it did not
+func (r *Router) healthy(ctx context.Context, entry *poolEntry) bool {
+	now := r.now()
+	if now.Sub(time.Unix(0, entry.checkedAt.Load())) < r.healthCheckInterval {
+		return true
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := entry.adapter.HealthCheck(checkCtx); err != nil {
+		return false
+	}
+	entry.checkedAt.Store(now.UnixNano())
+	return true
+}
+
 // CloseConnection closes a specific connection
 func (r *Router) CloseConnection(connectionID uuid.UUID) error {
 	connKey := connectionID.String()
@@ -96,8 +207,8 @@ func (r *Router) CloseConnection(connectionID uuid.UUID) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if adapter, ok := r.pool[connKey]; ok {
-		err := adapter.Close()
+	if entry, ok := r.pool[connKey]; ok {
+		err := entry.adapter.Close()
 		delete(r.pool, connKey)
 		return err
 	}
@@ -105,15 +216,19 @@ func (r *Router) CloseConnection(connectionID uuid.UUID) error {
 	return nil
 }
 
-// CloseAll closes all connections
-func (r *Router) CloseAll() {
+// CloseAll closes all pooled connections and returns their close errors
+func (r *Router) CloseAll() error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for connKey, adapter := range r.pool {
-		adapter.Close()
+	var errs []error
+	for connKey, entry := range r.pool {
+		if err := entry.adapter.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("connection %s: %w", connKey, err))
+		}
 		delete(r.pool, connKey)
 	}
+	return errors.Join(errs...)
 }
 
 // PoolSize returns the current number of pooled connections
@@ -122,3 +237,25 @@ func (r *Router) PoolSize() int {
 	defer r.mu.RUnlock()
 	return len(r.pool)
 }
+
+// PoolStats reports the connection pools of the pooled adapters that keep one
+func (r *Router) PoolStats() []AdapterPoolStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := make([]AdapterPoolStats, 0, len(r.pool))
+	for connKey, entry := range r.pool {
+		adapter := entry.adapter
+		statter, ok := adapter.(PoolStatter)
+		if !ok {
+			continue
+		}
+		pool, ok := statter.PoolStats()
+		if !ok {
+			continue
+		}
+		connectionID, _ := uuid.Parse(connKey)
+		stats = append(stats, AdapterPoolStats{ConnectionID: connectionID, DatabaseType: adapter.DatabaseType(), Stats: pool})
+	}
+	return stats
+}
@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyAdapter fails its health checks once down is set
+type flakyAdapter struct {
+	Adapter
+	down   bool
+	checks int
+	closed bool
+}
+
+func (a *flakyAdapter) DatabaseType() string { return "mysql" }
+
+func (a *flakyAdapter) Connect(ctx context.Context, config ConnectionConfig) error { return nil }
+
+func (a *flakyAdapter) HealthCheck(ctx context.Context) error {
+	a.checks++
+	if a.down {
+		return errors.New("driver: bad connection")
+	}
+	return nil
+}
+
+func (a *flakyAdapter) Close() error {
+	a.closed = true
+	return nil
+}
+
+func TestRouter_GetAdapterHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	clock := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	var created []*flakyAdapter
+	var reconnects []uuid.UUID
+
+	router := NewRouter().WithReconnectHook(func(connectionID uuid.UUID, databaseType string) {
+		assert.Equal(t, "mysql", databaseType)
+		reconnects = append(reconnects, connectionID)
+	})
+	router.now = func() time.Time { return clock }
+	router.RegisterAdapter("mysql", func() Adapter {
+		a := &flakyAdapter{}
+		created = append(created, a)
+		return a
+	})
+	connectionID := uuid.New()
+
+	first, err := router.GetAdapter(ctx, connectionID, "mysql", ConnectionConfig{})
+	require.NoError(t, err)
+
+	again, err := router.GetAdapter(ctx, connectionID, "mysql", ConnectionConfig{})
+	require.NoError(t, err)
+	assert.Same(t, first, again)
+	assert.Zero(t, created[0].checks, "a fresh adapter is not checked within the interval")
+
+	clock = clock.Add(DefaultHealthCheckInterval)
+	_, err = router.GetAdapter(ctx, connectionID, "mysql", ConnectionConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, created[0].checks)
+
+	// The database restarted overnight
+	created[0].down = true
+	clock = clock.Add(8 * time.Hour)
+	fresh, err := router.GetAdapter(ctx, connectionID, "mysql", ConnectionConfig{})
+	require.NoError(t, err)
+	require.Len(t, created, 2)
+	assert.Same(t, created[1], fresh)
+	assert.True(t, created[0].closed)
+	assert.Equal(t, []uuid.UUID{connectionID}, reconnects)
+	assert.Equal(t, 1, router.PoolSize())
+}
+
+func TestRouter_GetAdapterCanceled(t *testing.T) {
+	router := NewRouter().WithHealthCheckInterval(0)
+	var created []*flakyAdapter
+	router.RegisterAdapter("mysql", func() Adapter {
+		a := &flakyAdapter{}
+		created = append(created, a)
+		return a
+	})
+	connectionID := uuid.New()
+	_, err := router.GetAdapter(context.Background(), connectionID, "mysql", ConnectionConfig{})
+	require.NoError(t, err)
+
+	created[0].down = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = router.GetAdapter(ctx, connectionID, "mysql", ConnectionConfig{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Len(t, created, 1, "a canceled request does not reconnect")
+	assert.False(t, created[0].closed)
+}
+
+func TestRouter_Dialect(t *testing.T) {
+	router := NewRouter()
+	router.RegisterDialect("postgres", "PostgreSQL SQL dialect")
+
+	dialect, ok := router.Dialect("postgres")
+	assert.True(t, ok)
+	assert.Equal(t, "PostgreSQL SQL dialect", dialect)
+
+	_, ok = router.Dialect("oracle")
+	assert.False(t, ok)
+}
+
+// configAdapter keeps the config it was connected with
+type configAdapter struct {
+	Adapter
+	config ConnectionConfig
+}
+
+func (a *configAdapter) Connect(ctx context.Context, config ConnectionConfig) error {
+	a.config = config
+	return nil
+}
+
+func TestRouter_ReplicaFallbackHook(t *testing.T) {
+	var fallbacks []uuid.UUID
+	router := NewRouter().WithReplicaFallbackHook(func(connectionID uuid.UUID, databaseType string) {
+		assert.Equal(t, "postgres", databaseType)
+		fallbacks = append(fallbacks, connectionID)
+	})
+	adapter := &configAdapter{}
+	router.RegisterAdapter("postgres", func() Adapter { return adapter })
+
+	connectionID := uuid.New()
+	_, err := router.GetAdapter(context.Background(), connectionID, "postgres", ConnectionConfig{Host: "db", ReplicaHost: "replica"})
+	require.NoError(t, err)
+	require.NotNil(t, adapter.config.OnReplicaFallback)
+	adapter.config.OnReplicaFallback()
+	assert.Equal(t, []uuid.UUID{connectionID}, fallbacks)
+
+	_, err = router.GetAdapter(context.Background(), uuid.New(), "postgres", ConnectionConfig{Host: "db"})
+	require.NoError(t, err)
+	assert.Nil(t, adapter.config.OnReplicaFallback, "no hook without a replica")
+}
@@ -0,0 +1,96 @@
+package mcp
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SchemaOrder is how tables are ordered in schema DDL, which decides the tables kept
+// when it is truncated
+type SchemaOrder string
+
+const (
+	SchemaOrderSize         SchemaOrder = "size"         // largest first, by estimated rows
+	SchemaOrderAlphabetical SchemaOrder = "alphabetical" // by name
+	SchemaOrderRecent       SchemaOrder = "recent"       // recently queried first, then by size
+)
+
+// SchemaOptions controls the schema DDL of adapters implementing SchemaOrderer
+type SchemaOptions struct {
+	Order SchemaOrder // defaults to SchemaOrderSize
+	// PinnedTables come first, in order, unless tables are ordered alphabetically, so
+	// they are kept when the DDL is truncated
+	PinnedTables []string
+	// RecentTables are the tables queried recently, most recent first. They are
+	// matched case-insensitively, as unquoted names are.
+	RecentTables []string
+}
+
+// OrderTables orders table names following opts. rows holds the estimated row count
+// of the tables that have one; tables without an estimate sort after those with one.
+func OrderTables(tables []string, rows map[string]int64, opts SchemaOptions) []string {
+	ordered := slices.Clone(tables)
+	if opts.Order == SchemaOrderAlphabetical {
+		slices.Sort(ordered)
+		return ordered
+	}
+
+	// Pinned and recent tables rank ahead of the rest, in that order
+	priority := make(map[string]int)
+	rank := func(tables []string) {
+		for _, t := range tables {
+			if _, ok := priority[strings.ToLower(t)]; !ok {
+				priority[strings.ToLower(t)] = len(priority)
+			}
+		}
+	}
+	rank(opts.PinnedTables)
+	if opts.Order == SchemaOrderRecent {
+		rank(opts.RecentTables)
+	}
+	slices.SortFunc(ordered, func(a, b string) int {
+		pa, aRanked := priority[strings.ToLower(a)]
+		pb, bRanked := priority[strings.ToLower(b)]
+		switch {
+		case aRanked && bRanked:
+			return cmp.Compare(pa, pb)
+		case aRanked != bRanked:
+			if aRanked {
+				return -1
+			}
+			return 1
+		}
+		na, aKnown := rows[a]
+		nb, bKnown := rows[b]
+		if aKnown != bKnown {
+			if aKnown {
+				return -1
+			}
+			return 1
+		}
+		if c := cmp.Compare(nb, na); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+	return ordered
+}
+
+// RowCountComment renders an estimated row count as the comment after CREATE TABLE,
+// e.g. " -- ~1.2M rows"
+func RowCountComment(rows int64) string {
+	value := strconv.FormatInt(rows, 10)
+	for _, unit := range []struct {
+		size   float64
+		suffix string
+	}{{1e9, "B"}, {1e6, "M"}, {1e3, "K"}} {
+		if float64(rows) >= unit.size {
+			value = strings.TrimSuffix(strconv.FormatFloat(float64(rows)/unit.size, 'f', 1, 64), ".0") + unit.suffix
+			break
+		}
+	}
+	return fmt.Sprintf(" -- ~%s rows", value)
+}
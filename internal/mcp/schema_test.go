@@ -0,0 +1,39 @@
+package mcp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderTables(t *testing.T) {
+	tables := []string{"countries", "events", "orders", "users"}
+	rows := map[string]int64{"countries": 200, "events": 90_000_000, "orders": 1_200_000}
+
+	assert.Equal(t, []string{"events", "orders", "countries", "users"}, OrderTables(tables, rows, SchemaOptions{}))
+	assert.Equal(t, tables, OrderTables([]string{"users", "orders", "events", "countries"}, rows, SchemaOptions{Order: SchemaOrderAlphabetical}))
+	assert.Equal(t, []string{"users", "countries", "events", "orders"}, OrderTables(tables, rows, SchemaOptions{
+		Order:        SchemaOrderRecent,
+		RecentTables: []string{"Users", "countries", "users", "missing"},
+	}))
+	// Pinned tables lead both size and recent order, but not alphabetical order
+	assert.Equal(t, []string{"users", "countries", "events", "orders"}, OrderTables(tables, rows, SchemaOptions{
+		PinnedTables: []string{"users"},
+		Order:        SchemaOrderRecent,
+		RecentTables: []string{"countries"},
+	}))
+	assert.Equal(t, tables, OrderTables(tables, rows, SchemaOptions{Order: SchemaOrderAlphabetical, PinnedTables: []string{"users"}}))
+	// Recent tables only count in recent order
+	assert.Equal(t, []string{"events", "orders", "countries", "users"}, OrderTables(tables, rows, SchemaOptions{
+		Order:        SchemaOrderSize,
+		RecentTables: []string{"users"},
+	}))
+}
+
+func TestRowCountComment(t *testing.T) {
+	assert.Equal(t, " -- ~0 rows", RowCountComment(0))
+	assert.Equal(t, " -- ~850 rows", RowCountComment(850))
+	assert.Equal(t, " -- ~12K rows", RowCountComment(12_000))
+	assert.Equal(t, " -- ~1.2M rows", RowCountComment(1_234_567))
+	assert.Equal(t, " -- ~3.5B rows", RowCountComment(3_500_000_000))
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/mcp"
 	_ "modernc.org/sqlite"
@@ -14,13 +15,24 @@ import (
 type Adapter struct {
 	db       *sql.DB
 	database string
+	// root is the directory database files must be in; empty allows any file
+	root string
 }
 
-// NewAdapter creates a new SQLite adapter
+// NewAdapter creates a new SQLite adapter that opens database files anywhere, for
+// tests and tools; the server uses NewAdapterFactory
 func NewAdapter() mcp.Adapter {
 	return &Adapter{}
 }
 
+// NewAdapterFactory returns a factory of SQLite adapters that only open database files
+// inside root, as ResolvePath checks them
+func NewAdapterFactory(root string) mcp.AdapterFactory {
+	return func() mcp.Adapter {
+		return &Adapter{root: root}
+	}
+}
+
 // DatabaseType returns the database type identifier
 func (a *Adapter) DatabaseType() string {
 	return "sqlite"
@@ -28,7 +40,11 @@ func (a *Adapter) DatabaseType() string {
 
 // SQLDialect returns SQL dialect hints for LLM prompting
 func (a *Adapter) SQLDialect() string {
-	return `SQLite SQL dialect:
+	return Dialect
+}
+
+// Dialect holds the SQL dialect hints given to the LLM, which need no connection
+const Dialect = `SQLite SQL dialect:
 - Use double quotes for identifiers: "column_name"
 - String concatenation: || operator (e.g., col1 || ' ' || col2)
 - Case-insensitive matching: LIKE (case-insensitive by default for ASCII)
@@ -46,7 +62,6 @@ func (a *Adapter) SQLDialect() string {
 - typeof() function to check value types
 - No RIGHT JOIN or FULL OUTER JOIN support (use LEFT JOIN alternatives)
 - Use EXPLAIN QUERY PLAN for query analysis`
-}
 
 // Connect establishes connection to SQLite database file
 func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error {
@@ -55,6 +70,14 @@ func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) erro
 	if dbPath == "" {
 		return fmt.Errorf("database file path is required")
 	}
+	if a.root != "" {
+		resolved, err := ResolvePath(a.root, dbPath)
+		if err != nil {
+			return err
+		}
+		// The resolved path, so a symlink swapped after the check is not followed
+		dbPath = resolved
+	}
 
 	// Open with read-only mode and other pragmas via DSN
 	dsn := fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", dbPath)
@@ -123,7 +146,14 @@ func (a *Adapter) ListTables(ctx context.Context) ([]string, error) {
 
 // DescribeTable returns detailed table schema
 func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.TableInfo, error) {
-	rows, err := a.db.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info('%s')", tableName))
+	quoted, err := mcp.QuoteIdentifier(tableName, mcp.QuoteDouble)
+	if err != nil {
+		return nil, fmt.Errorf("invalid table name: %w", err)
+	}
+
+	// The table-valued form of the pragma takes the name as a bound parameter
+	rows, err := a.db.QueryContext(ctx,
+		`SELECT cid, name, type, "notnull", dflt_value, pk FROM pragma_table_info(?)`, tableName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to describe table: %w", err)
 	}
@@ -154,7 +184,7 @@ func (a *Adapter) DescribeTable(ctx context.Context, tableName string) (*mcp.Tab
 
 	// Get row count
 	var rowCount int64
-	err = a.db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM \"%s\"", tableName)).Scan(&rowCount)
+	err = a.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quoted).Scan(&rowCount)
 
 	var rowCountPtr *int64
 	if err == nil && rowCount >= 0 {
@@ -199,17 +229,42 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 
 // ValidateQuery validates SQL is safe to execute
 func (a *Adapter) ValidateQuery(sql string) error {
-	return mcp.ValidateSQL(sql, mcp.SqliteBlockedPatterns)
+	return mcp.ValidateSQL(sql, mcp.DialectStandard, mcp.SqliteBlockedPatterns)
+}
+
+// PageQuery returns the rows of page with LIMIT and OFFSET, or a keyset predicate
+func (a *Adapter) PageQuery(sql string, page mcp.Page) (string, error) {
+	return mcp.LimitOffsetPage(sql, page, mcp.QuoteDouble)
 }
 
 // ExecuteQuery executes read-only SQL query
 func (a *Adapter) ExecuteQuery(ctx context.Context, sqlStr string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sqlStr, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sqlStr, nil, opts)
+	})
+}
+
+// Placeholder returns the placeholder of the n-th query parameter
+func (a *Adapter) Placeholder(n int, _ mcp.ParamType) string {
+	return "?"
+}
+
+// ExecuteQueryWithParams executes read-only SQL with ? placeholders bound to params
+func (a *Adapter) ExecuteQueryWithParams(ctx context.Context, sqlStr string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sqlStr, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sqlStr, sqliteArgs(params), opts)
+	})
+}
+
+// executeQuery validates, limits and runs the query with args bound to its placeholders
+func (a *Adapter) executeQuery(ctx context.Context, sqlStr string, args []any, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
 	if err := a.ValidateQuery(sqlStr); err != nil {
 		return nil, err
 	}
 
-	// Enforce LIMIT
-	sqlStr = mcp.EnforceLimit(sqlStr, opts.MaxRows, "LIMIT")
+	// Enforce LIMIT, one row past the limit so truncation can be detected
+	limit, defaultApplied := opts.RowLimit(mcp.HasLimit(sqlStr))
+	sqlStr = mcp.EnforceLimit(sqlStr, limit+1, "LIMIT")
 
 	// Create context with timeout
 	if opts.Timeout > 0 {
@@ -218,7 +273,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sqlStr string, opts mcp.Quer
 		defer cancel()
 	}
 
-	rows, err := a.db.QueryContext(ctx, sqlStr)
+	rows, err := a.db.QueryContext(ctx, sqlStr, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -252,7 +307,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sqlStr string, opts mcp.Quer
 
 		resultRows = append(resultRows, values)
 
-		if len(resultRows) > opts.MaxRows {
+		if len(resultRows) > limit {
 			break
 		}
 	}
@@ -261,15 +316,34 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sqlStr string, opts mcp.Quer
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	truncated := len(resultRows) > opts.MaxRows
+	truncated := len(resultRows) > limit
 	if truncated {
-		resultRows = resultRows[:opts.MaxRows]
+		resultRows = resultRows[:limit]
 	}
 
 	return &mcp.QueryResult{
-		Columns:   columns,
-		Rows:      resultRows,
-		RowCount:  len(resultRows),
-		Truncated: truncated,
+		Columns:             columns,
+		Rows:                resultRows,
+		RowCount:            len(resultRows),
+		Truncated:           truncated,
+		DefaultLimitApplied: defaultApplied,
 	}, nil
 }
+
+// sqliteArgs returns the values of params, with dates and timestamps as the text
+// SQLite's date functions compare against
+func sqliteArgs(params []mcp.QueryParam) []any {
+	args := mcp.ParamValues(params)
+	for i, p := range params {
+		t, ok := p.Value.(time.Time)
+		if !ok {
+			continue
+		}
+		if p.Type == mcp.ParamDate {
+			args[i] = t.Format(time.DateOnly)
+		} else {
+			args[i] = t.UTC().Format(time.DateTime)
+		}
+	}
+	return args
+}
@@ -0,0 +1,75 @@
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/mcp/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAdapter(t *testing.T) mcp.Adapter {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, email TEXT NOT NULL);
+		CREATE TABLE x (id INTEGER);
+		CREATE TABLE "we""ird" (id INTEGER);
+		INSERT INTO users (email) VALUES ('a@example.com'), ('b@example.com');
+		INSERT INTO "we""ird" VALUES (1);
+	`)
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	adapter := sqlite.NewAdapter()
+	require.NoError(t, adapter.Connect(context.Background(), mcp.ConnectionConfig{Database: path}))
+	t.Cleanup(func() { adapter.Close() })
+	return adapter
+}
+
+func TestDescribeTable(t *testing.T) {
+	adapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	info, err := adapter.DescribeTable(ctx, "users")
+	require.NoError(t, err)
+	assert.Len(t, info.Columns, 2)
+	assert.True(t, info.Columns[0].PrimaryKey)
+	assert.False(t, info.Columns[1].Nullable)
+	require.NotNil(t, info.RowCount)
+	assert.Equal(t, int64(2), *info.RowCount)
+
+	// Embedded quotes are doubled rather than breaking out of the identifier
+	info, err = adapter.DescribeTable(ctx, `we"ird`)
+	require.NoError(t, err)
+	require.NotNil(t, info.RowCount)
+	assert.Equal(t, int64(1), *info.RowCount)
+}
+
+func TestDescribeTable_InjectionAttempts(t *testing.T) {
+	adapter := newTestAdapter(t)
+	ctx := context.Background()
+
+	for _, name := range []string{
+		`users"); DROP TABLE x;--`,
+		`users'); DROP TABLE x;--`,
+		`x" ; DROP TABLE users; --`,
+		"users\x00",
+		"",
+	} {
+		_, err := adapter.DescribeTable(ctx, name)
+		assert.Error(t, err, name)
+	}
+
+	tables, err := adapter.ListTables(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, tables, "users")
+	assert.Contains(t, tables, "x")
+}
@@ -0,0 +1,38 @@
+//go:build contract
+
+package sqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/mcp/mcptest"
+	"github.com/Rrens/text-to-sql/internal/mcp/sqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContract(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "contract.db")
+
+	db, err := sql.Open("sqlite", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	mcptest.Run(t, mcptest.Target{
+		Adapter: sqlite.NewAdapter(),
+		Config:  mcp.ConnectionConfig{Database: path},
+		Exec: func(ctx context.Context, stmt string) error {
+			_, err := db.ExecContext(ctx, stmt)
+			return err
+		},
+		CreateTables: []string{
+			// Only a NOT NULL column is reported as such, primary key or not
+			`CREATE TABLE contract_customers (id INTEGER NOT NULL PRIMARY KEY, name TEXT NOT NULL, email TEXT)`,
+			`CREATE TABLE contract_orders (id INTEGER NOT NULL PRIMARY KEY, customer_id INTEGER NOT NULL,
+				total REAL NOT NULL, note TEXT)`,
+		},
+	})
+}
@@ -0,0 +1,75 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Extensions are the file extensions of the SQLite databases that can be opened
+var Extensions = []string{".db", ".sqlite", ".sqlite3", ".db3"}
+
+// ErrPathNotAllowed is returned for database paths outside the SQLite root
+var ErrPathNotAllowed = errors.New("sqlite database must be a .db, .sqlite, .sqlite3 or .db3 file in the upload directory")
+
+// ResolvePath returns the real path of the database file path once symlinks are
+// followed. It must be an existing file with one of Extensions inside root, and name
+// no parent directory. Relative paths are relative to the working directory, the
+// same as the adapter opens them.
+func ResolvePath(root, path string) (string, error) {
+	if root == "" {
+		return "", errors.New("sqlite connections are disabled: no upload directory is configured")
+	}
+	if path == "" {
+		return "", errors.New("database file path is required")
+	}
+	// ? and # would start the query or fragment of the file: URI the adapter opens
+	if strings.ContainsAny(path, "?#") || slices.Contains(strings.Split(filepath.ToSlash(path), "/"), "..") {
+		return "", ErrPathNotAllowed
+	}
+	if !slices.Contains(Extensions, strings.ToLower(filepath.Ext(path))) {
+		return "", ErrPathNotAllowed
+	}
+
+	realRoot, err := realPath(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve upload directory: %w", err)
+	}
+	realFile, err := realPath(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("database file not found: %s", path)
+		}
+		return "", fmt.Errorf("failed to resolve database file: %w", err)
+	}
+
+	// Checked again on the target, so a symlink inside the root cannot lead out of it
+	// or to a file of another kind
+	rel, err := filepath.Rel(realRoot, realFile)
+	if err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return "", ErrPathNotAllowed
+	}
+	if !slices.Contains(Extensions, strings.ToLower(filepath.Ext(realFile))) {
+		return "", ErrPathNotAllowed
+	}
+	info, err := os.Stat(realFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve database file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", ErrPathNotAllowed
+	}
+	return realFile, nil
+}
+
+// realPath returns the absolute path of path with every symlink followed
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
@@ -0,0 +1,84 @@
+package sqlite_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/mcp/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	inside := filepath.Join(root, "sales.db")
+	require.NoError(t, os.WriteFile(inside, nil, 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "nested.sqlite"), nil, 0o644))
+	secret := filepath.Join(outside, "secret.db")
+	require.NoError(t, os.WriteFile(secret, nil, 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, ".env"), nil, 0o644))
+
+	// A symlink inside the root leading out of it, and one to a file of another kind
+	require.NoError(t, os.Symlink(secret, filepath.Join(root, "escape.db")))
+	require.NoError(t, os.Symlink(filepath.Join(root, ".env"), filepath.Join(root, "env.db")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(root, "out")))
+	// A symlink inside the root to a database in it is followed
+	require.NoError(t, os.Symlink(inside, filepath.Join(root, "alias.db")))
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	require.NoError(t, err)
+
+	for _, path := range []string{inside, filepath.Join(root, "alias.db")} {
+		got, err := sqlite.ResolvePath(root, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, filepath.Join(realRoot, "sales.db"), got)
+	}
+	got, err := sqlite.ResolvePath(root, filepath.Join(root, "sub", "nested.sqlite"))
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(realRoot, "sub", "nested.sqlite"), got)
+
+	for name, path := range map[string]string{
+		"outside the root":       secret,
+		"system file":            "/etc/passwd",
+		"traversal":              root + "/../" + filepath.Base(outside) + "/secret.db",
+		"traversal back in":      root + "/sub/../sales.db",
+		"symlink out":            filepath.Join(root, "escape.db"),
+		"symlink to other file":  filepath.Join(root, "env.db"),
+		"symlinked directory":    filepath.Join(root, "out", "secret.db"),
+		"wrong extension":        filepath.Join(root, ".env"),
+		"the root itself":        root,
+		"uri query":              inside + "?mode=rwc",
+		"uri query before .db":   filepath.Join(root, "x?_pragma=foo.db"),
+		"missing file":           filepath.Join(root, "missing.db"),
+		"relative outside cwd":   "../secret.db",
+		"empty":                  "",
+		"directory with db name": filepath.Join(root, "sub"),
+	} {
+		_, err := sqlite.ResolvePath(root, path)
+		assert.Error(t, err, name)
+	}
+
+	_, err = sqlite.ResolvePath("", inside)
+	assert.ErrorContains(t, err, "no upload directory")
+}
+
+func TestNewAdapterFactory(t *testing.T) {
+	root := t.TempDir()
+	secret := filepath.Join(t.TempDir(), "secret.db")
+	require.NoError(t, os.WriteFile(secret, nil, 0o644))
+	require.NoError(t, os.Symlink(secret, filepath.Join(root, "link.db")))
+
+	adapter := sqlite.NewAdapterFactory(root)()
+	err := adapter.Connect(context.Background(), mcp.ConnectionConfig{Database: filepath.Join(root, "link.db")})
+	assert.ErrorIs(t, err, sqlite.ErrPathNotAllowed)
+
+	inside := filepath.Join(root, "app.db")
+	require.NoError(t, os.WriteFile(inside, nil, 0o644))
+	require.NoError(t, adapter.Connect(context.Background(), mcp.ConnectionConfig{Database: inside}))
+	adapter.Close()
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
 	_ "github.com/microsoft/go-mssqldb"
 )
 
@@ -28,7 +31,11 @@ func (a *Adapter) DatabaseType() string {
 
 // SQLDialect returns SQL dialect hints for LLM prompting
 func (a *Adapter) SQLDialect() string {
-	return `T-SQL (SQL Server) dialect:
+	return Dialect
+}
+
+// Dialect holds the SQL dialect hints given to the LLM, which need no connection
+const Dialect = `T-SQL (SQL Server) dialect:
 - Use square brackets for identifiers: [column_name]
 - String concatenation: CONCAT(a, b) or a + b
 - Case-insensitive matching: LIKE (SQL Server is case-insensitive by default with most collations)
@@ -46,7 +53,6 @@ func (a *Adapter) SQLDialect() string {
 - Common Table Expressions (WITH) are supported
 - Use SET NOCOUNT ON to suppress row count messages
 - Use EXPLAIN → SET SHOWPLAN_TEXT ON for query analysis`
-}
 
 // Connect establishes connection to SQL Server
 func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) error {
@@ -73,15 +79,14 @@ func (a *Adapter) Connect(ctx context.Context, config mcp.ConnectionConfig) erro
 
 	db, err := sql.Open("sqlserver", dsn)
 	if err != nil {
-		return fmt.Errorf("failed to open connection: %w", err)
+		return security.Redact(fmt.Errorf("failed to open connection: %w", err), config.Password)
 	}
 
-	db.SetMaxOpenConns(5)
-	db.SetMaxIdleConns(1)
+	config.Pool.ConfigureDB(db)
 
 	if err := db.PingContext(ctx); err != nil {
 		db.Close()
-		return fmt.Errorf("failed to ping: %w", err)
+		return security.Redact(fmt.Errorf("failed to ping: %w", err), config.Password)
 	}
 
 	a.db = db
@@ -99,6 +104,14 @@ func (a *Adapter) Close() error {
 	return nil
 }
 
+// PoolStats reports the connection pool
+func (a *Adapter) PoolStats() (domain.PoolStats, bool) {
+	if a.db == nil {
+		return domain.PoolStats{}, false
+	}
+	return mcp.DBPoolStats(a.db), true
+}
+
 // HealthCheck verifies connection is alive
 func (a *Adapter) HealthCheck(ctx context.Context) error {
 	if a.db == nil {
@@ -274,17 +287,37 @@ func (a *Adapter) GetSchemaDDL(ctx context.Context) (string, error) {
 
 // ValidateQuery validates SQL is safe to execute
 func (a *Adapter) ValidateQuery(sql string) error {
-	return mcp.ValidateSQL(sql, mcp.SqlserverBlockedPatterns)
+	return mcp.ValidateSQL(sql, mcp.DialectStandard, mcp.SqlserverBlockedPatterns)
 }
 
 // ExecuteQuery executes read-only SQL query
 func (a *Adapter) ExecuteQuery(ctx context.Context, sqlQuery string, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sqlQuery, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sqlQuery, nil, opts)
+	})
+}
+
+// Placeholder returns the placeholder of the n-th query parameter
+func (a *Adapter) Placeholder(n int, _ mcp.ParamType) string {
+	return "@p" + strconv.Itoa(n)
+}
+
+// ExecuteQueryWithParams executes read-only SQL with @pN placeholders bound to params
+func (a *Adapter) ExecuteQueryWithParams(ctx context.Context, sqlQuery string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	return mcp.TraceQuery(ctx, a.DatabaseType(), sqlQuery, func(ctx context.Context) (*mcp.QueryResult, error) {
+		return a.executeQuery(ctx, sqlQuery, mcp.ParamValues(params), opts)
+	})
+}
+
+// executeQuery validates, limits and runs the query with args bound to its placeholders
+func (a *Adapter) executeQuery(ctx context.Context, sqlQuery string, args []any, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
 	if err := a.ValidateQuery(sqlQuery); err != nil {
 		return nil, err
 	}
 
-	// SQL Server uses TOP instead of LIMIT
-	sqlQuery = enforceSQLServerLimit(sqlQuery, opts.MaxRows)
+	// SQL Server uses TOP instead of LIMIT, one row past the limit so truncation can be detected
+	limit, defaultApplied := opts.RowLimit(hasSQLServerLimit(sqlQuery))
+	sqlQuery = enforceSQLServerLimit(sqlQuery, limit+1)
 
 	// Create context with timeout
 	if opts.Timeout > 0 {
@@ -293,7 +326,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sqlQuery string, opts mcp.Qu
 		defer cancel()
 	}
 
-	rows, err := a.db.QueryContext(ctx, sqlQuery)
+	rows, err := a.db.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query failed: %w", err)
 	}
@@ -327,7 +360,7 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sqlQuery string, opts mcp.Qu
 
 		resultRows = append(resultRows, values)
 
-		if len(resultRows) > opts.MaxRows {
+		if len(resultRows) > limit {
 			break
 		}
 	}
@@ -336,27 +369,23 @@ func (a *Adapter) ExecuteQuery(ctx context.Context, sqlQuery string, opts mcp.Qu
 		return nil, fmt.Errorf("row iteration error: %w", err)
 	}
 
-	truncated := len(resultRows) > opts.MaxRows
+	truncated := len(resultRows) > limit
 	if truncated {
-		resultRows = resultRows[:opts.MaxRows]
+		resultRows = resultRows[:limit]
 	}
 
 	return &mcp.QueryResult{
-		Columns:   columns,
-		Rows:      resultRows,
-		RowCount:  len(resultRows),
-		Truncated: truncated,
+		Columns:             columns,
+		Rows:                resultRows,
+		RowCount:            len(resultRows),
+		Truncated:           truncated,
+		DefaultLimitApplied: defaultApplied,
 	}, nil
 }
 
 // enforceSQLServerLimit ensures the query has a TOP clause if no OFFSET/FETCH or TOP is present
 func enforceSQLServerLimit(sqlQuery string, maxRows int) string {
-	normalized := strings.ToUpper(sqlQuery)
-
-	// Check if TOP, OFFSET, or FETCH already exists
-	if strings.Contains(normalized, "TOP") ||
-		strings.Contains(normalized, "OFFSET") ||
-		strings.Contains(normalized, "FETCH") {
+	if hasSQLServerLimit(sqlQuery) {
 		return sqlQuery
 	}
 
@@ -366,3 +395,11 @@ func enforceSQLServerLimit(sqlQuery string, maxRows int) string {
 	// Wrap in SELECT TOP N * FROM (original query)
 	return fmt.Sprintf("SELECT TOP %d * FROM (%s) AS __limited", maxRows, sqlQuery)
 }
+
+// hasSQLServerLimit reports whether the query limits its rows with TOP or OFFSET/FETCH
+func hasSQLServerLimit(sqlQuery string) bool {
+	normalized := strings.ToUpper(sqlQuery)
+	return strings.Contains(normalized, "TOP") ||
+		strings.Contains(normalized, "OFFSET") ||
+		strings.Contains(normalized, "FETCH")
+}
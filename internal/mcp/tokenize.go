@@ -0,0 +1,150 @@
+package mcp
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Dialect selects the quoting rules of a database's SQL
+type Dialect byte
+
+// Dialects with quoting rules beyond doubled quotes
+const (
+	DialectStandard   Dialect = iota
+	DialectPostgres           // $tag$ dollar-quoted strings
+	DialectMySQL              // backslash escapes; double quotes delimit strings
+	DialectClickHouse         // backslash escapes in strings and quoted names
+)
+
+// dollarTag matches the opening delimiter of a Postgres dollar-quoted string
+var dollarTag = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+// TokenKind classifies a lexical token of SQL
+type TokenKind byte
+
+// Token kinds
+const (
+	TokenWord       TokenKind = 'w' // keyword or unquoted name
+	TokenString     TokenKind = 's' // string literal, quotes included
+	TokenNumber     TokenKind = 'n'
+	TokenIdentifier TokenKind = 'i' // quoted name, quotes excluded
+	TokenPunct      TokenKind = 'p' // punctuation or operator
+)
+
+// Token is a lexical token of SQL with its byte range in the query
+type Token struct {
+	Kind       TokenKind
+	Text       string
+	Start, End int
+}
+
+// Tokenize splits SQL into tokens of the dialect, dropping whitespace and comments
+func Tokenize(sql string, dialect Dialect) []Token {
+	var tokens []Token
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		start := i
+		switch {
+		case unicode.IsSpace(rune(c)):
+			i++
+			continue
+		case strings.HasPrefix(sql[i:], "--"):
+			if end := strings.IndexByte(sql[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(sql)
+			}
+			continue
+		case strings.HasPrefix(sql[i:], "/*"):
+			if end := strings.Index(sql[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(sql)
+			}
+			continue
+		case c == '\'' || c == '"' && dialect == DialectMySQL:
+			i = StringLiteralEnd(sql, i, dialect)
+			tokens = append(tokens, Token{Kind: TokenString, Text: sql[start:i], Start: start, End: i})
+		case c == '$' && dialect == DialectPostgres && dollarTag.MatchString(sql[i:]):
+			tag := dollarTag.FindString(sql[i:])
+			if end := strings.Index(sql[i+len(tag):], tag); end >= 0 {
+				i += len(tag) + end + len(tag)
+			} else {
+				i = len(sql)
+			}
+			tokens = append(tokens, Token{Kind: TokenString, Text: sql[start:i], Start: start, End: i})
+		case (c == '"' || c == '`') && dialect == DialectClickHouse:
+			i = StringLiteralEnd(sql, i, dialect)
+			tokens = append(tokens, Token{Kind: TokenIdentifier, Text: sql[start+1 : max(start+1, i-1)], Start: start, End: i})
+		case c == '"' || c == '`' || c == '[':
+			closing := map[byte]byte{'"': '"', '`': '`', '[': ']'}[c]
+			if end := strings.IndexByte(sql[i+1:], closing); end >= 0 {
+				i += end + 2
+			} else {
+				i = len(sql)
+			}
+			tokens = append(tokens, Token{Kind: TokenIdentifier, Text: sql[start+1 : max(start+1, i-1)], Start: start, End: i})
+		case c >= '0' && c <= '9':
+			for i < len(sql) && (sql[i] >= '0' && sql[i] <= '9' || sql[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenNumber, Text: sql[start:i], Start: start, End: i})
+		case c == '_' || c == '$' || c == '@' || unicode.IsLetter(rune(c)) || c >= 0x80:
+			for i < len(sql) && (sql[i] == '_' || sql[i] == '$' || sql[i] == '@' || sql[i] >= 0x80 ||
+				unicode.IsLetter(rune(sql[i])) || sql[i] >= '0' && sql[i] <= '9') {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenWord, Text: sql[start:i], Start: start, End: i})
+		case strings.ContainsRune("<>!=", rune(c)):
+			for i < len(sql) && strings.ContainsRune("<>!=", rune(sql[i])) {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: TokenPunct, Text: sql[start:i], Start: start, End: i})
+		default:
+			i++
+			tokens = append(tokens, Token{Kind: TokenPunct, Text: sql[start:i], Start: start, End: i})
+		}
+	}
+	return tokens
+}
+
+// StringLiteralEnd returns the offset after the literal starting with the quote at
+// start, where a doubled quote is an escaped quote. In MySQL and ClickHouse a
+// backslash escapes the next character as well.
+func StringLiteralEnd(sql string, start int, dialect Dialect) int {
+	quote := sql[start]
+	backslash := dialect == DialectMySQL || dialect == DialectClickHouse
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case sql[i] == '\\' && backslash:
+			i++
+		case sql[i] != quote:
+		case i+1 < len(sql) && sql[i+1] == quote:
+			i++
+		default:
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// SplitStatements splits tokens into statements at semicolons outside literals and
+// comments. Empty statements, such as after a trailing semicolon, are dropped.
+func SplitStatements(tokens []Token) [][]Token {
+	var statements [][]Token
+	start := 0
+	for i, tok := range tokens {
+		if tok.Kind != TokenPunct || tok.Text != ";" {
+			continue
+		}
+		if i > start {
+			statements = append(statements, tokens[start:i])
+		}
+		start = i + 1
+	}
+	if start < len(tokens) {
+		statements = append(statements, tokens[start:])
+	}
+	return statements
+}
@@ -0,0 +1,33 @@
+package mcp_test
+
+import (
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"one statement", "SELECT 1", []string{"SELECT 1"}},
+		{"trailing semicolon", "SELECT 1;  ", []string{"SELECT 1"}},
+		{"two statements", "SELECT 1; SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"empty statements", ";SELECT 1;;", []string{"SELECT 1"}},
+		{"literal", "SELECT 'it''s; fine'; SELECT 2", []string{"SELECT 'it''s; fine'", "SELECT 2"}},
+		{"comments", "SELECT 1 -- a; b\n/* c; d */;", []string{"SELECT 1"}},
+		{"only comments", "-- nothing; here", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, statement := range mcp.SplitStatements(mcp.Tokenize(tt.sql, mcp.DialectStandard)) {
+				got = append(got, tt.sql[statement[0].Start:statement[len(statement)-1].End])
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
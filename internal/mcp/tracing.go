@@ -0,0 +1,33 @@
+package mcp
+
+import (
+	"context"
+
+	"github.com/Rrens/text-to-sql/internal/observability"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxTracedStatement caps the query text recorded on spans
+const maxTracedStatement = 2048
+
+// TraceQuery runs an adapter's query execution inside a span carrying the database type,
+// statement and row count
+func TraceQuery(ctx context.Context, dbType, statement string, execute func(ctx context.Context) (*QueryResult, error)) (*QueryResult, error) {
+	if len(statement) > maxTracedStatement {
+		statement = statement[:maxTracedStatement]
+	}
+	ctx, span := observability.StartSpan(ctx, dbType+".query",
+		attribute.String("db.system", dbType),
+		attribute.String("db.query.text", statement),
+	)
+
+	result, err := execute(ctx)
+	if result != nil {
+		span.SetAttributes(
+			attribute.Int("db.response.returned_rows", result.RowCount),
+			attribute.Bool("db.response.truncated", result.Truncated),
+		)
+	}
+	observability.EndSpan(span, err)
+	return result, err
+}
@@ -4,115 +4,171 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
+// BlockedPattern rejects queries matching Pattern, reporting Rule as the reason
+type BlockedPattern struct {
+	Rule    string
+	Pattern *regexp.Regexp
+}
+
+// keyword blocks a statement keyword anywhere in the query
+func keyword(name string) BlockedPattern {
+	return BlockedPattern{
+		Rule:    name + " keyword found",
+		Pattern: regexp.MustCompile(`(?i)\b` + strings.ReplaceAll(name, " ", `\s+`) + `\b`),
+	}
+}
+
+// dialect blocks a database-specific function or statement
+func dialect(database, name, pattern string) BlockedPattern {
+	return BlockedPattern{Rule: database + ": " + name + " blocked", Pattern: regexp.MustCompile(pattern)}
+}
+
 // Common blocked SQL patterns across all databases
-var blockedPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)\bINSERT\b`),
-	regexp.MustCompile(`(?i)\bUPDATE\b`),
-	regexp.MustCompile(`(?i)\bDELETE\b`),
-	regexp.MustCompile(`(?i)\bDROP\b`),
-	regexp.MustCompile(`(?i)\bTRUNCATE\b`),
-	regexp.MustCompile(`(?i)\bALTER\b`),
-	regexp.MustCompile(`(?i)\bCREATE\b`),
-	regexp.MustCompile(`(?i)\bGRANT\b`),
-	regexp.MustCompile(`(?i)\bREVOKE\b`),
-	regexp.MustCompile(`(?i)\bEXEC\b`),
-	regexp.MustCompile(`(?i)\bEXECUTE\b`),
-	regexp.MustCompile(`(?i)\bINTO\s+OUTFILE\b`),
-	regexp.MustCompile(`(?i)\bINTO\s+DUMPFILE\b`),
-	regexp.MustCompile(`(?i)\bLOAD_FILE\b`),
-	regexp.MustCompile(`(?i)\bLOAD\s+DATA\b`),
+var blockedPatterns = []BlockedPattern{
+	keyword("INSERT"),
+	keyword("UPDATE"),
+	keyword("DELETE"),
+	keyword("DROP"),
+	keyword("TRUNCATE"),
+	keyword("ALTER"),
+	keyword("CREATE"),
+	keyword("GRANT"),
+	keyword("REVOKE"),
+	keyword("EXEC"),
+	keyword("EXECUTE"),
+	keyword("INTO OUTFILE"),
+	keyword("INTO DUMPFILE"),
+	keyword("LOAD_FILE"),
+	keyword("LOAD DATA"),
 }
 
 // PostgreSQL specific blocked patterns
-var PostgresBlockedPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)pg_read_file`),
-	regexp.MustCompile(`(?i)pg_write_file`),
-	regexp.MustCompile(`(?i)pg_ls_dir`),
-	regexp.MustCompile(`(?i)lo_import`),
-	regexp.MustCompile(`(?i)lo_export`),
-	regexp.MustCompile(`(?i)\bCOPY\b`),
-	regexp.MustCompile(`(?i)dblink`),
+var PostgresBlockedPatterns = []BlockedPattern{
+	dialect("postgres", "pg_read_file", `(?i)pg_read_file`),
+	dialect("postgres", "pg_write_file", `(?i)pg_write_file`),
+	dialect("postgres", "pg_ls_dir", `(?i)pg_ls_dir`),
+	dialect("postgres", "lo_import", `(?i)lo_import`),
+	dialect("postgres", "lo_export", `(?i)lo_export`),
+	dialect("postgres", "COPY", `(?i)\bCOPY\b`),
+	dialect("postgres", "dblink", `(?i)dblink`),
 }
 
 // ClickHouse specific blocked patterns
-var ClickhouseBlockedPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)file\s*\(`),
-	regexp.MustCompile(`(?i)url\s*\(`),
-	regexp.MustCompile(`(?i)remote\s*\(`),
-	regexp.MustCompile(`(?i)mysql\s*\(`),
-	regexp.MustCompile(`(?i)postgresql\s*\(`),
+var ClickhouseBlockedPatterns = []BlockedPattern{
+	dialect("clickhouse", "file()", `(?i)file\s*\(`),
+	dialect("clickhouse", "url()", `(?i)url\s*\(`),
+	dialect("clickhouse", "remote()", `(?i)remote\s*\(`),
+	dialect("clickhouse", "mysql()", `(?i)mysql\s*\(`),
+	dialect("clickhouse", "postgresql()", `(?i)postgresql\s*\(`),
+	dialect("clickhouse", "remoteSecure()", `(?i)\bremoteSecure\s*\(`),
+	dialect("clickhouse", "cluster()", `(?i)\bcluster(AllReplicas)?\s*\(`),
+	dialect("clickhouse", "s3()", `(?i)\bs3(Cluster)?\s*\(`),
+	dialect("clickhouse", "gcs()", `(?i)\bgcs\s*\(`),
+	dialect("clickhouse", "azureBlobStorage()", `(?i)\bazureBlobStorage(Cluster)?\s*\(`),
+	dialect("clickhouse", "hdfs()", `(?i)\bhdfs(Cluster)?\s*\(`),
+	dialect("clickhouse", "jdbc()", `(?i)\bjdbc\s*\(`),
+	dialect("clickhouse", "odbc()", `(?i)\bodbc\s*\(`),
+	dialect("clickhouse", "mongodb()", `(?i)\bmongodb\s*\(`),
+	dialect("clickhouse", "redis()", `(?i)\bredis\s*\(`),
+	dialect("clickhouse", "sqlite()", `(?i)\bsqlite\s*\(`),
+	dialect("clickhouse", "executable()", `(?i)\bexecutable\s*\(`),
+	dialect("clickhouse", "input()", `(?i)\binput\s*\(`),
 }
 
 // MySQL specific blocked patterns
-var MysqlBlockedPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)LOAD_FILE`),
-	regexp.MustCompile(`(?i)INTO\s+OUTFILE`),
-	regexp.MustCompile(`(?i)INTO\s+DUMPFILE`),
+var MysqlBlockedPatterns = []BlockedPattern{
+	dialect("mysql", "LOAD_FILE", `(?i)LOAD_FILE`),
+	dialect("mysql", "INTO OUTFILE", `(?i)INTO\s+OUTFILE`),
+	dialect("mysql", "INTO DUMPFILE", `(?i)INTO\s+DUMPFILE`),
 }
 
 // SQLite specific blocked patterns
-var SqliteBlockedPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)\bATTACH\b`),
-	regexp.MustCompile(`(?i)\bDETACH\b`),
-	regexp.MustCompile(`(?i)load_extension`),
+var SqliteBlockedPatterns = []BlockedPattern{
+	dialect("sqlite", "ATTACH", `(?i)\bATTACH\b`),
+	dialect("sqlite", "DETACH", `(?i)\bDETACH\b`),
+	dialect("sqlite", "load_extension", `(?i)load_extension`),
 }
 
 // SQL Server specific blocked patterns
-var SqlserverBlockedPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)xp_cmdshell`),
-	regexp.MustCompile(`(?i)sp_OACreate`),
-	regexp.MustCompile(`(?i)\bOPENROWSET\b`),
-	regexp.MustCompile(`(?i)\bOPENDATASOURCE\b`),
-	regexp.MustCompile(`(?i)\bBULK\s+INSERT\b`),
-	regexp.MustCompile(`(?i)xp_regread`),
-	regexp.MustCompile(`(?i)sp_configure`),
-	regexp.MustCompile(`(?i)xp_fileexist`),
-	regexp.MustCompile(`(?i)xp_dirtree`),
+var SqlserverBlockedPatterns = []BlockedPattern{
+	dialect("sqlserver", "xp_cmdshell", `(?i)xp_cmdshell`),
+	dialect("sqlserver", "sp_OACreate", `(?i)sp_OACreate`),
+	dialect("sqlserver", "OPENROWSET", `(?i)\bOPENROWSET\b`),
+	dialect("sqlserver", "OPENDATASOURCE", `(?i)\bOPENDATASOURCE\b`),
+	dialect("sqlserver", "BULK INSERT", `(?i)\bBULK\s+INSERT\b`),
+	dialect("sqlserver", "xp_regread", `(?i)xp_regread`),
+	dialect("sqlserver", "sp_configure", `(?i)sp_configure`),
+	dialect("sqlserver", "xp_fileexist", `(?i)xp_fileexist`),
+	dialect("sqlserver", "xp_dirtree", `(?i)xp_dirtree`),
+}
+
+// Rules reported for queries rejected by their shape rather than a pattern
+const (
+	RuleEmpty              = "query is empty"
+	RuleMultipleStatements = "only one statement allowed"
+	RuleSelectOnly         = "statement must start with SELECT"
+)
+
+// ValidationError explains why a query was rejected
+type ValidationError struct {
+	Rule     string // e.g. "INSERT keyword found" or "postgres: pg_read_file blocked"
+	Matched  string // the offending snippet, empty when the rule is about the whole query
+	Position int    // byte offset of Matched in the query
 }
 
-// ValidateSQL validates SQL for safety
-func ValidateSQL(sql string, additionalPatterns []*regexp.Regexp) error {
+func (e *ValidationError) Error() string {
+	if e.Matched == "" {
+		return "query blocked: " + e.Rule
+	}
+	return fmt.Sprintf("query blocked: %s (%q at position %d)", e.Rule, e.Matched, e.Position)
+}
+
+// ValidateSQL validates SQL of the dialect for safety, returning a *ValidationError
+// naming the rule that rejected it
+func ValidateSQL(sql string, dialect Dialect, additionalPatterns []BlockedPattern) error {
+	// Positions refer to the query as given
+	offset := len(sql) - len(strings.TrimLeftFunc(sql, unicode.IsSpace))
 	sql = strings.TrimSpace(sql)
 	if sql == "" {
-		return fmt.Errorf("empty SQL query")
+		return &ValidationError{Rule: RuleEmpty}
 	}
 
-	// Check for multiple statements
-	if strings.Count(sql, ";") > 1 {
-		return fmt.Errorf("multiple statements not allowed")
+	// Anything but comments after the first statement is another statement, whatever
+	// it is; semicolons inside literals and comments do not end a statement
+	if statements := SplitStatements(Tokenize(sql, dialect)); len(statements) > 1 {
+		next := statements[1][0]
+		return &ValidationError{Rule: RuleMultipleStatements, Matched: sql[next.Start:next.End], Position: offset + next.Start}
 	}
 
 	// Must start with SELECT or WITH (for CTEs)
-	normalized := strings.ToUpper(strings.TrimSpace(sql))
+	normalized := strings.ToUpper(sql)
 	if !strings.HasPrefix(normalized, "SELECT") && !strings.HasPrefix(normalized, "WITH") {
-		return fmt.Errorf("only SELECT statements allowed")
+		return &ValidationError{Rule: RuleSelectOnly, Matched: strings.Fields(sql)[0], Position: offset}
 	}
 
-	// Check common blocked patterns
-	for _, pattern := range blockedPatterns {
-		if pattern.MatchString(sql) {
-			return fmt.Errorf("blocked SQL pattern detected")
-		}
-	}
-
-	// Check database-specific blocked patterns
-	for _, pattern := range additionalPatterns {
-		if pattern.MatchString(sql) {
-			return fmt.Errorf("blocked SQL pattern detected")
+	// Check common, then database-specific blocked patterns
+	for _, patterns := range [][]BlockedPattern{blockedPatterns, additionalPatterns} {
+		for _, blocked := range patterns {
+			if loc := blocked.Pattern.FindStringIndex(sql); loc != nil {
+				return &ValidationError{Rule: blocked.Rule, Matched: sql[loc[0]:loc[1]], Position: offset + loc[0]}
+			}
 		}
 	}
 
 	return nil
 }
 
+// HasLimit reports whether the query has a LIMIT clause
+func HasLimit(sql string) bool {
+	return strings.Contains(strings.ToUpper(sql), "LIMIT")
+}
+
 // EnforceLimit ensures the query has a LIMIT clause
 func EnforceLimit(sql string, maxRows int, limitKeyword string) string {
-	normalized := strings.ToUpper(sql)
-
-	// Check if LIMIT already exists
-	if strings.Contains(normalized, "LIMIT") {
+	if HasLimit(sql) {
 		return sql
 	}
 
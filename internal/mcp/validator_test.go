@@ -1,104 +1,192 @@
 package mcp_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/Rrens/text-to-sql/internal/mcp"
 )
 
+// checkRule asserts that sql is accepted when wantRule is empty, and otherwise
+// rejected by the named rule
+func checkRule(t *testing.T, sql string, dialect mcp.Dialect, patterns []mcp.BlockedPattern, wantRule string) {
+	t.Helper()
+	err := mcp.ValidateSQL(sql, dialect, patterns)
+	if wantRule == "" {
+		if err != nil {
+			t.Errorf("ValidateSQL() error = %v, want nil", err)
+		}
+		return
+	}
+	var validationErr *mcp.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("ValidateSQL() error = %v, want a *mcp.ValidationError", err)
+	}
+	if validationErr.Rule != wantRule {
+		t.Errorf("ValidateSQL() rule = %q, want %q", validationErr.Rule, wantRule)
+	}
+}
+
 func TestValidateSQL(t *testing.T) {
 	tests := []struct {
-		name    string
-		sql     string
-		wantErr bool
+		name     string
+		sql      string
+		wantRule string
 	}{
 		// Valid SELECT queries
-		{"simple select", "SELECT * FROM users", false},
-		{"select with where", "SELECT id FROM users WHERE active = true", false},
-		{"select with join", "SELECT u.id FROM users u JOIN orders o ON u.id = o.user_id", false},
-		{"cte", "WITH cte AS (SELECT * FROM users) SELECT * FROM cte", false},
-		{"subquery", "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", false},
+		{"simple select", "SELECT * FROM users", ""},
+		{"select with where", "SELECT id FROM users WHERE active = true", ""},
+		{"select with join", "SELECT u.id FROM users u JOIN orders o ON u.id = o.user_id", ""},
+		{"cte", "WITH cte AS (SELECT * FROM users) SELECT * FROM cte", ""},
+		{"subquery", "SELECT * FROM users WHERE id IN (SELECT user_id FROM orders)", ""},
 
 		// Invalid - empty
-		{"empty", "", true},
-		{"whitespace", "   ", true},
+		{"empty", "", mcp.RuleEmpty},
+		{"whitespace", "   ", mcp.RuleEmpty},
 
 		// Invalid - not SELECT
-		{"insert", "INSERT INTO users VALUES (1)", true},
-		{"update", "UPDATE users SET name = 'x'", true},
-		{"delete", "DELETE FROM users", true},
-		{"drop", "DROP TABLE users", true},
-		{"truncate", "TRUNCATE users", true},
-		{"alter", "ALTER TABLE users ADD col INT", true},
-		{"create", "CREATE TABLE t (id INT)", true},
-		{"grant", "GRANT SELECT ON users TO x", true},
-		{"revoke", "REVOKE SELECT ON users FROM x", true},
-		{"exec", "EXEC procedure", true},
-		{"execute", "EXECUTE procedure", true},
+		{"insert", "INSERT INTO users VALUES (1)", mcp.RuleSelectOnly},
+		{"update", "UPDATE users SET name = 'x'", mcp.RuleSelectOnly},
+		{"delete", "DELETE FROM users", mcp.RuleSelectOnly},
+		{"drop", "DROP TABLE users", mcp.RuleSelectOnly},
+		{"truncate", "TRUNCATE users", mcp.RuleSelectOnly},
+		{"alter", "ALTER TABLE users ADD col INT", mcp.RuleSelectOnly},
+		{"create", "CREATE TABLE t (id INT)", mcp.RuleSelectOnly},
+		{"grant", "GRANT SELECT ON users TO x", mcp.RuleSelectOnly},
+		{"revoke", "REVOKE SELECT ON users FROM x", mcp.RuleSelectOnly},
+		{"exec", "EXEC procedure", mcp.RuleSelectOnly},
+		{"execute", "EXECUTE procedure", mcp.RuleSelectOnly},
+
+		// Invalid - blocked keywords inside a SELECT
+		{"cte with delete", "WITH gone AS (DELETE FROM users RETURNING *) SELECT * FROM gone", "DELETE keyword found"},
+		{"select with update", "SELECT * FROM users FOR UPDATE", "UPDATE keyword found"},
 
 		// Invalid - multiple statements
-		{"multi statement", "SELECT 1; SELECT 2;", true},
+		{"multi statement", "SELECT 1; SELECT 2;", mcp.RuleMultipleStatements},
+		{"second select without terminator", "SELECT 1; SELECT 2", mcp.RuleMultipleStatements},
+		{"second select sleeping", "SELECT 1; SELECT pg_sleep(999)", mcp.RuleMultipleStatements},
+		{"second statement dropping", "SELECT 1; DROP TABLE x", mcp.RuleMultipleStatements},
+		{"empty statement then select", "SELECT 1;; SELECT 2", mcp.RuleMultipleStatements},
+
+		// Valid - semicolons that do not start another statement
+		{"trailing semicolon", "SELECT 1;", ""},
+		{"trailing semicolon and comment", "SELECT 1; -- all users\n", ""},
+		{"semicolon in literal", "SELECT * FROM users WHERE bio = 'a; b; c';", ""},
+		{"semicolon in quoted name", `SELECT "a;b" FROM users;`, ""},
+		{"semicolon in comment", "SELECT 1 /* x; y */ FROM users;", ""},
 
 		// Invalid - file operations
-		{"into outfile", "SELECT * INTO OUTFILE '/tmp/x'", true},
-		{"into dumpfile", "SELECT * INTO DUMPFILE '/tmp/x'", true},
-		{"load_file", "SELECT LOAD_FILE('/etc/passwd')", true},
-		{"load data", "LOAD DATA INFILE '/tmp/x' INTO TABLE t", true},
+		{"into outfile", "SELECT * INTO OUTFILE '/tmp/x'", "INTO OUTFILE keyword found"},
+		{"into dumpfile", "SELECT * INTO DUMPFILE '/tmp/x'", "INTO DUMPFILE keyword found"},
+		{"load_file", "SELECT LOAD_FILE('/etc/passwd')", "LOAD_FILE keyword found"},
+		{"load data", "LOAD DATA INFILE '/tmp/x' INTO TABLE t", mcp.RuleSelectOnly},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mcp.ValidateSQL(tt.sql, nil)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateSQL() error = %v, wantErr %v", err, tt.wantErr)
+			checkRule(t, tt.sql, mcp.DialectStandard, nil, tt.wantRule)
+		})
+	}
+}
+
+func TestValidateSQL_DialectQuoting(t *testing.T) {
+	tests := []struct {
+		name     string
+		dialect  mcp.Dialect
+		sql      string
+		wantRule string
+	}{
+		{"mysql backslash escape", mcp.DialectMySQL, `SELECT 'a\'' ; SELECT sleep(9) -- '`, mcp.RuleMultipleStatements},
+		{"mysql escaped backslash", mcp.DialectMySQL, `SELECT 'a\\'; SELECT sleep(9)`, mcp.RuleMultipleStatements},
+		{"mysql escaped quote in literal", mcp.DialectMySQL, `SELECT 'it\'s; fine'`, ""},
+		{"mysql double-quoted string", mcp.DialectMySQL, `SELECT "a\" b " ; SELECT sleep(9) -- "`, mcp.RuleMultipleStatements},
+		{"clickhouse backslash escape", mcp.DialectClickHouse, `SELECT 'a\'' ; SELECT sleep(9) -- '`, mcp.RuleMultipleStatements},
+		{"postgres backslash is literal", mcp.DialectPostgres, `SELECT 'a\'; SELECT pg_sleep(9)`, mcp.RuleMultipleStatements},
+		{"postgres dollar quote", mcp.DialectPostgres, `SELECT $$a; b$$`, ""},
+		{"postgres tagged dollar quote", mcp.DialectPostgres, `SELECT $fn$it's; $$ fine$fn$ FROM users`, ""},
+		{"postgres statement after dollar quote", mcp.DialectPostgres, `SELECT $$a$$; SELECT pg_sleep(9)`, mcp.RuleMultipleStatements},
+		{"postgres positional parameter", mcp.DialectPostgres, `SELECT * FROM users WHERE id = $1; SELECT $1`, mcp.RuleMultipleStatements},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRule(t, tt.sql, tt.dialect, nil, tt.wantRule)
+		})
+	}
+}
+
+func TestValidateSQL_ReportsMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want mcp.ValidationError
+	}{
+		{"keyword", "SELECT 1 FROM t WHERE x IN (delete)", mcp.ValidationError{Rule: "DELETE keyword found", Matched: "delete", Position: 28}},
+		{"leading whitespace", "\n  SELECT pg_read_file('/etc/passwd')", mcp.ValidationError{Rule: "postgres: pg_read_file blocked", Matched: "pg_read_file", Position: 10}},
+		{"first word", "  update users set a = 1", mcp.ValidationError{Rule: mcp.RuleSelectOnly, Matched: "update", Position: 2}},
+		{"second statement", "SELECT 1; SELECT 2;", mcp.ValidationError{Rule: mcp.RuleMultipleStatements, Matched: "SELECT", Position: 10}},
+		{"second statement after literal", " SELECT ';'; 'x'", mcp.ValidationError{Rule: mcp.RuleMultipleStatements, Matched: "'x'", Position: 13}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *mcp.ValidationError
+			if err := mcp.ValidateSQL(tt.sql, mcp.DialectPostgres, mcp.PostgresBlockedPatterns); !errors.As(err, &got) {
+				t.Fatalf("ValidateSQL() error = %v, want a *mcp.ValidationError", err)
+			}
+			if *got != tt.want {
+				t.Errorf("ValidateSQL() = %+v, want %+v", *got, tt.want)
 			}
 		})
 	}
+
+	err := mcp.ValidateSQL("SELECT 1 FROM t WHERE x IN (delete)", mcp.DialectStandard, nil)
+	if want := `query blocked: DELETE keyword found ("delete" at position 28)`; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
 }
 
 func TestValidateSQL_PostgresPatterns(t *testing.T) {
 	tests := []struct {
-		name    string
-		sql     string
-		wantErr bool
+		name     string
+		sql      string
+		wantRule string
 	}{
-		{"pg_read_file", "SELECT pg_read_file('/etc/passwd')", true},
-		{"pg_ls_dir", "SELECT pg_ls_dir('/tmp')", true},
-		{"lo_import", "SELECT lo_import('/tmp/x')", true},
-		{"lo_export", "SELECT lo_export(1234, '/tmp/x')", true},
-		{"copy", "COPY users TO '/tmp/x'", true},
-		{"dblink", "SELECT * FROM dblink('host=x', 'SELECT 1')", true},
+		{"pg_read_file", "SELECT pg_read_file('/etc/passwd')", "postgres: pg_read_file blocked"},
+		{"pg_ls_dir", "SELECT pg_ls_dir('/tmp')", "postgres: pg_ls_dir blocked"},
+		{"lo_import", "SELECT lo_import('/tmp/x')", "postgres: lo_import blocked"},
+		{"lo_export", "SELECT lo_export(1234, '/tmp/x')", "postgres: lo_export blocked"},
+		{"copy", "COPY users TO '/tmp/x'", mcp.RuleSelectOnly},
+		{"copy in select", "SELECT 1 FROM (COPY users TO '/tmp/x') c", "postgres: COPY blocked"},
+		{"dblink", "SELECT * FROM dblink('host=x', 'SELECT 1')", "postgres: dblink blocked"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mcp.ValidateSQL(tt.sql, mcp.PostgresBlockedPatterns)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateSQL() error = %v, wantErr %v", err, tt.wantErr)
-			}
+			checkRule(t, tt.sql, mcp.DialectPostgres, mcp.PostgresBlockedPatterns, tt.wantRule)
 		})
 	}
 }
 
 func TestValidateSQL_ClickHousePatterns(t *testing.T) {
 	tests := []struct {
-		name    string
-		sql     string
-		wantErr bool
+		name     string
+		sql      string
+		wantRule string
 	}{
-		{"file function", "SELECT * FROM file('/tmp/x.csv')", true},
-		{"url function", "SELECT * FROM url('http://x.com/data')", true},
-		{"remote function", "SELECT * FROM remote('host', 'db', 'table')", true},
-		{"mysql function", "SELECT * FROM mysql('host', 'db', 'table', 'user', 'pass')", true},
-		{"postgresql function", "SELECT * FROM postgresql('host', 'db', 'table', 'user', 'pass')", true},
+		{"file function", "SELECT * FROM file('/tmp/x.csv')", "clickhouse: file() blocked"},
+		{"url function", "SELECT * FROM url('http://x.com/data')", "clickhouse: url() blocked"},
+		{"remote function", "SELECT * FROM remote('host', 'db', 'table')", "clickhouse: remote() blocked"},
+		{"mysql function", "SELECT * FROM mysql('host', 'db', 'table', 'user', 'pass')", "clickhouse: mysql() blocked"},
+		{"postgresql function", "SELECT * FROM postgresql('host', 'db', 'table', 'user', 'pass')", "clickhouse: postgresql() blocked"},
+		{"remoteSecure function", "SELECT * FROM remoteSecure('host', 'db', 'table')", "clickhouse: remoteSecure() blocked"},
+		{"cluster function", "SELECT * FROM clusterAllReplicas('default', system.one)", "clickhouse: cluster() blocked"},
+		{"s3 function", "SELECT * FROM s3Cluster('c', 'https://bucket/*.parquet')", "clickhouse: s3() blocked"},
+		{"executable function", "SELECT * FROM executable('script.sh', 'TSV', 'x String')", "clickhouse: executable() blocked"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := mcp.ValidateSQL(tt.sql, mcp.ClickhouseBlockedPatterns)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateSQL() error = %v, wantErr %v", err, tt.wantErr)
-			}
+			checkRule(t, tt.sql, mcp.DialectClickHouse, mcp.ClickhouseBlockedPatterns, tt.wantRule)
 		})
 	}
 }
@@ -0,0 +1,56 @@
+package observability
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/config"
+	rotatelogs "github.com/lestrrat-go/file-rotatelogs"
+	"github.com/rs/zerolog"
+)
+
+// NewLogger builds the application logger from cfg. Lines go to out as raw JSON, or
+// pretty-printed when format is console, and additionally to rotated files when file
+// logging is enabled. The level is returned for zerolog.SetGlobalLevel.
+func NewLogger(cfg config.LoggingConfig, out io.Writer) (zerolog.Logger, zerolog.Level, error) {
+	level := zerolog.InfoLevel
+	if cfg.Level != "" {
+		parsed, err := zerolog.ParseLevel(strings.ToLower(cfg.Level))
+		if err != nil {
+			return zerolog.Nop(), level, fmt.Errorf("invalid log level %q", cfg.Level)
+		}
+		level = parsed
+	}
+
+	var stdout io.Writer
+	switch cfg.Format {
+	case "", "json":
+		stdout = out
+	case "console":
+		stdout = zerolog.ConsoleWriter{Out: out}
+	default:
+		return zerolog.Nop(), level, fmt.Errorf("invalid log format %q, expected json or console", cfg.Format)
+	}
+
+	writer := stdout
+	if cfg.File.Enabled {
+		if err := os.MkdirAll(filepath.Dir(cfg.File.Path), 0755); err != nil {
+			return zerolog.Nop(), level, fmt.Errorf("failed to create log directory: %w", err)
+		}
+		rotator, err := rotatelogs.New(
+			cfg.File.Path,
+			rotatelogs.WithRotationTime(cfg.File.RotationTime),
+			rotatelogs.WithMaxAge(cfg.File.MaxAge),
+		)
+		if err != nil {
+			return zerolog.Nop(), level, fmt.Errorf("failed to initialize log rotation: %w", err)
+		}
+		// Files always get JSON so they can be shipped and parsed
+		writer = zerolog.MultiLevelWriter(stdout, rotator)
+	}
+
+	return zerolog.New(writer).Level(level).With().Timestamp().Logger(), level, nil
+}
@@ -0,0 +1,74 @@
+package observability_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/observability"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLogger(t *testing.T) {
+	t.Run("json at configured level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, level, err := observability.NewLogger(config.LoggingConfig{Level: "WARN", Format: "json"}, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, zerolog.WarnLevel, level)
+
+		logger.Info().Msg("dropped")
+		logger.Warn().Str("component", "redis").Msg("kept")
+
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+		assert.Equal(t, "kept", line["message"])
+		assert.Equal(t, "redis", line["component"])
+	})
+
+	t.Run("console", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger, level, err := observability.NewLogger(config.LoggingConfig{Format: "console"}, &buf)
+		require.NoError(t, err)
+		assert.Equal(t, zerolog.InfoLevel, level)
+
+		logger.Info().Msg("hello")
+		assert.Contains(t, buf.String(), "hello")
+		assert.False(t, json.Valid(bytes.TrimSpace(buf.Bytes())))
+	})
+
+	t.Run("invalid settings", func(t *testing.T) {
+		_, _, err := observability.NewLogger(config.LoggingConfig{Level: "verbose"}, &bytes.Buffer{})
+		assert.Error(t, err)
+		_, _, err = observability.NewLogger(config.LoggingConfig{Format: "text"}, &bytes.Buffer{})
+		assert.Error(t, err)
+	})
+
+	t.Run("rotated file", func(t *testing.T) {
+		dir := t.TempDir()
+		logger, _, err := observability.NewLogger(config.LoggingConfig{
+			Format: "console",
+			File: config.LogFileConfig{
+				Enabled:      true,
+				Path:         filepath.Join(dir, "logs", "app-%Y-%m-%d.log"),
+				RotationTime: 24 * time.Hour,
+				MaxAge:       7 * 24 * time.Hour,
+			},
+		}, &bytes.Buffer{})
+		require.NoError(t, err)
+
+		logger.Info().Msg("to file")
+
+		files, err := filepath.Glob(filepath.Join(dir, "logs", "app-*.log"))
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		data, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		assert.True(t, json.Valid(bytes.TrimSpace(data)), "files get JSON even with console format")
+	})
+}
@@ -0,0 +1,375 @@
+// Package observability holds the Prometheus metrics recorded by the API and its services.
+package observability
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "texttosql"
+
+// Metrics records application metrics into a Prometheus registry.
+// All methods are safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	llmRequests *prometheus.CounterVec
+	llmDuration *prometheus.HistogramVec
+	llmTokens   *prometheus.CounterVec
+
+	queryExecutions  *prometheus.CounterVec
+	queryDuration    *prometheus.HistogramVec
+	queryRows        *prometheus.HistogramVec
+	queryTruncations *prometheus.CounterVec
+	queryPhases      *prometheus.HistogramVec
+	promptTokens     *prometheus.HistogramVec
+
+	schemaCacheLookups      *prometheus.CounterVec
+	schemaRefreshSuppressed *prometheus.CounterVec
+	schemaLoadDuration      *prometheus.HistogramVec
+	schemaDescribeFailures  *prometheus.CounterVec
+	rateLimitRejections     *prometheus.CounterVec
+	adapterReconnects       *prometheus.CounterVec
+	replicaFallbacks        *prometheus.CounterVec
+	llmBusyRejections       *prometheus.CounterVec
+	decryptFailures         *prometheus.CounterVec
+}
+
+// NewMetrics creates the application metrics and registers them with registry
+func NewMetrics(registry *prometheus.Registry) *Metrics {
+	m := &Metrics{
+		registry: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		llmRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_requests_total",
+			Help:      "LLM calls by provider, model and outcome (ok or error).",
+		}, []string{"provider", "model", "outcome"}),
+		llmDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "llm_request_duration_seconds",
+			Help:      "LLM call latency by provider and model.",
+			Buckets:   prometheus.ExponentialBuckets(0.25, 2, 9), // 0.25s to 64s
+		}, []string{"provider", "model"}),
+		llmTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_tokens_total",
+			Help:      "Tokens used by LLM calls by provider and model.",
+		}, []string{"provider", "model"}),
+		queryExecutions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_executions_total",
+			Help:      "Executions of generated SQL by database type and status (ok, sql_error, blocked, timeout).",
+		}, []string{"database_type", "status"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_duration_seconds",
+			Help:      "Latency of executing generated SQL by database type.",
+			Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"database_type"}),
+		queryPhases: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_phase_duration_seconds",
+			Help:      "Time spent answering questions by phase (connect, schema, prompt, llm_queue, llm, validation, execution or serialization) and database type.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to about 4 minutes
+		}, []string{"phase", "database_type"}),
+		queryRows: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_rows",
+			Help:      "Rows returned by generated SQL by database type.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 8), // 1 to 16384
+		}, []string{"database_type"}),
+		queryTruncations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "query_truncations_total",
+			Help:      "Query results cut off at the row limit by database type.",
+		}, []string{"database_type"}),
+		promptTokens: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "prompt_section_tokens",
+			Help:      "Estimated tokens of generation prompts by section (instructions, schema, examples, history, question or total) and database type.",
+			Buckets:   prometheus.ExponentialBuckets(16, 2, 14), // 16 to 131072
+		}, []string{"section", "database_type"}),
+		schemaCacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schema_cache_lookups_total",
+			Help:      "Schema cache lookups by result (hit or miss).",
+		}, []string{"result"}),
+		schemaRefreshSuppressed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schema_refreshes_suppressed_total",
+			Help:      "Schema refreshes skipped because another one was running, by how the schema was served (shared, remote or stale).",
+		}, []string{"served"}),
+		schemaLoadDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "schema_load_phase_duration_seconds",
+			Help:      "Time spent loading schemas from databases by database type and phase (list, describe or ddl).",
+			Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12), // 50ms to about 100s
+		}, []string{"database_type", "phase"}),
+		schemaDescribeFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "schema_describe_failures_total",
+			Help:      "Tables left out of a loaded schema because they could not be described, by connection and database type.",
+		}, []string{"connection_id", "database_type"}),
+		rateLimitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limit_rejections_total",
+			Help:      "Requests rejected by the rate limiter by class.",
+		}, []string{"class"}),
+		adapterReconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "adapter_reconnects_total",
+			Help:      "Pooled database adapters replaced after failing a health check, by connection and database type.",
+		}, []string{"connection_id", "database_type"}),
+		replicaFallbacks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "replica_fallbacks_total",
+			Help:      "Times a read replica could not be reached and its statements went to the primary, by connection and database type.",
+		}, []string{"connection_id", "database_type"}),
+		llmBusyRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "llm_busy_rejections_total",
+			Help:      "LLM requests turned away because the provider's queue was full, by provider.",
+		}, []string{"provider"}),
+		decryptFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decrypt_failures_total",
+			Help:      "Stored secrets that could not be decrypted with the current encryption key, by kind of secret.",
+		}, []string{"secret"}),
+	}
+
+	registry.MustRegister(
+		m.httpRequests, m.httpDuration,
+		m.llmRequests, m.llmDuration, m.llmTokens,
+		m.queryExecutions, m.queryDuration, m.queryRows, m.queryTruncations, m.queryPhases, m.promptTokens,
+		m.schemaCacheLookups, m.schemaRefreshSuppressed, m.schemaLoadDuration, m.schemaDescribeFailures,
+		m.rateLimitRejections, m.adapterReconnects, m.replicaFallbacks, m.llmBusyRejections, m.decryptFailures,
+	)
+	return m
+}
+
+// NewRegistry creates a registry with the Go runtime and process collectors
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+// A non-empty token is required as a bearer token.
+func (m *Metrics) Handler(token string) http.Handler {
+	h := promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Middleware records request count and latency labelled by the matched route template,
+// so path parameters such as IDs do not become label values
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		m.httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveLLMCall records one LLM call
+func (m *Metrics) ObserveLLMCall(provider, model string, duration time.Duration, tokens int, err error) {
+	if m == nil {
+		return
+	}
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	m.llmRequests.WithLabelValues(provider, model, outcome).Inc()
+	m.llmDuration.WithLabelValues(provider, model).Observe(duration.Seconds())
+	if tokens > 0 {
+		m.llmTokens.WithLabelValues(provider, model).Add(float64(tokens))
+	}
+}
+
+// ObserveQueryBlocked records generated SQL rejected by validation before execution
+func (m *Metrics) ObserveQueryBlocked(databaseType string) {
+	if m == nil {
+		return
+	}
+	m.queryExecutions.WithLabelValues(databaseType, string(domain.QueryStatusBlocked)).Inc()
+}
+
+// ObserveQuery records one execution of generated SQL. result is nil when it failed.
+func (m *Metrics) ObserveQuery(databaseType string, status domain.QueryStatus, duration time.Duration, result *domain.QueryResult) {
+	if m == nil {
+		return
+	}
+	m.queryExecutions.WithLabelValues(databaseType, string(status)).Inc()
+	m.queryDuration.WithLabelValues(databaseType).Observe(duration.Seconds())
+	if result != nil {
+		m.queryRows.WithLabelValues(databaseType).Observe(float64(result.RowCount))
+		if result.Truncated {
+			m.queryTruncations.WithLabelValues(databaseType).Inc()
+		}
+	}
+}
+
+// ObserveQueryPhase records how long a phase of answering a question took
+func (m *Metrics) ObserveQueryPhase(databaseType, phase string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.queryPhases.WithLabelValues(phase, databaseType).Observe(duration.Seconds())
+}
+
+// ObserveSchemaCache records a schema cache lookup
+func (m *Metrics) ObserveSchemaCache(hit bool) {
+	if m == nil {
+		return
+	}
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.schemaCacheLookups.WithLabelValues(result).Inc()
+}
+
+// ObserveSchemaRefreshSuppressed records a schema refresh that was not run because
+// another one was in progress. served is "shared" for the result of a refresh in this
+// process, "remote" for one cached by another replica and "stale" for the old schema.
+func (m *Metrics) ObserveSchemaRefreshSuppressed(served string) {
+	if m == nil {
+		return
+	}
+	m.schemaRefreshSuppressed.WithLabelValues(served).Inc()
+}
+
+// ObserveSchemaLoad records one phase of loading a schema from a database
+func (m *Metrics) ObserveSchemaLoad(databaseType, phase string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.schemaLoadDuration.WithLabelValues(databaseType, phase).Observe(duration.Seconds())
+}
+
+// ObserveSchemaDescribeFailures records the tables of a connection's schema that could
+// not be described, which usually points at missing grants
+func (m *Metrics) ObserveSchemaDescribeFailures(connectionID, databaseType string, failures int) {
+	if m == nil || failures <= 0 {
+		return
+	}
+	m.schemaDescribeFailures.WithLabelValues(connectionID, databaseType).Add(float64(failures))
+}
+
+// ObserveRateLimitRejection records a request rejected by the rate limiter
+func (m *Metrics) ObserveRateLimitRejection(class string) {
+	if m == nil {
+		return
+	}
+	m.rateLimitRejections.WithLabelValues(class).Inc()
+}
+
+// ObserveAdapterReconnect records a pooled database adapter replaced after failing a
+// health check; a connection reconnecting often points at a flapping database
+func (m *Metrics) ObserveAdapterReconnect(connectionID, databaseType string) {
+	if m == nil {
+		return
+	}
+	m.adapterReconnects.WithLabelValues(connectionID, databaseType).Inc()
+}
+
+// ObserveReplicaFallback records a read replica that could not be reached, so the
+// primary serves its statements for a while
+func (m *Metrics) ObserveReplicaFallback(connectionID, databaseType string) {
+	if m == nil {
+		return
+	}
+	m.replicaFallbacks.WithLabelValues(connectionID, databaseType).Inc()
+}
+
+// ObservePrompt records the size of each section of a generation prompt
+func (m *Metrics) ObservePrompt(databaseType string, breakdown domain.PromptBreakdown) {
+	if m == nil {
+		return
+	}
+	for section, size := range map[string]domain.PromptSize{
+		"instructions": breakdown.Instructions,
+		"schema":       breakdown.Schema,
+		"examples":     breakdown.Examples,
+		"history":      breakdown.History,
+		"question":     breakdown.Question,
+		"total":        breakdown.Total,
+	} {
+		m.promptTokens.WithLabelValues(section, databaseType).Observe(float64(size.Tokens))
+	}
+}
+
+// ObserveLLMBusy records an LLM request turned away by a provider's full queue
+func (m *Metrics) ObserveLLMBusy(provider string) {
+	if m == nil {
+		return
+	}
+	m.llmBusyRejections.WithLabelValues(provider).Inc()
+}
+
+// ObserveDecryptFailure records a stored secret, such as "connection_credentials",
+// that could not be decrypted; a spike means the encryption key changed without the
+// stored secrets being re-encrypted
+func (m *Metrics) ObserveDecryptFailure(secret string) {
+	if m == nil {
+		return
+	}
+	m.decryptFailures.WithLabelValues(secret).Inc()
+}
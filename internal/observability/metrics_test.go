@@ -0,0 +1,192 @@
+package observability_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/observability"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Middleware(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := observability.NewMetrics(registry)
+
+	r := chi.NewRouter()
+	r.Use(m.Middleware)
+	r.Get("/workspaces/{workspaceID}/sessions", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, path := range []string{"/workspaces/a/sessions", "/workspaces/b/sessions", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expected := `
+# HELP texttosql_http_requests_total HTTP requests by method, route template and status code.
+# TYPE texttosql_http_requests_total counter
+texttosql_http_requests_total{method="GET",route="/workspaces/{workspaceID}/sessions",status="200"} 2
+texttosql_http_requests_total{method="GET",route="unmatched",status="404"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "texttosql_http_requests_total"))
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	m := observability.NewMetrics(prometheus.NewRegistry())
+	m.ObserveSchemaCache(true)
+
+	t.Run("open without token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		m.Handler("").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `texttosql_schema_cache_lookups_total{result="hit"} 1`)
+	})
+
+	t.Run("token required", func(t *testing.T) {
+		h := m.Handler("scrape-secret")
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.NotEmpty(t, rec.Header().Get("WWW-Authenticate"))
+
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+		req = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		req.Header.Set("Authorization", "Bearer scrape-secret")
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	})
+}
+
+func TestMetrics_Observe(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := observability.NewMetrics(registry)
+
+	m.ObserveLLMCall("openai", "gpt-4o", time.Second, 120, nil)
+	m.ObserveLLMCall("openai", "gpt-4o", time.Second, 0, errors.New("rate limited"))
+	m.ObserveQueryBlocked("postgres")
+	m.ObserveQuery("postgres", domain.QueryStatusOK, 50*time.Millisecond, &domain.QueryResult{RowCount: 1000, Truncated: true})
+	m.ObserveQuery("postgres", domain.QueryStatusSQLError, 10*time.Millisecond, nil)
+	m.ObserveRateLimitRejection("query")
+	m.ObserveSchemaLoad("postgres", "describe", time.Second)
+	m.ObserveSchemaDescribeFailures("c1", "postgres", 2)
+	m.ObserveSchemaDescribeFailures("c2", "postgres", 0)
+	m.ObservePrompt("postgres", domain.PromptBreakdown{
+		Schema: domain.PromptSize{Chars: 4000, Tokens: 1000},
+		Total:  domain.PromptSize{Chars: 4400, Tokens: 1100},
+	})
+
+	expected := `
+# HELP texttosql_llm_requests_total LLM calls by provider, model and outcome (ok or error).
+# TYPE texttosql_llm_requests_total counter
+texttosql_llm_requests_total{model="gpt-4o",outcome="error",provider="openai"} 1
+texttosql_llm_requests_total{model="gpt-4o",outcome="ok",provider="openai"} 1
+# HELP texttosql_llm_tokens_total Tokens used by LLM calls by provider and model.
+# TYPE texttosql_llm_tokens_total counter
+texttosql_llm_tokens_total{model="gpt-4o",provider="openai"} 120
+# HELP texttosql_query_executions_total Executions of generated SQL by database type and status (ok, sql_error, blocked, timeout).
+# TYPE texttosql_query_executions_total counter
+texttosql_query_executions_total{database_type="postgres",status="blocked"} 1
+texttosql_query_executions_total{database_type="postgres",status="ok"} 1
+texttosql_query_executions_total{database_type="postgres",status="sql_error"} 1
+# HELP texttosql_query_truncations_total Query results cut off at the row limit by database type.
+# TYPE texttosql_query_truncations_total counter
+texttosql_query_truncations_total{database_type="postgres"} 1
+# HELP texttosql_rate_limit_rejections_total Requests rejected by the rate limiter by class.
+# TYPE texttosql_rate_limit_rejections_total counter
+texttosql_rate_limit_rejections_total{class="query"} 1
+# HELP texttosql_schema_describe_failures_total Tables left out of a loaded schema because they could not be described, by connection and database type.
+# TYPE texttosql_schema_describe_failures_total counter
+texttosql_schema_describe_failures_total{connection_id="c1",database_type="postgres"} 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"texttosql_llm_requests_total",
+		"texttosql_llm_tokens_total",
+		"texttosql_query_executions_total",
+		"texttosql_query_truncations_total",
+		"texttosql_rate_limit_rejections_total",
+		"texttosql_schema_describe_failures_total",
+	))
+
+	assert.Equal(t, 6, testutil.CollectAndCount(registry, "texttosql_prompt_section_tokens"))
+}
+
+func TestMetrics_RegisterPools(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := observability.NewMetrics(registry)
+
+	pools := []observability.Pool{
+		{Name: "platform", Stats: domain.PoolStats{MaxConns: 25, AcquiredConns: 3, IdleConns: 2}},
+	}
+	m.RegisterPools(func() []observability.Pool { return pools })
+
+	// Pools are read on every scrape, so a pool opened after registration shows up
+	pools = append(pools, observability.Pool{
+		Name:         "adapter",
+		ConnectionID: "conn-1",
+		DatabaseType: "mysql",
+		Stats:        domain.PoolStats{MaxConns: 5, AcquiredConns: 5, WaitCount: 4, WaitMs: 1500},
+	})
+
+	expected := `
+# HELP texttosql_db_pool_acquire_seconds_total Time spent acquiring connections from a pool.
+# TYPE texttosql_db_pool_acquire_seconds_total counter
+texttosql_db_pool_acquire_seconds_total{connection_id="",database_type="",pool="platform"} 0
+texttosql_db_pool_acquire_seconds_total{connection_id="conn-1",database_type="mysql",pool="adapter"} 1.5
+# HELP texttosql_db_pool_connections Open connections of a pool by state (acquired or idle).
+# TYPE texttosql_db_pool_connections gauge
+texttosql_db_pool_connections{connection_id="",database_type="",pool="platform",state="acquired"} 3
+texttosql_db_pool_connections{connection_id="",database_type="",pool="platform",state="idle"} 2
+texttosql_db_pool_connections{connection_id="conn-1",database_type="mysql",pool="adapter",state="acquired"} 5
+texttosql_db_pool_connections{connection_id="conn-1",database_type="mysql",pool="adapter",state="idle"} 0
+# HELP texttosql_db_pool_max_connections Connections a pool may open.
+# TYPE texttosql_db_pool_max_connections gauge
+texttosql_db_pool_max_connections{connection_id="",database_type="",pool="platform"} 25
+texttosql_db_pool_max_connections{connection_id="conn-1",database_type="mysql",pool="adapter"} 5
+# HELP texttosql_db_pool_waits_total Connection acquisitions that waited because the pool had no free connection.
+# TYPE texttosql_db_pool_waits_total counter
+texttosql_db_pool_waits_total{connection_id="",database_type="",pool="platform"} 0
+texttosql_db_pool_waits_total{connection_id="conn-1",database_type="mysql",pool="adapter"} 4
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"texttosql_db_pool_acquire_seconds_total",
+		"texttosql_db_pool_connections",
+		"texttosql_db_pool_max_connections",
+		"texttosql_db_pool_waits_total",
+	))
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	var m *observability.Metrics
+
+	assert.NotPanics(t, func() {
+		m.ObserveLLMCall("openai", "gpt-4o", time.Second, 1, nil)
+		m.ObserveQueryBlocked("postgres")
+		m.ObserveQuery("postgres", domain.QueryStatusOK, time.Second, nil)
+		m.ObserveSchemaCache(false)
+		m.ObserveSchemaLoad("postgres", "describe", time.Second)
+		m.ObserveSchemaDescribeFailures("c1", "postgres", 1)
+		m.ObserveRateLimitRejection("default")
+		m.RegisterPools(func() []observability.Pool { return nil })
+	})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	rec := httptest.NewRecorder()
+	m.Middleware(next).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
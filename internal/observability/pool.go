@@ -0,0 +1,64 @@
+package observability
+
+import (
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Pool is a connection pool reported at scrape time. Name is "platform" for the
+// application database and "adapter" for pools kept to users' databases, which also
+// carry their connection ID and database type.
+type Pool struct {
+	Name         string
+	ConnectionID string
+	DatabaseType string
+	Stats        domain.PoolStats
+}
+
+// PoolSource lists the connection pools to report
+type PoolSource func() []Pool
+
+var poolLabels = []string{"pool", "connection_id", "database_type"}
+
+var (
+	poolMaxConnsDesc = prometheus.NewDesc(namespace+"_db_pool_max_connections",
+		"Connections a pool may open.", poolLabels, nil)
+	poolConnsDesc = prometheus.NewDesc(namespace+"_db_pool_connections",
+		"Open connections of a pool by state (acquired or idle).", append(poolLabels, "state"), nil)
+	poolWaitsDesc = prometheus.NewDesc(namespace+"_db_pool_waits_total",
+		"Connection acquisitions that waited because the pool had no free connection.", poolLabels, nil)
+	poolWaitSecondsDesc = prometheus.NewDesc(namespace+"_db_pool_acquire_seconds_total",
+		"Time spent acquiring connections from a pool.", poolLabels, nil)
+)
+
+// poolCollector reads pool statistics when the registry is scraped, so pools opened
+// and closed between scrapes need no bookkeeping
+type poolCollector struct {
+	source PoolSource
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- poolMaxConnsDesc
+	ch <- poolConnsDesc
+	ch <- poolWaitsDesc
+	ch <- poolWaitSecondsDesc
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.source() {
+		labels := []string{p.Name, p.ConnectionID, p.DatabaseType}
+		ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(p.Stats.MaxConns), labels...)
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(p.Stats.AcquiredConns), append(labels, "acquired")...)
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(p.Stats.IdleConns), append(labels, "idle")...)
+		ch <- prometheus.MustNewConstMetric(poolWaitsDesc, prometheus.CounterValue, float64(p.Stats.WaitCount), labels...)
+		ch <- prometheus.MustNewConstMetric(poolWaitSecondsDesc, prometheus.CounterValue, float64(p.Stats.WaitMs)/1000, labels...)
+	}
+}
+
+// RegisterPools reports the pools listed by source on every scrape
+func (m *Metrics) RegisterPools(source PoolSource) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(poolCollector{source: source})
+}
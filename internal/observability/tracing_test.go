@@ -0,0 +1,135 @@
+package observability_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/observability"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps finished spans in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var childTraceID trace.TraceID
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(observability.Tracing)
+	r.Get("/workspaces/{workspaceID}/query", func(w http.ResponseWriter, r *http.Request) {
+		_, span := observability.StartSpan(r.Context(), "query.llm_generate")
+		childTraceID = span.SpanContext().TraceID()
+		span.End()
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/workspaces/abc/query", nil)
+	req.Header.Set("X-Request-Id", "req-123")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	child, root := spans[0], spans[1]
+
+	assert.Equal(t, "GET /workspaces/{workspaceID}/query", root.Name())
+	assert.Equal(t, trace.SpanKindServer, root.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", root.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", root.Parent().SpanID().String())
+	assert.Equal(t, codes.Error, root.Status().Code)
+
+	attrs := spanAttributes(root)
+	assert.Equal(t, "req-123", attrs["request_id"].AsString())
+	assert.Equal(t, "/workspaces/{workspaceID}/query", attrs["http.route"].AsString())
+	assert.Equal(t, int64(http.StatusBadGateway), attrs["http.response.status_code"].AsInt64())
+
+	assert.Equal(t, root.SpanContext().TraceID(), childTraceID)
+	assert.Equal(t, root.SpanContext().SpanID(), child.Parent().SpanID())
+}
+
+func TestTracingTransport(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: observability.NewTracingTransport(nil, "openai")}
+	ctx, parent := observability.StartSpan(context.Background(), "query.llm_generate")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+"/v1/chat/completions", nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "openai POST", span.Name())
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Equal(t, "/v1/chat/completions", spanAttributes(span)["url.path"].AsString())
+	assert.Empty(t, traceparent, "trace context must not leak to third-party APIs")
+}
+
+func TestTraceHook(t *testing.T) {
+	recordSpans(t)
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Hook(observability.TraceHook{})
+
+	ctx, span := observability.StartSpan(context.Background(), "request")
+	logger.Info().Ctx(ctx).Msg("with span")
+	span.End()
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, span.SpanContext().TraceID().String(), line["trace_id"])
+	assert.Equal(t, span.SpanContext().SpanID().String(), line["span_id"])
+
+	buf.Reset()
+	logger.Info().Msg("without span")
+	line = map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.NotContains(t, line, "trace_id")
+}
@@ -0,0 +1,52 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+)
+
+// AuditRepository handles audit log data access
+type AuditRepository struct {
+	db *DB
+}
+
+// NewAuditRepository creates a new audit repository
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Create records an audit log entry
+func (r *AuditRepository) Create(ctx context.Context, entry *domain.AuditLog) error {
+	query := `
+		INSERT INTO audit_log (id, workspace_id, user_id, action, resource_type, resource_id, metadata, ip_address, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, NULLIF($8, '')::inet, $9)
+	`
+
+	_, err := r.db.Pool.Exec(ctx, query,
+		entry.ID,
+		nullableUUID(entry.WorkspaceID),
+		nullableUUID(entry.UserID),
+		entry.Action,
+		entry.ResourceType,
+		entry.ResourceID,
+		entry.Metadata,
+		entry.IPAddress,
+		entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+
+	return nil
+}
+
+// nullableUUID maps uuid.Nil to SQL NULL
+func nullableUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
@@ -26,9 +26,9 @@ func (r *ConnectionRepository) Create(ctx context.Context, conn *domain.Connecti
 		INSERT INTO connections (
 			id, workspace_id, name, database_type, host, port, 
 			database_name, username, credentials_encrypted, ssl_mode,
-			read_only, max_rows, timeout_seconds, created_at, updated_at
+			read_only, max_rows, timeout_seconds, schema_cache_ttl_seconds, max_estimated_rows, error_rate_threshold, default_limit, schema_order, replica_host, replica_port, replica_use, created_at, updated_at
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, COALESCE(NULLIF($18, ''), 'size'), $19, $20, COALESCE(NULLIF($21, ''), 'queries'), $22, $23)
 	`
 
 	_, err := r.db.Pool.Exec(ctx, query,
@@ -45,6 +45,14 @@ func (r *ConnectionRepository) Create(ctx context.Context, conn *domain.Connecti
 		conn.ReadOnly,
 		conn.MaxRows,
 		conn.TimeoutSeconds,
+		conn.SchemaCacheTTLSeconds,
+		conn.MaxEstimatedRows,
+		conn.ErrorRateThreshold,
+		conn.DefaultLimit,
+		conn.SchemaOrder,
+		conn.ReplicaHost,
+		conn.ReplicaPort,
+		conn.ReplicaUse,
 		conn.CreatedAt,
 		conn.UpdatedAt,
 	)
@@ -61,7 +69,7 @@ func (r *ConnectionRepository) GetByID(ctx context.Context, id uuid.UUID) (*doma
 		SELECT 
 			id, workspace_id, name, database_type, host, port,
 			database_name, username, credentials_encrypted, ssl_mode,
-			read_only, max_rows, timeout_seconds, created_at, updated_at
+			read_only, max_rows, timeout_seconds, schema_cache_ttl_seconds, max_estimated_rows, error_rate_threshold, default_limit, schema_order, replica_host, replica_port, replica_use, created_at, updated_at
 		FROM connections
 		WHERE id = $1
 	`
@@ -81,6 +89,14 @@ func (r *ConnectionRepository) GetByID(ctx context.Context, id uuid.UUID) (*doma
 		&conn.ReadOnly,
 		&conn.MaxRows,
 		&conn.TimeoutSeconds,
+		&conn.SchemaCacheTTLSeconds,
+		&conn.MaxEstimatedRows,
+		&conn.ErrorRateThreshold,
+		&conn.DefaultLimit,
+		&conn.SchemaOrder,
+		&conn.ReplicaHost,
+		&conn.ReplicaPort,
+		&conn.ReplicaUse,
 		&conn.CreatedAt,
 		&conn.UpdatedAt,
 	)
@@ -100,7 +116,7 @@ func (r *ConnectionRepository) GetByIDAndWorkspace(ctx context.Context, id, work
 		SELECT 
 			id, workspace_id, name, database_type, host, port,
 			database_name, username, credentials_encrypted, ssl_mode,
-			read_only, max_rows, timeout_seconds, created_at, updated_at
+			read_only, max_rows, timeout_seconds, schema_cache_ttl_seconds, max_estimated_rows, error_rate_threshold, default_limit, schema_order, replica_host, replica_port, replica_use, created_at, updated_at
 		FROM connections
 		WHERE id = $1 AND workspace_id = $2
 	`
@@ -120,6 +136,14 @@ func (r *ConnectionRepository) GetByIDAndWorkspace(ctx context.Context, id, work
 		&conn.ReadOnly,
 		&conn.MaxRows,
 		&conn.TimeoutSeconds,
+		&conn.SchemaCacheTTLSeconds,
+		&conn.MaxEstimatedRows,
+		&conn.ErrorRateThreshold,
+		&conn.DefaultLimit,
+		&conn.SchemaOrder,
+		&conn.ReplicaHost,
+		&conn.ReplicaPort,
+		&conn.ReplicaUse,
 		&conn.CreatedAt,
 		&conn.UpdatedAt,
 	)
@@ -139,7 +163,7 @@ func (r *ConnectionRepository) ListByWorkspace(ctx context.Context, workspaceID
 		SELECT 
 			id, workspace_id, name, database_type, host, port,
 			database_name, username, credentials_encrypted, ssl_mode,
-			read_only, max_rows, timeout_seconds, created_at, updated_at
+			read_only, max_rows, timeout_seconds, schema_cache_ttl_seconds, max_estimated_rows, error_rate_threshold, default_limit, schema_order, replica_host, replica_port, replica_use, created_at, updated_at
 		FROM connections
 		WHERE workspace_id = $1
 		ORDER BY created_at DESC
@@ -168,6 +192,14 @@ func (r *ConnectionRepository) ListByWorkspace(ctx context.Context, workspaceID
 			&conn.ReadOnly,
 			&conn.MaxRows,
 			&conn.TimeoutSeconds,
+			&conn.SchemaCacheTTLSeconds,
+			&conn.MaxEstimatedRows,
+			&conn.ErrorRateThreshold,
+			&conn.DefaultLimit,
+			&conn.SchemaOrder,
+			&conn.ReplicaHost,
+			&conn.ReplicaPort,
+			&conn.ReplicaUse,
 			&conn.CreatedAt,
 			&conn.UpdatedAt,
 		); err != nil {
@@ -193,6 +225,14 @@ func (r *ConnectionRepository) Update(ctx context.Context, id uuid.UUID, conn *d
 		    read_only = $9,
 		    max_rows = $10,
 		    timeout_seconds = $11,
+		    schema_cache_ttl_seconds = $12,
+		    max_estimated_rows = $13,
+		    error_rate_threshold = $14,
+		    default_limit = $15,
+		    schema_order = COALESCE(NULLIF($16, ''), schema_order),
+		    replica_host = $17,
+		    replica_port = $18,
+		    replica_use = COALESCE(NULLIF($19, ''), replica_use),
 		    updated_at = NOW()
 		WHERE id = $1
 	`
@@ -209,6 +249,14 @@ func (r *ConnectionRepository) Update(ctx context.Context, id uuid.UUID, conn *d
 		conn.ReadOnly,
 		conn.MaxRows,
 		conn.TimeoutSeconds,
+		conn.SchemaCacheTTLSeconds,
+		conn.MaxEstimatedRows,
+		conn.ErrorRateThreshold,
+		conn.DefaultLimit,
+		conn.SchemaOrder,
+		conn.ReplicaHost,
+		conn.ReplicaPort,
+		conn.ReplicaUse,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update connection: %w", err)
@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ConnectionSchemaRepository implements domain.ConnectionSchemaRepository
+type ConnectionSchemaRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewConnectionSchemaRepository creates a new connection schema repository
+func NewConnectionSchemaRepository(pool *pgxpool.Pool) *ConnectionSchemaRepository {
+	return &ConnectionSchemaRepository{pool: pool}
+}
+
+// Get returns the stored schema of a connection, or nil if there is none
+func (r *ConnectionSchemaRepository) Get(ctx context.Context, connectionID uuid.UUID) (*domain.SchemaInfo, error) {
+	var data []byte
+	var schema domain.SchemaInfo
+	err := r.pool.QueryRow(ctx, `
+		SELECT schema, hash, refreshed_at FROM connection_schemas WHERE connection_id = $1
+	`, connectionID).Scan(&data, &schema.Hash, &schema.CachedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored schema: %w", err)
+	}
+
+	hash, refreshedAt := schema.Hash, schema.CachedAt
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to decode stored schema: %w", err)
+	}
+	schema.Hash, schema.CachedAt = hash, refreshedAt
+	return &schema, nil
+}
+
+// Save replaces the stored schema of a connection
+func (r *ConnectionSchemaRepository) Save(ctx context.Context, connectionID uuid.UUID, schema *domain.SchemaInfo) error {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return fmt.Errorf("failed to encode schema: %w", err)
+	}
+	hash := schema.Hash
+	if hash == "" {
+		hash = schema.ContentHash()
+	}
+
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO connection_schemas (connection_id, schema, hash, refreshed_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (connection_id) DO UPDATE
+		SET schema = EXCLUDED.schema, hash = EXCLUDED.hash, refreshed_at = EXCLUDED.refreshed_at
+	`, connectionID, data, hash, schema.CachedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save schema: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the stored schema of a connection
+func (r *ConnectionSchemaRepository) Delete(ctx context.Context, connectionID uuid.UUID) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM connection_schemas WHERE connection_id = $1`, connectionID); err != nil {
+		return fmt.Errorf("failed to delete stored schema: %w", err)
+	}
+	return nil
+}
+
+// DeleteAll removes every stored schema
+func (r *ConnectionSchemaRepository) DeleteAll(ctx context.Context) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM connection_schemas`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stored schemas: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionSchemaRepository(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	conn := &domain.Connection{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Name:         "warehouse",
+		DatabaseType: domain.DatabaseTypePostgres,
+		Host:         "localhost",
+		Port:         5432,
+		Database:     "warehouse",
+		Username:     "reader",
+		SSLMode:      "disable",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	require.NoError(t, NewConnectionRepository(&DB{Pool: pool}).Create(ctx, conn))
+
+	repo := NewConnectionSchemaRepository(pool)
+	stored, err := repo.Get(ctx, conn.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+
+	schema := &domain.SchemaInfo{
+		DatabaseType: "postgres",
+		Tables:       []domain.TableInfo{{Name: "orders", Columns: []domain.ColumnInfo{{Name: "id", DataType: "integer", PrimaryKey: true}}}},
+		DDL:          "CREATE TABLE orders (id integer PRIMARY KEY);",
+		CachedAt:     time.Now().Add(-time.Minute).UTC().Truncate(time.Microsecond),
+	}
+	require.NoError(t, repo.Save(ctx, conn.ID, schema))
+	schema.DDL = "CREATE TABLE orders (\n  id integer PRIMARY KEY\n);"
+	require.NoError(t, repo.Save(ctx, conn.ID, schema))
+
+	stored, err = repo.Get(ctx, conn.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, schema.DDL, stored.DDL)
+	assert.Equal(t, schema.Tables, stored.Tables)
+	assert.Equal(t, schema.ContentHash(), stored.Hash)
+	assert.True(t, schema.CachedAt.Equal(stored.CachedAt))
+
+	require.NoError(t, repo.Delete(ctx, conn.ID))
+	stored, err = repo.Get(ctx, conn.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
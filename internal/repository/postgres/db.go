@@ -5,9 +5,16 @@ import (
 	"fmt"
 
 	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// execer is satisfied by both *pgxpool.Pool and pgx.Tx
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
 // DB wraps the database connection pool
 type DB struct {
 	Pool *pgxpool.Pool
@@ -22,6 +29,15 @@ func NewDB(ctx context.Context, cfg config.DatabaseConfig) (*DB, error) {
 
 	poolConfig.MaxConns = cfg.MaxConns
 	poolConfig.MinConns = cfg.MinConns
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolConfig.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
@@ -47,3 +63,19 @@ func (db *DB) Close() {
 func (db *DB) Ping(ctx context.Context) error {
 	return db.Pool.Ping(ctx)
 }
+
+// PoolStats reports the connection pool
+func (db *DB) PoolStats() domain.PoolStats {
+	if db.Pool == nil {
+		return domain.PoolStats{}
+	}
+	s := db.Pool.Stat()
+	return domain.PoolStats{
+		MaxConns:      s.MaxConns(),
+		TotalConns:    s.TotalConns(),
+		AcquiredConns: s.AcquiredConns(),
+		IdleConns:     s.IdleConns(),
+		WaitCount:     s.EmptyAcquireCount(),
+		WaitMs:        s.AcquireDuration().Milliseconds(),
+	}
+}
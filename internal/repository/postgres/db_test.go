@@ -0,0 +1,42 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestPool connects to TEST_DATABASE_URL and migrates it, skipping the test when unset
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	require.NoError(t, RunMigrations(dsn, "file://../../../migrations"))
+
+	pool, err := pgxpool.New(context.Background(), dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// createTestSession inserts a workspace with one chat session, removed again on cleanup
+func createTestSession(t *testing.T, pool *pgxpool.Pool, workspaceID, sessionID uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `INSERT INTO workspaces (id, name) VALUES ($1, 'test workspace')`, workspaceID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM workspaces WHERE id = $1`, workspaceID)
+	})
+
+	_, err = pool.Exec(ctx, `INSERT INTO chat_sessions (id, workspace_id) VALUES ($1, $2)`, sessionID, workspaceID)
+	require.NoError(t, err)
+}
@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ExperimentRepository implements domain.ExperimentRepository over the answers in chat_messages
+type ExperimentRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewExperimentRepository creates a new experiment repository
+func NewExperimentRepository(pool *pgxpool.Pool) *ExperimentRepository {
+	return &ExperimentRepository{pool: pool}
+}
+
+// CountByArm counts the answers given in a workspace by the arms of an experiment since
+// the given time, grouped by arm and status
+func (r *ExperimentRepository) CountByArm(ctx context.Context, workspaceID uuid.UUID, experiment string, since time.Time) ([]domain.ExperimentArmCount, error) {
+	query := `
+		SELECT
+			experiment_arm,
+			status,
+			COUNT(*),
+			COALESCE(SUM(latency_ms), 0),
+			COUNT(latency_ms),
+			COALESCE(SUM(CASE WHEN jsonb_typeof(metadata->'tokens_used') = 'number'
+				THEN (metadata->>'tokens_used')::BIGINT END), 0)
+		FROM chat_messages
+		WHERE workspace_id = $1
+			AND experiment = $2
+			AND role = 'assistant'
+			AND status IS NOT NULL
+			AND created_at >= $3
+		GROUP BY 1, 2
+	`
+
+	rows, err := r.pool.Query(ctx, query, workspaceID, experiment, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count experiment answers: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.ExperimentArmCount
+	for rows.Next() {
+		var c domain.ExperimentArmCount
+		var status string
+		if err := rows.Scan(&c.Arm, &status, &c.Count, &c.TotalLatencyMs, &c.LatencyCount, &c.TotalTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan experiment count: %w", err)
+		}
+		c.Status = domain.QueryStatus(status)
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
@@ -3,16 +3,20 @@ package postgres
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // MessageRepository implements domain.MessageRepository
 type MessageRepository struct {
-	pool *pgxpool.Pool
+	pool        *pgxpool.Pool
+	resultLimit domain.StoredResultLimit
 }
 
 // NewMessageRepository creates a new message repository
@@ -20,20 +24,72 @@ func NewMessageRepository(pool *pgxpool.Pool) *MessageRepository {
 	return &MessageRepository{pool: pool}
 }
 
-// MessageRepository defines the interface for message storage (copying interface here to avoid import cycle if in domain, but it is in domain) - ah this is implementation.
+// WithResultLimit caps the results stored with messages. Callers keep the full result;
+// only the stored copy is trimmed.
+func (r *MessageRepository) WithResultLimit(limit domain.StoredResultLimit) *MessageRepository {
+	r.resultLimit = limit
+	return r
+}
 
 // Create inserts a new message
 func (r *MessageRepository) Create(ctx context.Context, message *domain.Message) error {
+	return insertMessage(ctx, r.pool, message, r.resultLimit)
+}
+
+// CreateConversationTurn inserts a question and its answer and bumps the session in one
+// transaction, creating the session first when the turn starts a new one
+func (r *MessageRepository) CreateConversationTurn(ctx context.Context, turn *domain.ConversationTurn) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if turn.NewSession != nil {
+		if err := insertSession(ctx, tx, turn.NewSession); err != nil {
+			return err
+		}
+	}
+	if err := insertMessage(ctx, tx, turn.UserMessage, r.resultLimit); err != nil {
+		return err
+	}
+	if err := insertMessage(ctx, tx, turn.AssistantMessage, r.resultLimit); err != nil {
+		return err
+	}
+
+	// A single statement avoids racing concurrent turns in the same session
 	query := `
-		INSERT INTO chat_messages (id, workspace_id, user_id, session_id, role, content, sql, result, metadata, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		UPDATE chat_sessions
+		SET updated_at = NOW(),
+			title = CASE WHEN title = $2 AND $3 <> '' THEN $3 ELSE title END,
+			connection_id = CASE WHEN $5 AND $4::uuid IS NOT NULL THEN $4 ELSE COALESCE(connection_id, $4) END
+		WHERE id = $1
+	`
+	if _, err := tx.Exec(ctx, query, turn.SessionID, domain.DefaultSessionTitle, turn.Title, turn.ConnectionID, turn.SwitchConnection); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit conversation turn: %w", err)
+	}
+	return nil
+}
+
+func insertMessage(ctx context.Context, db execer, message *domain.Message, limit domain.StoredResultLimit) error {
+	query := `
+		INSERT INTO chat_messages (
+			id, workspace_id, user_id, session_id, role, content, sql, result, metadata,
+			error, status, row_count, latency_ms, experiment, experiment_arm, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''), $12, $13,
+			NULLIF($14, ''), NULLIF($15, ''), $16)
 	`
 
 	// Marshal metadata and result to JSON if needed
 	var resultJSON, metadataJSON []byte
 	if message.Result != nil {
 		var err error
-		resultJSON, err = json.Marshal(message.Result)
+		resultJSON, err = json.Marshal(message.Result.ForStorage(limit))
 		if err != nil {
 			return fmt.Errorf("failed to marshal result: %w", err)
 		}
@@ -46,7 +102,12 @@ func (r *MessageRepository) Create(ctx context.Context, message *domain.Message)
 		}
 	}
 
-	_, err := r.pool.Exec(ctx, query,
+	var experiment domain.ExperimentAssignment
+	if message.Metadata != nil && message.Metadata.Experiment != nil {
+		experiment = *message.Metadata.Experiment
+	}
+
+	_, err := db.Exec(ctx, query,
 		message.ID,
 		message.WorkspaceID,
 		message.UserID,
@@ -56,6 +117,12 @@ func (r *MessageRepository) Create(ctx context.Context, message *domain.Message)
 		message.SQL,
 		resultJSON,   // Pass JSON bytes
 		metadataJSON, // Pass JSON bytes
+		message.Error,
+		message.Status,
+		message.RowCount,
+		message.LatencyMs,
+		experiment.Experiment,
+		experiment.Arm,
 		message.CreatedAt,
 	)
 	if err != nil {
@@ -65,67 +132,116 @@ func (r *MessageRepository) Create(ctx context.Context, message *domain.Message)
 	return nil
 }
 
+// messageColumns is the column list scanned by scanMessage
+const messageColumns = `id, workspace_id, user_id, session_id, role, content, COALESCE(sql, ''), result, metadata,
+	COALESCE(error, ''), COALESCE(status, ''), row_count, latency_ms, created_at`
+
+// inDeletedSession matches messages belonging to a soft-deleted session
+const inDeletedSession = `EXISTS (
+	SELECT 1 FROM chat_sessions s WHERE s.id = chat_messages.session_id AND s.deleted_at IS NOT NULL
+)`
+
 // ListBySession retrieves messages for a specific session
 func (r *MessageRepository) ListBySession(ctx context.Context, sessionID uuid.UUID, limit int) ([]domain.Message, error) {
 	query := `
-		SELECT id, workspace_id, user_id, session_id, role, content, sql, result, metadata, created_at
+		SELECT ` + messageColumns + `
 		FROM chat_messages
 		WHERE session_id = $1
 		ORDER BY created_at DESC
 		LIMIT $2
 	`
 
-	rows, err := r.pool.Query(ctx, query, sessionID, limit)
+	return r.listLatest(ctx, query, sessionID, limit)
+}
+
+// ListByWorkspace retrieves the most recent messages across a workspace
+func (r *MessageRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]domain.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM chat_messages
+		WHERE workspace_id = $1 AND NOT ` + inDeletedSession + `
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+
+	return r.listLatest(ctx, query, workspaceID, limit)
+}
+
+// GetByIDAndWorkspace retrieves a message of a workspace, or nil if there is none or
+// its session was deleted
+func (r *MessageRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM chat_messages
+		WHERE id = $1 AND workspace_id = $2 AND NOT ` + inDeletedSession
+
+	m, err := scanMessage(r.pool.QueryRow(ctx, query, id, workspaceID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list messages: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
-	defer rows.Close()
+	return m, nil
+}
 
-	var messages []domain.Message
-	for rows.Next() {
-		var m domain.Message
-		var roleStr string
-
-		if err := rows.Scan(
-			&m.ID,
-			&m.WorkspaceID,
-			&m.UserID,
-			&m.SessionID,
-			&roleStr,
-			&m.Content,
-			&m.SQL,
-			&m.Result,
-			&m.Metadata,
-			&m.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-		m.Role = domain.MessageRole(roleStr)
-		messages = append(messages, m)
+// GetQuestion returns the latest user message before answer in its session, or ""
+// if there is none
+func (r *MessageRepository) GetQuestion(ctx context.Context, answer *domain.Message) (string, error) {
+	if answer.SessionID == nil {
+		return "", nil
 	}
 
-	// Reverse to return chronological order (oldest first)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	var question string
+	err := r.pool.QueryRow(ctx, `
+		SELECT content
+		FROM chat_messages
+		WHERE session_id = $1 AND role = 'user' AND created_at <= $2
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, *answer.SessionID, answer.CreatedAt).Scan(&question)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get question: %w", err)
 	}
-
-	return messages, nil
+	return question, nil
 }
 
-// ListByWorkspace retrieves recent messages for a workspace (Deprecated or use for overview?)
-// Keeping it but maybe modifying to only show latest messages globally or just use session list.
-func (r *MessageRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]domain.Message, error) {
-	// ... existing implementation but adding session_id scan ...
-	query := `
-		SELECT id, workspace_id, user_id, session_id, role, content, sql, result, metadata, created_at
+// ListRecentSQL returns the SQL of the latest successful answers on a connection,
+// most recent first
+func (r *MessageRepository) ListRecentSQL(ctx context.Context, workspaceID, connectionID uuid.UUID, limit int) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT sql
 		FROM chat_messages
 		WHERE workspace_id = $1
+			AND role = 'assistant'
+			AND status = 'ok'
+			AND sql <> ''
+			AND metadata->>'connection_id' = $2::text
 		ORDER BY created_at DESC
-		LIMIT $2
-	`
-	// ... rest of implementation similar to ListBySession but with workspace_id filter
+		LIMIT $3
+	`, workspaceID, connectionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent SQL: %w", err)
+	}
+	defer rows.Close()
+
+	var queries []string
+	for rows.Next() {
+		var sql string
+		if err := rows.Scan(&sql); err != nil {
+			return nil, fmt.Errorf("failed to scan SQL: %w", err)
+		}
+		queries = append(queries, sql)
+	}
+	return queries, rows.Err()
+}
 
-	rows, err := r.pool.Query(ctx, query, workspaceID, limit)
+// listLatest runs a newest-first message query and returns the rows oldest first
+func (r *MessageRepository) listLatest(ctx context.Context, query string, args ...any) ([]domain.Message, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list messages: %w", err)
 	}
@@ -133,25 +249,14 @@ func (r *MessageRepository) ListByWorkspace(ctx context.Context, workspaceID uui
 
 	var messages []domain.Message
 	for rows.Next() {
-		var m domain.Message
-		var roleStr string
-
-		if err := rows.Scan(
-			&m.ID,
-			&m.WorkspaceID,
-			&m.UserID,
-			&m.SessionID,
-			&roleStr,
-			&m.Content,
-			&m.SQL,
-			&m.Result,
-			&m.Metadata,
-			&m.CreatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-		m.Role = domain.MessageRole(roleStr)
-		messages = append(messages, m)
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
 	}
 
 	// Reverse to return chronological order (oldest first)
@@ -163,18 +268,165 @@ func (r *MessageRepository) ListByWorkspace(ctx context.Context, workspaceID uui
 	return messages, nil
 }
 
-// GetMostFrequentQuestions retrieves the most frequent user questions for a workspace
-func (r *MessageRepository) GetMostFrequentQuestions(ctx context.Context, workspaceID uuid.UUID, limit int) ([]string, error) {
+// scanMessage scans a row selected with messageColumns
+func scanMessage(row pgx.Row) (*domain.Message, error) {
+	var m domain.Message
+	var roleStr, statusStr string
+	var resultJSON, metadataJSON []byte
+
+	if err := row.Scan(
+		&m.ID,
+		&m.WorkspaceID,
+		&m.UserID,
+		&m.SessionID,
+		&roleStr,
+		&m.Content,
+		&m.SQL,
+		&resultJSON,
+		&metadataJSON,
+		&m.Error,
+		&statusStr,
+		&m.RowCount,
+		&m.LatencyMs,
+		&m.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan message: %w", err)
+	}
+	m.Role = domain.MessageRole(roleStr)
+	m.Status = domain.QueryStatus(statusStr)
+
+	if err := decodeMessageJSON(resultJSON, metadataJSON, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// decodeMessageJSON unmarshals the JSONB result and metadata columns. NULL leaves the field nil.
+func decodeMessageJSON(resultJSON, metadataJSON []byte, m *domain.Message) error {
+	if len(resultJSON) > 0 && string(resultJSON) != "null" {
+		var result domain.QueryResult
+		if err := json.Unmarshal(resultJSON, &result); err != nil {
+			return fmt.Errorf("failed to decode message result: %w", err)
+		}
+		m.Result = &result
+	}
+	if len(metadataJSON) > 0 && string(metadataJSON) != "null" {
+		var metadata domain.QueryMetadata
+		if err := json.Unmarshal(metadataJSON, &metadata); err != nil {
+			return fmt.Errorf("failed to decode message metadata: %w", err)
+		}
+		m.Metadata = &metadata
+	}
+	return nil
+}
+
+// TrimStoredResults applies the result limit to results stored before it was set, or
+// under a looser one, batch messages at a time. It returns how many were trimmed.
+func (r *MessageRepository) TrimStoredResults(ctx context.Context, batch int) (int, error) {
+	if r.resultLimit.MaxRows <= 0 && r.resultLimit.MaxBytes <= 0 {
+		return 0, nil
+	}
+	// Candidates are picked generously by the size of the JSONB text; ForStorage decides
 	query := `
-		SELECT content
+		SELECT id, result
 		FROM chat_messages
-		WHERE workspace_id = $1 AND role = 'user'
-		GROUP BY content
-		ORDER BY COUNT(*) DESC
-		LIMIT $2
+		WHERE id > $1
+			AND jsonb_typeof(result->'rows') = 'array'
+			AND (($2 > 0 AND jsonb_array_length(result->'rows') > $2)
+				OR ($3 > 0 AND octet_length(result::text) > $3))
+		ORDER BY id
+		LIMIT $4
+	`
+
+	trimmed := 0
+	after := uuid.Nil
+	for {
+		rows, err := r.pool.Query(ctx, query, after, r.resultLimit.MaxRows, r.resultLimit.MaxBytes, batch)
+		if err != nil {
+			return trimmed, fmt.Errorf("failed to find oversized results: %w", err)
+		}
+		updates := map[uuid.UUID][]byte{}
+		found := 0
+		for rows.Next() {
+			var id uuid.UUID
+			var resultJSON []byte
+			if err := rows.Scan(&id, &resultJSON); err != nil {
+				rows.Close()
+				return trimmed, fmt.Errorf("failed to scan result: %w", err)
+			}
+			found++
+			after = id
+
+			var result domain.QueryResult
+			if err := json.Unmarshal(resultJSON, &result); err != nil {
+				rows.Close()
+				return trimmed, fmt.Errorf("failed to decode result of message %s: %w", id, err)
+			}
+			stored := result.ForStorage(r.resultLimit)
+			if stored == &result {
+				continue
+			}
+			if updates[id], err = json.Marshal(stored); err != nil {
+				rows.Close()
+				return trimmed, fmt.Errorf("failed to marshal result: %w", err)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return trimmed, fmt.Errorf("failed to find oversized results: %w", err)
+		}
+
+		for id, resultJSON := range updates {
+			if _, err := r.pool.Exec(ctx, `UPDATE chat_messages SET result = $2 WHERE id = $1`, id, resultJSON); err != nil {
+				return trimmed, fmt.Errorf("failed to trim result of message %s: %w", id, err)
+			}
+			trimmed++
+		}
+		if found < batch {
+			return trimmed, nil
+		}
+	}
+}
+
+// GetMostFrequentQuestions retrieves the questions asked most often in a workspace.
+// Questions are grouped case-insensitively with trailing punctuation ignored and
+// reported in their latest wording. Questions whose answer failed and template runs
+// are skipped.
+func (r *MessageRepository) GetMostFrequentQuestions(ctx context.Context, workspaceID uuid.UUID, filter domain.FrequentQuestionFilter) ([]string, error) {
+	query := `
+		WITH questions AS (
+			SELECT
+				btrim(content) AS content,
+				regexp_replace(lower(btrim(content)), '[[:space:][:punct:]]+$', '') AS normalized,
+				created_at
+			FROM chat_messages
+			LEFT JOIN LATERAL (
+				SELECT a.error, a.status, a.metadata
+				FROM chat_messages a
+				WHERE a.session_id = chat_messages.session_id
+					AND a.role = 'assistant'
+					AND a.created_at >= chat_messages.created_at
+				ORDER BY a.created_at
+				LIMIT 1
+			) answer ON TRUE
+			WHERE workspace_id = $1
+				AND role = 'user'
+				AND NOT ` + inDeletedSession + `
+				AND answer.error IS NULL
+				AND answer.status IS DISTINCT FROM 'explained'
+				AND answer.metadata->'template' IS NULL
+				AND ($2::uuid IS NULL OR answer.metadata->>'connection_id' = $2::text)
+		)
+		SELECT (array_agg(content ORDER BY created_at DESC))[1]
+		FROM questions
+		WHERE char_length(normalized) >= $3
+		GROUP BY normalized
+		HAVING COUNT(*) >= $4
+		ORDER BY COUNT(*) DESC, MAX(created_at) DESC
+		LIMIT $5
 	`
 
-	rows, err := r.pool.Query(ctx, query, workspaceID, limit)
+	rows, err := r.pool.Query(ctx, query, workspaceID, filter.ConnectionID, filter.MinLength, max(filter.MinCount, 1), filter.Limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query frequent questions: %w", err)
 	}
@@ -189,5 +441,49 @@ func (r *MessageRepository) GetMostFrequentQuestions(ctx context.Context, worksp
 		questions = append(questions, q)
 	}
 
-	return questions, nil
+	return questions, rows.Err()
+}
+
+// CountByStatus counts the answers given in a workspace since the given time,
+// grouped by status, LLM provider and connection
+func (r *MessageRepository) CountByStatus(ctx context.Context, workspaceID uuid.UUID, since time.Time) ([]domain.QueryStatusCount, error) {
+	query := `
+		SELECT
+			m.status,
+			COALESCE(m.metadata->>'llm_provider', ''),
+			c.id,
+			COALESCE(c.name, ''),
+			COUNT(*),
+			COALESCE(SUM(m.latency_ms), 0),
+			COUNT(m.latency_ms)
+		FROM chat_messages m
+		LEFT JOIN connections c
+			ON c.id::text = m.metadata->>'connection_id' AND c.workspace_id = m.workspace_id
+		WHERE m.workspace_id = $1
+			AND m.role = 'assistant'
+			AND m.status IS NOT NULL
+			AND m.status <> 'explained'
+			AND m.created_at >= $2
+		GROUP BY 1, 2, 3, 4
+	`
+
+	rows, err := r.pool.Query(ctx, query, workspaceID, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages by status: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.QueryStatusCount
+	for rows.Next() {
+		var c domain.QueryStatusCount
+		var status string
+		if err := rows.Scan(&status, &c.LLMProvider, &c.ConnectionID, &c.ConnectionName,
+			&c.Count, &c.TotalLatencyMs, &c.LatencyCount); err != nil {
+			return nil, fmt.Errorf("failed to scan status count: %w", err)
+		}
+		c.Status = domain.QueryStatus(status)
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
 }
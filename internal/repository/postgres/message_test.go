@@ -0,0 +1,325 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testQueryResult() *domain.QueryResult {
+	return &domain.QueryResult{
+		Columns:   []string{"name", "total", "active", "note"},
+		Rows:      [][]any{{"alice", 12.5, true, nil}, {"bob", float64(3), false, "x"}},
+		RowCount:  2,
+		Truncated: true,
+	}
+}
+
+func testQueryMetadata() *domain.QueryMetadata {
+	return &domain.QueryMetadata{
+		ConnectionID:    uuid.New(),
+		DatabaseType:    "postgres",
+		LLMProvider:     "openai",
+		LLMModel:        "gpt-4o",
+		ExecutionTimeMs: 42,
+		LLMLatencyMs:    900,
+		TokensUsed:      321,
+	}
+}
+
+func TestDecodeMessageJSON(t *testing.T) {
+	result, metadata := testQueryResult(), testQueryMetadata()
+	resultJSON, err := json.Marshal(result)
+	require.NoError(t, err)
+	metadataJSON, err := json.Marshal(metadata)
+	require.NoError(t, err)
+
+	var m domain.Message
+	require.NoError(t, decodeMessageJSON(resultJSON, metadataJSON, &m))
+	assert.Equal(t, result, m.Result)
+	assert.Equal(t, metadata, m.Metadata)
+
+	t.Run("null columns", func(t *testing.T) {
+		var m domain.Message
+		require.NoError(t, decodeMessageJSON(nil, []byte("null"), &m))
+		assert.Nil(t, m.Result)
+		assert.Nil(t, m.Metadata)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		var m domain.Message
+		assert.Error(t, decodeMessageJSON([]byte(`{"rows":"nope"}`), nil, &m))
+	})
+}
+
+func TestMessageRepository_RoundTrip(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, sessionID)
+
+	repo := NewMessageRepository(pool)
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	rowCount, latency := 2, int64(1234)
+
+	question := &domain.Message{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		SessionID:   &sessionID,
+		Role:        domain.RoleUser,
+		Content:     "how many users?",
+		CreatedAt:   now,
+	}
+	answer := &domain.Message{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		SessionID:   &sessionID,
+		Role:        domain.RoleAssistant,
+		Content:     "Here are the totals",
+		SQL:         "SELECT name, total FROM users",
+		Result:      testQueryResult(),
+		Metadata:    testQueryMetadata(),
+		Status:      domain.QueryStatusOK,
+		RowCount:    &rowCount,
+		LatencyMs:   &latency,
+		CreatedAt:   now.Add(time.Second),
+	}
+	require.NoError(t, repo.Create(ctx, question))
+	require.NoError(t, repo.Create(ctx, answer))
+
+	messages, err := repo.ListBySession(ctx, sessionID, 10)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+
+	assert.Equal(t, question.ID, messages[0].ID)
+	assert.Nil(t, messages[0].Result)
+	assert.Nil(t, messages[0].Metadata)
+	assert.Empty(t, messages[0].SQL)
+	assert.Empty(t, messages[0].Status)
+	assert.Nil(t, messages[0].RowCount)
+
+	got := messages[1]
+	assert.Equal(t, answer.ID, got.ID)
+	assert.Equal(t, answer.SQL, got.SQL)
+	assert.Equal(t, answer.Result, got.Result)
+	assert.Equal(t, answer.Metadata, got.Metadata)
+	assert.Equal(t, answer.Status, got.Status)
+	assert.Equal(t, answer.RowCount, got.RowCount)
+	assert.Equal(t, answer.LatencyMs, got.LatencyMs)
+	assert.True(t, answer.CreatedAt.Equal(got.CreatedAt))
+}
+
+func TestMessageRepository_CreateConversationTurn(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(pool)
+	sessions := NewSessionRepository(pool)
+
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New()) // workspace only; the turn creates its own session
+	now := time.Now()
+	salesDB, crmDB := uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{salesDB, crmDB} {
+		_, err := pool.Exec(ctx, `
+			INSERT INTO connections (id, workspace_id, name, database_type, host, port, database_name, username, credentials_encrypted)
+			VALUES ($1, $2, $3, 'postgres', 'localhost', 5432, 'db', 'reader', '\x00')
+		`, id, workspaceID, id.String())
+		require.NoError(t, err)
+	}
+
+	newTurn := func(title string, newSession *domain.ChatSession) *domain.ConversationTurn {
+		return &domain.ConversationTurn{
+			NewSession: newSession,
+			SessionID:  sessionID,
+			UserMessage: &domain.Message{
+				ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID,
+				Role: domain.RoleUser, Content: title, CreatedAt: now,
+			},
+			AssistantMessage: &domain.Message{
+				ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID,
+				Role: domain.RoleAssistant, Content: "answer", CreatedAt: now.Add(time.Millisecond),
+			},
+			Title: title,
+		}
+	}
+
+	first := newTurn("first question", &domain.ChatSession{
+		ID: sessionID, WorkspaceID: workspaceID, Title: domain.DefaultSessionTitle, ConnectionID: &salesDB, CreatedAt: now, UpdatedAt: now,
+	})
+	require.NoError(t, repo.CreateConversationTurn(ctx, first))
+	require.NoError(t, repo.CreateConversationTurn(ctx, newTurn("second question", nil)))
+
+	session, err := sessions.Get(ctx, sessionID)
+	require.NoError(t, err)
+	assert.Equal(t, "first question", session.Title, "only the default title is replaced")
+	assert.True(t, session.UpdatedAt.After(now))
+	require.NotNil(t, session.ConnectionID)
+	assert.Equal(t, salesDB, *session.ConnectionID, "a turn without a connection keeps the session's")
+
+	other := newTurn("other question", nil)
+	other.ConnectionID = &crmDB
+	require.NoError(t, repo.CreateConversationTurn(ctx, other))
+	session, err = sessions.Get(ctx, sessionID)
+	require.NoError(t, err)
+	assert.Equal(t, salesDB, *session.ConnectionID, "the first connection stays without a switch")
+
+	switched := newTurn("switched question", nil)
+	switched.ConnectionID, switched.SwitchConnection = &crmDB, true
+	require.NoError(t, repo.CreateConversationTurn(ctx, switched))
+	session, err = sessions.Get(ctx, sessionID)
+	require.NoError(t, err)
+	assert.Equal(t, crmDB, *session.ConnectionID)
+
+	messages, err := repo.ListBySession(ctx, sessionID, 10)
+	require.NoError(t, err)
+	assert.Len(t, messages, 8)
+
+	t.Run("failure writes nothing", func(t *testing.T) {
+		turn := newTurn("third question", nil)
+		turn.AssistantMessage.ID = first.AssistantMessage.ID // duplicate key
+		assert.Error(t, repo.CreateConversationTurn(ctx, turn))
+
+		messages, err := repo.ListBySession(ctx, sessionID, 10)
+		require.NoError(t, err)
+		assert.Len(t, messages, 8, "the user message is rolled back with the failed answer")
+	})
+}
+
+func TestMessageRepository_GetMostFrequentQuestions(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(pool)
+
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, sessionID)
+	salesDB, logsDB := uuid.New(), uuid.New()
+
+	at := time.Now().Add(-time.Hour)
+	ask := func(question string, connectionID uuid.UUID, answerErr string) {
+		at = at.Add(time.Second)
+		require.NoError(t, repo.Create(ctx, &domain.Message{
+			ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID,
+			Role: domain.RoleUser, Content: question, CreatedAt: at,
+		}))
+		at = at.Add(time.Second)
+		require.NoError(t, repo.Create(ctx, &domain.Message{
+			ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID,
+			Role: domain.RoleAssistant, Content: "answer", Error: answerErr,
+			Metadata: &domain.QueryMetadata{ConnectionID: connectionID}, CreatedAt: at,
+		}))
+	}
+
+	ask("show revenue", salesDB, "")
+	ask("Show revenue?", salesDB, "")
+	ask("  show REVENUE!! ", salesDB, "")
+	ask("hi", salesDB, "")
+	ask("hi", salesDB, "")
+	ask("count error lines", logsDB, "")
+	ask("count error lines", logsDB, "")
+	ask("list broken things", salesDB, "relation does not exist")
+	ask("list broken things", salesDB, "relation does not exist")
+	ask("asked only once", salesDB, "")
+
+	filter := domain.FrequentQuestionFilter{MinLength: 8, MinCount: 2, Limit: 10}
+	questions, err := repo.GetMostFrequentQuestions(ctx, workspaceID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"show REVENUE!!", "count error lines"}, questions)
+
+	filter.ConnectionID = &logsDB
+	questions, err = repo.GetMostFrequentQuestions(ctx, workspaceID, filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"count error lines"}, questions)
+}
+
+func TestMessageRepository_CountByStatus(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewMessageRepository(pool)
+
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, sessionID)
+
+	salesDB, deletedDB := uuid.New(), uuid.New()
+	_, err := pool.Exec(ctx, `
+		INSERT INTO connections (id, workspace_id, name, database_type, host, port, database_name, username, credentials_encrypted)
+		VALUES ($1, $2, 'sales', 'postgres', 'localhost', 5432, 'sales', 'reader', '\x00')
+	`, salesDB, workspaceID)
+	require.NoError(t, err)
+
+	answer := func(status domain.QueryStatus, connectionID uuid.UUID, latency int64, age time.Duration) {
+		require.NoError(t, repo.Create(ctx, &domain.Message{
+			ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID,
+			Role: domain.RoleAssistant, Content: "answer", Status: status, LatencyMs: &latency,
+			Metadata:  &domain.QueryMetadata{ConnectionID: connectionID, LLMProvider: "openai"},
+			CreatedAt: time.Now().Add(-age),
+		}))
+	}
+	answer(domain.QueryStatusOK, salesDB, 100, time.Hour)
+	answer(domain.QueryStatusOK, salesDB, 300, time.Hour)
+	answer(domain.QueryStatusTimeout, deletedDB, 5000, time.Hour)
+	answer(domain.QueryStatusOK, salesDB, 100, 40*24*time.Hour)  // outside the window
+	answer(domain.QueryStatusExplained, salesDB, 900, time.Hour) // not an answer
+
+	counts, err := repo.CountByStatus(ctx, workspaceID, time.Now().AddDate(0, 0, -30))
+	require.NoError(t, err)
+	require.Len(t, counts, 2)
+
+	byStatus := map[domain.QueryStatus]domain.QueryStatusCount{}
+	for _, c := range counts {
+		byStatus[c.Status] = c
+	}
+
+	ok := byStatus[domain.QueryStatusOK]
+	assert.Equal(t, 2, ok.Count)
+	assert.Equal(t, "openai", ok.LLMProvider)
+	assert.Equal(t, &salesDB, ok.ConnectionID)
+	assert.Equal(t, "sales", ok.ConnectionName)
+	assert.Equal(t, int64(400), ok.TotalLatencyMs)
+	assert.Equal(t, 2, ok.LatencyCount)
+
+	timeout := byStatus[domain.QueryStatusTimeout]
+	assert.Equal(t, 1, timeout.Count)
+	assert.Nil(t, timeout.ConnectionID, "connections that no longer exist are not resolved")
+}
+
+func TestMessageRepository_StoredResultLimit(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, sessionID)
+
+	answer := func(repo *MessageRepository) *domain.Message {
+		m := &domain.Message{
+			ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID,
+			Role: domain.RoleAssistant, Content: "answer", Result: testQueryResult(), CreatedAt: time.Now(),
+		}
+		require.NoError(t, repo.Create(ctx, m))
+		return m
+	}
+	limit := domain.StoredResultLimit{MaxRows: 1}
+
+	stored := answer(NewMessageRepository(pool).WithResultLimit(limit))
+	assert.Len(t, stored.Result.Rows, 2, "the caller keeps the full result")
+	got, err := NewMessageRepository(pool).GetByIDAndWorkspace(ctx, stored.ID, workspaceID)
+	require.NoError(t, err)
+	assert.Len(t, got.Result.Rows, 1)
+	assert.True(t, got.Result.StoredTruncated)
+	assert.Equal(t, 2, got.Result.RowCount)
+
+	legacy := answer(NewMessageRepository(pool))
+	trimmed, err := NewMessageRepository(pool).WithResultLimit(limit).TrimStoredResults(ctx, 1)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, trimmed, 1)
+	got, err = NewMessageRepository(pool).GetByIDAndWorkspace(ctx, legacy.ID, workspaceID)
+	require.NoError(t, err)
+	assert.Len(t, got.Result.Rows, 1)
+	assert.True(t, got.Result.StoredTruncated)
+}
@@ -4,18 +4,43 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
+// MigrationSource returns the migrations source URL: MIGRATION_SOURCE if set,
+// /app/migrations inside the Docker image, ./migrations otherwise
+func MigrationSource() string {
+	source := "file://./migrations"
+	if env := os.Getenv("MIGRATION_SOURCE"); env != "" {
+		source = env
+	}
+	// In Docker, we copy migrations to /app/migrations
+	if _, err := os.Stat("/app/migrations"); err == nil {
+		source = "file:///app/migrations"
+	}
+	return source
+}
+
+// NewMigrator creates a golang-migrate instance for the given database and source
+func NewMigrator(dsn string, sourceURL string) (*migrate.Migrate, error) {
+	m, err := migrate.New(sourceURL, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
+	}
+	return m, nil
+}
+
 // RunMigrations executes database migrations from the specified source URL
 func RunMigrations(dsn string, sourceURL string) error {
-	m, err := migrate.New(sourceURL, dsn)
+	m, err := NewMigrator(dsn, sourceURL)
 	if err != nil {
-		return fmt.Errorf("failed to create migrate instance: %w", err)
+		return err
 	}
+	defer m.Close()
 
 	if err := m.Up(); err != nil {
 		if errors.Is(err, migrate.ErrNoChange) {
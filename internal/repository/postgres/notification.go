@@ -0,0 +1,107 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// notificationColumns is the column list scanned by scanNotification
+const notificationColumns = `id, user_id, workspace_id, type, payload, read_at, created_at`
+
+// NotificationRepository implements domain.NotificationRepository
+type NotificationRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(pool *pgxpool.Pool) *NotificationRepository {
+	return &NotificationRepository{pool: pool}
+}
+
+// CreateForUser adds a notification for one user unless they turned its type off
+func (r *NotificationRepository) CreateForUser(ctx context.Context, userID uuid.UUID, workspaceID *uuid.UUID, notificationType string, payload json.RawMessage) (*domain.Notification, error) {
+	rows, err := r.pool.Query(ctx, `
+		INSERT INTO notifications (id, user_id, workspace_id, type, payload, created_at)
+		SELECT $1, u.id, $3, $4, $5, NOW()
+		FROM users u
+		WHERE u.id = $2 AND u.deactivated_at IS NULL AND NOT ($4 = ANY(u.muted_notifications))
+		RETURNING `+notificationColumns,
+		uuid.New(), userID, workspaceID, notificationType, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+	notifications, err := collectNotifications(rows)
+	if err != nil || len(notifications) == 0 {
+		return nil, err
+	}
+	return &notifications[0], nil
+}
+
+// CreateForWorkspace adds a notification for each active member of a workspace who
+// did not turn its type off
+func (r *NotificationRepository) CreateForWorkspace(ctx context.Context, workspaceID uuid.UUID, notificationType string, payload json.RawMessage) ([]domain.Notification, error) {
+	rows, err := r.pool.Query(ctx, `
+		INSERT INTO notifications (id, user_id, workspace_id, type, payload, created_at)
+		SELECT gen_random_uuid(), u.id, m.workspace_id, $2, $3, NOW()
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1 AND u.deactivated_at IS NULL AND NOT ($2 = ANY(u.muted_notifications))
+		RETURNING `+notificationColumns,
+		workspaceID, notificationType, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifications: %w", err)
+	}
+	return collectNotifications(rows)
+}
+
+// ListByUser returns a user's notifications, newest first
+func (r *NotificationRepository) ListByUser(ctx context.Context, userID uuid.UUID, filter domain.NotificationFilter) ([]domain.Notification, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		ORDER BY created_at DESC
+		LIMIT $3
+	`, userID, filter.UnreadOnly, filter.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	return collectNotifications(rows)
+}
+
+// MarkRead marks a notification of a user read, keeping the time it was first read
+func (r *NotificationRepository) MarkRead(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE notifications SET read_at = COALESCE(read_at, $3)
+		WHERE id = $1 AND user_id = $2
+	`, id, userID, at)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// collectNotifications scans rows selected with notificationColumns
+func collectNotifications(rows pgx.Rows) ([]domain.Notification, error) {
+	defer rows.Close()
+
+	notifications := []domain.Notification{}
+	for rows.Next() {
+		var n domain.Notification
+		if err := rows.Scan(&n.ID, &n.UserID, &n.WorkspaceID, &n.Type, &n.Payload, &n.ReadAt, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read notifications: %w", err)
+	}
+	return notifications, nil
+}
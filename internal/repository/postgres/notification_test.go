@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotificationRepository(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	users := NewUserRepository(&DB{Pool: pool})
+	workspaces := NewWorkspaceRepository(&DB{Pool: pool})
+	newMember := func(muted ...string) *domain.User {
+		user := &domain.User{ID: uuid.New(), Email: uuid.NewString() + "@example.com", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		require.NoError(t, users.Create(ctx, user))
+		t.Cleanup(func() { pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, user.ID) })
+		user.MutedNotifications = muted
+		require.NoError(t, users.Update(ctx, user))
+		require.NoError(t, workspaces.AddMember(ctx, &domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: user.ID, Role: domain.RoleMember, CreatedAt: time.Now()}))
+		return user
+	}
+	alice := newMember()
+	bob := newMember(domain.NotificationConnectionDegraded)
+
+	repo := NewNotificationRepository(pool)
+	payload := json.RawMessage(`{"connection_id": "c1"}`)
+	created, err := repo.CreateForWorkspace(ctx, workspaceID, domain.NotificationConnectionDegraded, payload)
+	require.NoError(t, err)
+	require.Len(t, created, 1, "members who muted the type get none")
+	assert.Equal(t, alice.ID, created[0].UserID)
+	assert.JSONEq(t, string(payload), string(created[0].Payload))
+
+	muted, err := repo.CreateForUser(ctx, bob.ID, &workspaceID, domain.NotificationConnectionDegraded, payload)
+	require.NoError(t, err)
+	assert.Nil(t, muted)
+	warning, err := repo.CreateForUser(ctx, bob.ID, &workspaceID, domain.NotificationQuotaWarning, json.RawMessage(`{}`))
+	require.NoError(t, err)
+	require.NotNil(t, warning)
+
+	found, err := repo.MarkRead(ctx, created[0].ID, bob.ID, time.Now())
+	require.NoError(t, err)
+	assert.False(t, found, "only the recipient can mark a notification read")
+	found, err = repo.MarkRead(ctx, created[0].ID, alice.ID, time.Now())
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	unread, err := repo.ListByUser(ctx, alice.ID, domain.NotificationFilter{UnreadOnly: true, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, unread)
+	all, err := repo.ListByUser(ctx, alice.ID, domain.NotificationFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.NotNil(t, all[0].ReadAt)
+}
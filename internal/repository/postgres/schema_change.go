@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SchemaChangeRepository implements domain.SchemaChangeRepository
+type SchemaChangeRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewSchemaChangeRepository creates a new schema change repository
+func NewSchemaChangeRepository(pool *pgxpool.Pool) *SchemaChangeRepository {
+	return &SchemaChangeRepository{pool: pool}
+}
+
+// schemaChangeData is the part of a schema change stored as JSON
+type schemaChangeData struct {
+	AddedTables   []string             `json:"added_tables"`
+	RemovedTables []string             `json:"removed_tables"`
+	ChangedTables []domain.TableChange `json:"changed_tables"`
+}
+
+// Create records a schema change
+func (r *SchemaChangeRepository) Create(ctx context.Context, change *domain.SchemaChange) error {
+	data, err := json.Marshal(schemaChangeData{
+		AddedTables:   change.AddedTables,
+		RemovedTables: change.RemovedTables,
+		ChangedTables: change.ChangedTables,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode schema change: %w", err)
+	}
+
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO schema_changes (id, connection_id, changes, destructive, detected_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, change.ID, change.ConnectionID, data, change.Destructive, change.DetectedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create schema change: %w", err)
+	}
+	return nil
+}
+
+// ListByConnection returns the latest schema changes of a connection, newest first
+func (r *SchemaChangeRepository) ListByConnection(ctx context.Context, connectionID uuid.UUID, limit int) ([]domain.SchemaChange, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, connection_id, changes, destructive, detected_at
+		FROM schema_changes
+		WHERE connection_id = $1
+		ORDER BY detected_at DESC
+		LIMIT $2
+	`, connectionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []domain.SchemaChange{}
+	for rows.Next() {
+		var change domain.SchemaChange
+		var raw []byte
+		if err := rows.Scan(&change.ID, &change.ConnectionID, &raw, &change.Destructive, &change.DetectedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema change: %w", err)
+		}
+		var data schemaChangeData
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("failed to decode schema change: %w", err)
+		}
+		change.AddedTables, change.RemovedTables, change.ChangedTables = data.AddedTables, data.RemovedTables, data.ChangedTables
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
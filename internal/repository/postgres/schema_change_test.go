@@ -0,0 +1,69 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaChangeRepository(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	conn := &domain.Connection{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Name:         "warehouse",
+		DatabaseType: domain.DatabaseTypePostgres,
+		Host:         "localhost",
+		Port:         5432,
+		Database:     "warehouse",
+		Username:     "reader",
+		SSLMode:      "disable",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	require.NoError(t, NewConnectionRepository(&DB{Pool: pool}).Create(ctx, conn))
+
+	repo := NewSchemaChangeRepository(pool)
+	detected := time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+	older := &domain.SchemaChange{
+		ID:            uuid.New(),
+		ConnectionID:  conn.ID,
+		AddedTables:   []string{"refunds"},
+		RemovedTables: []string{},
+		ChangedTables: []domain.TableChange{},
+		DetectedAt:    detected,
+	}
+	newer := &domain.SchemaChange{
+		ID:            uuid.New(),
+		ConnectionID:  conn.ID,
+		AddedTables:   []string{},
+		RemovedTables: []string{"legacy_orders"},
+		ChangedTables: []domain.TableChange{{Table: "orders", ChangedColumns: []domain.ColumnChange{{Column: "total", From: "integer", To: "numeric"}}}},
+		Destructive:   true,
+		DetectedAt:    detected.Add(time.Minute),
+	}
+	require.NoError(t, repo.Create(ctx, older))
+	require.NoError(t, repo.Create(ctx, newer))
+
+	changes, err := repo.ListByConnection(ctx, conn.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, newer.ID, changes[0].ID)
+	assert.True(t, changes[0].Destructive)
+	assert.Equal(t, newer.ChangedTables, changes[0].ChangedTables)
+	assert.True(t, newer.DetectedAt.Equal(changes[0].DetectedAt))
+	assert.Equal(t, []string{"refunds"}, changes[1].AddedTables)
+
+	changes, err = repo.ListByConnection(ctx, conn.ID, 1)
+	require.NoError(t, err)
+	assert.Len(t, changes, 1)
+}
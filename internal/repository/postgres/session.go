@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/google/uuid"
@@ -20,15 +21,20 @@ func NewSessionRepository(pool *pgxpool.Pool) *SessionRepository {
 }
 
 func (r *SessionRepository) Create(ctx context.Context, session *domain.ChatSession) error {
+	return insertSession(ctx, r.pool, session)
+}
+
+func insertSession(ctx context.Context, db execer, session *domain.ChatSession) error {
 	query := `
-		INSERT INTO chat_sessions (id, workspace_id, user_id, title, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO chat_sessions (id, workspace_id, user_id, title, connection_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
-	_, err := r.pool.Exec(ctx, query,
+	_, err := db.Exec(ctx, query,
 		session.ID,
 		session.WorkspaceID,
 		session.UserID,
 		session.Title,
+		session.ConnectionID,
 		session.CreatedAt,
 		session.UpdatedAt,
 	)
@@ -40,7 +46,7 @@ func (r *SessionRepository) Create(ctx context.Context, session *domain.ChatSess
 
 func (r *SessionRepository) Get(ctx context.Context, id uuid.UUID) (*domain.ChatSession, error) {
 	query := `
-		SELECT id, workspace_id, user_id, title, created_at, updated_at
+		SELECT id, workspace_id, user_id, title, connection_id, created_at, updated_at, deleted_at
 		FROM chat_sessions
 		WHERE id = $1
 	`
@@ -50,8 +56,10 @@ func (r *SessionRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Chat
 		&s.WorkspaceID,
 		&s.UserID,
 		&s.Title,
+		&s.ConnectionID,
 		&s.CreatedAt,
 		&s.UpdatedAt,
+		&s.DeletedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
@@ -59,36 +67,64 @@ func (r *SessionRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Chat
 	return &s, nil
 }
 
-func (r *SessionRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int, offset int) ([]domain.ChatSession, error) {
+// sessionPreviewLength is the number of characters of the last message shown in session lists
+const sessionPreviewLength = 120
+
+// ListByWorkspace lists the live sessions of a workspace with their message statistics,
+// most recently active first. It also returns the total number of live sessions.
+func (r *SessionRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int, offset int) ([]domain.ChatSessionSummary, int, error) {
+	var total int
+	countQuery := `SELECT COUNT(*) FROM chat_sessions WHERE workspace_id = $1 AND deleted_at IS NULL`
+	if err := r.pool.QueryRow(ctx, countQuery, workspaceID).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
 	query := `
-		SELECT id, workspace_id, user_id, title, created_at, updated_at
-		FROM chat_sessions
-		WHERE workspace_id = $1
-		ORDER BY updated_at DESC
+		SELECT s.id, s.workspace_id, s.user_id, s.title, s.connection_id, s.created_at, s.updated_at,
+			stats.message_count, stats.last_message_at, COALESCE(LEFT(last.content, $4), '')
+		FROM chat_sessions s
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS message_count, MAX(created_at) AS last_message_at
+			FROM chat_messages
+			WHERE session_id = s.id
+		) stats ON TRUE
+		LEFT JOIN LATERAL (
+			SELECT content
+			FROM chat_messages
+			WHERE session_id = s.id
+			ORDER BY created_at DESC
+			LIMIT 1
+		) last ON TRUE
+		WHERE s.workspace_id = $1 AND s.deleted_at IS NULL
+		ORDER BY COALESCE(stats.last_message_at, s.updated_at) DESC, s.id
 		LIMIT $2 OFFSET $3
 	`
-	rows, err := r.pool.Query(ctx, query, workspaceID, limit, offset)
+	rows, err := r.pool.Query(ctx, query, workspaceID, limit, offset, sessionPreviewLength)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list sessions: %w", err)
+		return nil, 0, fmt.Errorf("failed to list sessions: %w", err)
 	}
 	defer rows.Close()
 
-	var sessions []domain.ChatSession
+	sessions := []domain.ChatSessionSummary{}
 	for rows.Next() {
-		var s domain.ChatSession
+		var s domain.ChatSessionSummary
 		if err := rows.Scan(
 			&s.ID,
 			&s.WorkspaceID,
 			&s.UserID,
 			&s.Title,
+			&s.ConnectionID,
 			&s.CreatedAt,
 			&s.UpdatedAt,
+			&s.MessageCount,
+			&s.LastMessageAt,
+			&s.LastMessagePreview,
 		); err != nil {
-			return nil, fmt.Errorf("failed to scan session: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan session: %w", err)
 		}
 		sessions = append(sessions, s)
 	}
-	return sessions, nil
+	return sessions, total, rows.Err()
 }
 
 func (r *SessionRepository) Update(ctx context.Context, session *domain.ChatSession) error {
@@ -104,11 +140,54 @@ func (r *SessionRepository) Update(ctx context.Context, session *domain.ChatSess
 	return nil
 }
 
-func (r *SessionRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `DELETE FROM chat_sessions WHERE id = $1`
-	_, err := r.pool.Exec(ctx, query, id)
-	if err != nil {
+// SoftDelete marks a session as deleted, hiding it from lists until it is restored or purged
+func (r *SessionRepository) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE chat_sessions SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
 	return nil
 }
+
+// Restore clears the deleted mark of a session
+func (r *SessionRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE chat_sessions SET deleted_at = NULL, updated_at = NOW() WHERE id = $1`
+	if _, err := r.pool.Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to restore session: %w", err)
+	}
+	return nil
+}
+
+// Delete permanently removes a session and its messages
+func (r *SessionRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.purge(ctx, `SELECT id FROM chat_sessions WHERE id = $1`, id)
+	return err
+}
+
+// PurgeDeleted permanently removes sessions soft-deleted before the given time, with their messages
+func (r *SessionRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return r.purge(ctx, `SELECT id FROM chat_sessions WHERE deleted_at < $1`, before)
+}
+
+// purge deletes the sessions selected by idQuery and their messages in one transaction.
+// Messages are deleted explicitly rather than relying on the foreign key cascade alone.
+func (r *SessionRepository) purge(ctx context.Context, idQuery string, args ...any) (int64, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM chat_messages WHERE session_id IN (`+idQuery+`)`, args...); err != nil {
+		return 0, fmt.Errorf("failed to delete session messages: %w", err)
+	}
+	tag, err := tx.Exec(ctx, `DELETE FROM chat_sessions WHERE id IN (`+idQuery+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit session delete: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func countSessionMessages(t *testing.T, pool *pgxpool.Pool, sessionID uuid.UUID) int {
+	t.Helper()
+	var n int
+	err := pool.QueryRow(context.Background(), `SELECT COUNT(*) FROM chat_messages WHERE session_id = $1`, sessionID).Scan(&n)
+	require.NoError(t, err)
+	return n
+}
+
+func addTestMessages(t *testing.T, repo *MessageRepository, workspaceID, sessionID uuid.UUID, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		require.NoError(t, repo.Create(context.Background(), &domain.Message{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			SessionID:   &sessionID,
+			Role:        domain.RoleUser,
+			Content:     "question",
+			CreatedAt:   time.Now(),
+		}))
+	}
+}
+
+func TestSessionRepository_SoftDeleteAndRestore(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, sessionID)
+
+	sessions := NewSessionRepository(pool)
+	messages := NewMessageRepository(pool)
+	addTestMessages(t, messages, workspaceID, sessionID, 2)
+
+	require.NoError(t, sessions.SoftDelete(ctx, sessionID))
+
+	listed, _, err := sessions.ListByWorkspace(ctx, workspaceID, 20, 0)
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+
+	history, err := messages.ListByWorkspace(ctx, workspaceID, 50)
+	require.NoError(t, err)
+	assert.Empty(t, history, "messages of deleted sessions are hidden from workspace history")
+
+	session, err := sessions.Get(ctx, sessionID)
+	require.NoError(t, err)
+	require.NotNil(t, session.DeletedAt)
+	assert.Equal(t, 2, countSessionMessages(t, pool, sessionID), "soft delete keeps messages")
+
+	require.NoError(t, sessions.Restore(ctx, sessionID))
+	listed, _, err = sessions.ListByWorkspace(ctx, workspaceID, 20, 0)
+	require.NoError(t, err)
+	assert.Len(t, listed, 1)
+}
+
+func TestSessionRepository_DeleteRemovesMessages(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID, sessionID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, sessionID)
+
+	sessions := NewSessionRepository(pool)
+	addTestMessages(t, NewMessageRepository(pool), workspaceID, sessionID, 3)
+
+	require.NoError(t, sessions.Delete(ctx, sessionID))
+
+	_, err := sessions.Get(ctx, sessionID)
+	assert.Error(t, err)
+	assert.Zero(t, countSessionMessages(t, pool, sessionID))
+}
+
+func TestSessionRepository_PurgeDeleted(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	expiredID, recentID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, expiredID)
+	_, err := pool.Exec(ctx, `INSERT INTO chat_sessions (id, workspace_id) VALUES ($1, $2)`, recentID, workspaceID)
+	require.NoError(t, err)
+
+	sessions := NewSessionRepository(pool)
+	messages := NewMessageRepository(pool)
+	addTestMessages(t, messages, workspaceID, expiredID, 2)
+	addTestMessages(t, messages, workspaceID, recentID, 1)
+
+	_, err = pool.Exec(ctx, `UPDATE chat_sessions SET deleted_at = $2 WHERE id = $1`,
+		expiredID, time.Now().Add(-domain.SessionRetention-time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, sessions.SoftDelete(ctx, recentID))
+
+	purged, err := sessions.PurgeDeleted(ctx, time.Now().Add(-domain.SessionRetention))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	assert.Zero(t, countSessionMessages(t, pool, expiredID), "purge leaves no orphan messages")
+	assert.Equal(t, 1, countSessionMessages(t, pool, recentID))
+
+	_, err = sessions.Get(ctx, recentID)
+	assert.NoError(t, err, "sessions inside the retention window are kept")
+}
+
+func TestSessionRepository_ListByWorkspaceSummary(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	emptyID, activeID := uuid.New(), uuid.New()
+	createTestSession(t, pool, workspaceID, emptyID)
+	_, err := pool.Exec(ctx, `INSERT INTO chat_sessions (id, workspace_id, updated_at) VALUES ($1, $2, NOW() - INTERVAL '1 day')`,
+		activeID, workspaceID)
+	require.NoError(t, err)
+
+	messages := NewMessageRepository(pool)
+	longQuestion := strings.Repeat("x", sessionPreviewLength+50)
+	for i, content := range []string{"first question", longQuestion} {
+		require.NoError(t, messages.Create(ctx, &domain.Message{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			SessionID:   &activeID,
+			Role:        domain.RoleUser,
+			Content:     content,
+			CreatedAt:   time.Now().Add(time.Duration(i) * time.Second),
+		}))
+	}
+
+	sessions, total, err := NewSessionRepository(pool).ListByWorkspace(ctx, workspaceID, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, sessions, 1)
+
+	// The session with the latest message sorts first despite its older updated_at
+	active := sessions[0]
+	assert.Equal(t, activeID, active.ID)
+	assert.Equal(t, 2, active.MessageCount)
+	require.NotNil(t, active.LastMessageAt)
+	assert.Equal(t, longQuestion[:sessionPreviewLength], active.LastMessagePreview)
+
+	sessions, _, err = NewSessionRepository(pool).ListByWorkspace(ctx, workspaceID, 1, 1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, emptyID, sessions[0].ID)
+	assert.Zero(t, sessions[0].MessageCount)
+	assert.Nil(t, sessions[0].LastMessageAt)
+	assert.Empty(t, sessions[0].LastMessagePreview)
+}
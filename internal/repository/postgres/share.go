@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SharedResultRepository implements domain.SharedResultRepository
+type SharedResultRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewSharedResultRepository creates a new share link repository
+func NewSharedResultRepository(pool *pgxpool.Pool) *SharedResultRepository {
+	return &SharedResultRepository{pool: pool}
+}
+
+const sharedResultColumns = `id, token_hash, workspace_id, message_id, created_by, COALESCE(passcode_hash, ''),
+	expires_at, revoked_at, created_at`
+
+func (r *SharedResultRepository) Create(ctx context.Context, share *domain.SharedResult) error {
+	query := `
+		INSERT INTO shared_results (id, token_hash, workspace_id, message_id, created_by, passcode_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+	`
+	_, err := r.pool.Exec(ctx, query,
+		share.ID,
+		share.TokenHash,
+		share.WorkspaceID,
+		share.MessageID,
+		share.CreatedBy,
+		share.PasscodeHash,
+		share.ExpiresAt,
+		share.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create share: %w", err)
+	}
+	return nil
+}
+
+// GetByTokenHash retrieves a share by the hash of its token, or nil if there is none
+func (r *SharedResultRepository) GetByTokenHash(ctx context.Context, tokenHash []byte) (*domain.SharedResult, error) {
+	return r.get(ctx, `SELECT `+sharedResultColumns+` FROM shared_results WHERE token_hash = $1`, tokenHash)
+}
+
+// GetByIDAndWorkspace retrieves a share of a workspace, or nil if there is none
+func (r *SharedResultRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.SharedResult, error) {
+	return r.get(ctx, `SELECT `+sharedResultColumns+` FROM shared_results WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+}
+
+func (r *SharedResultRepository) get(ctx context.Context, query string, args ...any) (*domain.SharedResult, error) {
+	share, err := scanSharedResult(r.pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+	return share, nil
+}
+
+// ListByWorkspace lists the shares of a workspace, newest first, optionally only those
+// created by one user
+func (r *SharedResultRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, createdBy *uuid.UUID) ([]domain.SharedResult, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+sharedResultColumns+` FROM shared_results
+		WHERE workspace_id = $1 AND ($2::uuid IS NULL OR created_by = $2)
+		ORDER BY created_at DESC
+	`, workspaceID, createdBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []domain.SharedResult{}
+	for rows.Next() {
+		share, err := scanSharedResult(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share: %w", err)
+		}
+		shares = append(shares, *share)
+	}
+	return shares, rows.Err()
+}
+
+func scanSharedResult(row pgx.Row) (*domain.SharedResult, error) {
+	var s domain.SharedResult
+	err := row.Scan(
+		&s.ID,
+		&s.TokenHash,
+		&s.WorkspaceID,
+		&s.MessageID,
+		&s.CreatedBy,
+		&s.PasscodeHash,
+		&s.ExpiresAt,
+		&s.RevokedAt,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Revoke marks a share revoked at the given time. Revoking it again keeps the first time.
+func (r *SharedResultRepository) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	_, err := r.pool.Exec(ctx, `UPDATE shared_results SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, at)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PlatformStatsRepository implements domain.PlatformStatsRepository
+type PlatformStatsRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPlatformStatsRepository creates a new platform stats repository
+func NewPlatformStatsRepository(pool *pgxpool.Pool) *PlatformStatsRepository {
+	return &PlatformStatsRepository{pool: pool}
+}
+
+// Totals counts users, workspaces and connections by database type
+func (r *PlatformStatsRepository) Totals(ctx context.Context) (*domain.PlatformTotals, error) {
+	totals := &domain.PlatformTotals{ConnectionsByType: map[string]int64{}}
+	err := r.pool.QueryRow(ctx, `SELECT (SELECT COUNT(*) FROM users), (SELECT COUNT(*) FROM workspaces)`).
+		Scan(&totals.Users, &totals.Workspaces)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users and workspaces: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, `SELECT database_type, COUNT(*) FROM connections GROUP BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count connections: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var databaseType string
+		var count int64
+		if err := rows.Scan(&databaseType, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan connection count: %w", err)
+		}
+		totals.ConnectionsByType[databaseType] = count
+	}
+	return totals, rows.Err()
+}
+
+// AnswerCounts groups the answers given since a time by UTC day and provider. Errors
+// are answers whose status is not ok, and latencies are those of the LLM calls.
+func (r *PlatformStatsRepository) AnswerCounts(ctx context.Context, since time.Time) ([]domain.DailyProviderCount, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT day, provider, COUNT(*), COUNT(*) FILTER (WHERE status <> 'ok'),
+			COALESCE(SUM(tokens), 0), COALESCE(SUM(llm_latency_ms), 0), COUNT(llm_latency_ms)
+		FROM (
+			SELECT
+				date_trunc('day', created_at AT TIME ZONE 'UTC') AS day,
+				COALESCE(metadata->>'llm_provider', '') AS provider,
+				status,
+				CASE WHEN jsonb_typeof(metadata->'tokens_used') = 'number'
+					THEN (metadata->>'tokens_used')::BIGINT END AS tokens,
+				CASE WHEN jsonb_typeof(metadata->'llm_latency_ms') = 'number'
+					THEN NULLIF((metadata->>'llm_latency_ms')::BIGINT, 0) END AS llm_latency_ms
+			FROM chat_messages
+			WHERE role = 'assistant'
+				AND status IS NOT NULL
+				AND status <> 'explained'
+				AND created_at >= $1
+		) answers
+		GROUP BY 1, 2
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count answers: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.DailyProviderCount
+	for rows.Next() {
+		var c domain.DailyProviderCount
+		if err := rows.Scan(&c.Day, &c.Provider, &c.Queries, &c.Errors, &c.Tokens,
+			&c.LLMLatencyTotal, &c.LLMLatencyCount); err != nil {
+			return nil, fmt.Errorf("failed to scan answer count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
+// NewUserCounts counts the users created since a time by UTC day
+func (r *PlatformStatsRepository) NewUserCounts(ctx context.Context, since time.Time) ([]domain.DayCount, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT date_trunc('day', created_at AT TIME ZONE 'UTC'), COUNT(*)
+		FROM users
+		WHERE created_at >= $1
+		GROUP BY 1
+	`, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count new users: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []domain.DayCount
+	for rows.Next() {
+		var c domain.DayCount
+		if err := rows.Scan(&c.Day, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan new user count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatformStatsRepository(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+	repo := NewPlatformStatsRepository(pool)
+
+	// The database is shared, so answers are told apart by a provider of their own
+	provider := "stats-" + uuid.NewString()
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	insert := func(status string, metadata string, createdAt time.Time) {
+		_, err := pool.Exec(ctx, `
+			INSERT INTO chat_messages (workspace_id, role, content, status, metadata, created_at)
+			VALUES ($1, 'assistant', 'answer', $2, $3::jsonb, $4)
+		`, workspaceID, status, metadata, createdAt)
+		require.NoError(t, err)
+	}
+	insert("ok", `{"llm_provider": "`+provider+`", "tokens_used": 100, "llm_latency_ms": 300}`, day.Add(time.Hour))
+	insert("sql_error", `{"llm_provider": "`+provider+`", "tokens_used": 50, "llm_latency_ms": 0}`, day.Add(2*time.Hour))
+	insert("ok", `{"llm_provider": "`+provider+`", "tokens_used": "n/a"}`, day.Add(3*time.Hour))
+	insert("ok", `{"llm_provider": "`+provider+`", "tokens_used": 1000}`, day.AddDate(0, 0, -10))
+
+	counts, err := repo.AnswerCounts(ctx, day.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	var mine []domain.DailyProviderCount
+	for _, c := range counts {
+		if c.Provider == provider {
+			mine = append(mine, c)
+		}
+	}
+	require.Len(t, mine, 1, "answers before the window are left out")
+	assert.True(t, day.Equal(mine[0].Day))
+	assert.Equal(t, int64(3), mine[0].Queries)
+	assert.Equal(t, int64(1), mine[0].Errors)
+	assert.Equal(t, int64(150), mine[0].Tokens, "malformed token counts are skipped")
+	assert.Equal(t, int64(300), mine[0].LLMLatencyTotal)
+	assert.Equal(t, int64(1), mine[0].LLMLatencyCount, "answers without an LLM latency do not lower the average")
+
+	totals, err := repo.Totals(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, totals.Workspaces, int64(1))
+
+	newUsers, err := repo.NewUserCounts(ctx, day.AddDate(0, 0, -1))
+	require.NoError(t, err)
+	for _, c := range newUsers {
+		assert.False(t, c.Day.Before(day.AddDate(0, 0, -1)))
+	}
+}
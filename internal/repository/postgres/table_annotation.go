@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TableAnnotationRepository implements domain.TableAnnotationRepository
+type TableAnnotationRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewTableAnnotationRepository creates a new table annotation repository
+func NewTableAnnotationRepository(pool *pgxpool.Pool) *TableAnnotationRepository {
+	return &TableAnnotationRepository{pool: pool}
+}
+
+// ListByConnection returns the table annotations of a connection, by table name
+func (r *TableAnnotationRepository) ListByConnection(ctx context.Context, connectionID uuid.UUID) ([]domain.TableAnnotation, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT connection_id, schema_name, table_name, COALESCE(role, ''), COALESCE(description, ''), updated_by, updated_at
+		FROM table_annotations
+		WHERE connection_id = $1
+		ORDER BY schema_name, table_name
+	`, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list table annotations: %w", err)
+	}
+	defer rows.Close()
+
+	annotations := []domain.TableAnnotation{}
+	for rows.Next() {
+		var a domain.TableAnnotation
+		if err := rows.Scan(&a.ConnectionID, &a.SchemaName, &a.TableName, &a.Role, &a.Description, &a.UpdatedBy, &a.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan table annotation: %w", err)
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, rows.Err()
+}
+
+// Upsert creates or replaces the annotation of a table
+func (r *TableAnnotationRepository) Upsert(ctx context.Context, a *domain.TableAnnotation) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO table_annotations (connection_id, schema_name, table_name, role, description, updated_by, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+		ON CONFLICT (connection_id, schema_name, table_name) DO UPDATE
+		SET role = EXCLUDED.role, description = EXCLUDED.description,
+			updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+	`, a.ConnectionID, a.SchemaName, a.TableName, string(a.Role), a.Description, a.UpdatedBy, a.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save table annotation: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the annotation of a table, reporting false when it had none
+func (r *TableAnnotationRepository) Delete(ctx context.Context, connectionID uuid.UUID, schemaName, tableName string) (bool, error) {
+	tag, err := r.pool.Exec(ctx, `
+		DELETE FROM table_annotations
+		WHERE connection_id = $1 AND schema_name = $2 AND table_name = $3
+	`, connectionID, schemaName, tableName)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete table annotation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableAnnotationRepository(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	conn := &domain.Connection{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Name:         "warehouse",
+		DatabaseType: domain.DatabaseTypePostgres,
+		Host:         "localhost",
+		Port:         5432,
+		Database:     "warehouse",
+		Username:     "reader",
+		SSLMode:      "disable",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	require.NoError(t, NewConnectionRepository(&DB{Pool: pool}).Create(ctx, conn))
+
+	repo := NewTableAnnotationRepository(pool)
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	orders := &domain.TableAnnotation{ConnectionID: conn.ID, SchemaName: "sales", TableName: "orders", Role: domain.TableRoleFact, UpdatedAt: now}
+	require.NoError(t, repo.Upsert(ctx, orders))
+	require.NoError(t, repo.Upsert(ctx, &domain.TableAnnotation{ConnectionID: conn.ID, TableName: "regions", Description: "Sales regions", UpdatedAt: now}))
+
+	orders.Role, orders.Description = "", "One row per order line"
+	require.NoError(t, repo.Upsert(ctx, orders))
+
+	annotations, err := repo.ListByConnection(ctx, conn.ID)
+	require.NoError(t, err)
+	require.Len(t, annotations, 2)
+	assert.Equal(t, "regions", annotations[0].TableName)
+	assert.Equal(t, "Sales regions", annotations[0].Description)
+	assert.Equal(t, "orders", annotations[1].TableName)
+	assert.Empty(t, annotations[1].Role, "an update replaces the role")
+	assert.Equal(t, "One row per order line", annotations[1].Description)
+
+	deleted, err := repo.Delete(ctx, conn.ID, "sales", "orders")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = repo.Delete(ctx, conn.ID, "sales", "orders")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+}
@@ -0,0 +1,61 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TableUsageRepository implements domain.TableUsageRepository
+type TableUsageRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewTableUsageRepository creates a new table usage repository
+func NewTableUsageRepository(pool *pgxpool.Pool) *TableUsageRepository {
+	return &TableUsageRepository{pool: pool}
+}
+
+// Record counts one query reading each of tables
+func (r *TableUsageRepository) Record(ctx context.Context, connectionID uuid.UUID, tables []string, at time.Time) error {
+	_, err := r.pool.Exec(ctx, `
+		INSERT INTO connection_table_usage (connection_id, table_name, query_count, last_queried_at)
+		SELECT $1, t, 1, $3 FROM (SELECT DISTINCT unnest($2::text[])) AS u(t)
+		ON CONFLICT (connection_id, table_name) DO UPDATE
+		SET query_count = connection_table_usage.query_count + 1,
+		    last_queried_at = GREATEST(connection_table_usage.last_queried_at, EXCLUDED.last_queried_at)
+	`, connectionID, tables, at)
+	if err != nil {
+		return fmt.Errorf("failed to record table usage: %w", err)
+	}
+	return nil
+}
+
+// ListTop returns the most queried tables of a connection, most queried first
+func (r *TableUsageRepository) ListTop(ctx context.Context, connectionID uuid.UUID, limit int) ([]domain.TableUsage, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT table_name, query_count, last_queried_at
+		FROM connection_table_usage
+		WHERE connection_id = $1
+		ORDER BY query_count DESC, last_queried_at DESC
+		LIMIT $2
+	`, connectionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list table usage: %w", err)
+	}
+	defer rows.Close()
+
+	usage := []domain.TableUsage{}
+	for rows.Next() {
+		var u domain.TableUsage
+		if err := rows.Scan(&u.TableName, &u.QueryCount, &u.LastQueriedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan table usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
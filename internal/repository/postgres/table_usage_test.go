@@ -0,0 +1,53 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableUsageRepository_RecordAndListTop(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	conn := &domain.Connection{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Name:         "warehouse",
+		DatabaseType: domain.DatabaseTypePostgres,
+		Host:         "localhost",
+		Port:         5432,
+		Database:     "warehouse",
+		Username:     "reader",
+		SSLMode:      "disable",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	require.NoError(t, NewConnectionRepository(&DB{Pool: pool}).Create(ctx, conn))
+
+	repo := NewTableUsageRepository(pool)
+	first := time.Now().Add(-time.Hour).UTC().Truncate(time.Microsecond)
+	last := first.Add(time.Minute)
+	require.NoError(t, repo.Record(ctx, conn.ID, []string{"orders", "users", "orders"}, first))
+	require.NoError(t, repo.Record(ctx, conn.ID, []string{"orders"}, last))
+
+	top, err := repo.ListTop(ctx, conn.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, "orders", top[0].TableName)
+	assert.Equal(t, int64(2), top[0].QueryCount)
+	assert.True(t, last.Equal(top[0].LastQueriedAt))
+	assert.Equal(t, "users", top[1].TableName)
+	assert.Equal(t, int64(1), top[1].QueryCount)
+
+	top, err = repo.ListTop(ctx, uuid.New(), 10)
+	require.NoError(t, err)
+	assert.Empty(t, top)
+}
@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TemplateRepository implements domain.QueryTemplateRepository
+type TemplateRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewTemplateRepository creates a new query template repository
+func NewTemplateRepository(pool *pgxpool.Pool) *TemplateRepository {
+	return &TemplateRepository{pool: pool}
+}
+
+const templateColumns = `id, workspace_id, connection_id, name, description, sql, parameters, created_by, created_at, updated_at`
+
+func (r *TemplateRepository) Create(ctx context.Context, template *domain.QueryTemplate) error {
+	params, err := json.Marshal(template.Parameters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template parameters: %w", err)
+	}
+
+	query := `
+		INSERT INTO query_templates (` + templateColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = r.pool.Exec(ctx, query,
+		template.ID,
+		template.WorkspaceID,
+		template.ConnectionID,
+		template.Name,
+		template.Description,
+		template.SQL,
+		params,
+		template.CreatedBy,
+		template.CreatedAt,
+		template.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create query template: %w", err)
+	}
+	return nil
+}
+
+// GetByIDAndWorkspace retrieves a template by ID and workspace, or nil if there is none
+func (r *TemplateRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.QueryTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM query_templates WHERE id = $1 AND workspace_id = $2`
+	template, err := scanTemplate(r.pool.QueryRow(ctx, query, id, workspaceID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get query template: %w", err)
+	}
+	return template, nil
+}
+
+// ListByWorkspace lists the templates of a workspace by name
+func (r *TemplateRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.QueryTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM query_templates WHERE workspace_id = $1 ORDER BY name, created_at`
+	rows, err := r.pool.Query(ctx, query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list query templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := []domain.QueryTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan query template: %w", err)
+		}
+		templates = append(templates, *template)
+	}
+	return templates, rows.Err()
+}
+
+func scanTemplate(row pgx.Row) (*domain.QueryTemplate, error) {
+	var t domain.QueryTemplate
+	var params []byte
+	err := row.Scan(
+		&t.ID,
+		&t.WorkspaceID,
+		&t.ConnectionID,
+		&t.Name,
+		&t.Description,
+		&t.SQL,
+		&params,
+		&t.CreatedBy,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(params, &t.Parameters); err != nil {
+		return nil, fmt.Errorf("failed to decode template parameters: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *TemplateRepository) Update(ctx context.Context, template *domain.QueryTemplate) error {
+	params, err := json.Marshal(template.Parameters)
+	if err != nil {
+		return fmt.Errorf("failed to marshal template parameters: %w", err)
+	}
+
+	query := `
+		UPDATE query_templates
+		SET connection_id = $2, name = $3, description = $4, sql = $5, parameters = $6, updated_at = $7
+		WHERE id = $1
+	`
+	_, err = r.pool.Exec(ctx, query,
+		template.ID,
+		template.ConnectionID,
+		template.Name,
+		template.Description,
+		template.SQL,
+		params,
+		template.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update query template: %w", err)
+	}
+	return nil
+}
+
+func (r *TemplateRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM query_templates WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete query template: %w", err)
+	}
+	return nil
+}
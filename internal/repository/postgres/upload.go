@@ -0,0 +1,157 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UploadRepository implements domain.UploadRepository
+type UploadRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewUploadRepository creates a new upload repository
+func NewUploadRepository(pool *pgxpool.Pool) *UploadRepository {
+	return &UploadRepository{pool: pool}
+}
+
+// linkedConnection matches SQLite connections of the upload's workspace that open its file
+const linkedConnection = `
+	c.workspace_id = u.workspace_id
+	AND c.database_type = 'sqlite'
+	AND c.database_name = u.file_path
+`
+
+// uploadColumns selects an upload with the oldest connection linked to it
+const uploadColumns = `
+	SELECT u.id, u.workspace_id, u.user_id, u.original_name, u.file_path, u.size_bytes,
+		u.orphaned_at, u.created_at, c.id, COALESCE(c.name, '')
+	FROM uploads u
+	LEFT JOIN LATERAL (
+		SELECT c.id, c.name FROM connections c
+		WHERE ` + linkedConnection + `
+		ORDER BY c.created_at
+		LIMIT 1
+	) c ON TRUE
+`
+
+func (r *UploadRepository) Create(ctx context.Context, upload *domain.Upload) error {
+	query := `
+		INSERT INTO uploads (id, workspace_id, user_id, original_name, file_path, size_bytes, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.pool.Exec(ctx, query,
+		upload.ID,
+		upload.WorkspaceID,
+		upload.UserID,
+		upload.OriginalName,
+		upload.FilePath,
+		upload.SizeBytes,
+		upload.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create upload: %w", err)
+	}
+	return nil
+}
+
+// GetByIDAndWorkspace retrieves an upload by ID and workspace, or nil if there is none
+func (r *UploadRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Upload, error) {
+	upload, err := scanUpload(r.pool.QueryRow(ctx, uploadColumns+`WHERE u.id = $1 AND u.workspace_id = $2`, id, workspaceID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	return upload, nil
+}
+
+// ListByWorkspace lists the uploads of a workspace, newest first
+func (r *UploadRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Upload, error) {
+	rows, err := r.pool.Query(ctx, uploadColumns+`WHERE u.workspace_id = $1 ORDER BY u.created_at DESC`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploads: %w", err)
+	}
+	defer rows.Close()
+
+	uploads := []domain.Upload{}
+	for rows.Next() {
+		upload, err := scanUpload(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan upload: %w", err)
+		}
+		uploads = append(uploads, *upload)
+	}
+	return uploads, rows.Err()
+}
+
+func scanUpload(row pgx.Row) (*domain.Upload, error) {
+	var u domain.Upload
+	err := row.Scan(
+		&u.ID,
+		&u.WorkspaceID,
+		&u.UserID,
+		&u.OriginalName,
+		&u.FilePath,
+		&u.SizeBytes,
+		&u.OrphanedAt,
+		&u.CreatedAt,
+		&u.ConnectionID,
+		&u.ConnectionName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// ListFilePaths returns the file paths of all uploads
+func (r *UploadRepository) ListFilePaths(ctx context.Context) ([]string, error) {
+	rows, err := r.pool.Query(ctx, `SELECT file_path FROM uploads`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upload paths: %w", err)
+	}
+	paths, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan upload path: %w", err)
+	}
+	return paths, nil
+}
+
+func (r *UploadRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM uploads WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+// MarkOrphans flags uploads that no connection opens as orphaned since at, and clears
+// the flag on uploads that are linked again. It returns the number of newly flagged uploads.
+func (r *UploadRepository) MarkOrphans(ctx context.Context, at time.Time) (int64, error) {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE uploads u SET orphaned_at = NULL
+		WHERE u.orphaned_at IS NOT NULL
+		  AND EXISTS (SELECT 1 FROM connections c WHERE `+linkedConnection+`)
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear linked uploads: %w", err)
+	}
+
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE uploads u SET orphaned_at = $1
+		WHERE u.orphaned_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM connections c WHERE `+linkedConnection+`)
+	`, at)
+	if err != nil {
+		return 0, fmt.Errorf("failed to flag orphaned uploads: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
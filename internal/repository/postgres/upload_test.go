@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadRepository_LinkedConnectionAndOrphans(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	uploads := NewUploadRepository(pool)
+	upload := &domain.Upload{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		OriginalName: "sales.csv",
+		FilePath:     "/data/sqlite/" + uuid.NewString() + ".db",
+		SizeBytes:    2048,
+		CreatedAt:    time.Now(),
+	}
+	require.NoError(t, uploads.Create(ctx, upload))
+
+	connections := NewConnectionRepository(&DB{Pool: pool})
+	conn := &domain.Connection{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Name:         "sales",
+		DatabaseType: domain.DatabaseTypeSQLite,
+		Host:         "localhost",
+		Port:         1,
+		Database:     upload.FilePath,
+		Username:     "sqlite",
+		SSLMode:      "disable",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	require.NoError(t, connections.Create(ctx, conn))
+
+	listed, err := uploads.ListByWorkspace(ctx, workspaceID)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.NotNil(t, listed[0].ConnectionID)
+	assert.Equal(t, conn.ID, *listed[0].ConnectionID)
+	assert.Equal(t, "sales", listed[0].ConnectionName)
+
+	flagged, err := uploads.MarkOrphans(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, flagged, "linked uploads are not orphans")
+
+	require.NoError(t, connections.Delete(ctx, conn.ID))
+	flagged, err = uploads.MarkOrphans(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), flagged)
+
+	got, err := uploads.GetByIDAndWorkspace(ctx, upload.ID, workspaceID)
+	require.NoError(t, err)
+	assert.Nil(t, got.ConnectionID)
+	assert.NotNil(t, got.OrphanedAt)
+
+	flagged, err = uploads.MarkOrphans(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, flagged, "orphans are flagged once")
+}
@@ -4,12 +4,19 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
 
+// userColumns is the column list scanned by scanUser
+const userColumns = `id, email, COALESCE(display_name, ''), password_hash, auth_provider, COALESCE(external_id, ''),
+	is_admin, deactivated_at, created_at, updated_at, COALESCE(llm_config, '{}'::jsonb),
+	COALESCE(preferred_llm_provider, ''), COALESCE(preferred_llm_model, ''), muted_notifications`
+
 // UserRepository handles user data access
 type UserRepository struct {
 	db *DB
@@ -20,18 +27,61 @@ func NewUserRepository(db *DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
+// scanUser scans a row selected with userColumns
+func scanUser(row pgx.Row) (*domain.User, error) {
+	var user domain.User
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.DisplayName,
+		&user.PasswordHash,
+		&user.AuthProvider,
+		&user.ExternalID,
+		&user.IsAdmin,
+		&user.DeactivatedAt,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.LLMConfig,
+		&user.PreferredProvider,
+		&user.PreferredModel,
+		&user.MutedNotifications,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// getOne runs a single-user query, returning nil if no row matches
+func (r *UserRepository) getOne(ctx context.Context, query string, args ...any) (*domain.User, error) {
+	user, err := scanUser(r.db.Pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
 // Create creates a new user
 func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	query := `
-		INSERT INTO users (id, email, display_name, password_hash, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO users (id, email, display_name, password_hash, auth_provider, external_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
 	`
 
+	if user.AuthProvider == "" {
+		user.AuthProvider = domain.AuthProviderPassword
+	}
+
 	_, err := r.db.Pool.Exec(ctx, query,
 		user.ID,
 		user.Email,
 		user.DisplayName,
 		user.PasswordHash,
+		user.AuthProvider,
+		user.ExternalID,
 		user.CreatedAt,
 		user.UpdatedAt,
 	)
@@ -44,58 +94,47 @@ func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 
 // GetByID retrieves a user by ID
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
-	query := `
-		SELECT id, email, COALESCE(display_name, ''), password_hash, created_at, updated_at, COALESCE(llm_config, '{}'::jsonb)
-		FROM users
-		WHERE id = $1
-	`
-
-	var user domain.User
-	err := r.db.Pool.QueryRow(ctx, query, id).Scan(
-		&user.ID,
-		&user.Email,
-		&user.DisplayName,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.LLMConfig,
-	)
+	user, err := r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE id = $1`, id)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
-		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-
-	return &user, nil
+	return user, nil
 }
 
 // GetByEmail retrieves a user by email
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
-	query := `
-		SELECT id, email, COALESCE(display_name, ''), password_hash, created_at, updated_at, COALESCE(llm_config, '{}'::jsonb)
-		FROM users
-		WHERE email = $1
-	`
+	user, err := r.getOne(ctx, `SELECT `+userColumns+` FROM users WHERE email = $1`, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+	return user, nil
+}
 
-	var user domain.User
-	err := r.db.Pool.QueryRow(ctx, query, email).Scan(
-		&user.ID,
-		&user.Email,
-		&user.DisplayName,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-		&user.LLMConfig,
+// GetByExternalID retrieves a user by their identity at an external provider
+func (r *UserRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error) {
+	user, err := r.getOne(ctx,
+		`SELECT `+userColumns+` FROM users WHERE auth_provider = $1 AND external_id = $2`,
+		provider, externalID,
 	)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
-		}
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return nil, fmt.Errorf("failed to get user by external id: %w", err)
 	}
+	return user, nil
+}
 
-	return &user, nil
+// LinkExternalID attaches an external identity to an existing user
+func (r *UserRepository) LinkExternalID(ctx context.Context, userID uuid.UUID, provider, externalID string) error {
+	query := `
+		UPDATE users
+		SET auth_provider = $2, external_id = $3, updated_at = NOW()
+		WHERE id = $1
+	`
+
+	if _, err := r.db.Pool.Exec(ctx, query, userID, provider, externalID); err != nil {
+		return fmt.Errorf("failed to link external id: %w", err)
+	}
+
+	return nil
 }
 
 // EmailExists checks if an email is already registered
@@ -111,13 +150,110 @@ func (r *UserRepository) EmailExists(ctx context.Context, email string) (bool, e
 	return exists, nil
 }
 
+// ListWithLLMConfig retrieves all users that have a non-empty LLM configuration
+func (r *UserRepository) ListWithLLMConfig(ctx context.Context) ([]*domain.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE llm_config IS NOT NULL AND llm_config <> '{}'::jsonb
+		ORDER BY created_at
+	`
+
+	return r.list(ctx, query)
+}
+
+// Search lists users whose email or display name contains term, newest first.
+// An empty term lists all users. It also returns the total number of matches.
+func (r *UserRepository) Search(ctx context.Context, term string, limit, offset int) ([]*domain.User, int, error) {
+	pattern := "%" + escapeLike(term) + "%"
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM users WHERE email ILIKE $1 OR display_name ILIKE $1`
+	if err := r.db.Pool.QueryRow(ctx, countQuery, pattern).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE email ILIKE $1 OR display_name ILIKE $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`
+
+	users, err := r.list(ctx, query, pattern, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// list runs a multi-user query selected with userColumns
+func (r *UserRepository) list(ctx context.Context, query string, args ...any) ([]*domain.User, error) {
+	rows, err := r.db.Pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// SetDeactivated deactivates a user at the given time, or reactivates them when at is nil
+func (r *UserRepository) SetDeactivated(ctx context.Context, id uuid.UUID, at *time.Time) error {
+	query := `UPDATE users SET deactivated_at = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.Pool.Exec(ctx, query, id, at); err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	return nil
+}
+
+// PromoteAdmins grants the global admin flag to the users with the given emails
+func (r *UserRepository) PromoteAdmins(ctx context.Context, emails []string) (int64, error) {
+	if len(emails) == 0 {
+		return 0, nil
+	}
+
+	normalized := make([]string, 0, len(emails))
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			normalized = append(normalized, email)
+		}
+	}
+
+	query := `UPDATE users SET is_admin = TRUE, updated_at = NOW() WHERE LOWER(email) = ANY($1) AND NOT is_admin`
+
+	tag, err := r.db.Pool.Exec(ctx, query, normalized)
+	if err != nil {
+		return 0, fmt.Errorf("failed to promote admins: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
 // Update updates a user
 func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 	query := `
 		UPDATE users
-		SET email = $2, display_name = $3, password_hash = $4, updated_at = $5, llm_config = $6
+		SET email = $2, display_name = $3, password_hash = $4, updated_at = $5, llm_config = $6,
+		    preferred_llm_provider = $7, preferred_llm_model = $8, muted_notifications = $9
 		WHERE id = $1
 	`
+	muted := user.MutedNotifications
+	if muted == nil {
+		muted = []string{}
+	}
 
 	_, err := r.db.Pool.Exec(ctx, query,
 		user.ID,
@@ -126,6 +262,9 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 		user.PasswordHash,
 		user.UpdatedAt,
 		user.LLMConfig,
+		user.PreferredProvider,
+		user.PreferredModel,
+		muted,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
@@ -133,3 +272,8 @@ func (r *UserRepository) Update(ctx context.Context, user *domain.User) error {
 
 	return nil
 }
+
+// escapeLike escapes LIKE wildcards so term is matched literally
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+}
@@ -0,0 +1,241 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WebhookRepository implements domain.WebhookRepository
+type WebhookRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(pool *pgxpool.Pool) *WebhookRepository {
+	return &WebhookRepository{pool: pool}
+}
+
+const webhookColumns = `id, workspace_id, config_encrypted, events, enabled, created_at, updated_at`
+
+func (r *WebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	query := `
+		INSERT INTO webhooks (` + webhookColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := r.pool.Exec(ctx, query,
+		webhook.ID,
+		webhook.WorkspaceID,
+		webhook.ConfigEncrypted,
+		webhook.Events,
+		webhook.Enabled,
+		webhook.CreatedAt,
+		webhook.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves a webhook by ID, or nil if there is none
+func (r *WebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	return r.get(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1`, id)
+}
+
+// GetByIDAndWorkspace retrieves a webhook by ID and workspace, or nil if there is none
+func (r *WebhookRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Webhook, error) {
+	return r.get(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id = $1 AND workspace_id = $2`, id, workspaceID)
+}
+
+func (r *WebhookRepository) get(ctx context.Context, query string, args ...any) (*domain.Webhook, error) {
+	webhook, err := scanWebhook(r.pool.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return webhook, nil
+}
+
+// ListByWorkspace lists the webhooks of a workspace, oldest first
+func (r *WebhookRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Webhook, error) {
+	return r.list(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE workspace_id = $1 ORDER BY created_at`, workspaceID)
+}
+
+// ListSubscribed lists the enabled webhooks of a workspace subscribed to event
+func (r *WebhookRepository) ListSubscribed(ctx context.Context, workspaceID uuid.UUID, event string) ([]domain.Webhook, error) {
+	return r.list(ctx, `
+		SELECT `+webhookColumns+` FROM webhooks
+		WHERE workspace_id = $1 AND enabled AND $2 = ANY(events)
+	`, workspaceID, event)
+}
+
+func (r *WebhookRepository) list(ctx context.Context, query string, args ...any) ([]domain.Webhook, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []domain.Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, *webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+func scanWebhook(row pgx.Row) (*domain.Webhook, error) {
+	var w domain.Webhook
+	err := row.Scan(
+		&w.ID,
+		&w.WorkspaceID,
+		&w.ConfigEncrypted,
+		&w.Events,
+		&w.Enabled,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (r *WebhookRepository) Update(ctx context.Context, webhook *domain.Webhook) error {
+	query := `
+		UPDATE webhooks
+		SET config_encrypted = $2, events = $3, enabled = $4, updated_at = $5
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query,
+		webhook.ID,
+		webhook.ConfigEncrypted,
+		webhook.Events,
+		webhook.Enabled,
+		webhook.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+	return nil
+}
+
+func (r *WebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, err := r.pool.Exec(ctx, `DELETE FROM webhooks WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
+
+const deliveryColumns = `
+	id, webhook_id, event, payload, status, attempts, response_status,
+	COALESCE(error, ''), next_attempt_at, created_at, updated_at
+`
+
+func (r *WebhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query := `
+		INSERT INTO webhook_deliveries (id, webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := r.pool.Exec(ctx, query,
+		delivery.ID,
+		delivery.WebhookID,
+		delivery.Event,
+		delivery.Payload,
+		delivery.Status,
+		delivery.NextAttemptAt,
+		delivery.CreatedAt,
+		delivery.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListDeliveries lists the most recent deliveries of a webhook, newest first
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY created_at DESC LIMIT $2`
+	return r.listDeliveries(ctx, query, webhookID, limit)
+}
+
+// ClaimDueDeliveries returns pending deliveries due by now, oldest first, and moves their
+// next attempt lease into the future. Rows locked by another worker are skipped.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + deliveryColumns
+	return r.listDeliveries(ctx, query, now, now.Add(lease), limit)
+}
+
+func (r *WebhookRepository) listDeliveries(ctx context.Context, query string, args ...any) ([]domain.WebhookDelivery, error) {
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		var d domain.WebhookDelivery
+		if err := rows.Scan(
+			&d.ID,
+			&d.WebhookID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.ResponseStatus,
+			&d.Error,
+			&d.NextAttemptAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// UpdateDelivery records the outcome of a delivery attempt
+func (r *WebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, response_status = $4, error = NULLIF($5, ''),
+		    next_attempt_at = $6, updated_at = $7
+		WHERE id = $1
+	`
+	_, err := r.pool.Exec(ctx, query,
+		delivery.ID,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.Error,
+		delivery.NextAttemptAt,
+		delivery.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
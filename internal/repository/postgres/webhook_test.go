@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRepository_ClaimDueDeliveries(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	createTestSession(t, pool, workspaceID, uuid.New())
+
+	repo := NewWebhookRepository(pool)
+	now := time.Now()
+	webhook := &domain.Webhook{
+		ID:              uuid.New(),
+		WorkspaceID:     workspaceID,
+		ConfigEncrypted: []byte("encrypted"),
+		Events:          []string{domain.WebhookEventQueryCompleted},
+		Enabled:         true,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	require.NoError(t, repo.Create(ctx, webhook))
+
+	subscribed, err := repo.ListSubscribed(ctx, workspaceID, domain.WebhookEventQueryCompleted)
+	require.NoError(t, err)
+	require.Len(t, subscribed, 1)
+	subscribed, err = repo.ListSubscribed(ctx, workspaceID, domain.WebhookEventSchemaRefreshFailed)
+	require.NoError(t, err)
+	assert.Empty(t, subscribed)
+
+	due := now.Add(-time.Second)
+	delivery := &domain.WebhookDelivery{
+		ID:            uuid.New(),
+		WebhookID:     webhook.ID,
+		Event:         domain.WebhookEventQueryCompleted,
+		Payload:       []byte(`{"event":"query.completed"}`),
+		Status:        domain.WebhookDeliveryPending,
+		NextAttemptAt: &due,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	require.NoError(t, repo.CreateDelivery(ctx, delivery))
+
+	claimed, err := repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, delivery.ID, claimed[0].ID)
+
+	claimed, err = repo.ClaimDueDeliveries(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, claimed, "claimed deliveries are leased")
+
+	status := 200
+	delivery.Status = domain.WebhookDeliverySucceeded
+	delivery.Attempts = 1
+	delivery.ResponseStatus = &status
+	delivery.NextAttemptAt = nil
+	require.NoError(t, repo.UpdateDelivery(ctx, delivery))
+
+	listed, err := repo.ListDeliveries(ctx, webhook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, domain.WebhookDeliverySucceeded, listed[0].Status)
+	assert.Equal(t, 1, listed[0].Attempts)
+}
@@ -122,11 +122,65 @@ func (r *WorkspaceRepository) ListByUserID(ctx context.Context, userID uuid.UUID
 	return workspaces, nil
 }
 
+// ListAll retrieves all workspaces with their member counts, newest first.
+// It also returns the total number of workspaces.
+func (r *WorkspaceRepository) ListAll(ctx context.Context, limit, offset int) ([]domain.WorkspaceSummary, int, error) {
+	var total int
+	if err := r.db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM workspaces`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count workspaces: %w", err)
+	}
+
+	query := `
+		SELECT w.id, w.name, w.settings, w.created_at, w.updated_at, COUNT(wm.user_id)
+		FROM workspaces w
+		LEFT JOIN workspace_members wm ON w.id = wm.workspace_id
+		GROUP BY w.id
+		ORDER BY w.created_at DESC
+		LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.db.Pool.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := []domain.WorkspaceSummary{}
+	for rows.Next() {
+		var summary domain.WorkspaceSummary
+		var settingsJSON []byte
+
+		if err := rows.Scan(
+			&summary.ID,
+			&summary.Name,
+			&settingsJSON,
+			&summary.CreatedAt,
+			&summary.UpdatedAt,
+			&summary.MemberCount,
+		); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+
+		if len(settingsJSON) > 0 {
+			json.Unmarshal(settingsJSON, &summary.Settings)
+		}
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, total, rows.Err()
+}
+
 // Update updates a workspace
 func (r *WorkspaceRepository) Update(ctx context.Context, id uuid.UUID, update *domain.WorkspaceUpdate) error {
-	settings, err := json.Marshal(update.Settings)
-	if err != nil {
-		return fmt.Errorf("failed to marshal settings: %w", err)
+	// nil settings leave the stored ones untouched
+	var settings []byte
+	if update.Settings != nil {
+		var err error
+		settings, err = json.Marshal(update.Settings)
+		if err != nil {
+			return fmt.Errorf("failed to marshal settings: %w", err)
+		}
 	}
 
 	query := `
@@ -137,7 +191,7 @@ func (r *WorkspaceRepository) Update(ctx context.Context, id uuid.UUID, update *
 		WHERE id = $1
 	`
 
-	_, err = r.db.Pool.Exec(ctx, query, id, update.Name, settings)
+	_, err := r.db.Pool.Exec(ctx, query, id, update.Name, settings)
 	if err != nil {
 		return fmt.Errorf("failed to update workspace: %w", err)
 	}
@@ -157,12 +211,12 @@ func (r *WorkspaceRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-// AddMember adds a member to a workspace
+// AddMember adds a member to a workspace; an existing member keeps their role
 func (r *WorkspaceRepository) AddMember(ctx context.Context, member *domain.WorkspaceMember) error {
 	query := `
 		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
 		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = $3
+		ON CONFLICT (workspace_id, user_id) DO NOTHING
 	`
 
 	_, err := r.db.Pool.Exec(ctx, query,
@@ -178,6 +232,18 @@ func (r *WorkspaceRepository) AddMember(ctx context.Context, member *domain.Work
 	return nil
 }
 
+// UpdateMemberRole changes the role of a workspace member
+func (r *WorkspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error {
+	query := `UPDATE workspace_members SET role = $3 WHERE workspace_id = $1 AND user_id = $2`
+
+	_, err := r.db.Pool.Exec(ctx, query, workspaceID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+
+	return nil
+}
+
 // GetMember retrieves a workspace member
 func (r *WorkspaceRepository) GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error) {
 	query := `
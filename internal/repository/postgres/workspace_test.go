@@ -0,0 +1,57 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkspaceRepository_Settings(t *testing.T) {
+	pool := newTestPool(t)
+	ctx := context.Background()
+	repo := NewWorkspaceRepository(&DB{Pool: pool})
+
+	workspaceID := uuid.New()
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM workspaces WHERE id = $1`, workspaceID)
+	})
+
+	// Settings written by earlier versions carry keys the typed settings do not know
+	_, err := pool.Exec(ctx,
+		`INSERT INTO workspaces (id, name, settings) VALUES ($1, 'legacy', '{"theme": "dark", "max_rows": 100}')`,
+		workspaceID,
+	)
+	require.NoError(t, err)
+
+	workspace, err := repo.GetByID(ctx, workspaceID)
+	require.NoError(t, err)
+	assert.Equal(t, 100, workspace.Settings.MaxRows)
+	assert.Equal(t, "dark", workspace.Settings.Extra["theme"])
+
+	t.Run("rename keeps settings", func(t *testing.T) {
+		name := "renamed"
+		require.NoError(t, repo.Update(ctx, workspaceID, &domain.WorkspaceUpdate{Name: &name}))
+
+		workspace, err := repo.GetByID(ctx, workspaceID)
+		require.NoError(t, err)
+		assert.Equal(t, "renamed", workspace.Name)
+		assert.Equal(t, 100, workspace.Settings.MaxRows)
+	})
+
+	t.Run("settings update preserves unknown keys", func(t *testing.T) {
+		settings := workspace.Settings
+		settings.MaxRows = 20
+		settings.LLMProviderAllowlist = []string{"ollama"}
+		require.NoError(t, repo.Update(ctx, workspaceID, &domain.WorkspaceUpdate{Settings: &settings}))
+
+		updated, err := repo.GetByID(ctx, workspaceID)
+		require.NoError(t, err)
+		assert.Equal(t, 20, updated.Settings.MaxRows)
+		assert.Equal(t, []string{"ollama"}, updated.Settings.LLMProviderAllowlist)
+		assert.Equal(t, "dark", updated.Settings.Extra["theme"])
+	})
+}
@@ -1,83 +1,191 @@
 package redis
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
 const (
 	schemaCachePrefix = "schema:"
-	schemaCacheTTL    = 5 * time.Minute
+	schemaLockPrefix  = "schema_lock:"
 )
 
+// unlockScript deletes a lock only if it still holds the caller's token, so an expired
+// lock taken over by another replica is left alone
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// gzipSchemaMagic marks a gzip-compressed schema. Entries without it are plain JSON
+// written by older versions.
+var gzipSchemaMagic = []byte("gz1:")
+
 // SchemaCache handles schema caching in Redis
 type SchemaCache struct {
-	client *Client
+	client  *Client
+	ttl     time.Duration
+	maxSize int
+}
+
+// NewSchemaCache creates a new schema cache whose entries expire after ttl unless a
+// connection overrides it
+func NewSchemaCache(client *Client, ttl time.Duration) *SchemaCache {
+	return &SchemaCache{client: client, ttl: ttl}
+}
+
+// WithMaxSize skips caching schemas whose compressed size exceeds maxSize bytes
+func (c *SchemaCache) WithMaxSize(maxSize int) *SchemaCache {
+	c.maxSize = maxSize
+	return c
+}
+
+// TTL returns the default time a schema stays cached
+func (c *SchemaCache) TTL() time.Duration {
+	return c.ttl
 }
 
-// NewSchemaCache creates a new schema cache
-func NewSchemaCache(client *Client) *SchemaCache {
-	return &SchemaCache{client: client}
+// schemaKey namespaces a connection's schema by workspace, so that a workspace's
+// entries can be removed together
+func schemaKey(workspaceID, connectionID uuid.UUID) string {
+	return fmt.Sprintf("%s%s:%s", schemaCachePrefix, workspaceID, connectionID)
 }
 
-// Get retrieves cached schema for a connection
-func (c *SchemaCache) Get(ctx context.Context, connectionID uuid.UUID) (*domain.SchemaInfo, error) {
-	key := fmt.Sprintf("%s%s", schemaCachePrefix, connectionID.String())
+// Get retrieves cached schema for a connection. The schema may be stale, see
+// domain.SchemaInfo.Stale.
+func (c *SchemaCache) Get(ctx context.Context, workspaceID, connectionID uuid.UUID) (*domain.SchemaInfo, error) {
+	key := schemaKey(workspaceID, connectionID)
 
 	data, err := c.client.rdb.Get(ctx, key).Bytes()
 	if err != nil {
 		return nil, nil // Cache miss
 	}
 
-	var schema domain.SchemaInfo
-	if err := json.Unmarshal(data, &schema); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
-	}
-
-	return &schema, nil
+	return decodeSchema(data)
 }
 
-// Set caches schema for a connection
-func (c *SchemaCache) Set(ctx context.Context, connectionID uuid.UUID, schema *domain.SchemaInfo) error {
-	key := fmt.Sprintf("%s%s", schemaCachePrefix, connectionID.String())
+// Set caches schema for a connection for ttl. A ttl of zero or less means the schema
+// must not be cached, so any earlier entry is removed instead. Entries are kept for
+// twice their TTL so that a stale schema can be served while it is being refreshed.
+func (c *SchemaCache) Set(ctx context.Context, workspaceID, connectionID uuid.UUID, schema *domain.SchemaInfo, ttl time.Duration) error {
+	if ttl <= 0 {
+		return c.Invalidate(ctx, workspaceID, connectionID)
+	}
+	key := schemaKey(workspaceID, connectionID)
 
-	data, err := json.Marshal(schema)
+	data, err := encodeSchema(schema)
 	if err != nil {
-		return fmt.Errorf("failed to marshal schema: %w", err)
+		return err
+	}
+	if c.maxSize > 0 && len(data) > c.maxSize {
+		logging.FromContext(ctx).Warn().Ctx(ctx).
+			Str("connection_id", connectionID.String()).
+			Int("size", len(data)).
+			Int("max_size", c.maxSize).
+			Msg("schema too large to cache")
+		return c.Invalidate(ctx, workspaceID, connectionID)
 	}
 
-	return c.client.rdb.Set(ctx, key, data, schemaCacheTTL).Err()
+	return c.client.rdb.Set(ctx, key, data, 2*ttl).Err()
 }
 
 // Invalidate removes cached schema for a connection
-func (c *SchemaCache) Invalidate(ctx context.Context, connectionID uuid.UUID) error {
-	key := fmt.Sprintf("%s%s", schemaCachePrefix, connectionID.String())
-	return c.client.rdb.Del(ctx, key).Err()
+func (c *SchemaCache) Invalidate(ctx context.Context, workspaceID, connectionID uuid.UUID) error {
+	return c.client.rdb.Del(ctx, schemaKey(workspaceID, connectionID)).Err()
+}
+
+// InvalidateByWorkspace removes the cached schemas of all connections in a workspace
+func (c *SchemaCache) InvalidateByWorkspace(ctx context.Context, workspaceID uuid.UUID) (int64, error) {
+	return c.deleteMatching(ctx, fmt.Sprintf("%s%s:*", schemaCachePrefix, workspaceID))
+}
+
+// LockRefresh takes the lock a replica holds while it reloads a connection's schema.
+// It returns false when another replica holds it. The lock expires after ttl unless
+// unlock is called first.
+func (c *SchemaCache) LockRefresh(ctx context.Context, connectionID uuid.UUID, ttl time.Duration) (unlock func(), locked bool, err error) {
+	key := schemaLockPrefix + connectionID.String()
+	token := uuid.NewString()
+
+	locked, err = c.client.rdb.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock schema refresh: %w", err)
+	}
+	if !locked {
+		return nil, false, nil
+	}
+	return func() {
+		// The caller's context may be gone by now
+		unlockScript.Run(context.WithoutCancel(ctx), c.client.rdb, []string{key}, token)
+	}, true, nil
+}
+
+// RefreshLocked reports whether a replica holds the refresh lock of a connection
+func (c *SchemaCache) RefreshLocked(ctx context.Context, connectionID uuid.UUID) (bool, error) {
+	n, err := c.client.rdb.Exists(ctx, schemaLockPrefix+connectionID.String()).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check schema refresh lock: %w", err)
+	}
+	return n > 0, nil
 }
 
 // FlushAll removes all cached schemas
 func (c *SchemaCache) FlushAll(ctx context.Context) (int64, error) {
-	pattern := schemaCachePrefix + "*"
+	return c.deleteMatching(ctx, schemaCachePrefix+"*")
+}
+
+// deleteMatching removes the keys matching a SCAN pattern
+func (c *SchemaCache) deleteMatching(ctx context.Context, pattern string) (int64, error) {
+	cluster, ok := c.client.rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanDelete(ctx, c.client.rdb, pattern)
+	}
+
+	// SCAN only walks the node it runs on, so each primary is scanned
+	var deleted atomic.Int64
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		n, err := scanDelete(ctx, node, pattern)
+		deleted.Add(n)
+		return err
+	})
+	return deleted.Load(), err
+}
+
+// scanDelete removes the keys of db matching a SCAN pattern. Keys are deleted one per
+// command, since a cluster refuses commands on keys in different slots.
+func scanDelete(ctx context.Context, db redis.Cmdable, pattern string) (int64, error) {
 	var cursor uint64
 	var deleted int64
 
 	for {
-		keys, nextCursor, err := c.client.rdb.Scan(ctx, cursor, pattern, 100).Result()
+		keys, nextCursor, err := db.Scan(ctx, cursor, pattern, 100).Result()
 		if err != nil {
 			return deleted, fmt.Errorf("failed to scan keys: %w", err)
 		}
 
 		if len(keys) > 0 {
-			count, err := c.client.rdb.Del(ctx, keys...).Result()
-			if err != nil {
+			pipe := db.Pipeline()
+			dels := make([]*redis.IntCmd, len(keys))
+			for i, key := range keys {
+				dels[i] = pipe.Del(ctx, key)
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
 				return deleted, fmt.Errorf("failed to delete keys: %w", err)
 			}
-			deleted += count
+			for _, del := range dels {
+				deleted += del.Val()
+			}
 		}
 
 		cursor = nextCursor
@@ -88,3 +196,41 @@ func (c *SchemaCache) FlushAll(ctx context.Context) (int64, error) {
 
 	return deleted, nil
 }
+
+// encodeSchema serializes a schema as gzip-compressed JSON behind gzipSchemaMagic
+func encodeSchema(schema *domain.SchemaInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(gzipSchemaMagic)
+	// Schemas are read on every query, so favour speed over ratio
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress schema: %w", err)
+	}
+	if err := json.NewEncoder(zw).Encode(schema); err != nil {
+		return nil, fmt.Errorf("failed to marshal schema: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress schema: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeSchema reads a schema written by encodeSchema or an uncompressed JSON entry
+func decodeSchema(data []byte) (*domain.SchemaInfo, error) {
+	if compressed, ok := bytes.CutPrefix(data, gzipSchemaMagic); ok {
+		zr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress schema: %w", err)
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("failed to decompress schema: %w", err)
+		}
+	}
+
+	var schema domain.SchemaInfo
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schema: %w", err)
+	}
+	return &schema, nil
+}
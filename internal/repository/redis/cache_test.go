@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient connects to TEST_REDIS_ADDR, skipping when it is not set
+func newTestClient(tb testing.TB) *Client {
+	tb.Helper()
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		tb.Skip("TEST_REDIS_ADDR not set")
+	}
+
+	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
+	require.NoError(tb, rdb.Ping(context.Background()).Err())
+	tb.Cleanup(func() { rdb.Close() })
+	return &Client{rdb: rdb}
+}
+
+// syntheticSchema builds a schema with the given number of ten-column tables
+func syntheticSchema(tables int) *domain.SchemaInfo {
+	schema := &domain.SchemaInfo{DatabaseType: "postgres", CachedAt: time.Now().UTC(), CacheTTLSeconds: 300}
+	for i := 0; i < tables; i++ {
+		table := domain.TableInfo{Name: fmt.Sprintf("table_%d", i), SchemaName: "public"}
+		ddl := fmt.Sprintf("CREATE TABLE public.table_%d (\n", i)
+		for j := 0; j < 10; j++ {
+			name := fmt.Sprintf("column_%d", j)
+			table.Columns = append(table.Columns, domain.ColumnInfo{
+				Name:        name,
+				DataType:    "character varying",
+				Nullable:    j > 0,
+				PrimaryKey:  j == 0,
+				Description: "Synthetic column used for cache benchmarks",
+			})
+			ddl += fmt.Sprintf("    %s character varying,\n", name)
+		}
+		schema.Tables = append(schema.Tables, table)
+		schema.DDL += ddl + ");\n\n"
+	}
+	return schema
+}
+
+func TestSchemaEncoding(t *testing.T) {
+	schema := syntheticSchema(50)
+
+	t.Run("round trip", func(t *testing.T) {
+		data, err := encodeSchema(schema)
+		require.NoError(t, err)
+		plain, err := json.Marshal(schema)
+		require.NoError(t, err)
+		assert.Less(t, len(data), len(plain)/4, "compressed payload should be much smaller")
+
+		decoded, err := decodeSchema(data)
+		require.NoError(t, err)
+		assert.Equal(t, schema.Tables, decoded.Tables)
+		assert.Equal(t, schema.DDL, decoded.DDL)
+		assert.True(t, schema.CachedAt.Equal(decoded.CachedAt))
+	})
+
+	t.Run("reads uncompressed entries", func(t *testing.T) {
+		plain, err := json.Marshal(schema)
+		require.NoError(t, err)
+
+		decoded, err := decodeSchema(plain)
+		require.NoError(t, err)
+		assert.Equal(t, schema.DDL, decoded.DDL)
+	})
+
+	t.Run("corrupt payload", func(t *testing.T) {
+		_, err := decodeSchema(append([]byte("gz1:"), "not gzip"...))
+		assert.ErrorContains(t, err, "failed to decompress schema")
+	})
+}
+
+func TestSchemaCache_SkipsOversizedSchemas(t *testing.T) {
+	client := newTestClient(t)
+	ctx := context.Background()
+	workspaceID, connectionID := uuid.New(), uuid.New()
+	schema := syntheticSchema(500)
+
+	cache := NewSchemaCache(client, time.Minute).WithMaxSize(1024)
+	require.NoError(t, cache.Set(ctx, workspaceID, connectionID, schema, time.Minute))
+	cached, err := cache.Get(ctx, workspaceID, connectionID)
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	cache.WithMaxSize(0)
+	require.NoError(t, cache.Set(ctx, workspaceID, connectionID, schema, time.Minute))
+	t.Cleanup(func() { cache.Invalidate(ctx, workspaceID, connectionID) })
+	cached, err = cache.Get(ctx, workspaceID, connectionID)
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Len(t, cached.Tables, 500)
+}
+
+func BenchmarkSchemaEncoding(b *testing.B) {
+	schema := syntheticSchema(500)
+	plain, _ := json.Marshal(schema)
+	compressed, _ := encodeSchema(schema)
+
+	b.Run("encode/json", func(b *testing.B) {
+		b.ReportMetric(float64(len(plain)), "bytes/payload")
+		for i := 0; i < b.N; i++ {
+			json.Marshal(schema)
+		}
+	})
+	b.Run("encode/gzip", func(b *testing.B) {
+		b.ReportMetric(float64(len(compressed)), "bytes/payload")
+		for i := 0; i < b.N; i++ {
+			encodeSchema(schema)
+		}
+	})
+	b.Run("decode/json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decodeSchema(plain)
+		}
+	})
+	b.Run("decode/gzip", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			decodeSchema(compressed)
+		}
+	})
+}
+
+// BenchmarkSchemaCache compares round trips through Redis for a 500-table schema
+// stored as plain JSON (the old format) and compressed
+func BenchmarkSchemaCache(b *testing.B) {
+	client := newTestClient(b)
+	ctx := context.Background()
+	cache := NewSchemaCache(client, time.Minute)
+	schema := syntheticSchema(500)
+	workspaceID, connectionID := uuid.New(), uuid.New()
+	b.Cleanup(func() { cache.Invalidate(ctx, workspaceID, connectionID) })
+	key := schemaKey(workspaceID, connectionID)
+
+	b.Run("set/json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			data, _ := json.Marshal(schema)
+			if err := client.rdb.Set(ctx, key, data, time.Minute).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("get/json", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := cache.Get(ctx, workspaceID, connectionID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("set/gzip", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := cache.Set(ctx, workspaceID, connectionID, schema, time.Minute); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("get/gzip", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := cache.Get(ctx, workspaceID, connectionID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestSchemaCache_LockRefresh(t *testing.T) {
+	cache := NewSchemaCache(newTestClient(t), time.Minute)
+	ctx := context.Background()
+	connectionID := uuid.New()
+
+	unlock, locked, err := cache.LockRefresh(ctx, connectionID, time.Minute)
+	require.NoError(t, err)
+	require.True(t, locked)
+
+	_, locked, err = cache.LockRefresh(ctx, connectionID, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, locked, "a second replica must not get the lock")
+	held, err := cache.RefreshLocked(ctx, connectionID)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	unlock()
+	held, err = cache.RefreshLocked(ctx, connectionID)
+	require.NoError(t, err)
+	assert.False(t, held)
+}
+
+func TestSchemaCache_InvalidateByWorkspace(t *testing.T) {
+	cache := NewSchemaCache(newTestClient(t), time.Minute)
+	ctx := context.Background()
+	workspaceID, otherWorkspaceID := uuid.New(), uuid.New()
+	first, second, other := uuid.New(), uuid.New(), uuid.New()
+	schema := syntheticSchema(1)
+
+	require.NoError(t, cache.Set(ctx, workspaceID, first, schema, time.Minute))
+	require.NoError(t, cache.Set(ctx, workspaceID, second, schema, time.Minute))
+	require.NoError(t, cache.Set(ctx, otherWorkspaceID, other, schema, time.Minute))
+	t.Cleanup(func() { cache.Invalidate(ctx, otherWorkspaceID, other) })
+
+	deleted, err := cache.InvalidateByWorkspace(ctx, workspaceID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	cached, err := cache.Get(ctx, workspaceID, first)
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+	cached, err = cache.Get(ctx, otherWorkspaceID, other)
+	require.NoError(t, err)
+	assert.NotNil(t, cached, "other workspaces keep their cache")
+}
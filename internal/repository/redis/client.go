@@ -2,7 +2,11 @@ package redis
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/Rrens/text-to-sql/internal/config"
 	"github.com/redis/go-redis/v9"
@@ -10,31 +14,102 @@ import (
 
 // Client wraps the Redis client
 type Client struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 }
 
-// NewClient creates a new Redis client
+// NewClient creates a Redis client for a standalone server, a Sentinel-managed primary
+// or a cluster, depending on the configured mode. Sentinel clients follow failovers to
+// the new primary without a restart.
 func NewClient(cfg config.RedisConfig) (*Client, error) {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     cfg.Addr(),
-		Password: cfg.Password,
-		DB:       cfg.DB,
-	})
+	opts, err := universalOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	rdb := newUniversalClient(cfg.Mode, opts)
 
 	// Verify connection
 	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
 	return &Client{rdb: rdb}, nil
 }
 
+// universalOptions translates the configuration into go-redis options
+func universalOptions(cfg config.RedisConfig) (*redis.UniversalOptions, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addresses(),
+		Username:         cfg.Username,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		MasterName:       cfg.SentinelMasterName,
+		SentinelPassword: cfg.SentinelPassword,
+	}
+	if cfg.TLS.Enabled {
+		tlsConfig, err := redisTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+	return opts, nil
+}
+
+// newUniversalClient creates the client for mode. The mode is explicit rather than
+// guessed from the options, so a single sentinel or seed node is not mistaken for a
+// standalone server.
+func newUniversalClient(mode string, opts *redis.UniversalOptions) redis.UniversalClient {
+	switch mode {
+	case config.RedisModeSentinel:
+		return redis.NewFailoverClient(opts.Failover())
+	case config.RedisModeCluster:
+		return redis.NewClusterClient(opts.Cluster())
+	default:
+		return redis.NewClient(opts.Simple())
+	}
+}
+
+// redisTLSConfig builds the TLS configuration for Redis connections
+func redisTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("failed to parse Redis CA file: no PEM certificates found")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Ping verifies Redis connectivity
+func (c *Client) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
 // Close closes the Redis connection
 func (c *Client) Close() error {
 	return c.rdb.Close()
 }
 
-// Client returns the underlying Redis client
-func (c *Client) Client() *redis.Client {
+// Client returns the underlying Redis client, which is a *redis.Client,
+// *redis.ClusterClient or failover *redis.Client depending on the mode
+func (c *Client) Client() redis.UniversalClient {
 	return c.rdb
 }
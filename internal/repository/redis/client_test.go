@@ -0,0 +1,130 @@
+package redis
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniversalOptions(t *testing.T) {
+	t.Run("standalone", func(t *testing.T) {
+		cfg := config.RedisConfig{Mode: config.RedisModeStandalone, Host: "redis", Port: 6380, Password: "secret", DB: 2}
+		opts, err := universalOptions(cfg)
+		require.NoError(t, err)
+
+		client := newUniversalClient(cfg.Mode, opts)
+		defer client.Close()
+		simple, ok := client.(*goredis.Client)
+		require.True(t, ok)
+		assert.Equal(t, "redis:6380", simple.Options().Addr)
+		assert.Equal(t, "secret", simple.Options().Password)
+		assert.Equal(t, 2, simple.Options().DB)
+		assert.Nil(t, simple.Options().TLSConfig)
+	})
+
+	t.Run("sentinel", func(t *testing.T) {
+		cfg := config.RedisConfig{
+			Mode:               config.RedisModeSentinel,
+			Host:               "ignored",
+			Addrs:              []string{"sentinel-1:26379", "sentinel-2:26379"},
+			Password:           "secret",
+			SentinelMasterName: "mymaster",
+			SentinelPassword:   "sentinel-secret",
+		}
+		opts, err := universalOptions(cfg)
+		require.NoError(t, err)
+
+		failover := opts.Failover()
+		assert.Equal(t, "mymaster", failover.MasterName)
+		assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, failover.SentinelAddrs)
+		assert.Equal(t, "sentinel-secret", failover.SentinelPassword)
+		assert.Equal(t, "secret", failover.Password)
+
+		client := newUniversalClient(cfg.Mode, opts)
+		defer client.Close()
+		simple, ok := client.(*goredis.Client)
+		require.True(t, ok)
+		assert.Equal(t, "FailoverClient", simple.Options().Addr, "a single sentinel is not mistaken for a server")
+	})
+
+	t.Run("cluster", func(t *testing.T) {
+		cfg := config.RedisConfig{Mode: config.RedisModeCluster, Addrs: []string{"node-1:6379"}}
+		opts, err := universalOptions(cfg)
+		require.NoError(t, err)
+
+		client := newUniversalClient(cfg.Mode, opts)
+		defer client.Close()
+		cluster, ok := client.(*goredis.ClusterClient)
+		require.True(t, ok)
+		assert.Equal(t, []string{"node-1:6379"}, cluster.Options().Addrs)
+	})
+}
+
+func TestUniversalOptions_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caFile, caPEM, 0o600))
+
+	cfg := config.RedisConfig{
+		Mode:               config.RedisModeSentinel,
+		Addrs:              []string{"sentinel-1:26379"},
+		SentinelMasterName: "mymaster",
+		TLS:                config.RedisTLSConfig{Enabled: true, CAFile: caFile, ServerName: "redis.internal"},
+	}
+	opts, err := universalOptions(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, opts.TLSConfig)
+	assert.Equal(t, "redis.internal", opts.TLSConfig.ServerName)
+	assert.NotNil(t, opts.TLSConfig.RootCAs)
+	assert.Same(t, opts.TLSConfig, opts.Failover().TLSConfig, "sentinels and the primary share the TLS settings")
+
+	t.Run("CA file without certificates", func(t *testing.T) {
+		bad := cfg
+		bad.TLS.CAFile = filepath.Join(t.TempDir(), "empty.pem")
+		require.NoError(t, os.WriteFile(bad.TLS.CAFile, []byte("not a certificate"), 0o600))
+		_, err := universalOptions(bad)
+		assert.ErrorContains(t, err, "no PEM certificates found")
+	})
+
+	t.Run("missing client certificate", func(t *testing.T) {
+		bad := cfg
+		bad.TLS.CertFile = filepath.Join(t.TempDir(), "client.pem")
+		bad.TLS.KeyFile = filepath.Join(t.TempDir(), "client-key.pem")
+		_, err := universalOptions(bad)
+		assert.ErrorContains(t, err, "failed to load Redis client certificate")
+	})
+}
+
+func TestNewClient_Standalone(t *testing.T) {
+	m := miniredis.RunT(t)
+	port, err := strconv.Atoi(m.Port())
+	require.NoError(t, err)
+	cfg := config.RedisConfig{Host: m.Host(), Port: port}
+
+	client, err := NewClient(cfg)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// Flushing deletes keys one by one, which also works against a cluster
+	cache := NewSchemaCache(client, time.Minute)
+	require.NoError(t, m.Set(schemaCachePrefix+"a", "1"))
+	require.NoError(t, m.Set(schemaCachePrefix+"b", "1"))
+	require.NoError(t, m.Set("other", "1"))
+	deleted, err := cache.FlushAll(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.True(t, m.Exists("other"))
+}
@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	connectionErrorsPrefix   = "connerr:"
+	connectionDegradedPrefix = "connerr:degraded:"
+)
+
+// recordOutcomeScript adds the member ARGV[2] scored ARGV[1] (milliseconds) to the
+// sorted set at KEYS[1], drops members scored before ARGV[3] and all but the last
+// ARGV[4], and keeps the set for ARGV[5] milliseconds. Members ending in ":1" are
+// failures. It returns {queries, errors}.
+var recordOutcomeScript = redis.NewScript(`
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[3])
+local window = tonumber(ARGV[4])
+local count = redis.call('ZCARD', KEYS[1])
+if count > window then
+	redis.call('ZREMRANGEBYRANK', KEYS[1], 0, count - window - 1)
+end
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+
+local members = redis.call('ZRANGE', KEYS[1], 0, -1)
+local errors = 0
+for _, member in ipairs(members) do
+	if string.sub(member, -2) == ':1' then
+		errors = errors + 1
+	end
+end
+return {#members, errors}
+`)
+
+// ConnectionErrorStore keeps the outcomes of each connection's recent queries and
+// whether the connection is flagged degraded
+type ConnectionErrorStore struct {
+	client *Client
+}
+
+// NewConnectionErrorStore creates a new connection error store
+func NewConnectionErrorStore(client *Client) *ConnectionErrorStore {
+	return &ConnectionErrorStore{client: client}
+}
+
+// Record adds a query outcome at now and returns the counts of the last window
+// outcomes younger than maxAge
+func (s *ConnectionErrorStore) Record(ctx context.Context, connectionID uuid.UUID, failed bool, now time.Time, window int, maxAge time.Duration) (domain.ConnectionErrorRate, error) {
+	outcome := "0"
+	if failed {
+		outcome = "1"
+	}
+	result, err := recordOutcomeScript.Run(ctx, s.client.rdb, []string{connectionErrorsPrefix + connectionID.String()},
+		now.UnixMilli(), uuid.NewString()+":"+outcome, now.Add(-maxAge).UnixMilli(), window, maxAge.Milliseconds()).Int64Slice()
+	if err != nil {
+		return domain.ConnectionErrorRate{}, fmt.Errorf("failed to record connection outcome: %w", err)
+	}
+	return domain.ConnectionErrorRate{Queries: int(result[0]), Errors: int(result[1])}, nil
+}
+
+// MarkDegraded flags the connection degraded since the given time unless it already
+// is, reporting whether it was flagged by this call. The flag expires after ttl, which
+// each call renews, so a connection that stops getting queries does not stay degraded.
+func (s *ConnectionErrorStore) MarkDegraded(ctx context.Context, connectionID uuid.UUID, since time.Time, ttl time.Duration) (bool, error) {
+	key := connectionDegradedPrefix + connectionID.String()
+	ok, err := s.client.rdb.SetNX(ctx, key, since.UnixMilli(), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to flag connection degraded: %w", err)
+	}
+	if !ok {
+		if err := s.client.rdb.PExpire(ctx, key, ttl).Err(); err != nil {
+			return false, fmt.Errorf("failed to renew connection degraded flag: %w", err)
+		}
+	}
+	return ok, nil
+}
+
+// ClearDegraded removes the degraded flag, reporting whether it was set
+func (s *ConnectionErrorStore) ClearDegraded(ctx context.Context, connectionID uuid.UUID) (bool, error) {
+	n, err := s.client.rdb.Del(ctx, connectionDegradedPrefix+connectionID.String()).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to clear connection degraded flag: %w", err)
+	}
+	return n > 0, nil
+}
+
+// DegradedSince returns when each degraded connection among connectionIDs was flagged
+func (s *ConnectionErrorStore) DegradedSince(ctx context.Context, connectionIDs []uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	degraded := map[uuid.UUID]time.Time{}
+	if len(connectionIDs) == 0 {
+		return degraded, nil
+	}
+	// One GET per key rather than MGET, whose keys would span hash slots in a cluster
+	pipe := s.client.rdb.Pipeline()
+	gets := make([]*redis.StringCmd, len(connectionIDs))
+	for i, id := range connectionIDs {
+		gets[i] = pipe.Get(ctx, connectionDegradedPrefix+id.String())
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get connection degraded flags: %w", err)
+	}
+	for i, get := range gets {
+		ms, err := get.Int64()
+		if err != nil {
+			continue
+		}
+		degraded[connectionIDs[i]] = time.UnixMilli(ms).UTC()
+	}
+	return degraded, nil
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnectionErrorStore(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, m := newMiniredisClient(t, start)
+	store := NewConnectionErrorStore(client)
+	connectionID := uuid.New()
+
+	record := func(failed bool, at time.Time) domain.ConnectionErrorRate {
+		t.Helper()
+		rate, err := store.Record(ctx, connectionID, failed, at, 4, time.Hour)
+		require.NoError(t, err)
+		return rate
+	}
+
+	assert.Equal(t, domain.ConnectionErrorRate{Queries: 1}, record(false, start))
+	assert.Equal(t, domain.ConnectionErrorRate{Queries: 2, Errors: 1}, record(true, start.Add(time.Second)))
+	record(true, start.Add(2*time.Second))
+	record(true, start.Add(3*time.Second))
+	assert.Equal(t, domain.ConnectionErrorRate{Queries: 4, Errors: 4}, record(true, start.Add(4*time.Second)),
+		"only the last 4 outcomes are kept")
+	assert.Equal(t, domain.ConnectionErrorRate{Queries: 1}, record(false, start.Add(2*time.Hour)),
+		"outcomes older than an hour are forgotten")
+
+	flagged, err := store.MarkDegraded(ctx, connectionID, start, time.Hour)
+	require.NoError(t, err)
+	assert.True(t, flagged)
+	flagged, err = store.MarkDegraded(ctx, connectionID, start.Add(time.Minute), time.Hour)
+	require.NoError(t, err)
+	assert.False(t, flagged, "already degraded")
+
+	other := uuid.New()
+	degraded, err := store.DegradedSince(ctx, []uuid.UUID{connectionID, other})
+	require.NoError(t, err)
+	assert.Equal(t, map[uuid.UUID]time.Time{connectionID: start}, degraded)
+
+	cleared, err := store.ClearDegraded(ctx, connectionID)
+	require.NoError(t, err)
+	assert.True(t, cleared)
+	cleared, err = store.ClearDegraded(ctx, connectionID)
+	require.NoError(t, err)
+	assert.False(t, cleared)
+
+	t.Run("flag expires", func(t *testing.T) {
+		_, err := store.MarkDegraded(ctx, connectionID, start, time.Hour)
+		require.NoError(t, err)
+		m.FastForward(45 * time.Minute)
+		_, err = store.MarkDegraded(ctx, connectionID, start.Add(45*time.Minute), time.Hour)
+		require.NoError(t, err)
+		m.FastForward(45 * time.Minute)
+		degraded, err := store.DegradedSince(ctx, []uuid.UUID{connectionID})
+		require.NoError(t, err)
+		assert.Equal(t, map[uuid.UUID]time.Time{connectionID: start}, degraded, "renewed while still degraded")
+
+		m.FastForward(time.Hour)
+		degraded, err = store.DegradedSince(ctx, []uuid.UUID{connectionID})
+		require.NoError(t, err)
+		assert.Empty(t, degraded)
+	})
+}
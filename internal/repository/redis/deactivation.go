@@ -0,0 +1,49 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const deactivatedUserPrefix = "user:deactivated:"
+
+// DeactivatedUsers flags deactivated accounts so their outstanding access tokens
+// are rejected without a database lookup per request. Entries only need to live
+// as long as an access token; after that, refresh is refused by the database check.
+type DeactivatedUsers struct {
+	client *Client
+	ttl    time.Duration
+}
+
+// NewDeactivatedUsers creates a new deactivated user list
+func NewDeactivatedUsers(client *Client, accessTokenTTL time.Duration) *DeactivatedUsers {
+	return &DeactivatedUsers{client: client, ttl: accessTokenTTL}
+}
+
+// Add flags a user as deactivated
+func (d *DeactivatedUsers) Add(ctx context.Context, userID uuid.UUID) error {
+	if err := d.client.rdb.Set(ctx, deactivatedUserPrefix+userID.String(), 1, d.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to flag deactivated user: %w", err)
+	}
+	return nil
+}
+
+// Remove clears the deactivation flag
+func (d *DeactivatedUsers) Remove(ctx context.Context, userID uuid.UUID) error {
+	if err := d.client.rdb.Del(ctx, deactivatedUserPrefix+userID.String()).Err(); err != nil {
+		return fmt.Errorf("failed to clear deactivated user: %w", err)
+	}
+	return nil
+}
+
+// IsDeactivated reports whether a user is flagged as deactivated
+func (d *DeactivatedUsers) IsDeactivated(ctx context.Context, userID uuid.UUID) (bool, error) {
+	n, err := d.client.rdb.Exists(ctx, deactivatedUserPrefix+userID.String()).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check deactivated user: %w", err)
+	}
+	return n > 0, nil
+}
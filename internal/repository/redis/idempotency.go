@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const idempotencyPrefix = "idempotency:query:"
+
+// IdempotencyStore keeps query requests sent with an Idempotency-Key and their outcome
+type IdempotencyStore struct {
+	client *Client
+}
+
+// NewIdempotencyStore creates a new idempotency store
+func NewIdempotencyStore(client *Client) *IdempotencyStore {
+	return &IdempotencyStore{client: client}
+}
+
+// Claim stores entry under key for ttl unless the key is already taken. It returns
+// nil when the key was claimed, or the entry stored by an earlier request.
+func (s *IdempotencyStore) Claim(ctx context.Context, key string, entry *domain.IdempotentQuery, ttl time.Duration) (*domain.IdempotentQuery, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotency entry: %w", err)
+	}
+
+	// The earlier entry may expire between the two calls, so try twice
+	for range 2 {
+		claimed, err := s.client.rdb.SetNX(ctx, idempotencyPrefix+key, data, ttl).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+		if claimed {
+			return nil, nil
+		}
+
+		stored, err := s.client.rdb.Get(ctx, idempotencyPrefix+key).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load idempotency entry: %w", err)
+		}
+
+		var existing domain.IdempotentQuery
+		if err := json.Unmarshal(stored, &existing); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal idempotency entry: %w", err)
+		}
+		return &existing, nil
+	}
+	return nil, errors.New("failed to claim idempotency key: key expired while claiming")
+}
+
+// Save replaces the entry stored under key
+func (s *IdempotencyStore) Save(ctx context.Context, key string, entry *domain.IdempotentQuery, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency entry: %w", err)
+	}
+	if err := s.client.rdb.Set(ctx, idempotencyPrefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotency entry: %w", err)
+	}
+	return nil
+}
+
+// Release deletes the entry stored under key
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := s.client.rdb.Del(ctx, idempotencyPrefix+key).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
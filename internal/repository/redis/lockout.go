@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	loginFailuresPrefix = "login:failures:"
+	loginLockPrefix     = "login:lock:"
+	loginLockoutsPrefix = "login:lockouts:"
+
+	// lockoutMemory is how long previous lockouts count towards the next cooldown
+	lockoutMemory = 24 * time.Hour
+)
+
+// LoginLockout tracks failed logins per account and locks it with a growing cooldown
+type LoginLockout struct {
+	client *Client
+	cfg    config.LockoutConfig
+}
+
+// NewLoginLockout creates a new login lockout tracker
+func NewLoginLockout(client *Client, cfg config.LockoutConfig) *LoginLockout {
+	return &LoginLockout{client: client, cfg: cfg}
+}
+
+// Check returns the remaining lock duration for an account, or 0 if it is not locked
+func (l *LoginLockout) Check(ctx context.Context, email string) (time.Duration, error) {
+	ttl, err := l.client.rdb.PTTL(ctx, loginLockPrefix+normalizeEmail(email)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to check login lock: %w", err)
+	}
+	if ttl < 0 {
+		return 0, nil // -2: no key, -1: no expiry (never set by us)
+	}
+	return ttl, nil
+}
+
+// RecordFailure counts a failed login and locks the account once MaxAttempts is reached.
+// It returns the lock duration when this failure triggered a lock, otherwise 0.
+func (l *LoginLockout) RecordFailure(ctx context.Context, email string) (time.Duration, error) {
+	account := normalizeEmail(email)
+	failuresKey := loginFailuresPrefix + account
+
+	pipe := l.client.rdb.Pipeline()
+	incr := pipe.Incr(ctx, failuresKey)
+	pipe.ExpireNX(ctx, failuresKey, l.cfg.Window)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	if l.cfg.MaxAttempts <= 0 || incr.Val() < int64(l.cfg.MaxAttempts) {
+		return 0, nil
+	}
+
+	// Each lockout within lockoutMemory doubles the cooldown
+	lockoutsKey := loginLockoutsPrefix + account
+	lockouts, err := l.client.rdb.Incr(ctx, lockoutsKey).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record lockout: %w", err)
+	}
+	l.client.rdb.Expire(ctx, lockoutsKey, lockoutMemory)
+
+	cooldown := lockoutCooldown(l.cfg.Cooldown, l.cfg.MaxCooldown, lockouts)
+
+	pipe = l.client.rdb.Pipeline()
+	pipe.Set(ctx, loginLockPrefix+account, lockouts, cooldown)
+	pipe.Del(ctx, failuresKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to lock account: %w", err)
+	}
+
+	return cooldown, nil
+}
+
+// Reset clears failure counters after a successful login
+func (l *LoginLockout) Reset(ctx context.Context, email string) error {
+	account := normalizeEmail(email)
+	// Separate commands, since the keys may live in different cluster slots
+	pipe := l.client.rdb.Pipeline()
+	pipe.Del(ctx, loginFailuresPrefix+account)
+	pipe.Del(ctx, loginLockoutsPrefix+account)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to reset login failures: %w", err)
+	}
+	return nil
+}
+
+// lockoutCooldown returns base doubled for every previous lockout, capped at max
+func lockoutCooldown(base, max time.Duration, lockouts int64) time.Duration {
+	cooldown := base
+	for i := int64(1); i < lockouts; i++ {
+		cooldown *= 2
+		if max > 0 && cooldown >= max {
+			return max
+		}
+	}
+	if max > 0 && cooldown > max {
+		return max
+	}
+	return cooldown
+}
+
+// normalizeEmail makes counters case-insensitive so "A@x.com" and "a@x.com" share a bucket
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
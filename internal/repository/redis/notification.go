@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+const notificationChannelPrefix = "notifications:"
+
+// notificationBuffer is how many notifications a slow stream can fall behind by
+// before the newest are dropped; they remain in the feed
+const notificationBuffer = 16
+
+// NotificationBus publishes new notifications on a channel per user, so they reach
+// the user's streams on every replica
+type NotificationBus struct {
+	client *Client
+}
+
+// NewNotificationBus creates a new notification bus
+func NewNotificationBus(client *Client) *NotificationBus {
+	return &NotificationBus{client: client}
+}
+
+// Publish sends a notification to its user's subscribers
+func (b *NotificationBus) Publish(ctx context.Context, notification domain.Notification) error {
+	data, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	if err := b.client.rdb.Publish(ctx, notificationChannelPrefix+notification.UserID.String(), data).Err(); err != nil {
+		return fmt.Errorf("failed to publish notification: %w", err)
+	}
+	return nil
+}
+
+// Subscribe returns the notifications published for userID until ctx is done
+func (b *NotificationBus) Subscribe(ctx context.Context, userID uuid.UUID) (<-chan domain.Notification, error) {
+	pubsub := b.client.rdb.Subscribe(ctx, notificationChannelPrefix+userID.String())
+	// Wait for the subscription, so nothing published after Subscribe returns is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to notifications: %w", err)
+	}
+
+	out := make(chan domain.Notification, notificationBuffer)
+	go func() {
+		defer close(out)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var n domain.Notification
+				if err := json.Unmarshal([]byte(msg.Payload), &n); err != nil {
+					logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to decode notification")
+					continue
+				}
+				select {
+				case out <- n:
+				default:
+				}
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	oidcStatePrefix = "oidc:state:"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// OIDCStateStore keeps pending OIDC logins between the redirect and the callback
+type OIDCStateStore struct {
+	client *Client
+}
+
+// NewOIDCStateStore creates a new OIDC state store
+func NewOIDCStateStore(client *Client) *OIDCStateStore {
+	return &OIDCStateStore{client: client}
+}
+
+// Save stores the nonce and PKCE verifier for state
+func (s *OIDCStateStore) Save(ctx context.Context, state string, authState *domain.OIDCAuthState) error {
+	data, err := json.Marshal(authState)
+	if err != nil {
+		return fmt.Errorf("failed to marshal oidc state: %w", err)
+	}
+
+	return s.client.rdb.Set(ctx, oidcStatePrefix+state, data, oidcStateTTL).Err()
+}
+
+// Consume returns and deletes the data stored for state, so each state is usable once.
+// It returns nil if the state is unknown or expired.
+func (s *OIDCStateStore) Consume(ctx context.Context, state string) (*domain.OIDCAuthState, error) {
+	data, err := s.client.rdb.GetDel(ctx, oidcStatePrefix+state).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load oidc state: %w", err)
+	}
+
+	var authState domain.OIDCAuthState
+	if err := json.Unmarshal(data, &authState); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal oidc state: %w", err)
+	}
+
+	return &authState, nil
+}
@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const queryPagePrefix = "query:page:"
+
+// PageStore keeps the state behind page tokens of truncated query results
+type PageStore struct {
+	client *Client
+}
+
+// NewPageStore creates a new page store
+func NewPageStore(client *Client) *PageStore {
+	return &PageStore{client: client}
+}
+
+// Save stores page under token for ttl
+func (s *PageStore) Save(ctx context.Context, token string, page *domain.QueryPage, ttl time.Duration) error {
+	data, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query page: %w", err)
+	}
+	if err := s.client.rdb.Set(ctx, queryPagePrefix+token, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save query page: %w", err)
+	}
+	return nil
+}
+
+// Get returns the page stored under token, or nil if the token is unknown or expired
+func (s *PageStore) Get(ctx context.Context, token string) (*domain.QueryPage, error) {
+	data, err := s.client.rdb.Get(ctx, queryPagePrefix+token).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load query page: %w", err)
+	}
+
+	var page domain.QueryPage
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal query page: %w", err)
+	}
+	return &page, nil
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const quotaPrefix = "quota:"
+
+// reserveQuotaScript counts a query in the hash at KEYS[1] unless its queries reached
+// ARGV[1] or its tokens reached ARGV[2] (0 for no limit), then keeps the hash for ARGV[3]
+// milliseconds. It returns {counted, queries, tokens}.
+var reserveQuotaScript = redis.NewScript(`
+local queries = tonumber(redis.call('HGET', KEYS[1], 'queries') or '0')
+local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens') or '0')
+local max_queries = tonumber(ARGV[1])
+local max_tokens = tonumber(ARGV[2])
+
+if (max_queries > 0 and queries >= max_queries) or (max_tokens > 0 and tokens >= max_tokens) then
+	return {0, queries, tokens}
+end
+
+queries = redis.call('HINCRBY', KEYS[1], 'queries', 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return {1, queries, tokens}
+`)
+
+// QuotaStore keeps daily per-user LLM usage counters in Redis hashes. They live as long
+// as the Redis data does, so enable persistence for counters to survive a Redis restart.
+type QuotaStore struct {
+	client *Client
+}
+
+// NewQuotaStore creates a new quota store
+func NewQuotaStore(client *Client) *QuotaStore {
+	return &QuotaStore{client: client}
+}
+
+func quotaKey(key domain.QuotaKey) string {
+	return fmt.Sprintf("%s%s:%s:%s:%s", quotaPrefix, key.WorkspaceID, key.UserID, key.Day, key.ProviderClass)
+}
+
+// Reserve atomically counts one query unless the limit is reached
+func (s *QuotaStore) Reserve(ctx context.Context, key domain.QuotaKey, limit domain.QuotaLimit, ttl time.Duration) (domain.QuotaCounts, bool, error) {
+	result, err := reserveQuotaScript.Run(ctx, s.client.rdb, []string{quotaKey(key)},
+		limit.DailyQueries, limit.DailyTokens, ttl.Milliseconds()).Int64Slice()
+	if err != nil {
+		return domain.QuotaCounts{}, false, fmt.Errorf("failed to reserve quota: %w", err)
+	}
+	return domain.QuotaCounts{Queries: result[1], Tokens: result[2]}, result[0] == 1, nil
+}
+
+// AddTokens adds tokens to the counters of key
+func (s *QuotaStore) AddTokens(ctx context.Context, key domain.QuotaKey, tokens int64, ttl time.Duration) error {
+	pipe := s.client.rdb.TxPipeline()
+	pipe.HIncrBy(ctx, quotaKey(key), "tokens", tokens)
+	pipe.PExpire(ctx, quotaKey(key), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add quota tokens: %w", err)
+	}
+	return nil
+}
+
+// Get returns the counters of key, zero when nothing was counted
+func (s *QuotaStore) Get(ctx context.Context, key domain.QuotaKey) (domain.QuotaCounts, error) {
+	var counts struct {
+		Queries int64 `redis:"queries"`
+		Tokens  int64 `redis:"tokens"`
+	}
+	if err := s.client.rdb.HGetAll(ctx, quotaKey(key)).Scan(&counts); err != nil {
+		return domain.QuotaCounts{}, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+	return domain.QuotaCounts{Queries: counts.Queries, Tokens: counts.Tokens}, nil
+}
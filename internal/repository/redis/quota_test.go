@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuotaStore(t *testing.T) {
+	ctx := context.Background()
+	client, m := newMiniredisClient(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	store := NewQuotaStore(client)
+	key := domain.QuotaKey{WorkspaceID: uuid.New(), UserID: uuid.New(), ProviderClass: domain.ProviderClassHosted, Day: "2024-05-01"}
+	limit := domain.QuotaLimit{DailyQueries: 2, DailyTokens: 1000}
+
+	counts, err := store.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, domain.QuotaCounts{}, counts)
+
+	counts, ok, err := store.Reserve(ctx, key, limit, 12*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, domain.QuotaCounts{Queries: 1}, counts)
+	require.NoError(t, store.AddTokens(ctx, key, 400, 12*time.Hour))
+
+	counts, ok, err = store.Reserve(ctx, key, limit, 12*time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, domain.QuotaCounts{Queries: 2, Tokens: 400}, counts)
+
+	counts, ok, err = store.Reserve(ctx, key, limit, 12*time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok, "the query limit is reached")
+	assert.Equal(t, domain.QuotaCounts{Queries: 2, Tokens: 400}, counts)
+
+	t.Run("token limit", func(t *testing.T) {
+		other := key
+		other.ProviderClass = domain.ProviderClassLocal
+		require.NoError(t, store.AddTokens(ctx, other, 1000, time.Hour))
+		_, ok, err := store.Reserve(ctx, other, domain.QuotaLimit{DailyTokens: 1000}, time.Hour)
+		require.NoError(t, err)
+		assert.False(t, ok)
+
+		_, ok, err = store.Reserve(ctx, other, domain.QuotaLimit{DailyQueries: 5}, time.Hour)
+		require.NoError(t, err)
+		assert.True(t, ok, "tokens are unlimited without a token limit")
+	})
+
+	// Counters expire with their TTL
+	m.FastForward(13 * time.Hour)
+	counts, err = store.Get(ctx, key)
+	require.NoError(t, err)
+	assert.Equal(t, domain.QuotaCounts{}, counts)
+}
@@ -5,64 +5,150 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
 const (
-	rateLimitPrefix = "ratelimit:"
+	// rateLimitPrefix differs from the fixed-window counters used before, whose string
+	// keys would clash with the sorted sets
+	rateLimitPrefix = "ratelimit:sw:"
+
+	// rateLimitWindow is the sliding window requests are counted over
+	rateLimitWindow = time.Minute
 )
 
+// slidingWindowScript records a request in the sorted set KEYS[1] if fewer than
+// ARGV[2] requests were recorded in the last ARGV[1] microseconds. Time comes from
+// Redis so replicas with skewed clocks share one window. It returns whether the
+// request was allowed, the requests left and when the oldest recorded request leaves
+// the window, in microseconds since the epoch.
+var slidingWindowScript = redis.NewScript(`
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], math.ceil(window / 1000))
+
+local reset = now + window
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window
+end
+return {allowed, limit - count, reset}`)
+
 // RateLimiter handles rate limiting using Redis
 type RateLimiter struct {
 	client            *Client
+	class             string
 	requestsPerMinute int
 	burst             int
 }
 
-// NewRateLimiter creates a new rate limiter
+// NewRateLimiter creates a new rate limiter for the default bucket
 func NewRateLimiter(client *Client, requestsPerMinute, burst int) *RateLimiter {
 	return &RateLimiter{
 		client:            client,
+		class:             domain.DefaultRateLimitClass,
 		requestsPerMinute: requestsPerMinute,
 		burst:             burst,
 	}
 }
 
-// Allow checks if a request should be allowed based on rate limits
-// Returns (allowed, remaining, resetTime, error)
-func (r *RateLimiter) Allow(ctx context.Context, key string) (bool, int, time.Time, error) {
-	fullKey := fmt.Sprintf("%s%s", rateLimitPrefix, key)
-	now := time.Now()
-	windowStart := now.Truncate(time.Minute)
-	windowEnd := windowStart.Add(time.Minute)
+// ForClass returns a limiter for a named bucket with independent limits and counters
+func (r *RateLimiter) ForClass(class string, requestsPerMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		client:            r.client,
+		class:             class,
+		requestsPerMinute: requestsPerMinute,
+		burst:             burst,
+	}
+}
+
+// Class returns the name of the bucket this limiter counts against
+func (r *RateLimiter) Class() string {
+	return r.class
+}
 
-	pipe := r.client.rdb.Pipeline()
+// key returns the Redis key for a rate limit subject in this limiter's bucket
+func (r *RateLimiter) key(key string) string {
+	if r.class == domain.DefaultRateLimitClass {
+		return rateLimitPrefix + key
+	}
+	return rateLimitPrefix + r.class + ":" + key
+}
 
-	// Increment counter
-	incrCmd := pipe.Incr(ctx, fullKey)
+// Limit returns the number of requests allowed per window, including burst
+func (r *RateLimiter) Limit() int {
+	return r.requestsPerMinute + r.burst
+}
 
-	// Set expiry if key is new
-	pipe.ExpireNX(ctx, fullKey, time.Minute)
+// Allow records a request for key if fewer than Limit requests were recorded in the
+// last minute. Rejected requests are not recorded. It returns whether the request is
+// allowed, the requests left and when the next one becomes available.
+func (r *RateLimiter) Allow(ctx context.Context, key string) (bool, int, time.Time, error) {
+	return r.record(ctx, r.key(key), r.Limit(), uuid.NewString())
+}
 
-	_, err := pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
-		return false, 0, time.Time{}, fmt.Errorf("failed to execute rate limit check: %w", err)
+// AllowInWorkspace records a request for key and in the bucket shared by everyone in a
+// workspace, across all classes, if both have room: key's bucket below Limit and the
+// workspace's below workspaceLimit requests in the last minute. The buckets may live
+// on different cluster nodes, so the request is recorded for key first and taken back
+// when the workspace's bucket is full. It returns whether the request is allowed and
+// which bucket it reports: the one that rejected it, else the one with fewer requests
+// left, with that bucket's requests left and when its next one becomes available.
+func (r *RateLimiter) AllowInWorkspace(ctx context.Context, key string, workspaceID uuid.UUID, workspaceLimit int) (allowed, byWorkspace bool, remaining int, reset time.Time, err error) {
+	member := uuid.NewString()
+	userKey := r.key(key)
+	allowed, remaining, reset, err = r.record(ctx, userKey, r.Limit(), member)
+	if err != nil || !allowed {
+		return allowed, false, remaining, reset, err
 	}
 
-	count := incrCmd.Val()
-	limit := int64(r.requestsPerMinute + r.burst)
-	remaining := int(limit - count)
-	if remaining < 0 {
-		remaining = 0
+	wsAllowed, wsRemaining, wsReset, err := r.record(ctx, workspaceRateLimitKey(workspaceID), workspaceLimit, member)
+	if err != nil {
+		return false, false, 0, time.Time{}, err
 	}
+	if !wsAllowed {
+		if err := r.client.rdb.ZRem(ctx, userKey, member).Err(); err != nil {
+			return false, true, wsRemaining, wsReset, fmt.Errorf("failed to take back rate limited request: %w", err)
+		}
+		return false, true, wsRemaining, wsReset, nil
+	}
+	if wsRemaining < remaining {
+		return true, true, wsRemaining, wsReset, nil
+	}
+	return true, false, remaining, reset, nil
+}
 
-	allowed := count <= limit
+// workspaceRateLimitKey returns the Redis key of the bucket shared by a workspace
+func workspaceRateLimitKey(workspaceID uuid.UUID) string {
+	return rateLimitPrefix + "workspace:" + workspaceID.String()
+}
 
-	return allowed, remaining, windowEnd, nil
+// record runs the sliding window check on fullKey, recording member if the request is
+// allowed
+func (r *RateLimiter) record(ctx context.Context, fullKey string, limit int, member string) (bool, int, time.Time, error) {
+	res, err := slidingWindowScript.Run(ctx, r.client.rdb, []string{fullKey},
+		rateLimitWindow.Microseconds(), limit, member).Int64Slice()
+	if err != nil {
+		return false, 0, time.Time{}, fmt.Errorf("failed to execute rate limit check: %w", err)
+	}
+	return res[0] == 1, int(max(res[1], 0)), time.UnixMicro(res[2]), nil
 }
 
 // Reset resets the rate limit counter for a key
 func (r *RateLimiter) Reset(ctx context.Context, key string) error {
-	fullKey := fmt.Sprintf("%s%s", rateLimitPrefix, key)
+	fullKey := r.key(key)
 	return r.client.rdb.Del(ctx, fullKey).Err()
 }
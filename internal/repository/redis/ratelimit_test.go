@@ -0,0 +1,156 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMiniredisClient returns a client backed by an in-process Redis whose clock starts
+// at start
+func newMiniredisClient(t *testing.T, start time.Time) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	m := miniredis.RunT(t)
+	m.SetTime(start)
+	rdb := goredis.NewClient(&goredis.Options{Addr: m.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+	return &Client{rdb: rdb}, m
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := newMiniredisClient(t, start)
+	limiter := NewRateLimiter(client, 2, 1)
+
+	for want := 2; want >= 0; want-- {
+		allowed, remaining, reset, err := limiter.Allow(ctx, "user")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+		assert.Equal(t, want, remaining)
+		assert.Equal(t, start.Add(time.Minute), reset.UTC())
+	}
+
+	allowed, remaining, reset, err := limiter.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, start.Add(time.Minute), reset.UTC(), "a slot frees when the oldest request leaves the window")
+
+	// Classes and subjects count separately
+	allowed, _, _, err = limiter.ForClass("query", 1, 0).Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, _, _, err = limiter.Allow(ctx, "other-user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	require.NoError(t, limiter.Reset(ctx, "user"))
+	allowed, _, _, err = limiter.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+}
+
+func TestRateLimiter_SlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	// Just before a minute boundary, where a fixed window would reset its counter
+	start := time.Date(2024, 5, 1, 12, 0, 59, 0, time.UTC)
+	client, m := newMiniredisClient(t, start)
+	limiter := NewRateLimiter(client, 3, 0)
+
+	for i := 0; i < 3; i++ {
+		allowed, _, _, err := limiter.Allow(ctx, "user")
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	m.SetTime(start.Add(2 * time.Second))
+	allowed, _, reset, err := limiter.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.False(t, allowed, "crossing the minute boundary does not refill the window")
+	assert.Equal(t, start.Add(time.Minute), reset.UTC())
+
+	m.SetTime(start.Add(time.Minute + time.Millisecond))
+	allowed, remaining, _, err := limiter.Allow(ctx, "user")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 2, remaining, "the whole burst has left the window")
+}
+
+func TestRateLimiter_ConcurrentRequestsDoNotOvershoot(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newMiniredisClient(t, time.Now())
+	limiter := NewRateLimiter(client, 10, 5)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, _, err := limiter.Allow(ctx, "user")
+			assert.NoError(t, err)
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(limiter.Limit()), allowed.Load())
+}
+
+func TestRateLimiter_AllowInWorkspace(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client, _ := newMiniredisClient(t, start)
+	limiter := NewRateLimiter(client, 2, 0)
+	query := limiter.ForClass("query", 5, 0)
+	workspaceID := uuid.New()
+
+	// Each user is under their own limit while the workspace fills up across classes
+	allowed, byWorkspace, remaining, _, err := limiter.AllowInWorkspace(ctx, "alice", workspaceID, 3)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.False(t, byWorkspace, "alice has 1 left, the workspace 2")
+	assert.Equal(t, 1, remaining)
+
+	allowed, byWorkspace, remaining, _, err = query.AllowInWorkspace(ctx, "bob", workspaceID, 3)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.True(t, byWorkspace, "the workspace has fewer requests left than bob")
+	assert.Equal(t, 1, remaining)
+
+	allowed, _, _, _, err = limiter.AllowInWorkspace(ctx, "carol", workspaceID, 3)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	allowed, byWorkspace, remaining, reset, err := limiter.AllowInWorkspace(ctx, "dave", workspaceID, 3)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.True(t, byWorkspace)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, start.Add(time.Minute), reset.UTC())
+
+	// A request the workspace rejected does not count against the user
+	_, userRemaining, _, err := limiter.Allow(ctx, "dave")
+	require.NoError(t, err)
+	assert.Equal(t, 1, userRemaining)
+
+	// The user's own limit still applies and is reported as theirs
+	allowed, _, _, _, err = limiter.AllowInWorkspace(ctx, "alice", uuid.New(), 100)
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	allowed, byWorkspace, _, _, err = limiter.AllowInWorkspace(ctx, "alice", uuid.New(), 100)
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.False(t, byWorkspace)
+}
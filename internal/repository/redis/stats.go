@@ -0,0 +1,55 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+const platformStatsPrefix = "stats:platform:"
+
+// PlatformStatsCache keeps computed platform statistics for a short while, so admin
+// dashboards refreshing often do not aggregate the whole database each time
+type PlatformStatsCache struct {
+	client *Client
+}
+
+// NewPlatformStatsCache creates a new platform stats cache
+func NewPlatformStatsCache(client *Client) *PlatformStatsCache {
+	return &PlatformStatsCache{client: client}
+}
+
+// Get returns the statistics cached for a window of days, or nil if there are none
+func (c *PlatformStatsCache) Get(ctx context.Context, days int) (*domain.PlatformStats, error) {
+	data, err := c.client.rdb.Get(ctx, platformStatsPrefix+strconv.Itoa(days)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load platform stats: %w", err)
+	}
+
+	var stats domain.PlatformStats
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal platform stats: %w", err)
+	}
+	return &stats, nil
+}
+
+// Set caches the statistics of a window of days for ttl
+func (c *PlatformStatsCache) Set(ctx context.Context, days int, stats *domain.PlatformStats, ttl time.Duration) error {
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal platform stats: %w", err)
+	}
+	if err := c.client.rdb.Set(ctx, platformStatsPrefix+strconv.Itoa(days), data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to cache platform stats: %w", err)
+	}
+	return nil
+}
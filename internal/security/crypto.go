@@ -6,10 +6,15 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 )
 
+// ErrUndecryptable is returned for ciphertext that was not encrypted with the current
+// key, or was corrupted
+var ErrUndecryptable = errors.New("failed to decrypt")
+
 // Encryptor handles credential encryption/decryption
 type Encryptor struct {
 	key []byte
@@ -34,6 +39,13 @@ func NewEncryptorFromBase64(keyBase64 string) (*Encryptor, error) {
 	return NewEncryptor(key)
 }
 
+// NewEncryptorFromSecret derives a 32-byte key from a shared secret by truncating or zero-padding it
+func NewEncryptorFromSecret(secret string) (*Encryptor, error) {
+	key := make([]byte, 32)
+	copy(key, secret)
+	return NewEncryptor(key)
+}
+
 // GenerateKey generates a new random encryption key
 func GenerateKey() ([]byte, error) {
 	key := make([]byte, 32) // AES-256
@@ -78,13 +90,13 @@ func (e *Encryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrUndecryptable)
 	}
 
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt: %w", err)
+		return nil, fmt.Errorf("%w: %w", ErrUndecryptable, err)
 	}
 
 	return plaintext, nil
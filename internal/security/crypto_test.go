@@ -1,6 +1,7 @@
 package security_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/Rrens/text-to-sql/internal/security"
@@ -127,6 +128,18 @@ func TestEncryptor_DifferentCiphertexts(t *testing.T) {
 	}
 }
 
+func TestEncryptor_DecryptWithOtherKey(t *testing.T) {
+	encryptor, _ := security.NewEncryptorFromSecret("current")
+	previous, _ := security.NewEncryptorFromSecret("previous")
+
+	ciphertext, _ := previous.Encrypt([]byte("secret"))
+	for name, input := range map[string][]byte{"other key": ciphertext, "too short": []byte("x")} {
+		if _, err := encryptor.Decrypt(input); !errors.Is(err, security.ErrUndecryptable) {
+			t.Errorf("%s: expected ErrUndecryptable, got %v", name, err)
+		}
+	}
+}
+
 func TestGenerateKey(t *testing.T) {
 	key1, err := security.GenerateKey()
 	if err != nil {
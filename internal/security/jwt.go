@@ -14,6 +14,7 @@ type Claims struct {
 	UserID     uuid.UUID   `json:"sub"`
 	Email      string      `json:"email"`
 	Workspaces []uuid.UUID `json:"workspaces,omitempty"`
+	IsAdmin    bool        `json:"adm,omitempty"` // global administrator
 	jwt.RegisteredClaims
 }
 
@@ -35,11 +36,21 @@ func NewJWTManager(secret string, accessTTL, refreshTTL time.Duration) *JWTManag
 
 // GenerateAccessToken generates a new access token
 func (m *JWTManager) GenerateAccessToken(userID uuid.UUID, email string, workspaces []uuid.UUID) (string, error) {
+	return m.generateAccessToken(userID, email, workspaces, false)
+}
+
+// GenerateAdminAccessToken generates a new access token carrying the global admin flag
+func (m *JWTManager) GenerateAdminAccessToken(userID uuid.UUID, email string, workspaces []uuid.UUID) (string, error) {
+	return m.generateAccessToken(userID, email, workspaces, true)
+}
+
+func (m *JWTManager) generateAccessToken(userID uuid.UUID, email string, workspaces []uuid.UUID, isAdmin bool) (string, error) {
 	now := time.Now()
 	claims := Claims{
 		UserID:     userID,
 		Email:      email,
 		Workspaces: workspaces,
+		IsAdmin:    isAdmin,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(m.accessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -68,8 +79,8 @@ func (m *JWTManager) GenerateRefreshToken(userID uuid.UUID) (string, error) {
 }
 
 // GenerateTokenPair generates both access and refresh tokens
-func (m *JWTManager) GenerateTokenPair(userID uuid.UUID, email string, workspaces []uuid.UUID) (accessToken, refreshToken string, expiresIn int64, err error) {
-	accessToken, err = m.GenerateAccessToken(userID, email, workspaces)
+func (m *JWTManager) GenerateTokenPair(userID uuid.UUID, email string, workspaces []uuid.UUID, isAdmin bool) (accessToken, refreshToken string, expiresIn int64, err error) {
+	accessToken, err = m.generateAccessToken(userID, email, workspaces, isAdmin)
 	if err != nil {
 		return "", "", 0, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -50,7 +50,7 @@ func TestJWTManager_GenerateTokenPair(t *testing.T) {
 	userID := uuid.New()
 	email := "test@example.com"
 
-	accessToken, refreshToken, expiresIn, err := manager.GenerateTokenPair(userID, email, nil)
+	accessToken, refreshToken, expiresIn, err := manager.GenerateTokenPair(userID, email, nil, false)
 	if err != nil {
 		t.Fatalf("failed to generate token pair: %v", err)
 	}
@@ -111,3 +111,25 @@ func TestJWTManager_AccessTokenTTL(t *testing.T) {
 		t.Errorf("access token TTL mismatch: got %v, want %v", manager.AccessTokenTTL(), accessTTL)
 	}
 }
+
+func TestJWTManager_AdminClaim(t *testing.T) {
+	manager := security.NewJWTManager("test-secret-key-with-32-chars!!", 15*time.Minute, 7*24*time.Hour)
+
+	accessToken, _, _, err := manager.GenerateTokenPair(uuid.New(), "admin@example.com", nil, true)
+	if err != nil {
+		t.Fatalf("failed to generate token pair: %v", err)
+	}
+	claims, err := manager.ValidateAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("failed to validate token: %v", err)
+	}
+	if !claims.IsAdmin {
+		t.Error("expected admin claim to be set")
+	}
+
+	userToken, _ := manager.GenerateAccessToken(uuid.New(), "user@example.com", nil)
+	claims, _ = manager.ValidateAccessToken(userToken)
+	if claims.IsAdmin {
+		t.Error("expected admin claim to be unset")
+	}
+}
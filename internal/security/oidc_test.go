@@ -0,0 +1,195 @@
+package security_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIssuer is a minimal OpenID Connect provider for tests
+type fakeIssuer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	// claims overrides the ID token claims issued by the token endpoint
+	claims func(nonce string) jwt.MapClaims
+	// challenge and nonce are captured from the authorization request
+	challenge string
+	nonce     string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	f := &fakeIssuer{key: key, clientID: "test-client"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 f.server.URL,
+			"authorization_endpoint": f.server.URL + "/authorize",
+			"token_endpoint":         f.server.URL + "/token",
+			"jwks_uri":               f.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kid": "key-1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "opaque",
+			"token_type":   "Bearer",
+			"id_token":     f.signIDToken(t, f.claims(f.nonce)),
+		})
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	f.claims = f.defaultClaims
+	return f
+}
+
+func (f *fakeIssuer) defaultClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            f.server.URL,
+		"aud":            f.clientID,
+		"sub":            "subject-123",
+		"email":          "Jane@Example.com",
+		"email_verified": true,
+		"name":           "Jane",
+		"nonce":          nonce,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+}
+
+func (f *fakeIssuer) signIDToken(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "key-1"
+	signed, err := token.SignedString(f.key)
+	if err != nil {
+		t.Fatalf("failed to sign id token: %v", err)
+	}
+	return signed
+}
+
+// authorize simulates the browser visiting the authorization URL
+func (f *fakeIssuer) authorize(t *testing.T, authURL string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid auth url: %v", err)
+	}
+	if u.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("expected S256 PKCE challenge, got %q", u.Query().Get("code_challenge_method"))
+	}
+	f.challenge = u.Query().Get("code_challenge")
+	f.nonce = u.Query().Get("nonce")
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	idp := newFakeIssuer(t)
+	provider := security.NewOIDCProvider(idp.server.URL, idp.clientID, "secret", "http://localhost/callback", nil)
+	ctx := context.Background()
+
+	begin := func(t *testing.T) (verifier, nonce string) {
+		nonce, _ = security.GenerateOIDCState()
+		verifier, _ = security.GenerateOIDCState()
+		authURL, err := provider.AuthCodeURL(ctx, "state", nonce, verifier)
+		if err != nil {
+			t.Fatalf("AuthCodeURL failed: %v", err)
+		}
+		idp.authorize(t, authURL)
+		return verifier, nonce
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		verifier, nonce := begin(t)
+		identity, err := provider.Exchange(ctx, "code", verifier, nonce)
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		if identity.Subject != "subject-123" || identity.Email != "jane@example.com" || !identity.EmailVerified {
+			t.Errorf("unexpected identity: %+v", identity)
+		}
+	})
+
+	t.Run("wrong verifier", func(t *testing.T) {
+		_, nonce := begin(t)
+		if _, err := provider.Exchange(ctx, "code", "not-the-verifier", nonce); err == nil {
+			t.Error("expected error for mismatched PKCE verifier")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		verifier, _ := begin(t)
+		if _, err := provider.Exchange(ctx, "code", verifier, "other-nonce"); err == nil {
+			t.Error("expected error for mismatched nonce")
+		}
+	})
+
+	tests := []struct {
+		name   string
+		mutate func(jwt.MapClaims)
+	}{
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp.claims = func(nonce string) jwt.MapClaims {
+				c := idp.defaultClaims(nonce)
+				tt.mutate(c)
+				return c
+			}
+			defer func() { idp.claims = idp.defaultClaims }()
+
+			verifier, nonce := begin(t)
+			if _, err := provider.Exchange(ctx, "code", verifier, nonce); err == nil {
+				t.Error("expected id token to be rejected")
+			}
+		})
+	}
+
+	t.Run("unsigned token", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodNone, idp.defaultClaims("n"))
+		raw, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if _, err := provider.VerifyIDToken(ctx, raw, "n"); err == nil || !strings.Contains(err.Error(), "invalid id token") {
+			t.Errorf("expected unsigned token to be rejected, got %v", err)
+		}
+	})
+}
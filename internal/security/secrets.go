@@ -0,0 +1,117 @@
+package security
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EncryptedPrefix marks a config value that has already been encrypted
+const EncryptedPrefix = "enc:"
+
+// MaskPlaceholder replaces the hidden part of a masked secret
+const MaskPlaceholder = "****"
+
+// IsSecretField reports whether a config key holds a secret value
+func IsSecretField(key string) bool {
+	return key == "api_key"
+}
+
+// IsEncryptedValue reports whether a value was produced by EncryptSecrets
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, EncryptedPrefix)
+}
+
+// IsMaskedValue reports whether a value was produced by MaskSecret
+func IsMaskedValue(value string) bool {
+	return strings.Contains(value, MaskPlaceholder)
+}
+
+// MaskSecret hides all but the key prefix and last 4 characters (sk-****abcd)
+func MaskSecret(secret string) string {
+	if len(secret) < 8 {
+		return MaskPlaceholder
+	}
+
+	prefix := ""
+	if idx := strings.Index(secret, "-"); idx > 0 && idx <= 4 {
+		prefix = secret[:idx+1]
+	}
+
+	return prefix + MaskPlaceholder + secret[len(secret)-4:]
+}
+
+// EncryptSecrets returns a copy of cfg with every secret field encrypted.
+// Values that are already encrypted are left untouched, so it is safe to re-run.
+func (e *Encryptor) EncryptSecrets(cfg map[string]any) (map[string]any, error) {
+	return transformSecrets(cfg, func(value string) (string, error) {
+		if value == "" || IsEncryptedValue(value) {
+			return value, nil
+		}
+		encrypted, err := e.EncryptString(value)
+		if err != nil {
+			return "", err
+		}
+		return EncryptedPrefix + encrypted, nil
+	})
+}
+
+// DecryptSecrets returns a copy of cfg with every encrypted secret field decrypted
+func (e *Encryptor) DecryptSecrets(cfg map[string]any) (map[string]any, error) {
+	return transformSecrets(cfg, func(value string) (string, error) {
+		if !IsEncryptedValue(value) {
+			return value, nil
+		}
+		return e.DecryptString(strings.TrimPrefix(value, EncryptedPrefix))
+	})
+}
+
+// MaskSecrets returns a copy of cfg with every secret field masked for display
+func (e *Encryptor) MaskSecrets(cfg map[string]any) map[string]any {
+	masked, _ := transformSecrets(cfg, func(value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		if IsEncryptedValue(value) {
+			plaintext, err := e.DecryptString(strings.TrimPrefix(value, EncryptedPrefix))
+			if err != nil {
+				return MaskPlaceholder, nil
+			}
+			value = plaintext
+		}
+		return MaskSecret(value), nil
+	})
+	return masked
+}
+
+// transformSecrets copies cfg, applying fn to every string secret field in nested maps
+func transformSecrets(cfg map[string]any, fn func(string) (string, error)) (map[string]any, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	out := make(map[string]any, len(cfg))
+	for key, value := range cfg {
+		switch v := value.(type) {
+		case map[string]any:
+			nested, err := transformSecrets(v, fn)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = nested
+		case string:
+			if !IsSecretField(key) {
+				out[key] = v
+				continue
+			}
+			transformed, err := fn(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to process %s: %w", key, err)
+			}
+			out[key] = transformed
+		default:
+			out[key] = value
+		}
+	}
+
+	return out, nil
+}
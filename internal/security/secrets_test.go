@@ -0,0 +1,101 @@
+package security_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/security"
+)
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		want   string
+	}{
+		{"openai", "sk-proj-1234567890abcd", "sk-****abcd"},
+		{"anthropic", "sk-ant-api03-xyzwxyz9876", "sk-****9876"},
+		{"no prefix", "AIzaSyA1234567890wxyz", "****wxyz"},
+		{"short", "abc", "****"},
+		{"empty", "", "****"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := security.MaskSecret(tt.secret); got != tt.want {
+				t.Errorf("MaskSecret(%q) = %q, want %q", tt.secret, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptor_Secrets(t *testing.T) {
+	encryptor, err := security.NewEncryptorFromSecret("test-secret")
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+
+	cfg := map[string]any{
+		"openai": map[string]any{
+			"api_key": "sk-proj-1234567890abcd",
+			"model":   "gpt-4o",
+		},
+		"ollama": map[string]any{
+			"host": "http://localhost:11434",
+		},
+	}
+
+	encrypted, err := encryptor.EncryptSecrets(cfg)
+	if err != nil {
+		t.Fatalf("encrypt failed: %v", err)
+	}
+
+	openai := encrypted["openai"].(map[string]any)
+	apiKey := openai["api_key"].(string)
+	if !security.IsEncryptedValue(apiKey) || strings.Contains(apiKey, "1234567890abcd") {
+		t.Errorf("api_key was not encrypted: %q", apiKey)
+	}
+	if openai["model"] != "gpt-4o" {
+		t.Errorf("non-secret field changed: %v", openai["model"])
+	}
+	if cfg["openai"].(map[string]any)["api_key"] != "sk-proj-1234567890abcd" {
+		t.Error("input config was modified")
+	}
+
+	t.Run("idempotent", func(t *testing.T) {
+		again, err := encryptor.EncryptSecrets(encrypted)
+		if err != nil {
+			t.Fatalf("encrypt failed: %v", err)
+		}
+		if again["openai"].(map[string]any)["api_key"] != apiKey {
+			t.Error("re-encrypting changed an already encrypted value")
+		}
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+		decrypted, err := encryptor.DecryptSecrets(encrypted)
+		if err != nil {
+			t.Fatalf("decrypt failed: %v", err)
+		}
+		if got := decrypted["openai"].(map[string]any)["api_key"]; got != "sk-proj-1234567890abcd" {
+			t.Errorf("decrypted api_key = %v", got)
+		}
+	})
+
+	t.Run("mask", func(t *testing.T) {
+		masked := encryptor.MaskSecrets(encrypted)
+		if got := masked["openai"].(map[string]any)["api_key"]; got != "sk-****abcd" {
+			t.Errorf("masked api_key = %v", got)
+		}
+		if got := masked["ollama"].(map[string]any)["host"]; got != "http://localhost:11434" {
+			t.Errorf("non-secret field masked: %v", got)
+		}
+	})
+
+	t.Run("wrong key", func(t *testing.T) {
+		other, _ := security.NewEncryptorFromSecret("another-secret")
+		if _, err := other.DecryptSecrets(encrypted); err == nil {
+			t.Error("expected error decrypting with a different key")
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/google/uuid"
+)
+
+// GenerateAdhoc generates a query for a schema pasted by the user, using the dialect
+// hints registered for the database type. Nothing is connected to, run, cached or
+// recorded, but the workspace's provider allowlist and quotas still apply.
+func (s *QueryService) GenerateAdhoc(ctx context.Context, userID, workspaceID uuid.UUID, req domain.AdhocGenerateRequest) (*domain.QueryResponse, error) {
+	startTime := time.Now()
+
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleViewer); err != nil {
+		return nil, err
+	}
+	if len(req.SchemaDDL) > domain.MaxAdhocSchemaBytes {
+		return nil, &apperr.Error{
+			Kind:    apperr.Validation,
+			Message: fmt.Sprintf("schema_ddl exceeds %d bytes", domain.MaxAdhocSchemaBytes),
+			Details: map[string]any{"max_bytes": domain.MaxAdhocSchemaBytes},
+		}
+	}
+	databaseType := string(req.DatabaseType)
+	dialect, ok := s.mcpRouter.Dialect(databaseType)
+	if !ok {
+		return nil, apperr.Newf(apperr.Validation, "unsupported database type: %s", databaseType)
+	}
+
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		user = nil
+	}
+	providerName, modelName := resolveProvider(settings, user, domain.QueryRequest{LLMProvider: req.LLMProvider, LLMModel: req.LLMModel}, s.llmRouter.DefaultProvider())
+	if err := s.llmRouter.CheckSelection(ctx, providerName, req.LLMModel); err != nil {
+		return nil, selectionError(err)
+	}
+	if err := s.checkProvider(ctx, settings, workspaceID, userID, providerName, "generate_adhoc"); err != nil {
+		return nil, err
+	}
+	quota, err := s.quotas.Reserve(ctx, settings, workspaceID, userID, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	var llmConfig map[string]any
+	if user != nil {
+		llmConfig = s.providerConfig(user, providerName)
+	}
+	provider, err := s.llmRouter.GetProviderWithConfig(providerName, llmConfig)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Validation, fmt.Errorf("failed to get LLM provider: %w", err))
+	}
+	if modelName == "" {
+		modelName = provider.DefaultModel()
+	}
+
+	llmReq := llm.Request{
+		Question:     req.Question,
+		SchemaDDL:    req.SchemaDDL,
+		SQLDialect:   dialect,
+		DatabaseType: databaseType,
+	}
+	releaseLLM, err := s.acquireLLM(ctx, workspaceID, providerName)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLLM()
+	llmTimeout := s.generationTimeout(providerName, nil)
+	genCtx, cancelGen := context.WithCancel(ctx)
+	if llmTimeout > 0 {
+		genCtx, cancelGen = context.WithTimeout(ctx, llmTimeout)
+	}
+	llmStart := time.Now()
+	llmResp, err := provider.GenerateSQL(genCtx, llmReq, modelName)
+	releaseLLM()
+	genTimedOut := err != nil && errors.Is(genCtx.Err(), context.DeadlineExceeded)
+	cancelGen()
+	tokens := 0
+	if llmResp != nil {
+		tokens = llmResp.TokensUsed
+	}
+	quota.AddTokens(ctx, tokens)
+	s.metrics.ObserveLLMCall(providerName, modelName, time.Since(llmStart), tokens, err)
+	if genTimedOut {
+		return nil, apperr.Newf(apperr.Timeout, "SQL generation timed out after %s", llmTimeout)
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to generate SQL: %w", err))
+	}
+	if extract := queryExtractor(databaseType); extract != nil {
+		llmResp.SQL = extract(llmResp.Content)
+	}
+
+	resp := &domain.QueryResponse{
+		RequestID:   uuid.New().String(),
+		Question:    req.Question,
+		SQL:         llmResp.SQL,
+		Explanation: llmResp.Explanation,
+		Metadata: &domain.QueryMetadata{
+			DatabaseType:    databaseType,
+			LLMProvider:     providerName,
+			LLMModel:        modelName,
+			ExecutionTimeMs: time.Since(startTime).Milliseconds(),
+			LLMLatencyMs:    llmResp.LatencyMs,
+			TokensUsed:      llmResp.TokensUsed,
+			PromptTemplate:  llm.PromptVersion(llmReq),
+		},
+	}
+	recordPhases(ctx, resp.Metadata)
+	return resp, nil
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryService_GenerateAdhoc(t *testing.T) {
+	ctx := context.Background()
+	ddl := "CREATE TABLE orders (id int, total numeric);"
+
+	setup := func(t *testing.T) *executeQueryFixture {
+		f := newExecuteQueryFixture(t)
+		f.workspaceRepo.On("GetMember", mock.Anything, f.workspaceID, f.userID).
+			Return(&domain.WorkspaceMember{Role: domain.RoleViewer}, nil)
+		f.svc.mcpRouter.RegisterDialect("postgres", "PostgreSQL dialect")
+		return f
+	}
+
+	t.Run("generates from the pasted schema without connecting", func(t *testing.T) {
+		f := setup(t)
+		f.llmProvider.On("GenerateSQL", mock.Anything, mock.MatchedBy(func(req llm.Request) bool {
+			return req.SchemaDDL == ddl && req.SQLDialect == "PostgreSQL dialect" && req.DatabaseType == "postgres"
+		}), "mock-model").Return(&llm.Response{SQL: "SELECT SUM(total) FROM orders", Explanation: "Sums totals", TokensUsed: 12}, nil)
+
+		resp, err := f.svc.GenerateAdhoc(ctx, f.userID, f.workspaceID, domain.AdhocGenerateRequest{
+			SchemaDDL:    ddl,
+			DatabaseType: domain.DatabaseTypePostgres,
+			Question:     "Total revenue?",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "SELECT SUM(total) FROM orders", resp.SQL)
+		assert.Equal(t, "Sums totals", resp.Explanation)
+		assert.Equal(t, "mock-provider", resp.Metadata.LLMProvider)
+		assert.Zero(t, resp.Metadata.ConnectionID)
+		assert.Nil(t, resp.Result)
+		f.adapter.AssertNotCalled(t, "Connect", mock.Anything, mock.Anything)
+	})
+
+	t.Run("oversized schema", func(t *testing.T) {
+		f := setup(t)
+		_, err := f.svc.GenerateAdhoc(ctx, f.userID, f.workspaceID, domain.AdhocGenerateRequest{
+			SchemaDDL:    strings.Repeat("x", domain.MaxAdhocSchemaBytes+1),
+			DatabaseType: domain.DatabaseTypePostgres,
+			Question:     "Total revenue?",
+		})
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+		f.llmProvider.AssertNotCalled(t, "GenerateSQL", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("database type without a dialect", func(t *testing.T) {
+		f := setup(t)
+		_, err := f.svc.GenerateAdhoc(ctx, f.userID, f.workspaceID, domain.AdhocGenerateRequest{
+			SchemaDDL:    ddl,
+			DatabaseType: domain.DatabaseTypeMySQL,
+			Question:     "Total revenue?",
+		})
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+	})
+
+	t.Run("provider not allowed", func(t *testing.T) {
+		f := setup(t)
+		f.workspace.Settings.LLMProviderAllowlist = []string{"openai"}
+		_, err := f.svc.GenerateAdhoc(ctx, f.userID, f.workspaceID, domain.AdhocGenerateRequest{
+			SchemaDDL:    ddl,
+			DatabaseType: domain.DatabaseTypePostgres,
+			Question:     "Total revenue?",
+			LLMProvider:  "mock-provider",
+		})
+		assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+		f.llmProvider.AssertNotCalled(t, "GenerateSQL", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
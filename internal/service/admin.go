@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+// DeactivationList flags deactivated users for the auth middleware
+type DeactivationList interface {
+	Add(ctx context.Context, userID uuid.UUID) error
+	Remove(ctx context.Context, userID uuid.UUID) error
+}
+
+// AdminService handles platform administration for global admins.
+// Callers are expected to have checked the admin flag already.
+type AdminService struct {
+	userRepo      domain.UserRepository
+	workspaceRepo domain.WorkspaceRepository
+	auditRepo     domain.AuditLogRepository
+	deactivations DeactivationList
+	statsRepo     domain.PlatformStatsRepository // nil when platform statistics are not served
+	statsCache    PlatformStatsCache             // nil when statistics are computed on every call
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(
+	userRepo domain.UserRepository,
+	workspaceRepo domain.WorkspaceRepository,
+	auditRepo domain.AuditLogRepository,
+	deactivations DeactivationList,
+) *AdminService {
+	return &AdminService{
+		userRepo:      userRepo,
+		workspaceRepo: workspaceRepo,
+		auditRepo:     auditRepo,
+		deactivations: deactivations,
+	}
+}
+
+// ListUsers lists users matching term by email or display name
+func (s *AdminService) ListUsers(ctx context.Context, term string, limit, offset int) ([]*domain.User, int, error) {
+	return s.userRepo.Search(ctx, term, limit, offset)
+}
+
+// DeactivateUser blocks a user from signing in and revokes their outstanding access tokens
+func (s *AdminService) DeactivateUser(ctx context.Context, adminID, userID uuid.UUID, ipAddress string) error {
+	if adminID == userID {
+		return apperr.New(apperr.Validation, "cannot deactivate yourself")
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return apperr.New(apperr.NotFound, "user not found")
+	}
+	if user.DeactivatedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	if err := s.userRepo.SetDeactivated(ctx, userID, &now); err != nil {
+		return err
+	}
+	if err := s.deactivations.Add(ctx, userID); err != nil {
+		// The database flag still blocks login and refresh
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("user_id", userID.String()).Msg("failed to revoke access tokens of deactivated user")
+	}
+
+	s.audit(ctx, &domain.AuditLog{
+		UserID:       adminID,
+		Action:       domain.AuditActionUserDeactivate,
+		ResourceType: "user",
+		ResourceID:   &userID,
+		Metadata:     map[string]any{"email": user.Email},
+		IPAddress:    ipAddress,
+	})
+	return nil
+}
+
+// ReactivateUser lifts a deactivation
+func (s *AdminService) ReactivateUser(ctx context.Context, adminID, userID uuid.UUID, ipAddress string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return apperr.New(apperr.NotFound, "user not found")
+	}
+	if user.DeactivatedAt == nil {
+		return nil
+	}
+
+	if err := s.userRepo.SetDeactivated(ctx, userID, nil); err != nil {
+		return err
+	}
+	if err := s.deactivations.Remove(ctx, userID); err != nil {
+		return err
+	}
+
+	s.audit(ctx, &domain.AuditLog{
+		UserID:       adminID,
+		Action:       domain.AuditActionUserReactivate,
+		ResourceType: "user",
+		ResourceID:   &userID,
+		Metadata:     map[string]any{"email": user.Email},
+		IPAddress:    ipAddress,
+	})
+	return nil
+}
+
+// ListWorkspaces lists all workspaces with their member counts
+func (s *AdminService) ListWorkspaces(ctx context.Context, limit, offset int) ([]domain.WorkspaceSummary, int, error) {
+	return s.workspaceRepo.ListAll(ctx, limit, offset)
+}
+
+// JoinWorkspace adds the admin to any workspace for support purposes
+func (s *AdminService) JoinWorkspace(ctx context.Context, adminID, workspaceID uuid.UUID, role, ipAddress string) error {
+	if !domain.IsAssignableRole(role) {
+		return errors.New("invalid role")
+	}
+
+	workspace, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if workspace == nil {
+		return errors.New("workspace not found")
+	}
+
+	isMember, err := s.workspaceRepo.IsMember(ctx, workspaceID, adminID)
+	if err != nil {
+		return fmt.Errorf("failed to check membership: %w", err)
+	}
+	if isMember {
+		return errors.New("already a member")
+	}
+
+	member := &domain.WorkspaceMember{
+		WorkspaceID: workspaceID,
+		UserID:      adminID,
+		Role:        role,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
+		return fmt.Errorf("failed to add member: %w", err)
+	}
+
+	s.audit(ctx, &domain.AuditLog{
+		WorkspaceID:  workspaceID,
+		UserID:       adminID,
+		Action:       domain.AuditActionWorkspaceJoin,
+		ResourceType: "workspace",
+		ResourceID:   &workspaceID,
+		Metadata:     map[string]any{"role": role},
+		IPAddress:    ipAddress,
+	})
+	return nil
+}
+
+// audit records an admin action. Failures are logged, not returned, since the action already happened.
+func (s *AdminService) audit(ctx context.Context, entry *domain.AuditLog) {
+	if s.auditRepo == nil {
+		return
+	}
+
+	entry.ID = uuid.New()
+	entry.CreatedAt = time.Now()
+	if err := s.auditRepo.Create(ctx, entry); err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("action", entry.Action).Msg("failed to write admin audit log")
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+)
+
+// platformStatsTTL is how long computed platform statistics are served from the cache
+const platformStatsTTL = time.Minute
+
+// PlatformStatsCache keeps computed platform statistics by window
+type PlatformStatsCache interface {
+	// Get returns nil when nothing is cached for the window
+	Get(ctx context.Context, days int) (*domain.PlatformStats, error)
+	Set(ctx context.Context, days int, stats *domain.PlatformStats, ttl time.Duration) error
+}
+
+// WithStats serves platform statistics from repo, cached for a minute in cache unless it is nil
+func (s *AdminService) WithStats(repo domain.PlatformStatsRepository, cache PlatformStatsCache) *AdminService {
+	s.statsRepo = repo
+	s.statsCache = cache
+	return s
+}
+
+// Stats summarizes the installation over the last days, today included
+func (s *AdminService) Stats(ctx context.Context, days int) (*domain.PlatformStats, error) {
+	if s.statsRepo == nil {
+		return nil, errors.New("platform statistics are not available")
+	}
+	if s.statsCache != nil {
+		stats, err := s.statsCache.Get(ctx, days)
+		if err == nil && stats != nil {
+			return stats, nil
+		}
+		if err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to read cached platform stats")
+		}
+	}
+
+	now := time.Now().UTC()
+	since := now.Truncate(24*time.Hour).AddDate(0, 0, 1-days)
+	totals, err := s.statsRepo.Totals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := s.statsRepo.AnswerCounts(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	newUsers, err := s.statsRepo.NewUserCounts(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	stats := summarizePlatformStats(now, since, days, totals, answers, newUsers)
+
+	if s.statsCache != nil {
+		if err := s.statsCache.Set(ctx, days, stats, platformStatsTTL); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to cache platform stats")
+		}
+	}
+	return stats, nil
+}
+
+// summarizePlatformStats folds the per day and provider counts into totals, a series
+// with an entry for each of the days from since, and averages by provider
+func summarizePlatformStats(now, since time.Time, days int, totals *domain.PlatformTotals, answers []domain.DailyProviderCount, newUsers []domain.DayCount) *domain.PlatformStats {
+	stats := &domain.PlatformStats{
+		Since:             since,
+		GeneratedAt:       now,
+		Users:             totals.Users,
+		Workspaces:        totals.Workspaces,
+		ConnectionsByType: totals.ConnectionsByType,
+		ByProvider:        []domain.ProviderUsageStats{},
+		Daily:             make([]domain.DailyUsageStats, days),
+	}
+	for _, count := range totals.ConnectionsByType {
+		stats.Connections += count
+	}
+
+	daily := map[string]*domain.DailyUsageStats{}
+	for i := range stats.Daily {
+		date := since.AddDate(0, 0, i).Format(time.DateOnly)
+		stats.Daily[i].Date = date
+		daily[date] = &stats.Daily[i]
+	}
+
+	type providerSum struct {
+		usage        domain.ProviderUsageStats
+		latencyTotal int64
+		latencyCount int64
+	}
+	providers := map[string]*providerSum{}
+	for _, c := range answers {
+		stats.Queries += c.Queries
+		stats.Errors += c.Errors
+		stats.Tokens += c.Tokens
+		if day, ok := daily[c.Day.Format(time.DateOnly)]; ok {
+			day.Queries += c.Queries
+			day.Errors += c.Errors
+			day.Tokens += c.Tokens
+		}
+
+		sum, ok := providers[c.Provider]
+		if !ok {
+			sum = &providerSum{usage: domain.ProviderUsageStats{Provider: c.Provider}}
+			providers[c.Provider] = sum
+		}
+		sum.usage.Queries += c.Queries
+		sum.usage.Errors += c.Errors
+		sum.usage.Tokens += c.Tokens
+		sum.latencyTotal += c.LLMLatencyTotal
+		sum.latencyCount += c.LLMLatencyCount
+	}
+	for _, c := range newUsers {
+		if day, ok := daily[c.Day.Format(time.DateOnly)]; ok {
+			day.NewUsers += c.Count
+		}
+	}
+
+	if stats.Queries > 0 {
+		stats.ErrorRate = float64(stats.Errors) / float64(stats.Queries)
+	}
+	for _, sum := range providers {
+		if sum.latencyCount > 0 {
+			sum.usage.AvgLLMLatencyMs = sum.latencyTotal / sum.latencyCount
+		}
+		stats.ByProvider = append(stats.ByProvider, sum.usage)
+	}
+	slices.SortFunc(stats.ByProvider, func(a, b domain.ProviderUsageStats) int {
+		if c := cmp.Compare(b.Queries, a.Queries); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Provider, b.Provider)
+	})
+	return stats
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPlatformStatsRepository returns fixed figures and counts its calls
+type stubPlatformStatsRepository struct {
+	totals   *domain.PlatformTotals
+	answers  []domain.DailyProviderCount
+	newUsers []domain.DayCount
+	calls    int
+	since    time.Time
+}
+
+func (r *stubPlatformStatsRepository) Totals(ctx context.Context) (*domain.PlatformTotals, error) {
+	r.calls++
+	return r.totals, nil
+}
+
+func (r *stubPlatformStatsRepository) AnswerCounts(ctx context.Context, since time.Time) ([]domain.DailyProviderCount, error) {
+	r.since = since
+	return r.answers, nil
+}
+
+func (r *stubPlatformStatsRepository) NewUserCounts(ctx context.Context, since time.Time) ([]domain.DayCount, error) {
+	return r.newUsers, nil
+}
+
+// memoryPlatformStatsCache keeps platform stats in memory, ignoring the TTL
+type memoryPlatformStatsCache struct {
+	stats map[int]*domain.PlatformStats
+}
+
+func (c *memoryPlatformStatsCache) Get(ctx context.Context, days int) (*domain.PlatformStats, error) {
+	return c.stats[days], nil
+}
+
+func (c *memoryPlatformStatsCache) Set(ctx context.Context, days int, stats *domain.PlatformStats, ttl time.Duration) error {
+	c.stats[days] = stats
+	return nil
+}
+
+func TestSummarizePlatformStats(t *testing.T) {
+	now := time.Date(2024, 5, 3, 15, 0, 0, 0, time.UTC)
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+
+	stats := summarizePlatformStats(now, since, 3,
+		&domain.PlatformTotals{Users: 12, Workspaces: 4, ConnectionsByType: map[string]int64{"postgres": 5, "mysql": 2}},
+		[]domain.DailyProviderCount{
+			{Day: day(1), Provider: "openai", Queries: 10, Errors: 2, Tokens: 5000, LLMLatencyTotal: 9000, LLMLatencyCount: 9},
+			{Day: day(3), Provider: "openai", Queries: 6, Errors: 0, Tokens: 3000, LLMLatencyTotal: 1000, LLMLatencyCount: 1},
+			{Day: day(3), Provider: "ollama", Queries: 4, Errors: 2, Tokens: 800},
+		},
+		[]domain.DayCount{{Day: day(2), Count: 3}},
+	)
+
+	assert.Equal(t, since, stats.Since)
+	assert.Equal(t, now, stats.GeneratedAt)
+	assert.Equal(t, int64(7), stats.Connections)
+	assert.Equal(t, int64(20), stats.Queries)
+	assert.Equal(t, int64(4), stats.Errors)
+	assert.InDelta(t, 0.2, stats.ErrorRate, 1e-9)
+	assert.Equal(t, int64(8800), stats.Tokens)
+	assert.Equal(t, []domain.ProviderUsageStats{
+		{Provider: "openai", Queries: 16, Errors: 2, Tokens: 8000, AvgLLMLatencyMs: 1000},
+		{Provider: "ollama", Queries: 4, Errors: 2, Tokens: 800},
+	}, stats.ByProvider)
+	assert.Equal(t, []domain.DailyUsageStats{
+		{Date: "2024-05-01", Queries: 10, Errors: 2, Tokens: 5000},
+		{Date: "2024-05-02", NewUsers: 3},
+		{Date: "2024-05-03", Queries: 10, Errors: 2, Tokens: 3800},
+	}, stats.Daily, "days without answers are in the series")
+
+	t.Run("no answers", func(t *testing.T) {
+		stats := summarizePlatformStats(now, since, 1, &domain.PlatformTotals{}, nil, nil)
+		assert.Zero(t, stats.ErrorRate)
+		assert.NotNil(t, stats.ByProvider)
+		assert.Len(t, stats.Daily, 1)
+	})
+}
+
+func TestAdminService_StatsCached(t *testing.T) {
+	ctx := context.Background()
+	repo := &stubPlatformStatsRepository{totals: &domain.PlatformTotals{Users: 2, ConnectionsByType: map[string]int64{}}}
+	svc := NewAdminService(nil, nil, nil, nil).
+		WithStats(repo, &memoryPlatformStatsCache{stats: map[int]*domain.PlatformStats{}})
+
+	stats, err := svc.Stats(ctx, 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Users)
+	assert.Len(t, stats.Daily, 7)
+	assert.Equal(t, time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -6), repo.since, "the window starts at midnight UTC and includes today")
+
+	cached, err := svc.Stats(ctx, 7)
+	require.NoError(t, err)
+	assert.Same(t, stats, cached)
+	assert.Equal(t, 1, repo.calls)
+
+	_, err = svc.Stats(ctx, 30)
+	require.NoError(t, err)
+	assert.Equal(t, 2, repo.calls, "windows are cached separately")
+}
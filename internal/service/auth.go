@@ -4,36 +4,86 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/Rrens/text-to-sql/internal/apperr"
 	"github.com/Rrens/text-to-sql/internal/domain"
-	"github.com/Rrens/text-to-sql/internal/repository/postgres"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/security"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/api/idtoken"
 )
 
+// LoginLimiter tracks failed logins per account and locks it after repeated failures
+type LoginLimiter interface {
+	// Check returns the remaining lock duration, or 0 if the account is not locked
+	Check(ctx context.Context, email string) (time.Duration, error)
+	// RecordFailure counts a failure and returns the lock duration if it triggered a lock
+	RecordFailure(ctx context.Context, email string) (time.Duration, error)
+	// Reset clears the failure counters after a successful login
+	Reset(ctx context.Context, email string) error
+}
+
+// LockoutError is returned when an account is temporarily locked after repeated failed logins
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
 // AuthService handles authentication operations
 type AuthService struct {
-	userRepo      *postgres.UserRepository
-	workspaceRepo *postgres.WorkspaceRepository
+	userRepo      domain.UserRepository
+	workspaceRepo domain.WorkspaceRepository
 	jwtManager    *security.JWTManager
+	encryptor     *security.Encryptor
+	loginLimiter  LoginLimiter
+	auditRepo     domain.AuditLogRepository
+	llmRouter     *llm.Router
+	googleDomains []string // email domains allowed to sign in with Google, empty for any
 }
 
 // NewAuthService creates a new auth service
 func NewAuthService(
-	userRepo *postgres.UserRepository,
-	workspaceRepo *postgres.WorkspaceRepository,
+	userRepo domain.UserRepository,
+	workspaceRepo domain.WorkspaceRepository,
 	jwtManager *security.JWTManager,
+	encryptor *security.Encryptor,
+	loginLimiter LoginLimiter,
+	auditRepo domain.AuditLogRepository,
 ) *AuthService {
 	return &AuthService{
 		userRepo:      userRepo,
 		workspaceRepo: workspaceRepo,
 		jwtManager:    jwtManager,
+		encryptor:     encryptor,
+		loginLimiter:  loginLimiter,
+		auditRepo:     auditRepo,
 	}
 }
 
+// WithLLMRouter checks preferred providers and models against the registered providers
+// and resolves the system default for LLMDefaults
+func (s *AuthService) WithLLMRouter(router *llm.Router) *AuthService {
+	s.llmRouter = router
+	return s
+}
+
+// WithGoogleDomains restricts Google sign-in to emails of domains, the same allowlist
+// SSO sign-in uses
+func (s *AuthService) WithGoogleDomains(domains []string) *AuthService {
+	s.googleDomains = domains
+	return s
+}
+
 // Register creates a new user account
 func (s *AuthService) Register(ctx context.Context, input domain.UserCreate) (*domain.User, error) {
 	// Check if email already exists
@@ -71,21 +121,87 @@ func (s *AuthService) Register(ctx context.Context, input domain.UserCreate) (*d
 
 // Login authenticates a user and returns tokens
 func (s *AuthService) Login(ctx context.Context, input domain.UserLogin) (*domain.TokenPair, error) {
+	// Reject locked accounts before touching the password
+	if s.loginLimiter != nil {
+		remaining, err := s.loginLimiter.Check(ctx, input.Email)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to check login lockout, continuing")
+		} else if remaining > 0 {
+			return nil, &LockoutError{RetryAfter: remaining}
+		}
+	}
+
 	// Get user by email
 	user, err := s.userRepo.GetByEmail(ctx, input.Email)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("invalid credentials")
+		return nil, s.loginFailed(ctx, input, nil)
 	}
 
 	// Verify password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(input.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, s.loginFailed(ctx, input, user)
+	}
+
+	if s.loginLimiter != nil {
+		if err := s.loginLimiter.Reset(ctx, input.Email); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to reset login failures")
+		}
+	}
+
+	return s.issueTokens(ctx, user)
+}
+
+// LoginExternal finds or creates the user for a verified external identity and returns tokens.
+// An existing account with the same email is linked to the identity on first sign-in.
+func (s *AuthService) LoginExternal(ctx context.Context, provider, externalID, email, name string) (*domain.TokenPair, error) {
+	user, err := s.userRepo.GetByExternalID(ctx, provider, externalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user == nil {
+		user, err = s.userRepo.GetByEmail(ctx, email)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+	}
+
+	switch {
+	case user == nil:
+		now := time.Now()
+		user = &domain.User{
+			ID:           uuid.New(),
+			Email:        email,
+			DisplayName:  name,
+			AuthProvider: provider,
+			ExternalID:   externalID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := s.userRepo.Create(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+	case user.ExternalID == "":
+		if err := s.userRepo.LinkExternalID(ctx, user.ID, provider, externalID); err != nil {
+			return nil, err
+		}
+	case user.AuthProvider != provider || user.ExternalID != externalID:
+		return nil, errors.New("account is linked to a different identity")
+	}
+
+	return s.issueTokens(ctx, user)
+}
+
+// issueTokens generates a token pair carrying the user's workspace memberships.
+// It is the single place tokens are minted, so deactivated accounts are rejected here.
+func (s *AuthService) issueTokens(ctx context.Context, user *domain.User) (*domain.TokenPair, error) {
+	if user.DeactivatedAt != nil {
+		return nil, errors.New("account deactivated")
 	}
 
-	// Get user's workspaces
 	workspaces, err := s.workspaceRepo.ListByUserID(ctx, user.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workspaces: %w", err)
@@ -96,8 +212,7 @@ func (s *AuthService) Login(ctx context.Context, input domain.UserLogin) (*domai
 		workspaceIDs[i] = ws.ID
 	}
 
-	// Generate tokens
-	accessToken, refreshToken, expiresIn, err := s.jwtManager.GenerateTokenPair(user.ID, user.Email, workspaceIDs)
+	accessToken, refreshToken, expiresIn, err := s.jwtManager.GenerateTokenPair(user.ID, user.Email, workspaceIDs, user.IsAdmin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tokens: %w", err)
 	}
@@ -109,6 +224,52 @@ func (s *AuthService) Login(ctx context.Context, input domain.UserLogin) (*domai
 	}, nil
 }
 
+// loginFailed records a failed login and returns the error to report to the client.
+// user is nil when the email is unknown.
+func (s *AuthService) loginFailed(ctx context.Context, input domain.UserLogin, user *domain.User) error {
+	invalid := errors.New("invalid credentials")
+	if s.loginLimiter == nil {
+		return invalid
+	}
+
+	lockedFor, err := s.loginLimiter.RecordFailure(ctx, input.Email)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to record login failure")
+		return invalid
+	}
+	if lockedFor == 0 {
+		return invalid
+	}
+
+	logging.FromContext(ctx).Warn().Ctx(ctx).
+		Str("ip", input.IPAddress).
+		Dur("cooldown", lockedFor).
+		Msg("account locked after repeated failed logins")
+
+	if s.auditRepo != nil {
+		entry := &domain.AuditLog{
+			ID:           uuid.New(),
+			Action:       domain.AuditActionLoginLockout,
+			ResourceType: "user",
+			Metadata: map[string]any{
+				"email":            input.Email,
+				"cooldown_seconds": int(lockedFor.Seconds()),
+			},
+			IPAddress: input.IPAddress,
+			CreatedAt: time.Now(),
+		}
+		if user != nil {
+			entry.UserID = user.ID
+			entry.ResourceID = &user.ID
+		}
+		if err := s.auditRepo.Create(ctx, entry); err != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Msg("failed to write lockout audit log")
+		}
+	}
+
+	return &LockoutError{RetryAfter: lockedFor}
+}
+
 // Refresh refreshes the access token using a refresh token
 func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*domain.TokenPair, error) {
 	// Validate refresh token
@@ -123,50 +284,71 @@ func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*domain
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, apperr.New(apperr.NotFound, "user not found")
 	}
 
-	// Get user's workspaces
-	workspaces, err := s.workspaceRepo.ListByUserID(ctx, user.ID)
+	return s.issueTokens(ctx, user)
+}
+
+// GetUserByID retrieves a user by ID
+func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
+	return s.userRepo.GetByID(ctx, userID)
+}
+
+// MaskLLMConfig returns the user's LLM configuration with API keys masked for display
+func (s *AuthService) MaskLLMConfig(config map[string]any) map[string]any {
+	return s.encryptor.MaskSecrets(config)
+}
+
+// MaxLLMConfigSize caps the body of an LLM config update
+const MaxLLMConfigSize = 16 << 10
+
+// UpdateLLMConfig merges patch into the user's LLM configuration, encrypting API keys
+// before they are stored. A provider or setting set to null is removed, settings given
+// replace the stored ones and the rest are kept. Providers must be registered and
+// settings ones the provider reads.
+func (s *AuthService) UpdateLLMConfig(ctx context.Context, userID uuid.UUID, patch map[string]any) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get workspaces: %w", err)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
-
-	workspaceIDs := make([]uuid.UUID, len(workspaces))
-	for i, ws := range workspaces {
-		workspaceIDs[i] = ws.ID
+	if user == nil {
+		return nil, apperr.New(apperr.NotFound, "user not found")
 	}
 
-	// Generate new tokens
-	accessToken, newRefreshToken, expiresIn, err := s.jwtManager.GenerateTokenPair(user.ID, user.Email, workspaceIDs)
+	merged, err := s.mergeLLMConfig(user.LLMConfig, patch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate tokens: %w", err)
+		return nil, err
 	}
-
-	return &domain.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: newRefreshToken,
-		ExpiresIn:    expiresIn,
-	}, nil
+	return s.saveLLMConfig(ctx, user, merged)
 }
 
-// GetUserByID retrieves a user by ID
-func (s *AuthService) GetUserByID(ctx context.Context, userID uuid.UUID) (*domain.User, error) {
-	return s.userRepo.GetByID(ctx, userID)
-}
-
-// UpdateLLMConfig updates user's LLM configuration
-func (s *AuthService) UpdateLLMConfig(ctx context.Context, userID uuid.UUID, config map[string]any) (*domain.User, error) {
+// DeleteLLMConfig removes the settings and credentials the user stored for a provider
+func (s *AuthService) DeleteLLMConfig(ctx context.Context, userID uuid.UUID, provider string) (*domain.User, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, apperr.New(apperr.NotFound, "user not found")
+	}
+	if _, ok := user.LLMConfig[provider]; !ok {
+		return user, nil
 	}
 
-	// Update config
-	user.LLMConfig = config
+	config := maps.Clone(user.LLMConfig)
+	delete(config, provider)
+	return s.saveLLMConfig(ctx, user, config)
+}
+
+// saveLLMConfig encrypts and stores config as the user's LLM configuration
+func (s *AuthService) saveLLMConfig(ctx context.Context, user *domain.User, config map[string]any) (*domain.User, error) {
+	encrypted, err := s.encryptor.EncryptSecrets(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt llm config: %w", err)
+	}
+
+	user.LLMConfig = encrypted
 	user.UpdatedAt = time.Now()
 
 	if err := s.userRepo.Update(ctx, user); err != nil {
@@ -176,6 +358,53 @@ func (s *AuthService) UpdateLLMConfig(ctx context.Context, userID uuid.UUID, con
 	return user, nil
 }
 
+// mergeLLMConfig applies patch to the stored config without changing it. Masked API
+// keys, which clients echo back from /auth/me, keep the stored key.
+func (s *AuthService) mergeLLMConfig(stored, patch map[string]any) (map[string]any, error) {
+	merged := maps.Clone(stored)
+	if merged == nil {
+		merged = map[string]any{}
+	}
+	for provider, value := range patch {
+		if value == nil {
+			delete(merged, provider)
+			continue
+		}
+		settings, ok := value.(map[string]any)
+		if !ok {
+			return nil, apperr.Newf(apperr.Validation, "llm_config.%s must be an object or null", provider)
+		}
+		if s.llmRouter != nil && !slices.Contains(s.llmRouter.Available(), provider) {
+			return nil, apperr.Newf(apperr.Validation, "llm_config: unknown provider %q, available: %s", provider, strings.Join(s.llmRouter.Available(), ", "))
+		}
+
+		current, _ := merged[provider].(map[string]any)
+		next := maps.Clone(current)
+		if next == nil {
+			next = map[string]any{}
+		}
+		for key, setting := range settings {
+			if setting == nil {
+				delete(next, key)
+				continue
+			}
+			if err := llm.CheckUserSetting(provider, key, setting); err != nil {
+				return nil, apperr.Wrap(apperr.Validation, err)
+			}
+			if v, ok := setting.(string); ok && security.IsSecretField(key) && security.IsMaskedValue(v) {
+				continue
+			}
+			next[key] = setting
+		}
+		if len(next) == 0 {
+			delete(merged, provider)
+			continue
+		}
+		merged[provider] = next
+	}
+	return merged, nil
+}
+
 // UpdateProfile updates user's display name
 func (s *AuthService) UpdateProfile(ctx context.Context, userID uuid.UUID, displayName string) (*domain.User, error) {
 	user, err := s.userRepo.GetByID(ctx, userID)
@@ -183,7 +412,7 @@ func (s *AuthService) UpdateProfile(ctx context.Context, userID uuid.UUID, displ
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 	if user == nil {
-		return nil, errors.New("user not found")
+		return nil, apperr.New(apperr.NotFound, "user not found")
 	}
 
 	user.DisplayName = displayName
@@ -196,6 +425,79 @@ func (s *AuthService) UpdateProfile(ctx context.Context, userID uuid.UUID, displ
 	return user, nil
 }
 
+// UpdatePreferences sets the user's preferred LLM provider and model and the
+// notification types they turned off. Changing the provider without naming a model
+// clears the preferred model.
+func (s *AuthService) UpdatePreferences(ctx context.Context, userID uuid.UUID, input domain.UserPreferences) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, apperr.New(apperr.NotFound, "user not found")
+	}
+
+	if input.PreferredProvider != nil {
+		provider := strings.TrimSpace(*input.PreferredProvider)
+		if provider != user.PreferredProvider {
+			user.PreferredModel = ""
+		}
+		user.PreferredProvider = provider
+	}
+	if input.PreferredModel != nil {
+		user.PreferredModel = strings.TrimSpace(*input.PreferredModel)
+	}
+	if input.MutedNotifications != nil {
+		muted := []string{}
+		for _, t := range *input.MutedNotifications {
+			if !domain.IsNotificationType(t) {
+				return nil, apperr.New(apperr.Validation, fmt.Sprintf("unknown notification type %q, available: %s", t, strings.Join(domain.NotificationTypes, ", ")))
+			}
+			if !slices.Contains(muted, t) {
+				muted = append(muted, t)
+			}
+		}
+		user.MutedNotifications = muted
+	}
+	if user.PreferredProvider == "" {
+		if user.PreferredModel != "" {
+			return nil, apperr.New(apperr.Validation, "preferred_model requires preferred_provider")
+		}
+	} else if s.llmRouter != nil {
+		if err := s.llmRouter.CheckSelection(ctx, user.PreferredProvider, user.PreferredModel); err != nil {
+			return nil, selectionError(err)
+		}
+	}
+	user.UpdatedAt = time.Now()
+
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update preferences: %w", err)
+	}
+
+	return user, nil
+}
+
+// LLMDefaults returns the provider and model the user's queries use when they name
+// none: the user's preferences, else the system default provider and its default model
+func (s *AuthService) LLMDefaults(user *domain.User) domain.LLMDefaults {
+	if user.PreferredProvider != "" {
+		return domain.LLMDefaults{
+			Provider: user.PreferredProvider,
+			Model:    user.PreferredModel,
+			Source:   domain.LLMDefaultsSourceUser,
+		}
+	}
+
+	defaults := domain.LLMDefaults{Source: domain.LLMDefaultsSourceSystem}
+	if s.llmRouter != nil {
+		defaults.Provider = s.llmRouter.DefaultProvider()
+		if provider, err := s.llmRouter.GetProvider(defaults.Provider); err == nil {
+			defaults.Model = provider.DefaultModel()
+		}
+	}
+	return defaults
+}
+
 // GoogleLogin authenticates a user via Google OAuth and returns tokens
 func (s *AuthService) GoogleLogin(ctx context.Context, idToken string) (*domain.TokenPair, error) {
 	// Verify the token
@@ -207,10 +509,9 @@ func (s *AuthService) GoogleLogin(ctx context.Context, idToken string) (*domain.
 		return nil, fmt.Errorf("invalid google token: %w", err)
 	}
 
-	// Extract email and name
-	email, ok := payload.Claims["email"].(string)
-	if !ok || email == "" {
-		return nil, errors.New("email not found in google token")
+	email, err := googleLoginEmail(payload.Claims, s.googleDomains)
+	if err != nil {
+		return nil, err
 	}
 
 	name, _ := payload.Claims["name"].(string)
@@ -242,26 +543,51 @@ func (s *AuthService) GoogleLogin(ctx context.Context, idToken string) (*domain.
 		}
 	}
 
-	// Get user's workspaces
-	workspaces, err := s.workspaceRepo.ListByUserID(ctx, user.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get workspaces: %w", err)
-	}
+	return s.issueTokens(ctx, user)
+}
 
-	workspaceIDs := make([]uuid.UUID, len(workspaces))
-	for i, ws := range workspaces {
-		workspaceIDs[i] = ws.ID
+// googleLoginEmail returns the email of a Google ID token's claims. With allowedDomains
+// set, the email must be verified and in one of them.
+func googleLoginEmail(claims map[string]any, allowedDomains []string) (string, error) {
+	email, ok := claims["email"].(string)
+	if !ok || email == "" {
+		return "", errors.New("email not found in google token")
+	}
+	if len(allowedDomains) > 0 {
+		if verified, _ := claims["email_verified"].(bool); !verified {
+			return "", errors.New("google email is not verified")
+		}
+		if !emailDomainAllowed(email, allowedDomains) {
+			return "", errors.New("email domain not allowed")
+		}
 	}
+	return email, nil
+}
 
-	// Generate tokens
-	accessToken, refreshToken, expiresIn, err := s.jwtManager.GenerateTokenPair(user.ID, user.Email, workspaceIDs)
+// BackfillLLMConfigEncryption encrypts API keys that were stored in plaintext before
+// encryption was introduced. It is idempotent and returns the number of users updated.
+func BackfillLLMConfigEncryption(ctx context.Context, userRepo domain.UserRepository, encryptor *security.Encryptor) (int, error) {
+	users, err := userRepo.ListWithLLMConfig(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate tokens: %w", err)
+		return 0, err
 	}
 
-	return &domain.TokenPair{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		ExpiresIn:    expiresIn,
-	}, nil
+	updated := 0
+	for _, user := range users {
+		encrypted, err := encryptor.EncryptSecrets(user.LLMConfig)
+		if err != nil {
+			return updated, fmt.Errorf("failed to encrypt llm config for user %s: %w", user.ID, err)
+		}
+		if reflect.DeepEqual(encrypted, user.LLMConfig) {
+			continue
+		}
+
+		user.LLMConfig = encrypted
+		if err := userRepo.Update(ctx, user); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+
+	return updated, nil
 }
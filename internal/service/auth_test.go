@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthService_UpdatePreferences(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	provider := new(MockLLMProvider)
+	provider.On("Name").Return("openai")
+	provider.On("IsConfigured").Return(true)
+	provider.On("AvailableModels").Return([]string{"gpt-4o", "gpt-4o-mini"})
+	provider.On("DefaultModel").Return("gpt-4o")
+	router := llm.NewRouter("openai")
+	router.RegisterProvider(provider)
+
+	newService := func(user *domain.User) (*AuthService, *MockUserRepository) {
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByID", ctx, userID).Return(user, nil)
+		userRepo.On("Update", ctx, mock.AnythingOfType("*domain.User")).Return(nil)
+		return NewAuthService(userRepo, nil, nil, nil, nil, nil).WithLLMRouter(router), userRepo
+	}
+	str := func(s string) *string { return &s }
+
+	t.Run("sets provider and model", func(t *testing.T) {
+		svc, userRepo := newService(&domain.User{ID: userID})
+
+		user, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{
+			PreferredProvider: str("openai"),
+			PreferredModel:    str("gpt-4o-mini"),
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "openai", user.PreferredProvider)
+		assert.Equal(t, "gpt-4o-mini", user.PreferredModel)
+		assert.Equal(t, domain.LLMDefaults{Provider: "openai", Model: "gpt-4o-mini", Source: domain.LLMDefaultsSourceUser}, svc.LLMDefaults(user))
+		userRepo.AssertCalled(t, "Update", ctx, user)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		svc, userRepo := newService(&domain.User{ID: userID})
+
+		_, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{PreferredProvider: str("groq")})
+		assert.EqualError(t, err, `unknown llm provider "groq", available: openai`)
+		userRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown model", func(t *testing.T) {
+		svc, _ := newService(&domain.User{ID: userID})
+
+		_, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{
+			PreferredProvider: str("openai"),
+			PreferredModel:    str("claude-3"),
+		})
+		assert.ErrorContains(t, err, `unknown llm model "claude-3" for openai`)
+	})
+
+	t.Run("model without provider", func(t *testing.T) {
+		svc, _ := newService(&domain.User{ID: userID})
+
+		_, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{PreferredModel: str("gpt-4o")})
+		assert.EqualError(t, err, "preferred_model requires preferred_provider")
+	})
+
+	t.Run("clearing the provider clears the model", func(t *testing.T) {
+		svc, _ := newService(&domain.User{ID: userID, PreferredProvider: "openai", PreferredModel: "gpt-4o"})
+
+		user, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{PreferredProvider: str("")})
+		require.NoError(t, err)
+		assert.Empty(t, user.PreferredProvider)
+		assert.Empty(t, user.PreferredModel)
+		assert.Equal(t, domain.LLMDefaults{Provider: "openai", Model: "gpt-4o", Source: domain.LLMDefaultsSourceSystem}, svc.LLMDefaults(user))
+	})
+
+	t.Run("muted notifications", func(t *testing.T) {
+		svc, userRepo := newService(&domain.User{ID: userID, MutedNotifications: []string{domain.NotificationQuotaWarning}})
+
+		muted := []string{domain.NotificationConnectionRecovered, domain.NotificationConnectionRecovered}
+		user, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{MutedNotifications: &muted})
+		require.NoError(t, err)
+		assert.Equal(t, []string{domain.NotificationConnectionRecovered}, user.MutedNotifications)
+
+		unknown := []string{"query.completed"}
+		_, err = svc.UpdatePreferences(ctx, userID, domain.UserPreferences{MutedNotifications: &unknown})
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+		userRepo.AssertNumberOfCalls(t, "Update", 1)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		svc, _ := newService(nil)
+
+		_, err := svc.UpdatePreferences(ctx, userID, domain.UserPreferences{PreferredProvider: str("openai")})
+		assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	})
+}
+
+func TestAuthService_UpdateLLMConfig(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	encryptor, err := security.NewEncryptorFromSecret("auth-test-secret")
+	require.NoError(t, err)
+	router := llm.NewRouter("openai")
+	for _, name := range []string{"openai", "ollama"} {
+		router.RegisterFactory(name, func(map[string]any) (llm.Provider, error) { return nil, nil })
+	}
+	storedKey, err := encryptor.EncryptSecrets(map[string]any{"api_key": "sk-stored-key-1234"})
+	require.NoError(t, err)
+
+	newService := func() (*AuthService, *MockUserRepository) {
+		user := &domain.User{ID: userID, LLMConfig: map[string]any{
+			"openai": map[string]any{"api_key": storedKey["api_key"], "model": "gpt-4o"},
+			"ollama": map[string]any{"host": "http://gpu:11434", "model": "llama3"},
+		}}
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByID", ctx, userID).Return(user, nil)
+		userRepo.On("Update", ctx, mock.AnythingOfType("*domain.User")).Return(nil)
+		return NewAuthService(userRepo, nil, nil, encryptor, nil, nil).WithLLMRouter(router), userRepo
+	}
+
+	t.Run("merges instead of replacing", func(t *testing.T) {
+		svc, _ := newService()
+
+		user, err := svc.UpdateLLMConfig(ctx, userID, map[string]any{
+			"ollama": map[string]any{"model": "qwen2.5-coder", "host": nil},
+			"openai": map[string]any{"api_key": "sk-****1234", "timeout": float64(60)},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"model": "qwen2.5-coder"}, user.LLMConfig["ollama"])
+		// The masked key echoed back keeps the stored one
+		assert.Equal(t, map[string]any{"api_key": storedKey["api_key"], "model": "gpt-4o", "timeout": float64(60)}, user.LLMConfig["openai"])
+		assert.Equal(t, map[string]any{
+			"openai": map[string]any{"api_key": "sk-****1234", "model": "gpt-4o", "timeout": float64(60)},
+			"ollama": map[string]any{"model": "qwen2.5-coder"},
+		}, svc.MaskLLMConfig(user.LLMConfig))
+	})
+
+	t.Run("new key is encrypted, null removes a provider", func(t *testing.T) {
+		svc, _ := newService()
+
+		user, err := svc.UpdateLLMConfig(ctx, userID, map[string]any{
+			"openai": map[string]any{"api_key": "sk-new-key-5678"},
+			"ollama": nil,
+		})
+		require.NoError(t, err)
+		assert.NotContains(t, user.LLMConfig, "ollama")
+		key := user.LLMConfig["openai"].(map[string]any)["api_key"].(string)
+		assert.True(t, security.IsEncryptedValue(key))
+		decrypted, err := encryptor.DecryptSecrets(user.LLMConfig)
+		require.NoError(t, err)
+		assert.Equal(t, "sk-new-key-5678", decrypted["openai"].(map[string]any)["api_key"])
+	})
+
+	for name, tt := range map[string]struct {
+		patch map[string]any
+		err   string
+	}{
+		"unknown provider": {map[string]any{"groq": map[string]any{"api_key": "x"}}, `llm_config: unknown provider "groq", available: ollama, openai`},
+		"not an object":    {map[string]any{"openai": "sk-key"}, "llm_config.openai must be an object or null"},
+		"unknown setting":  {map[string]any{"openai": map[string]any{"host": "x"}}, `llm_config.openai: unknown setting "host", allowed: api_key, base_url, http_proxy, model, timeout`},
+		"not a string":     {map[string]any{"openai": map[string]any{"model": float64(4)}}, "llm_config.openai.model must be a string"},
+		"not a number":     {map[string]any{"ollama": map[string]any{"num_ctx": "big"}}, "llm_config.ollama.num_ctx must be a number"},
+		"nested object":    {map[string]any{"ollama": map[string]any{"timeout": map[string]any{}}}, "llm_config.ollama.timeout must be a string or a number"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc, userRepo := newService()
+
+			_, err := svc.UpdateLLMConfig(ctx, userID, tt.patch)
+			assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+			assert.EqualError(t, err, tt.err)
+			userRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+	}
+
+	t.Run("delete one provider", func(t *testing.T) {
+		svc, userRepo := newService()
+
+		user, err := svc.DeleteLLMConfig(ctx, userID, "openai")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"ollama": map[string]any{"host": "http://gpu:11434", "model": "llama3"}}, user.LLMConfig)
+
+		// Nothing stored for it is nothing to do
+		_, err = svc.DeleteLLMConfig(ctx, userID, "anthropic")
+		require.NoError(t, err)
+		userRepo.AssertNumberOfCalls(t, "Update", 1)
+	})
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+)
+
+// requireRole returns the user's membership if their role in the workspace is at least minRole
+func requireRole(ctx context.Context, repo domain.WorkspaceRepository, workspaceID, userID uuid.UUID, minRole string) (*domain.WorkspaceMember, error) {
+	member, err := repo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get member: %w", err)
+	}
+	if member == nil {
+		return nil, apperr.New(apperr.Forbidden, "access denied")
+	}
+	if !domain.RoleAtLeast(member.Role, minRole) {
+		return nil, apperr.New(apperr.Forbidden, roleRequiredMessage(minRole))
+	}
+	return member, nil
+}
+
+// roleRequiredMessage returns the error message for a caller below minRole
+func roleRequiredMessage(minRole string) string {
+	switch minRole {
+	case domain.RoleOwner:
+		return "owner access required"
+	case domain.RoleAdmin:
+		return "admin access required"
+	case domain.RoleMember:
+		return "write access required"
+	default:
+		return "access denied"
+	}
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// authzFixture wires services to mocks where every data call succeeds, so only
+// the role check decides the outcome.
+type authzFixture struct {
+	workspaceService  *WorkspaceService
+	connectionService *ConnectionService
+	queryService      *QueryService
+
+	userID       uuid.UUID
+	workspaceID  uuid.UUID
+	connectionID uuid.UUID
+	sessionID    uuid.UUID
+
+	// adminID and viewerID are other members of the workspace
+	adminID  uuid.UUID
+	viewerID uuid.UUID
+}
+
+func newAuthzFixture(t *testing.T, role string) *authzFixture {
+	f := &authzFixture{
+		userID:       uuid.New(),
+		workspaceID:  uuid.New(),
+		connectionID: uuid.New(),
+		sessionID:    uuid.New(),
+		adminID:      uuid.New(),
+		viewerID:     uuid.New(),
+	}
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	if role == "" {
+		workspaceRepo.On("GetMember", mock.Anything, f.workspaceID, f.userID).Return(nil, nil)
+		workspaceRepo.On("IsMember", mock.Anything, f.workspaceID, f.userID).Return(false, nil)
+	} else {
+		workspaceRepo.On("GetMember", mock.Anything, f.workspaceID, f.userID).
+			Return(&domain.WorkspaceMember{WorkspaceID: f.workspaceID, UserID: f.userID, Role: role}, nil)
+		workspaceRepo.On("IsMember", mock.Anything, f.workspaceID, f.userID).Return(true, nil)
+	}
+	workspaceRepo.On("GetByID", mock.Anything, f.workspaceID).Return(&domain.Workspace{ID: f.workspaceID}, nil).Maybe()
+	workspaceRepo.On("Update", mock.Anything, f.workspaceID, mock.Anything).Return(nil).Maybe()
+	workspaceRepo.On("Delete", mock.Anything, f.workspaceID).Return(nil).Maybe()
+	workspaceRepo.On("AddMember", mock.Anything, mock.Anything).Return(nil).Maybe()
+	for id, memberRole := range map[uuid.UUID]string{f.adminID: domain.RoleAdmin, f.viewerID: domain.RoleViewer} {
+		workspaceRepo.On("GetMember", mock.Anything, f.workspaceID, id).
+			Return(&domain.WorkspaceMember{WorkspaceID: f.workspaceID, UserID: id, Role: memberRole}, nil).Maybe()
+	}
+	workspaceRepo.On("RemoveMember", mock.Anything, f.workspaceID, mock.Anything).Return(nil).Maybe()
+	workspaceRepo.On("GetMember", mock.Anything, f.workspaceID, mock.Anything).Return(nil, nil).Maybe()
+
+	conn := &domain.Connection{ID: f.connectionID, WorkspaceID: f.workspaceID, DatabaseType: domain.DatabaseTypePostgres}
+	connRepo := new(MockConnectionRepository)
+	connRepo.On("Create", mock.Anything, mock.Anything).Return(nil).Maybe()
+	connRepo.On("GetByIDAndWorkspace", mock.Anything, f.connectionID, f.workspaceID).Return(conn, nil).Maybe()
+	connRepo.On("ListByWorkspace", mock.Anything, f.workspaceID).Return([]domain.Connection{*conn}, nil).Maybe()
+	connRepo.On("Update", mock.Anything, f.connectionID, mock.Anything).Return(nil).Maybe()
+	connRepo.On("Delete", mock.Anything, f.connectionID).Return(nil).Maybe()
+
+	sessionRepo := new(MockSessionRepository)
+	sessionRepo.On("Get", mock.Anything, f.sessionID).
+		Return(&domain.ChatSession{ID: f.sessionID, WorkspaceID: f.workspaceID}, nil).Maybe()
+	sessionRepo.On("ListByWorkspace", mock.Anything, f.workspaceID, 20, 0).Return([]domain.ChatSessionSummary{}, 0, nil).Maybe()
+	sessionRepo.On("SoftDelete", mock.Anything, f.sessionID).Return(nil).Maybe()
+
+	messageRepo := new(MockMessageRepository)
+	messageRepo.On("ListBySession", mock.Anything, f.sessionID, 50).Return([]domain.Message{}, nil).Maybe()
+
+	encryptor, err := security.NewEncryptorFromSecret("authz-test-secret")
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+
+	f.workspaceService = NewWorkspaceService(workspaceRepo, 1000)
+	f.connectionService = NewConnectionService(connRepo, workspaceRepo, encryptor, mcp.NewRouter(), 100, 30)
+	f.queryService = &QueryService{
+		connectionService: f.connectionService,
+		messageRepo:       messageRepo,
+		sessionRepo:       sessionRepo,
+		workspaceRepo:     workspaceRepo,
+	}
+
+	return f
+}
+
+func TestAuthorizationMatrix(t *testing.T) {
+	roles := []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleViewer, ""}
+
+	tests := []struct {
+		name    string
+		allowed []string
+		call    func(ctx context.Context, f *authzFixture) error
+	}{
+		// ConnectionService
+		{
+			name:    "ConnectionService.Create",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, err := f.connectionService.Create(ctx, f.userID, f.workspaceID, domain.ConnectionCreate{
+					Name:         "db",
+					DatabaseType: domain.DatabaseTypePostgres,
+					Password:     "secret",
+					Validate:     new(bool),
+				})
+				return err
+			},
+		},
+		{
+			name:    "ConnectionService.GetByID",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleViewer},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, err := f.connectionService.GetByID(ctx, f.userID, f.workspaceID, f.connectionID)
+				return err
+			},
+		},
+		{
+			name:    "ConnectionService.ListByWorkspace",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleViewer},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, err := f.connectionService.ListByWorkspace(ctx, f.userID, f.workspaceID)
+				return err
+			},
+		},
+		{
+			name:    "ConnectionService.Update",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember},
+			call: func(ctx context.Context, f *authzFixture) error {
+				name := "renamed"
+				_, err := f.connectionService.Update(ctx, f.userID, f.workspaceID, f.connectionID, domain.ConnectionUpdate{Name: &name})
+				return err
+			},
+		},
+		{
+			name:    "ConnectionService.Delete",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.connectionService.Delete(ctx, f.userID, f.workspaceID, f.connectionID)
+			},
+		},
+
+		// WorkspaceService
+		{
+			name:    "WorkspaceService.GetByID",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleViewer},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, err := f.workspaceService.GetByID(ctx, f.userID, f.workspaceID)
+				return err
+			},
+		},
+		{
+			name:    "WorkspaceService.Update",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, err := f.workspaceService.Update(ctx, f.userID, f.workspaceID, domain.WorkspaceUpdate{
+					Settings: &domain.WorkspaceSettings{MaxRows: 10},
+				})
+				return err
+			},
+		},
+		{
+			name:    "WorkspaceService.Delete",
+			allowed: []string{domain.RoleOwner},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.workspaceService.Delete(ctx, f.userID, f.workspaceID)
+			},
+		},
+		{
+			name:    "WorkspaceService.AddMember",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.workspaceService.AddMember(ctx, f.userID, f.workspaceID, uuid.New(), domain.RoleViewer)
+			},
+		},
+		{
+			name:    "WorkspaceService.RemoveMember/admin",
+			allowed: []string{domain.RoleOwner},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.workspaceService.RemoveMember(ctx, f.userID, f.workspaceID, f.adminID)
+			},
+		},
+		{
+			name:    "WorkspaceService.RemoveMember/viewer",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.workspaceService.RemoveMember(ctx, f.userID, f.workspaceID, f.viewerID)
+			},
+		},
+
+		// QueryService
+		{
+			name:    "QueryService.ListSessions",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleViewer},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, _, err := f.queryService.ListSessions(ctx, f.userID, f.workspaceID, 20, 0)
+				return err
+			},
+		},
+		{
+			name:    "QueryService.GetSessionHistory",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember, domain.RoleViewer},
+			call: func(ctx context.Context, f *authzFixture) error {
+				_, err := f.queryService.GetSessionHistory(ctx, f.userID, f.workspaceID, f.sessionID)
+				return err
+			},
+		},
+		{
+			name:    "QueryService.DeleteSession",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.queryService.DeleteSession(ctx, f.userID, f.workspaceID, f.sessionID)
+			},
+		},
+		{
+			name:    "QueryService.FlushConnectionCache",
+			allowed: []string{domain.RoleOwner, domain.RoleAdmin, domain.RoleMember},
+			call: func(ctx context.Context, f *authzFixture) error {
+				return f.queryService.FlushConnectionCache(ctx, f.userID, f.workspaceID, f.connectionID)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for _, role := range roles {
+			roleName := role
+			if roleName == "" {
+				roleName = "non-member"
+			}
+
+			t.Run(tt.name+"/"+roleName, func(t *testing.T) {
+				f := newAuthzFixture(t, role)
+				err := tt.call(context.Background(), f)
+
+				allowed := false
+				for _, r := range tt.allowed {
+					if r == role {
+						allowed = true
+					}
+				}
+
+				if allowed {
+					assert.NoError(t, err)
+				} else {
+					assert.Error(t, err)
+				}
+			})
+		}
+	}
+}
+
+func TestWorkspaceService_AddMember_Roles(t *testing.T) {
+	tests := []struct {
+		role    string
+		wantErr bool
+	}{
+		{domain.RoleAdmin, false},
+		{domain.RoleMember, false},
+		{domain.RoleViewer, false},
+		{domain.RoleOwner, true},
+		{"superuser", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			f := newAuthzFixture(t, domain.RoleOwner)
+			err := f.workspaceService.AddMember(context.Background(), f.userID, f.workspaceID, uuid.New(), tt.role)
+			if tt.wantErr {
+				assert.EqualError(t, err, "invalid role")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// fakeWorkspaceCache records the workspaces whose cache was dropped
+type fakeWorkspaceCache struct {
+	invalidated []uuid.UUID
+}
+
+func (c *fakeWorkspaceCache) InvalidateByWorkspace(ctx context.Context, workspaceID uuid.UUID) (int64, error) {
+	c.invalidated = append(c.invalidated, workspaceID)
+	return 1, nil
+}
+
+func TestWorkspaceService_DeleteDropsCache(t *testing.T) {
+	cache := &fakeWorkspaceCache{}
+
+	f := newAuthzFixture(t, domain.RoleAdmin)
+	f.workspaceService.WithCache(cache)
+	assert.Error(t, f.workspaceService.Delete(context.Background(), f.userID, f.workspaceID))
+	assert.Empty(t, cache.invalidated, "a refused delete keeps the cache")
+
+	f = newAuthzFixture(t, domain.RoleOwner)
+	f.workspaceService.WithCache(cache)
+	assert.NoError(t, f.workspaceService.Delete(context.Background(), f.userID, f.workspaceID))
+	assert.Equal(t, []uuid.UUID{f.workspaceID}, cache.invalidated)
+}
+
+func TestWorkspaceService_MemberRoles(t *testing.T) {
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	ownerID, adminID, otherAdminID, memberID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+
+	newService := func() (*WorkspaceService, *MockWorkspaceRepository) {
+		repo := new(MockWorkspaceRepository)
+		for id, role := range map[uuid.UUID]string{
+			ownerID: domain.RoleOwner, adminID: domain.RoleAdmin, otherAdminID: domain.RoleAdmin, memberID: domain.RoleMember,
+		} {
+			repo.On("GetMember", mock.Anything, workspaceID, id).
+				Return(&domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: id, Role: role}, nil).Maybe()
+		}
+		repo.On("GetMember", mock.Anything, workspaceID, mock.Anything).Return(nil, nil).Maybe()
+		repo.On("UpdateMemberRole", mock.Anything, workspaceID, mock.Anything, mock.Anything).Return(nil).Maybe()
+		return NewWorkspaceService(repo, 1000), repo
+	}
+
+	t.Run("admin cannot demote the owner", func(t *testing.T) {
+		svc, repo := newService()
+		err := svc.UpdateMemberRole(ctx, adminID, workspaceID, ownerID, domain.RoleViewer)
+		assert.EqualError(t, err, "cannot change the owner's role")
+		repo.AssertNotCalled(t, "UpdateMemberRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("re-adding the owner does not change their role", func(t *testing.T) {
+		svc, repo := newService()
+		err := svc.AddMember(ctx, adminID, workspaceID, ownerID, domain.RoleViewer)
+		assert.EqualError(t, err, "user is already a member, change their role instead")
+		repo.AssertNotCalled(t, "AddMember", mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin cannot change another admin", func(t *testing.T) {
+		svc, _ := newService()
+		err := svc.UpdateMemberRole(ctx, adminID, workspaceID, otherAdminID, domain.RoleMember)
+		assert.EqualError(t, err, "cannot change the role of a member with the admin role")
+	})
+
+	t.Run("admin cannot grant admin", func(t *testing.T) {
+		svc, _ := newService()
+		err := svc.UpdateMemberRole(ctx, adminID, workspaceID, memberID, domain.RoleAdmin)
+		assert.EqualError(t, err, "cannot grant the admin role")
+		err = svc.AddMember(ctx, adminID, workspaceID, uuid.New(), domain.RoleAdmin)
+		assert.EqualError(t, err, "cannot grant the admin role")
+	})
+
+	t.Run("admin changes a member", func(t *testing.T) {
+		svc, repo := newService()
+		require.NoError(t, svc.UpdateMemberRole(ctx, adminID, workspaceID, memberID, domain.RoleViewer))
+		repo.AssertCalled(t, "UpdateMemberRole", mock.Anything, workspaceID, memberID, domain.RoleViewer)
+	})
+
+	t.Run("owner promotes a member", func(t *testing.T) {
+		svc, _ := newService()
+		assert.NoError(t, svc.UpdateMemberRole(ctx, ownerID, workspaceID, memberID, domain.RoleAdmin))
+	})
+}
@@ -1,13 +1,18 @@
 package service
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"time"
 
+	"github.com/Rrens/text-to-sql/internal/apperr"
 	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/mcp"
+	mcpSQLite "github.com/Rrens/text-to-sql/internal/mcp/sqlite"
+	"github.com/Rrens/text-to-sql/internal/observability"
 	"github.com/Rrens/text-to-sql/internal/security"
 	"github.com/google/uuid"
 )
@@ -20,6 +25,22 @@ type ConnectionService struct {
 	mcpRouter      *mcp.Router
 	defaultMaxRows int
 	defaultTimeout int
+	schemaWarmer   SchemaWarmer
+	alerts         *ConnectionAlerts
+	metrics        *observability.Metrics
+	sqliteRoot     string
+
+	schemaCache ConnectionCache
+}
+
+// ConnectionCache drops the cached schema of a deleted connection
+type ConnectionCache interface {
+	Invalidate(ctx context.Context, workspaceID, connectionID uuid.UUID) error
+}
+
+// SchemaWarmer loads the schema of a newly created connection in the background
+type SchemaWarmer interface {
+	WarmSchema(ctx context.Context, userID, workspaceID, connectionID uuid.UUID)
 }
 
 // NewConnectionService creates a new connection service
@@ -41,15 +62,73 @@ func NewConnectionService(
 	}
 }
 
-// Create creates a new database connection
+// WithSchemaWarmer fetches the schema of validated connections once they are created
+func (s *ConnectionService) WithSchemaWarmer(warmer SchemaWarmer) *ConnectionService {
+	s.schemaWarmer = warmer
+	return s
+}
+
+// WithConnectionAlerts reports degraded connections and counts health checks towards
+// their error rate
+func (s *ConnectionService) WithConnectionAlerts(alerts *ConnectionAlerts) *ConnectionService {
+	s.alerts = alerts
+	return s
+}
+
+// WithMetrics counts connections whose credentials cannot be decrypted
+func (s *ConnectionService) WithMetrics(metrics *observability.Metrics) *ConnectionService {
+	s.metrics = metrics
+	return s
+}
+
+// WithSQLiteRoot allows SQLite connections to database files inside root, the upload
+// directory; without it SQLite connections cannot be created
+func (s *ConnectionService) WithSQLiteRoot(root string) *ConnectionService {
+	s.sqliteRoot = root
+	return s
+}
+
+// WithSchemaCache drops the cached schema of connections when they are deleted
+func (s *ConnectionService) WithSchemaCache(cache ConnectionCache) *ConnectionService {
+	s.schemaCache = cache
+	return s
+}
+
+// checkSQLitePath rejects a SQLite database path outside the SQLite root
+func (s *ConnectionService) checkSQLitePath(dbType domain.DatabaseType, path string) error {
+	if dbType != domain.DatabaseTypeSQLite {
+		return nil
+	}
+	if _, err := mcpSQLite.ResolvePath(s.sqliteRoot, path); err != nil {
+		return apperr.Wrap(apperr.Validation, err)
+	}
+	return nil
+}
+
+// Create creates a new database connection. Unless input opts out, the database must
+// be reachable first; a connection that fails is not saved and its error is returned.
 func (s *ConnectionService) Create(ctx context.Context, userID, workspaceID uuid.UUID, input domain.ConnectionCreate) (*domain.ConnectionInfo, error) {
-	// Check workspace access
-	isMember, err := s.workspaceRepo.IsMember(ctx, workspaceID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check membership: %w", err)
+	// Check workspace access (viewers cannot manage connections)
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
 	}
-	if !isMember {
-		return nil, errors.New("access denied")
+
+	if err := s.checkSQLitePath(input.DatabaseType, input.Database); err != nil {
+		return nil, err
+	}
+
+	tableCount := -1
+	if input.ShouldValidate() {
+		n, err := s.probe(ctx, input)
+		if err != nil {
+			return nil, &apperr.Error{
+				Kind:    apperr.Validation,
+				Message: err.Error(),
+				Details: map[string]any{"connected": false},
+				Err:     err,
+			}
+		}
+		tableCount = n
 	}
 
 	// Encrypt password
@@ -72,24 +151,40 @@ func (s *ConnectionService) Create(ctx context.Context, userID, workspaceID uuid
 	if sslMode == "" {
 		sslMode = "disable"
 	}
+	schemaOrder := input.SchemaOrder
+	if schemaOrder == "" {
+		schemaOrder = string(mcp.SchemaOrderSize)
+	}
+	replicaUse := input.ReplicaUse
+	if replicaUse == "" {
+		replicaUse = domain.ReplicaUseQueries
+	}
 
 	now := time.Now()
 	conn := &domain.Connection{
-		ID:                   uuid.New(),
-		WorkspaceID:          workspaceID,
-		Name:                 input.Name,
-		DatabaseType:         input.DatabaseType,
-		Host:                 input.Host,
-		Port:                 input.Port,
-		Database:             input.Database,
-		Username:             input.Username,
-		CredentialsEncrypted: encryptedCreds,
-		SSLMode:              sslMode,
-		ReadOnly:             input.ReadOnly,
-		MaxRows:              maxRows,
-		TimeoutSeconds:       timeout,
-		CreatedAt:            now,
-		UpdatedAt:            now,
+		ID:                    uuid.New(),
+		WorkspaceID:           workspaceID,
+		Name:                  input.Name,
+		DatabaseType:          input.DatabaseType,
+		Host:                  input.Host,
+		Port:                  input.Port,
+		Database:              input.Database,
+		Username:              input.Username,
+		CredentialsEncrypted:  encryptedCreds,
+		SSLMode:               sslMode,
+		ReadOnly:              input.ReadOnly,
+		MaxRows:               maxRows,
+		TimeoutSeconds:        timeout,
+		SchemaCacheTTLSeconds: input.SchemaCacheTTLSeconds,
+		MaxEstimatedRows:      input.MaxEstimatedRows,
+		ErrorRateThreshold:    input.ErrorRateThreshold,
+		DefaultLimit:          input.DefaultLimit,
+		SchemaOrder:           schemaOrder,
+		ReplicaHost:           input.ReplicaHost,
+		ReplicaPort:           input.ReplicaPort,
+		ReplicaUse:            replicaUse,
+		CreatedAt:             now,
+		UpdatedAt:             now,
 	}
 
 	if err := s.connectionRepo.Create(ctx, conn); err != nil {
@@ -97,6 +192,13 @@ func (s *ConnectionService) Create(ctx context.Context, userID, workspaceID uuid
 	}
 
 	info := conn.ToInfo()
+	if tableCount >= 0 {
+		info.Validated = true
+		info.TableCount = &tableCount
+		if s.schemaWarmer != nil {
+			s.schemaWarmer.WarmSchema(ctx, userID, workspaceID, conn.ID)
+		}
+	}
 	return &info, nil
 }
 
@@ -108,7 +210,7 @@ func (s *ConnectionService) GetByID(ctx context.Context, userID, workspaceID, co
 		return nil, fmt.Errorf("failed to check membership: %w", err)
 	}
 	if !isMember {
-		return nil, errors.New("access denied")
+		return nil, apperr.New(apperr.Forbidden, "access denied")
 	}
 
 	conn, err := s.connectionRepo.GetByIDAndWorkspace(ctx, connectionID, workspaceID)
@@ -116,11 +218,12 @@ func (s *ConnectionService) GetByID(ctx context.Context, userID, workspaceID, co
 		return nil, fmt.Errorf("failed to get connection: %w", err)
 	}
 	if conn == nil {
-		return nil, errors.New("connection not found")
+		return nil, apperr.New(apperr.NotFound, "connection not found")
 	}
 
-	info := conn.ToInfo()
-	return &info, nil
+	infos := []domain.ConnectionInfo{conn.ToInfo()}
+	s.markDegraded(ctx, infos)
+	return &infos[0], nil
 }
 
 // GetFullConnection retrieves a connection with decrypted credentials
@@ -131,7 +234,7 @@ func (s *ConnectionService) GetFullConnection(ctx context.Context, userID, works
 		return nil, "", fmt.Errorf("failed to check membership: %w", err)
 	}
 	if !isMember {
-		return nil, "", errors.New("access denied")
+		return nil, "", apperr.New(apperr.Forbidden, "access denied")
 	}
 
 	conn, err := s.connectionRepo.GetByIDAndWorkspace(ctx, connectionID, workspaceID)
@@ -139,18 +242,63 @@ func (s *ConnectionService) GetFullConnection(ctx context.Context, userID, works
 		return nil, "", fmt.Errorf("failed to get connection: %w", err)
 	}
 	if conn == nil {
-		return nil, "", errors.New("connection not found")
+		return nil, "", apperr.New(apperr.NotFound, "connection not found")
 	}
 
-	// Decrypt credentials
+	// Decrypt credentials. Credentials encrypted with another key are reported apart
+	// so the user can be asked to enter the password again.
 	var credentials map[string]string
 	if err := s.encryptor.DecryptJSON(conn.CredentialsEncrypted, &credentials); err != nil {
+		if errors.Is(err, security.ErrUndecryptable) {
+			s.metrics.ObserveDecryptFailure("connection_credentials")
+			return nil, "", &apperr.Error{
+				Kind:    apperr.CredentialsUnreadable,
+				Message: "connection credentials cannot be read, re-enter the password of this connection",
+				Details: map[string]any{"connection_id": connectionID},
+				Err:     err,
+			}
+		}
 		return nil, "", fmt.Errorf("failed to decrypt credentials: %w", err)
 	}
 
 	return conn, credentials["password"], nil
 }
 
+// Health checks that a saved connection's database answers, opening its pooled
+// adapter if needed, and reports the adapter's connection pool. An unreachable
+// database is reported in the result rather than as an error.
+func (s *ConnectionService) Health(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) (*domain.ConnectionHealth, error) {
+	conn, password, err := s.GetFullConnection(ctx, userID, workspaceID, connectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &domain.ConnectionHealth{ConnectionID: conn.ID}
+	start := time.Now()
+	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), adapterConfig(conn, password))
+	if err == nil {
+		err = adapter.HealthCheck(ctx)
+	}
+	health.LatencyMs = time.Since(start).Milliseconds()
+	s.alerts.Record(ctx, conn, err)
+	if since, ok := s.alerts.DegradedSince(ctx, []uuid.UUID{conn.ID})[conn.ID]; ok {
+		health.Degraded = true
+		health.DegradedSince = &since
+	}
+	if err != nil {
+		health.Error = err.Error()
+		return health, nil
+	}
+
+	health.Healthy = true
+	if statter, ok := adapter.(mcp.PoolStatter); ok {
+		if stats, ok := statter.PoolStats(); ok {
+			health.Pool = &stats
+		}
+	}
+	return health, nil
+}
+
 // ListByWorkspace retrieves all connections for a workspace
 func (s *ConnectionService) ListByWorkspace(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.ConnectionInfo, error) {
 	// Check workspace access
@@ -159,7 +307,7 @@ func (s *ConnectionService) ListByWorkspace(ctx context.Context, userID, workspa
 		return nil, fmt.Errorf("failed to check membership: %w", err)
 	}
 	if !isMember {
-		return nil, errors.New("access denied")
+		return nil, apperr.New(apperr.Forbidden, "access denied")
 	}
 
 	connections, err := s.connectionRepo.ListByWorkspace(ctx, workspaceID)
@@ -171,28 +319,43 @@ func (s *ConnectionService) ListByWorkspace(ctx context.Context, userID, workspa
 	for i, conn := range connections {
 		infos[i] = conn.ToInfo()
 	}
+	s.markDegraded(ctx, infos)
 
 	return infos, nil
 }
 
+// markDegraded sets the degraded flag of the connections in infos
+func (s *ConnectionService) markDegraded(ctx context.Context, infos []domain.ConnectionInfo) {
+	if s.alerts == nil || len(infos) == 0 {
+		return
+	}
+	ids := make([]uuid.UUID, len(infos))
+	for i := range infos {
+		ids[i] = infos[i].ID
+	}
+	degraded := s.alerts.DegradedSince(ctx, ids)
+	for i := range infos {
+		if since, ok := degraded[infos[i].ID]; ok {
+			infos[i].Degraded = true
+			infos[i].DegradedSince = &since
+		}
+	}
+}
+
 // Update updates a connection
 func (s *ConnectionService) Update(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, input domain.ConnectionUpdate) (*domain.ConnectionInfo, error) {
+	// Check workspace access (viewers cannot manage connections)
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+
 	// Get existing connection
 	conn, err := s.connectionRepo.GetByIDAndWorkspace(ctx, connectionID, workspaceID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get connection: %w", err)
 	}
 	if conn == nil {
-		return nil, errors.New("connection not found")
-	}
-
-	// Check workspace access
-	isMember, err := s.workspaceRepo.IsMember(ctx, workspaceID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check membership: %w", err)
-	}
-	if !isMember {
-		return nil, errors.New("access denied")
+		return nil, apperr.New(apperr.NotFound, "connection not found")
 	}
 
 	// Apply updates
@@ -206,6 +369,9 @@ func (s *ConnectionService) Update(ctx context.Context, userID, workspaceID, con
 		conn.Port = *input.Port
 	}
 	if input.Database != nil {
+		if err := s.checkSQLitePath(conn.DatabaseType, *input.Database); err != nil {
+			return nil, err
+		}
 		conn.Database = *input.Database
 	}
 	if input.Username != nil {
@@ -231,24 +397,94 @@ func (s *ConnectionService) Update(ctx context.Context, userID, workspaceID, con
 	if input.TimeoutSeconds != nil {
 		conn.TimeoutSeconds = *input.TimeoutSeconds
 	}
+	if input.SchemaCacheTTLSeconds.Set {
+		ttl := input.SchemaCacheTTLSeconds.Value
+		if ttl != nil && (*ttl < 0 || *ttl > domain.MaxSchemaCacheTTLSeconds) {
+			return nil, apperr.Newf(apperr.Validation, "schema_cache_ttl_seconds must be between 0 and %d", domain.MaxSchemaCacheTTLSeconds)
+		}
+		conn.SchemaCacheTTLSeconds = ttl
+	}
+	if input.MaxEstimatedRows != nil {
+		conn.MaxEstimatedRows = input.MaxEstimatedRows
+	}
+	if input.ErrorRateThreshold != nil {
+		conn.ErrorRateThreshold = input.ErrorRateThreshold
+	}
+	if input.DefaultLimit != nil {
+		conn.DefaultLimit = input.DefaultLimit
+	}
+	if input.SchemaOrder != nil {
+		conn.SchemaOrder = *input.SchemaOrder
+	}
+	if input.ReplicaHost != nil {
+		conn.ReplicaHost = *input.ReplicaHost
+	}
+	if input.ReplicaPort != nil {
+		conn.ReplicaPort = *input.ReplicaPort
+	}
+	if input.ReplicaUse != nil {
+		conn.ReplicaUse = *input.ReplicaUse
+	}
 
 	if err := s.connectionRepo.Update(ctx, connectionID, conn); err != nil {
 		return nil, fmt.Errorf("failed to update connection: %w", err)
 	}
 
-	info := conn.ToInfo()
-	return &info, nil
+	// A pooled adapter still routes statements the old way
+	replicaChanged := input.ReplicaHost != nil || input.ReplicaPort != nil || input.ReplicaUse != nil
+	if replicaChanged && s.mcpRouter != nil {
+		if err := s.mcpRouter.CloseConnection(connectionID); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to close pooled connection")
+		}
+	}
+
+	infos := []domain.ConnectionInfo{conn.ToInfo()}
+	s.markDegraded(ctx, infos)
+	return &infos[0], nil
 }
 
-// Delete deletes a connection
-func (s *ConnectionService) Delete(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) error {
-	// Check workspace access
-	isMember, err := s.workspaceRepo.IsMember(ctx, workspaceID, userID)
+// UpdateCredentials replaces the password of a connection, encrypting it with the
+// current key and leaving the other fields as they are. It recovers connections
+// whose credentials were encrypted with a key that is no longer configured.
+func (s *ConnectionService) UpdateCredentials(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, input domain.ConnectionCredentialsUpdate) (*domain.ConnectionInfo, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connectionRepo.GetByIDAndWorkspace(ctx, connectionID, workspaceID)
 	if err != nil {
-		return fmt.Errorf("failed to check membership: %w", err)
+		return nil, fmt.Errorf("failed to get connection: %w", err)
 	}
-	if !isMember {
-		return errors.New("access denied")
+	if conn == nil {
+		return nil, apperr.New(apperr.NotFound, "connection not found")
+	}
+
+	encryptedCreds, err := s.encryptor.EncryptJSON(map[string]string{"password": input.Password})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	conn.CredentialsEncrypted = encryptedCreds
+	if err := s.connectionRepo.Update(ctx, connectionID, conn); err != nil {
+		return nil, fmt.Errorf("failed to update connection: %w", err)
+	}
+
+	// A pooled adapter still holds the old password
+	if s.mcpRouter != nil {
+		if err := s.mcpRouter.CloseConnection(connectionID); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to close pooled connection")
+		}
+	}
+
+	infos := []domain.ConnectionInfo{conn.ToInfo()}
+	s.markDegraded(ctx, infos)
+	return &infos[0], nil
+}
+
+// Delete deletes a connection
+func (s *ConnectionService) Delete(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) error {
+	// Check workspace access (viewers cannot manage connections)
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return err
 	}
 
 	// Verify connection exists in workspace
@@ -257,14 +493,74 @@ func (s *ConnectionService) Delete(ctx context.Context, userID, workspaceID, con
 		return fmt.Errorf("failed to get connection: %w", err)
 	}
 	if conn == nil {
-		return errors.New("connection not found")
+		return apperr.New(apperr.NotFound, "connection not found")
+	}
+
+	if err := s.connectionRepo.Delete(ctx, connectionID); err != nil {
+		return err
 	}
 
-	return s.connectionRepo.Delete(ctx, connectionID)
+	// A pooled adapter keeps the database open after the connection is gone
+	if s.mcpRouter != nil {
+		if err := s.mcpRouter.CloseConnection(connectionID); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to close pooled connection")
+		}
+	}
+	if s.schemaCache != nil {
+		if err := s.schemaCache.Invalidate(ctx, workspaceID, connectionID); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to invalidate schema cache")
+		}
+	}
+	return nil
+}
+
+// TestConnection tests a database connection using real adapter, and its read replica
+// apart. The error is the primary's; the replica's is only reported in the result,
+// since queries fall back to the primary while the replica is down.
+func (s *ConnectionService) TestConnection(ctx context.Context, input domain.ConnectionCreate) (*domain.ConnectionTest, error) {
+	result := &domain.ConnectionTest{}
+	var err error
+	result.Primary, err = s.testEndpoint(ctx, input)
+	if input.ReplicaHost != "" {
+		replica := input
+		replica.Host, replica.Port = input.ReplicaHost, cmp.Or(input.ReplicaPort, input.Port)
+		replica.ReplicaHost = ""
+		test, _ := s.testEndpoint(ctx, replica)
+		result.Replica = &test
+	}
+	return result, err
+}
+
+// testEndpoint probes one endpoint of a connection
+func (s *ConnectionService) testEndpoint(ctx context.Context, input domain.ConnectionCreate) (domain.EndpointTest, error) {
+	start := time.Now()
+	_, err := s.probe(ctx, input)
+	test := domain.EndpointTest{Connected: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		test.Error = err.Error()
+	}
+	return test, err
 }
 
-// TestConnection tests a database connection using real adapter
-func (s *ConnectionService) TestConnection(ctx context.Context, input domain.ConnectionCreate) error {
+// adapterConfig returns the adapter config of a saved connection
+func adapterConfig(conn *domain.Connection, password string) mcp.ConnectionConfig {
+	return mcp.ConnectionConfig{
+		Host:             conn.Host,
+		Port:             conn.Port,
+		Database:         conn.Database,
+		Username:         conn.Username,
+		Password:         password,
+		SSLMode:          conn.SSLMode,
+		MaxRows:          conn.MaxRows,
+		TimeoutSeconds:   conn.TimeoutSeconds,
+		ReplicaHost:      conn.ReplicaHost,
+		ReplicaPort:      conn.ReplicaPort,
+		ReplicaForSchema: conn.ReplicaUse == domain.ReplicaUseSchema,
+	}
+}
+
+// probe connects to the database of input on a throwaway adapter and counts its tables
+func (s *ConnectionService) probe(ctx context.Context, input domain.ConnectionCreate) (int, error) {
 	mcpConfig := mcp.ConnectionConfig{
 		Host:           input.Host,
 		Port:           input.Port,
@@ -280,25 +576,23 @@ func (s *ConnectionService) TestConnection(ctx context.Context, input domain.Con
 		mcpConfig.TimeoutSeconds = input.TimeoutSeconds
 	}
 
-	// Use random ID to avoid pooling conflicts, and ensure cleanup
+	// A random ID keeps the adapter apart from pooled ones; it is closed and dropped
+	// from the pool once the probe is done
 	tempConnID := uuid.New()
 
 	adapter, err := s.mcpRouter.GetAdapter(ctx, tempConnID, string(input.DatabaseType), mcpConfig)
 	if err != nil {
-		return fmt.Errorf("connection failed: %w", err)
+		return 0, fmt.Errorf("connection failed: %w", err)
 	}
+	defer func() {
+		if err := s.mcpRouter.CloseConnection(tempConnID); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to close test connection")
+		}
+	}()
 
-	// Close connection immediately as this is just a test
-	if err := adapter.Close(); err != nil {
-		// Log error but don't fail the test if close fails
-		fmt.Printf("failed to close test connection: %v\n", err)
+	tables, err := adapter.ListTables(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("connection failed: %w", err)
 	}
-
-	// Also remove from router pool to prevent leak (since we used GetAdapter which pools it)
-	// Accessing pool directly is not possible if private.
-	// But since we use unique ID, it will just stay in pool until evicted or app restart.
-	// Ideally Router should have TestConnection or CreateEphemeralAdapter.
-	// For now this is acceptable as test connection volume is low.
-
-	return nil
+	return len(tables), nil
 }
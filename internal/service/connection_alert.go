@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+// ConnectionErrorStore keeps the outcomes of each connection's recent queries and
+// whether the connection is flagged degraded
+type ConnectionErrorStore interface {
+	// Record adds a query outcome at now and returns the counts of the last window
+	// outcomes younger than maxAge
+	Record(ctx context.Context, connectionID uuid.UUID, failed bool, now time.Time, window int, maxAge time.Duration) (domain.ConnectionErrorRate, error)
+	// MarkDegraded flags the connection unless it already is, reporting whether it
+	// was flagged by this call. The flag expires after ttl, renewed by each call.
+	MarkDegraded(ctx context.Context, connectionID uuid.UUID, since time.Time, ttl time.Duration) (bool, error)
+	// ClearDegraded removes the flag, reporting whether it was set
+	ClearDegraded(ctx context.Context, connectionID uuid.UUID) (bool, error)
+	// DegradedSince returns when each degraded connection among connectionIDs was flagged
+	DegradedSince(ctx context.Context, connectionIDs []uuid.UUID) (map[uuid.UUID]time.Time, error)
+}
+
+// ConnectionAlertSettings decide when a connection counts as degraded
+type ConnectionAlertSettings struct {
+	ErrorRate  float64       // share of failed queries that flags a connection; 0 disables alerts
+	Window     int           // recent queries considered
+	MinQueries int           // queries needed in the window before the rate is judged
+	MaxAge     time.Duration // outcomes older than this are forgotten
+}
+
+// ConnectionAlerts flags connections whose recent queries mostly fail, such as after
+// their credentials were rotated, and notifies webhooks when a connection becomes
+// degraded and when it recovers. A degraded connection recovers once its error rate
+// falls to half the threshold, so a rate hovering around it does not flap.
+type ConnectionAlerts struct {
+	store    ConnectionErrorStore
+	settings ConnectionAlertSettings
+	webhooks WebhookEmitter
+	now      func() time.Time
+}
+
+// NewConnectionAlerts creates a new connection alert tracker
+func NewConnectionAlerts(store ConnectionErrorStore, settings ConnectionAlertSettings) *ConnectionAlerts {
+	if settings.Window <= 0 {
+		settings.Window = 20
+	}
+	if settings.MinQueries <= 0 || settings.MinQueries > settings.Window {
+		settings.MinQueries = min(5, settings.Window)
+	}
+	if settings.MaxAge <= 0 {
+		settings.MaxAge = time.Hour
+	}
+	return &ConnectionAlerts{store: store, settings: settings, now: time.Now}
+}
+
+// WithWebhooks notifies webhooks when connections become degraded or recover
+func (a *ConnectionAlerts) WithWebhooks(webhooks WebhookEmitter) *ConnectionAlerts {
+	a.webhooks = webhooks
+	return a
+}
+
+// threshold returns the error rate that flags conn, 0 when alerts are off for it
+func (a *ConnectionAlerts) threshold(conn *domain.Connection) float64 {
+	if conn.ErrorRateThreshold != nil {
+		return *conn.ErrorRateThreshold
+	}
+	return a.settings.ErrorRate
+}
+
+// Record counts a query outcome on conn. cause is the error of a failed query. Store
+// errors are logged: alerting never fails a query.
+func (a *ConnectionAlerts) Record(ctx context.Context, conn *domain.Connection, cause error) {
+	if a == nil {
+		return
+	}
+	threshold := a.threshold(conn)
+	if threshold <= 0 {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	log := logging.FromContext(ctx)
+
+	now := a.now()
+	rate, err := a.store.Record(ctx, conn.ID, cause != nil, now, a.settings.Window, a.settings.MaxAge)
+	if err != nil {
+		log.Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to record connection outcome")
+		return
+	}
+	if rate.Queries < a.settings.MinQueries {
+		return
+	}
+
+	switch {
+	case rate.Rate() >= threshold:
+		flagged, err := a.store.MarkDegraded(ctx, conn.ID, now, a.settings.MaxAge)
+		if err != nil {
+			log.Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to flag connection degraded")
+			return
+		}
+		if !flagged {
+			return
+		}
+		log.Warn().Ctx(ctx).
+			Str("connection_id", conn.ID.String()).
+			Int("queries", rate.Queries).
+			Int("errors", rate.Errors).
+			Msg("connection degraded")
+		data := connectionAlertData(conn, rate, threshold)
+		if cause != nil {
+			data["last_error"] = cause.Error()
+		}
+		a.emit(ctx, conn.WorkspaceID, domain.WebhookEventConnectionDegraded, data)
+	case rate.Rate() <= threshold/2:
+		cleared, err := a.store.ClearDegraded(ctx, conn.ID)
+		if err != nil {
+			log.Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to clear connection degraded flag")
+			return
+		}
+		if !cleared {
+			return
+		}
+		log.Info().Ctx(ctx).Str("connection_id", conn.ID.String()).Msg("connection recovered")
+		a.emit(ctx, conn.WorkspaceID, domain.WebhookEventConnectionRecovered, connectionAlertData(conn, rate, threshold))
+	}
+}
+
+// DegradedSince returns when each degraded connection among connectionIDs was
+// flagged. When the store cannot be read no connection is reported degraded.
+func (a *ConnectionAlerts) DegradedSince(ctx context.Context, connectionIDs []uuid.UUID) map[uuid.UUID]time.Time {
+	if a == nil {
+		return nil
+	}
+	degraded, err := a.store.DegradedSince(ctx, connectionIDs)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to get degraded connections")
+		return nil
+	}
+	return degraded
+}
+
+func (a *ConnectionAlerts) emit(ctx context.Context, workspaceID uuid.UUID, event string, data map[string]any) {
+	if a.webhooks != nil {
+		a.webhooks.Emit(ctx, workspaceID, event, data)
+	}
+}
+
+func connectionAlertData(conn *domain.Connection, rate domain.ConnectionErrorRate, threshold float64) map[string]any {
+	return map[string]any{
+		"connection_id":   conn.ID,
+		"connection_name": conn.Name,
+		"database_type":   conn.DatabaseType,
+		"queries":         rate.Queries,
+		"errors":          rate.Errors,
+		"error_rate":      rate.Rate(),
+		"threshold":       threshold,
+	}
+}
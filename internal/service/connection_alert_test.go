@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryConnectionErrorStore keeps connection outcomes in memory, like the Redis store
+type memoryConnectionErrorStore struct {
+	outcomes map[uuid.UUID][]connectionOutcome
+	degraded map[uuid.UUID]time.Time
+}
+
+type connectionOutcome struct {
+	at     time.Time
+	failed bool
+}
+
+func newMemoryConnectionErrorStore() *memoryConnectionErrorStore {
+	return &memoryConnectionErrorStore{
+		outcomes: map[uuid.UUID][]connectionOutcome{},
+		degraded: map[uuid.UUID]time.Time{},
+	}
+}
+
+func (s *memoryConnectionErrorStore) Record(_ context.Context, connectionID uuid.UUID, failed bool, now time.Time, window int, maxAge time.Duration) (domain.ConnectionErrorRate, error) {
+	kept := []connectionOutcome{}
+	for _, o := range append(s.outcomes[connectionID], connectionOutcome{at: now, failed: failed}) {
+		if !o.at.Before(now.Add(-maxAge)) {
+			kept = append(kept, o)
+		}
+	}
+	if len(kept) > window {
+		kept = kept[len(kept)-window:]
+	}
+	s.outcomes[connectionID] = kept
+
+	rate := domain.ConnectionErrorRate{Queries: len(kept)}
+	for _, o := range kept {
+		if o.failed {
+			rate.Errors++
+		}
+	}
+	return rate, nil
+}
+
+func (s *memoryConnectionErrorStore) MarkDegraded(_ context.Context, connectionID uuid.UUID, since time.Time, _ time.Duration) (bool, error) {
+	if _, ok := s.degraded[connectionID]; ok {
+		return false, nil
+	}
+	s.degraded[connectionID] = since
+	return true, nil
+}
+
+func (s *memoryConnectionErrorStore) ClearDegraded(_ context.Context, connectionID uuid.UUID) (bool, error) {
+	_, ok := s.degraded[connectionID]
+	delete(s.degraded, connectionID)
+	return ok, nil
+}
+
+func (s *memoryConnectionErrorStore) DegradedSince(_ context.Context, connectionIDs []uuid.UUID) (map[uuid.UUID]time.Time, error) {
+	degraded := map[uuid.UUID]time.Time{}
+	for _, id := range connectionIDs {
+		if since, ok := s.degraded[id]; ok {
+			degraded[id] = since
+		}
+	}
+	return degraded, nil
+}
+
+// recordingEmitter keeps the webhook events emitted
+type recordingEmitter struct {
+	events []string
+	data   []map[string]any
+}
+
+func (e *recordingEmitter) Emit(_ context.Context, _ uuid.UUID, event string, data any) {
+	e.events = append(e.events, event)
+	e.data = append(e.data, data.(map[string]any))
+}
+
+func TestConnectionAlerts_Record(t *testing.T) {
+	ctx := context.Background()
+	errAuth := errors.New("password authentication failed")
+
+	setup := func() (*ConnectionAlerts, *recordingEmitter, *time.Time) {
+		clock := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		emitter := &recordingEmitter{}
+		alerts := NewConnectionAlerts(newMemoryConnectionErrorStore(), ConnectionAlertSettings{
+			ErrorRate:  0.5,
+			Window:     10,
+			MinQueries: 4,
+			MaxAge:     time.Hour,
+		}).WithWebhooks(emitter)
+		alerts.now = func() time.Time { return clock }
+		return alerts, emitter, &clock
+	}
+	conn := &domain.Connection{ID: uuid.New(), WorkspaceID: uuid.New(), Name: "warehouse", DatabaseType: domain.DatabaseTypePostgres}
+	degradedSince := func(alerts *ConnectionAlerts) (time.Time, bool) {
+		since, ok := alerts.DegradedSince(ctx, []uuid.UUID{conn.ID})[conn.ID]
+		return since, ok
+	}
+
+	t.Run("failure burst then recovery", func(t *testing.T) {
+		alerts, emitter, clock := setup()
+
+		for range 3 {
+			alerts.Record(ctx, conn, nil)
+			*clock = clock.Add(time.Second)
+		}
+		for range 2 {
+			alerts.Record(ctx, conn, errAuth)
+			*clock = clock.Add(time.Second)
+		}
+		assert.Empty(t, emitter.events, "2 of 5 queries failed")
+
+		alerts.Record(ctx, conn, errAuth)
+		require.Equal(t, []string{domain.WebhookEventConnectionDegraded}, emitter.events)
+		assert.Equal(t, 3, emitter.data[0]["errors"])
+		assert.Equal(t, errAuth.Error(), emitter.data[0]["last_error"])
+		since, ok := degradedSince(alerts)
+		require.True(t, ok)
+		assert.Equal(t, *clock, since)
+
+		for range 3 {
+			*clock = clock.Add(time.Second)
+			alerts.Record(ctx, conn, errAuth)
+		}
+		assert.Len(t, emitter.events, 1, "a degraded connection is reported once")
+
+		// 6 failures in the window: the rate must fall to 25% to recover
+		for range 4 {
+			*clock = clock.Add(time.Second)
+			alerts.Record(ctx, conn, nil)
+		}
+		assert.Len(t, emitter.events, 1, "still failing 6 of 10")
+		_, ok = degradedSince(alerts)
+		assert.True(t, ok)
+
+		for range 4 {
+			*clock = clock.Add(time.Second)
+			alerts.Record(ctx, conn, nil)
+		}
+		assert.Equal(t, []string{domain.WebhookEventConnectionDegraded, domain.WebhookEventConnectionRecovered}, emitter.events)
+		_, ok = degradedSince(alerts)
+		assert.False(t, ok)
+	})
+
+	t.Run("too few queries", func(t *testing.T) {
+		alerts, emitter, clock := setup()
+
+		for range 3 {
+			alerts.Record(ctx, conn, errAuth)
+			*clock = clock.Add(time.Second)
+		}
+		assert.Empty(t, emitter.events)
+	})
+
+	t.Run("old failures are forgotten", func(t *testing.T) {
+		alerts, emitter, clock := setup()
+
+		for range 3 {
+			alerts.Record(ctx, conn, errAuth)
+			*clock = clock.Add(time.Minute)
+		}
+		*clock = clock.Add(2 * time.Hour)
+		alerts.Record(ctx, conn, errAuth)
+		assert.Empty(t, emitter.events, "only one failure in the last hour")
+	})
+
+	t.Run("disabled for the connection", func(t *testing.T) {
+		alerts, emitter, _ := setup()
+		disabled := 0.0
+		quiet := *conn
+		quiet.ErrorRateThreshold = &disabled
+
+		for range 10 {
+			alerts.Record(ctx, &quiet, errAuth)
+		}
+		assert.Empty(t, emitter.events)
+	})
+
+	t.Run("stricter threshold for the connection", func(t *testing.T) {
+		alerts, emitter, _ := setup()
+		strict := 0.2
+		critical := *conn
+		critical.ErrorRateThreshold = &strict
+
+		for range 4 {
+			alerts.Record(ctx, &critical, nil)
+		}
+		alerts.Record(ctx, &critical, errAuth)
+		assert.Equal(t, []string{domain.WebhookEventConnectionDegraded}, emitter.events)
+		assert.Equal(t, strict, emitter.data[0]["threshold"])
+	})
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingWarmer records the connections it is asked to warm
+type recordingWarmer struct {
+	connections []uuid.UUID
+}
+
+func (w *recordingWarmer) WarmSchema(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) {
+	w.connections = append(w.connections, connectionID)
+}
+
+// recordingCache records the connections whose cached schema is invalidated
+type recordingCache struct {
+	connections []uuid.UUID
+}
+
+func (c *recordingCache) Invalidate(ctx context.Context, workspaceID, connectionID uuid.UUID) error {
+	c.connections = append(c.connections, connectionID)
+	return nil
+}
+
+func TestConnectionService_Delete(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	conn := &domain.Connection{ID: uuid.New(), WorkspaceID: uuid.New()}
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetMember", ctx, conn.WorkspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleMember}, nil)
+	connectionRepo := new(MockConnectionRepository)
+	connectionRepo.On("GetByIDAndWorkspace", ctx, conn.ID, conn.WorkspaceID).Return(conn, nil)
+	connectionRepo.On("Delete", ctx, conn.ID).Return(nil)
+
+	cache := &recordingCache{}
+	svc := NewConnectionService(connectionRepo, workspaceRepo, nil, mcp.NewRouter(), 0, 0).WithSchemaCache(cache)
+	require.NoError(t, svc.Delete(ctx, userID, conn.WorkspaceID, conn.ID))
+	assert.Equal(t, []uuid.UUID{conn.ID}, cache.connections)
+	connectionRepo.AssertExpectations(t)
+}
+
+func TestConnectionService_UpdateSchemaCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	userID := uuid.New()
+	ttl := 60
+	conn := &domain.Connection{ID: uuid.New(), WorkspaceID: uuid.New(), SchemaCacheTTLSeconds: &ttl}
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetMember", ctx, conn.WorkspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleMember}, nil)
+	connectionRepo := new(MockConnectionRepository)
+	connectionRepo.On("GetByIDAndWorkspace", ctx, conn.ID, conn.WorkspaceID).Return(conn, nil)
+	connectionRepo.On("Update", ctx, conn.ID, conn).Return(nil)
+	svc := NewConnectionService(connectionRepo, workspaceRepo, nil, nil, 0, 0)
+
+	update := func(body string) error {
+		var input domain.ConnectionUpdate
+		require.NoError(t, json.Unmarshal([]byte(body), &input))
+		_, err := svc.Update(ctx, userID, conn.WorkspaceID, conn.ID, input)
+		return err
+	}
+
+	require.NoError(t, update(`{"name": "warehouse"}`))
+	assert.Equal(t, &ttl, conn.SchemaCacheTTLSeconds, "left out keeps the override")
+	assert.Equal(t, apperr.Validation, apperr.KindOf(update(`{"schema_cache_ttl_seconds": 700000}`)))
+	require.NoError(t, update(`{"schema_cache_ttl_seconds": 0}`))
+	assert.Equal(t, 0, *conn.SchemaCacheTTLSeconds)
+	require.NoError(t, update(`{"schema_cache_ttl_seconds": null}`))
+	assert.Nil(t, conn.SchemaCacheTTLSeconds, "null restores the server default")
+}
+
+func TestConnectionService_CreateValidates(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+	input := domain.ConnectionCreate{
+		Name:         "warehouse",
+		DatabaseType: domain.DatabaseTypePostgres,
+		Host:         "db",
+		Port:         5432,
+		Database:     "analytics",
+		Username:     "reader",
+		Password:     "secret",
+	}
+
+	setup := func(t *testing.T, connectErr error) (*ConnectionService, *MockConnectionRepository, *MockMCPAdapter, *mcp.Router, *recordingWarmer) {
+		workspaceRepo := new(MockWorkspaceRepository)
+		workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleMember}, nil)
+		connRepo := new(MockConnectionRepository)
+		connRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		adapter := new(MockMCPAdapter)
+		adapter.On("Connect", mock.Anything, mock.Anything).Return(connectErr)
+		adapter.On("ListTables", mock.Anything).Return([]string{"orders", "customers"}, nil)
+		adapter.On("Close").Return(nil)
+		mcpRouter := mcp.NewRouter()
+		mcpRouter.RegisterAdapter("postgres", func() mcp.Adapter { return adapter })
+
+		encryptor, err := security.NewEncryptorFromSecret("connection-test-secret")
+		require.NoError(t, err)
+		warmer := &recordingWarmer{}
+		svc := NewConnectionService(connRepo, workspaceRepo, encryptor, mcpRouter, 100, 30).WithSchemaWarmer(warmer)
+		return svc, connRepo, adapter, mcpRouter, warmer
+	}
+
+	t.Run("reachable connection is saved and warmed", func(t *testing.T) {
+		svc, connRepo, adapter, mcpRouter, warmer := setup(t, nil)
+
+		info, err := svc.Create(ctx, userID, workspaceID, input)
+		require.NoError(t, err)
+		assert.True(t, info.Validated)
+		require.NotNil(t, info.TableCount)
+		assert.Equal(t, 2, *info.TableCount)
+		connRepo.AssertNumberOfCalls(t, "Create", 1)
+		assert.Equal(t, []uuid.UUID{info.ID}, warmer.connections)
+
+		// The probe's adapter does not stay in the pool
+		adapter.AssertNumberOfCalls(t, "Close", 1)
+		assert.Equal(t, 0, mcpRouter.PoolSize())
+	})
+
+	t.Run("unreachable connection is not saved", func(t *testing.T) {
+		svc, connRepo, _, _, warmer := setup(t, errors.New("dial tcp db:5432: connection refused"))
+
+		_, err := svc.Create(ctx, userID, workspaceID, input)
+		require.Error(t, err)
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+		assert.Contains(t, err.Error(), "dial tcp db:5432: connection refused")
+		connRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		assert.Empty(t, warmer.connections)
+	})
+
+	t.Run("opting out skips the probe", func(t *testing.T) {
+		svc, connRepo, adapter, _, warmer := setup(t, errors.New("connection refused"))
+
+		unchecked := input
+		unchecked.Validate = new(bool)
+		info, err := svc.Create(ctx, userID, workspaceID, unchecked)
+		require.NoError(t, err)
+		assert.False(t, info.Validated)
+		assert.Nil(t, info.TableCount)
+		connRepo.AssertNumberOfCalls(t, "Create", 1)
+		adapter.AssertNotCalled(t, "Connect", mock.Anything, mock.Anything)
+		assert.Empty(t, warmer.connections)
+	})
+}
+
+func TestConnectionService_SQLitePaths(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+	root := t.TempDir()
+	inside := filepath.Join(root, "sales.db")
+	require.NoError(t, os.WriteFile(inside, nil, 0o644))
+	require.NoError(t, os.Symlink("/etc/passwd", filepath.Join(root, "passwd.db")))
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleMember}, nil)
+	connRepo := new(MockConnectionRepository)
+	connRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	encryptor, err := security.NewEncryptorFromSecret("connection-test-secret")
+	require.NoError(t, err)
+	svc := NewConnectionService(connRepo, workspaceRepo, encryptor, mcp.NewRouter(), 100, 30).WithSQLiteRoot(root)
+
+	input := domain.ConnectionCreate{Name: "file", DatabaseType: domain.DatabaseTypeSQLite, Host: "localhost", Port: 1,
+		Username: "sqlite", Password: "sqlite", Validate: new(bool)}
+	for _, path := range []string{"/app/.env", root + "/../etc/passwd.db", filepath.Join(root, "passwd.db")} {
+		input.Database = path
+		_, err := svc.Create(ctx, userID, workspaceID, input)
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err), path)
+	}
+	connRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+	input.Database = inside
+	_, err = svc.Create(ctx, userID, workspaceID, input)
+	require.NoError(t, err)
+}
+
+func TestConnectionService_TestConnection(t *testing.T) {
+	ctx := context.Background()
+	adapter := new(MockMCPAdapter)
+	adapter.On("Connect", mock.Anything, mock.MatchedBy(func(c mcp.ConnectionConfig) bool { return c.Host == "replica" })).
+		Return(errors.New("dial tcp replica:5433: connection refused"))
+	adapter.On("Connect", mock.Anything, mock.Anything).Return(nil)
+	adapter.On("ListTables", mock.Anything).Return([]string{"orders"}, nil)
+	adapter.On("Close").Return(nil)
+	mcpRouter := mcp.NewRouter()
+	mcpRouter.RegisterAdapter("postgres", func() mcp.Adapter { return adapter })
+	svc := NewConnectionService(nil, nil, nil, mcpRouter, 100, 30)
+
+	input := domain.ConnectionCreate{DatabaseType: domain.DatabaseTypePostgres, Host: "db", Port: 5432, Database: "sales", Username: "reader", Password: "secret"}
+	result, err := svc.TestConnection(ctx, input)
+	require.NoError(t, err)
+	assert.True(t, result.Primary.Connected)
+	assert.Nil(t, result.Replica)
+
+	// A replica that is down is reported without failing the test
+	input.ReplicaHost, input.ReplicaPort = "replica", 5433
+	result, err = svc.TestConnection(ctx, input)
+	require.NoError(t, err)
+	assert.True(t, result.Primary.Connected)
+	require.NotNil(t, result.Replica)
+	assert.False(t, result.Replica.Connected)
+	assert.Contains(t, result.Replica.Error, "replica:5433: connection refused")
+	assert.Equal(t, 0, mcpRouter.PoolSize())
+}
+
+func TestConnectionService_Health(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+
+	setup := func(t *testing.T, healthErr error) (*ConnectionService, *domain.Connection) {
+		encryptor, err := security.NewEncryptorFromSecret("connection-test-secret")
+		require.NoError(t, err)
+		credentials, err := encryptor.EncryptJSON(map[string]string{"password": "secret"})
+		require.NoError(t, err)
+		conn := &domain.Connection{
+			ID:                   uuid.New(),
+			WorkspaceID:          workspaceID,
+			DatabaseType:         domain.DatabaseTypePostgres,
+			Host:                 "db",
+			Port:                 5432,
+			CredentialsEncrypted: credentials,
+		}
+
+		workspaceRepo := new(MockWorkspaceRepository)
+		workspaceRepo.On("IsMember", mock.Anything, workspaceID, userID).Return(true, nil)
+		connRepo := new(MockConnectionRepository)
+		connRepo.On("GetByIDAndWorkspace", mock.Anything, conn.ID, workspaceID).Return(conn, nil)
+
+		adapter := new(MockMCPAdapter)
+		adapter.On("Connect", mock.Anything, mock.MatchedBy(func(config mcp.ConnectionConfig) bool {
+			return config.Password == "secret"
+		})).Return(nil)
+		adapter.On("HealthCheck", mock.Anything).Return(healthErr)
+		mcpRouter := mcp.NewRouter()
+		mcpRouter.RegisterAdapter("postgres", func() mcp.Adapter { return adapter })
+
+		return NewConnectionService(connRepo, workspaceRepo, encryptor, mcpRouter, 100, 30), conn
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		svc, conn := setup(t, nil)
+
+		health, err := svc.Health(ctx, userID, workspaceID, conn.ID)
+		require.NoError(t, err)
+		assert.Equal(t, conn.ID, health.ConnectionID)
+		assert.True(t, health.Healthy)
+		assert.Empty(t, health.Error)
+	})
+
+	t.Run("unreachable database is reported, not returned", func(t *testing.T) {
+		svc, conn := setup(t, errors.New("connection refused"))
+
+		health, err := svc.Health(ctx, userID, workspaceID, conn.ID)
+		require.NoError(t, err)
+		assert.False(t, health.Healthy)
+		assert.Equal(t, "connection refused", health.Error)
+		assert.Nil(t, health.Pool)
+	})
+}
+
+func TestConnectionService_UnreadableCredentials(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+
+	encryptor, err := security.NewEncryptorFromSecret("connection-test-secret")
+	require.NoError(t, err)
+	rotated, err := security.NewEncryptorFromSecret("previous-secret")
+	require.NoError(t, err)
+	credentials, err := rotated.EncryptJSON(map[string]string{"password": "old"})
+	require.NoError(t, err)
+	conn := &domain.Connection{
+		ID:                   uuid.New(),
+		WorkspaceID:          workspaceID,
+		Name:                 "warehouse",
+		DatabaseType:         domain.DatabaseTypePostgres,
+		Host:                 "db",
+		Port:                 5432,
+		CredentialsEncrypted: credentials,
+	}
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("IsMember", mock.Anything, workspaceID, userID).Return(true, nil)
+	workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleMember}, nil)
+	connRepo := new(MockConnectionRepository)
+	connRepo.On("GetByIDAndWorkspace", mock.Anything, conn.ID, workspaceID).Return(conn, nil)
+	connRepo.On("Update", mock.Anything, conn.ID, conn).Return(nil)
+	svc := NewConnectionService(connRepo, workspaceRepo, encryptor, mcp.NewRouter(), 100, 30)
+
+	_, _, err = svc.GetFullConnection(ctx, userID, workspaceID, conn.ID)
+	require.Error(t, err)
+	assert.Equal(t, apperr.CredentialsUnreadable, apperr.KindOf(err))
+	assert.ErrorIs(t, err, security.ErrUndecryptable)
+
+	info, err := svc.UpdateCredentials(ctx, userID, workspaceID, conn.ID, domain.ConnectionCredentialsUpdate{Password: "new"})
+	require.NoError(t, err)
+	assert.Equal(t, "warehouse", info.Name, "other fields are kept")
+
+	_, password, err := svc.GetFullConnection(ctx, userID, workspaceID, conn.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new", password)
+}
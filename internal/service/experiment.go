@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+)
+
+// WithExperiments reports the results of workspace experiments from repo
+func (s *QueryService) WithExperiments(repo domain.ExperimentRepository) *QueryService {
+	s.experimentRepo = repo
+	return s
+}
+
+// experimentArm returns the workspace's running experiment and the arm that answers req.
+// Only questions that leave the provider and model to the server are enrolled, so an
+// explicit choice is never overridden.
+func experimentArm(settings domain.WorkspaceSettings, userID uuid.UUID, req domain.QueryRequest) (*domain.Experiment, domain.ExperimentArm, bool) {
+	exp := settings.Experiment
+	if exp == nil || !exp.Enabled || len(exp.Arms) == 0 || req.LLMProvider != "" || req.LLMModel != "" {
+		return nil, domain.ExperimentArm{}, false
+	}
+	return exp, exp.Assign(exp.AssignmentKey(userID, req.Question)), true
+}
+
+// GetExperimentResults compares the arms of a workspace experiment over the last days.
+// name defaults to the workspace's configured experiment, so results of an experiment
+// that was since replaced can still be read by name.
+func (s *QueryService) GetExperimentResults(ctx context.Context, workspaceID uuid.UUID, name string, days int) (*domain.ExperimentResults, error) {
+	var arms []domain.ExperimentArm
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if exp := settings.Experiment; exp != nil && (name == "" || name == exp.Name) {
+		name = exp.Name
+		arms = exp.Arms
+	}
+	if name == "" {
+		return nil, apperr.New(apperr.NotFound, "workspace has no experiment")
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	var counts []domain.ExperimentArmCount
+	if s.experimentRepo != nil {
+		counts, err = s.experimentRepo.CountByArm(ctx, workspaceID, name, since)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count experiment answers: %w", err)
+		}
+	}
+	return summarizeExperiment(name, since, arms, counts), nil
+}
+
+// summarizeExperiment folds per-arm counts into arm results, listing the configured arms
+// first in their order, then arms that were since removed
+func summarizeExperiment(name string, since time.Time, arms []domain.ExperimentArm, counts []domain.ExperimentArmCount) *domain.ExperimentResults {
+	type armSum struct {
+		result       domain.ExperimentArmResult
+		latencyTotal int64
+		latencyCount int64
+	}
+	sums := map[string]*armSum{}
+	var order []string
+	sumFor := func(arm string) *armSum {
+		sum, ok := sums[arm]
+		if !ok {
+			sum = &armSum{result: domain.ExperimentArmResult{Arm: arm, ByStatus: map[domain.QueryStatus]int{}}}
+			sums[arm] = sum
+			order = append(order, arm)
+		}
+		return sum
+	}
+	for _, arm := range arms {
+		sumFor(arm.Name)
+	}
+	for _, c := range counts {
+		sum := sumFor(c.Arm)
+		sum.result.Total += c.Count
+		sum.result.ByStatus[c.Status] += c.Count
+		sum.result.TotalTokens += c.TotalTokens
+		sum.latencyTotal += c.TotalLatencyMs
+		sum.latencyCount += int64(c.LatencyCount)
+	}
+
+	results := &domain.ExperimentResults{Experiment: name, Since: since, Arms: make([]domain.ExperimentArmResult, 0, len(order))}
+	for _, arm := range order {
+		sum := sums[arm]
+		if sum.result.Total > 0 {
+			sum.result.SuccessRate = float64(sum.result.ByStatus[domain.QueryStatusOK]) / float64(sum.result.Total)
+			sum.result.AvgTokens = sum.result.TotalTokens / int64(sum.result.Total)
+		}
+		if sum.latencyCount > 0 {
+			sum.result.AvgLatencyMs = sum.latencyTotal / sum.latencyCount
+		}
+		results.Arms = append(results.Arms, sum.result)
+	}
+	return results
+}
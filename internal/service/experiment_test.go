@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExperimentArm(t *testing.T) {
+	exp := &domain.Experiment{
+		Name:     "providers",
+		Enabled:  true,
+		AssignBy: domain.ExperimentAssignByUser,
+		Arms: []domain.ExperimentArm{
+			{Name: "control", Provider: "openai", Weight: 1},
+			{Name: "claude", Provider: "anthropic", Weight: 1},
+		},
+	}
+	settings := domain.WorkspaceSettings{Experiment: exp}
+	userID := uuid.New()
+
+	got, arm, ok := experimentArm(settings, userID, domain.QueryRequest{Question: "How many users?"})
+	require.True(t, ok)
+	assert.Same(t, exp, got)
+	assert.Equal(t, exp.Assign(userID.String()), arm)
+
+	_, _, ok = experimentArm(settings, userID, domain.QueryRequest{Question: "q", LLMProvider: "openai"})
+	assert.False(t, ok, "an explicit provider is not enrolled")
+	_, _, ok = experimentArm(settings, userID, domain.QueryRequest{Question: "q", LLMModel: "gpt-4o"})
+	assert.False(t, ok, "an explicit model is not enrolled")
+
+	_, _, ok = experimentArm(domain.WorkspaceSettings{}, userID, domain.QueryRequest{Question: "q"})
+	assert.False(t, ok, "no experiment")
+
+	disabled := *exp
+	disabled.Enabled = false
+	_, _, ok = experimentArm(domain.WorkspaceSettings{Experiment: &disabled}, userID, domain.QueryRequest{Question: "q"})
+	assert.False(t, ok, "experiments are opt in")
+}
+
+func TestSummarizeExperiment(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	arms := []domain.ExperimentArm{{Name: "control"}, {Name: "candidate"}, {Name: "idle"}}
+	results := summarizeExperiment("providers", since, arms, []domain.ExperimentArmCount{
+		{Arm: "candidate", Status: domain.QueryStatusOK, Count: 3, TotalLatencyMs: 900, LatencyCount: 3, TotalTokens: 600},
+		{Arm: "candidate", Status: domain.QueryStatusSQLError, Count: 1, TotalLatencyMs: 500, LatencyCount: 1, TotalTokens: 200},
+		{Arm: "control", Status: domain.QueryStatusOK, Count: 1, TotalLatencyMs: 100, LatencyCount: 1, TotalTokens: 50},
+		{Arm: "retired", Status: domain.QueryStatusLLMError, Count: 2},
+	})
+
+	assert.Equal(t, "providers", results.Experiment)
+	assert.Equal(t, since, results.Since)
+	require.Len(t, results.Arms, 4)
+
+	control, candidate, idle, retired := results.Arms[0], results.Arms[1], results.Arms[2], results.Arms[3]
+	assert.Equal(t, "control", control.Arm)
+	assert.Equal(t, 1.0, control.SuccessRate)
+
+	assert.Equal(t, "candidate", candidate.Arm)
+	assert.Equal(t, 4, candidate.Total)
+	assert.Equal(t, map[domain.QueryStatus]int{domain.QueryStatusOK: 3, domain.QueryStatusSQLError: 1}, candidate.ByStatus)
+	assert.Equal(t, 0.75, candidate.SuccessRate)
+	assert.Equal(t, int64(350), candidate.AvgLatencyMs)
+	assert.Equal(t, int64(800), candidate.TotalTokens)
+	assert.Equal(t, int64(200), candidate.AvgTokens)
+
+	assert.Equal(t, "idle", idle.Arm)
+	assert.Zero(t, idle.Total)
+	assert.Zero(t, idle.SuccessRate)
+
+	assert.Equal(t, "retired", retired.Arm, "arms removed from the settings are still reported")
+	assert.Zero(t, retired.SuccessRate)
+	assert.Zero(t, retired.AvgLatencyMs)
+}
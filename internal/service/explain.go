@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+)
+
+// ExplainSQL explains SQL written elsewhere against a connection's schema, without
+// running it. The SQL must pass the adapter's validation, so only reads are explained.
+// With a session ID the explanation is recorded in that session.
+func (s *QueryService) ExplainSQL(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, req domain.ExplainSQLRequest) (*domain.ExplainSQLResponse, error) {
+	startTime := time.Now()
+
+	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		user = nil
+	}
+	providerName, modelName := resolveProvider(settings, user, domain.QueryRequest{LLMProvider: req.LLMProvider, LLMModel: req.LLMModel}, s.llmRouter.DefaultProvider())
+	if err := s.llmRouter.CheckSelection(ctx, providerName, req.LLMModel); err != nil {
+		return nil, selectionError(err)
+	}
+	if err := s.checkProvider(ctx, settings, workspaceID, userID, providerName, "explain_sql"); err != nil {
+		return nil, err
+	}
+
+	if req.SessionID != uuid.Nil {
+		if _, err := s.getWorkspaceSession(ctx, workspaceID, req.SessionID); err != nil {
+			return nil, err
+		}
+	}
+
+	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), adapterConfig(conn, password))
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to get database adapter: %w", err))
+	}
+	if err := adapter.ValidateQuery(req.SQL); err != nil {
+		blocked := &apperr.Error{Kind: apperr.Validation, Message: err.Error(), Err: err}
+		var validation *mcp.ValidationError
+		if errors.As(err, &validation) {
+			blocked.Details = &domain.BlockedQuery{Rule: validation.Rule, Matched: validation.Matched, Position: validation.Position}
+		}
+		return nil, blocked
+	}
+
+	schema, err := s.getSchema(ctx, conn, adapter)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to get schema: %w", err))
+	}
+
+	var llmConfig map[string]any
+	if user != nil {
+		llmConfig = s.providerConfig(user, providerName)
+	}
+	provider, err := s.llmRouter.GetProviderWithConfig(providerName, llmConfig)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Validation, fmt.Errorf("failed to get LLM provider: %w", err))
+	}
+	if modelName == "" {
+		modelName = provider.DefaultModel()
+	}
+
+	releaseLLM, err := s.acquireLLM(ctx, workspaceID, providerName)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseLLM()
+	llmTimeout := s.generationTimeout(providerName, nil)
+	genCtx, cancelGen := context.WithCancel(ctx)
+	if llmTimeout > 0 {
+		genCtx, cancelGen = context.WithTimeout(ctx, llmTimeout)
+	}
+	llmStart := time.Now()
+	llmReq := llm.Request{
+		SchemaDDL:         schema.DDL,
+		UndescribedTables: schema.WarningTables(),
+		SQLDialect:        adapter.SQLDialect(),
+		DatabaseType:      adapter.DatabaseType(),
+		ExplainSQL:        req.SQL,
+	}
+	llmResp, err := provider.GenerateSQL(genCtx, llmReq, modelName)
+	releaseLLM()
+	genTimedOut := err != nil && errors.Is(genCtx.Err(), context.DeadlineExceeded)
+	cancelGen()
+	tokens := 0
+	if llmResp != nil {
+		tokens = llmResp.TokensUsed
+	}
+	s.metrics.ObserveLLMCall(providerName, modelName, time.Since(llmStart), tokens, err)
+	if genTimedOut {
+		return nil, apperr.Newf(apperr.Timeout, "SQL explanation timed out after %s", llmTimeout)
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to explain SQL: %w", err))
+	}
+
+	content := llmResp.Content
+	if content == "" {
+		content = llmResp.Explanation
+	}
+	explanation, llmWarnings := llm.ParseExplanation(content)
+	tables, unknown := schemaTables(req.SQL, schema.Tables)
+	warnings := []string{}
+	for _, name := range unknown {
+		warnings = append(warnings, fmt.Sprintf("table %s is not in the schema", name))
+	}
+	warnings = append(warnings, llmWarnings...)
+
+	resp := &domain.ExplainSQLResponse{
+		Explanation:      explanation,
+		ReferencedTables: tables,
+		Warnings:         warnings,
+		Metadata: &domain.QueryMetadata{
+			ConnectionID:    conn.ID,
+			DatabaseType:    string(conn.DatabaseType),
+			LLMProvider:     providerName,
+			LLMModel:        modelName,
+			ExecutionTimeMs: time.Since(startTime).Milliseconds(),
+			LLMLatencyMs:    llmResp.LatencyMs,
+			TokensUsed:      llmResp.TokensUsed,
+			PromptTemplate:  llm.PromptVersion(llmReq),
+		},
+	}
+	recordPhases(ctx, resp.Metadata)
+
+	if req.SessionID != uuid.Nil {
+		s.saveExplanation(ctx, userID, workspaceID, req, resp, startTime)
+	}
+	return resp, nil
+}
+
+// saveExplanation records an explanation as a turn of the request's session, so it
+// shows in the history and gives later questions the SQL as context. Its status keeps
+// it out of answer statistics and SQL suggestions.
+func (s *QueryService) saveExplanation(ctx context.Context, userID, workspaceID uuid.UUID, req domain.ExplainSQLRequest, resp *domain.ExplainSQLResponse, startTime time.Time) {
+	content := resp.Explanation
+	if len(resp.Warnings) > 0 {
+		content += "\n\nPotential issues:\n- " + strings.Join(resp.Warnings, "\n- ")
+	}
+	latency := resp.Metadata.ExecutionTimeMs
+	turn := &domain.ConversationTurn{
+		SessionID: req.SessionID,
+		UserMessage: &domain.Message{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			UserID:      &userID,
+			SessionID:   &req.SessionID,
+			Role:        domain.RoleUser,
+			Content:     fmt.Sprintf("Explain this SQL:\n```sql\n%s\n```", strings.TrimSpace(req.SQL)),
+			CreatedAt:   startTime,
+		},
+		AssistantMessage: &domain.Message{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			SessionID:   &req.SessionID,
+			Role:        domain.RoleAssistant,
+			Content:     content,
+			SQL:         req.SQL,
+			Metadata:    resp.Metadata,
+			Status:      domain.QueryStatusExplained,
+			LatencyMs:   &latency,
+			CreatedAt:   time.Now(),
+		},
+		Title: sessionTitle("Explain SQL"),
+	}
+	if err := s.messageRepo.CreateConversationTurn(context.WithoutCancel(ctx), turn); err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("session_id", req.SessionID.String()).Msg("failed to save SQL explanation")
+	}
+}
+
+// schemaTables splits the tables sql reads from into those of the schema, named as
+// in the schema, and the others
+func schemaTables(sql string, schema []domain.TableInfo) (tables, unknown []string) {
+	known := make(map[string]string, len(schema))
+	for _, table := range schema {
+		known[strings.ToLower(table.Name)] = table.Name
+	}
+
+	tables, unknown = []string{}, []string{}
+	seen := map[string]bool{}
+	for _, name := range referencedTables(sql) {
+		name = strings.Trim(name, "\"`[]")
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if table, ok := known[key]; ok {
+			tables = append(tables, table)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return tables, unknown
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryService_ExplainSQL(t *testing.T) {
+	ctx := context.Background()
+	sql := "SELECT u.id FROM users u JOIN legacy_orders o ON o.user_id = u.id"
+
+	t.Run("success", func(t *testing.T) {
+		f := newExecuteQueryFixture(t)
+		sessionID := uuid.New()
+		f.sessionRepo.On("Get", mock.Anything, sessionID).
+			Return(&domain.ChatSession{ID: sessionID, WorkspaceID: f.workspaceID, Title: "Users"}, nil)
+		f.adapter.On("ValidateQuery", sql).Return(nil)
+		f.llmProvider.On("GenerateSQL", mock.Anything, mock.MatchedBy(func(req llm.Request) bool {
+			return req.ExplainSQL == sql && req.SchemaDDL == "CREATE TABLE users (id uuid);"
+		}), "mock-model").Return(&llm.Response{
+			Content:    "Lists users with orders.\n\nPotential issues:\n- Users with several orders repeat",
+			TokensUsed: 30,
+		}, nil)
+
+		var turn *domain.ConversationTurn
+		f.messageRepo.On("CreateConversationTurn", mock.Anything, mock.AnythingOfType("*domain.ConversationTurn")).
+			Run(func(args mock.Arguments) { turn = args.Get(1).(*domain.ConversationTurn) }).
+			Return(nil)
+
+		resp, err := f.svc.ExplainSQL(ctx, f.userID, f.workspaceID, f.connectionID, domain.ExplainSQLRequest{
+			SQL:       sql,
+			SessionID: sessionID,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, "Lists users with orders.", resp.Explanation)
+		assert.Equal(t, []string{"users"}, resp.ReferencedTables)
+		assert.Equal(t, []string{"table legacy_orders is not in the schema", "Users with several orders repeat"}, resp.Warnings)
+		assert.Equal(t, 30, resp.Metadata.TokensUsed)
+
+		require.NotNil(t, turn)
+		assert.Equal(t, sessionID, turn.SessionID)
+		assert.Contains(t, turn.UserMessage.Content, sql)
+		assert.Equal(t, sql, turn.AssistantMessage.SQL)
+		assert.Equal(t, domain.QueryStatusExplained, turn.AssistantMessage.Status)
+		assert.Contains(t, turn.AssistantMessage.Content, "Users with several orders repeat")
+		f.adapter.AssertNotCalled(t, "ExecuteQuery", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("common table expressions are not flagged", func(t *testing.T) {
+		f := newExecuteQueryFixture(t)
+		cte := "WITH recent (id) AS (SELECT id FROM users) SELECT * FROM recent"
+		f.adapter.On("ValidateQuery", cte).Return(nil)
+		f.llmProvider.On("GenerateSQL", mock.Anything, mock.Anything, "mock-model").
+			Return(&llm.Response{Content: "Lists users."}, nil)
+
+		resp, err := f.svc.ExplainSQL(ctx, f.userID, f.workspaceID, f.connectionID, domain.ExplainSQLRequest{SQL: cte})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"users"}, resp.ReferencedTables)
+		assert.Empty(t, resp.Warnings)
+	})
+
+	t.Run("write rejected", func(t *testing.T) {
+		f := newExecuteQueryFixture(t)
+		f.adapter.On("ValidateQuery", "DELETE FROM users").
+			Return(&mcp.ValidationError{Rule: "DELETE keyword found", Matched: "DELETE"})
+
+		_, err := f.svc.ExplainSQL(ctx, f.userID, f.workspaceID, f.connectionID, domain.ExplainSQLRequest{SQL: "DELETE FROM users"})
+		require.Error(t, err)
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+		f.llmProvider.AssertNotCalled(t, "GenerateSQL", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
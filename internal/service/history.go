@@ -0,0 +1,103 @@
+package service
+
+import (
+	"cmp"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+)
+
+const (
+	// historyFetchLimit is the most messages of a session read to pick the history from
+	historyFetchLimit = domain.MaxHistoryMessages
+	// DefaultHistoryTokenBudget is the estimated tokens of history given to the LLM when
+	// the server sets no budget
+	DefaultHistoryTokenBudget = 2000
+	// DefaultHistoryMaxMessages is the most messages of history given to the LLM when
+	// the server sets no cap
+	DefaultHistoryMaxMessages = 20
+)
+
+// historyLimits cap the history given to the LLM
+type historyLimits struct {
+	messages int // messages of the session
+	tokens   int // estimated tokens
+}
+
+// historyLimits returns the history caps of a workspace, the server's where it sets none
+func (s *QueryService) historyLimits(settings domain.WorkspaceSettings) historyLimits {
+	return historyLimits{
+		messages: cmp.Or(settings.HistoryMaxMessages, s.historyMessages),
+		tokens:   cmp.Or(settings.HistoryMaxTokens, s.historyBudget),
+	}
+}
+
+// historyTurn is a question and the answer that followed it. Either may be missing
+// when the session holds unpaired messages.
+type historyTurn struct {
+	messages []domain.Message
+	answer   *domain.Message
+}
+
+// failed reports whether the turn's answer failed
+func (t historyTurn) failed() bool {
+	return t.answer != nil && t.answer.Status.Failed()
+}
+
+// tokens estimates the tokens the turn takes in a prompt, at about four characters a token
+func (t historyTurn) tokens() int {
+	chars := 0
+	for _, m := range t.messages {
+		chars += len(m.Content) + len(m.SQL) + len(m.Error)
+	}
+	return chars/4 + 1
+}
+
+// selectHistory picks the messages of a session, oldest first, given to the LLM. mode
+// is one of the History* modes, HistorySuccessful when empty. Turns are taken from
+// the newest while they fit limits, so a long answer does not push the schema out of
+// the model's context. dropped counts the messages of older turns left out to fit.
+func selectHistory(messages []domain.Message, mode string, limits historyLimits) (history []domain.Message, dropped int) {
+	if mode == domain.HistoryNone || len(messages) == 0 {
+		return []domain.Message{}, 0
+	}
+
+	var turns []historyTurn
+	for i := range messages {
+		m := messages[i]
+		last := len(turns) - 1
+		if m.Role == domain.RoleAssistant && last >= 0 && turns[last].answer == nil {
+			turns[last].messages = append(turns[last].messages, m)
+			turns[last].answer = &turns[last].messages[len(turns[last].messages)-1]
+			continue
+		}
+		turn := historyTurn{messages: []domain.Message{m}}
+		if m.Role == domain.RoleAssistant {
+			turn.answer = &turn.messages[0]
+		}
+		turns = append(turns, turn)
+	}
+
+	var picked []historyTurn
+	usedTokens, usedMessages := 0, 0
+	full := false
+	for i := len(turns) - 1; i >= 0; i-- {
+		turn := turns[i]
+		if mode != domain.HistoryAll && turn.failed() && i != len(turns)-1 {
+			continue
+		}
+		usedTokens += turn.tokens()
+		usedMessages += len(turn.messages)
+		full = full || usedTokens > limits.tokens || usedMessages > limits.messages
+		if full {
+			dropped += len(turn.messages)
+			continue
+		}
+		picked = append(picked, turn)
+	}
+
+	history = []domain.Message{}
+	for i := len(picked) - 1; i >= 0; i-- {
+		history = append(history, picked[i].messages...)
+	}
+	return history, dropped
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectHistory(t *testing.T) {
+	question := func(content string) domain.Message {
+		return domain.Message{Role: domain.RoleUser, Content: content}
+	}
+	answer := func(sql string, status domain.QueryStatus) domain.Message {
+		return domain.Message{Role: domain.RoleAssistant, SQL: sql, Status: status}
+	}
+	contents := func(messages []domain.Message) []string {
+		out := []string{}
+		for _, m := range messages {
+			out = append(out, m.Content+m.SQL)
+		}
+		return out
+	}
+
+	limits := historyLimits{messages: 50, tokens: 1000}
+	session := []domain.Message{
+		question("q1"), answer("s1", domain.QueryStatusOK),
+		question("q2"), answer("s2", domain.QueryStatusBlocked),
+		question("q3"), answer("s3", domain.QueryStatusOK),
+		question("q4"), answer("s4", domain.QueryStatusSQLError),
+	}
+
+	t.Run("successful turns and the latest", func(t *testing.T) {
+		got, dropped := selectHistory(session, domain.HistorySuccessful, limits)
+		assert.Equal(t, []string{"q1", "s1", "q3", "s3", "q4", "s4"}, contents(got))
+		assert.Zero(t, dropped)
+	})
+
+	t.Run("empty mode is successful", func(t *testing.T) {
+		successful, _ := selectHistory(session, domain.HistorySuccessful, limits)
+		got, _ := selectHistory(session, "", limits)
+		assert.Equal(t, successful, got)
+	})
+
+	t.Run("all turns", func(t *testing.T) {
+		got, _ := selectHistory(session, domain.HistoryAll, limits)
+		assert.Equal(t, []string{"q1", "s1", "q2", "s2", "q3", "s3", "q4", "s4"}, contents(got))
+	})
+
+	t.Run("none", func(t *testing.T) {
+		got, dropped := selectHistory(session, domain.HistoryNone, limits)
+		assert.Empty(t, got)
+		assert.Zero(t, dropped)
+	})
+
+	t.Run("token budget keeps the newest turns", func(t *testing.T) {
+		long := []domain.Message{
+			question("old"), answer(strings.Repeat("x", 400), domain.QueryStatusOK),
+			question("new"), answer("s", domain.QueryStatusOK),
+		}
+		got, dropped := selectHistory(long, domain.HistoryAll, historyLimits{messages: 50, tokens: 50})
+		assert.Equal(t, []string{"new", "s"}, contents(got))
+		assert.Equal(t, 2, dropped)
+	})
+
+	t.Run("message cap drops the oldest turns", func(t *testing.T) {
+		got, dropped := selectHistory(session, domain.HistoryAll, historyLimits{messages: 5, tokens: 1000})
+		assert.Equal(t, []string{"q3", "s3", "q4", "s4"}, contents(got))
+		assert.Equal(t, 4, dropped)
+	})
+
+	t.Run("unanswered question", func(t *testing.T) {
+		got, _ := selectHistory([]domain.Message{question("q1"), answer("s1", domain.QueryStatusOK), question("q2")}, domain.HistorySuccessful, limits)
+		assert.Equal(t, []string{"q1", "s1", "q2"}, contents(got))
+	})
+}
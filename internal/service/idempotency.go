@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+const (
+	// idempotencyRunTTL bounds a query run under an idempotency key; a claim left by a
+	// crashed server expires after it
+	idempotencyRunTTL = 5 * time.Minute
+	// idempotencyTTL is how long the outcome of a query is replayed to retries
+	idempotencyTTL = time.Hour
+
+	// IdempotencyRetryAfter is suggested to clients retrying while the original request runs
+	IdempotencyRetryAfter = 2 * time.Second
+	// MaxIdempotencyKeyLength caps the length of Idempotency-Key headers
+	MaxIdempotencyKeyLength = 255
+)
+
+// ErrIdempotencyInProgress is returned to retries arriving while the original request runs
+var ErrIdempotencyInProgress = apperr.New(apperr.Conflict, "a request with this idempotency key is in progress")
+
+// IdempotencyStore persists query requests sent with an Idempotency-Key
+type IdempotencyStore interface {
+	// Claim stores entry unless key is taken, in which case it returns the stored entry
+	Claim(ctx context.Context, key string, entry *domain.IdempotentQuery, ttl time.Duration) (*domain.IdempotentQuery, error)
+	Save(ctx context.Context, key string, entry *domain.IdempotentQuery, ttl time.Duration) error
+	// Release removes the entry under key so that a retry runs the request again
+	Release(ctx context.Context, key string) error
+}
+
+// WithIdempotency enables Idempotency-Key support for ExecuteQueryIdempotent
+func (s *QueryService) WithIdempotency(store IdempotencyStore) *QueryService {
+	s.idempotency = store
+	return s
+}
+
+// ExecuteQueryIdempotent runs ExecuteQuery at most once per key. Retries with the same key
+// get the outcome of the first request and replayed reports whether the result was replayed.
+// Only answers and errors a retry would get again are replayed; after any other error the
+// key is released so that the retry runs. Keys are scoped to the user and workspace.
+func (s *QueryService) ExecuteQueryIdempotent(ctx context.Context, userID, workspaceID uuid.UUID, key string, req domain.QueryRequest) (resp *domain.QueryResponse, replayed bool, err error) {
+	if s.idempotency == nil || key == "" {
+		resp, err := s.ExecuteQuery(ctx, userID, workspaceID, req)
+		return resp, false, err
+	}
+
+	scopedKey := userID.String() + ":" + workspaceID.String() + ":" + key
+	fingerprint := requestFingerprint(req)
+
+	existing, err := s.idempotency.Claim(ctx, scopedKey, &domain.IdempotentQuery{Fingerprint: fingerprint}, idempotencyRunTTL)
+	if err != nil {
+		// Without Redis the request still runs, just without duplicate protection
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("idempotency store unavailable")
+		resp, err := s.ExecuteQuery(ctx, userID, workspaceID, req)
+		return resp, false, err
+	}
+	if existing != nil {
+		switch {
+		case existing.Fingerprint != fingerprint:
+			return nil, false, apperr.New(apperr.Conflict, "idempotency key was used for a different request")
+		case !existing.Done:
+			return nil, false, ErrIdempotencyInProgress
+		case existing.ErrorKind != "":
+			return nil, true, apperr.New(apperr.Kind(existing.ErrorKind), existing.Error)
+		case existing.Error != "":
+			return nil, true, errors.New(existing.Error)
+		default:
+			return existing.Response, true, nil
+		}
+	}
+
+	// The query finishes even if the client disconnects, so that its retry finds the result
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyRunTTL)
+	defer cancel()
+	resp, err = s.ExecuteQuery(runCtx, userID, workspaceID, req)
+
+	if err != nil && !replayableError(err) {
+		if releaseErr := s.idempotency.Release(runCtx, scopedKey); releaseErr != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(releaseErr).Msg("failed to release idempotency key")
+		}
+		return resp, false, err
+	}
+	entry := &domain.IdempotentQuery{Fingerprint: fingerprint, Done: true, Response: resp}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.ErrorKind = string(apperr.KindOf(err))
+	}
+	if saveErr := s.idempotency.Save(runCtx, scopedKey, entry, idempotencyTTL); saveErr != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(saveErr).Msg("failed to save idempotent query result")
+	}
+	return resp, false, err
+}
+
+// replayableError reports whether err would recur on a retry, such as a validation error,
+// rather than a failure of the LLM, the database or the server
+func replayableError(err error) bool {
+	switch apperr.KindOf(err) {
+	case apperr.Validation, apperr.NotFound, apperr.Forbidden, apperr.Conflict:
+		return true
+	}
+	return false
+}
+
+// requestFingerprint identifies the body of a query request
+func requestFingerprint(req domain.QueryRequest) string {
+	data, _ := json.Marshal(req)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
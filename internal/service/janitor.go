@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/rs/zerolog/log"
+)
+
+// RetentionJanitor periodically purges data that has outlived its retention window
+type RetentionJanitor struct {
+	sessionRepo domain.SessionRepository
+	interval    time.Duration
+}
+
+// NewRetentionJanitor creates a janitor that sweeps every interval
+func NewRetentionJanitor(sessionRepo domain.SessionRepository, interval time.Duration) *RetentionJanitor {
+	return &RetentionJanitor{
+		sessionRepo: sessionRepo,
+		interval:    interval,
+	}
+}
+
+// Run sweeps immediately and then every interval until ctx is cancelled
+func (j *RetentionJanitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.Sweep(ctx); err != nil {
+			log.Error().Err(err).Msg("retention sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep hard-deletes sessions deleted more than domain.SessionRetention ago, with their messages
+func (j *RetentionJanitor) Sweep(ctx context.Context) (int64, error) {
+	purged, err := j.sessionRepo.PurgeDeleted(ctx, time.Now().Add(-domain.SessionRetention))
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		log.Info().Int64("sessions", purged).Msg("purged expired deleted sessions")
+	}
+	return purged, nil
+}
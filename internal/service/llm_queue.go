@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/google/uuid"
+)
+
+// llmQueueKey names a request in the LLM queues, scoped to its workspace so its
+// status is only visible there. Requests without an ID are not tracked.
+func llmQueueKey(workspaceID uuid.UUID, requestID string) string {
+	if requestID == "" {
+		return ""
+	}
+	return workspaceID.String() + "/" + requestID
+}
+
+// acquireLLM waits for a generation slot of the provider, queued under the ID of the
+// HTTP request in ctx. A full queue fails as rate limited, with when to retry.
+func (s *QueryService) acquireLLM(ctx context.Context, workspaceID uuid.UUID, providerName string) (func(), error) {
+	release, err := s.llmRouter.Acquire(ctx, providerName, llmQueueKey(workspaceID, middleware.GetReqID(ctx)))
+	var busy *llm.BusyError
+	if errors.As(err, &busy) {
+		s.metrics.ObserveLLMBusy(busy.Provider)
+		appErr := apperr.Wrap(apperr.RateLimited, busy)
+		appErr.Details = domain.LLMBusy{Provider: busy.Provider, RetryAfterMs: busy.RetryAfter.Milliseconds()}
+		return nil, appErr
+	}
+	return release, err
+}
+
+// LLMQueueStatus reports where a request of the workspace waits for its LLM provider.
+// requestID is the X-Request-ID the request was sent with.
+func (s *QueryService) LLMQueueStatus(workspaceID uuid.UUID, requestID string) (*domain.LLMQueueStatus, error) {
+	status, ok := s.llmRouter.QueueStatus(llmQueueKey(workspaceID, requestID))
+	if !ok {
+		return nil, apperr.New(apperr.NotFound, "request is not waiting for an LLM")
+	}
+	return &domain.LLMQueueStatus{
+		RequestID:       requestID,
+		Provider:        status.Provider,
+		State:           status.State,
+		Position:        status.Position,
+		QueueLength:     status.QueueLength,
+		EstimatedWaitMs: status.EstimatedWait.Milliseconds(),
+	}, nil
+}
@@ -2,6 +2,9 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/Rrens/text-to-sql/internal/domain"
 	"github.com/Rrens/text-to-sql/internal/llm"
@@ -20,6 +23,11 @@ func (m *MockMessageRepository) Create(ctx context.Context, message *domain.Mess
 	return args.Error(0)
 }
 
+func (m *MockMessageRepository) CreateConversationTurn(ctx context.Context, turn *domain.ConversationTurn) error {
+	args := m.Called(ctx, turn)
+	return args.Error(0)
+}
+
 func (m *MockMessageRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int) ([]domain.Message, error) {
 	args := m.Called(ctx, workspaceID, limit)
 	return args.Get(0).([]domain.Message), args.Error(1)
@@ -30,11 +38,59 @@ func (m *MockMessageRepository) ListBySession(ctx context.Context, sessionID uui
 	return args.Get(0).([]domain.Message), args.Error(1)
 }
 
-func (m *MockMessageRepository) GetMostFrequentQuestions(ctx context.Context, workspaceID uuid.UUID, limit int) ([]string, error) {
-	args := m.Called(ctx, workspaceID, limit)
+func (m *MockMessageRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Message, error) {
+	args := m.Called(ctx, id, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Message), args.Error(1)
+}
+
+func (m *MockMessageRepository) GetMostFrequentQuestions(ctx context.Context, workspaceID uuid.UUID, filter domain.FrequentQuestionFilter) ([]string, error) {
+	args := m.Called(ctx, workspaceID, filter)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockMessageRepository) CountByStatus(ctx context.Context, workspaceID uuid.UUID, since time.Time) ([]domain.QueryStatusCount, error) {
+	args := m.Called(ctx, workspaceID, since)
+	return args.Get(0).([]domain.QueryStatusCount), args.Error(1)
+}
+
+func (m *MockMessageRepository) GetQuestion(ctx context.Context, answer *domain.Message) (string, error) {
+	args := m.Called(ctx, answer)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockMessageRepository) ListRecentSQL(ctx context.Context, workspaceID, connectionID uuid.UUID, limit int) ([]string, error) {
+	args := m.Called(ctx, workspaceID, connectionID, limit)
 	return args.Get(0).([]string), args.Error(1)
 }
 
+// MockTableUsageRepository mocks the TableUsageRepository interface
+type MockTableUsageRepository struct {
+	mock.Mock
+}
+
+func (m *MockTableUsageRepository) Record(ctx context.Context, connectionID uuid.UUID, tables []string, at time.Time) error {
+	args := m.Called(ctx, connectionID, tables, at)
+	return args.Error(0)
+}
+
+func (m *MockTableUsageRepository) ListTop(ctx context.Context, connectionID uuid.UUID, limit int) ([]domain.TableUsage, error) {
+	args := m.Called(ctx, connectionID, limit)
+	return args.Get(0).([]domain.TableUsage), args.Error(1)
+}
+
+// MockAuditLogRepository mocks the AuditLogRepository interface
+type MockAuditLogRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuditLogRepository) Create(ctx context.Context, entry *domain.AuditLog) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
 // MockSessionRepository mocks the SessionRepository interface
 type MockSessionRepository struct {
 	mock.Mock
@@ -53,9 +109,9 @@ func (m *MockSessionRepository) Get(ctx context.Context, id uuid.UUID) (*domain.
 	return args.Get(0).(*domain.ChatSession), args.Error(1)
 }
 
-func (m *MockSessionRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int, offset int) ([]domain.ChatSession, error) {
+func (m *MockSessionRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit int, offset int) ([]domain.ChatSessionSummary, int, error) {
 	args := m.Called(ctx, workspaceID, limit, offset)
-	return args.Get(0).([]domain.ChatSession), args.Error(1)
+	return args.Get(0).([]domain.ChatSessionSummary), args.Int(1), args.Error(2)
 }
 
 func (m *MockSessionRepository) Update(ctx context.Context, session *domain.ChatSession) error {
@@ -68,6 +124,21 @@ func (m *MockSessionRepository) Delete(ctx context.Context, id uuid.UUID) error
 	return args.Error(0)
 }
 
+func (m *MockSessionRepository) SoftDelete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockSessionRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
 // MockConnectionRepository mocks the ConnectionRepository
 type MockConnectionRepository struct {
 	mock.Mock
@@ -78,7 +149,7 @@ func (m *MockConnectionRepository) Create(ctx context.Context, conn *domain.Conn
 	return args.Error(0)
 }
 
-func (m *MockConnectionRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Connection, error) {
+func (m *MockConnectionRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Connection, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -86,13 +157,21 @@ func (m *MockConnectionRepository) Get(ctx context.Context, id uuid.UUID) (*doma
 	return args.Get(0).(*domain.Connection), args.Error(1)
 }
 
+func (m *MockConnectionRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Connection, error) {
+	args := m.Called(ctx, id, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Connection), args.Error(1)
+}
+
 func (m *MockConnectionRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Connection, error) {
 	args := m.Called(ctx, workspaceID)
 	return args.Get(0).([]domain.Connection), args.Error(1)
 }
 
-func (m *MockConnectionRepository) Update(ctx context.Context, conn *domain.Connection) error {
-	args := m.Called(ctx, conn)
+func (m *MockConnectionRepository) Update(ctx context.Context, id uuid.UUID, conn *domain.Connection) error {
+	args := m.Called(ctx, id, conn)
 	return args.Error(0)
 }
 
@@ -101,6 +180,183 @@ func (m *MockConnectionRepository) Delete(ctx context.Context, id uuid.UUID) err
 	return args.Error(0)
 }
 
+// MockUploadRepository mocks the UploadRepository
+type MockUploadRepository struct {
+	mock.Mock
+}
+
+func (m *MockUploadRepository) Create(ctx context.Context, upload *domain.Upload) error {
+	args := m.Called(ctx, upload)
+	return args.Error(0)
+}
+
+func (m *MockUploadRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Upload, error) {
+	args := m.Called(ctx, id, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Upload), args.Error(1)
+}
+
+func (m *MockUploadRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Upload, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).([]domain.Upload), args.Error(1)
+}
+
+func (m *MockUploadRepository) ListFilePaths(ctx context.Context) ([]string, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockUploadRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUploadRepository) MarkOrphans(ctx context.Context, at time.Time) (int64, error) {
+	args := m.Called(ctx, at)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// MockWebhookRepository mocks the WebhookRepository
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Webhook, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.Webhook, error) {
+	args := m.Called(ctx, id, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Webhook, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).([]domain.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListSubscribed(ctx context.Context, workspaceID uuid.UUID, event string) ([]domain.Webhook, error) {
+	args := m.Called(ctx, workspaceID, event)
+	return args.Get(0).([]domain.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) Update(ctx context.Context, webhook *domain.Webhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListDeliveries(ctx context.Context, webhookID uuid.UUID, limit int) ([]domain.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, limit)
+	return args.Get(0).([]domain.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ClaimDueDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]domain.WebhookDelivery, error) {
+	args := m.Called(ctx, now, lease, limit)
+	return args.Get(0).([]domain.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+// MockNotificationRepository mocks the NotificationRepository
+type MockNotificationRepository struct {
+	mock.Mock
+}
+
+func (m *MockNotificationRepository) CreateForUser(ctx context.Context, userID uuid.UUID, workspaceID *uuid.UUID, notificationType string, payload json.RawMessage) (*domain.Notification, error) {
+	args := m.Called(ctx, userID, workspaceID, notificationType, payload)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.Notification), args.Error(1)
+}
+
+func (m *MockNotificationRepository) CreateForWorkspace(ctx context.Context, workspaceID uuid.UUID, notificationType string, payload json.RawMessage) ([]domain.Notification, error) {
+	args := m.Called(ctx, workspaceID, notificationType, payload)
+	return args.Get(0).([]domain.Notification), args.Error(1)
+}
+
+func (m *MockNotificationRepository) ListByUser(ctx context.Context, userID uuid.UUID, filter domain.NotificationFilter) ([]domain.Notification, error) {
+	args := m.Called(ctx, userID, filter)
+	return args.Get(0).([]domain.Notification), args.Error(1)
+}
+
+func (m *MockNotificationRepository) MarkRead(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error) {
+	args := m.Called(ctx, id, userID, at)
+	return args.Bool(0), args.Error(1)
+}
+
+// MockNotifier mocks the Notifier
+type MockNotifier struct {
+	mock.Mock
+}
+
+func (m *MockNotifier) Notify(ctx context.Context, userID, workspaceID uuid.UUID, notificationType string, data any) {
+	m.Called(ctx, userID, workspaceID, notificationType, data)
+}
+
+// MockSharedResultRepository mocks the SharedResultRepository
+type MockSharedResultRepository struct {
+	mock.Mock
+}
+
+func (m *MockSharedResultRepository) Create(ctx context.Context, share *domain.SharedResult) error {
+	args := m.Called(ctx, share)
+	return args.Error(0)
+}
+
+func (m *MockSharedResultRepository) GetByTokenHash(ctx context.Context, tokenHash []byte) (*domain.SharedResult, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.SharedResult), args.Error(1)
+}
+
+func (m *MockSharedResultRepository) GetByIDAndWorkspace(ctx context.Context, id, workspaceID uuid.UUID) (*domain.SharedResult, error) {
+	args := m.Called(ctx, id, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.SharedResult), args.Error(1)
+}
+
+func (m *MockSharedResultRepository) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, createdBy *uuid.UUID) ([]domain.SharedResult, error) {
+	args := m.Called(ctx, workspaceID, createdBy)
+	return args.Get(0).([]domain.SharedResult), args.Error(1)
+}
+
+func (m *MockSharedResultRepository) Revoke(ctx context.Context, id uuid.UUID, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
 // MockWorkspaceRepository mocks WorkspaceRepository
 type MockWorkspaceRepository struct {
 	mock.Mock
@@ -111,7 +367,7 @@ func (m *MockWorkspaceRepository) Create(ctx context.Context, workspace *domain.
 	return args.Error(0)
 }
 
-func (m *MockWorkspaceRepository) Get(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
+func (m *MockWorkspaceRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
 	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
@@ -129,6 +385,11 @@ func (m *MockWorkspaceRepository) AddMember(ctx context.Context, member *domain.
 	return args.Error(0)
 }
 
+func (m *MockWorkspaceRepository) UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error {
+	args := m.Called(ctx, workspaceID, userID, role)
+	return args.Error(0)
+}
+
 func (m *MockWorkspaceRepository) GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error) {
 	args := m.Called(ctx, workspaceID, userID)
 	if args.Get(0) == nil {
@@ -137,11 +398,100 @@ func (m *MockWorkspaceRepository) GetMember(ctx context.Context, workspaceID, us
 	return args.Get(0).(*domain.WorkspaceMember), args.Error(1)
 }
 
+func (m *MockWorkspaceRepository) IsMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, workspaceID, userID)
+	return args.Bool(0), args.Error(1)
+}
+
 func (m *MockWorkspaceRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]domain.Workspace, error) {
 	args := m.Called(ctx, userID)
 	return args.Get(0).([]domain.Workspace), args.Error(1)
 }
 
+func (m *MockWorkspaceRepository) ListAll(ctx context.Context, limit, offset int) ([]domain.WorkspaceSummary, int, error) {
+	args := m.Called(ctx, limit, offset)
+	return args.Get(0).([]domain.WorkspaceSummary), args.Int(1), args.Error(2)
+}
+
+func (m *MockWorkspaceRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockWorkspaceRepository) RemoveMember(ctx context.Context, workspaceID, userID uuid.UUID) error {
+	args := m.Called(ctx, workspaceID, userID)
+	return args.Error(0)
+}
+
+// MockUserRepository mocks UserRepository
+type MockUserRepository struct {
+	mock.Mock
+}
+
+func (m *MockUserRepository) Create(ctx context.Context, user *domain.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) GetByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	args := m.Called(ctx, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) GetByExternalID(ctx context.Context, provider, externalID string) (*domain.User, error) {
+	args := m.Called(ctx, provider, externalID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) LinkExternalID(ctx context.Context, userID uuid.UUID, provider, externalID string) error {
+	args := m.Called(ctx, userID, provider, externalID)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	args := m.Called(ctx, email)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockUserRepository) ListWithLLMConfig(ctx context.Context) ([]*domain.User, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*domain.User), args.Error(1)
+}
+
+func (m *MockUserRepository) Search(ctx context.Context, term string, limit, offset int) ([]*domain.User, int, error) {
+	args := m.Called(ctx, term, limit, offset)
+	return args.Get(0).([]*domain.User), args.Int(1), args.Error(2)
+}
+
+func (m *MockUserRepository) SetDeactivated(ctx context.Context, id uuid.UUID, at *time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) PromoteAdmins(ctx context.Context, emails []string) (int64, error) {
+	args := m.Called(ctx, emails)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockUserRepository) Update(ctx context.Context, user *domain.User) error {
+	args := m.Called(ctx, user)
+	return args.Error(0)
+}
+
 // MockLLMProvider mocks llm.Provider
 type MockLLMProvider struct {
 	mock.Mock
@@ -240,3 +590,27 @@ func (m *MockMCPAdapter) ExecuteQuery(ctx context.Context, sql string, opts mcp.
 	}
 	return args.Get(0).(*mcp.QueryResult), args.Error(1)
 }
+
+func (m *MockMCPAdapter) Placeholder(n int, typ mcp.ParamType) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (m *MockMCPAdapter) ExecuteQueryWithParams(ctx context.Context, sql string, params []mcp.QueryParam, opts mcp.QueryOptions) (*mcp.QueryResult, error) {
+	args := m.Called(ctx, sql, params, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*mcp.QueryResult), args.Error(1)
+}
+
+func (m *MockMCPAdapter) ExplainQuery(ctx context.Context, sql string) (*mcp.QueryEstimate, error) {
+	args := m.Called(ctx, sql)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*mcp.QueryEstimate), args.Error(1)
+}
+
+func (m *MockMCPAdapter) PageQuery(sql string, page mcp.Page) (string, error) {
+	return mcp.LimitOffsetPage(sql, page, mcp.QuoteDouble)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultNotificationLimit is the number of notifications listed by default
+	DefaultNotificationLimit = 50
+	// MaxNotificationLimit caps the number of notifications listed per request
+	MaxNotificationLimit = 200
+)
+
+// NotificationBus carries new notifications to the replicas streaming them to their
+// users
+type NotificationBus interface {
+	Publish(ctx context.Context, notification domain.Notification) error
+	// Subscribe returns the notifications published for userID from now on. The
+	// channel is closed once ctx is done.
+	Subscribe(ctx context.Context, userID uuid.UUID) (<-chan domain.Notification, error)
+}
+
+// Notifier notifies a single user of an event
+type Notifier interface {
+	Notify(ctx context.Context, userID, workspaceID uuid.UUID, notificationType string, data any)
+}
+
+// NotificationService stores in-app notifications and pushes them to the users
+// streaming them. As a WebhookEmitter it notifies every member of a workspace of the
+// workspace events users can be notified of.
+type NotificationService struct {
+	repo domain.NotificationRepository
+	bus  NotificationBus
+	now  func() time.Time
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(repo domain.NotificationRepository, bus NotificationBus) *NotificationService {
+	return &NotificationService{repo: repo, bus: bus, now: time.Now}
+}
+
+// Emit notifies the members of a workspace of an event, unless it is not a
+// notification type. Failures are logged, as for webhooks.
+func (s *NotificationService) Emit(ctx context.Context, workspaceID uuid.UUID, event string, data any) {
+	if !domain.IsNotificationType(event) {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("type", event).Msg("failed to encode notification payload")
+		return
+	}
+	notifications, err := s.repo.CreateForWorkspace(ctx, workspaceID, event, payload)
+	if err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("type", event).Msg("failed to create notifications")
+		return
+	}
+	for _, n := range notifications {
+		s.publish(ctx, n)
+	}
+}
+
+// Notify notifies one user of an event in a workspace. Failures are logged.
+func (s *NotificationService) Notify(ctx context.Context, userID, workspaceID uuid.UUID, notificationType string, data any) {
+	ctx = context.WithoutCancel(ctx)
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("type", notificationType).Msg("failed to encode notification payload")
+		return
+	}
+	n, err := s.repo.CreateForUser(ctx, userID, &workspaceID, notificationType, payload)
+	if err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("type", notificationType).Msg("failed to create notification")
+		return
+	}
+	if n != nil {
+		s.publish(ctx, *n)
+	}
+}
+
+// publish pushes a stored notification to its user's streams; it stays in the feed
+// if that fails
+func (s *NotificationService) publish(ctx context.Context, n domain.Notification) {
+	if s.bus == nil {
+		return
+	}
+	if err := s.bus.Publish(ctx, n); err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("notification_id", n.ID.String()).Msg("failed to publish notification")
+	}
+}
+
+// List returns the user's notifications, newest first
+func (s *NotificationService) List(ctx context.Context, userID uuid.UUID, filter domain.NotificationFilter) ([]domain.Notification, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultNotificationLimit
+	}
+	filter.Limit = min(filter.Limit, MaxNotificationLimit)
+	return s.repo.ListByUser(ctx, userID, filter)
+}
+
+// MarkRead marks one of the user's notifications read
+func (s *NotificationService) MarkRead(ctx context.Context, userID, notificationID uuid.UUID) error {
+	found, err := s.repo.MarkRead(ctx, notificationID, userID, s.now())
+	if err != nil {
+		return err
+	}
+	if !found {
+		return apperr.New(apperr.NotFound, "notification not found")
+	}
+	return nil
+}
+
+// Subscribe returns the user's new notifications until ctx is done
+func (s *NotificationService) Subscribe(ctx context.Context, userID uuid.UUID) (<-chan domain.Notification, error) {
+	if s.bus == nil {
+		return nil, apperr.New(apperr.Upstream, "live notifications are not available")
+	}
+	ch, err := s.bus.Subscribe(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to notifications: %w", err)
+	}
+	return ch, nil
+}
+
+// WebhookEmitters sends each event to several emitters, such as webhooks and in-app
+// notifications
+type WebhookEmitters []WebhookEmitter
+
+// Emit sends an event to each emitter
+func (e WebhookEmitters) Emit(ctx context.Context, workspaceID uuid.UUID, event string, data any) {
+	for _, emitter := range e {
+		emitter.Emit(ctx, workspaceID, event, data)
+	}
+}
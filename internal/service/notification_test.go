@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingBus keeps the notifications published on it
+type recordingBus struct {
+	published []domain.Notification
+}
+
+func (b *recordingBus) Publish(ctx context.Context, n domain.Notification) error {
+	b.published = append(b.published, n)
+	return nil
+}
+
+func (b *recordingBus) Subscribe(ctx context.Context, userID uuid.UUID) (<-chan domain.Notification, error) {
+	return make(chan domain.Notification), nil
+}
+
+func TestNotificationService_Emit(t *testing.T) {
+	ctx := context.Background()
+	workspaceID, connectionID := uuid.New(), uuid.New()
+
+	t.Run("workspace events reach the members' feeds and streams", func(t *testing.T) {
+		repo, bus := new(MockNotificationRepository), &recordingBus{}
+		created := []domain.Notification{{ID: uuid.New(), UserID: uuid.New()}, {ID: uuid.New(), UserID: uuid.New()}}
+		repo.On("CreateForWorkspace", mock.Anything, workspaceID, domain.NotificationConnectionDegraded, mock.MatchedBy(func(payload json.RawMessage) bool {
+			return string(payload) == `{"connection_id":"`+connectionID.String()+`"}`
+		})).Return(created, nil)
+
+		NewNotificationService(repo, bus).Emit(ctx, workspaceID, domain.WebhookEventConnectionDegraded, map[string]any{"connection_id": connectionID})
+		assert.Equal(t, created, bus.published)
+	})
+
+	t.Run("events that are not notifications are ignored", func(t *testing.T) {
+		repo := new(MockNotificationRepository)
+		NewNotificationService(repo, &recordingBus{}).Emit(ctx, workspaceID, domain.WebhookEventQueryCompleted, map[string]any{})
+		repo.AssertNotCalled(t, "CreateForWorkspace", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("a failure stores nothing to publish", func(t *testing.T) {
+		repo, bus := new(MockNotificationRepository), &recordingBus{}
+		repo.On("CreateForWorkspace", mock.Anything, workspaceID, domain.NotificationSchemaDestructive, mock.Anything).
+			Return([]domain.Notification(nil), errors.New("connection refused"))
+
+		NewNotificationService(repo, bus).Emit(ctx, workspaceID, domain.WebhookEventSchemaDestructive, map[string]any{})
+		assert.Empty(t, bus.published)
+	})
+}
+
+func TestNotificationService_Notify(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+
+	t.Run("muted type", func(t *testing.T) {
+		repo, bus := new(MockNotificationRepository), &recordingBus{}
+		repo.On("CreateForUser", mock.Anything, userID, &workspaceID, domain.NotificationQuotaWarning, mock.Anything).Return(nil, nil)
+
+		NewNotificationService(repo, bus).Notify(ctx, userID, workspaceID, domain.NotificationQuotaWarning, domain.QuotaUsage{})
+		assert.Empty(t, bus.published)
+	})
+
+	t.Run("published", func(t *testing.T) {
+		repo, bus := new(MockNotificationRepository), &recordingBus{}
+		n := &domain.Notification{ID: uuid.New(), UserID: userID, Type: domain.NotificationQuotaWarning}
+		repo.On("CreateForUser", mock.Anything, userID, &workspaceID, domain.NotificationQuotaWarning, mock.Anything).Return(n, nil)
+
+		NewNotificationService(repo, bus).Notify(ctx, userID, workspaceID, domain.NotificationQuotaWarning, domain.QuotaUsage{})
+		assert.Equal(t, []domain.Notification{*n}, bus.published)
+	})
+}
+
+func TestNotificationService_ListAndMarkRead(t *testing.T) {
+	ctx := context.Background()
+	userID, notificationID := uuid.New(), uuid.New()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := new(MockNotificationRepository)
+	svc := NewNotificationService(repo, &recordingBus{})
+	svc.now = func() time.Time { return now }
+
+	repo.On("ListByUser", ctx, userID, domain.NotificationFilter{UnreadOnly: true, Limit: MaxNotificationLimit}).Return([]domain.Notification{}, nil)
+	_, err := svc.List(ctx, userID, domain.NotificationFilter{UnreadOnly: true, Limit: 1000})
+	require.NoError(t, err)
+
+	repo.On("MarkRead", ctx, notificationID, userID, now).Return(true, nil).Once()
+	require.NoError(t, svc.MarkRead(ctx, userID, notificationID))
+
+	repo.On("MarkRead", ctx, notificationID, userID, now).Return(false, nil).Once()
+	assert.Equal(t, apperr.NotFound, apperr.KindOf(svc.MarkRead(ctx, userID, notificationID)))
+}
+
+func TestWebhookEmitters(t *testing.T) {
+	first, second := &recordingEmitter{}, &recordingEmitter{}
+	data := map[string]any{"connection_id": uuid.New()}
+
+	WebhookEmitters{first, second}.Emit(context.Background(), uuid.New(), domain.WebhookEventSchemaDestructive, data)
+	for _, emitter := range []*recordingEmitter{first, second} {
+		assert.Equal(t, []string{domain.WebhookEventSchemaDestructive}, emitter.events)
+		assert.Equal(t, []map[string]any{data}, emitter.data)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"golang.org/x/oauth2"
+)
+
+// OIDCStateStore persists pending OIDC logins between redirect and callback
+type OIDCStateStore interface {
+	Save(ctx context.Context, state string, authState *domain.OIDCAuthState) error
+	Consume(ctx context.Context, state string) (*domain.OIDCAuthState, error)
+}
+
+// OIDCService handles single sign-on through an OpenID Connect provider
+type OIDCService struct {
+	provider       *security.OIDCProvider
+	stateStore     OIDCStateStore
+	authService    *AuthService
+	allowedDomains []string
+}
+
+// NewOIDCService creates a new OIDC service
+func NewOIDCService(
+	provider *security.OIDCProvider,
+	stateStore OIDCStateStore,
+	authService *AuthService,
+	allowedDomains []string,
+) *OIDCService {
+	return &OIDCService{
+		provider:       provider,
+		stateStore:     stateStore,
+		authService:    authService,
+		allowedDomains: allowedDomains,
+	}
+}
+
+// Begin starts a login and returns the provider URL to redirect to and the state
+// the caller should bind to the browser session
+func (s *OIDCService) Begin(ctx context.Context) (authURL, state string, err error) {
+	state, err = security.GenerateOIDCState()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := security.GenerateOIDCState()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	authState := &domain.OIDCAuthState{Nonce: nonce, CodeVerifier: verifier}
+	if err := s.stateStore.Save(ctx, state, authState); err != nil {
+		return "", "", fmt.Errorf("failed to save login state: %w", err)
+	}
+
+	authURL, err = s.provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// Complete exchanges the authorization code for the state issued by Begin and
+// returns tokens for the matching user
+func (s *OIDCService) Complete(ctx context.Context, state, code string) (*domain.TokenPair, error) {
+	authState, err := s.stateStore.Consume(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+	if authState == nil {
+		return nil, errors.New("invalid or expired login state")
+	}
+
+	identity, err := s.provider.Exchange(ctx, code, authState.CodeVerifier, authState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errors.New("email not verified")
+	}
+	if !emailDomainAllowed(identity.Email, s.allowedDomains) {
+		return nil, errors.New("email domain not allowed")
+	}
+
+	return s.authService.LoginExternal(ctx, domain.AuthProviderOIDC, identity.Subject, identity.Email, identity.Name)
+}
+
+// emailDomainAllowed reports whether email belongs to one of domains. An empty list allows all.
+func emailDomainAllowed(email string, domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	emailDomain := strings.ToLower(email[at+1:])
+
+	for _, d := range domains {
+		if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")) == emailDomain {
+			return true
+		}
+	}
+	return false
+}
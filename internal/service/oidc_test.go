@@ -0,0 +1,50 @@
+package service
+
+import "testing"
+
+func TestEmailDomainAllowed(t *testing.T) {
+	tests := []struct {
+		email   string
+		domains []string
+		want    bool
+	}{
+		{"jane@example.com", nil, true},
+		{"jane@example.com", []string{"example.com"}, true},
+		{"jane@Example.COM", []string{"@example.com"}, true},
+		{"jane@example.com.evil.io", []string{"example.com"}, false},
+		{"jane@sub.example.com", []string{"example.com"}, false},
+		{"not-an-email", []string{"example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		if got := emailDomainAllowed(tt.email, tt.domains); got != tt.want {
+			t.Errorf("emailDomainAllowed(%q, %v) = %v, want %v", tt.email, tt.domains, got, tt.want)
+		}
+	}
+}
+
+func TestGoogleLoginEmail(t *testing.T) {
+	domains := []string{"example.com"}
+	tests := []struct {
+		name    string
+		claims  map[string]any
+		domains []string
+		wantErr string
+	}{
+		{"any domain", map[string]any{"email": "jane@gmail.com"}, nil, ""},
+		{"allowed domain", map[string]any{"email": "jane@example.com", "email_verified": true}, domains, ""},
+		{"other domain", map[string]any{"email": "jane@gmail.com", "email_verified": true}, domains, "email domain not allowed"},
+		{"unverified", map[string]any{"email": "jane@example.com"}, domains, "google email is not verified"},
+		{"no email", map[string]any{}, nil, "email not found in google token"},
+	}
+
+	for _, tt := range tests {
+		_, err := googleLoginEmail(tt.claims, tt.domains)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
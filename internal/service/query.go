@@ -2,16 +2,53 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/Rrens/text-to-sql/internal/apperr"
 	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/lifecycle"
 	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/Rrens/text-to-sql/internal/mcp"
-	"github.com/Rrens/text-to-sql/internal/repository/postgres"
+	"github.com/Rrens/text-to-sql/internal/observability"
 	"github.com/Rrens/text-to-sql/internal/repository/redis"
+	"github.com/Rrens/text-to-sql/internal/security"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultSuggestionLimit is the number of suggested questions returned by default
+	DefaultSuggestionLimit = 5
+	// MaxSuggestionLimit caps the number of suggested questions per request
+	MaxSuggestionLimit = 20
+
+	// suggestionMinLength drops greetings and one-word messages from suggestions
+	suggestionMinLength = 8
+	// suggestionMinCount is how often a question must be asked to be suggested
+	suggestionMinCount = 2
+
+	// schemaRefreshLockTTL bounds a schema refresh, and how long other replicas wait
+	// for one before refreshing themselves
+	schemaRefreshLockTTL = time.Minute
+	// schemaRefreshPollInterval is how often a replica waiting for another one's
+	// refresh checks the cache
+	schemaRefreshPollInterval = 200 * time.Millisecond
+
+	// defaultSchemaConcurrency is how many tables are described at once when a schema
+	// is loaded, unless WithSchemaConcurrency says otherwise
+	defaultSchemaConcurrency = 8
+
+	// ruleQueryTooExpensive is the rule reported when the cost gate refuses SQL
+	ruleQueryTooExpensive = "query too expensive"
 )
 
 // QueryService handles text-to-SQL query operations
@@ -22,7 +59,35 @@ type QueryService struct {
 	schemaCache       *redis.SchemaCache
 	messageRepo       domain.MessageRepository
 	sessionRepo       domain.SessionRepository
-	userRepo          *postgres.UserRepository
+	workspaceRepo     domain.WorkspaceRepository
+	userRepo          domain.UserRepository
+	encryptor         *security.Encryptor
+	metrics           *observability.Metrics
+	idempotency       IdempotencyStore
+	webhooks          WebhookEmitter
+	connectionAlerts  *ConnectionAlerts
+	background        *lifecycle.Manager
+	llmTimeout        time.Duration                     // per SQL generation call, 0 for none
+	llmTimeouts       map[string]time.Duration          // per provider overrides of llmTimeout
+	maxEstimatedRows  int64                             // cost gate threshold for connections without one, 0 for none
+	rowDefaultLimit   int                               // rows of SQL without a LIMIT on connections without an override, 0 for the row limit
+	historyBudget     int                               // estimated tokens of session history given to the LLM
+	historyMessages   int                               // messages of session history given to the LLM
+	schemaRefresh     singleflight.Group                // schema refreshes in flight by connection ID
+	schemaRefreshing  sync.Map                          // connection IDs with a refresh in flight
+	tableUsage        domain.TableUsageRepository       // nil when table usage is not recorded
+	pages             PageStore                         // nil when results are not paged
+	schemaConcurrency int                               // tables described at once, 0 for the default
+	schemaStore       domain.ConnectionSchemaRepository // nil when schemas are only cached in Redis
+	schemaStoreTTL    time.Duration                     // schema TTL when there is no Redis cache
+	auditRepo         domain.AuditLogRepository         // nil when denied providers are not audited
+	quotas            *QuotaService                     // nil when user quotas are not enforced
+	experimentRepo    domain.ExperimentRepository       // nil when experiment results are not reported
+	schemaChanges     domain.SchemaChangeRepository     // nil when schema changes are not logged
+	tableAnnotations  domain.TableAnnotationRepository  // nil when tables cannot be annotated
+	titleQueue        chan titleJob
+	titleWorkers      sync.Once
+	titlePending      sync.Map // session IDs with a title queued or being generated
 }
 
 // NewQueryService creates a new query service
@@ -33,7 +98,9 @@ func NewQueryService(
 	schemaCache *redis.SchemaCache,
 	messageRepo domain.MessageRepository,
 	sessionRepo domain.SessionRepository,
-	userRepo *postgres.UserRepository,
+	workspaceRepo domain.WorkspaceRepository,
+	userRepo domain.UserRepository,
+	encryptor *security.Encryptor,
 ) *QueryService {
 	return &QueryService{
 		connectionService: connectionService,
@@ -42,8 +109,108 @@ func NewQueryService(
 		schemaCache:       schemaCache,
 		messageRepo:       messageRepo,
 		sessionRepo:       sessionRepo,
+		workspaceRepo:     workspaceRepo,
 		userRepo:          userRepo,
+		encryptor:         encryptor,
+		historyBudget:     DefaultHistoryTokenBudget,
+		historyMessages:   DefaultHistoryMaxMessages,
+	}
+}
+
+// WithTableUsage records the tables read by successful queries, so the most used
+// ones are kept in truncated schemas
+func (s *QueryService) WithTableUsage(repo domain.TableUsageRepository) *QueryService {
+	s.tableUsage = repo
+	return s
+}
+
+// WithMetrics records LLM calls, query executions and schema cache lookups
+func (s *QueryService) WithMetrics(metrics *observability.Metrics) *QueryService {
+	s.metrics = metrics
+	return s
+}
+
+// WithLLMTimeout bounds each SQL generation call by timeout, or by the provider's entry
+// in perProvider if it has one. Requests may override both through their options.
+func (s *QueryService) WithLLMTimeout(timeout time.Duration, perProvider map[string]time.Duration) *QueryService {
+	s.llmTimeout = timeout
+	s.llmTimeouts = perProvider
+	return s
+}
+
+// WithHistoryLimits caps the session history given to the LLM at maxMessages messages
+// and about tokens tokens, for workspaces without caps of their own. 0 keeps
+// DefaultHistoryMaxMessages and DefaultHistoryTokenBudget.
+func (s *QueryService) WithHistoryLimits(maxMessages, tokens int) *QueryService {
+	if maxMessages > 0 {
+		s.historyMessages = maxMessages
+	}
+	if tokens > 0 {
+		s.historyBudget = tokens
 	}
+	return s
+}
+
+// WithDefaultLimit limits SQL without a LIMIT of its own to defaultLimit rows on
+// connections without an override, rather than to their row limit
+func (s *QueryService) WithDefaultLimit(defaultLimit int) *QueryService {
+	s.rowDefaultLimit = defaultLimit
+	return s
+}
+
+// WithCostGate refuses generated SQL whose estimated rows exceed maxEstimatedRows,
+// unless the connection sets its own threshold or the request is forced
+func (s *QueryService) WithCostGate(maxEstimatedRows int64) *QueryService {
+	s.maxEstimatedRows = maxEstimatedRows
+	return s
+}
+
+// WithSchemaConcurrency bounds how many tables are described at once when a schema
+// is loaded from a database that cannot describe them all in one go
+func (s *QueryService) WithSchemaConcurrency(n int) *QueryService {
+	s.schemaConcurrency = n
+	return s
+}
+
+// WithSchemaStore keeps the last schema of each connection in store, read when the
+// Redis cache misses. Without a Redis cache, stored schemas are served for ttl unless
+// the connection overrides it.
+func (s *QueryService) WithSchemaStore(store domain.ConnectionSchemaRepository, ttl time.Duration) *QueryService {
+	s.schemaStore = store
+	s.schemaStoreTTL = ttl
+	return s
+}
+
+// WithLifecycle runs background work, such as session title generation, under the
+// manager so shutdown cancels and waits for it
+func (s *QueryService) WithLifecycle(background *lifecycle.Manager) *QueryService {
+	s.background = background
+	return s
+}
+
+// WithAudit records attempts to use an LLM provider the workspace does not allow
+func (s *QueryService) WithAudit(repo domain.AuditLogRepository) *QueryService {
+	s.auditRepo = repo
+	return s
+}
+
+// WithQuotas enforces the daily per-user LLM quotas of workspace settings
+func (s *QueryService) WithQuotas(quotas *QuotaService) *QueryService {
+	s.quotas = quotas
+	return s
+}
+
+// WithWebhooks notifies workspace webhooks of finished queries, failed schema refreshes
+// and destructive schema changes
+func (s *QueryService) WithWebhooks(emitter WebhookEmitter) *QueryService {
+	s.webhooks = emitter
+	return s
+}
+
+// WithConnectionAlerts counts answers towards their connection's error rate
+func (s *QueryService) WithConnectionAlerts(alerts *ConnectionAlerts) *QueryService {
+	s.connectionAlerts = alerts
+	return s
 }
 
 // ExecuteQuery processes a text-to-SQL query
@@ -51,31 +218,99 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, userID, workspaceID uui
 	requestID := uuid.New().String()
 	startTime := time.Now()
 
-	// 1. Handle Session
-	// 1. Handle Session
-	var sessionID uuid.UUID
-	var isNewSession bool
+	// The session comes first, since follow-up questions default to its connection
+	var session *domain.ChatSession
 	if req.SessionID != uuid.Nil {
-		sessionID = req.SessionID
-		// Verify session exists/belongs to user? (Optional but good)
-	} else {
-		isNewSession = true
-		// Create new session
+		var err error
+		if session, err = s.getWorkspaceSession(ctx, workspaceID, req.SessionID); err != nil {
+			return nil, err
+		}
+	}
+	if err := resolveSessionConnection(session, &req); err != nil {
+		return nil, err
+	}
+
+	// Get connection with decrypted credentials. This also checks workspace access,
+	// so nothing is written for callers without it.
+	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, req.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	// phase records the time since start as a phase of the answer
+	timings := &domain.QueryTimings{}
+	phase := func(name string, start time.Time) int64 {
+		elapsed := time.Since(start)
+		s.metrics.ObserveQueryPhase(string(conn.DatabaseType), name, elapsed)
+		return elapsed.Milliseconds()
+	}
+
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	// The user's preferences pick the provider, and their config and profile feed the LLM.
+	// Queries still run with the defaults if the user cannot be loaded.
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		user = nil
+	}
+	providerName, modelName := resolveProvider(settings, user, req, s.llmRouter.DefaultProvider())
+	if err := s.llmRouter.CheckSelection(ctx, providerName, req.LLMModel); err != nil {
+		return nil, selectionError(err)
+	}
+	// A running experiment picks the provider, model and prompt variant instead. An arm
+	// the server cannot serve is skipped rather than failing the question.
+	var assignment *domain.ExperimentAssignment
+	promptVariant := ""
+	if exp, arm, ok := experimentArm(settings, userID, req); ok {
+		if err := s.llmRouter.CheckSelection(ctx, arm.Provider, arm.Model); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("experiment", exp.Name).Str("arm", arm.Name).
+				Msg("experiment arm unavailable, answering without the experiment")
+		} else {
+			providerName, modelName = arm.Provider, arm.Model
+			promptVariant = arm.PromptVariant
+			assignment = &domain.ExperimentAssignment{Experiment: exp.Name, Arm: arm.Name}
+		}
+	}
+	if err := s.checkProvider(ctx, settings, workspaceID, userID, providerName, "query"); err != nil {
+		return nil, err
+	}
+	// Counted before anything is written, so a refused query leaves the session untouched
+	quota, err := s.quotas.Reserve(ctx, settings, workspaceID, userID, providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Resolve the session. A new one is only written together with the first turn,
+	// and none is when the turn is not persisted.
+	persist := req.Persisted()
+	sessionID := req.SessionID
+	var newSession *domain.ChatSession
+	untitled := false
+	history := []domain.Message{}
+	if sessionID == uuid.Nil && persist {
 		sessionID = uuid.New()
-		newSession := &domain.ChatSession{
-			ID:          sessionID,
-			WorkspaceID: workspaceID,
-			UserID:      &userID,
-			Title:       "New Chat", // Will be updated async
-			CreatedAt:   startTime,
-			UpdatedAt:   startTime,
+		newSession = &domain.ChatSession{
+			ID:           sessionID,
+			WorkspaceID:  workspaceID,
+			UserID:       &userID,
+			Title:        domain.DefaultSessionTitle, // Will be updated async
+			ConnectionID: &req.ConnectionID,
+			CreatedAt:    startTime,
+			UpdatedAt:    startTime,
 		}
-		if err := s.sessionRepo.Create(ctx, newSession); err != nil {
-			return nil, fmt.Errorf("failed to create session: %w", err)
+		untitled = true
+	} else if sessionID != uuid.Nil {
+		// 2. Fetch Chat History; the turns given to the LLM are picked from it
+		if messages, err := s.messageRepo.ListBySession(ctx, sessionID, historyFetchLimit); err == nil {
+			history = messages
 		}
+		// A session created empty gets its title from its first question only, so later
+		// questions do not race the title generated for the first
+		untitled = persist && session.Title == domain.DefaultSessionTitle && len(history) == 0
 	}
 
-	// 2. Save User Question
 	userMsg := &domain.Message{
 		ID:          uuid.New(),
 		WorkspaceID: workspaceID,
@@ -85,76 +320,123 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, userID, workspaceID uui
 		Content:     req.Question,
 		CreatedAt:   startTime,
 	}
-	if err := s.messageRepo.Create(ctx, userMsg); err != nil {
-		// Log error but continue execution
-		log.Error().Err(err).Msg("failed to save user message")
-	}
 
-	// 3. Fetch Chat History (last 10 messages from this session)
-	history, err := s.messageRepo.ListBySession(ctx, sessionID, 10)
-	if err != nil {
-		// log.Error().Err(err).Msg("failed to fetch chat history")
-		history = []domain.Message{}
+	// saveTurn writes the question and its answer atomically with the session update.
+	// It outlives request cancellation so a timed-out request still records its answer.
+	// Turns that are not persisted leave no trace beyond logs and metrics.
+	saveTurn := func(aiMsg *domain.Message) {
+		recordPhases(ctx, aiMsg.Metadata)
+		s.recordConnectionOutcome(ctx, conn, aiMsg)
+		if !persist {
+			return
+		}
+		turn := &domain.ConversationTurn{
+			NewSession:       newSession,
+			SessionID:        sessionID,
+			UserMessage:      userMsg,
+			AssistantMessage: aiMsg,
+			Title:            sessionTitle(req.Question),
+			ConnectionID:     &req.ConnectionID,
+			SwitchConnection: req.SwitchConnection,
+		}
+		if err := s.messageRepo.CreateConversationTurn(context.WithoutCancel(ctx), turn); err != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("session_id", sessionID.String()).Msg("failed to save conversation turn")
+		}
+		s.recordTableUsage(ctx, req.ConnectionID, aiMsg)
+		s.emitQueryCompleted(ctx, workspaceID, req.ConnectionID, userMsg, aiMsg)
 	}
 
-	// Get connection with decrypted credentials
-	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, req.ConnectionID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get connection: %w", err)
+	// promptTemplate and promptBreakdown are set once the prompt is built
+	promptTemplate := ""
+	var promptBreakdown *domain.PromptBreakdown
+
+	// fail records an error answer so the session never holds an unanswered question.
+	// Execution timeouts are answers, so a timeout here happened during generation.
+	fail := func(status domain.QueryStatus, err error) (*domain.QueryResponse, error) {
+		latency := time.Since(startTime).Milliseconds()
+		timeoutPhase := ""
+		if status == domain.QueryStatusTimeout {
+			timeoutPhase = domain.TimeoutPhaseGeneration
+		}
+		saveTurn(&domain.Message{
+			ID:          uuid.New(),
+			WorkspaceID: workspaceID,
+			SessionID:   &sessionID,
+			Role:        domain.RoleAssistant,
+			Content:     fmt.Sprintf("I encountered an error: %s", err),
+			Metadata: &domain.QueryMetadata{
+				ConnectionID:    req.ConnectionID,
+				DatabaseType:    string(conn.DatabaseType),
+				LLMProvider:     providerName,
+				LLMModel:        modelName,
+				ExecutionTimeMs: latency,
+				TimeoutPhase:    timeoutPhase,
+				Timings:         timings,
+				PromptTemplate:  promptTemplate,
+				PromptBreakdown: promptBreakdown,
+				Experiment:      assignment,
+			},
+			Error:     err.Error(),
+			Status:    status,
+			LatencyMs: &latency,
+			CreatedAt: time.Now(),
+		})
+		return nil, err
 	}
 
 	// ... (Get MCP Adapter logic remains same)
 	// Get or create MCP adapter
-	mcpConfig := mcp.ConnectionConfig{
-		Host:           conn.Host,
-		Port:           conn.Port,
-		Database:       conn.Database,
-		Username:       conn.Username,
-		Password:       password,
-		SSLMode:        conn.SSLMode,
-		MaxRows:        conn.MaxRows,
-		TimeoutSeconds: conn.TimeoutSeconds,
-	}
-
-	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), mcpConfig)
+	mcpConfig := adapterConfig(conn, password)
+
+	schemaCtx, schemaSpan := observability.StartSpan(ctx, "query.schema_load",
+		attribute.String("db.system", string(conn.DatabaseType)),
+		attribute.String("connection_id", conn.ID.String()),
+	)
+	connectStart := time.Now()
+	adapter, err := s.mcpRouter.GetAdapter(schemaCtx, conn.ID, string(conn.DatabaseType), mcpConfig)
+	timings.ConnectMs = phase("connect", connectStart)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get database adapter: %w", err)
+		observability.EndSpan(schemaSpan, err)
+		return fail(domain.QueryStatusSQLError, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to get database adapter: %w", err)))
 	}
 
 	// Get schema (from cache or refresh)
-	schema, err := s.getSchema(ctx, conn.ID, adapter)
+	schemaStart := time.Now()
+	schema, err := s.getSchema(schemaCtx, conn, adapter)
+	timings.SchemaMs = phase("schema", schemaStart)
+	observability.EndSpan(schemaSpan, err)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get schema: %w", err)
+		return fail(domain.QueryStatusSQLError, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to get schema: %w", err)))
 	}
+	timings.SchemaSource = schema.Source
+	timings.SchemaCacheHit = schema.Source != domain.SchemaSourceLive
+	promptStart := time.Now()
 
 	// Get LLM provider
-	providerName := req.LLMProvider
-	if providerName == "" {
-		providerName = s.llmRouter.DefaultProvider()
-	}
-
 	// Fetch user config for LLM
 	var llmConfig map[string]any
-	user, err := s.userRepo.GetByID(ctx, userID)
-	if err == nil && user != nil && user.LLMConfig != nil {
-		if config, ok := user.LLMConfig[providerName].(map[string]any); ok {
-			llmConfig = config
-		}
+	if user != nil {
+		llmConfig = s.providerConfig(user, providerName)
 	}
 
 	provider, err := s.llmRouter.GetProviderWithConfig(providerName, llmConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get LLM provider: %w", err)
+		return fail(domain.QueryStatusLLMError, apperr.Wrap(apperr.Validation, fmt.Errorf("failed to get LLM provider: %w", err)))
 	}
 
 	// Generate SQL
+	promptHistory, historyDropped := selectHistory(history, historyMode(req.Options), s.historyLimits(settings))
 	llmReq := llm.Request{
-		Question:     req.Question,
-		SchemaDDL:    schema.DDL,
-		SQLDialect:   adapter.SQLDialect(),
-		DatabaseType: adapter.DatabaseType(),
-		History:      history, // Pass history to LLM
+		Question:          req.Question,
+		SchemaDDL:         schema.DDL,
+		UndescribedTables: schema.WarningTables(),
+		SQLDialect:        adapter.SQLDialect(),
+		DatabaseType:      adapter.DatabaseType(),
+		History:           promptHistory,
+		PromptVariant:     promptVariant,
 	}
+	// The model is told the default limit so it does not add a larger one
+	llmReq.DefaultLimit, _ = s.executionOptions(conn, settings, req.Options).RowLimit(false)
 
 	// Add user profile context if available
 	if user != nil {
@@ -164,28 +446,72 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, userID, workspaceID uui
 		}
 		llmReq.UserContext = userCtx
 	}
+	promptTemplate = llm.PromptVersion(llmReq)
+	breakdown := llm.MeasurePrompt(llmReq)
+	breakdown.HistoryMessages, breakdown.HistoryDropped = len(promptHistory), historyDropped
+	promptBreakdown = &breakdown
+	s.metrics.ObservePrompt(string(conn.DatabaseType), breakdown)
 
 	// DEBUG: Log schema DDL length
-	log.Debug().
+	logging.FromContext(ctx).Debug().Ctx(ctx).
 		Int("schema_ddl_length", len(schema.DDL)).
 		Str("question", req.Question).
 		Msg("Preparing LLM request")
 
-	modelName := req.LLMModel
 	if modelName == "" {
 		modelName = provider.DefaultModel()
 	}
 
-	// llmStart := time.Now()
-	llmResp, err := provider.GenerateSQL(ctx, llmReq, modelName)
+	timings.PromptMs = phase("prompt", promptStart)
+	// The generation timeout starts once the provider has a slot for the request
+	queueStart := time.Now()
+	releaseLLM, err := s.acquireLLM(ctx, workspaceID, providerName)
+	timings.LLMQueueMs = phase("llm_queue", queueStart)
+	if err != nil {
+		return fail(domain.QueryStatusLLMError, err)
+	}
+	// Released again right after generation; the deferred call frees the slot if the
+	// provider panics, and is a no-op otherwise
+	defer releaseLLM()
+
+	llmCtx, llmSpan := observability.StartSpan(ctx, "query.llm_generate",
+		attribute.String("gen_ai.system", providerName),
+		attribute.String("gen_ai.request.model", modelName),
+	)
+	llmTimeout := s.generationTimeout(providerName, req.Options)
+	genCtx, cancelGen := context.WithCancel(llmCtx)
+	if llmTimeout > 0 {
+		genCtx, cancelGen = context.WithTimeout(llmCtx, llmTimeout)
+	}
+	llmStart := time.Now()
+	llmResp, err := provider.GenerateSQL(genCtx, llmReq, modelName)
+	releaseLLM()
+	timings.LLMMs = phase("llm", llmStart)
+	// Providers wrap deadline errors differently, so the context tells whether it expired
+	genTimedOut := err != nil && errors.Is(genCtx.Err(), context.DeadlineExceeded)
+	cancelGen()
+	tokens := 0
+	if llmResp != nil {
+		tokens = llmResp.TokensUsed
+	}
+	llmSpan.SetAttributes(attribute.Int("gen_ai.usage.total_tokens", tokens))
+	observability.EndSpan(llmSpan, err)
+	quota.AddTokens(ctx, tokens)
+	s.metrics.ObserveLLMCall(providerName, modelName, time.Since(llmStart), tokens, err)
+	if genTimedOut {
+		return fail(domain.QueryStatusTimeout, apperr.Newf(apperr.Timeout, "SQL generation timed out after %s", llmTimeout))
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate SQL: %w", err)
+		return fail(domain.QueryStatusLLMError, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to generate SQL: %w", err)))
+	}
+	if extract := queryExtractor(adapter.DatabaseType()); extract != nil {
+		llmResp.SQL = extract(llmResp.Content)
 	}
 	// Calculate total execution time
 	// executionTime := time.Since(startTime).Milliseconds()
 
 	// DEBUG: Log LLM response
-	log.Debug().
+	logging.FromContext(ctx).Debug().Ctx(ctx).
 		Str("sql", llmResp.SQL).
 		Str("explanation", llmResp.Explanation).
 		Int("tokens_used", llmResp.TokensUsed).
@@ -205,44 +531,83 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, userID, workspaceID uui
 			ExecutionTimeMs: time.Since(startTime).Milliseconds(),
 			LLMLatencyMs:    llmResp.LatencyMs,
 			TokensUsed:      llmResp.TokensUsed,
+			Timings:         timings,
+			PromptTemplate:  promptTemplate,
+			PromptBreakdown: promptBreakdown,
+			Experiment:      assignment,
 		},
 	}
 
 	// 3. Execute query if requested
+	status := domain.QueryStatusOK
+	var rowCount *int
 	if req.Execute && llmResp.SQL != "" {
-		maxRows := conn.MaxRows
-		timeout := time.Duration(conn.TimeoutSeconds) * time.Second
-
-		if req.Options != nil {
-			if req.Options.MaxRows > 0 && req.Options.MaxRows < maxRows {
-				maxRows = req.Options.MaxRows
+		queryOpts := s.executionOptions(conn, settings, req.Options)
+
+		execCtx, execSpan := observability.StartSpan(ctx, "query.execute",
+			attribute.String("db.system", string(conn.DatabaseType)),
+			attribute.Int("max_rows", queryOpts.MaxRows),
+		)
+
+		// Validated up front so rejections are told apart from database errors
+		validationStart := time.Now()
+		validationErr := adapter.ValidateQuery(llmResp.SQL)
+		var costErr error
+		if validationErr == nil {
+			costErr = s.checkQueryCost(execCtx, conn, adapter, llmResp.SQL, req.Force, queryOpts.Timeout, response.Metadata)
+		}
+		timings.ValidationMs = phase("validation", validationStart)
+		if validationErr != nil {
+			response.Error = validationErr.Error()
+			var blocked *mcp.ValidationError
+			if errors.As(validationErr, &blocked) {
+				response.ErrorDetail = &domain.BlockedQuery{Rule: blocked.Rule, Matched: blocked.Matched, Position: blocked.Position}
 			}
-			if req.Options.TimeoutSeconds > 0 {
-				timeout = time.Duration(req.Options.TimeoutSeconds) * time.Second
+			status = domain.QueryStatusBlocked
+			s.metrics.ObserveQueryBlocked(string(conn.DatabaseType))
+		} else if costErr != nil {
+			response.Error = costErr.Error()
+			response.ErrorDetail = &domain.BlockedQuery{Rule: ruleQueryTooExpensive}
+			status = domain.QueryStatusBlocked
+			s.metrics.ObserveQueryBlocked(string(conn.DatabaseType))
+		} else {
+			queryStart := time.Now()
+			result, err := adapter.ExecuteQuery(execCtx, llmResp.SQL, queryOpts)
+			timings.ExecutionMs = phase("execution", queryStart)
+			if err != nil {
+				response.Error = err.Error()
+				status = executionStatus(err)
+				if status == domain.QueryStatusTimeout {
+					response.Metadata.TimeoutPhase = domain.TimeoutPhaseExecution
+				}
+			} else {
+				serializeStart := time.Now()
+				response.Result = &domain.QueryResult{
+					Columns:             result.Columns,
+					Rows:                result.Rows,
+					RowCount:            result.RowCount,
+					Truncated:           result.Truncated,
+					DefaultLimitApplied: result.DefaultLimitApplied,
+				}
+				rowCount = &result.RowCount
+				response.NextPageToken = s.firstPageToken(execCtx, adapter, userID, workspaceID, conn.ID, llmResp.SQL, result)
+				timings.SerializationMs = phase("serialization", serializeStart)
 			}
+			s.metrics.ObserveQuery(string(conn.DatabaseType), status, time.Since(queryStart), response.Result)
 		}
 
-		queryOpts := mcp.QueryOptions{
-			MaxRows: maxRows,
-			Timeout: timeout,
-		}
-
-		result, err := adapter.ExecuteQuery(ctx, llmResp.SQL, queryOpts)
-		if err != nil {
-			response.Error = err.Error()
-		} else {
-			response.Result = &domain.QueryResult{
-				Columns:   result.Columns,
-				Rows:      result.Rows,
-				RowCount:  result.RowCount,
-				Truncated: result.Truncated,
-			}
+		execSpan.SetAttributes(attribute.String("query.status", string(status)))
+		var execErr error
+		if response.Error != "" {
+			execErr = errors.New(response.Error)
 		}
+		observability.EndSpan(execSpan, execErr)
 	}
 
-	response.Metadata.ExecutionTimeMs = time.Since(startTime).Milliseconds()
+	latency := time.Since(startTime).Milliseconds()
+	response.Metadata.ExecutionTimeMs = latency
 
-	// 4. Save Assistant Response (now with full context)
+	// 4. Save the turn with the assistant response
 	// Ensure content is not empty
 	content := llmResp.Explanation
 	if content == "" {
@@ -262,62 +627,454 @@ func (s *QueryService) ExecuteQuery(ctx context.Context, userID, workspaceID uui
 		SQL:         llmResp.SQL,
 		Result:      response.Result,
 		Metadata:    response.Metadata,
+		Error:       response.Error,
+		Status:      status,
+		RowCount:    rowCount,
+		LatencyMs:   &latency,
 		CreatedAt:   time.Now(),
 	}
-	if err := s.messageRepo.Create(ctx, aiMsg); err != nil {
-		log.Error().Err(err).Msg("failed to save AI message")
-	}
-
-	// Update session timestamp
-	// Optimization: could be async
-	// I'll make a specialized UpdateTimestamp method.
-	// Or I'll just ignore for now and let it be created_at based.
-	// Actually, having updated_at for sorting sessions is important.
-	// Let's quickly fetch and update.
-	if sess, err := s.sessionRepo.Get(ctx, sessionID); err == nil {
-		sess.UpdatedAt = time.Now()
-		// Auto-update title if it's "New Chat" and we have a question
-		if sess.Title == "New Chat" {
-			if len(req.Question) > 30 {
-				sess.Title = req.Question[:30] + "..."
-			} else {
-				sess.Title = req.Question
-			}
+	saveTurn(aiMsg)
+
+	// 5. Replace the provisional title with a generated one (async)
+	if untitled {
+		s.enqueueSessionTitle(titleJob{
+			sessionID: sessionID,
+			question:  req.Question,
+			provider:  providerName,
+			model:     modelName,
+		})
+	}
+
+	return response, nil
+}
+
+// schemaCacheTTL returns how long a connection's schema is cached: the connection's
+// override if it has one, otherwise the cache default
+func (s *QueryService) schemaCacheTTL(conn *domain.Connection) time.Duration {
+	if s.schemaCache == nil && s.schemaStore == nil {
+		return 0
+	}
+	if conn.SchemaCacheTTLSeconds != nil {
+		return time.Duration(*conn.SchemaCacheTTLSeconds) * time.Second
+	}
+	if s.schemaCache == nil {
+		return s.schemaStoreTTL
+	}
+	return s.schemaCache.TTL()
+}
+
+// executionOptions limits rows and time of a query run on conn: the connection's limits,
+// lowered by the workspace's row limit and the request's options. SQL without a LIMIT
+// returns the request's, the connection's or the server's default limit of rows.
+func (s *QueryService) executionOptions(conn *domain.Connection, settings domain.WorkspaceSettings, opts *domain.QueryOptions) mcp.QueryOptions {
+	maxRows := conn.MaxRows
+	if settings.MaxRows > 0 && settings.MaxRows < maxRows {
+		maxRows = settings.MaxRows
+	}
+	timeout := time.Duration(conn.TimeoutSeconds) * time.Second
+
+	if opts != nil {
+		if opts.MaxRows > 0 && opts.MaxRows < maxRows {
+			maxRows = opts.MaxRows
+		}
+		if opts.TimeoutSeconds > 0 {
+			timeout = time.Duration(opts.TimeoutSeconds) * time.Second
 		}
-		s.sessionRepo.Update(ctx, sess)
 	}
+	return mcp.QueryOptions{MaxRows: maxRows, DefaultLimit: s.defaultLimit(conn, opts), Timeout: timeout}
+}
 
-	// Trigger async title	// 4. Update session title if needed (async)
-	if isNewSession {
-		go s.generateSessionTitle(context.Background(), sessionID, req.Question, providerName, modelName)
+// defaultLimit returns how many rows SQL without a LIMIT returns on conn: the request's
+// default if it sets one, otherwise the connection's override or the server default.
+// 0 means the row limit.
+func (s *QueryService) defaultLimit(conn *domain.Connection, opts *domain.QueryOptions) int {
+	if opts != nil && opts.DefaultLimit > 0 {
+		return opts.DefaultLimit
+	}
+	if conn.DefaultLimit != nil {
+		return *conn.DefaultLimit
 	}
+	return s.rowDefaultLimit
+}
 
-	return response, nil
+// costLimit returns a connection's cost gate threshold in estimated rows: the
+// connection's override if it has one, otherwise the server default
+func (s *QueryService) costLimit(conn *domain.Connection) int64 {
+	if conn.MaxEstimatedRows != nil {
+		return *conn.MaxEstimatedRows
+	}
+	return s.maxEstimatedRows
 }
 
-// getSchema retrieves schema from cache or database
-func (s *QueryService) getSchema(ctx context.Context, connectionID uuid.UUID, adapter mcp.Adapter) (*domain.SchemaInfo, error) {
-	// Try cache first
+// checkQueryCost asks the planner for an estimate when the connection has a cost
+// threshold and records it in meta. It returns an error when the estimate exceeds the
+// threshold and the request is not forced. SQL that cannot be estimated is let through.
+func (s *QueryService) checkQueryCost(ctx context.Context, conn *domain.Connection, adapter mcp.Adapter, sql string, force bool, timeout time.Duration, meta *domain.QueryMetadata) error {
+	limit := s.costLimit(conn)
+	explainer, ok := adapter.(mcp.Explainer)
+	if limit <= 0 || !ok {
+		return nil
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	estimate, err := explainer.ExplainQuery(ctx, sql)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).
+			Str("connection_id", conn.ID.String()).
+			Msg("Failed to estimate query cost, running it unchecked")
+		return nil
+	}
+
+	meta.CostEstimate = &domain.CostEstimate{
+		EstimatedRows: estimate.Rows,
+		EstimatedCost: estimate.Cost,
+		MaxRows:       limit,
+		Decision:      domain.CostDecisionAllowed,
+	}
+	switch {
+	case estimate.Rows <= float64(limit):
+		return nil
+	case force:
+		meta.CostEstimate.Decision = domain.CostDecisionForced
+		return nil
+	}
+	meta.CostEstimate.Decision = domain.CostDecisionRefused
+	return fmt.Errorf("%s: estimated %.0f rows exceeds the limit of %d; resend with force to run it anyway",
+		ruleQueryTooExpensive, estimate.Rows, limit)
+}
+
+// getSchema retrieves schema from Redis, then from the stored copy, then from the
+// database, filling the faster layers on the way back. Concurrent refreshes of a
+// connection are collapsed into one: within the process by a single-flight group, and
+// across replicas by a Redis lock. Callers that find a refresh running get the stale
+// schema if there is one, otherwise they wait for the result.
+func (s *QueryService) getSchema(ctx context.Context, conn *domain.Connection, adapter mcp.Adapter) (*domain.SchemaInfo, error) {
+	ttl := s.schemaCacheTTL(conn)
+
+	// Try the caches first
+	var stale *domain.SchemaInfo
+	if ttl > 0 {
+		cached, fresh := s.cachedSchema(ctx, conn, ttl)
+		s.metrics.ObserveSchemaCache(fresh)
+		if fresh {
+			return cached, nil
+		}
+		stale = cached
+	}
+
+	key := conn.ID.String()
+	if _, refreshing := s.schemaRefreshing.Load(key); refreshing && stale != nil {
+		s.metrics.ObserveSchemaRefreshSuppressed("stale")
+		return stale, nil
+	}
+
+	leader := false
+	schema, err, _ := s.schemaRefresh.Do(key, func() (any, error) {
+		leader = true
+		s.schemaRefreshing.Store(key, struct{}{})
+		defer s.schemaRefreshing.Delete(key)
+
+		// Waiters share the result, so the leader going away must not cancel it
+		refreshCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), schemaRefreshLockTTL)
+		defer cancel()
+		return s.refreshSchemaLocked(refreshCtx, conn, adapter, ttl, stale)
+	})
+	if !leader {
+		s.metrics.ObserveSchemaRefreshSuppressed("shared")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return schema.(*domain.SchemaInfo), nil
+}
+
+// cachedSchema looks a connection's schema up in Redis, then in the schema store,
+// copying a fresh stored schema into Redis. It returns the newest schema found and
+// whether it is fresh; a stale one can still be served while a refresh runs.
+func (s *QueryService) cachedSchema(ctx context.Context, conn *domain.Connection, ttl time.Duration) (*domain.SchemaInfo, bool) {
+	var stale *domain.SchemaInfo
 	if s.schemaCache != nil {
-		cached, err := s.schemaCache.Get(ctx, connectionID)
+		cached, err := s.schemaCache.Get(ctx, conn.WorkspaceID, conn.ID)
 		if err == nil && cached != nil {
-			return cached, nil
+			cached.Source = domain.SchemaSourceRedis
+			if !cached.Stale(time.Now()) {
+				return cached, true
+			}
+			stale = cached
+		}
+	}
+	if s.schemaStore == nil {
+		return stale, false
+	}
+
+	stored, err := s.schemaStore.Get(ctx, conn.ID)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to read stored schema")
+		return stale, false
+	}
+	if stored == nil {
+		return stale, false
+	}
+	// The TTL in force now decides, not the one the schema was stored under
+	stored.Source = domain.SchemaSourcePostgres
+	stored.CacheTTLSeconds = int(ttl / time.Second)
+	if !stored.Stale(time.Now()) {
+		if s.schemaCache != nil {
+			s.schemaCache.Set(ctx, conn.WorkspaceID, conn.ID, stored, time.Until(stored.CachedAt.Add(ttl)))
 		}
+		return stored, true
 	}
+	if stale == nil || stored.CachedAt.After(stale.CachedAt) {
+		stale = stored
+	}
+	return stale, false
+}
 
-	// Get from database
-	tables, err := adapter.ListTables(ctx)
+// refreshSchemaLocked reloads and caches a schema while holding the connection's
+// refresh lock. If another replica holds it, the stale schema is served or the other
+// replica's result awaited; the schema is only reloaded here if that never arrives.
+func (s *QueryService) refreshSchemaLocked(ctx context.Context, conn *domain.Connection, adapter mcp.Adapter, ttl time.Duration, stale *domain.SchemaInfo) (*domain.SchemaInfo, error) {
+	if ttl > 0 && s.schemaCache != nil {
+		unlock, locked, err := s.schemaCache.LockRefresh(ctx, conn.ID, schemaRefreshLockTTL)
+		switch {
+		case err != nil:
+			// Refreshing without the lock is still correct, only wasteful
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("schema refresh lock unavailable")
+		case locked:
+			defer unlock()
+			// Another replica may have finished a refresh since the cache was read
+			if cached, err := s.schemaCache.Get(ctx, conn.WorkspaceID, conn.ID); err == nil && cached != nil && !cached.Stale(time.Now()) {
+				s.metrics.ObserveSchemaRefreshSuppressed("remote")
+				return cached, nil
+			}
+		case stale != nil:
+			s.metrics.ObserveSchemaRefreshSuppressed("stale")
+			return stale, nil
+		default:
+			if schema := s.waitForSchema(ctx, conn); schema != nil {
+				s.metrics.ObserveSchemaRefreshSuppressed("remote")
+				return schema, nil
+			}
+		}
+	}
+
+	schema, err := s.loadSchema(ctx, adapter, s.schemaOptions(ctx, conn))
 	if err != nil {
-		return nil, fmt.Errorf("failed to list tables: %w", err)
+		return nil, err
+	}
+	schema.CacheTTLSeconds = int(ttl / time.Second)
+	schema.Hash = schema.ContentHash()
+	schema.Source = domain.SchemaSourceLive
+	domain.ClassifyTables(schema.Tables)
+	if len(schema.Warnings) > 0 {
+		s.metrics.ObserveSchemaDescribeFailures(conn.ID.String(), schema.DatabaseType, len(schema.Warnings))
+		logging.FromContext(ctx).Warn().Ctx(ctx).
+			Str("connection_id", conn.ID.String()).
+			Int("count", len(schema.Warnings)).
+			Strs("tables", schema.WarningTables()).
+			Msg("tables could not be described")
+	}
+	if stale != nil && stale.Hash != "" && stale.Hash != schema.Hash {
+		logging.FromContext(ctx).Info().Ctx(ctx).Str("connection_id", conn.ID.String()).Msg("schema changed")
+		s.recordSchemaChange(ctx, conn.WorkspaceID, conn.ID, stale, schema)
+	}
+
+	// Cache the schema; a zero TTL drops any entry cached before the override
+	if s.schemaCache != nil {
+		s.schemaCache.Set(ctx, conn.WorkspaceID, conn.ID, schema, ttl)
+	}
+	if s.schemaStore != nil && ttl > 0 {
+		if err := s.schemaStore.Save(ctx, conn.ID, schema); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to store schema")
+		}
+	}
+	return schema, nil
+}
+
+// waitForSchema polls the cache while another replica refreshes a schema. It returns
+// nil if that replica gives up the lock without caching a fresh schema.
+func (s *QueryService) waitForSchema(ctx context.Context, conn *domain.Connection) *domain.SchemaInfo {
+	ticker := time.NewTicker(schemaRefreshPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		cached, err := s.schemaCache.Get(ctx, conn.WorkspaceID, conn.ID)
+		if err == nil && cached != nil && !cached.Stale(time.Now()) {
+			return cached
+		}
+		if locked, err := s.schemaCache.RefreshLocked(ctx, conn.ID); err != nil || !locked {
+			return nil
+		}
+	}
+}
+
+const (
+	// recentSchemaQueries is how many recent answers decide the recently queried tables
+	recentSchemaQueries = 50
+	// pinnedSchemaTables is how many of the most queried tables lead the schema
+	pinnedSchemaTables = 5
+)
+
+// schemaOptions returns how the schema DDL of a connection is ordered. Failing to read
+// the table usage or recent queries only loses the priority of their tables.
+func (s *QueryService) schemaOptions(ctx context.Context, conn *domain.Connection) mcp.SchemaOptions {
+	opts := mcp.SchemaOptions{Order: mcp.SchemaOrder(conn.SchemaOrder)}
+	if opts.Order == mcp.SchemaOrderAlphabetical {
+		return opts
+	}
+
+	if s.tableUsage != nil {
+		usage, err := s.tableUsage.ListTop(ctx, conn.ID, pinnedSchemaTables)
+		if err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to list table usage for schema order")
+		}
+		for _, u := range usage {
+			opts.PinnedTables = append(opts.PinnedTables, u.TableName)
+		}
+	}
+	if opts.Order != mcp.SchemaOrderRecent {
+		return opts
+	}
+
+	queries, err := s.messageRepo.ListRecentSQL(ctx, conn.WorkspaceID, conn.ID, recentSchemaQueries)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", conn.ID.String()).Msg("failed to list recent queries for schema order")
+		return opts
+	}
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		for _, table := range referencedTables(q) {
+			if !seen[table] {
+				seen[table] = true
+				opts.RecentTables = append(opts.RecentTables, table)
+			}
+		}
+	}
+	return opts
+}
+
+// recordPhases hands the timings of an answer to the request logger, which reports
+// them when the request turns out to be slow
+func recordPhases(ctx context.Context, meta *domain.QueryMetadata) {
+	if meta == nil {
+		return
+	}
+	logging.SetPhase(ctx, "total_ms", meta.ExecutionTimeMs)
+	if meta.LLMLatencyMs > 0 {
+		logging.SetPhase(ctx, "llm_ms", meta.LLMLatencyMs)
+	}
+	if t := meta.Timings; t != nil {
+		for name, ms := range map[string]int64{
+			"connect_ms":    t.ConnectMs,
+			"schema_ms":     t.SchemaMs,
+			"validation_ms": t.ValidationMs,
+			"execution_ms":  t.ExecutionMs,
+		} {
+			if ms > 0 {
+				logging.SetPhase(ctx, name, ms)
+			}
+		}
+	}
+}
+
+// recordTableUsage counts the tables read by a successful answer. Usage is only a
+// ranking hint, so failures are logged.
+func (s *QueryService) recordTableUsage(ctx context.Context, connectionID uuid.UUID, answer *domain.Message) {
+	if s.tableUsage == nil || answer.Status != domain.QueryStatusOK || answer.Result == nil {
+		return
+	}
+	tables := referencedTables(answer.SQL)
+	if len(tables) == 0 {
+		return
+	}
+	if err := s.tableUsage.Record(context.WithoutCancel(ctx), connectionID, tables, answer.CreatedAt); err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to record table usage")
+	}
+}
+
+// historyMode returns the history mode requested in opts
+func historyMode(opts *domain.QueryOptions) string {
+	if opts == nil || opts.History == "" {
+		return domain.HistorySuccessful
+	}
+	return opts.History
+}
+
+// recordConnectionOutcome counts an answer towards its connection's error rate. Only
+// answers that reached the database count: generation failures and SQL that was not
+// run say nothing about the connection.
+func (s *QueryService) recordConnectionOutcome(ctx context.Context, conn *domain.Connection, answer *domain.Message) {
+	switch answer.Status {
+	case domain.QueryStatusOK:
+		if answer.RowCount != nil {
+			s.connectionAlerts.Record(ctx, conn, nil)
+		}
+	case domain.QueryStatusSQLError:
+		s.connectionAlerts.Record(ctx, conn, errors.New(answer.Error))
+	case domain.QueryStatusTimeout:
+		if answer.Metadata != nil && answer.Metadata.TimeoutPhase == domain.TimeoutPhaseExecution {
+			s.connectionAlerts.Record(ctx, conn, errors.New(answer.Error))
+		}
+	}
+}
+
+// PopularTables returns the tables most read by successful queries on a connection
+func (s *QueryService) PopularTables(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, limit int) ([]domain.TableUsage, error) {
+	if _, err := s.connectionService.GetByID(ctx, userID, workspaceID, connectionID); err != nil {
+		return nil, err
+	}
+	if s.tableUsage == nil {
+		return []domain.TableUsage{}, nil
 	}
+	return s.tableUsage.ListTop(ctx, connectionID, limit)
+}
+
+// loadSchema reads the tables, columns and DDL of a database. Tables are described
+// in one go by adapters that can, otherwise concurrently; tables that cannot be
+// described are left out and reported in the schema's warnings. Adapters that can
+// order their DDL do so following opts.
+func (s *QueryService) loadSchema(ctx context.Context, adapter mcp.Adapter, opts mcp.SchemaOptions) (*domain.SchemaInfo, error) {
+	dbType := adapter.DatabaseType()
+	start := time.Now()
+
+	var described []mcp.TableInfo
+	warnings := []domain.SchemaWarning{}
+	var listTime, describeTime time.Duration
+	if describer, ok := adapter.(mcp.SchemaDescriber); ok {
+		tables, err := describer.DescribeTables(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe tables: %w", err)
+		}
+		described = tables
+		describeTime = time.Since(start)
+	} else {
+		tables, err := adapter.ListTables(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		listTime = time.Since(start)
+		s.metrics.ObserveSchemaLoad(dbType, "list", listTime)
 
-	var tableInfos []domain.TableInfo
-	for _, tableName := range tables {
-		tableInfo, err := adapter.DescribeTable(ctx, tableName)
+		describeStart := time.Now()
+		described, warnings, err = s.describeTables(ctx, adapter, tables)
 		if err != nil {
-			continue // Skip tables we can't describe
+			return nil, err
 		}
+		describeTime = time.Since(describeStart)
+	}
+	s.metrics.ObserveSchemaLoad(dbType, "describe", describeTime)
 
+	tableInfos := make([]domain.TableInfo, 0, len(described))
+	for _, tableInfo := range described {
 		columns := make([]domain.ColumnInfo, len(tableInfo.Columns))
 		for i, col := range tableInfo.Columns {
 			columns[i] = domain.ColumnInfo{
@@ -329,41 +1086,160 @@ func (s *QueryService) getSchema(ctx context.Context, connectionID uuid.UUID, ad
 			}
 		}
 
+		var indexes []domain.IndexInfo
+		for _, idx := range tableInfo.Indexes {
+			indexes = append(indexes, domain.IndexInfo{Name: idx.Name, Columns: idx.Columns, Unique: idx.Unique})
+		}
+
 		tableInfos = append(tableInfos, domain.TableInfo{
 			Name:       tableInfo.Name,
 			SchemaName: tableInfo.SchemaName,
 			Columns:    columns,
 			RowCount:   tableInfo.RowCount,
+			Indexes:    indexes,
 		})
 	}
 
-	ddl, err := adapter.GetSchemaDDL(ctx)
+	ddlStart := time.Now()
+	var ddl string
+	var err error
+	if orderer, ok := adapter.(mcp.SchemaOrderer); ok {
+		ddl, err = orderer.OrderedSchemaDDL(ctx, opts)
+	} else {
+		ddl, err = adapter.GetSchemaDDL(ctx)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get DDL: %w", err)
 	}
-
-	schema := &domain.SchemaInfo{
-		DatabaseType: adapter.DatabaseType(),
+	ddlTime := time.Since(ddlStart)
+	s.metrics.ObserveSchemaLoad(dbType, "ddl", ddlTime)
+
+	logging.SetPhase(ctx, "schema_ms", time.Since(start).Milliseconds())
+	logging.FromContext(ctx).Debug().Ctx(ctx).
+		Str("database_type", dbType).
+		Int("tables", len(tableInfos)).
+		Int("warnings", len(warnings)).
+		Int64("list_ms", listTime.Milliseconds()).
+		Int64("describe_ms", describeTime.Milliseconds()).
+		Int64("ddl_ms", ddlTime.Milliseconds()).
+		Msg("schema loaded")
+
+	return &domain.SchemaInfo{
+		DatabaseType: dbType,
 		Tables:       tableInfos,
 		DDL:          ddl,
 		CachedAt:     time.Now(),
+		Warnings:     warnings,
+	}, nil
+}
+
+// describeTables describes tables concurrently, keeping their order. Tables that
+// cannot be described are left out and reported as warnings; only the context ending
+// fails the whole load.
+func (s *QueryService) describeTables(ctx context.Context, adapter mcp.Adapter, tables []string) ([]mcp.TableInfo, []domain.SchemaWarning, error) {
+	concurrency := s.schemaConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultSchemaConcurrency
 	}
 
-	// Cache the schema
-	if s.schemaCache != nil {
-		s.schemaCache.Set(ctx, connectionID, schema)
+	infos := make([]*mcp.TableInfo, len(tables))
+	errs := make([]error, len(tables))
+	var g errgroup.Group
+	g.SetLimit(concurrency)
+	for i, table := range tables {
+		g.Go(func() error {
+			if ctx.Err() != nil {
+				return nil
+			}
+			infos[i], errs[i] = adapter.DescribeTable(ctx, table)
+			return nil
+		})
+	}
+	g.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to describe tables: %w", err)
 	}
 
-	return schema, nil
+	described := make([]mcp.TableInfo, 0, len(tables))
+	warnings := []domain.SchemaWarning{}
+	for i, table := range tables {
+		if errs[i] != nil || infos[i] == nil {
+			warning := domain.SchemaWarning{Table: table, Error: "no description returned"}
+			if errs[i] != nil {
+				warning.Error = errs[i].Error()
+			}
+			warnings = append(warnings, warning)
+			continue
+		}
+		described = append(described, *infos[i])
+	}
+	return described, warnings, nil
 }
 
-// RefreshSchema forces a schema refresh for a connection
+// RefreshSchema forces a schema refresh for a connection. A schema that differs from
+// the one loaded before is returned with the difference in its Changes.
 func (s *QueryService) RefreshSchema(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) (*domain.SchemaInfo, error) {
+	// The schema loaded before, to report what changed since
+	previous := s.previousSchema(ctx, workspaceID, connectionID)
+
 	// Invalidate cache
 	if s.schemaCache != nil {
-		s.schemaCache.Invalidate(ctx, connectionID)
+		s.schemaCache.Invalidate(ctx, workspaceID, connectionID)
+	}
+	if s.schemaStore != nil {
+		if err := s.schemaStore.Delete(ctx, connectionID); err != nil {
+			return nil, fmt.Errorf("failed to drop stored schema: %w", err)
+		}
 	}
+	schema, err := s.loadConnectionSchema(ctx, userID, workspaceID, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if change := s.recordSchemaChange(ctx, workspaceID, connectionID, previous, schema); change != nil {
+		// A copy, since the schema may be shared with concurrent loads
+		refreshed := *schema
+		refreshed.Changes = change
+		return &refreshed, nil
+	}
+	return schema, nil
+}
+
+// FlushConnectionCache removes what is cached for a connection, which is its schema.
+// Viewers cannot flush, since the next query then reloads the schema.
+func (s *QueryService) FlushConnectionCache(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) error {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return err
+	}
+	if _, err := s.connectionService.GetByID(ctx, userID, workspaceID, connectionID); err != nil {
+		return err
+	}
+	if s.schemaCache != nil {
+		if err := s.schemaCache.Invalidate(ctx, workspaceID, connectionID); err != nil {
+			return fmt.Errorf("failed to flush cache: %w", err)
+		}
+	}
+	if s.schemaStore != nil {
+		if err := s.schemaStore.Delete(ctx, connectionID); err != nil {
+			return fmt.Errorf("failed to flush cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// WarmSchema loads the schema of a new connection in the background, so the first
+// question about it does not wait for the schema
+func (s *QueryService) WarmSchema(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) {
+	logger := logging.FromContext(ctx)
+	s.goBackground(func(bgCtx context.Context) {
+		bgCtx = logging.NewContext(bgCtx, *logger)
+		if _, err := s.loadConnectionSchema(bgCtx, userID, workspaceID, connectionID); err != nil {
+			logger.Warn().Err(err).Str("connection_id", connectionID.String()).Msg("failed to fetch initial schema")
+		}
+	})
+}
 
+// loadConnectionSchema opens a connection and gets its schema
+func (s *QueryService) loadConnectionSchema(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) (*domain.SchemaInfo, error) {
 	// Get connection
 	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, connectionID)
 	if err != nil {
@@ -371,35 +1247,82 @@ func (s *QueryService) RefreshSchema(ctx context.Context, userID, workspaceID, c
 	}
 
 	// Get adapter
-	mcpConfig := mcp.ConnectionConfig{
-		Host:     conn.Host,
-		Port:     conn.Port,
-		Database: conn.Database,
-		Username: conn.Username,
-		Password: password,
-		SSLMode:  conn.SSLMode,
-	}
+	mcpConfig := adapterConfig(conn, password)
 
 	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), mcpConfig)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get adapter: %w", err)
+		err = fmt.Errorf("failed to get adapter: %w", err)
+		s.emitSchemaRefreshFailed(ctx, workspaceID, connectionID, err)
+		return nil, apperr.Wrap(apperr.Upstream, err)
+	}
+
+	schema, err := s.getSchema(ctx, conn, adapter)
+	if err != nil {
+		s.emitSchemaRefreshFailed(ctx, workspaceID, connectionID, err)
+		return nil, apperr.Wrap(apperr.Upstream, err)
 	}
+	return schema, nil
+}
 
-	return s.getSchema(ctx, connectionID, adapter)
+// emitQueryCompleted notifies webhooks of an answered question, successful or not
+func (s *QueryService) emitQueryCompleted(ctx context.Context, workspaceID, connectionID uuid.UUID, question, answer *domain.Message) {
+	if s.webhooks == nil {
+		return
+	}
+	s.webhooks.Emit(ctx, workspaceID, domain.WebhookEventQueryCompleted, map[string]any{
+		"session_id":    answer.SessionID,
+		"connection_id": connectionID,
+		"user_id":       question.UserID,
+		"question":      question.Content,
+		"status":        answer.Status,
+		"row_count":     answer.RowCount,
+		"latency_ms":    answer.LatencyMs,
+		"error":         answer.Error,
+	})
+}
+
+// emitSchemaRefreshFailed notifies webhooks that a connection's schema could not be loaded
+func (s *QueryService) emitSchemaRefreshFailed(ctx context.Context, workspaceID, connectionID uuid.UUID, err error) {
+	if s.webhooks == nil {
+		return
+	}
+	s.webhooks.Emit(ctx, workspaceID, domain.WebhookEventSchemaRefreshFailed, map[string]any{
+		"connection_id": connectionID,
+		"error":         err.Error(),
+	})
 }
 
 // GetSchema returns cached or fresh schema for a connection
 func (s *QueryService) GetSchema(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) (*domain.SchemaInfo, error) {
-	// Try cache first
+	// Try cache first; misses are recorded by getSchema
 	if s.schemaCache != nil {
-		cached, err := s.schemaCache.Get(ctx, connectionID)
-		if err == nil && cached != nil {
-			return cached, nil
+		cached, err := s.schemaCache.Get(ctx, workspaceID, connectionID)
+		if err == nil && cached != nil && !cached.Stale(time.Now()) {
+			s.metrics.ObserveSchemaCache(true)
+			cached.Source = domain.SchemaSourceRedis
+			return s.labelTables(ctx, connectionID, cached), nil
 		}
 	}
 
-	// Refresh if not cached
-	return s.RefreshSchema(ctx, userID, workspaceID, connectionID)
+	// Refresh if not cached or stale
+	schema, err := s.loadConnectionSchema(ctx, userID, workspaceID, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	return s.labelTables(ctx, connectionID, schema), nil
+}
+
+// labelTables returns a copy of a schema with its tables annotated and ordered by
+// role, classifying them if the schema was cached before roles were set
+func (s *QueryService) labelTables(ctx context.Context, connectionID uuid.UUID, schema *domain.SchemaInfo) *domain.SchemaInfo {
+	labelled := *schema
+	labelled.Tables = slices.Clone(schema.Tables)
+	if slices.ContainsFunc(labelled.Tables, func(t domain.TableInfo) bool { return t.Role == "" }) {
+		domain.ClassifyTables(labelled.Tables)
+	}
+	s.annotateTables(ctx, connectionID, labelled.Tables)
+	labelled.Tables = domain.SortTablesByRole(labelled.Tables)
+	return &labelled
 }
 
 // GetChatHistory returns chat history for a workspace
@@ -411,7 +1334,7 @@ func (s *QueryService) GetChatHistory(ctx context.Context, workspaceID uuid.UUID
 // CreateSession creates a new chat session
 func (s *QueryService) CreateSession(ctx context.Context, userID, workspaceID uuid.UUID, title string) (*domain.ChatSession, error) {
 	if title == "" {
-		title = "New Chat"
+		title = domain.DefaultSessionTitle
 	}
 	session := &domain.ChatSession{
 		ID:          uuid.New(),
@@ -427,8 +1350,11 @@ func (s *QueryService) CreateSession(ctx context.Context, userID, workspaceID uu
 	return session, nil
 }
 
-// ListSessions lists chat sessions for a workspace
-func (s *QueryService) ListSessions(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]domain.ChatSession, error) {
+// ListSessions lists chat sessions for a workspace along with the total count
+func (s *QueryService) ListSessions(ctx context.Context, userID, workspaceID uuid.UUID, limit, offset int) ([]domain.ChatSessionSummary, int, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleViewer); err != nil {
+		return nil, 0, err
+	}
 	return s.sessionRepo.ListByWorkspace(ctx, workspaceID, limit, offset)
 }
 
@@ -437,79 +1363,345 @@ func (s *QueryService) GetSession(ctx context.Context, sessionID uuid.UUID) (*do
 	return s.sessionRepo.Get(ctx, sessionID)
 }
 
-// DeleteSession deletes a chat session
-func (s *QueryService) DeleteSession(ctx context.Context, sessionID uuid.UUID) error {
-	return s.sessionRepo.Delete(ctx, sessionID)
+// DeleteSession soft-deletes a chat session (viewers cannot delete).
+// It can be restored until domain.SessionRetention has passed.
+func (s *QueryService) DeleteSession(ctx context.Context, userID, workspaceID, sessionID uuid.UUID) error {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return err
+	}
+	if _, err := s.getWorkspaceSession(ctx, workspaceID, sessionID); err != nil {
+		return err
+	}
+	return s.sessionRepo.SoftDelete(ctx, sessionID)
+}
+
+// RestoreSession undoes the deletion of a chat session still within the retention window
+func (s *QueryService) RestoreSession(ctx context.Context, userID, workspaceID, sessionID uuid.UUID) (*domain.ChatSession, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.Get(ctx, sessionID)
+	if err != nil || session.WorkspaceID != workspaceID {
+		return nil, apperr.New(apperr.NotFound, "session not found")
+	}
+	if session.DeletedAt == nil {
+		return nil, apperr.New(apperr.Conflict, "session is not deleted")
+	}
+	if time.Since(*session.DeletedAt) > domain.SessionRetention {
+		return nil, apperr.New(apperr.NotFound, "session not found")
+	}
+
+	if err := s.sessionRepo.Restore(ctx, sessionID); err != nil {
+		return nil, err
+	}
+	session.DeletedAt = nil
+	return session, nil
 }
 
 // GetSessionHistory retrieves chat history for a session
-func (s *QueryService) GetSessionHistory(ctx context.Context, sessionID uuid.UUID) ([]domain.Message, error) {
+func (s *QueryService) GetSessionHistory(ctx context.Context, userID, workspaceID, sessionID uuid.UUID) ([]domain.Message, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleViewer); err != nil {
+		return nil, err
+	}
+	if _, err := s.getWorkspaceSession(ctx, workspaceID, sessionID); err != nil {
+		return nil, err
+	}
 	// 50 messages limit for now
 	return s.messageRepo.ListBySession(ctx, sessionID, 50)
 }
 
-// generateSessionTitle generates and updates the session title using LLM
-func (s *QueryService) generateSessionTitle(ctx context.Context, sessionID uuid.UUID, question string, providerName string, modelName string) {
-	// 1. Get LLM provider
-	if providerName == "" {
-		providerName = s.llmRouter.DefaultProvider()
+// sessionTitle derives a provisional session title from the first question
+func sessionTitle(question string) string {
+	return llm.TruncateTitle(strings.TrimSpace(question), 30)
+}
+
+// resolveSessionConnection defaults the request's connection to the session's and
+// refuses a different one unless the request asks to switch. Sessions from before
+// connections were recorded take the request's connection.
+func resolveSessionConnection(session *domain.ChatSession, req *domain.QueryRequest) error {
+	if session == nil || session.ConnectionID == nil {
+		if req.ConnectionID == uuid.Nil {
+			return apperr.New(apperr.Validation, "connection_id is required")
+		}
+		return nil
+	}
+	switch {
+	case req.ConnectionID == uuid.Nil:
+		req.ConnectionID = *session.ConnectionID
+	case req.ConnectionID != *session.ConnectionID && !req.SwitchConnection:
+		return &apperr.Error{
+			Kind:    apperr.Conflict,
+			Message: "session uses a different connection; set switch_connection to ask against this one",
+			Details: map[string]any{"session_connection_id": *session.ConnectionID},
+		}
 	}
+	return nil
+}
 
-	// Fetch user config for LLM (need userID from session)
-	// Since we only have sessionID here, we first get the session to find userID
+// getWorkspaceSession retrieves a session, treating deleted sessions and those of other workspaces as missing
+func (s *QueryService) getWorkspaceSession(ctx context.Context, workspaceID, sessionID uuid.UUID) (*domain.ChatSession, error) {
 	session, err := s.sessionRepo.Get(ctx, sessionID)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to get session for title generation")
+	if err != nil || session.WorkspaceID != workspaceID || session.DeletedAt != nil {
+		return nil, apperr.New(apperr.NotFound, "session not found")
+	}
+	return session, nil
+}
+
+// goBackground runs fn outside the request, tracked by the lifecycle manager when one is set
+func (s *QueryService) goBackground(fn func(ctx context.Context)) {
+	if s.background != nil {
+		s.background.Go(fn)
 		return
 	}
-	if session.UserID == nil {
-		// Anonymous session? fallback to system default
-		log.Warn().Msg("session has no user ID, using default config")
+	go fn(context.Background())
+}
+
+// GetSuggestedQuestions retrieves the questions asked most often in the workspace,
+// optionally only those asked against connectionID
+func (s *QueryService) GetSuggestedQuestions(ctx context.Context, workspaceID uuid.UUID, connectionID *uuid.UUID, limit int) ([]string, error) {
+	if limit <= 0 {
+		limit = DefaultSuggestionLimit
+	}
+	limit = min(limit, MaxSuggestionLimit)
+	questions, err := s.messageRepo.GetMostFrequentQuestions(ctx, workspaceID, domain.FrequentQuestionFilter{
+		ConnectionID: connectionID,
+		MinLength:    suggestionMinLength,
+		MinCount:     suggestionMinCount,
+		Limit:        limit,
+	})
+	if err != nil || connectionID == nil || len(questions) >= limit {
+		return questions, err
 	}
 
-	var llmConfig map[string]any
-	if session.UserID != nil {
-		user, err := s.userRepo.GetByID(ctx, *session.UserID)
-		if err == nil && user != nil && user.LLMConfig != nil {
-			if config, ok := user.LLMConfig[providerName].(map[string]any); ok {
-				llmConfig = config
-			}
+	// Fill the rest with questions about the connection's fact tables, from the schema
+	// last loaded so suggesting never connects to the database
+	schema := s.previousSchema(ctx, workspaceID, *connectionID)
+	if schema == nil {
+		return questions, nil
+	}
+	for _, q := range factTableQuestions(s.labelTables(ctx, *connectionID, schema).Tables) {
+		if len(questions) >= limit {
+			break
+		}
+		if !slices.Contains(questions, q) {
+			questions = append(questions, q)
 		}
 	}
+	return questions, nil
+}
 
-	provider, err := s.llmRouter.GetProviderWithConfig(providerName, llmConfig)
+// factTableQuestions suggests a question for each fact table, by month when it has a
+// date or time column
+func factTableQuestions(tables []domain.TableInfo) []string {
+	var questions []string
+	for _, t := range tables {
+		if t.Role != domain.TableRoleFact {
+			continue
+		}
+		name := strings.ReplaceAll(t.Name, "_", " ")
+		if slices.ContainsFunc(t.Columns, func(c domain.ColumnInfo) bool {
+			dataType := strings.ToLower(c.DataType)
+			return strings.Contains(dataType, "date") || strings.Contains(dataType, "time")
+		}) {
+			questions = append(questions, fmt.Sprintf("How many %s were there per month?", name))
+		} else {
+			questions = append(questions, fmt.Sprintf("How many %s are there?", name))
+		}
+	}
+	return questions
+}
+
+// workspaceSettings returns the settings of a workspace, empty if it has none
+func (s *QueryService) workspaceSettings(ctx context.Context, workspaceID uuid.UUID) (domain.WorkspaceSettings, error) {
+	workspace, err := s.workspaceRepo.GetByID(ctx, workspaceID)
 	if err != nil {
-		log.Error().Err(err).Str("provider", providerName).Msg("failed to get LLM provider for title generation")
-		return
+		return domain.WorkspaceSettings{}, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if workspace == nil {
+		return domain.WorkspaceSettings{}, nil
+	}
+	return workspace.Settings, nil
+}
+
+// checkProvider refuses a provider the workspace does not allow, auditing the attempt
+// made from source
+func (s *QueryService) checkProvider(ctx context.Context, settings domain.WorkspaceSettings, workspaceID, userID uuid.UUID, provider, source string) error {
+	if settings.AllowsProvider(provider) {
+		return nil
+	}
+	if s.auditRepo != nil {
+		entry := &domain.AuditLog{
+			ID:           uuid.New(),
+			WorkspaceID:  workspaceID,
+			UserID:       userID,
+			Action:       domain.AuditActionProviderDenied,
+			ResourceType: "workspace",
+			ResourceID:   &workspaceID,
+			Metadata:     map[string]any{"provider": provider, "source": source},
+			CreatedAt:    time.Now(),
+		}
+		if err := s.auditRepo.Create(context.WithoutCancel(ctx), entry); err != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Msg("failed to write provider audit log")
+		}
 	}
+	return apperr.New(apperr.Forbidden, "llm provider not allowed in this workspace")
+}
 
-	// 2. Generate title
-	// Use a reasonable timeout
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+// resolveProvider picks the provider and model for a request: the requested ones, then
+// the user's preferences, then the workspace defaults, then the first allowed provider
+// or the global default. A preferred provider the workspace does not allow is skipped.
+// An empty model means the provider's default model.
+func resolveProvider(settings domain.WorkspaceSettings, user *domain.User, req domain.QueryRequest, globalDefault string) (string, string) {
+	provider, model := req.LLMProvider, req.LLMModel
+	preferred := ""
+	if user != nil && settings.AllowsProvider(user.PreferredProvider) {
+		preferred = user.PreferredProvider
+	}
+	if provider == "" {
+		provider = preferred
+	}
+	if provider == "" {
+		provider = settings.DefaultProvider(globalDefault)
+	}
+	if model == "" && preferred != "" && provider == preferred {
+		model = user.PreferredModel
+	}
+	if model == "" && provider == settings.DefaultLLMProvider {
+		model = settings.DefaultLLMModel
+	}
+	return provider, model
+}
 
-	if modelName == "" {
-		modelName = provider.DefaultModel()
+// selectionError classifies a rejected provider or model selection, giving clients the
+// valid models and suggestions for an unknown model
+func selectionError(err error) *apperr.Error {
+	appErr := apperr.Wrap(apperr.Validation, err)
+	var unknown *llm.UnknownModelError
+	if errors.As(err, &unknown) {
+		appErr.Details = map[string]any{"models": unknown.Models, "suggestions": unknown.Suggestions}
 	}
-	title, err := provider.GenerateTitle(ctx, question, modelName)
+	return appErr
+}
+
+// generationTimeout is the deadline for one SQL generation call: the request's option,
+// else the provider's configured timeout, else the default
+func (s *QueryService) generationTimeout(providerName string, opts *domain.QueryOptions) time.Duration {
+	if opts != nil && opts.LLMTimeoutSeconds > 0 {
+		return time.Duration(opts.LLMTimeoutSeconds) * time.Second
+	}
+	if timeout, ok := s.llmTimeouts[providerName]; ok {
+		return timeout
+	}
+	return s.llmTimeout
+}
+
+// queryExtractor returns how to pull the query out of the model's answer for databases
+// that are not queried with SQL, or nil when the provider's ExtractSQL applies
+func queryExtractor(databaseType string) func(string) string {
+	if databaseType == string(domain.DatabaseTypeMongoDB) {
+		return llm.ExtractMongoCommand
+	}
+	return nil
+}
+
+// executionStatus classifies an error returned while executing generated SQL
+func executionStatus(err error) domain.QueryStatus {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return domain.QueryStatusTimeout
+	}
+	return domain.QueryStatusSQLError
+}
+
+// GetQueryStats summarizes the answers given in a workspace over the last days
+func (s *QueryService) GetQueryStats(ctx context.Context, workspaceID uuid.UUID, days int) (*domain.QueryStats, error) {
+	since := time.Now().AddDate(0, 0, -days)
+	counts, err := s.messageRepo.CountByStatus(ctx, workspaceID, since)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to generate session title")
-		return
+		return nil, err
+	}
+	return summarizeQueryStats(since, counts), nil
+}
+
+// summarizeQueryStats folds per-status counts into totals by status, provider and connection
+func summarizeQueryStats(since time.Time, counts []domain.QueryStatusCount) *domain.QueryStats {
+	stats := &domain.QueryStats{
+		Since:    since,
+		ByStatus: map[domain.QueryStatus]int{},
 	}
+	providers := map[string]*statsGroupSum{}
+	connections := map[string]*statsGroupSum{}
+
+	for _, c := range counts {
+		stats.Total += c.Count
+		stats.ByStatus[c.Status] += c.Count
+
+		addStatsGroup(providers, c.LLMProvider, "", c)
+
+		connectionKey := ""
+		if c.ConnectionID != nil {
+			connectionKey = c.ConnectionID.String()
+		}
+		addStatsGroup(connections, connectionKey, c.ConnectionName, c)
+	}
+
+	stats.ByProvider = sortedStatsGroups(providers)
+	stats.ByConnection = sortedStatsGroups(connections)
+	return stats
+}
 
-	// 3. Update session (we already fetched it)
-	session.Title = title
-	session.UpdatedAt = time.Now()
+// statsGroupSum accumulates one QueryStatsGroup
+type statsGroupSum struct {
+	group        domain.QueryStatsGroup
+	latencyTotal int64
+	latencyCount int64
+}
 
-	if err := s.sessionRepo.Update(ctx, session); err != nil {
-		log.Error().Err(err).Msg("failed to update session title")
+func addStatsGroup(groups map[string]*statsGroupSum, key, name string, c domain.QueryStatusCount) {
+	sum, ok := groups[key]
+	if !ok {
+		sum = &statsGroupSum{group: domain.QueryStatsGroup{Key: key, Name: name, ByStatus: map[domain.QueryStatus]int{}}}
+		groups[key] = sum
 	}
+	sum.group.Total += c.Count
+	sum.group.ByStatus[c.Status] += c.Count
+	sum.latencyTotal += c.TotalLatencyMs
+	sum.latencyCount += int64(c.LatencyCount)
+}
 
-	log.Info().Str("session_id", sessionID.String()).Str("title", title).Msg("updated session title")
+// sortedStatsGroups returns the groups with average latency filled in, largest first
+func sortedStatsGroups(groups map[string]*statsGroupSum) []domain.QueryStatsGroup {
+	result := make([]domain.QueryStatsGroup, 0, len(groups))
+	for _, sum := range groups {
+		if sum.latencyCount > 0 {
+			sum.group.AvgLatencyMs = sum.latencyTotal / sum.latencyCount
+		}
+		result = append(result, sum.group)
+	}
+	slices.SortFunc(result, func(a, b domain.QueryStatsGroup) int {
+		if a.Total != b.Total {
+			return b.Total - a.Total
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return result
 }
 
-// GetSuggestedQuestions retrieves suggested questions based on frequency
-func (s *QueryService) GetSuggestedQuestions(ctx context.Context, workspaceID uuid.UUID) ([]string, error) {
-	// Limit to top 5 frequent questions
-	return s.messageRepo.GetMostFrequentQuestions(ctx, workspaceID, 5)
+// providerConfig returns the user's config for a provider with API keys decrypted
+func (s *QueryService) providerConfig(user *domain.User, providerName string) map[string]any {
+	config, ok := user.LLMConfig[providerName].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	decrypted, err := s.encryptor.DecryptSecrets(config)
+	if err != nil {
+		if errors.Is(err, security.ErrUndecryptable) {
+			s.metrics.ObserveDecryptFailure("llm_config")
+		}
+		log.Error().Err(err).Str("provider", providerName).Msg("failed to decrypt user LLM config, using defaults")
+		return nil
+	}
+
+	return decrypted
 }
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+)
+
+// pageTokenTTL is how long the next page of a truncated result can be fetched
+const pageTokenTTL = 15 * time.Minute
+
+// errPageNotFound is returned for unknown, expired and foreign page tokens alike
+var errPageNotFound = apperr.New(apperr.NotFound, "page token not found or expired")
+
+// PageStore persists the state behind page tokens
+type PageStore interface {
+	Save(ctx context.Context, token string, page *domain.QueryPage, ttl time.Duration) error
+	// Get returns nil when the token is unknown or expired
+	Get(ctx context.Context, token string) (*domain.QueryPage, error)
+}
+
+// WithPaging hands out page tokens for truncated results of adapters that can page
+func (s *QueryService) WithPaging(store PageStore) *QueryService {
+	s.pages = store
+	return s
+}
+
+// NextPage runs the SQL behind a page token again for the rows of its page. Each page
+// is bounded by the connection's current row limit.
+func (s *QueryService) NextPage(ctx context.Context, userID, workspaceID uuid.UUID, token string) (*domain.QueryPageResponse, error) {
+	if s.pages == nil {
+		return nil, errPageNotFound
+	}
+	page, err := s.pages.Get(ctx, token)
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, err)
+	}
+	if page == nil || page.UserID != userID || page.WorkspaceID != workspaceID {
+		return nil, errPageNotFound
+	}
+
+	// This also checks the user still has access to the connection
+	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, page.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), adapterConfig(conn, password))
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to get database adapter: %w", err))
+	}
+	pager, ok := adapter.(mcp.Pager)
+	if !ok {
+		return nil, apperr.New(apperr.Validation, "connection does not support paging")
+	}
+
+	opts := s.executionOptions(conn, settings, nil)
+	opts.MaxRows = min(opts.MaxRows, page.PageSize)
+	// One row past the page tells whether another page follows
+	sql, err := pager.PageQuery(page.SQL, mcp.Page{
+		Offset:     page.Offset,
+		Limit:      opts.MaxRows + 1,
+		KeyColumn:  page.KeyColumn,
+		After:      page.After,
+		Descending: page.Descending,
+	})
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Validation, err)
+	}
+	if err := adapter.ValidateQuery(sql); err != nil {
+		return nil, apperr.Wrap(apperr.Validation, err)
+	}
+
+	start := time.Now()
+	result, err := adapter.ExecuteQuery(ctx, sql, opts)
+	status := domain.QueryStatusOK
+	if err != nil {
+		status = executionStatus(err)
+	}
+	resp := &domain.QueryPageResponse{}
+	if result != nil {
+		resp.Result = &domain.QueryResult{
+			Columns:             result.Columns,
+			Rows:                result.Rows,
+			RowCount:            result.RowCount,
+			Truncated:           result.Truncated,
+			DefaultLimitApplied: result.DefaultLimitApplied,
+		}
+	}
+	s.metrics.ObserveQuery(string(conn.DatabaseType), status, time.Since(start), resp.Result)
+	if status == domain.QueryStatusTimeout {
+		return nil, apperr.New(apperr.Timeout, "query timed out")
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to execute query: %w", err))
+	}
+
+	next := *page
+	next.PageSize = opts.MaxRows
+	next.Offset += result.RowCount
+	resp.NextPageToken = s.issuePageToken(ctx, &next, result)
+	return resp, nil
+}
+
+// firstPageToken returns the token of the page after a truncated answer, or "" when
+// paging is off or the adapter cannot page. Pages follow the primary key when the SQL
+// is ordered by the single-column primary key of the table it reads.
+func (s *QueryService) firstPageToken(ctx context.Context, adapter mcp.Adapter, userID, workspaceID, connectionID uuid.UUID, sql string, result *mcp.QueryResult) string {
+	if s.pages == nil || !result.Truncated {
+		return ""
+	}
+	if _, ok := adapter.(mcp.Pager); !ok {
+		return ""
+	}
+
+	page := &domain.QueryPage{
+		UserID:       userID,
+		WorkspaceID:  workspaceID,
+		ConnectionID: connectionID,
+		SQL:          sql,
+		PageSize:     result.RowCount,
+		Offset:       result.RowCount,
+	}
+	if table, column, descending, ok := mcp.KeysetCandidate(sql); ok {
+		if info, err := adapter.DescribeTable(ctx, table); err == nil {
+			var keys []string
+			for _, col := range info.Columns {
+				if col.PrimaryKey {
+					keys = append(keys, col.Name)
+				}
+			}
+			if len(keys) == 1 && keys[0] == column {
+				page.KeyColumn = column
+				page.Descending = descending
+			}
+		}
+	}
+	return s.issuePageToken(ctx, page, result)
+}
+
+// issuePageToken saves page, moved past the rows of result, and returns its token.
+// It returns "" when no page follows or when the page cannot be saved, in which case
+// the result is still served without it.
+func (s *QueryService) issuePageToken(ctx context.Context, page *domain.QueryPage, result *mcp.QueryResult) string {
+	if s.pages == nil || !result.Truncated || result.RowCount == 0 {
+		return ""
+	}
+
+	if page.KeyColumn != "" {
+		after, ok := keyValue(result, page.KeyColumn)
+		if !ok {
+			// Keys that are not integers are not written into SQL; later pages use offsets
+			page.KeyColumn = ""
+			page.Descending = false
+		}
+		page.After = after
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Msg("failed to generate page token")
+		return ""
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	if err := s.pages.Save(ctx, token, page, pageTokenTTL); err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Msg("failed to save page token")
+		return ""
+	}
+	return token
+}
+
+// keyValue returns the value of column in the last row of result, if it is an integer
+func keyValue(result *mcp.QueryResult, column string) (int64, bool) {
+	index := -1
+	for i, name := range result.Columns {
+		if name == column {
+			index = i
+		}
+	}
+	if index < 0 || len(result.Rows) == 0 {
+		return 0, false
+	}
+
+	switch v := result.Rows[len(result.Rows)-1][index].(type) {
+	case int:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case float64:
+		return int64(v), v == math.Trunc(v) && math.Abs(v) < 1<<53
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
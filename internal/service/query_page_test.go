@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryPageStore is a PageStore without expiry
+type memoryPageStore map[string]*domain.QueryPage
+
+func (m memoryPageStore) Save(_ context.Context, token string, page *domain.QueryPage, _ time.Duration) error {
+	m[token] = page
+	return nil
+}
+
+func (m memoryPageStore) Get(_ context.Context, token string) (*domain.QueryPage, error) {
+	return m[token], nil
+}
+
+func TestQueryService_NextPage(t *testing.T) {
+	ctx := context.Background()
+	f := newExecuteQueryFixture(t)
+	pages := memoryPageStore{}
+	f.svc.WithPaging(pages)
+
+	// Ordered by the primary key, so pages follow the key
+	sql := "SELECT id, email FROM users ORDER BY id"
+	token := f.svc.firstPageToken(ctx, f.adapter, f.userID, f.workspaceID, f.connectionID, sql, &mcp.QueryResult{
+		Columns:   []string{"id", "email"},
+		Rows:      [][]any{{int64(1), "a@example.com"}, {int64(2), "b@example.com"}},
+		RowCount:  2,
+		Truncated: true,
+	})
+	require.NotEmpty(t, token)
+	assert.Equal(t, &domain.QueryPage{
+		UserID:       f.userID,
+		WorkspaceID:  f.workspaceID,
+		ConnectionID: f.connectionID,
+		SQL:          sql,
+		PageSize:     2,
+		Offset:       2,
+		KeyColumn:    "id",
+		After:        2,
+	}, pages[token])
+
+	pageSQL := `SELECT * FROM (SELECT id, email FROM users ORDER BY id) AS page_rows WHERE "id" > 2 ORDER BY "id" ASC LIMIT 3`
+	f.adapter.On("ValidateQuery", pageSQL).Return(nil)
+	f.adapter.On("ExecuteQuery", mock.Anything, pageSQL, mcp.QueryOptions{MaxRows: 2, Timeout: 30 * time.Second}).
+		Return(&mcp.QueryResult{Columns: []string{"id", "email"}, Rows: [][]any{{int64(3), "c@example.com"}}, RowCount: 1}, nil)
+
+	resp, err := f.svc.NextPage(ctx, f.userID, f.workspaceID, token)
+	require.NoError(t, err)
+	assert.Equal(t, [][]any{{int64(3), "c@example.com"}}, resp.Result.Rows)
+	assert.Empty(t, resp.NextPageToken, "the last page has no next page")
+
+	t.Run("tokens are scoped to the user and workspace", func(t *testing.T) {
+		_, err := f.svc.NextPage(ctx, uuid.New(), f.workspaceID, token)
+		assert.ErrorIs(t, err, apperr.NotFound)
+		_, err = f.svc.NextPage(ctx, f.userID, uuid.New(), token)
+		assert.ErrorIs(t, err, apperr.NotFound)
+		_, err = f.svc.NextPage(ctx, f.userID, f.workspaceID, "unknown")
+		assert.ErrorIs(t, err, apperr.NotFound)
+	})
+
+	t.Run("other orders page by offset", func(t *testing.T) {
+		token := f.svc.firstPageToken(ctx, f.adapter, f.userID, f.workspaceID, f.connectionID, "SELECT email FROM users ORDER BY email", &mcp.QueryResult{
+			Columns:   []string{"email"},
+			Rows:      [][]any{{"a@example.com"}},
+			RowCount:  1,
+			Truncated: true,
+		})
+		require.NotEmpty(t, token)
+		assert.Empty(t, pages[token].KeyColumn)
+		assert.Equal(t, 1, pages[token].Offset)
+	})
+
+	t.Run("complete results get no token", func(t *testing.T) {
+		token := f.svc.firstPageToken(ctx, f.adapter, f.userID, f.workspaceID, f.connectionID, sql, &mcp.QueryResult{
+			Columns:  []string{"id"},
+			Rows:     [][]any{{int64(1)}},
+			RowCount: 1,
+		})
+		assert.Empty(t, token)
+	})
+}
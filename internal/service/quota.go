@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+// quotaRetention is how long counters are kept past the midnight that resets them,
+// so a clock running slightly behind on another replica still finds them
+const quotaRetention = time.Hour
+
+// quotaWarningShare is the share of a daily query quota at which the user is warned
+const quotaWarningShare = 0.8
+
+// QuotaStore keeps the daily LLM usage counters of users
+type QuotaStore interface {
+	// Reserve counts one query against limit and returns the counts after it. When the
+	// queries or tokens already reached their limit nothing is counted and ok is false.
+	Reserve(ctx context.Context, key domain.QuotaKey, limit domain.QuotaLimit, ttl time.Duration) (counts domain.QuotaCounts, ok bool, err error)
+	// AddTokens adds the tokens a counted query used
+	AddTokens(ctx context.Context, key domain.QuotaKey, tokens int64, ttl time.Duration) error
+	Get(ctx context.Context, key domain.QuotaKey) (domain.QuotaCounts, error)
+}
+
+// QuotaService enforces the daily per-user LLM quotas that workspace settings set by role
+type QuotaService struct {
+	store         QuotaStore
+	workspaceRepo domain.WorkspaceRepository
+	notifier      Notifier
+	now           func() time.Time
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(store QuotaStore, workspaceRepo domain.WorkspaceRepository) *QuotaService {
+	return &QuotaService{store: store, workspaceRepo: workspaceRepo, now: time.Now}
+}
+
+// WithNotifications warns users when they have used most of a daily query quota
+func (s *QuotaService) WithNotifications(notifier Notifier) *QuotaService {
+	s.notifier = notifier
+	return s
+}
+
+// QuotaReservation is a query counted against a quota, whose tokens are added once known
+type QuotaReservation struct {
+	store QuotaStore
+	key   domain.QuotaKey
+	ttl   time.Duration
+}
+
+// quotaDay returns the day of now in loc and the midnight that ends it
+func quotaDay(now time.Time, loc *time.Location) (string, time.Time) {
+	local := now.In(loc)
+	year, month, day := local.Date()
+	return local.Format(time.DateOnly), time.Date(year, month, day+1, 0, 0, 0, 0, loc)
+}
+
+// Reserve counts a query by userID with provider against the user's quota, returning
+// nil when their role has no quota for the provider's class. A reached quota is a
+// RateLimited error whose details tell when it resets. Like the rate limiter, quotas
+// let queries through while the store is unavailable.
+func (s *QuotaService) Reserve(ctx context.Context, settings domain.WorkspaceSettings, workspaceID, userID uuid.UUID, provider string) (*QuotaReservation, error) {
+	if s == nil || len(settings.UserQuotas) == 0 {
+		return nil, nil
+	}
+	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace member: %w", err)
+	}
+	if member == nil {
+		return nil, nil
+	}
+	class := domain.ProviderClass(provider)
+	limit, ok := settings.QuotaFor(member.Role, class)
+	if !ok {
+		return nil, nil
+	}
+
+	now := s.now()
+	day, resetAt := quotaDay(now, settings.Location())
+	key := domain.QuotaKey{WorkspaceID: workspaceID, UserID: userID, ProviderClass: class, Day: day}
+	ttl := resetAt.Sub(now) + quotaRetention
+	counts, ok, err := s.store.Reserve(ctx, key, limit, ttl)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("provider_class", class).Msg("quota check failed, allowing query")
+		return nil, nil
+	}
+	if !ok {
+		return nil, &apperr.Error{
+			Kind:    apperr.RateLimited,
+			Message: fmt.Sprintf("daily %s LLM quota exceeded", class),
+			Details: domain.QuotaUsage{
+				WorkspaceID:   workspaceID,
+				ProviderClass: class,
+				Used:          counts,
+				Limit:         limit,
+				ResetAt:       resetAt,
+			},
+		}
+	}
+	if s.notifier != nil && limit.DailyQueries > 0 && counts.Queries == quotaWarningAt(limit.DailyQueries) {
+		s.notifier.Notify(ctx, userID, workspaceID, domain.NotificationQuotaWarning, domain.QuotaUsage{
+			WorkspaceID:   workspaceID,
+			ProviderClass: class,
+			Used:          counts,
+			Limit:         limit,
+			ResetAt:       resetAt,
+		})
+	}
+	return &QuotaReservation{store: s.store, key: key, ttl: ttl}, nil
+}
+
+// quotaWarningAt returns the query count of a daily quota at which the user is warned,
+// which only the query reaching it sees
+func quotaWarningAt(limit int64) int64 {
+	return int64(math.Ceil(float64(limit) * quotaWarningShare))
+}
+
+// AddTokens counts the tokens the reserved query used. Failures are logged, since the
+// query has been answered by then.
+func (r *QuotaReservation) AddTokens(ctx context.Context, tokens int) {
+	if r == nil || tokens <= 0 {
+		return
+	}
+	if err := r.store.AddTokens(context.WithoutCancel(ctx), r.key, int64(tokens), r.ttl); err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Msg("failed to count quota tokens")
+	}
+}
+
+// Usage reports the user's usage of every quota set for their role in their workspaces
+func (s *QuotaService) Usage(ctx context.Context, userID uuid.UUID) ([]domain.QuotaUsage, error) {
+	usage := []domain.QuotaUsage{}
+	if s == nil {
+		return usage, nil
+	}
+	workspaces, err := s.workspaceRepo.ListByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+
+	now := s.now()
+	for _, workspace := range workspaces {
+		settings := workspace.Settings
+		if len(settings.UserQuotas) == 0 {
+			continue
+		}
+		member, err := s.workspaceRepo.GetMember(ctx, workspace.ID, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get workspace member: %w", err)
+		}
+		if member == nil {
+			continue
+		}
+		day, resetAt := quotaDay(now, settings.Location())
+		for _, class := range domain.ProviderClasses {
+			limit, ok := settings.QuotaFor(member.Role, class)
+			if !ok {
+				continue
+			}
+			key := domain.QuotaKey{WorkspaceID: workspace.ID, UserID: userID, ProviderClass: class, Day: day}
+			counts, err := s.store.Get(ctx, key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get quota usage: %w", err)
+			}
+			usage = append(usage, domain.QuotaUsage{
+				WorkspaceID:   workspace.ID,
+				ProviderClass: class,
+				Used:          counts,
+				Limit:         limit,
+				ResetAt:       resetAt,
+			})
+		}
+	}
+	return usage, nil
+}
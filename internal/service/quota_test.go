@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryQuotaStore keeps quota counters in memory
+type memoryQuotaStore struct {
+	mu     sync.Mutex
+	counts map[domain.QuotaKey]domain.QuotaCounts
+	err    error
+}
+
+func newMemoryQuotaStore() *memoryQuotaStore {
+	return &memoryQuotaStore{counts: map[domain.QuotaKey]domain.QuotaCounts{}}
+}
+
+func (s *memoryQuotaStore) Reserve(ctx context.Context, key domain.QuotaKey, limit domain.QuotaLimit, ttl time.Duration) (domain.QuotaCounts, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return domain.QuotaCounts{}, false, s.err
+	}
+	counts := s.counts[key]
+	if (limit.DailyQueries > 0 && counts.Queries >= limit.DailyQueries) || (limit.DailyTokens > 0 && counts.Tokens >= limit.DailyTokens) {
+		return counts, false, nil
+	}
+	counts.Queries++
+	s.counts[key] = counts
+	return counts, true, nil
+}
+
+func (s *memoryQuotaStore) AddTokens(ctx context.Context, key domain.QuotaKey, tokens int64, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := s.counts[key]
+	counts.Tokens += tokens
+	s.counts[key] = counts
+	return nil
+}
+
+func (s *memoryQuotaStore) Get(ctx context.Context, key domain.QuotaKey) (domain.QuotaCounts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counts[key], s.err
+}
+
+func TestQuotaService(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+	settings := domain.WorkspaceSettings{
+		UserQuotas: map[string]domain.RoleQuotas{
+			domain.RoleMember: {domain.ProviderClassHosted: {DailyQueries: 2, DailyTokens: 500}},
+		},
+		Timezone: "Asia/Jakarta",
+	}
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	require.NoError(t, err)
+
+	setup := func(role string) (*QuotaService, *memoryQuotaStore) {
+		workspaceRepo := new(MockWorkspaceRepository)
+		workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).Return(&domain.WorkspaceMember{Role: role}, nil)
+		workspaceRepo.On("ListByUserID", mock.Anything, userID).
+			Return([]domain.Workspace{{ID: workspaceID, Settings: settings}, {ID: uuid.New()}}, nil)
+		store := newMemoryQuotaStore()
+		quotas := NewQuotaService(store, workspaceRepo)
+		// 23:30 in Jakarta, half an hour before the quota resets
+		quotas.now = func() time.Time { return time.Date(2024, 5, 1, 16, 30, 0, 0, time.UTC) }
+		return quotas, store
+	}
+
+	t.Run("queries are counted until the limit", func(t *testing.T) {
+		quotas, store := setup(domain.RoleMember)
+
+		for range 2 {
+			reservation, err := quotas.Reserve(ctx, settings, workspaceID, userID, "openai")
+			require.NoError(t, err)
+			require.NotNil(t, reservation)
+			reservation.AddTokens(ctx, 100)
+		}
+		_, err := quotas.Reserve(ctx, settings, workspaceID, userID, "anthropic")
+		require.Error(t, err)
+		assert.Equal(t, apperr.RateLimited, apperr.KindOf(err))
+		assert.EqualError(t, err, "daily hosted LLM quota exceeded")
+		var appErr *apperr.Error
+		require.ErrorAs(t, err, &appErr)
+		assert.Equal(t, domain.QuotaUsage{
+			WorkspaceID:   workspaceID,
+			ProviderClass: domain.ProviderClassHosted,
+			Used:          domain.QuotaCounts{Queries: 2, Tokens: 200},
+			Limit:         domain.QuotaLimit{DailyQueries: 2, DailyTokens: 500},
+			ResetAt:       time.Date(2024, 5, 2, 0, 0, 0, 0, jakarta),
+		}, appErr.Details)
+
+		key := domain.QuotaKey{WorkspaceID: workspaceID, UserID: userID, ProviderClass: domain.ProviderClassHosted, Day: "2024-05-01"}
+		assert.Equal(t, domain.QuotaCounts{Queries: 2, Tokens: 200}, store.counts[key], "the day is the workspace's")
+
+		// The local class has no quota for the role
+		reservation, err := quotas.Reserve(ctx, settings, workspaceID, userID, "ollama")
+		require.NoError(t, err)
+		assert.Nil(t, reservation)
+
+		// Midnight in the workspace's timezone starts a new day
+		quotas.now = func() time.Time { return time.Date(2024, 5, 1, 17, 0, 0, 0, time.UTC) }
+		reservation, err = quotas.Reserve(ctx, settings, workspaceID, userID, "openai")
+		require.NoError(t, err)
+		assert.NotNil(t, reservation)
+	})
+
+	t.Run("roles without a quota are unlimited", func(t *testing.T) {
+		quotas, store := setup(domain.RoleAdmin)
+
+		reservation, err := quotas.Reserve(ctx, settings, workspaceID, userID, "openai")
+		require.NoError(t, err)
+		assert.Nil(t, reservation)
+		assert.Empty(t, store.counts)
+	})
+
+	t.Run("store failure lets the query through", func(t *testing.T) {
+		quotas, store := setup(domain.RoleMember)
+		store.err = errors.New("connection refused")
+
+		reservation, err := quotas.Reserve(ctx, settings, workspaceID, userID, "openai")
+		require.NoError(t, err)
+		assert.Nil(t, reservation)
+	})
+
+	t.Run("warns once when most of the quota is used", func(t *testing.T) {
+		quotas, _ := setup(domain.RoleMember)
+		notifier := new(MockNotifier)
+		notifier.On("Notify", mock.Anything, userID, workspaceID, domain.NotificationQuotaWarning, mock.MatchedBy(func(usage domain.QuotaUsage) bool {
+			return usage.Used.Queries == 2 && usage.Limit.DailyQueries == 2
+		})).Once()
+		quotas.WithNotifications(notifier)
+
+		for range 3 {
+			_, _ = quotas.Reserve(ctx, settings, workspaceID, userID, "openai")
+		}
+		notifier.AssertExpectations(t)
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		quotas, _ := setup(domain.RoleMember)
+		reservation, err := quotas.Reserve(ctx, settings, workspaceID, userID, "openai")
+		require.NoError(t, err)
+		reservation.AddTokens(ctx, 120)
+
+		usage, err := quotas.Usage(ctx, userID)
+		require.NoError(t, err)
+		assert.Equal(t, []domain.QuotaUsage{{
+			WorkspaceID:   workspaceID,
+			ProviderClass: domain.ProviderClassHosted,
+			Used:          domain.QuotaCounts{Queries: 1, Tokens: 120},
+			Limit:         domain.QuotaLimit{DailyQueries: 2, DailyTokens: 500},
+			ResetAt:       time.Date(2024, 5, 2, 0, 0, 0, 0, jakarta),
+		}}, usage)
+	})
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+)
+
+// rerunDiffMaxRows is the most rows a result may have for a rerun to match rows one
+// by one; larger results are compared by counts and column totals
+const rerunDiffMaxRows = 1000
+
+// Rerun runs the SQL of an assistant message again on its connection and compares
+// the fresh result with the stored one. The SQL goes through the validation and cost
+// checks in force now, not those it passed when it was stored. Reruns are not
+// recorded in the session.
+func (s *QueryService) Rerun(ctx context.Context, userID, workspaceID, messageID uuid.UUID, req domain.RerunRequest) (*domain.RerunResponse, error) {
+	startTime := time.Now()
+
+	message, err := s.messageRepo.GetByIDAndWorkspace(ctx, messageID, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return nil, apperr.New(apperr.NotFound, "message not found")
+	}
+	if message.Role != domain.RoleAssistant || message.SQL == "" || message.Metadata == nil {
+		return nil, apperr.New(apperr.Validation, "message has no SQL to rerun")
+	}
+	if message.Metadata.Template != nil {
+		return nil, apperr.New(apperr.Validation, "template answers are rerun through their template")
+	}
+	if message.Result == nil {
+		return nil, apperr.New(apperr.Validation, "message has no stored result to compare with")
+	}
+	if req.KeyColumn != "" && !slices.Contains(message.Result.Columns, req.KeyColumn) {
+		return nil, apperr.Newf(apperr.Validation, "key column %q is not in the result", req.KeyColumn)
+	}
+
+	// This also checks the user still has access to the connection
+	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, message.Metadata.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), adapterConfig(conn, password))
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to get database adapter: %w", err))
+	}
+
+	meta := &domain.QueryMetadata{
+		ConnectionID: conn.ID,
+		DatabaseType: string(conn.DatabaseType),
+	}
+	opts := s.executionOptions(conn, settings, nil)
+	if err := adapter.ValidateQuery(message.SQL); err != nil {
+		s.metrics.ObserveQueryBlocked(string(conn.DatabaseType))
+		blocked := &apperr.Error{Kind: apperr.Validation, Message: err.Error(), Err: err}
+		var validation *mcp.ValidationError
+		if errors.As(err, &validation) {
+			blocked.Details = &domain.BlockedQuery{Rule: validation.Rule, Matched: validation.Matched, Position: validation.Position}
+		}
+		return nil, blocked
+	}
+	if err := s.checkQueryCost(ctx, conn, adapter, message.SQL, req.Force, opts.Timeout, meta); err != nil {
+		s.metrics.ObserveQueryBlocked(string(conn.DatabaseType))
+		return nil, &apperr.Error{Kind: apperr.Validation, Message: err.Error(), Err: err, Details: &domain.BlockedQuery{Rule: ruleQueryTooExpensive}}
+	}
+
+	queryStart := time.Now()
+	result, err := adapter.ExecuteQuery(ctx, message.SQL, opts)
+	status := domain.QueryStatusOK
+	if err != nil {
+		status = executionStatus(err)
+	}
+	var current *domain.QueryResult
+	if result != nil {
+		current = &domain.QueryResult{
+			Columns:             result.Columns,
+			Rows:                result.Rows,
+			RowCount:            result.RowCount,
+			Truncated:           result.Truncated,
+			DefaultLimitApplied: result.DefaultLimitApplied,
+		}
+	}
+	s.metrics.ObserveQuery(string(conn.DatabaseType), status, time.Since(queryStart), current)
+	if status == domain.QueryStatusTimeout {
+		return nil, apperr.New(apperr.Timeout, "query timed out")
+	}
+	if err != nil {
+		return nil, apperr.Wrap(apperr.Upstream, fmt.Errorf("failed to execute query: %w", err))
+	}
+
+	meta.ExecutionTimeMs = time.Since(startTime).Milliseconds()
+	recordPhases(ctx, meta)
+	return &domain.RerunResponse{
+		MessageID: message.ID,
+		SQL:       message.SQL,
+		Previous:  message.Result,
+		Current:   current,
+		Diff:      diffResults(message.Result, current, req.KeyColumn),
+		Metadata:  meta,
+	}, nil
+}
+
+// diffResults compares two results of the same SQL. Rows are matched by keyColumn
+// when its values are unique in both results, otherwise by all their values. Results
+// that are truncated, too large or shaped differently are compared by row counts and
+// column totals only.
+func diffResults(previous, current *domain.QueryResult, keyColumn string) *domain.ResultDiff {
+	diff := &domain.ResultDiff{
+		Mode:             domain.DiffModeRows,
+		PreviousRowCount: previous.RowCount,
+		CurrentRowCount:  current.RowCount,
+		Added:            [][]any{},
+		Removed:          [][]any{},
+		Changed:          []domain.RowChange{},
+		Aggregates:       []domain.ValueChange{},
+	}
+
+	switch {
+	case !slices.Equal(previous.Columns, current.Columns):
+		diff.Mode, diff.Reason = domain.DiffModeSummary, domain.DiffReasonColumnsChanged
+	case previous.Truncated || previous.StoredTruncated || current.Truncated:
+		// Totals of partial results say nothing, so only the counts are compared
+		diff.Mode, diff.Reason = domain.DiffModeSummary, domain.DiffReasonTruncated
+		return diff
+	case len(previous.Rows) > rerunDiffMaxRows || len(current.Rows) > rerunDiffMaxRows:
+		diff.Mode, diff.Reason = domain.DiffModeSummary, domain.DiffReasonTooManyRows
+	}
+	if diff.Mode == domain.DiffModeSummary {
+		diff.Aggregates = columnTotalChanges(previous, current)
+		return diff
+	}
+
+	key := slices.Index(current.Columns, keyColumn)
+	if keyColumn != "" && key >= 0 && uniqueKeys(previous.Rows, key) && uniqueKeys(current.Rows, key) {
+		diff.KeyColumn = keyColumn
+		diffByKey(diff, previous.Rows, current.Rows, key)
+	} else {
+		diffByValues(diff, previous.Rows, current.Rows)
+	}
+
+	if len(previous.Rows) == 1 && len(current.Rows) == 1 {
+		// A single row is usually an aggregate, whose values are worth comparing
+		for i, column := range current.Columns {
+			before, okBefore := numericValue(previous.Rows[0][i])
+			after, okAfter := numericValue(current.Rows[0][i])
+			if okBefore && okAfter && before != after {
+				diff.Aggregates = append(diff.Aggregates, domain.ValueChange{Column: column, Previous: before, Current: after, Delta: after - before})
+			}
+		}
+	}
+	return diff
+}
+
+// diffByKey matches rows by the value of the column at key
+func diffByKey(diff *domain.ResultDiff, previous, current [][]any, key int) {
+	before := make(map[string][]any, len(previous))
+	for _, row := range previous {
+		before[valueKey(row[key])] = row
+	}
+	seen := make(map[string]bool, len(current))
+	for _, row := range current {
+		k := valueKey(row[key])
+		seen[k] = true
+		old, ok := before[k]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, row)
+		case valueKey(old) != valueKey(row):
+			diff.Changed = append(diff.Changed, domain.RowChange{Key: row[key], Previous: old, Current: row})
+		}
+	}
+	for _, row := range previous {
+		if !seen[valueKey(row[key])] {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+}
+
+// diffByValues matches rows by all their values, counting duplicates
+func diffByValues(diff *domain.ResultDiff, previous, current [][]any) {
+	diff.Removed = unmatchedRows(previous, current)
+	diff.Added = unmatchedRows(current, previous)
+}
+
+// unmatchedRows returns the rows of rows left over once each row of others has been
+// matched against an equal one
+func unmatchedRows(rows, others [][]any) [][]any {
+	counts := make(map[string]int, len(others))
+	for _, row := range others {
+		counts[valueKey(row)]++
+	}
+	unmatched := [][]any{}
+	for _, row := range rows {
+		k := valueKey(row)
+		if counts[k] > 0 {
+			counts[k]--
+			continue
+		}
+		unmatched = append(unmatched, row)
+	}
+	return unmatched
+}
+
+// uniqueKeys reports whether the column at key has no repeated values in rows
+func uniqueKeys(rows [][]any, key int) bool {
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		k := valueKey(row[key])
+		if seen[k] {
+			return false
+		}
+		seen[k] = true
+	}
+	return true
+}
+
+// columnTotalChanges compares the totals of the numeric columns both results have
+func columnTotalChanges(previous, current *domain.QueryResult) []domain.ValueChange {
+	changes := []domain.ValueChange{}
+	for i, column := range current.Columns {
+		j := slices.Index(previous.Columns, column)
+		if j < 0 {
+			continue
+		}
+		before, okBefore := columnTotal(previous.Rows, j)
+		after, okAfter := columnTotal(current.Rows, i)
+		if okBefore && okAfter && before != after {
+			changes = append(changes, domain.ValueChange{Column: column, Previous: before, Current: after, Delta: after - before})
+		}
+	}
+	return changes
+}
+
+// columnTotal sums the column at index, which must hold only numbers and NULLs
+func columnTotal(rows [][]any, index int) (float64, bool) {
+	var total float64
+	for _, row := range rows {
+		if row[index] == nil {
+			continue
+		}
+		n, ok := numericValue(row[index])
+		if !ok {
+			return 0, false
+		}
+		total += n
+	}
+	return total, true
+}
+
+// numericValue returns v as a number. Strings count when they hold one, since some
+// drivers return decimals as strings to keep their precision.
+func numericValue(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int8:
+		return float64(n), true
+	case int16:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint8:
+		return float64(n), true
+	case uint16:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// valueKey identifies a value by its JSON encoding, so values of a fresh result equal
+// those of a stored one, which were decoded from JSON
+func valueKey(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
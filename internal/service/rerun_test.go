@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffResults(t *testing.T) {
+	result := func(truncated bool, columns []string, rows ...[]any) *domain.QueryResult {
+		return &domain.QueryResult{Columns: columns, Rows: rows, RowCount: len(rows), Truncated: truncated}
+	}
+	cols := []string{"id", "total"}
+
+	t.Run("rows by value", func(t *testing.T) {
+		// Stored results come back from JSON, so their numbers are float64
+		diff := diffResults(
+			result(false, cols, []any{float64(1), float64(10)}, []any{float64(2), float64(20)}, []any{float64(2), float64(20)}),
+			result(false, cols, []any{int64(1), int64(10)}, []any{int64(2), int64(20)}, []any{int64(3), int64(30)}),
+			"",
+		)
+		assert.Equal(t, domain.DiffModeRows, diff.Mode)
+		assert.Equal(t, [][]any{{int64(3), int64(30)}}, diff.Added)
+		assert.Equal(t, [][]any{{float64(2), float64(20)}}, diff.Removed)
+		assert.Empty(t, diff.Changed)
+	})
+
+	t.Run("rows by key", func(t *testing.T) {
+		diff := diffResults(
+			result(false, cols, []any{1, 10}, []any{2, 20}),
+			result(false, cols, []any{1, 15}, []any{3, 30}),
+			"id",
+		)
+		assert.Equal(t, "id", diff.KeyColumn)
+		assert.Equal(t, [][]any{{3, 30}}, diff.Added)
+		assert.Equal(t, [][]any{{2, 20}}, diff.Removed)
+		assert.Equal(t, []domain.RowChange{{Key: 1, Previous: []any{1, 10}, Current: []any{1, 15}}}, diff.Changed)
+	})
+
+	t.Run("duplicate keys match by value", func(t *testing.T) {
+		diff := diffResults(
+			result(false, cols, []any{1, 10}, []any{1, 20}),
+			result(false, cols, []any{1, 10}, []any{1, 20}),
+			"id",
+		)
+		assert.Empty(t, diff.KeyColumn)
+		assert.Empty(t, diff.Added)
+		assert.Empty(t, diff.Removed)
+	})
+
+	t.Run("single row aggregates", func(t *testing.T) {
+		diff := diffResults(
+			result(false, []string{"count", "revenue"}, []any{float64(7), "100.50"}),
+			result(false, []string{"count", "revenue"}, []any{int64(9), "100.50"}),
+			"",
+		)
+		assert.Equal(t, []domain.ValueChange{{Column: "count", Previous: 7, Current: 9, Delta: 2}}, diff.Aggregates)
+	})
+
+	t.Run("truncated compares counts only", func(t *testing.T) {
+		diff := diffResults(
+			result(false, cols, []any{1, 10}),
+			result(true, cols, []any{1, 10}, []any{2, 20}),
+			"",
+		)
+		assert.Equal(t, domain.DiffModeSummary, diff.Mode)
+		assert.Equal(t, domain.DiffReasonTruncated, diff.Reason)
+		assert.Equal(t, 1, diff.PreviousRowCount)
+		assert.Equal(t, 2, diff.CurrentRowCount)
+		assert.Empty(t, diff.Aggregates)
+	})
+
+	t.Run("trimmed stored result compares counts only", func(t *testing.T) {
+		stored := result(false, cols, []any{1, 10}, []any{2, 20}, []any{3, 30}).ForStorage(domain.StoredResultLimit{MaxRows: 1})
+		diff := diffResults(stored, result(false, cols, []any{1, 10}, []any{2, 20}, []any{3, 30}), "")
+		assert.Equal(t, domain.DiffReasonTruncated, diff.Reason)
+		assert.Equal(t, 3, diff.PreviousRowCount)
+		assert.Empty(t, diff.Added)
+	})
+
+	t.Run("too many rows compares totals", func(t *testing.T) {
+		var previous, current [][]any
+		for i := range rerunDiffMaxRows + 1 {
+			previous = append(previous, []any{i, 1})
+			current = append(current, []any{i, 2})
+		}
+		diff := diffResults(result(false, cols, previous...), result(false, cols, current...), "")
+		assert.Equal(t, domain.DiffReasonTooManyRows, diff.Reason)
+		assert.Empty(t, diff.Added)
+		require.Len(t, diff.Aggregates, 1)
+		assert.Equal(t, "total", diff.Aggregates[0].Column)
+		assert.Equal(t, float64(rerunDiffMaxRows+1), diff.Aggregates[0].Delta)
+	})
+
+	t.Run("columns changed", func(t *testing.T) {
+		diff := diffResults(
+			result(false, []string{"id", "total"}, []any{1, 10}),
+			result(false, []string{"id", "total", "note"}, []any{1, 12, "x"}),
+			"",
+		)
+		assert.Equal(t, domain.DiffReasonColumnsChanged, diff.Reason)
+		assert.Equal(t, []domain.ValueChange{{Column: "total", Previous: 10, Current: 12, Delta: 2}}, diff.Aggregates)
+	})
+}
+
+func TestQueryService_Rerun(t *testing.T) {
+	ctx := context.Background()
+	sql := "SELECT COUNT(*) AS count FROM users"
+
+	setup := func(t *testing.T, message *domain.Message) *executeQueryFixture {
+		f := newExecuteQueryFixture(t)
+		message.ID = uuid.New()
+		message.WorkspaceID = f.workspaceID
+		f.messageRepo.On("GetByIDAndWorkspace", mock.Anything, message.ID, f.workspaceID).Return(message, nil)
+		return f
+	}
+
+	t.Run("success", func(t *testing.T) {
+		message := &domain.Message{
+			Role:     domain.RoleAssistant,
+			SQL:      sql,
+			Result:   &domain.QueryResult{Columns: []string{"count"}, Rows: [][]any{{float64(7)}}, RowCount: 1},
+			Metadata: &domain.QueryMetadata{},
+		}
+		f := setup(t, message)
+		message.Metadata.ConnectionID = f.connectionID
+		f.adapter.On("ValidateQuery", sql).Return(nil)
+		f.adapter.On("ExecuteQuery", mock.Anything, sql, mcp.QueryOptions{MaxRows: 100, Timeout: 30 * time.Second}).
+			Return(&mcp.QueryResult{Columns: []string{"count"}, Rows: [][]any{{int64(9)}}, RowCount: 1}, nil)
+
+		resp, err := f.svc.Rerun(ctx, f.userID, f.workspaceID, message.ID, domain.RerunRequest{})
+		require.NoError(t, err)
+
+		assert.Equal(t, message.Result, resp.Previous)
+		assert.Equal(t, 1, resp.Current.RowCount)
+		assert.Equal(t, []domain.ValueChange{{Column: "count", Previous: 7, Current: 9, Delta: 2}}, resp.Diff.Aggregates)
+		f.messageRepo.AssertNotCalled(t, "CreateConversationTurn", mock.Anything, mock.Anything)
+	})
+
+	t.Run("blocked by current rules", func(t *testing.T) {
+		message := &domain.Message{
+			Role:     domain.RoleAssistant,
+			SQL:      "SELECT pg_read_file('x')",
+			Result:   &domain.QueryResult{Columns: []string{"x"}},
+			Metadata: &domain.QueryMetadata{},
+		}
+		f := setup(t, message)
+		message.Metadata.ConnectionID = f.connectionID
+		f.adapter.On("ValidateQuery", message.SQL).Return(&mcp.ValidationError{Rule: "postgres: pg_read_file blocked"})
+
+		_, err := f.svc.Rerun(ctx, f.userID, f.workspaceID, message.ID, domain.RerunRequest{})
+		require.Error(t, err)
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+		f.adapter.AssertNotCalled(t, "ExecuteQuery", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("unknown key column", func(t *testing.T) {
+		message := &domain.Message{
+			Role:     domain.RoleAssistant,
+			SQL:      sql,
+			Result:   &domain.QueryResult{Columns: []string{"count"}},
+			Metadata: &domain.QueryMetadata{},
+		}
+		f := setup(t, message)
+
+		_, err := f.svc.Rerun(ctx, f.userID, f.workspaceID, message.ID, domain.RerunRequest{KeyColumn: "id"})
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+	})
+
+	t.Run("message not found", func(t *testing.T) {
+		f := newExecuteQueryFixture(t)
+		id := uuid.New()
+		f.messageRepo.On("GetByIDAndWorkspace", mock.Anything, id, f.workspaceID).Return(nil, nil)
+
+		_, err := f.svc.Rerun(ctx, f.userID, f.workspaceID, id, domain.RerunRequest{})
+		assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	})
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+// droppedTablesLookback is how many of a connection's latest schema changes are read
+// to find the tables dropped from it
+const droppedTablesLookback = 100
+
+// WithSchemaChanges logs how each refreshed schema differs from the one before it
+func (s *QueryService) WithSchemaChanges(repo domain.SchemaChangeRepository) *QueryService {
+	s.schemaChanges = repo
+	return s
+}
+
+// ListSchemaChanges returns the latest schema changes of a connection, newest first
+func (s *QueryService) ListSchemaChanges(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, limit int) ([]domain.SchemaChange, error) {
+	if _, err := s.connectionService.GetByID(ctx, userID, workspaceID, connectionID); err != nil {
+		return nil, err
+	}
+	if s.schemaChanges == nil {
+		return []domain.SchemaChange{}, nil
+	}
+	changes, err := s.schemaChanges.ListByConnection(ctx, connectionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schema changes: %w", err)
+	}
+	return changes, nil
+}
+
+// previousSchema returns the schema last loaded from a connection, stale or not, or
+// nil when none is kept
+func (s *QueryService) previousSchema(ctx context.Context, workspaceID, connectionID uuid.UUID) *domain.SchemaInfo {
+	if s.schemaStore != nil {
+		if stored, err := s.schemaStore.Get(ctx, connectionID); err == nil && stored != nil {
+			return stored
+		}
+	}
+	if s.schemaCache != nil {
+		if cached, err := s.schemaCache.Get(ctx, workspaceID, connectionID); err == nil && cached != nil {
+			return cached
+		}
+	}
+	return nil
+}
+
+// recordSchemaChange logs how a freshly loaded schema differs from the previous one
+// and notifies webhooks of destructive changes. It returns nil when the tables and
+// columns did not change.
+func (s *QueryService) recordSchemaChange(ctx context.Context, workspaceID, connectionID uuid.UUID, previous, current *domain.SchemaInfo) *domain.SchemaChange {
+	if previous == nil || current == nil || (previous.Hash != "" && previous.Hash == current.Hash) {
+		return nil
+	}
+	change := domain.DiffSchemas(previous, current)
+	if change == nil {
+		return nil
+	}
+	change.ID = uuid.New()
+	change.ConnectionID = connectionID
+	change.DetectedAt = time.Now()
+
+	if s.schemaChanges != nil {
+		if err := s.schemaChanges.Create(context.WithoutCancel(ctx), change); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to record schema change")
+		}
+	}
+	if change.Destructive && s.webhooks != nil {
+		s.webhooks.Emit(ctx, workspaceID, domain.WebhookEventSchemaDestructive, map[string]any{
+			"connection_id":  connectionID,
+			"removed_tables": change.RemovedTables,
+			"changed_tables": change.ChangedTables,
+		})
+	}
+	return change
+}
+
+// droppedTables returns the tables schema refreshes found dropped from a connection
+// and not added back, in lower case
+func (s *QueryService) droppedTables(ctx context.Context, connectionID uuid.UUID) map[string]bool {
+	if s.schemaChanges == nil {
+		return nil
+	}
+	changes, err := s.schemaChanges.ListByConnection(ctx, connectionID, droppedTablesLookback)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to read schema changes")
+		return nil
+	}
+	return domain.DroppedTables(changes)
+}
+
+// flagDroppedTables sets the DroppedTables of templates whose SQL reads tables that
+// were dropped from their connection
+func (s *QueryService) flagDroppedTables(ctx context.Context, templates []domain.QueryTemplate) {
+	dropped := map[uuid.UUID]map[string]bool{}
+	for i := range templates {
+		t := &templates[i]
+		tables, ok := dropped[t.ConnectionID]
+		if !ok {
+			tables = s.droppedTables(ctx, t.ConnectionID)
+			dropped[t.ConnectionID] = tables
+		}
+		if len(tables) == 0 {
+			continue
+		}
+		for _, name := range referencedTables(t.SQL) {
+			name = strings.Trim(name, "\"`[]")
+			if isDropped(tables, strings.ToLower(name)) {
+				t.DroppedTables = append(t.DroppedTables, name)
+			}
+		}
+	}
+}
+
+// isDropped reports whether name, qualified or not, is among the dropped tables
+func isDropped(dropped map[string]bool, name string) bool {
+	if dropped[name] {
+		return true
+	}
+	if strings.Contains(name, ".") {
+		return false
+	}
+	for table := range dropped {
+		if strings.HasSuffix(table, "."+name) {
+			return true
+		}
+	}
+	return false
+}
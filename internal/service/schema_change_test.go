@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySchemaChanges is a SchemaChangeRepository in memory
+type memorySchemaChanges struct {
+	changes []domain.SchemaChange // oldest first
+}
+
+func (m *memorySchemaChanges) Create(_ context.Context, change *domain.SchemaChange) error {
+	m.changes = append(m.changes, *change)
+	return nil
+}
+
+func (m *memorySchemaChanges) ListByConnection(_ context.Context, connectionID uuid.UUID, limit int) ([]domain.SchemaChange, error) {
+	var changes []domain.SchemaChange
+	for _, change := range slices.Backward(m.changes) {
+		if change.ConnectionID == connectionID && len(changes) < limit {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+func TestQueryService_RefreshSchemaChanges(t *testing.T) {
+	ctx := context.Background()
+	f := newExecuteQueryFixture(t)
+	store := memorySchemaStore{}
+	changes := &memorySchemaChanges{}
+	emitter := &recordingEmitter{}
+	f.svc.WithSchemaStore(store, time.Minute).WithSchemaChanges(changes).WithWebhooks(emitter)
+
+	// The fixture's database has only users, so legacy_orders was dropped since
+	store[f.connectionID] = domain.SchemaInfo{
+		Tables: []domain.TableInfo{
+			{Name: "users", Columns: []domain.ColumnInfo{{Name: "id", DataType: "uuid", PrimaryKey: true}}},
+			{Name: "legacy_orders", Columns: []domain.ColumnInfo{{Name: "id", DataType: "integer"}}},
+		},
+		Hash:     "previous",
+		CachedAt: time.Now(),
+	}
+
+	schema, err := f.svc.RefreshSchema(ctx, f.userID, f.workspaceID, f.connectionID)
+	require.NoError(t, err)
+	require.NotNil(t, schema.Changes)
+	assert.Equal(t, []string{"legacy_orders"}, schema.Changes.RemovedTables)
+	assert.True(t, schema.Changes.Destructive)
+	assert.Nil(t, store[f.connectionID].Changes, "the stored schema does not carry the change")
+
+	require.Len(t, changes.changes, 1)
+	assert.Equal(t, f.connectionID, changes.changes[0].ConnectionID)
+	assert.Equal(t, []string{domain.WebhookEventSchemaDestructive}, emitter.events)
+
+	// Refreshing again finds nothing new
+	schema, err = f.svc.RefreshSchema(ctx, f.userID, f.workspaceID, f.connectionID)
+	require.NoError(t, err)
+	assert.Nil(t, schema.Changes)
+	assert.Len(t, changes.changes, 1)
+
+	listed, err := f.svc.ListSchemaChanges(ctx, f.userID, f.workspaceID, f.connectionID, 10)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	assert.Equal(t, []string{"legacy_orders"}, listed[0].RemovedTables)
+
+	templates := []domain.QueryTemplate{
+		{ConnectionID: f.connectionID, SQL: "SELECT * FROM public.legacy_orders o JOIN users u ON u.id = o.user_id"},
+		{ConnectionID: f.connectionID, SQL: "SELECT COUNT(*) FROM users"},
+		{ConnectionID: uuid.New(), SQL: "SELECT * FROM legacy_orders"},
+	}
+	f.svc.flagDroppedTables(ctx, templates)
+	assert.Equal(t, []string{"legacy_orders"}, templates[0].DroppedTables)
+	assert.Empty(t, templates[1].DroppedTables)
+	assert.Empty(t, templates[2].DroppedTables, "dropped from another connection")
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+)
+
+// WriteSchemaExport writes schema to w in format, one of the SchemaExport formats. Every
+// format carries when the schema was read, so readers can tell how fresh it is.
+func WriteSchemaExport(w io.Writer, schema *domain.SchemaInfo, format string) error {
+	switch format {
+	case domain.SchemaExportJSON:
+		return json.NewEncoder(w).Encode(schema)
+	case domain.SchemaExportSQL:
+		bw := bufio.NewWriter(w)
+		fmt.Fprintf(bw, "-- %s schema read at %s\n\n", schema.DatabaseType, schema.CachedAt.UTC().Format(time.RFC3339))
+		bw.WriteString(schema.DDL)
+		if !strings.HasSuffix(schema.DDL, "\n") {
+			bw.WriteString("\n")
+		}
+		return bw.Flush()
+	case domain.SchemaExportMarkdown:
+		return writeSchemaMarkdown(w, schema)
+	default:
+		return fmt.Errorf("unknown schema export format %q", format)
+	}
+}
+
+// writeSchemaMarkdown writes a section per table listing its columns, the tables they
+// refer to and its indexes
+func writeSchemaMarkdown(w io.Writer, schema *domain.SchemaInfo) error {
+	references := domain.InferReferences(schema.Tables)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Schema\n\nDatabase type: %s  \nRead at: %s  \nTables: %d\n",
+		schema.DatabaseType, schema.CachedAt.UTC().Format(time.RFC3339), len(schema.Tables))
+
+	for _, table := range schema.Tables {
+		name := table.Name
+		if table.SchemaName != "" {
+			name = table.SchemaName + "." + table.Name
+		}
+		fmt.Fprintf(bw, "\n## %s\n\n", markdownCell(name))
+		if table.RowCount != nil {
+			fmt.Fprintf(bw, "About %s rows.\n\n", strconv.FormatInt(*table.RowCount, 10))
+		}
+		if table.Role != "" {
+			fmt.Fprintf(bw, "Role: %s.\n\n", table.Role)
+		}
+		if table.Description != "" {
+			fmt.Fprintf(bw, "%s\n\n", markdownCell(table.Description))
+		}
+
+		bw.WriteString("| Column | Type | Nullable | Key | Description |\n")
+		bw.WriteString("| --- | --- | --- | --- | --- |\n")
+		for _, col := range table.Columns {
+			nullable, key := "no", ""
+			if col.Nullable {
+				nullable = "yes"
+			}
+			if col.PrimaryKey {
+				key = "PK"
+			}
+			fmt.Fprintf(bw, "| %s | %s | %s | %s | %s |\n",
+				markdownCell(col.Name), markdownCell(col.DataType), nullable, key, markdownCell(col.Description))
+		}
+
+		if refs := references[table.Name]; len(refs) > 0 {
+			bw.WriteString("\nReferences:\n\n")
+			for _, ref := range refs {
+				fmt.Fprintf(bw, "- %s → %s\n", markdownCell(ref.Column), markdownCell(ref.Table))
+			}
+		}
+
+		if len(table.Indexes) > 0 {
+			bw.WriteString("\nIndexes:\n\n")
+			for _, idx := range table.Indexes {
+				unique := ""
+				if idx.Unique {
+					unique = " (unique)"
+				}
+				fmt.Fprintf(bw, "- %s on %s%s\n", markdownCell(idx.Name), markdownCell(strings.Join(idx.Columns, ", ")), unique)
+			}
+		}
+	}
+
+	if len(schema.Warnings) > 0 {
+		bw.WriteString("\n## Tables left out\n\n")
+		for _, warning := range schema.Warnings {
+			fmt.Fprintf(bw, "- %s: %s\n", markdownCell(warning.Table), markdownCell(warning.Error))
+		}
+	}
+	return bw.Flush()
+}
+
+// markdownCell escapes text for a markdown table cell
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteSchemaExport(t *testing.T) {
+	rows := int64(1200)
+	schema := &domain.SchemaInfo{
+		DatabaseType: "postgres",
+		CachedAt:     time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		DDL:          "CREATE TABLE orders (id INT PRIMARY KEY, total NUMERIC);",
+		Tables: []domain.TableInfo{{
+			Name:       "orders",
+			SchemaName: "sales",
+			RowCount:   &rows,
+			Columns: []domain.ColumnInfo{
+				{Name: "id", DataType: "integer", PrimaryKey: true},
+				{Name: "total", DataType: "numeric", Nullable: true, Description: "gross | net\nof tax"},
+				{Name: "customer_id", DataType: "integer"},
+			},
+			Indexes: []domain.IndexInfo{{Name: "orders_total_idx", Columns: []string{"total"}}},
+		}, {
+			Name:    "customers",
+			Columns: []domain.ColumnInfo{{Name: "id", DataType: "integer", PrimaryKey: true}},
+		}},
+		Warnings: []domain.SchemaWarning{{Table: "payments", Error: "permission denied"}},
+	}
+
+	t.Run("sql", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteSchemaExport(&buf, schema, domain.SchemaExportSQL))
+		assert.Equal(t, "-- postgres schema read at 2024-05-01T12:00:00Z\n\n"+schema.DDL+"\n", buf.String())
+	})
+
+	t.Run("markdown", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteSchemaExport(&buf, schema, domain.SchemaExportMarkdown))
+		doc := buf.String()
+		assert.Contains(t, doc, "Read at: 2024-05-01T12:00:00Z")
+		assert.Contains(t, doc, "## sales.orders\n\nAbout 1200 rows.")
+		assert.Contains(t, doc, "| id | integer | no | PK |  |\n")
+		assert.Contains(t, doc, `| total | numeric | yes |  | gross \| net of tax |`)
+		assert.Contains(t, doc, "References:\n\n- customer_id → customers\n")
+		assert.Contains(t, doc, "- orders_total_idx on total\n")
+		assert.Contains(t, doc, "- payments: permission denied\n")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteSchemaExport(&buf, schema, domain.SchemaExportJSON))
+		var decoded domain.SchemaInfo
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, schema.CachedAt, decoded.CachedAt)
+		assert.Len(t, decoded.Tables, 2)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		assert.Error(t, WriteSchemaExport(&bytes.Buffer{}, schema, "yaml"))
+	})
+}
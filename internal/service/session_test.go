@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newSessionTestService(workspaceID, userID uuid.UUID, sessionRepo *MockSessionRepository) *QueryService {
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).
+		Return(&domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: domain.RoleMember}, nil)
+
+	return &QueryService{
+		sessionRepo:   sessionRepo,
+		messageRepo:   new(MockMessageRepository),
+		workspaceRepo: workspaceRepo,
+	}
+}
+
+func TestDeleteSession_SoftDeletes(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID, sessionID := uuid.New(), uuid.New(), uuid.New()
+
+	sessionRepo := new(MockSessionRepository)
+	sessionRepo.On("Get", ctx, sessionID).Return(&domain.ChatSession{ID: sessionID, WorkspaceID: workspaceID}, nil)
+	sessionRepo.On("SoftDelete", ctx, sessionID).Return(nil)
+	s := newSessionTestService(workspaceID, userID, sessionRepo)
+
+	require.NoError(t, s.DeleteSession(ctx, userID, workspaceID, sessionID))
+	sessionRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestDeletedSessionIsHidden(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID, sessionID := uuid.New(), uuid.New(), uuid.New()
+	deletedAt := time.Now().Add(-time.Hour)
+
+	sessionRepo := new(MockSessionRepository)
+	sessionRepo.On("Get", ctx, sessionID).
+		Return(&domain.ChatSession{ID: sessionID, WorkspaceID: workspaceID, DeletedAt: &deletedAt}, nil)
+	s := newSessionTestService(workspaceID, userID, sessionRepo)
+
+	_, err := s.GetSessionHistory(ctx, userID, workspaceID, sessionID)
+	assert.EqualError(t, err, "session not found")
+
+	err = s.DeleteSession(ctx, userID, workspaceID, sessionID)
+	assert.EqualError(t, err, "session not found")
+}
+
+func TestRestoreSession(t *testing.T) {
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name    string
+		session func(id uuid.UUID) *domain.ChatSession
+		wantErr string
+	}{
+		{
+			name: "within retention window",
+			session: func(id uuid.UUID) *domain.ChatSession {
+				deletedAt := time.Now().Add(-24 * time.Hour)
+				return &domain.ChatSession{ID: id, WorkspaceID: workspaceID, DeletedAt: &deletedAt}
+			},
+		},
+		{
+			name: "past retention window",
+			session: func(id uuid.UUID) *domain.ChatSession {
+				deletedAt := time.Now().Add(-domain.SessionRetention - time.Hour)
+				return &domain.ChatSession{ID: id, WorkspaceID: workspaceID, DeletedAt: &deletedAt}
+			},
+			wantErr: "session not found",
+		},
+		{
+			name: "not deleted",
+			session: func(id uuid.UUID) *domain.ChatSession {
+				return &domain.ChatSession{ID: id, WorkspaceID: workspaceID}
+			},
+			wantErr: "session is not deleted",
+		},
+		{
+			name: "other workspace",
+			session: func(id uuid.UUID) *domain.ChatSession {
+				deletedAt := time.Now()
+				return &domain.ChatSession{ID: id, WorkspaceID: uuid.New(), DeletedAt: &deletedAt}
+			},
+			wantErr: "session not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionID := uuid.New()
+			sessionRepo := new(MockSessionRepository)
+			sessionRepo.On("Get", ctx, sessionID).Return(tt.session(sessionID), nil)
+			sessionRepo.On("Restore", ctx, sessionID).Return(nil).Maybe()
+			s := newSessionTestService(workspaceID, userID, sessionRepo)
+
+			session, err := s.RestoreSession(ctx, userID, workspaceID, sessionID)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				sessionRepo.AssertNotCalled(t, "Restore", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			assert.Nil(t, session.DeletedAt)
+			sessionRepo.AssertCalled(t, "Restore", ctx, sessionID)
+		})
+	}
+}
+
+func TestRetentionJanitor_Sweep(t *testing.T) {
+	ctx := context.Background()
+	sessionRepo := new(MockSessionRepository)
+	sessionRepo.On("PurgeDeleted", ctx, mock.MatchedBy(func(before time.Time) bool {
+		cutoff := time.Now().Add(-domain.SessionRetention)
+		return before.Sub(cutoff).Abs() < time.Minute
+	})).Return(int64(3), nil)
+
+	purged, err := NewRetentionJanitor(sessionRepo, time.Hour).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	sessionRepo.AssertExpectations(t)
+}
+
+func TestSessionTitle(t *testing.T) {
+	assert.Equal(t, "Count users", sessionTitle("  Count users "))
+	assert.Equal(t, "How many orders were placed la...", sessionTitle("How many orders were placed last month?"))
+	// Truncation counts runes so multi-byte characters are never split
+	assert.Equal(t, strings.Repeat("é", 30)+"...", sessionTitle(strings.Repeat("é", 40)))
+	assert.Equal(t, strings.Repeat("订单", 15)+"...", sessionTitle(strings.Repeat("订单", 20)))
+	assert.Equal(t, "Berapa pesanan hari ini "+strings.Repeat("🛒", 6)+"...", sessionTitle("Berapa pesanan hari ini "+strings.Repeat("🛒", 10)))
+}
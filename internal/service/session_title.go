@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// titleWorkerCount bounds the LLM calls made for session titles at once
+	titleWorkerCount = 4
+	// titleQueueSize is how many sessions may wait for a title. Sessions beyond it
+	// keep their provisional title.
+	titleQueueSize = 100
+)
+
+// titleJob asks for a generated title for a session
+type titleJob struct {
+	sessionID uuid.UUID
+	question  string
+	provider  string
+	model     string
+}
+
+// enqueueSessionTitle queues title generation for a session unless it is already
+// queued or running
+func (s *QueryService) enqueueSessionTitle(job titleJob) {
+	if _, pending := s.titlePending.LoadOrStore(job.sessionID, struct{}{}); pending {
+		return
+	}
+	s.titleWorkers.Do(s.startTitleWorkers)
+
+	select {
+	case s.titleQueue <- job:
+	default:
+		s.titlePending.Delete(job.sessionID)
+		log.Warn().Str("session_id", job.sessionID.String()).Msg("session title queue full, keeping provisional title")
+	}
+}
+
+// startTitleWorkers starts the workers that generate session titles
+func (s *QueryService) startTitleWorkers() {
+	s.titleQueue = make(chan titleJob, titleQueueSize)
+	for range titleWorkerCount {
+		s.goBackground(func(ctx context.Context) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-s.titleQueue:
+					s.generateSessionTitle(ctx, job.sessionID, job.question, job.provider, job.model)
+					s.titlePending.Delete(job.sessionID)
+				}
+			}
+		})
+	}
+}
+
+// generateSessionTitle generates and updates the session title using LLM
+func (s *QueryService) generateSessionTitle(ctx context.Context, sessionID uuid.UUID, question string, providerName string, modelName string) {
+	// 1. Get LLM provider
+	// Fetch user config for LLM (need userID from session)
+	// Since we only have sessionID here, we first get the session to find userID
+	session, err := s.sessionRepo.Get(ctx, sessionID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get session for title generation")
+		return
+	}
+	if session.UserID == nil {
+		// Anonymous session? fallback to system default
+		log.Warn().Msg("session has no user ID, using default config")
+	}
+	if session.Title != domain.DefaultSessionTitle && session.Title != sessionTitle(question) {
+		// Renamed, or titled after an earlier question
+		return
+	}
+
+	// The workspace allowlist may have changed since the question was asked
+	settings, err := s.workspaceSettings(ctx, session.WorkspaceID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get workspace settings for title generation")
+		return
+	}
+	if providerName == "" {
+		providerName = settings.DefaultProvider(s.llmRouter.DefaultProvider())
+	}
+	var userID uuid.UUID
+	if session.UserID != nil {
+		userID = *session.UserID
+	}
+	if err := s.checkProvider(ctx, settings, session.WorkspaceID, userID, providerName, "session_title"); err != nil {
+		log.Warn().Str("session_id", sessionID.String()).Str("provider", providerName).Msg("llm provider not allowed, keeping provisional title")
+		return
+	}
+
+	var llmConfig map[string]any
+	if session.UserID != nil {
+		user, err := s.userRepo.GetByID(ctx, *session.UserID)
+		if err == nil && user != nil {
+			llmConfig = s.providerConfig(user, providerName)
+		}
+	}
+
+	provider, err := s.llmRouter.GetProviderWithConfig(providerName, llmConfig)
+	if err != nil {
+		log.Error().Err(err).Str("provider", providerName).Msg("failed to get LLM provider for title generation")
+		return
+	}
+
+	// 2. Generate title
+	// Use a reasonable timeout
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if modelName == "" {
+		modelName = provider.DefaultModel()
+	}
+	// Titles wait their turn at the provider, giving up with the timeout
+	releaseLLM, err := s.llmRouter.Acquire(ctx, providerName, "")
+	if err != nil {
+		log.Warn().Err(err).Str("session_id", sessionID.String()).Msg("llm busy, keeping provisional title")
+		return
+	}
+	defer releaseLLM()
+	titleStart := time.Now()
+	title, err := provider.GenerateTitle(ctx, question, modelName)
+	releaseLLM()
+	s.metrics.ObserveLLMCall(providerName, modelName, time.Since(titleStart), 0, err)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to generate session title")
+		return
+	}
+	title = llm.CleanTitle(title)
+	if title == "" || title == domain.DefaultSessionTitle {
+		// Nothing better than the provisional title, which stays
+		return
+	}
+
+	// 3. Update session (we already fetched it)
+	session.Title = title
+	session.UpdatedAt = time.Now()
+
+	if err := s.sessionRepo.Update(ctx, session); err != nil {
+		log.Error().Err(err).Msg("failed to update session title")
+	}
+
+	log.Info().Str("session_id", sessionID.String()).Str("title", title).Msg("updated session title")
+}
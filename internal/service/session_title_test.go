@@ -0,0 +1,155 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/llm"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newTitleTestService(sessionRepo *MockSessionRepository, provider *MockLLMProvider) *QueryService {
+	provider.On("Name").Return("mock-provider")
+	provider.On("IsConfigured").Return(true)
+	provider.On("DefaultModel").Return("mock-model")
+	llmRouter := llm.NewRouter("mock-provider")
+	llmRouter.RegisterProvider(provider)
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetByID", mock.Anything, mock.Anything).Return(&domain.Workspace{}, nil)
+
+	return &QueryService{sessionRepo: sessionRepo, llmRouter: llmRouter, workspaceRepo: workspaceRepo}
+}
+
+// titlesSettled waits until no title is queued or being generated
+func titlesSettled(t *testing.T, svc *QueryService) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		pending := 0
+		svc.titlePending.Range(func(any, any) bool {
+			pending++
+			return true
+		})
+		return pending == 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestQueryService_SessionTitleRunsOncePerSession(t *testing.T) {
+	sessionID := uuid.New()
+	sessionRepo := new(MockSessionRepository)
+	sessionRepo.On("Get", mock.Anything, sessionID).
+		Return(&domain.ChatSession{ID: sessionID, Title: "Count users"}, nil)
+	updated := make(chan string, 2)
+	sessionRepo.On("Update", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { updated <- args.Get(1).(*domain.ChatSession).Title }).
+		Return(nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	provider := new(MockLLMProvider)
+	provider.On("GenerateTitle", mock.Anything, "Count users", "mock-model").
+		Run(func(mock.Arguments) {
+			close(started)
+			<-release
+		}).
+		Return("User count", nil).Once()
+	svc := newTitleTestService(sessionRepo, provider)
+
+	job := titleJob{sessionID: sessionID, question: "Count users", provider: "mock-provider"}
+	svc.enqueueSessionTitle(job)
+	<-started
+	svc.enqueueSessionTitle(job) // a second message while the title is generated
+	close(release)
+
+	assert.Equal(t, "User count", <-updated)
+	titlesSettled(t, svc)
+	provider.AssertNumberOfCalls(t, "GenerateTitle", 1)
+}
+
+func TestQueryService_SessionTitleSkipsTitledSessions(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+	}{
+		{"renamed by the user", "Quarterly revenue"},
+		{"titled after an earlier question", "List orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessionID := uuid.New()
+			sessionRepo := new(MockSessionRepository)
+			sessionRepo.On("Get", mock.Anything, sessionID).
+				Return(&domain.ChatSession{ID: sessionID, Title: tt.title}, nil)
+			provider := new(MockLLMProvider)
+			svc := newTitleTestService(sessionRepo, provider)
+
+			svc.enqueueSessionTitle(titleJob{sessionID: sessionID, question: "Count users", provider: "mock-provider"})
+			titlesSettled(t, svc)
+
+			sessionRepo.AssertCalled(t, "Get", mock.Anything, sessionID)
+			provider.AssertNotCalled(t, "GenerateTitle", mock.Anything, mock.Anything, mock.Anything)
+			sessionRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestQueryService_SessionTitleKeepsProvisionalTitle(t *testing.T) {
+	for _, generated := range []string{domain.DefaultSessionTitle, "  \"\"  "} {
+		sessionID := uuid.New()
+		sessionRepo := new(MockSessionRepository)
+		sessionRepo.On("Get", mock.Anything, sessionID).
+			Return(&domain.ChatSession{ID: sessionID, Title: "Berapa pesanan hari ini?"}, nil)
+		provider := new(MockLLMProvider)
+		provider.On("GenerateTitle", mock.Anything, "Berapa pesanan hari ini?", "mock-model").Return(generated, nil)
+		svc := newTitleTestService(sessionRepo, provider)
+
+		svc.enqueueSessionTitle(titleJob{sessionID: sessionID, question: "Berapa pesanan hari ini?", provider: "mock-provider"})
+		titlesSettled(t, svc)
+
+		provider.AssertCalled(t, "GenerateTitle", mock.Anything, "Berapa pesanan hari ini?", "mock-model")
+		sessionRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	}
+}
+
+func TestQueryService_SessionTitleHonorsAllowlist(t *testing.T) {
+	sessionID, workspaceID, userID := uuid.New(), uuid.New(), uuid.New()
+	sessionRepo := new(MockSessionRepository)
+	sessionRepo.On("Get", mock.Anything, sessionID).
+		Return(&domain.ChatSession{ID: sessionID, WorkspaceID: workspaceID, UserID: &userID, Title: "Count users"}, nil)
+	provider := new(MockLLMProvider)
+	svc := newTitleTestService(sessionRepo, provider)
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetByID", mock.Anything, workspaceID).
+		Return(&domain.Workspace{ID: workspaceID, Settings: domain.WorkspaceSettings{LLMProviderAllowlist: []string{"ollama"}}}, nil)
+	svc.workspaceRepo = workspaceRepo
+	audit := new(MockAuditLogRepository)
+	audit.On("Create", mock.Anything, mock.Anything).Return(nil)
+	svc.WithAudit(audit)
+
+	svc.enqueueSessionTitle(titleJob{sessionID: sessionID, question: "Count users", provider: "mock-provider"})
+	titlesSettled(t, svc)
+
+	provider.AssertNotCalled(t, "GenerateTitle", mock.Anything, mock.Anything, mock.Anything)
+	sessionRepo.AssertNotCalled(t, "Update", mock.Anything, mock.Anything)
+	audit.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(entry *domain.AuditLog) bool {
+		return entry.Action == domain.AuditActionProviderDenied && entry.WorkspaceID == workspaceID &&
+			entry.UserID == userID && entry.Metadata["provider"] == "mock-provider"
+	}))
+}
+
+func TestQueryService_SessionTitleQueueFull(t *testing.T) {
+	svc := &QueryService{}
+	svc.titleWorkers.Do(func() { svc.titleQueue = make(chan titleJob, 1) }) // no workers
+
+	first, second := uuid.New(), uuid.New()
+	svc.enqueueSessionTitle(titleJob{sessionID: first})
+	svc.enqueueSessionTitle(titleJob{sessionID: second})
+
+	_, queued := svc.titlePending.Load(first)
+	assert.True(t, queued)
+	_, queued = svc.titlePending.Load(second)
+	assert.False(t, queued, "a dropped session can be queued again later")
+	assert.Len(t, svc.titleQueue, 1)
+}
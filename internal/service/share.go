@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultMaxShareTTL is the longest a share link may live when the server sets no maximum
+const DefaultMaxShareTTL = 30 * 24 * time.Hour
+
+// errShareNotFound hides whether a link never existed, expired or was revoked
+var errShareNotFound = apperr.New(apperr.NotFound, "share not found")
+
+// ShareService manages read-only links to stored answers. Links show what was stored
+// when the question was answered; nothing is executed again.
+type ShareService struct {
+	shareRepo     domain.SharedResultRepository
+	messageRepo   domain.MessageRepository
+	workspaceRepo domain.WorkspaceRepository
+	maxTTL        time.Duration
+	now           func() time.Time
+}
+
+// NewShareService creates a new share service. maxTTL caps the lifetime of links;
+// 0 uses DefaultMaxShareTTL.
+func NewShareService(shareRepo domain.SharedResultRepository, messageRepo domain.MessageRepository, workspaceRepo domain.WorkspaceRepository, maxTTL time.Duration) *ShareService {
+	if maxTTL <= 0 {
+		maxTTL = DefaultMaxShareTTL
+	}
+	return &ShareService{
+		shareRepo:     shareRepo,
+		messageRepo:   messageRepo,
+		workspaceRepo: workspaceRepo,
+		maxTTL:        maxTTL,
+		now:           time.Now,
+	}
+}
+
+// Create shares an assistant message. The token is returned only in this response.
+func (s *ShareService) Create(ctx context.Context, userID, workspaceID, messageID uuid.UUID, input domain.SharedResultCreate) (*domain.SharedResultInfo, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+	ttl := time.Duration(input.ExpiresInSeconds) * time.Second
+	if ttl <= 0 {
+		return nil, apperr.New(apperr.Validation, "expires_in_seconds is required")
+	}
+	if ttl > s.maxTTL {
+		return nil, apperr.Newf(apperr.Validation, "share links may last at most %d seconds", int64(s.maxTTL.Seconds()))
+	}
+
+	message, err := s.messageRepo.GetByIDAndWorkspace(ctx, messageID, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return nil, apperr.New(apperr.NotFound, "message not found")
+	}
+	if message.Role != domain.RoleAssistant || message.SQL == "" {
+		return nil, apperr.New(apperr.Validation, "only answers with SQL can be shared")
+	}
+
+	token, tokenHash, err := generateShareToken()
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	share := &domain.SharedResult{
+		ID:          uuid.New(),
+		TokenHash:   tokenHash,
+		WorkspaceID: workspaceID,
+		MessageID:   messageID,
+		CreatedBy:   &userID,
+		ExpiresAt:   now.Add(ttl),
+		CreatedAt:   now,
+	}
+	if input.Passcode != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Passcode), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash passcode: %w", err)
+		}
+		share.PasscodeHash = string(hash)
+	}
+	if err := s.shareRepo.Create(ctx, share); err != nil {
+		return nil, err
+	}
+
+	info := s.toInfo(share)
+	info.Token = token
+	return info, nil
+}
+
+// List lists the shares of a workspace. Admins see every share, other members only
+// their own.
+func (s *ShareService) List(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.SharedResultInfo, error) {
+	member, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember)
+	if err != nil {
+		return nil, err
+	}
+
+	var createdBy *uuid.UUID
+	if !domain.RoleAtLeast(member.Role, domain.RoleAdmin) {
+		createdBy = &userID
+	}
+	shares, err := s.shareRepo.ListByWorkspace(ctx, workspaceID, createdBy)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]domain.SharedResultInfo, 0, len(shares))
+	for i := range shares {
+		infos = append(infos, *s.toInfo(&shares[i]))
+	}
+	return infos, nil
+}
+
+// Revoke disables a share at once. Its creator and workspace admins may revoke it.
+func (s *ShareService) Revoke(ctx context.Context, userID, workspaceID, shareID uuid.UUID) error {
+	member, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember)
+	if err != nil {
+		return err
+	}
+
+	share, err := s.shareRepo.GetByIDAndWorkspace(ctx, shareID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if share == nil {
+		return errShareNotFound
+	}
+	ownShare := share.CreatedBy != nil && *share.CreatedBy == userID
+	if !ownShare && !domain.RoleAtLeast(member.Role, domain.RoleAdmin) {
+		return apperr.New(apperr.Forbidden, "only the creator or an admin can revoke a share")
+	}
+	return s.shareRepo.Revoke(ctx, share.ID, s.now())
+}
+
+// View returns what a share link shows, without authentication. Links that are
+// unknown, expired or revoked are all reported as not found.
+func (s *ShareService) View(ctx context.Context, token, passcode string) (*domain.SharedResultView, error) {
+	if token == "" {
+		return nil, errShareNotFound
+	}
+	share, err := s.shareRepo.GetByTokenHash(ctx, hashShareToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if share == nil || !share.Active(s.now()) {
+		return nil, errShareNotFound
+	}
+	if share.PasscodeHash != "" {
+		if passcode == "" {
+			return nil, apperr.New(apperr.Forbidden, "passcode required")
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(share.PasscodeHash), []byte(passcode)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return nil, apperr.New(apperr.Forbidden, "invalid passcode")
+			}
+			return nil, fmt.Errorf("failed to check passcode: %w", err)
+		}
+	}
+
+	// The message is gone when its session was deleted
+	message, err := s.messageRepo.GetByIDAndWorkspace(ctx, share.MessageID, share.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message == nil {
+		return nil, errShareNotFound
+	}
+	question, err := s.messageRepo.GetQuestion(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.SharedResultView{
+		Question:    question,
+		SQL:         message.SQL,
+		Result:      message.Result,
+		Explanation: message.Content,
+		AnsweredAt:  message.CreatedAt,
+		ExpiresAt:   share.ExpiresAt,
+	}, nil
+}
+
+func (s *ShareService) toInfo(share *domain.SharedResult) *domain.SharedResultInfo {
+	return &domain.SharedResultInfo{
+		ID:                share.ID,
+		MessageID:         share.MessageID,
+		CreatedBy:         share.CreatedBy,
+		PasscodeProtected: share.PasscodeHash != "",
+		ExpiresAt:         share.ExpiresAt,
+		RevokedAt:         share.RevokedAt,
+		CreatedAt:         share.CreatedAt,
+		Active:            share.Active(s.now()),
+	}
+}
+
+// generateShareToken returns a random token and the hash stored in its place
+func generateShareToken() (string, []byte, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("failed to generate share token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashShareToken(token), nil
+}
+
+func hashShareToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestShareService(role string) (*ShareService, *MockSharedResultRepository, *MockMessageRepository, uuid.UUID, uuid.UUID) {
+	shareRepo := new(MockSharedResultRepository)
+	messageRepo := new(MockMessageRepository)
+	workspaceRepo := new(MockWorkspaceRepository)
+	userID, workspaceID := uuid.New(), uuid.New()
+	workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).
+		Return(&domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role}, nil)
+
+	svc := NewShareService(shareRepo, messageRepo, workspaceRepo, 24*time.Hour)
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	return svc, shareRepo, messageRepo, userID, workspaceID
+}
+
+func TestShareService_Create(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("stores only hashes", func(t *testing.T) {
+		svc, shareRepo, messageRepo, userID, workspaceID := newTestShareService(domain.RoleMember)
+		message := &domain.Message{ID: uuid.New(), WorkspaceID: workspaceID, Role: domain.RoleAssistant, SQL: "SELECT 1"}
+		messageRepo.On("GetByIDAndWorkspace", mock.Anything, message.ID, workspaceID).Return(message, nil)
+		var stored *domain.SharedResult
+		shareRepo.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*domain.SharedResult)
+		}).Return(nil)
+
+		info, err := svc.Create(ctx, userID, workspaceID, message.ID, domain.SharedResultCreate{ExpiresInSeconds: 3600, Passcode: "open sesame"})
+		require.NoError(t, err)
+
+		require.NotEmpty(t, info.Token)
+		assert.True(t, info.PasscodeProtected)
+		assert.True(t, info.Active)
+		assert.Equal(t, svc.now().Add(time.Hour), info.ExpiresAt)
+		assert.Equal(t, hashShareToken(info.Token), stored.TokenHash)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored.PasscodeHash), []byte("open sesame")))
+	})
+
+	t.Run("expiry over the maximum", func(t *testing.T) {
+		svc, _, _, userID, workspaceID := newTestShareService(domain.RoleMember)
+
+		_, err := svc.Create(ctx, userID, workspaceID, uuid.New(), domain.SharedResultCreate{ExpiresInSeconds: 2 * 86400})
+		require.Error(t, err)
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+	})
+
+	t.Run("question instead of answer", func(t *testing.T) {
+		svc, _, messageRepo, userID, workspaceID := newTestShareService(domain.RoleMember)
+		message := &domain.Message{ID: uuid.New(), WorkspaceID: workspaceID, Role: domain.RoleUser, Content: "How many?"}
+		messageRepo.On("GetByIDAndWorkspace", mock.Anything, message.ID, workspaceID).Return(message, nil)
+
+		_, err := svc.Create(ctx, userID, workspaceID, message.ID, domain.SharedResultCreate{ExpiresInSeconds: 3600})
+		require.Error(t, err)
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+	})
+
+	t.Run("viewer", func(t *testing.T) {
+		svc, _, _, userID, workspaceID := newTestShareService(domain.RoleViewer)
+
+		_, err := svc.Create(ctx, userID, workspaceID, uuid.New(), domain.SharedResultCreate{ExpiresInSeconds: 3600})
+		require.Error(t, err)
+		assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+	})
+}
+
+func TestShareService_View(t *testing.T) {
+	ctx := context.Background()
+	sessionID := uuid.New()
+	passcodeHash, err := bcrypt.GenerateFromPassword([]byte("open sesame"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	setup := func(t *testing.T, share *domain.SharedResult) (*ShareService, string) {
+		svc, shareRepo, messageRepo, _, workspaceID := newTestShareService(domain.RoleMember)
+		token, tokenHash, err := generateShareToken()
+		require.NoError(t, err)
+		share.TokenHash = tokenHash
+		share.WorkspaceID = workspaceID
+		share.MessageID = uuid.New()
+		shareRepo.On("GetByTokenHash", mock.Anything, tokenHash).Return(share, nil)
+		shareRepo.On("GetByTokenHash", mock.Anything, mock.Anything).Return(nil, nil)
+
+		answer := &domain.Message{
+			ID:          share.MessageID,
+			WorkspaceID: workspaceID,
+			SessionID:   &sessionID,
+			Role:        domain.RoleAssistant,
+			Content:     "Counts the orders.",
+			SQL:         "SELECT COUNT(*) FROM orders",
+			Result:      &domain.QueryResult{Columns: []string{"count"}, Rows: [][]any{{42}}, RowCount: 1},
+			Metadata:    &domain.QueryMetadata{ConnectionID: uuid.New(), DatabaseType: "postgres"},
+		}
+		messageRepo.On("GetByIDAndWorkspace", mock.Anything, answer.ID, workspaceID).Return(answer, nil)
+		messageRepo.On("GetQuestion", mock.Anything, answer).Return("How many orders?", nil)
+		return svc, token
+	}
+
+	t.Run("open link", func(t *testing.T) {
+		svc, token := setup(t, &domain.SharedResult{ExpiresAt: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)})
+
+		view, err := svc.View(ctx, token, "")
+		require.NoError(t, err)
+		assert.Equal(t, "How many orders?", view.Question)
+		assert.Equal(t, "SELECT COUNT(*) FROM orders", view.SQL)
+		assert.Equal(t, 1, view.Result.RowCount)
+		assert.Equal(t, "Counts the orders.", view.Explanation)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		svc, _ := setup(t, &domain.SharedResult{ExpiresAt: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)})
+
+		_, err := svc.View(ctx, "not-a-token", "")
+		assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		svc, token := setup(t, &domain.SharedResult{ExpiresAt: time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)})
+
+		_, err := svc.View(ctx, token, "")
+		assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		revokedAt := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+		svc, token := setup(t, &domain.SharedResult{ExpiresAt: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC), RevokedAt: &revokedAt})
+
+		_, err := svc.View(ctx, token, "")
+		assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	})
+
+	t.Run("passcode", func(t *testing.T) {
+		svc, token := setup(t, &domain.SharedResult{
+			ExpiresAt:    time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC),
+			PasscodeHash: string(passcodeHash),
+		})
+
+		_, err := svc.View(ctx, token, "")
+		assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+		_, err = svc.View(ctx, token, "wrong")
+		assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+		view, err := svc.View(ctx, token, "open sesame")
+		require.NoError(t, err)
+		assert.Equal(t, "How many orders?", view.Question)
+	})
+}
+
+func TestShareService_Revoke(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("someone else's share", func(t *testing.T) {
+		svc, shareRepo, _, userID, workspaceID := newTestShareService(domain.RoleMember)
+		creator := uuid.New()
+		share := &domain.SharedResult{ID: uuid.New(), WorkspaceID: workspaceID, CreatedBy: &creator}
+		shareRepo.On("GetByIDAndWorkspace", mock.Anything, share.ID, workspaceID).Return(share, nil)
+
+		err := svc.Revoke(ctx, userID, workspaceID, share.ID)
+		assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+		shareRepo.AssertNotCalled(t, "Revoke", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		svc, shareRepo, _, userID, workspaceID := newTestShareService(domain.RoleAdmin)
+		creator := uuid.New()
+		share := &domain.SharedResult{ID: uuid.New(), WorkspaceID: workspaceID, CreatedBy: &creator}
+		shareRepo.On("GetByIDAndWorkspace", mock.Anything, share.ID, workspaceID).Return(share, nil)
+		shareRepo.On("Revoke", mock.Anything, share.ID, svc.now()).Return(nil)
+
+		require.NoError(t, svc.Revoke(ctx, userID, workspaceID, share.ID))
+		shareRepo.AssertExpectations(t)
+	})
+}
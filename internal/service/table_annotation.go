@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/google/uuid"
+)
+
+// errTableAnnotationsDisabled is returned when the service has no annotation store
+var errTableAnnotationsDisabled = errors.New("table annotations are not enabled")
+
+// WithTableAnnotations lets users correct the roles guessed for tables and describe
+// them, keeping their annotations in repo
+func (s *QueryService) WithTableAnnotations(repo domain.TableAnnotationRepository) *QueryService {
+	s.tableAnnotations = repo
+	return s
+}
+
+// ListTableAnnotations returns the table annotations of a connection
+func (s *QueryService) ListTableAnnotations(ctx context.Context, userID, workspaceID, connectionID uuid.UUID) ([]domain.TableAnnotation, error) {
+	if _, err := s.connectionService.GetByID(ctx, userID, workspaceID, connectionID); err != nil {
+		return nil, err
+	}
+	if s.tableAnnotations == nil {
+		return []domain.TableAnnotation{}, nil
+	}
+	annotations, err := s.tableAnnotations.ListByConnection(ctx, connectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list table annotations: %w", err)
+	}
+	return annotations, nil
+}
+
+// AnnotateTable sets the role and description of a table in a connection's schema,
+// replacing its earlier annotation. Requires the member role.
+func (s *QueryService) AnnotateTable(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, table string, req domain.TableAnnotationRequest) (*domain.TableAnnotation, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+	if s.tableAnnotations == nil {
+		return nil, errTableAnnotationsDisabled
+	}
+	if req.Role == "" && req.Description == "" {
+		return nil, apperr.New(apperr.Validation, "role or description is required")
+	}
+	schema, err := s.GetSchema(ctx, userID, workspaceID, connectionID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.ContainsFunc(schema.Tables, func(t domain.TableInfo) bool {
+		return t.Name == table && t.SchemaName == req.SchemaName
+	}) {
+		return nil, apperr.Newf(apperr.NotFound, "table %q not found in the connection's schema", table)
+	}
+
+	annotation := &domain.TableAnnotation{
+		ConnectionID: connectionID,
+		SchemaName:   req.SchemaName,
+		TableName:    table,
+		Role:         req.Role,
+		Description:  req.Description,
+		UpdatedBy:    &userID,
+		UpdatedAt:    time.Now(),
+	}
+	if err := s.tableAnnotations.Upsert(ctx, annotation); err != nil {
+		return nil, fmt.Errorf("failed to save table annotation: %w", err)
+	}
+	return annotation, nil
+}
+
+// DeleteTableAnnotation removes the annotation of a table, so its role is guessed
+// again. Requires the member role.
+func (s *QueryService) DeleteTableAnnotation(ctx context.Context, userID, workspaceID, connectionID uuid.UUID, schemaName, table string) error {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return err
+	}
+	if _, err := s.connectionService.GetByID(ctx, userID, workspaceID, connectionID); err != nil {
+		return err
+	}
+	if s.tableAnnotations == nil {
+		return errTableAnnotationsDisabled
+	}
+	deleted, err := s.tableAnnotations.Delete(ctx, connectionID, schemaName, table)
+	if err != nil {
+		return fmt.Errorf("failed to delete table annotation: %w", err)
+	}
+	if !deleted {
+		return apperr.Newf(apperr.NotFound, "table %q has no annotation", table)
+	}
+	return nil
+}
+
+// annotateTables applies the connection's table annotations to tables. Failing to
+// read them only costs the corrections, so the error is logged.
+func (s *QueryService) annotateTables(ctx context.Context, connectionID uuid.UUID, tables []domain.TableInfo) {
+	if s.tableAnnotations == nil {
+		return
+	}
+	annotations, err := s.tableAnnotations.ListByConnection(ctx, connectionID)
+	if err != nil {
+		logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("connection_id", connectionID.String()).Msg("failed to read table annotations")
+		return
+	}
+	domain.AnnotateTables(tables, annotations)
+}
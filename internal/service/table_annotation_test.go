@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryTableAnnotations is a TableAnnotationRepository in memory
+type memoryTableAnnotations []domain.TableAnnotation
+
+func (m *memoryTableAnnotations) ListByConnection(_ context.Context, connectionID uuid.UUID) ([]domain.TableAnnotation, error) {
+	var annotations []domain.TableAnnotation
+	for _, a := range *m {
+		if a.ConnectionID == connectionID {
+			annotations = append(annotations, a)
+		}
+	}
+	return annotations, nil
+}
+
+func (m *memoryTableAnnotations) Upsert(_ context.Context, annotation *domain.TableAnnotation) error {
+	m.Delete(context.Background(), annotation.ConnectionID, annotation.SchemaName, annotation.TableName)
+	*m = append(*m, *annotation)
+	return nil
+}
+
+func (m *memoryTableAnnotations) Delete(_ context.Context, connectionID uuid.UUID, schemaName, tableName string) (bool, error) {
+	for i, a := range *m {
+		if a.ConnectionID == connectionID && a.SchemaName == schemaName && a.TableName == tableName {
+			*m = append((*m)[:i], (*m)[i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestQueryService_TableAnnotations(t *testing.T) {
+	ctx := context.Background()
+	workspaceID, userID, connectionID := uuid.New(), uuid.New(), uuid.New()
+
+	t.Run("annotated roles pick the suggested fact tables", func(t *testing.T) {
+		messageRepo := new(MockMessageRepo)
+		messageRepo.On("GetMostFrequentQuestions", ctx, workspaceID, mock.Anything).Return([]string{}, nil)
+		annotations := &memoryTableAnnotations{
+			{ConnectionID: connectionID, TableName: "order_items", Role: domain.TableRoleDimension},
+			{ConnectionID: connectionID, TableName: "products", Role: domain.TableRoleFact, Description: "Catalogue"},
+		}
+		svc := (&QueryService{messageRepo: messageRepo, schemaStore: memorySchemaStore{connectionID: {Tables: []domain.TableInfo{
+			{Name: "products", Columns: []domain.ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "name"}, {Name: "price"}, {Name: "sku"}}},
+			{Name: "order_items", Columns: []domain.ColumnInfo{{Name: "id", PrimaryKey: true}, {Name: "product_id"}, {Name: "created_at", DataType: "timestamp"}}},
+		}}}}).WithTableAnnotations(annotations)
+
+		got, err := svc.GetSuggestedQuestions(ctx, workspaceID, &connectionID, 3)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"How many products are there?"}, got)
+	})
+
+	t.Run("annotation needs a role or description", func(t *testing.T) {
+		workspaceRepo := new(MockWorkspaceRepository)
+		workspaceRepo.On("GetMember", ctx, workspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleMember}, nil)
+		svc := (&QueryService{workspaceRepo: workspaceRepo}).WithTableAnnotations(&memoryTableAnnotations{})
+
+		_, err := svc.AnnotateTable(ctx, userID, workspaceID, connectionID, "orders", domain.TableAnnotationRequest{})
+		assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+	})
+
+	t.Run("viewers cannot annotate", func(t *testing.T) {
+		workspaceRepo := new(MockWorkspaceRepository)
+		workspaceRepo.On("GetMember", ctx, workspaceID, userID).Return(&domain.WorkspaceMember{Role: domain.RoleViewer}, nil)
+		svc := (&QueryService{workspaceRepo: workspaceRepo}).WithTableAnnotations(&memoryTableAnnotations{})
+
+		_, err := svc.AnnotateTable(ctx, userID, workspaceID, connectionID, "orders", domain.TableAnnotationRequest{Role: domain.TableRoleFact})
+		assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+	})
+}
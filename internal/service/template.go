@@ -0,0 +1,384 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/observability"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// TemplateService manages query templates and runs them through the query service
+type TemplateService struct {
+	templateRepo   domain.QueryTemplateRepository
+	workspaceRepo  domain.WorkspaceRepository
+	connectionRepo domain.ConnectionRepository
+	messageRepo    domain.MessageRepository
+	queryService   *QueryService
+}
+
+// NewTemplateService creates a new query template service
+func NewTemplateService(
+	templateRepo domain.QueryTemplateRepository,
+	workspaceRepo domain.WorkspaceRepository,
+	connectionRepo domain.ConnectionRepository,
+	messageRepo domain.MessageRepository,
+	queryService *QueryService,
+) *TemplateService {
+	return &TemplateService{
+		templateRepo:   templateRepo,
+		workspaceRepo:  workspaceRepo,
+		connectionRepo: connectionRepo,
+		messageRepo:    messageRepo,
+		queryService:   queryService,
+	}
+}
+
+// List lists the templates of a workspace, flagging those that read dropped tables
+func (s *TemplateService) List(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.QueryTemplate, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleViewer); err != nil {
+		return nil, err
+	}
+	templates, err := s.templateRepo.ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	s.queryService.flagDroppedTables(ctx, templates)
+	return templates, nil
+}
+
+// Get retrieves a template of a workspace
+func (s *TemplateService) Get(ctx context.Context, userID, workspaceID, templateID uuid.UUID) (*domain.QueryTemplate, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.get(ctx, workspaceID, templateID)
+}
+
+// Create adds a template to a workspace. A template made from an assistant message
+// takes its SQL and connection, with the literals the SQL compares turned into
+// parameters that default to the original values.
+func (s *TemplateService) Create(ctx context.Context, userID, workspaceID uuid.UUID, input domain.QueryTemplateCreate) (*domain.QueryTemplate, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+
+	sql, params := input.SQL, input.Parameters
+	var connectionID uuid.UUID
+	if input.ConnectionID != nil {
+		connectionID = *input.ConnectionID
+	}
+	if input.MessageID != nil {
+		message, err := s.messageRepo.GetByIDAndWorkspace(ctx, *input.MessageID, workspaceID)
+		if err != nil {
+			return nil, err
+		}
+		if message == nil {
+			return nil, errors.New("message not found")
+		}
+		if message.Role != domain.RoleAssistant || message.SQL == "" {
+			return nil, errors.New("message has no SQL to make a template of")
+		}
+		if input.ConnectionID == nil && message.Metadata != nil {
+			connectionID = message.Metadata.ConnectionID
+		}
+		sql, params = parameterizeSQL(message.SQL)
+	}
+	if params == nil {
+		params = []domain.TemplateParameter{}
+	}
+
+	if err := s.checkConnection(ctx, workspaceID, connectionID); err != nil {
+		return nil, err
+	}
+	if err := validateTemplate(sql, params); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &domain.QueryTemplate{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		ConnectionID: connectionID,
+		Name:         input.Name,
+		Description:  input.Description,
+		SQL:          sql,
+		Parameters:   params,
+		CreatedBy:    &userID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.templateRepo.Create(ctx, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// Update changes a template. SQL and parameters are validated together, so changing
+// a placeholder means sending both.
+func (s *TemplateService) Update(ctx context.Context, userID, workspaceID, templateID uuid.UUID, input domain.QueryTemplateUpdate) (*domain.QueryTemplate, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+
+	template, err := s.get(ctx, workspaceID, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		template.Name = *input.Name
+	}
+	if input.Description != nil {
+		template.Description = *input.Description
+	}
+	if input.ConnectionID != nil && *input.ConnectionID != template.ConnectionID {
+		if err := s.checkConnection(ctx, workspaceID, *input.ConnectionID); err != nil {
+			return nil, err
+		}
+		template.ConnectionID = *input.ConnectionID
+	}
+	if input.SQL != nil {
+		template.SQL = *input.SQL
+	}
+	if input.Parameters != nil {
+		template.Parameters = input.Parameters
+	}
+	if err := validateTemplate(template.SQL, template.Parameters); err != nil {
+		return nil, err
+	}
+
+	template.UpdatedAt = time.Now()
+	if err := s.templateRepo.Update(ctx, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// Delete removes a template. Messages of past runs are kept.
+func (s *TemplateService) Delete(ctx context.Context, userID, workspaceID, templateID uuid.UUID) error {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return err
+	}
+	if _, err := s.get(ctx, workspaceID, templateID); err != nil {
+		return err
+	}
+	return s.templateRepo.Delete(ctx, templateID)
+}
+
+// Run runs a template with parameter values
+func (s *TemplateService) Run(ctx context.Context, userID, workspaceID, templateID uuid.UUID, req domain.TemplateRunRequest) (*domain.QueryResponse, error) {
+	template, err := s.Get(ctx, userID, workspaceID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryService.RunTemplate(ctx, userID, workspaceID, template, req)
+}
+
+func (s *TemplateService) get(ctx context.Context, workspaceID, templateID uuid.UUID) (*domain.QueryTemplate, error) {
+	template, err := s.templateRepo.GetByIDAndWorkspace(ctx, templateID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, errors.New("template not found")
+	}
+	return template, nil
+}
+
+// checkConnection checks that a template's connection belongs to the workspace
+func (s *TemplateService) checkConnection(ctx context.Context, workspaceID, connectionID uuid.UUID) error {
+	if connectionID == uuid.Nil {
+		return errors.New("connection_id is required")
+	}
+	conn, err := s.connectionRepo.GetByIDAndWorkspace(ctx, connectionID, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	if conn == nil {
+		return errors.New("connection not found")
+	}
+	return nil
+}
+
+// RunTemplate runs a query template on its connection with the parameter values bound
+// by the database driver, under the same validation and limits as generated SQL. The
+// run is recorded as a turn of the request's session, or of a new one.
+func (s *QueryService) RunTemplate(ctx context.Context, userID, workspaceID uuid.UUID, template *domain.QueryTemplate, req domain.TemplateRunRequest) (*domain.QueryResponse, error) {
+	startTime := time.Now()
+
+	bound, values, err := bindTemplateParams(template.Parameters, req.Params)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, password, err := s.connectionService.GetFullConnection(ctx, userID, workspaceID, template.ConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+	settings, err := s.workspaceSettings(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	mcpConfig := adapterConfig(conn, password)
+	adapter, err := s.mcpRouter.GetAdapter(ctx, conn.ID, string(conn.DatabaseType), mcpConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database adapter: %w", err)
+	}
+	executor, ok := adapter.(mcp.ParamExecutor)
+	if !ok {
+		return nil, fmt.Errorf("query templates are not supported for %s connections", conn.DatabaseType)
+	}
+	sql, params, err := compileTemplate(template.SQL, bound, executor.Placeholder)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID := req.SessionID
+	var newSession *domain.ChatSession
+	if sessionID == uuid.Nil {
+		sessionID = uuid.New()
+		newSession = &domain.ChatSession{
+			ID:           sessionID,
+			WorkspaceID:  workspaceID,
+			UserID:       &userID,
+			Title:        sessionTitle(template.Name),
+			ConnectionID: &conn.ID,
+			CreatedAt:    startTime,
+			UpdatedAt:    startTime,
+		}
+	} else if _, err := s.getWorkspaceSession(ctx, workspaceID, sessionID); err != nil {
+		return nil, err
+	}
+
+	question := templateRunQuestion(template.Name, values)
+	response := &domain.QueryResponse{
+		RequestID: uuid.New().String(),
+		SessionID: sessionID,
+		Question:  question,
+		SQL:       template.SQL,
+		Metadata: &domain.QueryMetadata{
+			ConnectionID: conn.ID,
+			DatabaseType: string(conn.DatabaseType),
+			Template:     &domain.TemplateRun{ID: template.ID, Name: template.Name, Params: values},
+		},
+	}
+
+	queryOpts := s.executionOptions(conn, settings, req.Options)
+	execCtx, execSpan := observability.StartSpan(ctx, "query.execute",
+		attribute.String("db.system", string(conn.DatabaseType)),
+		attribute.String("template_id", template.ID.String()),
+		attribute.Int("max_rows", queryOpts.MaxRows),
+	)
+	status := domain.QueryStatusOK
+	var rowCount *int
+	if err := adapter.ValidateQuery(sql); err != nil {
+		response.Error = err.Error()
+		var blocked *mcp.ValidationError
+		if errors.As(err, &blocked) {
+			response.ErrorDetail = &domain.BlockedQuery{Rule: blocked.Rule, Matched: blocked.Matched, Position: blocked.Position}
+		}
+		status = domain.QueryStatusBlocked
+		s.metrics.ObserveQueryBlocked(string(conn.DatabaseType))
+	} else {
+		queryStart := time.Now()
+		result, err := executor.ExecuteQueryWithParams(execCtx, sql, params, queryOpts)
+		if err != nil {
+			response.Error = err.Error()
+			status = executionStatus(err)
+			if status == domain.QueryStatusTimeout {
+				response.Metadata.TimeoutPhase = domain.TimeoutPhaseExecution
+			}
+		} else {
+			response.Result = &domain.QueryResult{
+				Columns:             result.Columns,
+				Rows:                result.Rows,
+				RowCount:            result.RowCount,
+				Truncated:           result.Truncated,
+				DefaultLimitApplied: result.DefaultLimitApplied,
+			}
+			rowCount = &result.RowCount
+		}
+		s.metrics.ObserveQuery(string(conn.DatabaseType), status, time.Since(queryStart), response.Result)
+	}
+	execSpan.SetAttributes(attribute.String("query.status", string(status)))
+	var execErr error
+	if response.Error != "" {
+		execErr = errors.New(response.Error)
+	}
+	observability.EndSpan(execSpan, execErr)
+
+	latency := time.Since(startTime).Milliseconds()
+	response.Metadata.ExecutionTimeMs = latency
+
+	content := "Here is the result of your query:"
+	if response.Error != "" {
+		content = fmt.Sprintf("I encountered an error: %s", response.Error)
+	}
+	userMsg := &domain.Message{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		UserID:      &userID,
+		SessionID:   &sessionID,
+		Role:        domain.RoleUser,
+		Content:     question,
+		CreatedAt:   startTime,
+	}
+	aiMsg := &domain.Message{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		SessionID:   &sessionID,
+		Role:        domain.RoleAssistant,
+		Content:     content,
+		SQL:         template.SQL,
+		Result:      response.Result,
+		Metadata:    response.Metadata,
+		Error:       response.Error,
+		Status:      status,
+		RowCount:    rowCount,
+		LatencyMs:   &latency,
+		CreatedAt:   time.Now(),
+	}
+	turn := &domain.ConversationTurn{
+		NewSession:       newSession,
+		SessionID:        sessionID,
+		UserMessage:      userMsg,
+		AssistantMessage: aiMsg,
+		Title:            sessionTitle(template.Name),
+	}
+	if err := s.messageRepo.CreateConversationTurn(context.WithoutCancel(ctx), turn); err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("session_id", sessionID.String()).Msg("failed to save conversation turn")
+	}
+	recordPhases(ctx, aiMsg.Metadata)
+	s.recordConnectionOutcome(ctx, conn, aiMsg)
+	s.recordTableUsage(ctx, conn.ID, aiMsg)
+	s.emitQueryCompleted(ctx, workspaceID, conn.ID, userMsg, aiMsg)
+
+	return response, nil
+}
+
+// templateRunQuestion describes a template run as the user's message of the turn
+func templateRunQuestion(name string, values map[string]any) string {
+	if len(values) == 0 {
+		return fmt.Sprintf("Run template %q", name)
+	}
+	names := make([]string, 0, len(values))
+	for n := range values {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = fmt.Sprintf("%s=%v", n, values[n])
+	}
+	return fmt.Sprintf("Run template %q with %s", name, strings.Join(pairs, ", "))
+}
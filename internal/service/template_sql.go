@@ -0,0 +1,430 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+)
+
+// templatePlaceholder matches a {{name}} placeholder in template SQL
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// placeholderRef is one occurrence of a placeholder in template SQL
+type placeholderRef struct {
+	name       string
+	start, end int
+}
+
+// templateRefs returns the placeholders of template SQL in order. Placeholders inside
+// string literals are rejected, since their values are bound as typed parameters.
+func templateRefs(sql string) ([]placeholderRef, error) {
+	quoted := quotedRanges(sql)
+	var refs []placeholderRef
+	for _, m := range templatePlaceholder.FindAllStringSubmatchIndex(sql, -1) {
+		for _, q := range quoted {
+			if m[0] > q[0] && m[0] < q[1] {
+				return nil, fmt.Errorf("invalid template: placeholder %s must not be quoted", sql[m[0]:m[1]])
+			}
+		}
+		refs = append(refs, placeholderRef{name: sql[m[2]:m[3]], start: m[0], end: m[1]})
+	}
+	return refs, nil
+}
+
+// quotedRanges returns the byte ranges of the single-quoted literals of sql
+func quotedRanges(sql string) [][2]int {
+	var ranges [][2]int
+	for i := 0; i < len(sql); i++ {
+		if sql[i] != '\'' {
+			continue
+		}
+		end := mcp.StringLiteralEnd(sql, i, mcp.DialectStandard)
+		ranges = append(ranges, [2]int{i, end})
+		i = end - 1
+	}
+	return ranges
+}
+
+// validateTemplate checks that template SQL is a read-only query whose placeholders
+// are exactly the declared parameters, and that defaults match their types
+func validateTemplate(sql string, params []domain.TemplateParameter) error {
+	if err := mcp.ValidateSQL(sql, mcp.DialectStandard, nil); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	refs, err := templateRefs(sql)
+	if err != nil {
+		return err
+	}
+
+	declared := make(map[string]bool, len(params))
+	for _, p := range params {
+		if !templatePlaceholder.MatchString("{{" + p.Name + "}}") {
+			return fmt.Errorf("invalid template: parameter name %q must be a letter or underscore followed by letters, digits or underscores", p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("invalid template: parameter %q is declared twice", p.Name)
+		}
+		declared[p.Name] = true
+		if !mcp.IsParamType(p.Type) {
+			return fmt.Errorf("invalid template: parameter %q has unknown type %q", p.Name, p.Type)
+		}
+		if p.Default != nil {
+			if _, err := mcp.ParseParam(mcp.ParamType(p.Type), p.Default); err != nil {
+				return fmt.Errorf("invalid template: default of parameter %q: %w", p.Name, err)
+			}
+		}
+	}
+
+	used := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if !declared[ref.name] {
+			return fmt.Errorf("invalid template: placeholder {{%s}} is not a declared parameter", ref.name)
+		}
+		used[ref.name] = true
+	}
+	for _, p := range params {
+		if !used[p.Name] {
+			return fmt.Errorf("invalid template: parameter %q is not used in the SQL", p.Name)
+		}
+	}
+	return nil
+}
+
+// bindTemplateParams checks the values supplied for a run against the template's
+// parameters, falling back to defaults. It returns the typed values by name and the
+// values used, as recorded with the run.
+func bindTemplateParams(params []domain.TemplateParameter, supplied map[string]any) (map[string]mcp.QueryParam, map[string]any, error) {
+	for name := range supplied {
+		if !slices.ContainsFunc(params, func(p domain.TemplateParameter) bool { return p.Name == name }) {
+			return nil, nil, fmt.Errorf("invalid parameter %q: not declared by the template", name)
+		}
+	}
+
+	bound := make(map[string]mcp.QueryParam, len(params))
+	used := make(map[string]any, len(params))
+	for _, p := range params {
+		value, ok := supplied[p.Name]
+		if !ok || value == nil {
+			value = p.Default
+		}
+		if value == nil {
+			return nil, nil, fmt.Errorf("invalid parameter %q: a %s value is required", p.Name, p.Type)
+		}
+		param, err := mcp.ParseParam(mcp.ParamType(p.Type), value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid parameter %q: %w", p.Name, err)
+		}
+		bound[p.Name] = param
+		used[p.Name] = value
+	}
+	return bound, used, nil
+}
+
+// compileTemplate replaces the placeholders of template SQL with the adapter's bind
+// placeholders and returns the parameters in placeholder order. Values never become
+// part of the SQL text.
+func compileTemplate(sql string, bound map[string]mcp.QueryParam, placeholder func(n int, typ mcp.ParamType) string) (string, []mcp.QueryParam, error) {
+	refs, err := templateRefs(sql)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	params := make([]mcp.QueryParam, 0, len(refs))
+	last := 0
+	for _, ref := range refs {
+		param, ok := bound[ref.name]
+		if !ok {
+			return "", nil, fmt.Errorf("invalid parameter %q: a value is required", ref.name)
+		}
+		params = append(params, param)
+		sb.WriteString(sql[last:ref.start])
+		sb.WriteString(placeholder(len(params), param.Type))
+		last = ref.end
+	}
+	sb.WriteString(sql[last:])
+	return sb.String(), params, nil
+}
+
+// tableClauseEnd lists the keywords that end the table list of a FROM clause
+var tableClauseEnd = []string{
+	"WHERE", "JOIN", "ON", "USING", "GROUP", "ORDER", "LIMIT", "OFFSET", "FETCH", "HAVING", "WINDOW",
+	"UNION", "INTERSECT", "EXCEPT", "LEFT", "RIGHT", "INNER", "OUTER", "FULL", "CROSS", "NATURAL",
+}
+
+// referencedTables returns the tables named after FROM and JOIN in SQL, without their
+// schema, in order of appearance. Subqueries are skipped; their own FROM clauses are
+// found on their own. Names of common table expressions are left out.
+func referencedTables(sql string) []string {
+	tokens := mcp.Tokenize(sql, mcp.DialectStandard)
+	isName := func(i int) bool {
+		return i < len(tokens) && (tokens[i].Kind == mcp.TokenIdentifier ||
+			tokens[i].Kind == mcp.TokenWord && !slices.Contains(tableClauseEnd, strings.ToUpper(tokens[i].Text)))
+	}
+
+	ctes := commonTableNames(tokens)
+
+	var tables []string
+	for i := 0; i < len(tokens); i++ {
+		keyword := strings.ToUpper(tokens[i].Text)
+		if tokens[i].Kind != mcp.TokenWord || keyword != "FROM" && keyword != "JOIN" {
+			continue
+		}
+		for j := i + 1; isName(j); {
+			name := tokens[j].Text
+			for j+2 < len(tokens) && tokens[j+1].Text == "." && isName(j+2) {
+				j += 2
+				name = tokens[j].Text
+			}
+			if !ctes[strings.ToLower(name)] {
+				tables = append(tables, name)
+			}
+			j++
+
+			// An alias, with or without AS
+			if j < len(tokens) && strings.EqualFold(tokens[j].Text, "AS") {
+				j++
+			}
+			if isName(j) {
+				j++
+			}
+			if keyword != "FROM" || j >= len(tokens) || tokens[j].Text != "," {
+				break
+			}
+			j++
+		}
+	}
+	return tables
+}
+
+// commonTableNames returns the lower-cased names defined by the WITH clauses of
+// tokenized SQL, including those with column lists and MATERIALIZED hints
+func commonTableNames(tokens []mcp.Token) map[string]bool {
+	names := make(map[string]bool)
+	// skipParens returns the index after the parenthesized group starting at i
+	skipParens := func(i int) int {
+		depth := 0
+		for ; i < len(tokens); i++ {
+			switch tokens[i].Text {
+			case "(":
+				depth++
+			case ")":
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return i
+	}
+	isWord := func(i int, word string) bool {
+		return i < len(tokens) && tokens[i].Kind == mcp.TokenWord && strings.EqualFold(tokens[i].Text, word)
+	}
+
+	for i := range tokens {
+		if !isWord(i, "WITH") {
+			continue
+		}
+		j := i + 1
+		if isWord(j, "RECURSIVE") {
+			j++
+		}
+		// Each definition is name [(columns)] AS [[NOT] MATERIALIZED] (query)
+		for j < len(tokens) && (tokens[j].Kind == mcp.TokenWord || tokens[j].Kind == mcp.TokenIdentifier) {
+			name := strings.ToLower(tokens[j].Text)
+			j++
+			if j < len(tokens) && tokens[j].Text == "(" {
+				j = skipParens(j)
+			}
+			if !isWord(j, "AS") {
+				break
+			}
+			j++
+			if isWord(j, "NOT") {
+				j++
+			}
+			if isWord(j, "MATERIALIZED") {
+				j++
+			}
+			if j >= len(tokens) || tokens[j].Text != "(" {
+				break
+			}
+			names[name] = true
+			j = skipParens(j)
+			if j >= len(tokens) || tokens[j].Text != "," {
+				break
+			}
+			j++
+		}
+	}
+	return names
+}
+
+// comparisonOperators precede the literals detected as parameters
+var comparisonOperators = []string{"=", "==", "<>", "!=", "<", ">", "<=", ">=", "LIKE", "ILIKE"}
+
+// parameterizeSQL turns the literals SQL compares columns with into template
+// parameters: right-hand sides of comparisons, BETWEEN bounds and IN list items.
+// Each parameter is named after its column and defaults to the literal, so the
+// template reproduces the original query when run without values.
+func parameterizeSQL(sql string) (string, []domain.TemplateParameter) {
+	tokens := mcp.Tokenize(sql, mcp.DialectStandard)
+
+	type literal struct {
+		start, end int
+		param      domain.TemplateParameter
+	}
+	var literals []literal
+	taken := map[string]bool{}
+	name := func(base string) string {
+		base = paramName(base)
+		n := base
+		for i := 2; taken[n]; i++ {
+			n = base + "_" + strconv.Itoa(i)
+		}
+		taken[n] = true
+		return n
+	}
+
+	column := ""     // the identifier compared, which names the parameter
+	inList := false  // inside the parentheses of IN (...)
+	between := false // between BETWEEN and its AND
+	betweenAnd := -1 // index of the AND closing a BETWEEN
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		upper := strings.ToUpper(tok.Text)
+		prevIdx := i - 1
+
+		switch {
+		case tok.Kind == mcp.TokenWord && upper == "IN" && i+1 < len(tokens) && tokens[i+1].Text == "(":
+			inList = true
+			i++
+			continue
+		case tok.Kind == mcp.TokenWord && upper == "BETWEEN":
+			between = true
+			continue
+		case tok.Kind == mcp.TokenWord && upper == "AND" && between:
+			between = false
+			betweenAnd = i
+			continue
+		case tok.Text == ")":
+			inList = false
+			continue
+		case tok.Kind == mcp.TokenIdentifier || tok.Kind == mcp.TokenWord && !isKeywordBeforeLiteral(upper):
+			if inList && tokens[prevIdx].Text == "(" {
+				inList = false // IN (SELECT ...)
+			}
+			if !inList && !between {
+				column = tok.Text
+			}
+			continue
+		case tok.Kind != mcp.TokenString && tok.Kind != mcp.TokenNumber:
+			continue
+		}
+
+		// A typed literal such as DATE '2024-01-01' is replaced with its keyword, and a
+		// negative number with its sign
+		start := tok.Start
+		keyword := ""
+		if prevIdx >= 0 && tok.Kind == mcp.TokenString && slices.Contains([]string{"DATE", "TIMESTAMP"}, strings.ToUpper(tokens[prevIdx].Text)) {
+			keyword = strings.ToUpper(tokens[prevIdx].Text)
+			start = tokens[prevIdx].Start
+			prevIdx--
+		} else if prevIdx >= 0 && tok.Kind == mcp.TokenNumber && tokens[prevIdx].Text == "-" {
+			start = tokens[prevIdx].Start
+			tok.Text = "-" + tok.Text
+			prevIdx--
+		}
+		if prevIdx < 0 {
+			continue
+		}
+		prev := strings.ToUpper(tokens[prevIdx].Text)
+
+		suffix := ""
+		switch {
+		case slices.Contains(comparisonOperators, prev):
+			// 1 = 1 compares no column
+			if prevIdx == 0 || tokens[prevIdx-1].Kind == mcp.TokenString || tokens[prevIdx-1].Kind == mcp.TokenNumber {
+				continue
+			}
+		case inList && (prev == "(" || prev == ","):
+		case prev == "BETWEEN":
+			suffix = "_from"
+		case prevIdx == betweenAnd:
+			suffix = "_to"
+		default:
+			continue
+		}
+
+		param := literalParam(tok, keyword)
+		param.Name = name(column + suffix)
+		literals = append(literals, literal{start: start, end: tok.End, param: param})
+	}
+
+	params := make([]domain.TemplateParameter, 0, len(literals))
+	var sb strings.Builder
+	last := 0
+	for _, l := range literals {
+		sb.WriteString(sql[last:l.start])
+		sb.WriteString("{{" + l.param.Name + "}}")
+		last = l.end
+		params = append(params, l.param)
+	}
+	sb.WriteString(sql[last:])
+	return sb.String(), params
+}
+
+// isKeywordBeforeLiteral reports whether word can precede a detected literal, so it
+// does not name the parameter
+func isKeywordBeforeLiteral(word string) bool {
+	return slices.Contains(comparisonOperators, word) ||
+		slices.Contains([]string{"AND", "OR", "NOT", "DATE", "TIMESTAMP"}, word)
+}
+
+// literalParam declares a parameter for a literal, typed by what it looks like
+func literalParam(tok mcp.Token, keyword string) domain.TemplateParameter {
+	if tok.Kind == mcp.TokenNumber {
+		text := tok.Text
+		if strings.Contains(text, ".") {
+			f, _ := strconv.ParseFloat(text, 64)
+			return domain.TemplateParameter{Type: string(mcp.ParamNumber), Default: f}
+		}
+		n, _ := strconv.ParseInt(text, 10, 64)
+		return domain.TemplateParameter{Type: string(mcp.ParamInteger), Default: n}
+	}
+
+	value := strings.ReplaceAll(tok.Text[1:max(1, len(tok.Text)-1)], "''", "'")
+	if _, err := time.Parse(time.DateOnly, value); err == nil && keyword != "TIMESTAMP" {
+		return domain.TemplateParameter{Type: string(mcp.ParamDate), Default: value}
+	}
+	if _, err := time.Parse(time.RFC3339, value); err == nil {
+		return domain.TemplateParameter{Type: string(mcp.ParamTimestamp), Default: value}
+	}
+	return domain.TemplateParameter{Type: string(mcp.ParamString), Default: value}
+}
+
+// paramName makes a parameter name out of a column name, without its table
+func paramName(column string) string {
+	column = column[strings.LastIndexByte(column, '.')+1:]
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, column)
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return "param"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "p" + name
+	}
+	return name
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParameterizeSQL(t *testing.T) {
+	tests := []struct {
+		name   string
+		sql    string
+		want   string
+		params []domain.TemplateParameter
+	}{
+		{
+			name: "comparisons",
+			sql:  "SELECT * FROM orders o WHERE o.status = 'paid' AND o.total >= 100.5 AND o.user_id = -3",
+			want: "SELECT * FROM orders o WHERE o.status = {{status}} AND o.total >= {{total}} AND o.user_id = {{user_id}}",
+			params: []domain.TemplateParameter{
+				{Name: "status", Type: "string", Default: "paid"},
+				{Name: "total", Type: "number", Default: 100.5},
+				{Name: "user_id", Type: "integer", Default: int64(-3)},
+			},
+		},
+		{
+			name: "between dates and in list",
+			sql:  "SELECT id FROM orders WHERE created_at BETWEEN DATE '2024-01-01' AND '2024-02-01' AND region IN ('eu', 'us')",
+			want: "SELECT id FROM orders WHERE created_at BETWEEN {{created_at_from}} AND {{created_at_to}} AND region IN ({{region}}, {{region_2}})",
+			params: []domain.TemplateParameter{
+				{Name: "created_at_from", Type: "date", Default: "2024-01-01"},
+				{Name: "created_at_to", Type: "date", Default: "2024-02-01"},
+				{Name: "region", Type: "string", Default: "eu"},
+				{Name: "region_2", Type: "string", Default: "us"},
+			},
+		},
+		{
+			name: "escaped quote and timestamp",
+			sql:  `SELECT * FROM "Events" WHERE "Name" = 'o''brien' AND at > '2024-01-01T00:00:00Z'`,
+			want: `SELECT * FROM "Events" WHERE "Name" = {{name}} AND at > {{at}}`,
+			params: []domain.TemplateParameter{
+				{Name: "name", Type: "string", Default: "o'brien"},
+				{Name: "at", Type: "timestamp", Default: "2024-01-01T00:00:00Z"},
+			},
+		},
+		{
+			name:   "no column compared",
+			sql:    "SELECT 'a' AS label FROM users WHERE 1 = 1 LIMIT 10",
+			want:   "SELECT 'a' AS label FROM users WHERE 1 = 1 LIMIT 10",
+			params: []domain.TemplateParameter{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, params := parameterizeSQL(tt.sql)
+			assert.Equal(t, tt.want, sql)
+			assert.Equal(t, tt.params, params)
+			assert.NoError(t, validateTemplate(sql, params))
+		})
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	region := []domain.TemplateParameter{{Name: "region", Type: "string"}}
+	tests := []struct {
+		name    string
+		sql     string
+		params  []domain.TemplateParameter
+		wantErr string
+	}{
+		{name: "valid", sql: "SELECT * FROM users WHERE region = {{ region }}", params: region},
+		{name: "write", sql: "DELETE FROM users WHERE region = {{region}}", params: region, wantErr: "invalid template: "},
+		{name: "quoted", sql: "SELECT * FROM users WHERE region = '{{region}}'", params: region, wantErr: "invalid template: placeholder {{region}} must not be quoted"},
+		{name: "undeclared", sql: "SELECT * FROM users WHERE region = {{country}}", params: region, wantErr: "invalid template: placeholder {{country}} is not a declared parameter"},
+		{name: "unused", sql: "SELECT * FROM users", params: region, wantErr: `invalid template: parameter "region" is not used in the SQL`},
+		{
+			name:    "duplicate",
+			sql:     "SELECT * FROM users WHERE region = {{region}}",
+			params:  []domain.TemplateParameter{{Name: "region", Type: "string"}, {Name: "region", Type: "string"}},
+			wantErr: `invalid template: parameter "region" is declared twice`,
+		},
+		{
+			name:    "bad default",
+			sql:     "SELECT * FROM users WHERE age > {{age}}",
+			params:  []domain.TemplateParameter{{Name: "age", Type: "integer", Default: "old"}},
+			wantErr: `invalid template: default of parameter "age": `,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTemplate(tt.sql, tt.params)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestBindAndCompileTemplate(t *testing.T) {
+	params := []domain.TemplateParameter{
+		{Name: "region", Type: "string"},
+		{Name: "since", Type: "date", Default: "2024-01-01"},
+	}
+	sql := "SELECT * FROM orders WHERE region = {{region}} AND created_at >= {{since}} AND ship_region = {{region}}"
+
+	bound, used, err := bindTemplateParams(params, map[string]any{"region": "eu'; DROP TABLE orders; --"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"region": "eu'; DROP TABLE orders; --", "since": "2024-01-01"}, used)
+
+	compiled, values, err := compileTemplate(sql, bound, func(n int, typ mcp.ParamType) string {
+		return fmt.Sprintf("$%d", n)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM orders WHERE region = $1 AND created_at >= $2 AND ship_region = $3", compiled)
+	assert.Equal(t, []mcp.QueryParam{
+		{Type: mcp.ParamString, Value: "eu'; DROP TABLE orders; --"},
+		{Type: mcp.ParamDate, Value: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{Type: mcp.ParamString, Value: "eu'; DROP TABLE orders; --"},
+	}, values)
+
+	_, _, err = bindTemplateParams(params, nil)
+	assert.EqualError(t, err, `invalid parameter "region": a string value is required`)
+
+	_, _, err = bindTemplateParams(params, map[string]any{"region": "eu", "since": "yesterday"})
+	assert.ErrorContains(t, err, `invalid parameter "since": expected a date`)
+
+	_, _, err = bindTemplateParams(params, map[string]any{"region": "eu", "country": "fr"})
+	assert.EqualError(t, err, `invalid parameter "country": not declared by the template`)
+}
+
+func TestQueryService_RunTemplate(t *testing.T) {
+	ctx := context.Background()
+	f := newExecuteQueryFixture(t)
+	sessionID := uuid.New()
+	template := &domain.QueryTemplate{
+		ID:           uuid.New(),
+		WorkspaceID:  f.workspaceID,
+		ConnectionID: f.connectionID,
+		Name:         "Users by country",
+		SQL:          "SELECT COUNT(*) FROM users WHERE country = {{country}}",
+		Parameters:   []domain.TemplateParameter{{Name: "country", Type: "string", Default: "NL"}},
+	}
+
+	f.sessionRepo.On("Get", ctx, sessionID).
+		Return(&domain.ChatSession{ID: sessionID, WorkspaceID: f.workspaceID, Title: "Users"}, nil)
+	f.adapter.On("ValidateQuery", "SELECT COUNT(*) FROM users WHERE country = $1").Return(nil)
+	f.adapter.On("ExecuteQueryWithParams", mock.Anything, "SELECT COUNT(*) FROM users WHERE country = $1",
+		[]mcp.QueryParam{{Type: mcp.ParamString, Value: "DE"}},
+		mcp.QueryOptions{MaxRows: 100, Timeout: 30 * time.Second},
+	).Return(&mcp.QueryResult{Columns: []string{"count"}, Rows: [][]any{{int64(3)}}, RowCount: 1}, nil)
+
+	var turn *domain.ConversationTurn
+	f.messageRepo.On("CreateConversationTurn", mock.Anything, mock.AnythingOfType("*domain.ConversationTurn")).
+		Run(func(args mock.Arguments) { turn = args.Get(1).(*domain.ConversationTurn) }).
+		Return(nil)
+
+	resp, err := f.svc.RunTemplate(ctx, f.userID, f.workspaceID, template, domain.TemplateRunRequest{
+		SessionID: sessionID,
+		Params:    map[string]any{"country": "DE"},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, resp.Error)
+	require.NotNil(t, resp.Result)
+	assert.Equal(t, 1, resp.Result.RowCount)
+	assert.Equal(t, template.SQL, resp.SQL)
+	require.NotNil(t, resp.Metadata.Template)
+	assert.Equal(t, template.ID, resp.Metadata.Template.ID)
+	assert.Equal(t, map[string]any{"country": "DE"}, resp.Metadata.Template.Params)
+
+	require.NotNil(t, turn)
+	assert.Nil(t, turn.NewSession)
+	assert.Equal(t, `Run template "Users by country" with country=DE`, turn.UserMessage.Content)
+	assert.Equal(t, template.SQL, turn.AssistantMessage.SQL)
+	assert.Equal(t, domain.QueryStatusOK, turn.AssistantMessage.Status)
+
+	f.adapter.AssertNumberOfCalls(t, "ExecuteQueryWithParams", 1)
+	f.messageRepo.AssertExpectations(t)
+	f.llmProvider.AssertNotCalled(t, "GenerateSQL", mock.Anything, mock.Anything, mock.Anything)
+}
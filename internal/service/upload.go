@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// UploadService tracks the SQLite files stored in the upload directory
+type UploadService struct {
+	uploadRepo     domain.UploadRepository
+	connectionRepo domain.ConnectionRepository
+	workspaceRepo  domain.WorkspaceRepository
+	dir            string
+
+	connections *ConnectionService
+}
+
+// NewUploadService creates a new upload service storing files in dir
+func NewUploadService(
+	uploadRepo domain.UploadRepository,
+	connectionRepo domain.ConnectionRepository,
+	workspaceRepo domain.WorkspaceRepository,
+	dir string,
+) *UploadService {
+	// Ensure upload directory exists
+	os.MkdirAll(dir, 0755)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return &UploadService{
+		uploadRepo:     uploadRepo,
+		connectionRepo: connectionRepo,
+		workspaceRepo:  workspaceRepo,
+		dir:            dir,
+	}
+}
+
+// WithConnections deletes the connections of a force-deleted upload through
+// connections, which closes their pooled adapters and cached schemas
+func (s *UploadService) WithConnections(connections *ConnectionService) *UploadService {
+	s.connections = connections
+	return s
+}
+
+// Dir returns the absolute path of the upload directory
+func (s *UploadService) Dir() string {
+	return s.dir
+}
+
+// Record registers a file written to the upload directory as owned by the workspace
+func (s *UploadService) Record(ctx context.Context, userID, workspaceID uuid.UUID, originalName, path string, size int64) (*domain.Upload, error) {
+	if len(originalName) > 255 {
+		originalName = originalName[:255]
+	}
+	upload := &domain.Upload{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		UserID:       &userID,
+		OriginalName: originalName,
+		FilePath:     path,
+		SizeBytes:    size,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.uploadRepo.Create(ctx, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// List lists the uploads of a workspace with the connection using each of them
+func (s *UploadService) List(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.Upload, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleViewer); err != nil {
+		return nil, err
+	}
+	return s.uploadRepo.ListByWorkspace(ctx, workspaceID)
+}
+
+// Delete removes an upload and its file. Uploads still used by a connection are only
+// deleted with force, which deletes those connections as well.
+func (s *UploadService) Delete(ctx context.Context, userID, workspaceID, uploadID uuid.UUID, force bool) error {
+	// Viewers cannot manage files, the same as connections
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return err
+	}
+
+	upload, err := s.uploadRepo.GetByIDAndWorkspace(ctx, uploadID, workspaceID)
+	if err != nil {
+		return err
+	}
+	if upload == nil {
+		return apperr.New(apperr.NotFound, "upload not found")
+	}
+	if upload.ConnectionID != nil && !force {
+		return apperr.New(apperr.Conflict, "upload is used by a connection")
+	}
+
+	if upload.ConnectionID != nil {
+		// Without the connection service the connections cannot be closed, a setup error
+		if s.connections == nil {
+			return errors.New("connections of an upload cannot be deleted")
+		}
+		connections, err := s.connectionRepo.ListByWorkspace(ctx, workspaceID)
+		if err != nil {
+			return err
+		}
+		for _, conn := range connections {
+			if conn.DatabaseType != domain.DatabaseTypeSQLite || conn.Database != upload.FilePath {
+				continue
+			}
+			if err := s.connections.Delete(ctx, userID, workspaceID, conn.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := os.Remove(upload.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload file: %w", err)
+	}
+	for _, suffix := range sqliteSidecars {
+		os.Remove(upload.FilePath + suffix)
+	}
+	return s.uploadRepo.Delete(ctx, upload.ID)
+}
+
+// sqliteSidecars are the suffixes of files SQLite keeps next to a database while it is open
+var sqliteSidecars = []string{"-journal", "-wal", "-shm"}
+
+// RunOrphanSweep sweeps immediately and then every interval until ctx is cancelled
+func (s *UploadService) RunOrphanSweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.SweepOrphans(ctx); err != nil {
+			log.Error().Err(err).Msg("upload sweep failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SweepOrphans flags uploads that no connection uses any more and logs files in the
+// upload directory that no upload owns. It returns the number of newly flagged uploads.
+func (s *UploadService) SweepOrphans(ctx context.Context) (int64, error) {
+	flagged, err := s.uploadRepo.MarkOrphans(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	if flagged > 0 {
+		log.Warn().Int64("uploads", flagged).Msg("flagged uploads no longer used by a connection")
+	}
+
+	paths, err := s.uploadRepo.ListFilePaths(ctx)
+	if err != nil {
+		return flagged, err
+	}
+	tracked := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		tracked[p] = true
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return flagged, fmt.Errorf("failed to read upload directory: %w", err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(s.dir, entry.Name())
+		if !entry.Type().IsRegular() || tracked[path] || isSidecar(path, tracked) {
+			continue
+		}
+		log.Warn().Str("file", path).Msg("upload file is not owned by any workspace")
+	}
+	return flagged, nil
+}
+
+// isSidecar reports whether path is a SQLite sidecar file of a tracked database
+func isSidecar(path string, tracked map[string]bool) bool {
+	for _, suffix := range sqliteSidecars {
+		if strings.HasSuffix(path, suffix) && tracked[strings.TrimSuffix(path, suffix)] {
+			return true
+		}
+	}
+	return false
+}
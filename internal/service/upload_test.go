@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newUploadFixture stores one linked upload on disk for a workspace member
+func newUploadFixture(t *testing.T) (*UploadService, *MockUploadRepository, *MockConnectionRepository, *domain.Upload) {
+	t.Helper()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sales.db")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	userID, connID := uuid.New(), uuid.New()
+	upload := &domain.Upload{
+		ID:           uuid.New(),
+		WorkspaceID:  uuid.New(),
+		UserID:       &userID,
+		FilePath:     path,
+		ConnectionID: &connID,
+	}
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetMember", mock.Anything, upload.WorkspaceID, userID).
+		Return(&domain.WorkspaceMember{WorkspaceID: upload.WorkspaceID, UserID: userID, Role: domain.RoleMember}, nil)
+	uploadRepo := new(MockUploadRepository)
+	uploadRepo.On("GetByIDAndWorkspace", mock.Anything, upload.ID, upload.WorkspaceID).Return(upload, nil)
+	connectionRepo := new(MockConnectionRepository)
+
+	connections := NewConnectionService(connectionRepo, workspaceRepo, nil, nil, 0, 0)
+	return NewUploadService(uploadRepo, connectionRepo, workspaceRepo, dir).WithConnections(connections), uploadRepo, connectionRepo, upload
+}
+
+func TestUploadService_Delete(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("in use without force", func(t *testing.T) {
+		svc, uploadRepo, _, upload := newUploadFixture(t)
+
+		err := svc.Delete(ctx, *upload.UserID, upload.WorkspaceID, upload.ID, false)
+		assert.EqualError(t, err, "upload is used by a connection")
+		assert.Equal(t, apperr.Conflict, apperr.KindOf(err))
+		assert.FileExists(t, upload.FilePath)
+		uploadRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("in use with force", func(t *testing.T) {
+		svc, uploadRepo, connectionRepo, upload := newUploadFixture(t)
+		other := domain.Connection{ID: uuid.New(), DatabaseType: domain.DatabaseTypeSQLite, Database: "/elsewhere.db"}
+		linked := domain.Connection{ID: *upload.ConnectionID, WorkspaceID: upload.WorkspaceID, DatabaseType: domain.DatabaseTypeSQLite, Database: upload.FilePath}
+		connectionRepo.On("ListByWorkspace", mock.Anything, upload.WorkspaceID).Return([]domain.Connection{linked, other}, nil)
+		connectionRepo.On("GetByIDAndWorkspace", mock.Anything, linked.ID, upload.WorkspaceID).Return(&linked, nil)
+		connectionRepo.On("Delete", mock.Anything, *upload.ConnectionID).Return(nil)
+		uploadRepo.On("Delete", mock.Anything, upload.ID).Return(nil)
+
+		require.NoError(t, svc.Delete(ctx, *upload.UserID, upload.WorkspaceID, upload.ID, true))
+		assert.NoFileExists(t, upload.FilePath)
+		connectionRepo.AssertNotCalled(t, "Delete", mock.Anything, other.ID)
+		connectionRepo.AssertExpectations(t)
+		uploadRepo.AssertExpectations(t)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		svc, uploadRepo, _, upload := newUploadFixture(t)
+		missing := uuid.New()
+		uploadRepo.On("GetByIDAndWorkspace", mock.Anything, missing, upload.WorkspaceID).Return(nil, nil)
+
+		err := svc.Delete(ctx, *upload.UserID, upload.WorkspaceID, missing, true)
+		assert.EqualError(t, err, "upload not found")
+		assert.Equal(t, apperr.NotFound, apperr.KindOf(err))
+	})
+}
+
+func TestUploadService_SweepOrphans(t *testing.T) {
+	dir := t.TempDir()
+	tracked := filepath.Join(dir, "sales.db")
+	for _, name := range []string{"sales.db", "sales.db-wal", "stray.db"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+
+	uploadRepo := new(MockUploadRepository)
+	uploadRepo.On("MarkOrphans", mock.Anything, mock.Anything).Return(int64(2), nil)
+	uploadRepo.On("ListFilePaths", mock.Anything).Return([]string{tracked}, nil)
+
+	svc := NewUploadService(uploadRepo, new(MockConnectionRepository), new(MockWorkspaceRepository), dir)
+	flagged, err := svc.SweepOrphans(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), flagged)
+	uploadRepo.AssertExpectations(t)
+}
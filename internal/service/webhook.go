@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+)
+
+// webhookDeliveryListLimit is the number of recent deliveries shown per webhook
+const webhookDeliveryListLimit = 50
+
+// WebhookEmitter notifies a workspace's webhooks of an event
+type WebhookEmitter interface {
+	Emit(ctx context.Context, workspaceID uuid.UUID, event string, data any)
+}
+
+// WebhookService manages webhooks and queues their deliveries
+type WebhookService struct {
+	webhookRepo   domain.WebhookRepository
+	workspaceRepo domain.WorkspaceRepository
+	encryptor     *security.Encryptor
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(webhookRepo domain.WebhookRepository, workspaceRepo domain.WorkspaceRepository, encryptor *security.Encryptor) *WebhookService {
+	return &WebhookService{
+		webhookRepo:   webhookRepo,
+		workspaceRepo: workspaceRepo,
+		encryptor:     encryptor,
+	}
+}
+
+// List lists the webhooks of a workspace
+func (s *WebhookService) List(ctx context.Context, userID, workspaceID uuid.UUID) ([]domain.WebhookInfo, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+
+	webhooks, err := s.webhookRepo.ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]domain.WebhookInfo, 0, len(webhooks))
+	for i := range webhooks {
+		info, err := s.toInfo(&webhooks[i])
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, *info)
+	}
+	return infos, nil
+}
+
+// Create adds a webhook to a workspace. The secret is generated when none is given
+// and returned only in this response.
+func (s *WebhookService) Create(ctx context.Context, userID, workspaceID uuid.UUID, input domain.WebhookCreate) (*domain.WebhookInfo, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+	if err := validateWebhook(input.URL, input.Events); err != nil {
+		return nil, err
+	}
+
+	generated := input.Secret == ""
+	if generated {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		input.Secret = secret
+	}
+
+	encrypted, err := s.encryptor.EncryptJSON(domain.WebhookConfig{URL: input.URL, Secret: input.Secret})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt webhook config: %w", err)
+	}
+
+	now := time.Now()
+	webhook := &domain.Webhook{
+		ID:              uuid.New(),
+		WorkspaceID:     workspaceID,
+		ConfigEncrypted: encrypted,
+		Events:          input.Events,
+		Enabled:         input.Enabled == nil || *input.Enabled,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.webhookRepo.Create(ctx, webhook); err != nil {
+		return nil, err
+	}
+
+	info, err := s.toInfo(webhook)
+	if err != nil {
+		return nil, err
+	}
+	if generated {
+		info.Secret = input.Secret
+	}
+	return info, nil
+}
+
+// Update changes a webhook's URL, secret, events or enabled flag
+func (s *WebhookService) Update(ctx context.Context, userID, workspaceID, webhookID uuid.UUID, input domain.WebhookUpdate) (*domain.WebhookInfo, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleAdmin); err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.get(ctx, workspaceID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := s.config(webhook)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.URL != nil {
+		cfg.URL = *input.URL
+	}
+	if input.Secret != nil {
+		cfg.Secret = *input.Secret
+	}
+	if input.Events != nil {
+		webhook.Events = input.Events
+	}
+	if input.Enabled != nil {
+		webhook.Enabled = *input.Enabled
+	}
+	if err := validateWebhook(cfg.URL, webhook.Events); err != nil {
+		return nil, err
+	}
+
+	if webhook.ConfigEncrypted, err = s.encryptor.EncryptJSON(cfg); err != nil {
+		return nil, fmt.Errorf("failed to encrypt webhook config: %w", err)
+	}
+	webhook.UpdatedAt = time.Now()
+	if err := s.webhookRepo.Update(ctx, webhook); err != nil {
+		return nil, err
+	}
+	return s.toInfo(webhook)
+}
+
+// Delete removes a webhook with its delivery history
+func (s *WebhookService) Delete(ctx context.Context, userID, workspaceID, webhookID uuid.UUID) error {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleAdmin); err != nil {
+		return err
+	}
+	if _, err := s.get(ctx, workspaceID, webhookID); err != nil {
+		return err
+	}
+	return s.webhookRepo.Delete(ctx, webhookID)
+}
+
+// ListDeliveries lists the most recent deliveries of a webhook
+func (s *WebhookService) ListDeliveries(ctx context.Context, userID, workspaceID, webhookID uuid.UUID) ([]domain.WebhookDelivery, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleMember); err != nil {
+		return nil, err
+	}
+	if _, err := s.get(ctx, workspaceID, webhookID); err != nil {
+		return nil, err
+	}
+	return s.webhookRepo.ListDeliveries(ctx, webhookID, webhookDeliveryListLimit)
+}
+
+// webhookPayload is the JSON body POSTed to webhooks
+type webhookPayload struct {
+	ID          uuid.UUID `json:"id"`
+	Event       string    `json:"event"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Data        any       `json:"data"`
+}
+
+// Emit queues a delivery of event to every enabled webhook of the workspace subscribed
+// to it. Failures are logged; they never fail the operation that emitted the event.
+func (s *WebhookService) Emit(ctx context.Context, workspaceID uuid.UUID, event string, data any) {
+	ctx = context.WithoutCancel(ctx)
+
+	webhooks, err := s.webhookRepo.ListSubscribed(ctx, workspaceID, event)
+	if err != nil {
+		logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("event", event).Msg("failed to list webhooks")
+		return
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		delivery := &domain.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     webhook.ID,
+			Event:         event,
+			Status:        domain.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		delivery.Payload, err = json.Marshal(webhookPayload{
+			ID:          delivery.ID,
+			Event:       event,
+			WorkspaceID: workspaceID,
+			CreatedAt:   now,
+			Data:        data,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("event", event).Msg("failed to encode webhook payload")
+			return
+		}
+		if err := s.webhookRepo.CreateDelivery(ctx, delivery); err != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(err).Str("webhook_id", webhook.ID.String()).Msg("failed to queue webhook delivery")
+		}
+	}
+}
+
+func (s *WebhookService) get(ctx context.Context, workspaceID, webhookID uuid.UUID) (*domain.Webhook, error) {
+	webhook, err := s.webhookRepo.GetByIDAndWorkspace(ctx, webhookID, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook == nil {
+		return nil, errors.New("webhook not found")
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) config(webhook *domain.Webhook) (*domain.WebhookConfig, error) {
+	var cfg domain.WebhookConfig
+	if err := s.encryptor.DecryptJSON(webhook.ConfigEncrypted, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to decrypt webhook config: %w", err)
+	}
+	return &cfg, nil
+}
+
+func (s *WebhookService) toInfo(webhook *domain.Webhook) (*domain.WebhookInfo, error) {
+	cfg, err := s.config(webhook)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.WebhookInfo{
+		ID:          webhook.ID,
+		WorkspaceID: webhook.WorkspaceID,
+		URL:         maskWebhookURL(cfg.URL),
+		Events:      webhook.Events,
+		Enabled:     webhook.Enabled,
+		CreatedAt:   webhook.CreatedAt,
+		UpdatedAt:   webhook.UpdatedAt,
+	}, nil
+}
+
+// maskWebhookURL keeps the scheme and host of a webhook URL and masks the rest
+func maskWebhookURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return security.MaskPlaceholder
+	}
+	rest := u.EscapedPath()
+	if u.RawQuery != "" {
+		rest += "?" + u.RawQuery
+	}
+	if rest == "" || rest == "/" {
+		return u.Scheme + "://" + u.Host + rest
+	}
+	return u.Scheme + "://" + u.Host + "/" + security.MaskSecret(rest)
+}
+
+// validateWebhook checks the URL scheme and the subscribed events. URLs naming an
+// address inside the server's network are refused here; hostnames are checked once
+// resolved, when deliveries are sent.
+func validateWebhook(rawURL string, events []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook URL must be an http or https URL")
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		if err := checkWebhookAddress(addr); err != nil {
+			return err
+		}
+	}
+	if len(events) == 0 {
+		return errors.New("webhook must subscribe to at least one event")
+	}
+	for _, event := range events {
+		if !domain.IsWebhookEvent(event) {
+			return fmt.Errorf("unknown webhook event: %s", event)
+		}
+	}
+	return nil
+}
+
+// generateWebhookSecret returns a random signing secret
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// webhookMaxAttempts is the number of attempts before a delivery is marked failed
+	webhookMaxAttempts = 6
+	// webhookRetryBase is the delay before the first retry; it doubles with every attempt
+	webhookRetryBase = 30 * time.Second
+	// webhookTimeout bounds a single delivery request
+	webhookTimeout = 10 * time.Second
+	// webhookLease is how long a claimed delivery is hidden from other workers
+	webhookLease = time.Minute
+	// webhookBatchSize is the number of deliveries sent per poll
+	webhookBatchSize = 50
+)
+
+// Headers sent with every webhook delivery
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// WebhookDispatcher sends queued webhook deliveries, retrying failures with exponential backoff
+type WebhookDispatcher struct {
+	webhookRepo domain.WebhookRepository
+	encryptor   *security.Encryptor
+	client      *http.Client
+	interval    time.Duration
+}
+
+// NewWebhookDispatcher creates a dispatcher that polls for due deliveries every interval
+func NewWebhookDispatcher(webhookRepo domain.WebhookRepository, encryptor *security.Encryptor, interval time.Duration) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		webhookRepo: webhookRepo,
+		encryptor:   encryptor,
+		client:      newWebhookClient(checkWebhookAddress),
+		interval:    interval,
+	}
+}
+
+// withAddressCheck replaces the check of the addresses deliveries connect to
+func (d *WebhookDispatcher) withAddressCheck(check func(netip.Addr) error) *WebhookDispatcher {
+	d.client = newWebhookClient(check)
+	return d
+}
+
+// newWebhookClient creates the client deliveries are sent with. check runs on every
+// address dialed, after DNS resolution, so a hostname cannot point it into the
+// server's network. Redirects are not followed and proxies are not used, so neither
+// can lead a delivery past the check.
+func newWebhookClient(check func(netip.Addr) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("invalid webhook address %q: %w", address, err)
+			}
+			return check(addrPort.Addr())
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// errWebhookAddress refuses webhook addresses inside the server's network
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// checkWebhookAddress refuses loopback, private, link-local, multicast and unspecified
+// addresses, such as 127.0.0.1, 10.0.0.0/8 or the cloud metadata address 169.254.169.254
+func checkWebhookAddress(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errWebhookAddress, addr)
+	}
+	return nil
+}
+
+// Run delivers due webhooks immediately and then every interval until ctx is cancelled
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DeliverDue(ctx); err != nil {
+			log.Error().Err(err).Msg("webhook delivery failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends the deliveries that are due and returns how many were attempted
+func (d *WebhookDispatcher) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := d.webhookRepo.ClaimDueDeliveries(ctx, time.Now(), webhookLease, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i := range deliveries {
+		d.deliver(ctx, &deliveries[i])
+	}
+	return len(deliveries), nil
+}
+
+// deliver makes one attempt and records its outcome
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery *domain.WebhookDelivery) {
+	status, err := d.send(ctx, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	delivery.ResponseStatus = nil
+	if status != 0 {
+		delivery.ResponseStatus = &status
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = domain.WebhookDeliverySucceeded
+		delivery.Error = ""
+		delivery.NextAttemptAt = nil
+	case delivery.Attempts >= webhookMaxAttempts || errors.Is(err, errWebhookDisabled):
+		delivery.Status = domain.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(webhookRetryDelay(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := d.webhookRepo.UpdateDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		log.Error().Err(err).Str("delivery_id", delivery.ID.String()).Msg("failed to record webhook delivery")
+	}
+}
+
+// errWebhookDisabled fails deliveries queued before their webhook was disabled
+var errWebhookDisabled = errors.New("webhook is disabled")
+
+// send POSTs the payload and returns the response status
+func (d *WebhookDispatcher) send(ctx context.Context, delivery *domain.WebhookDelivery) (int, error) {
+	webhook, err := d.webhookRepo.GetByID(ctx, delivery.WebhookID)
+	if err != nil {
+		return 0, err
+	}
+	if webhook == nil || !webhook.Enabled {
+		return 0, errWebhookDisabled
+	}
+	var cfg domain.WebhookConfig
+	if err := d.encryptor.DecryptJSON(webhook.ConfigEncrypted, &cfg); err != nil {
+		return 0, fmt.Errorf("failed to decrypt webhook config: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "text-to-sql-webhooks")
+	req.Header.Set(WebhookEventHeader, delivery.Event)
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.String())
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(cfg.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		// The URL may carry credentials, so only the failure itself is recorded
+		return 0, security.Redact(err, cfg.URL)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookRetryDelay is the backoff after the given number of failed attempts
+func webhookRetryDelay(attempts int) time.Duration {
+	return webhookRetryBase << (attempts - 1)
+}
+
+// SignWebhookPayload returns the signature header value for a payload: "sha256=" followed by
+// the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
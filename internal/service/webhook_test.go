@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebhook(t *testing.T, encryptor *security.Encryptor, url string) *domain.Webhook {
+	t.Helper()
+	cfg, err := encryptor.EncryptJSON(domain.WebhookConfig{URL: url, Secret: "whsec_test_secret_value"})
+	require.NoError(t, err)
+	return &domain.Webhook{
+		ID:              uuid.New(),
+		WorkspaceID:     uuid.New(),
+		ConfigEncrypted: cfg,
+		Events:          []string{domain.WebhookEventQueryCompleted},
+		Enabled:         true,
+	}
+}
+
+// newLoopbackDispatcher creates a dispatcher allowed to reach test servers on loopback
+func newLoopbackDispatcher(repo domain.WebhookRepository, encryptor *security.Encryptor) *WebhookDispatcher {
+	return NewWebhookDispatcher(repo, encryptor, time.Minute).withAddressCheck(func(netip.Addr) error { return nil })
+}
+
+func TestWebhookDispatcher_DeliverDue(t *testing.T) {
+	encryptor, err := security.NewEncryptor([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("signed delivery", func(t *testing.T) {
+		var received *http.Request
+		var body []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received = r
+			body, _ = io.ReadAll(r.Body)
+		}))
+		defer server.Close()
+
+		webhook := newTestWebhook(t, encryptor, server.URL)
+		delivery := domain.WebhookDelivery{
+			ID:        uuid.New(),
+			WebhookID: webhook.ID,
+			Event:     domain.WebhookEventQueryCompleted,
+			Payload:   json.RawMessage(`{"event":"query.completed"}`),
+			Status:    domain.WebhookDeliveryPending,
+		}
+
+		repo := new(MockWebhookRepository)
+		repo.On("ClaimDueDeliveries", mock.Anything, mock.Anything, webhookLease, webhookBatchSize).
+			Return([]domain.WebhookDelivery{delivery}, nil)
+		repo.On("GetByID", mock.Anything, webhook.ID).Return(webhook, nil)
+		var recorded *domain.WebhookDelivery
+		repo.On("UpdateDelivery", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { recorded = args.Get(1).(*domain.WebhookDelivery) }).
+			Return(nil)
+
+		n, err := newLoopbackDispatcher(repo, encryptor).DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		require.NotNil(t, received)
+		assert.JSONEq(t, `{"event":"query.completed"}`, string(body))
+		assert.Equal(t, domain.WebhookEventQueryCompleted, received.Header.Get(WebhookEventHeader))
+		timestamp := received.Header.Get(WebhookTimestampHeader)
+		assert.Equal(t, SignWebhookPayload("whsec_test_secret_value", timestamp, body), received.Header.Get(WebhookSignatureHeader))
+
+		require.NotNil(t, recorded)
+		assert.Equal(t, domain.WebhookDeliverySucceeded, recorded.Status)
+		assert.Equal(t, 1, recorded.Attempts)
+		require.NotNil(t, recorded.ResponseStatus)
+		assert.Equal(t, http.StatusOK, *recorded.ResponseStatus)
+	})
+
+	t.Run("retry with backoff", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		webhook := newTestWebhook(t, encryptor, server.URL)
+		delivery := domain.WebhookDelivery{ID: uuid.New(), WebhookID: webhook.ID, Payload: json.RawMessage(`{}`), Attempts: 2}
+
+		repo := new(MockWebhookRepository)
+		repo.On("ClaimDueDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return([]domain.WebhookDelivery{delivery}, nil)
+		repo.On("GetByID", mock.Anything, webhook.ID).Return(webhook, nil)
+		var recorded *domain.WebhookDelivery
+		repo.On("UpdateDelivery", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { recorded = args.Get(1).(*domain.WebhookDelivery) }).
+			Return(nil)
+
+		before := time.Now()
+		_, err := newLoopbackDispatcher(repo, encryptor).DeliverDue(ctx)
+		require.NoError(t, err)
+
+		require.NotNil(t, recorded)
+		assert.Equal(t, 3, recorded.Attempts)
+		assert.Equal(t, "unexpected response status 502", recorded.Error)
+		require.NotNil(t, recorded.NextAttemptAt)
+		assert.WithinDuration(t, before.Add(4*webhookRetryBase), *recorded.NextAttemptAt, 5*time.Second)
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		webhook := newTestWebhook(t, encryptor, "http://127.0.0.1:1/hook")
+		delivery := domain.WebhookDelivery{ID: uuid.New(), WebhookID: webhook.ID, Payload: json.RawMessage(`{}`), Attempts: webhookMaxAttempts - 1}
+
+		repo := new(MockWebhookRepository)
+		repo.On("ClaimDueDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return([]domain.WebhookDelivery{delivery}, nil)
+		repo.On("GetByID", mock.Anything, webhook.ID).Return(webhook, nil)
+		var recorded *domain.WebhookDelivery
+		repo.On("UpdateDelivery", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { recorded = args.Get(1).(*domain.WebhookDelivery) }).
+			Return(nil)
+
+		_, err := newLoopbackDispatcher(repo, encryptor).DeliverDue(ctx)
+		require.NoError(t, err)
+
+		require.NotNil(t, recorded)
+		assert.Equal(t, domain.WebhookDeliveryFailed, recorded.Status)
+		assert.Nil(t, recorded.NextAttemptAt)
+		assert.NotContains(t, recorded.Error, "/hook", "the URL is redacted from errors")
+	})
+}
+
+func TestWebhookDispatcher_PrivateAddresses(t *testing.T) {
+	encryptor, err := security.NewEncryptor([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// deliver sends one delivery to url and returns what was recorded
+	deliver := func(t *testing.T, dispatcher func(domain.WebhookRepository) *WebhookDispatcher, url string) *domain.WebhookDelivery {
+		t.Helper()
+		webhook := newTestWebhook(t, encryptor, url)
+		repo := new(MockWebhookRepository)
+		repo.On("ClaimDueDeliveries", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return([]domain.WebhookDelivery{{ID: uuid.New(), WebhookID: webhook.ID, Payload: json.RawMessage(`{}`)}}, nil)
+		repo.On("GetByID", mock.Anything, webhook.ID).Return(webhook, nil)
+		var recorded *domain.WebhookDelivery
+		repo.On("UpdateDelivery", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { recorded = args.Get(1).(*domain.WebhookDelivery) }).
+			Return(nil)
+		_, err := dispatcher(repo).DeliverDue(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, recorded)
+		return recorded
+	}
+	production := func(repo domain.WebhookRepository) *WebhookDispatcher {
+		return NewWebhookDispatcher(repo, encryptor, time.Minute)
+	}
+	loopback := func(repo domain.WebhookRepository) *WebhookDispatcher {
+		return newLoopbackDispatcher(repo, encryptor)
+	}
+
+	t.Run("loopback", func(t *testing.T) {
+		called := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+		defer server.Close()
+
+		recorded := deliver(t, production, server.URL)
+		assert.False(t, called)
+		assert.Contains(t, recorded.Error, "webhook address is not public")
+		assert.Nil(t, recorded.ResponseStatus)
+	})
+
+	t.Run("metadata address", func(t *testing.T) {
+		recorded := deliver(t, production, "http://169.254.169.254/latest/meta-data/")
+		assert.Contains(t, recorded.Error, "webhook address is not public: 169.254.169.254")
+	})
+
+	t.Run("redirects are not followed", func(t *testing.T) {
+		followed := false
+		target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { followed = true }))
+		defer target.Close()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target.URL, http.StatusFound)
+		}))
+		defer server.Close()
+
+		recorded := deliver(t, loopback, server.URL)
+		assert.False(t, followed)
+		assert.Equal(t, "unexpected response status 302", recorded.Error)
+	})
+
+	t.Run("registration refuses private addresses", func(t *testing.T) {
+		events := []string{domain.WebhookEventQueryCompleted}
+		for _, url := range []string{"http://127.0.0.1:8080/hook", "http://10.1.2.3/hook", "http://[::1]/hook", "http://169.254.169.254/"} {
+			assert.ErrorIs(t, validateWebhook(url, events), errWebhookAddress, url)
+		}
+		assert.NoError(t, validateWebhook("https://hooks.example.com/x", events))
+	})
+}
+
+func TestWebhookService_Create(t *testing.T) {
+	encryptor, err := security.NewEncryptor([]byte("12345678901234567890123456789012"))
+	require.NoError(t, err)
+	ctx := context.Background()
+	userID, workspaceID := uuid.New(), uuid.New()
+
+	workspaceRepo := new(MockWorkspaceRepository)
+	workspaceRepo.On("GetMember", mock.Anything, workspaceID, userID).
+		Return(&domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: domain.RoleAdmin}, nil)
+	repo := new(MockWebhookRepository)
+	var stored *domain.Webhook
+	repo.On("Create", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { stored = args.Get(1).(*domain.Webhook) }).
+		Return(nil)
+	svc := NewWebhookService(repo, workspaceRepo, encryptor)
+
+	info, err := svc.Create(ctx, userID, workspaceID, domain.WebhookCreate{
+		URL:    "https://hooks.slack.com/services/T000/B000/XXXXXXXX",
+		Events: []string{domain.WebhookEventSchemaRefreshFailed},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "https://hooks.slack.com/****XXXX", info.URL)
+	assert.NotEmpty(t, info.Secret, "generated secrets are returned once")
+	assert.True(t, info.Enabled)
+
+	var cfg domain.WebhookConfig
+	require.NoError(t, encryptor.DecryptJSON(stored.ConfigEncrypted, &cfg))
+	assert.Equal(t, info.Secret, cfg.Secret)
+
+	_, err = svc.Create(ctx, userID, workspaceID, domain.WebhookCreate{URL: "ftp://example.com", Events: []string{domain.WebhookEventQueryCompleted}})
+	assert.EqualError(t, err, "webhook URL must be an http or https URL")
+
+	_, err = svc.Create(ctx, userID, workspaceID, domain.WebhookCreate{URL: "https://example.com", Events: []string{"budget.exceeded"}})
+	assert.EqualError(t, err, "unknown webhook event: budget.exceeded")
+}
@@ -2,27 +2,44 @@ package service
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
+	"github.com/Rrens/text-to-sql/internal/apperr"
 	"github.com/Rrens/text-to-sql/internal/domain"
-	"github.com/Rrens/text-to-sql/internal/repository/postgres"
+	"github.com/Rrens/text-to-sql/internal/logging"
 	"github.com/google/uuid"
 )
 
+// WorkspaceCache holds cached data of a workspace's connections, such as schemas
+type WorkspaceCache interface {
+	InvalidateByWorkspace(ctx context.Context, workspaceID uuid.UUID) (int64, error)
+}
+
 // WorkspaceService handles workspace operations
 type WorkspaceService struct {
-	workspaceRepo *postgres.WorkspaceRepository
+	workspaceRepo domain.WorkspaceRepository
+	maxRows       int // global row limit that workspace settings may only lower
+	cache         WorkspaceCache
 }
 
 // NewWorkspaceService creates a new workspace service
-func NewWorkspaceService(workspaceRepo *postgres.WorkspaceRepository) *WorkspaceService {
-	return &WorkspaceService{workspaceRepo: workspaceRepo}
+func NewWorkspaceService(workspaceRepo domain.WorkspaceRepository, maxRows int) *WorkspaceService {
+	return &WorkspaceService{workspaceRepo: workspaceRepo, maxRows: maxRows}
+}
+
+// WithCache drops a workspace's cached data when it is deleted
+func (s *WorkspaceService) WithCache(cache WorkspaceCache) *WorkspaceService {
+	s.cache = cache
+	return s
 }
 
 // Create creates a new workspace and adds the creator as owner
 func (s *WorkspaceService) Create(ctx context.Context, userID uuid.UUID, input domain.WorkspaceCreate) (*domain.Workspace, error) {
+	if err := input.Settings.Validate(s.maxRows); err != nil {
+		return nil, apperr.Wrap(apperr.Validation, err)
+	}
+
 	now := time.Now()
 	workspace := &domain.Workspace{
 		ID:        uuid.New(),
@@ -60,7 +77,7 @@ func (s *WorkspaceService) GetByID(ctx context.Context, userID, workspaceID uuid
 		return nil, fmt.Errorf("failed to check membership: %w", err)
 	}
 	if !isMember {
-		return nil, errors.New("access denied")
+		return nil, apperr.New(apperr.Forbidden, "access denied")
 	}
 
 	workspace, err := s.workspaceRepo.GetByID(ctx, workspaceID)
@@ -68,7 +85,7 @@ func (s *WorkspaceService) GetByID(ctx context.Context, userID, workspaceID uuid
 		return nil, fmt.Errorf("failed to get workspace: %w", err)
 	}
 	if workspace == nil {
-		return nil, errors.New("workspace not found")
+		return nil, apperr.New(apperr.NotFound, "workspace not found")
 	}
 
 	return workspace, nil
@@ -86,15 +103,13 @@ func (s *WorkspaceService) ListByUser(ctx context.Context, userID uuid.UUID) ([]
 // Update updates a workspace
 func (s *WorkspaceService) Update(ctx context.Context, userID, workspaceID uuid.UUID, input domain.WorkspaceUpdate) (*domain.Workspace, error) {
 	// Check if user is admin or owner
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get member: %w", err)
-	}
-	if member == nil {
-		return nil, errors.New("access denied")
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleAdmin); err != nil {
+		return nil, err
 	}
-	if member.Role != domain.RoleOwner && member.Role != domain.RoleAdmin {
-		return nil, errors.New("admin access required")
+	if input.Settings != nil {
+		if err := input.Settings.Validate(s.maxRows); err != nil {
+			return nil, apperr.Wrap(apperr.Validation, err)
+		}
 	}
 
 	// Update workspace
@@ -108,37 +123,45 @@ func (s *WorkspaceService) Update(ctx context.Context, userID, workspaceID uuid.
 // Delete deletes a workspace (owner only)
 func (s *WorkspaceService) Delete(ctx context.Context, userID, workspaceID uuid.UUID) error {
 	// Check if user is owner
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
-	if err != nil {
-		return fmt.Errorf("failed to get member: %w", err)
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleOwner); err != nil {
+		return err
 	}
-	if member == nil {
-		return errors.New("access denied")
+
+	if err := s.workspaceRepo.Delete(ctx, workspaceID); err != nil {
+		return err
 	}
-	if member.Role != domain.RoleOwner {
-		return errors.New("owner access required")
+	if s.cache != nil {
+		// The entries expire on their own, so a failure here is not fatal
+		if _, err := s.cache.InvalidateByWorkspace(ctx, workspaceID); err != nil {
+			logging.FromContext(ctx).Warn().Ctx(ctx).Err(err).Str("workspace_id", workspaceID.String()).Msg("failed to drop workspace cache")
+		}
 	}
-
-	return s.workspaceRepo.Delete(ctx, workspaceID)
+	return nil
 }
 
-// AddMember adds a member to a workspace
+// AddMember adds a member to a workspace. Roles of existing members are changed
+// through UpdateMemberRole.
 func (s *WorkspaceService) AddMember(ctx context.Context, requesterID, workspaceID, userID uuid.UUID, role string) error {
 	// Check if requester is admin or owner
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+	requester, err := requireRole(ctx, s.workspaceRepo, workspaceID, requesterID, domain.RoleAdmin)
 	if err != nil {
-		return fmt.Errorf("failed to get member: %w", err)
+		return err
 	}
-	if member == nil {
-		return errors.New("access denied")
+
+	// Validate role
+	if !domain.IsAssignableRole(role) {
+		return apperr.New(apperr.Validation, "invalid role")
 	}
-	if member.Role != domain.RoleOwner && member.Role != domain.RoleAdmin {
-		return errors.New("admin access required")
+	if !domain.RoleOutranks(requester.Role, role) {
+		return apperr.Newf(apperr.Forbidden, "cannot grant the %s role", role)
 	}
 
-	// Validate role
-	if role != domain.RoleMember && role != domain.RoleAdmin {
-		return errors.New("invalid role")
+	existing, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get target member: %w", err)
+	}
+	if existing != nil {
+		return apperr.New(apperr.Conflict, "user is already a member, change their role instead")
 	}
 
 	newMember := &domain.WorkspaceMember{
@@ -151,18 +174,45 @@ func (s *WorkspaceService) AddMember(ctx context.Context, requesterID, workspace
 	return s.workspaceRepo.AddMember(ctx, newMember)
 }
 
-// RemoveMember removes a member from a workspace
-func (s *WorkspaceService) RemoveMember(ctx context.Context, requesterID, workspaceID, userID uuid.UUID) error {
-	// Check if requester is admin or owner
-	member, err := s.workspaceRepo.GetMember(ctx, workspaceID, requesterID)
+// UpdateMemberRole changes the role of a member. The requester must outrank both the
+// member's current role and the new one, so the owner cannot be demoted and admins
+// cannot change each other.
+func (s *WorkspaceService) UpdateMemberRole(ctx context.Context, requesterID, workspaceID, userID uuid.UUID, role string) error {
+	requester, err := requireRole(ctx, s.workspaceRepo, workspaceID, requesterID, domain.RoleAdmin)
 	if err != nil {
-		return fmt.Errorf("failed to get member: %w", err)
+		return err
 	}
-	if member == nil {
-		return errors.New("access denied")
+	if !domain.IsAssignableRole(role) {
+		return apperr.New(apperr.Validation, "invalid role")
 	}
-	if member.Role != domain.RoleOwner && member.Role != domain.RoleAdmin {
-		return errors.New("admin access required")
+
+	target, err := s.workspaceRepo.GetMember(ctx, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get target member: %w", err)
+	}
+	if target == nil {
+		return apperr.New(apperr.NotFound, "member not found")
+	}
+	if target.Role == domain.RoleOwner {
+		return apperr.New(apperr.Forbidden, "cannot change the owner's role")
+	}
+	if !domain.RoleOutranks(requester.Role, target.Role) {
+		return apperr.Newf(apperr.Forbidden, "cannot change the role of a member with the %s role", target.Role)
+	}
+	if !domain.RoleOutranks(requester.Role, role) {
+		return apperr.Newf(apperr.Forbidden, "cannot grant the %s role", role)
+	}
+
+	return s.workspaceRepo.UpdateMemberRole(ctx, workspaceID, userID, role)
+}
+
+// RemoveMember removes a member from a workspace. Like role changes, admins can only
+// remove members they outrank, though anyone but the owner may remove themselves.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, requesterID, workspaceID, userID uuid.UUID) error {
+	// Check if requester is admin or owner
+	requester, err := requireRole(ctx, s.workspaceRepo, workspaceID, requesterID, domain.RoleAdmin)
+	if err != nil {
+		return err
 	}
 
 	// Cannot remove owner
@@ -171,12 +221,28 @@ func (s *WorkspaceService) RemoveMember(ctx context.Context, requesterID, worksp
 		return fmt.Errorf("failed to get target member: %w", err)
 	}
 	if targetMember != nil && targetMember.Role == domain.RoleOwner {
-		return errors.New("cannot remove owner")
+		return apperr.New(apperr.Forbidden, "cannot remove owner")
+	}
+	if targetMember != nil && userID != requesterID && !domain.RoleOutranks(requester.Role, targetMember.Role) {
+		return apperr.Newf(apperr.Forbidden, "cannot remove a member with the %s role", targetMember.Role)
 	}
 
 	return s.workspaceRepo.RemoveMember(ctx, workspaceID, userID)
 }
 
+// WorkspaceRateLimit returns the requests a minute a workspace's members may make
+// together, 0 when the workspace sets no limit of its own
+func (s *WorkspaceService) WorkspaceRateLimit(ctx context.Context, workspaceID uuid.UUID) (int, error) {
+	workspace, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if workspace == nil {
+		return 0, nil
+	}
+	return workspace.Settings.RateLimitPerMinute, nil
+}
+
 // IsMember checks if a user is a member of a workspace
 func (s *WorkspaceService) IsMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
 	return s.workspaceRepo.IsMember(ctx, workspaceID, userID)
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/logging"
+	"github.com/Rrens/text-to-sql/internal/mcp"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+)
+
+// Exports page through sessions and keep at most exportSessionMessages of each
+const (
+	exportSessionPage     = 100
+	exportSessionMessages = 10000
+)
+
+// WorkspaceBundleService exports workspaces as bundles and recreates them from one
+type WorkspaceBundleService struct {
+	workspaceRepo  domain.WorkspaceRepository
+	connectionRepo domain.ConnectionRepository
+	templateRepo   domain.QueryTemplateRepository
+	sessionRepo    domain.SessionRepository
+	messageRepo    domain.MessageRepository
+	encryptor      *security.Encryptor
+	maxRows        int // global row limit, the default for imported connections
+	defaultTimeout int
+}
+
+// NewWorkspaceBundleService creates a new workspace bundle service
+func NewWorkspaceBundleService(
+	workspaceRepo domain.WorkspaceRepository,
+	connectionRepo domain.ConnectionRepository,
+	templateRepo domain.QueryTemplateRepository,
+	sessionRepo domain.SessionRepository,
+	messageRepo domain.MessageRepository,
+	encryptor *security.Encryptor,
+	maxRows int,
+	defaultTimeout int,
+) *WorkspaceBundleService {
+	return &WorkspaceBundleService{
+		workspaceRepo:  workspaceRepo,
+		connectionRepo: connectionRepo,
+		templateRepo:   templateRepo,
+		sessionRepo:    sessionRepo,
+		messageRepo:    messageRepo,
+		encryptor:      encryptor,
+		maxRows:        maxRows,
+		defaultTimeout: defaultTimeout,
+	}
+}
+
+// Export bundles a workspace's settings, connections without credentials and
+// templates, and with includeHistory the chat sessions that are not deleted. Only the
+// owner may export.
+func (s *WorkspaceBundleService) Export(ctx context.Context, userID, workspaceID uuid.UUID, includeHistory bool) (*domain.WorkspaceBundle, error) {
+	if _, err := requireRole(ctx, s.workspaceRepo, workspaceID, userID, domain.RoleOwner); err != nil {
+		return nil, err
+	}
+	workspace, err := s.workspaceRepo.GetByID(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+	if workspace == nil {
+		return nil, apperr.New(apperr.NotFound, "workspace not found")
+	}
+
+	bundle := &domain.WorkspaceBundle{
+		Version:     domain.WorkspaceBundleVersion,
+		ExportedAt:  time.Now().UTC(),
+		Name:        workspace.Name,
+		Settings:    workspace.Settings,
+		Connections: []domain.BundleConnection{},
+		Templates:   []domain.BundleTemplate{},
+	}
+
+	connections, err := s.connectionRepo.ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list connections: %w", err)
+	}
+	for _, c := range connections {
+		bundle.Connections = append(bundle.Connections, domain.BundleConnection{
+			ID:                    c.ID,
+			Name:                  c.Name,
+			DatabaseType:          c.DatabaseType,
+			Host:                  c.Host,
+			Port:                  c.Port,
+			Database:              c.Database,
+			Username:              c.Username,
+			SSLMode:               c.SSLMode,
+			ReadOnly:              c.ReadOnly,
+			MaxRows:               c.MaxRows,
+			TimeoutSeconds:        c.TimeoutSeconds,
+			SchemaCacheTTLSeconds: c.SchemaCacheTTLSeconds,
+			MaxEstimatedRows:      c.MaxEstimatedRows,
+			ErrorRateThreshold:    c.ErrorRateThreshold,
+			DefaultLimit:          c.DefaultLimit,
+			SchemaOrder:           c.SchemaOrder,
+			ReplicaHost:           c.ReplicaHost,
+			ReplicaPort:           c.ReplicaPort,
+			ReplicaUse:            c.ReplicaUse,
+			CredentialsRequired:   true,
+		})
+	}
+
+	templates, err := s.templateRepo.ListByWorkspace(ctx, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	for _, t := range templates {
+		bundle.Templates = append(bundle.Templates, domain.BundleTemplate{
+			ID:           t.ID,
+			ConnectionID: t.ConnectionID,
+			Name:         t.Name,
+			Description:  t.Description,
+			SQL:          t.SQL,
+			Parameters:   t.Parameters,
+		})
+	}
+
+	if includeHistory {
+		if bundle.Sessions, err = s.exportSessions(ctx, workspaceID); err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+// exportSessions returns every session of a workspace that is not deleted, with its messages
+func (s *WorkspaceBundleService) exportSessions(ctx context.Context, workspaceID uuid.UUID) ([]domain.BundleSession, error) {
+	sessions := []domain.BundleSession{}
+	for offset := 0; ; offset += exportSessionPage {
+		page, total, err := s.sessionRepo.ListByWorkspace(ctx, workspaceID, exportSessionPage, offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		for _, session := range page {
+			messages, err := s.messageRepo.ListBySession(ctx, session.ID, exportSessionMessages)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list messages: %w", err)
+			}
+			exported := domain.BundleSession{
+				ID:           session.ID,
+				Title:        session.Title,
+				ConnectionID: session.ConnectionID,
+				CreatedAt:    session.CreatedAt,
+				UpdatedAt:    session.UpdatedAt,
+				Messages:     make([]domain.BundleMessage, 0, len(messages)),
+			}
+			for _, m := range messages {
+				exported.Messages = append(exported.Messages, domain.BundleMessage{
+					Role:      m.Role,
+					Content:   m.Content,
+					SQL:       m.SQL,
+					Result:    m.Result,
+					Metadata:  m.Metadata,
+					Error:     m.Error,
+					Status:    m.Status,
+					RowCount:  m.RowCount,
+					LatencyMs: m.LatencyMs,
+					CreatedAt: m.CreatedAt,
+				})
+			}
+			sessions = append(sessions, exported)
+		}
+		if len(page) == 0 || offset+len(page) >= total {
+			return sessions, nil
+		}
+	}
+}
+
+// Import recreates a bundle as a new workspace owned by the user, giving everything
+// new IDs. Imported connections have no password until one is set. When any part
+// fails the new workspace is deleted, so an import either completes or leaves nothing.
+func (s *WorkspaceBundleService) Import(ctx context.Context, userID uuid.UUID, bundle *domain.WorkspaceBundle) (*domain.WorkspaceImport, error) {
+	if err := bundle.Validate(s.maxRows); err != nil {
+		return nil, apperr.Wrap(apperr.Validation, err)
+	}
+	for _, t := range bundle.Templates {
+		if err := validateTemplate(t.SQL, t.Parameters); err != nil {
+			return nil, apperr.Wrap(apperr.Validation, fmt.Errorf("template %q: %w", t.Name, err))
+		}
+	}
+
+	now := time.Now()
+	workspace := &domain.Workspace{
+		ID:        uuid.New(),
+		Name:      bundle.Name,
+		Settings:  bundle.Settings,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.workspaceRepo.Create(ctx, workspace); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	report, err := s.importInto(ctx, userID, workspace, bundle)
+	if err != nil {
+		// Everything imported so far cascades with the workspace
+		if delErr := s.workspaceRepo.Delete(context.WithoutCancel(ctx), workspace.ID); delErr != nil {
+			logging.FromContext(ctx).Error().Ctx(ctx).Err(delErr).Str("workspace_id", workspace.ID.String()).Msg("failed to delete partially imported workspace")
+		}
+		return nil, err
+	}
+	return report, nil
+}
+
+// importInto adds the user as owner of a newly created workspace and recreates the
+// bundle's entries in it
+func (s *WorkspaceBundleService) importInto(ctx context.Context, userID uuid.UUID, workspace *domain.Workspace, bundle *domain.WorkspaceBundle) (*domain.WorkspaceImport, error) {
+	now := workspace.CreatedAt
+	member := &domain.WorkspaceMember{
+		WorkspaceID: workspace.ID,
+		UserID:      userID,
+		Role:        domain.RoleOwner,
+		CreatedAt:   now,
+	}
+	if err := s.workspaceRepo.AddMember(ctx, member); err != nil {
+		return nil, fmt.Errorf("failed to add member: %w", err)
+	}
+
+	report := &domain.WorkspaceImport{
+		Workspace:           workspace,
+		Connections:         make(map[uuid.UUID]uuid.UUID, len(bundle.Connections)),
+		Templates:           make(map[uuid.UUID]uuid.UUID, len(bundle.Templates)),
+		Sessions:            make(map[uuid.UUID]uuid.UUID, len(bundle.Sessions)),
+		CredentialsRequired: []domain.ConnectionInfo{},
+	}
+
+	// Imported connections get an empty password, which is set again with an update
+	noCredentials, err := s.encryptor.EncryptJSON(map[string]string{"password": ""})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	for _, c := range bundle.Connections {
+		conn := &domain.Connection{
+			ID:                    uuid.New(),
+			WorkspaceID:           workspace.ID,
+			Name:                  c.Name,
+			DatabaseType:          c.DatabaseType,
+			Host:                  c.Host,
+			Port:                  c.Port,
+			Database:              c.Database,
+			Username:              c.Username,
+			CredentialsEncrypted:  noCredentials,
+			SSLMode:               cmp.Or(c.SSLMode, "disable"),
+			ReadOnly:              c.ReadOnly,
+			MaxRows:               cmp.Or(c.MaxRows, s.maxRows),
+			TimeoutSeconds:        cmp.Or(c.TimeoutSeconds, s.defaultTimeout),
+			SchemaCacheTTLSeconds: c.SchemaCacheTTLSeconds,
+			MaxEstimatedRows:      c.MaxEstimatedRows,
+			ErrorRateThreshold:    c.ErrorRateThreshold,
+			DefaultLimit:          c.DefaultLimit,
+			SchemaOrder:           cmp.Or(c.SchemaOrder, string(mcp.SchemaOrderSize)),
+			ReplicaHost:           c.ReplicaHost,
+			ReplicaPort:           c.ReplicaPort,
+			ReplicaUse:            c.ReplicaUse,
+			CreatedAt:             now,
+			UpdatedAt:             now,
+		}
+		if err := s.connectionRepo.Create(ctx, conn); err != nil {
+			return nil, fmt.Errorf("failed to create connection: %w", err)
+		}
+		report.Connections[c.ID] = conn.ID
+		report.CredentialsRequired = append(report.CredentialsRequired, conn.ToInfo())
+	}
+
+	for _, t := range bundle.Templates {
+		params := t.Parameters
+		if params == nil {
+			params = []domain.TemplateParameter{}
+		}
+		template := &domain.QueryTemplate{
+			ID:           uuid.New(),
+			WorkspaceID:  workspace.ID,
+			ConnectionID: report.Connections[t.ConnectionID],
+			Name:         t.Name,
+			Description:  t.Description,
+			SQL:          t.SQL,
+			Parameters:   params,
+			CreatedBy:    &userID,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := s.templateRepo.Create(ctx, template); err != nil {
+			return nil, fmt.Errorf("failed to create template: %w", err)
+		}
+		report.Templates[t.ID] = template.ID
+	}
+
+	for _, bs := range bundle.Sessions {
+		session := &domain.ChatSession{
+			ID:           uuid.New(),
+			WorkspaceID:  workspace.ID,
+			UserID:       &userID,
+			Title:        bs.Title,
+			ConnectionID: remapID(report.Connections, bs.ConnectionID),
+			CreatedAt:    timeOr(bs.CreatedAt, now),
+			UpdatedAt:    timeOr(bs.UpdatedAt, now),
+		}
+		if session.Title == "" {
+			session.Title = domain.DefaultSessionTitle
+		}
+		if err := s.sessionRepo.Create(ctx, session); err != nil {
+			return nil, fmt.Errorf("failed to create session: %w", err)
+		}
+		report.Sessions[bs.ID] = session.ID
+
+		for _, bm := range bs.Messages {
+			message := &domain.Message{
+				ID:          uuid.New(),
+				WorkspaceID: workspace.ID,
+				SessionID:   &session.ID,
+				Role:        bm.Role,
+				Content:     bm.Content,
+				SQL:         bm.SQL,
+				Result:      bm.Result,
+				Metadata:    remapMetadata(bm.Metadata, report),
+				Error:       bm.Error,
+				Status:      bm.Status,
+				RowCount:    bm.RowCount,
+				LatencyMs:   bm.LatencyMs,
+				CreatedAt:   timeOr(bm.CreatedAt, now),
+			}
+			if bm.Role == domain.RoleUser {
+				message.UserID = &userID
+			}
+			if err := s.messageRepo.Create(ctx, message); err != nil {
+				return nil, fmt.Errorf("failed to create message: %w", err)
+			}
+			report.Messages++
+		}
+	}
+	return report, nil
+}
+
+// remapMetadata returns a copy of an imported message's metadata pointing at the new
+// connection and template
+func remapMetadata(metadata *domain.QueryMetadata, report *domain.WorkspaceImport) *domain.QueryMetadata {
+	if metadata == nil {
+		return nil
+	}
+	remapped := *metadata
+	remapped.ConnectionID = report.Connections[metadata.ConnectionID]
+	if metadata.Template != nil {
+		template := *metadata.Template
+		if id, ok := report.Templates[template.ID]; ok {
+			template.ID = id
+		}
+		remapped.Template = &template
+	}
+	return &remapped
+}
+
+// remapID returns the new ID of a bundle ID, or nil when the bundle has no such entry
+func remapID(ids map[uuid.UUID]uuid.UUID, id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	newID, ok := ids[*id]
+	if !ok {
+		return nil
+	}
+	return &newID
+}
+
+// timeOr returns t, or fallback when t is zero
+func timeOr(t, fallback time.Time) time.Time {
+	if t.IsZero() {
+		return fallback
+	}
+	return t
+}
@@ -0,0 +1,367 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Rrens/text-to-sql/internal/apperr"
+	"github.com/Rrens/text-to-sql/internal/domain"
+	"github.com/Rrens/text-to-sql/internal/security"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryWorkspaceStore keeps workspaces and what belongs to them in memory. Each
+// repository embeds its interface, so methods the bundle service does not use panic.
+type memoryWorkspaceStore struct {
+	workspaces  map[uuid.UUID]*domain.Workspace
+	members     []domain.WorkspaceMember
+	connections []domain.Connection
+	templates   []domain.QueryTemplate
+	sessions    []domain.ChatSession
+	messages    []domain.Message
+	failOn      string // fails creating this kind of entry
+}
+
+func newMemoryWorkspaceStore() *memoryWorkspaceStore {
+	return &memoryWorkspaceStore{workspaces: map[uuid.UUID]*domain.Workspace{}}
+}
+
+type memoryWorkspaceRepo struct {
+	domain.WorkspaceRepository
+	*memoryWorkspaceStore
+}
+
+func (r memoryWorkspaceRepo) Create(ctx context.Context, w *domain.Workspace) error {
+	r.workspaces[w.ID] = w
+	return nil
+}
+
+func (r memoryWorkspaceRepo) GetByID(ctx context.Context, id uuid.UUID) (*domain.Workspace, error) {
+	return r.workspaces[id], nil
+}
+
+func (r memoryWorkspaceRepo) AddMember(ctx context.Context, m *domain.WorkspaceMember) error {
+	r.members = append(r.members, *m)
+	return nil
+}
+
+func (r memoryWorkspaceRepo) UpdateMemberRole(ctx context.Context, workspaceID, userID uuid.UUID, role string) error {
+	return nil
+}
+
+func (r memoryWorkspaceRepo) GetMember(ctx context.Context, workspaceID, userID uuid.UUID) (*domain.WorkspaceMember, error) {
+	for _, m := range r.members {
+		if m.WorkspaceID == workspaceID && m.UserID == userID {
+			return &m, nil
+		}
+	}
+	return nil, nil
+}
+
+// Delete cascades like the foreign keys do
+func (r memoryWorkspaceRepo) Delete(ctx context.Context, id uuid.UUID) error {
+	delete(r.workspaces, id)
+	r.members = slices.DeleteFunc(r.members, func(m domain.WorkspaceMember) bool { return m.WorkspaceID == id })
+	r.connections = slices.DeleteFunc(r.connections, func(c domain.Connection) bool { return c.WorkspaceID == id })
+	r.templates = slices.DeleteFunc(r.templates, func(t domain.QueryTemplate) bool { return t.WorkspaceID == id })
+	r.sessions = slices.DeleteFunc(r.sessions, func(s domain.ChatSession) bool { return s.WorkspaceID == id })
+	r.messages = slices.DeleteFunc(r.messages, func(m domain.Message) bool { return m.WorkspaceID == id })
+	return nil
+}
+
+type memoryConnectionRepo struct {
+	domain.ConnectionRepository
+	*memoryWorkspaceStore
+}
+
+func (r memoryConnectionRepo) Create(ctx context.Context, c *domain.Connection) error {
+	r.connections = append(r.connections, *c)
+	return nil
+}
+
+func (r memoryConnectionRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.Connection, error) {
+	var list []domain.Connection
+	for _, c := range r.connections {
+		if c.WorkspaceID == workspaceID {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+type memoryTemplateRepo struct {
+	domain.QueryTemplateRepository
+	*memoryWorkspaceStore
+}
+
+func (r memoryTemplateRepo) Create(ctx context.Context, t *domain.QueryTemplate) error {
+	if r.failOn == "template" {
+		return errors.New("insert failed")
+	}
+	r.templates = append(r.templates, *t)
+	return nil
+}
+
+func (r memoryTemplateRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]domain.QueryTemplate, error) {
+	var list []domain.QueryTemplate
+	for _, t := range r.templates {
+		if t.WorkspaceID == workspaceID {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+type memorySessionRepo struct {
+	domain.SessionRepository
+	*memoryWorkspaceStore
+}
+
+func (r memorySessionRepo) Create(ctx context.Context, s *domain.ChatSession) error {
+	r.sessions = append(r.sessions, *s)
+	return nil
+}
+
+func (r memorySessionRepo) ListByWorkspace(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]domain.ChatSessionSummary, int, error) {
+	var all []domain.ChatSessionSummary
+	for _, s := range r.sessions {
+		if s.WorkspaceID == workspaceID {
+			all = append(all, domain.ChatSessionSummary{ChatSession: s})
+		}
+	}
+	return all[min(offset, len(all)):min(offset+limit, len(all))], len(all), nil
+}
+
+type memoryMessageRepo struct {
+	domain.MessageRepository
+	*memoryWorkspaceStore
+}
+
+func (r memoryMessageRepo) Create(ctx context.Context, m *domain.Message) error {
+	r.messages = append(r.messages, *m)
+	return nil
+}
+
+func (r memoryMessageRepo) ListBySession(ctx context.Context, sessionID uuid.UUID, limit int) ([]domain.Message, error) {
+	var list []domain.Message
+	for _, m := range r.messages {
+		if m.SessionID != nil && *m.SessionID == sessionID {
+			list = append(list, m)
+		}
+	}
+	return list, nil
+}
+
+func newBundleTestService(t *testing.T, store *memoryWorkspaceStore) *WorkspaceBundleService {
+	encryptor, err := security.NewEncryptorFromSecret("bundle-test-secret")
+	require.NoError(t, err)
+	return NewWorkspaceBundleService(
+		memoryWorkspaceRepo{memoryWorkspaceStore: store},
+		memoryConnectionRepo{memoryWorkspaceStore: store},
+		memoryTemplateRepo{memoryWorkspaceStore: store},
+		memorySessionRepo{memoryWorkspaceStore: store},
+		memoryMessageRepo{memoryWorkspaceStore: store},
+		encryptor, 1000, 30,
+	)
+}
+
+// seedBundleWorkspace creates a workspace with a connection, a template and a session
+func seedBundleWorkspace(store *memoryWorkspaceStore, ownerID uuid.UUID) uuid.UUID {
+	created := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	workspaceID, connectionID, templateID, sessionID := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	ttl := 600
+
+	store.workspaces[workspaceID] = &domain.Workspace{
+		ID:       workspaceID,
+		Name:     "Analytics",
+		Settings: domain.WorkspaceSettings{DefaultLLMProvider: "openai", MaxRows: 500, Timezone: "Asia/Jakarta"},
+	}
+	store.members = append(store.members, domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: ownerID, Role: domain.RoleOwner})
+	store.connections = append(store.connections, domain.Connection{
+		ID: connectionID, WorkspaceID: workspaceID, Name: "warehouse", DatabaseType: domain.DatabaseTypePostgres,
+		Host: "db.internal", Port: 5432, Database: "sales", Username: "reader", CredentialsEncrypted: []byte("secret"),
+		SSLMode: "require", ReadOnly: true, MaxRows: 200, TimeoutSeconds: 15, SchemaCacheTTLSeconds: &ttl, SchemaOrder: "recent",
+	})
+	store.templates = append(store.templates, domain.QueryTemplate{
+		ID: templateID, WorkspaceID: workspaceID, ConnectionID: connectionID, Name: "Orders by status",
+		SQL: "SELECT * FROM orders WHERE status = {{status}}", Parameters: []domain.TemplateParameter{{Name: "status", Type: "string", Default: "paid"}},
+	})
+	store.sessions = append(store.sessions, domain.ChatSession{
+		ID: sessionID, WorkspaceID: workspaceID, UserID: &ownerID, Title: "Orders", ConnectionID: &connectionID, CreatedAt: created, UpdatedAt: created,
+	})
+	rows := 3
+	store.messages = append(store.messages,
+		domain.Message{ID: uuid.New(), WorkspaceID: workspaceID, UserID: &ownerID, SessionID: &sessionID, Role: domain.RoleUser, Content: "Paid orders", CreatedAt: created},
+		domain.Message{
+			ID: uuid.New(), WorkspaceID: workspaceID, SessionID: &sessionID, Role: domain.RoleAssistant, SQL: "SELECT * FROM orders WHERE status = 'paid'",
+			Status: domain.QueryStatusOK, RowCount: &rows, CreatedAt: created.Add(time.Second),
+			Metadata: &domain.QueryMetadata{ConnectionID: connectionID, LLMProvider: "template", Template: &domain.TemplateRun{ID: templateID, Name: "Orders by status"}},
+		},
+	)
+	return workspaceID
+}
+
+// mapBundleIDs rewrites a bundle's IDs through ids, so bundles of different imports compare
+func mapBundleIDs(b *domain.WorkspaceBundle, ids map[uuid.UUID]uuid.UUID) {
+	b.ExportedAt = time.Time{}
+	for i := range b.Connections {
+		b.Connections[i].ID = ids[b.Connections[i].ID]
+	}
+	for i := range b.Templates {
+		b.Templates[i].ID = ids[b.Templates[i].ID]
+		b.Templates[i].ConnectionID = ids[b.Templates[i].ConnectionID]
+	}
+	for i := range b.Sessions {
+		s := &b.Sessions[i]
+		s.ID = ids[s.ID]
+		if s.ConnectionID != nil {
+			id := ids[*s.ConnectionID]
+			s.ConnectionID = &id
+		}
+		for j := range s.Messages {
+			if m := s.Messages[j].Metadata; m != nil {
+				metadata := *m
+				metadata.ConnectionID = ids[m.ConnectionID]
+				if m.Template != nil {
+					metadata.Template = &domain.TemplateRun{ID: ids[m.Template.ID], Name: m.Template.Name, Params: m.Template.Params}
+				}
+				s.Messages[j].Metadata = &metadata
+			}
+		}
+	}
+}
+
+func TestWorkspaceBundle_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryWorkspaceStore()
+	svc := newBundleTestService(t, store)
+	ownerID, importerID := uuid.New(), uuid.New()
+	workspaceID := seedBundleWorkspace(store, ownerID)
+
+	exported, err := svc.Export(ctx, ownerID, workspaceID, true)
+	require.NoError(t, err)
+	assert.Equal(t, domain.WorkspaceBundleVersion, exported.Version)
+	require.Len(t, exported.Connections, 1)
+	assert.True(t, exported.Connections[0].CredentialsRequired)
+	require.Len(t, exported.Sessions, 1)
+	assert.Len(t, exported.Sessions[0].Messages, 2)
+
+	report, err := svc.Import(ctx, importerID, exported)
+	require.NoError(t, err)
+	assert.NotEqual(t, workspaceID, report.Workspace.ID)
+	assert.Equal(t, 2, report.Messages)
+	require.Len(t, report.CredentialsRequired, 1)
+	assert.Equal(t, report.Connections[exported.Connections[0].ID], report.CredentialsRequired[0].ID)
+	for oldID, newID := range report.Connections {
+		assert.NotEqual(t, oldID, newID)
+	}
+
+	reexported, err := svc.Export(ctx, importerID, report.Workspace.ID, true)
+	require.NoError(t, err, "the importer owns the new workspace")
+
+	// Mapping the new IDs back gives the original bundle
+	back := map[uuid.UUID]uuid.UUID{}
+	for _, ids := range []map[uuid.UUID]uuid.UUID{report.Connections, report.Templates, report.Sessions} {
+		for oldID, newID := range ids {
+			back[newID] = oldID
+		}
+	}
+	mapBundleIDs(reexported, back)
+	exported.ExportedAt = time.Time{}
+	assert.Equal(t, exported, reexported)
+
+	t.Run("credentials are not carried over", func(t *testing.T) {
+		var imported domain.Connection
+		for _, c := range store.connections {
+			if c.WorkspaceID == report.Workspace.ID {
+				imported = c
+			}
+		}
+		var credentials map[string]string
+		require.NoError(t, svc.encryptor.DecryptJSON(imported.CredentialsEncrypted, &credentials))
+		assert.Equal(t, map[string]string{"password": ""}, credentials)
+	})
+
+	t.Run("without history", func(t *testing.T) {
+		bundle, err := svc.Export(ctx, ownerID, workspaceID, false)
+		require.NoError(t, err)
+		assert.Nil(t, bundle.Sessions)
+		assert.Len(t, bundle.Templates, 1)
+	})
+}
+
+func TestWorkspaceBundle_ExportOwnerOnly(t *testing.T) {
+	store := newMemoryWorkspaceStore()
+	svc := newBundleTestService(t, store)
+	ownerID, adminID := uuid.New(), uuid.New()
+	workspaceID := seedBundleWorkspace(store, ownerID)
+	store.members = append(store.members, domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: adminID, Role: domain.RoleAdmin})
+
+	_, err := svc.Export(context.Background(), adminID, workspaceID, false)
+	assert.Equal(t, apperr.Forbidden, apperr.KindOf(err))
+}
+
+func TestWorkspaceBundle_Import(t *testing.T) {
+	ctx := context.Background()
+	connectionID := uuid.New()
+	valid := func() *domain.WorkspaceBundle {
+		return &domain.WorkspaceBundle{
+			Version:     domain.WorkspaceBundleVersion,
+			Name:        "Imported",
+			Connections: []domain.BundleConnection{{ID: connectionID, Name: "db", DatabaseType: domain.DatabaseTypeMySQL, Host: "db", Port: 3306, Database: "app"}},
+			Templates:   []domain.BundleTemplate{{ID: uuid.New(), ConnectionID: connectionID, Name: "All users", SQL: "SELECT * FROM users"}},
+		}
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		store := newMemoryWorkspaceStore()
+		report, err := newBundleTestService(t, store).Import(ctx, uuid.New(), valid())
+		require.NoError(t, err)
+		require.Len(t, store.connections, 1)
+		conn := store.connections[0]
+		assert.Equal(t, 1000, conn.MaxRows)
+		assert.Equal(t, 30, conn.TimeoutSeconds)
+		assert.Equal(t, "disable", conn.SSLMode)
+		assert.Equal(t, "size", conn.SchemaOrder)
+		assert.Equal(t, []domain.TemplateParameter{}, store.templates[0].Parameters)
+		assert.Empty(t, report.Sessions)
+	})
+
+	invalid := []struct {
+		name    string
+		modify  func(b *domain.WorkspaceBundle)
+		wantErr string
+	}{
+		{"version", func(b *domain.WorkspaceBundle) { b.Version = 2 }, "unsupported bundle version 2, expected 1"},
+		{"unknown connection", func(b *domain.WorkspaceBundle) { b.Templates[0].ConnectionID = uuid.New() }, `template "All users" uses connection`},
+		{"writing template", func(b *domain.WorkspaceBundle) { b.Templates[0].SQL = "DELETE FROM users" }, `template "All users": invalid template`},
+		{"settings", func(b *domain.WorkspaceBundle) { b.Settings.DefaultLLMProvider = "groq" }, "unknown default_llm_provider"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMemoryWorkspaceStore()
+			bundle := valid()
+			tt.modify(bundle)
+			_, err := newBundleTestService(t, store).Import(ctx, uuid.New(), bundle)
+			require.Error(t, err)
+			assert.Equal(t, apperr.Validation, apperr.KindOf(err))
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Empty(t, store.workspaces, "nothing is created")
+		})
+	}
+
+	t.Run("failure removes the partial workspace", func(t *testing.T) {
+		store := newMemoryWorkspaceStore()
+		store.failOn = "template"
+		_, err := newBundleTestService(t, store).Import(ctx, uuid.New(), valid())
+		require.Error(t, err)
+		assert.Empty(t, store.workspaces)
+		assert.Empty(t, store.members)
+		assert.Empty(t, store.connections)
+	})
+}
@@ -0,0 +1,23 @@
+// Package version holds build information injected at link time, e.g.
+//
+//	go build -ldflags "-X github.com/Rrens/text-to-sql/internal/version.Version=v1.2.0"
+package version
+
+// Set via -ldflags -X; see the Makefile
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = ""
+)
+
+// Info is the build information reported by the readiness endpoint
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time,omitempty"`
+}
+
+// Get returns the build information of the running binary
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, BuildTime: BuildTime}
+}
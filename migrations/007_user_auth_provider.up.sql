@@ -0,0 +1,6 @@
+-- Track how a user authenticates so SSO accounts can be matched by subject
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS auth_provider VARCHAR(50) NOT NULL DEFAULT 'password',
+ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(auth_provider, external_id)
+WHERE external_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Global administrators and account deactivation
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_chat_sessions_deleted;
+
+ALTER TABLE chat_sessions
+DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,17 @@
+-- Soft-deleted sessions stay restorable until the retention janitor purges them
+ALTER TABLE chat_sessions
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_chat_sessions_deleted ON chat_sessions(deleted_at)
+WHERE deleted_at IS NOT NULL;
+
+-- Re-assert the cascade on session_id: databases where the column predates 004 never got
+-- the foreign key, so remove messages orphaned there before adding it
+DELETE FROM chat_messages m
+WHERE m.session_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM chat_sessions s WHERE s.id = m.session_id);
+
+ALTER TABLE chat_messages
+DROP CONSTRAINT IF EXISTS chat_messages_session_id_fkey,
+ADD CONSTRAINT chat_messages_session_id_fkey
+    FOREIGN KEY (session_id) REFERENCES chat_sessions(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_chat_messages_session_created;
+
+ALTER TABLE chat_messages
+DROP COLUMN IF EXISTS error;
@@ -0,0 +1,12 @@
+-- Assistant messages record why a question could not be answered
+ALTER TABLE chat_messages
+ADD COLUMN IF NOT EXISTS error TEXT;
+
+-- Earlier failures were only recorded in the message text
+UPDATE chat_messages
+SET error = substring(content FROM 'I encountered an error: (.*)')
+WHERE role = 'assistant'
+  AND error IS NULL
+  AND content LIKE 'I encountered an error: %';
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_session_created ON chat_messages(session_id, created_at);
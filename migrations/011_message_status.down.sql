@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_chat_messages_answers;
+
+ALTER TABLE chat_messages
+DROP COLUMN IF EXISTS latency_ms,
+DROP COLUMN IF EXISTS row_count,
+DROP COLUMN IF EXISTS status;
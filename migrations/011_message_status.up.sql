@@ -0,0 +1,25 @@
+-- Queryable outcome of each assistant answer, for analytics without unpacking JSONB
+ALTER TABLE chat_messages
+ADD COLUMN IF NOT EXISTS status VARCHAR(20)
+    CHECK (status IN ('ok', 'sql_error', 'llm_error', 'blocked', 'timeout')),
+ADD COLUMN IF NOT EXISTS row_count INTEGER,
+ADD COLUMN IF NOT EXISTS latency_ms BIGINT;
+
+-- Best-effort backfill: failures before 010 that were not reflected in the message text stay 'ok'
+UPDATE chat_messages
+SET status = CASE
+        WHEN error IS NULL THEN 'ok'
+        WHEN error LIKE 'blocked SQL pattern%'
+            OR error LIKE 'only SELECT statements allowed%'
+            OR error LIKE 'multiple statements not allowed%' THEN 'blocked'
+        WHEN error LIKE '%deadline exceeded%' THEN 'timeout'
+        WHEN error LIKE 'failed to generate SQL%'
+            OR error LIKE 'failed to get LLM provider%' THEN 'llm_error'
+        ELSE 'sql_error'
+    END,
+    row_count = CASE WHEN jsonb_typeof(result->'row_count') = 'number' THEN (result->>'row_count')::INTEGER END,
+    latency_ms = CASE WHEN jsonb_typeof(metadata->'execution_time_ms') = 'number' THEN (metadata->>'execution_time_ms')::BIGINT END
+WHERE role = 'assistant' AND status IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_answers ON chat_messages(workspace_id, created_at)
+WHERE role = 'assistant';
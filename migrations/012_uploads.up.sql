@@ -0,0 +1,15 @@
+-- Files uploaded to the server's upload directory, owned by a workspace.
+-- A file is linked to a connection when a SQLite connection in the same workspace opens it.
+CREATE TABLE IF NOT EXISTS uploads (
+    id UUID PRIMARY KEY,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    original_name VARCHAR(255) NOT NULL,
+    file_path TEXT NOT NULL UNIQUE,
+    size_bytes BIGINT NOT NULL,
+    -- Set by the orphan sweep while no connection uses the file
+    orphaned_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_workspace ON uploads(workspace_id, created_at DESC);
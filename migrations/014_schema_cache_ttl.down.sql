@@ -0,0 +1 @@
+ALTER TABLE connections DROP COLUMN IF EXISTS schema_cache_ttl_seconds;
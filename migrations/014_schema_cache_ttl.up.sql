@@ -0,0 +1,5 @@
+-- Per-connection schema cache lifetime in seconds. NULL uses SCHEMA_CACHE_TTL and 0
+-- disables caching for the connection.
+ALTER TABLE connections
+    ADD COLUMN IF NOT EXISTS schema_cache_ttl_seconds INTEGER
+        CHECK (schema_cache_ttl_seconds >= 0);
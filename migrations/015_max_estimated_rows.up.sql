@@ -0,0 +1,5 @@
+-- Per-connection cost gate threshold in estimated rows. NULL uses MAX_ESTIMATED_ROWS
+-- and 0 disables the gate for the connection.
+ALTER TABLE connections
+    ADD COLUMN IF NOT EXISTS max_estimated_rows BIGINT
+        CHECK (max_estimated_rows >= 0);
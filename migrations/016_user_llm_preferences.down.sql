@@ -0,0 +1,3 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS preferred_llm_provider,
+DROP COLUMN IF EXISTS preferred_llm_model;
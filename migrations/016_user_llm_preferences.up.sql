@@ -0,0 +1,5 @@
+-- Provider and model used for a user's queries that name none, ahead of the
+-- workspace defaults. Empty means no preference.
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS preferred_llm_provider VARCHAR(50) DEFAULT '',
+ADD COLUMN IF NOT EXISTS preferred_llm_model VARCHAR(255) DEFAULT '';
@@ -0,0 +1,16 @@
+-- Stored SQL statements with {{name}} placeholders, run with parameter values
+-- instead of a question to the LLM. parameters holds the declared placeholders.
+CREATE TABLE IF NOT EXISTS query_templates (
+    id UUID PRIMARY KEY,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    connection_id UUID NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    sql TEXT NOT NULL,
+    parameters JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_templates_workspace ON query_templates(workspace_id);
@@ -0,0 +1,5 @@
+-- How tables are ordered in the schema DDL given to the LLM, which decides the
+-- tables kept when it is truncated: largest first, by name, or recently queried first.
+ALTER TABLE connections
+    ADD COLUMN IF NOT EXISTS schema_order TEXT NOT NULL DEFAULT 'size'
+        CHECK (schema_order IN ('size', 'alphabetical', 'recent'));
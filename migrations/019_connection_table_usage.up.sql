@@ -0,0 +1,9 @@
+-- Tables read by the successful queries of each connection, so the most used ones
+-- are kept when the schema given to the LLM is truncated
+CREATE TABLE IF NOT EXISTS connection_table_usage (
+    connection_id UUID NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    table_name TEXT NOT NULL,
+    query_count BIGINT NOT NULL DEFAULT 0,
+    last_queried_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (connection_id, table_name)
+);
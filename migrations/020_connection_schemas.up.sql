@@ -0,0 +1,8 @@
+-- The last schema loaded from each connection, read when the Redis cache misses so a
+-- flushed or restarted Redis does not send every connection back to the database
+CREATE TABLE IF NOT EXISTS connection_schemas (
+    connection_id UUID PRIMARY KEY REFERENCES connections(id) ON DELETE CASCADE,
+    schema JSONB NOT NULL,
+    hash TEXT NOT NULL,
+    refreshed_at TIMESTAMPTZ NOT NULL
+);
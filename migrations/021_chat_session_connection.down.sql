@@ -0,0 +1 @@
+ALTER TABLE chat_sessions DROP COLUMN IF EXISTS connection_id;
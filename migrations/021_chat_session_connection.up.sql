@@ -0,0 +1,15 @@
+-- The connection a session's questions run against, set by its first question
+ALTER TABLE chat_sessions
+    ADD COLUMN IF NOT EXISTS connection_id UUID REFERENCES connections(id) ON DELETE SET NULL;
+
+-- Existing sessions take the connection of their latest answer, if it still exists
+UPDATE chat_sessions s
+SET connection_id = latest.connection_id
+FROM (
+    SELECT DISTINCT ON (m.session_id) m.session_id, c.id AS connection_id
+    FROM chat_messages m
+    JOIN connections c ON c.id::text = m.metadata->>'connection_id'
+    WHERE m.session_id IS NOT NULL
+    ORDER BY m.session_id, m.created_at DESC
+) latest
+WHERE s.id = latest.session_id AND s.connection_id IS NULL;
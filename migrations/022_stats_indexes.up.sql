@@ -0,0 +1,4 @@
+-- Platform statistics read answers and sign-ups across all workspaces by creation time
+CREATE INDEX IF NOT EXISTS idx_chat_messages_answers_created ON chat_messages(created_at)
+WHERE role = 'assistant';
+CREATE INDEX IF NOT EXISTS idx_users_created ON users(created_at);
@@ -0,0 +1,15 @@
+-- Read-only links to a stored answer. Only a hash of the token is kept, so the link
+-- cannot be rebuilt from the database; passcode_hash is a bcrypt hash when set.
+CREATE TABLE IF NOT EXISTS shared_results (
+    id UUID PRIMARY KEY,
+    token_hash BYTEA NOT NULL UNIQUE,
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES chat_messages(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    passcode_hash TEXT,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_shared_results_workspace ON shared_results(workspace_id, created_at DESC);
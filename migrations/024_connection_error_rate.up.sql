@@ -0,0 +1,5 @@
+-- Per-connection error rate at which the connection is flagged degraded. NULL uses
+-- CONNECTION_ALERT_ERROR_RATE and 0 disables the alert for the connection.
+ALTER TABLE connections
+    ADD COLUMN IF NOT EXISTS error_rate_threshold DOUBLE PRECISION
+        CHECK (error_rate_threshold >= 0 AND error_rate_threshold <= 1);
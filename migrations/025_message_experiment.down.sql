@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_chat_messages_experiment;
+ALTER TABLE chat_messages
+DROP COLUMN IF EXISTS experiment_arm,
+DROP COLUMN IF EXISTS experiment;
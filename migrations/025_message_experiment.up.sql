@@ -0,0 +1,7 @@
+-- Experiment arm that gave each answer, for comparing arms without unpacking JSONB
+ALTER TABLE chat_messages
+ADD COLUMN IF NOT EXISTS experiment VARCHAR(63),
+ADD COLUMN IF NOT EXISTS experiment_arm VARCHAR(63);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_experiment ON chat_messages(workspace_id, experiment, created_at)
+WHERE experiment IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Differences found between successive loads of each connection's schema, so dropped
+-- tables and columns are noticed before saved queries break on them
+CREATE TABLE IF NOT EXISTS schema_changes (
+    id UUID PRIMARY KEY,
+    connection_id UUID NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    changes JSONB NOT NULL,
+    destructive BOOLEAN NOT NULL DEFAULT FALSE,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_schema_changes_connection ON schema_changes(connection_id, detected_at DESC);
@@ -0,0 +1,5 @@
+-- Per-connection row limit of queries without a LIMIT of their own. NULL uses
+-- DEFAULT_LIMIT and 0 limits them to max_rows.
+ALTER TABLE connections
+    ADD COLUMN IF NOT EXISTS default_limit INTEGER
+        CHECK (default_limit >= 0 AND default_limit <= 10000);
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS muted_notifications;
+
+DROP TABLE IF EXISTS notifications;
@@ -0,0 +1,4 @@
+ALTER TABLE connections
+    DROP COLUMN IF EXISTS replica_use,
+    DROP COLUMN IF EXISTS replica_port,
+    DROP COLUMN IF EXISTS replica_host;
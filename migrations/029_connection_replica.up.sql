@@ -0,0 +1,8 @@
+-- Optional read replica per connection. replica_port 0 uses the primary's port;
+-- replica_use says whether the replica serves queries or schema introspection.
+ALTER TABLE connections
+    ADD COLUMN IF NOT EXISTS replica_host VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS replica_port INTEGER NOT NULL DEFAULT 0
+        CHECK (replica_port >= 0 AND replica_port <= 65535),
+    ADD COLUMN IF NOT EXISTS replica_use TEXT NOT NULL DEFAULT 'queries'
+        CHECK (replica_use IN ('queries', 'schema'));
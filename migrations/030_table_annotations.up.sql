@@ -0,0 +1,12 @@
+-- Users' corrections of what tables are for: a role replacing the one guessed from the
+-- table's shape, and a one-line description
+CREATE TABLE IF NOT EXISTS table_annotations (
+    connection_id UUID NOT NULL REFERENCES connections(id) ON DELETE CASCADE,
+    schema_name VARCHAR(255) NOT NULL DEFAULT '',
+    table_name VARCHAR(255) NOT NULL,
+    role VARCHAR(20),
+    description VARCHAR(500),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (connection_id, schema_name, table_name)
+);